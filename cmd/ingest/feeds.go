@@ -0,0 +1,231 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/your-org/ai-sa-assistant/internal/acl"
+	"github.com/your-org/ai-sa-assistant/internal/chroma"
+	"github.com/your-org/ai-sa-assistant/internal/chunker"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/feeds"
+	"github.com/your-org/ai-sa-assistant/internal/metadata"
+	"github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
+)
+
+const (
+	// releaseNoteDocType is the metadata type of ingested feed items
+	releaseNoteDocType = "release_note"
+	// feedDocPath marks metadata entries that come from a feed rather than a local file
+	feedDocPath = "feed"
+)
+
+// runFeedIngestionPipeline ingests the release notes in a feed file, or a mirror directory
+// of feed files, into the knowledge base. Items already in the metadata store are skipped
+// unless forceReindex is set.
+func runFeedIngestionPipeline(
+	cfg *config.Config,
+	kb config.KnowledgeBaseConfig,
+	feedsPath string,
+	chunkSize int,
+	forceReindex bool,
+	logger *zap.Logger,
+) (*IngestionStats, error) {
+	ctx := context.Background()
+
+	parsedFeeds, err := feeds.LoadPath(feedsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load feeds: %w", err)
+	}
+
+	openaiClient, err := openai.NewClientWithEndpoint(cfg.OpenAI.APIKey, cfg.OpenAI.Endpoint, logger,
+		resilience.DefaultTimeoutConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize OpenAI client: %w", err)
+	}
+
+	chromaClient := chroma.NewClient(cfg.Chroma.URL, kb.CollectionName)
+	if err := chromaClient.HealthCheck(ctx); err != nil {
+		return nil, fmt.Errorf("ChromaDB health check failed: %w", err)
+	}
+
+	if err := chromaClient.CreateCollection(ctx, kb.CollectionName, map[string]interface{}{
+		"description":    "Cloud provider release notes",
+		"knowledge_base": kb.Name,
+		"created_at":     time.Now().Format(time.RFC3339),
+	}); err != nil {
+		logger.Warn("Failed to create collection (may already exist)", zap.Error(err))
+	}
+
+	metadataStore, err := metadata.NewStore(cfg.Metadata.DBPath, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize metadata store: %w", err)
+	}
+	defer func() {
+		if err := metadataStore.Close(); err != nil {
+			logger.Warn("Failed to close metadata store", zap.Error(err))
+		}
+	}()
+
+	pipeline := &IngestionPipeline{
+		openaiClient:  openaiClient,
+		chromaClient:  chromaClient,
+		metadataStore: metadataStore,
+		logger:        logger,
+		chunkSize:     chunkSize,
+		knowledgeBase: kb,
+	}
+
+	stats := &IngestionStats{}
+	for _, feed := range parsedFeeds {
+		logger.Info("Processing feed",
+			zap.String("feed", feed.Title),
+			zap.String("provider", feed.Provider),
+			zap.Int("items", len(feed.Items)))
+
+		for _, item := range feed.Items {
+			docID := item.DocID()
+			if !forceReindex {
+				existing, err := metadataStore.GetMetadataByDocIDWithNamespace(docID, kb.MetadataNamespace)
+				if err == nil && existing != nil {
+					stats.SkippedCount++
+					continue
+				}
+			}
+
+			stats.ProcessedCount++
+			chunks, err := pipeline.processFeedItem(ctx, item)
+			if err != nil {
+				logger.Error("Failed to process release note",
+					zap.String("doc_id", docID),
+					zap.String("title", item.Title),
+					zap.Error(err))
+				stats.FailureCount++
+				continue
+			}
+			stats.TotalChunks += chunks
+			stats.SuccessCount++
+		}
+	}
+
+	logger.Info("Feed ingestion completed",
+		zap.Int("feeds", len(parsedFeeds)),
+		zap.Int("items_processed", stats.ProcessedCount),
+		zap.Int("successful", stats.SuccessCount),
+		zap.Int("failed", stats.FailureCount),
+		zap.Int("skipped", stats.SkippedCount),
+		zap.Int("total_chunks", stats.TotalChunks))
+
+	// Bump the collection version so retrieval caches built on the old contents are dropped
+	if stats.SuccessCount > 0 {
+		if version, err := metadataStore.BumpCollectionVersion(kb.CollectionName); err != nil {
+			logger.Warn("Failed to bump collection version", zap.Error(err))
+		} else {
+			stats.CollectionVersion = version
+		}
+	}
+
+	if stats.SuccessCount == 0 && stats.ProcessedCount > 0 {
+		return stats, fmt.Errorf("no release notes were successfully processed")
+	}
+
+	return stats, nil
+}
+
+// processFeedItem embeds a release note, stores it in ChromaDB and records its metadata
+func (p *IngestionPipeline) processFeedItem(ctx context.Context, item feeds.Item) (int, error) {
+	chunks := chunker.Splitter(item.Text(), p.chunkSize)
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+
+	embeddings, err := p.generateEmbeddings(ctx, chunks)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate embeddings: %w", err)
+	}
+
+	documents := buildFeedDocuments(item, chunks, p.knowledgeBase)
+	if err := p.chromaClient.AddDocuments(ctx, documents, embeddings); err != nil {
+		return 0, fmt.Errorf("failed to store documents in ChromaDB: %w", err)
+	}
+
+	if err := p.metadataStore.AddMetadata(feedMetadataEntry(item, p.knowledgeBase)); err != nil {
+		return 0, fmt.Errorf("failed to store metadata: %w", err)
+	}
+
+	return len(chunks), nil
+}
+
+// buildFeedDocuments converts the chunks of a release note into ChromaDB documents. The
+// publish date is stamped on every chunk so retrieval can judge freshness.
+func buildFeedDocuments(item feeds.Item, chunks []string, kb config.KnowledgeBaseConfig) []chroma.Document {
+	docID := item.DocID()
+	published, publishedUnix := "", ""
+	if !item.Published.IsZero() {
+		published = item.Published.UTC().Format(time.RFC3339)
+		publishedUnix = strconv.FormatInt(item.Published.Unix(), 10)
+	}
+
+	documents := make([]chroma.Document, len(chunks))
+	for i, chunk := range chunks {
+		documents[i] = chroma.Document{
+			ID:      fmt.Sprintf("%s_chunk_%d", docID, i),
+			Content: chunk,
+			Metadata: map[string]string{
+				"doc_id":         docID,
+				"title":          item.Title,
+				"platform":       item.Provider,
+				"type":           releaseNoteDocType,
+				"source_url":     item.Link,
+				"path":           feedDocPath,
+				"feed":           item.FeedTitle,
+				"published":      published,
+				"published_unix": publishedUnix,
+				"chunk_index":    fmt.Sprintf("%d", i),
+				"chunk_count":    fmt.Sprintf("%d", len(chunks)),
+				"tags":           strings.Join(item.Categories, ","),
+				"knowledge_base": kb.Name,
+				"classification": string(acl.ClassificationPublic),
+				"allowed_groups": "",
+				"allowed_users":  "",
+			},
+		}
+	}
+	return documents
+}
+
+// feedMetadataEntry returns the metadata store entry for a release note. Release notes
+// are published by the providers, so they are public.
+func feedMetadataEntry(item feeds.Item, kb config.KnowledgeBaseConfig) metadata.Entry {
+	return metadata.Entry{
+		DocID:          item.DocID(),
+		Title:          item.Title,
+		Platform:       item.Provider,
+		Type:           releaseNoteDocType,
+		SourceURL:      item.Link,
+		Path:           feedDocPath,
+		Tags:           item.Categories,
+		Namespace:      kb.MetadataNamespace,
+		Classification: string(acl.ClassificationPublic),
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/feeds"
+)
+
+func TestBuildFeedDocuments(t *testing.T) {
+	kb := config.KnowledgeBaseConfig{Name: "freshness", CollectionName: "cloud_release_notes", MetadataNamespace: "freshness"}
+	item := feeds.Item{
+		ID:         "a1b2c3",
+		Title:      "Amazon EKS now supports Kubernetes version 1.31",
+		Link:       "https://aws.amazon.com/about-aws/whats-new/2024/09/amazon-eks-kubernetes-version-1-31/",
+		Summary:    "You can now create EKS clusters running Kubernetes 1.31.",
+		Categories: []string{"containers", "eks"},
+		Published:  time.Date(2024, 9, 26, 17, 0, 0, 0, time.UTC),
+		Provider:   feeds.ProviderAWS,
+		FeedTitle:  "Recent Announcements",
+	}
+
+	documents := buildFeedDocuments(item, []string{item.Text()}, kb)
+	require.Len(t, documents, 1)
+
+	doc := documents[0]
+	assert.Equal(t, item.DocID()+"_chunk_0", doc.ID)
+	assert.True(t, strings.HasPrefix(doc.Content, item.Title))
+	assert.Equal(t, "2024-09-26T17:00:00Z", doc.Metadata["published"])
+	assert.Equal(t, "1727370000", doc.Metadata["published_unix"])
+	assert.Equal(t, "aws", doc.Metadata["platform"])
+	assert.Equal(t, releaseNoteDocType, doc.Metadata["type"])
+	assert.Equal(t, item.Link, doc.Metadata["source_url"])
+	assert.Equal(t, "containers,eks", doc.Metadata["tags"])
+	assert.Equal(t, "freshness", doc.Metadata["knowledge_base"])
+	assert.Equal(t, "public", doc.Metadata["classification"])
+
+	// Undated items are stored without a publish date so they never count as fresh
+	item.Published = time.Time{}
+	documents = buildFeedDocuments(item, []string{item.Text()}, kb)
+	assert.Equal(t, "", documents[0].Metadata["published"])
+}
+
+func TestFeedMetadataEntry(t *testing.T) {
+	kb := config.KnowledgeBaseConfig{Name: "freshness", CollectionName: "cloud_release_notes", MetadataNamespace: "freshness"}
+	item := feeds.Item{
+		ID:       "urn:uuid:5f0e",
+		Title:    "Generally available: Azure Site Recovery",
+		Link:     "https://azure.microsoft.com/en-us/updates/asr/",
+		Provider: feeds.ProviderAzure,
+	}
+
+	entry := feedMetadataEntry(item, kb)
+	assert.Equal(t, item.DocID(), entry.DocID)
+	assert.Equal(t, "azure", entry.Platform)
+	assert.Equal(t, releaseNoteDocType, entry.Type)
+	assert.Equal(t, item.Link, entry.SourceURL)
+	assert.Equal(t, "freshness", entry.Namespace)
+	assert.Equal(t, "public", entry.Classification)
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/your-org/ai-sa-assistant/internal/config"
 	"github.com/your-org/ai-sa-assistant/internal/metadata"
 	"github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
 )
 
 const (
@@ -47,6 +48,7 @@ type IngestionPipeline struct {
 	metadataStore *metadata.Store
 	logger        *zap.Logger
 	chunkSize     int
+	knowledgeBase config.KnowledgeBaseConfig
 }
 
 // IngestionStats represents statistics from the ingestion process
@@ -56,13 +58,17 @@ type IngestionStats struct {
 	FailureCount   int
 	TotalChunks    int
 	SkippedCount   int
+	// CollectionVersion is the collection version recorded at the end of the run
+	CollectionVersion int64
 }
 
 var (
-	docsPath     string
-	configPath   string
-	chunkSize    int
-	forceReindex bool
+	docsPath      string
+	configPath    string
+	chunkSize     int
+	forceReindex  bool
+	knowledgeBase string
+	feedsPath     string
 )
 
 func main() {
@@ -83,13 +89,17 @@ This tool is essential for populating the knowledge base with synthetic document
 	rootCmd.Flags().StringVarP(&configPath, "config", "c", "./configs/config.yaml", "Path to configuration file")
 	rootCmd.Flags().IntVarP(&chunkSize, "chunk-size", "s", defaultChunkSize, "Chunk size in words")
 	rootCmd.Flags().BoolVarP(&forceReindex, "force-reindex", "f", false, "Force re-indexing of all documents")
+	rootCmd.Flags().StringVarP(&knowledgeBase, "knowledge-base", "k", config.DefaultKnowledgeBase,
+		"Knowledge base to ingest documents into")
+	rootCmd.Flags().StringVar(&feedsPath, "feeds", "",
+		"Ingest release notes from an RSS/Atom feed file or mirror directory instead of documents")
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
-func runIngestionCommand(_ *cobra.Command, _ []string) error {
+func runIngestionCommand(cmd *cobra.Command, _ []string) error {
 	logger, loggerErr := zap.NewProduction()
 	if loggerErr != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", loggerErr)
@@ -122,14 +132,48 @@ func runIngestionCommand(_ *cobra.Command, _ []string) error {
 		logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
 
+	// Release notes go to the freshness knowledge base unless another one is requested
+	kbName := knowledgeBase
+	if feedsPath != "" && !cmd.Flags().Changed("knowledge-base") {
+		kbName = cfg.WebSearch.ReleaseNotes.KnowledgeBase
+	}
+
+	kb, err := resolveKnowledgeBase(cfg, kbName)
+	if err != nil {
+		logger.Fatal("Invalid knowledge base", zap.Error(err))
+	}
+
+	if feedsPath != "" {
+		logger.Info("Starting release note feed ingestion",
+			zap.String("feeds_path", feedsPath),
+			zap.String("knowledge_base", kb.Name),
+			zap.String("collection_name", kb.CollectionName),
+			zap.Bool("force_reindex", forceReindex))
+
+		stats, err := runFeedIngestionPipeline(cfg, kb, feedsPath, chunkSize, forceReindex, logger)
+		if err != nil {
+			logger.Fatal("Feed ingestion failed", zap.Error(err))
+		}
+
+		logger.Info("Feed ingestion completed successfully",
+			zap.Int("total_processed", stats.ProcessedCount),
+			zap.Int("successful", stats.SuccessCount),
+			zap.Int("failed", stats.FailureCount),
+			zap.Int("skipped", stats.SkippedCount),
+			zap.Int("total_chunks", stats.TotalChunks))
+		return nil
+	}
+
 	logger.Info("Starting ingestion service",
 		zap.String("docs_path", docsPath),
 		zap.String("chroma_url", cfg.Chroma.URL),
-		zap.String("collection_name", cfg.Chroma.CollectionName),
+		zap.String("knowledge_base", kb.Name),
+		zap.String("collection_name", kb.CollectionName),
+		zap.String("metadata_namespace", kb.MetadataNamespace),
 		zap.Int("chunk_size", chunkSize),
 		zap.Bool("force_reindex", forceReindex))
 
-	stats, err := runIngestionPipeline(cfg, docsPath, chunkSize, forceReindex, logger)
+	stats, err := runIngestionPipeline(cfg, kb, docsPath, chunkSize, forceReindex, logger)
 	if err != nil {
 		logger.Fatal("Ingestion pipeline failed", zap.Error(err))
 	}
@@ -144,8 +188,22 @@ func runIngestionCommand(_ *cobra.Command, _ []string) error {
 	return nil
 }
 
+// resolveKnowledgeBase looks up the knowledge base that ingested documents are stored in
+func resolveKnowledgeBase(cfg *config.Config, name string) (config.KnowledgeBaseConfig, error) {
+	if name == "" {
+		name = config.DefaultKnowledgeBase
+	}
+
+	kb, ok := cfg.Chroma.GetKnowledgeBase(name)
+	if !ok {
+		return config.KnowledgeBaseConfig{}, fmt.Errorf("knowledge base %q is not configured", name)
+	}
+	return kb, nil
+}
+
 func runIngestionPipeline(
 	cfg *config.Config,
+	kb config.KnowledgeBaseConfig,
 	docsPath string,
 	chunkSize int,
 	_ bool,
@@ -154,13 +212,14 @@ func runIngestionPipeline(
 	ctx := context.Background()
 
 	// Initialize OpenAI client
-	openaiClient, err := openai.NewClient(cfg.OpenAI.APIKey, logger)
+	openaiClient, err := openai.NewClientWithEndpoint(cfg.OpenAI.APIKey, cfg.OpenAI.Endpoint, logger,
+		resilience.DefaultTimeoutConfig())
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize OpenAI client: %w", err)
 	}
 
-	// Initialize ChromaDB client
-	chromaClient := chroma.NewClient(cfg.Chroma.URL, cfg.Chroma.CollectionName)
+	// Initialize ChromaDB client for the target knowledge base
+	chromaClient := chroma.NewClient(cfg.Chroma.URL, kb.CollectionName)
 
 	// Health check ChromaDB
 	if err := chromaClient.HealthCheck(ctx); err != nil {
@@ -168,9 +227,10 @@ func runIngestionPipeline(
 	}
 
 	// Create collection if it doesn't exist
-	if err := chromaClient.CreateCollection(ctx, cfg.Chroma.CollectionName, map[string]interface{}{
-		"description": "AI SA Assistant document embeddings",
-		"created_at":  time.Now().Format(time.RFC3339),
+	if err := chromaClient.CreateCollection(ctx, kb.CollectionName, map[string]interface{}{
+		"description":    "AI SA Assistant document embeddings",
+		"knowledge_base": kb.Name,
+		"created_at":     time.Now().Format(time.RFC3339),
 	}); err != nil {
 		logger.Warn("Failed to create collection (may already exist)", zap.Error(err))
 	}
@@ -188,7 +248,7 @@ func runIngestionPipeline(
 
 	// Load metadata from JSON file
 	metadataPath := filepath.Join(docsPath, "metadata.json")
-	if err := metadataStore.LoadFromJSON(metadataPath); err != nil {
+	if err := metadataStore.LoadFromJSONWithNamespace(metadataPath, kb.MetadataNamespace); err != nil {
 		return nil, fmt.Errorf("failed to load metadata from JSON: %w", err)
 	}
 
@@ -199,6 +259,7 @@ func runIngestionPipeline(
 		metadataStore: metadataStore,
 		logger:        logger,
 		chunkSize:     chunkSize,
+		knowledgeBase: kb,
 	}
 
 	// Get all metadata entries
@@ -212,6 +273,11 @@ func runIngestionPipeline(
 
 	for i := range allMetadata {
 		entry := &allMetadata[i]
+		// Only ingest documents that belong to the target knowledge base
+		if entry.Namespace != kb.MetadataNamespace {
+			continue
+		}
+
 		// Skip external documents (they don't have local files)
 		if entry.Path == "external" {
 			logger.Debug("Skipping external document", zap.String("doc_id", entry.DocID))
@@ -254,6 +320,13 @@ func runIngestionPipeline(
 		zap.Int("skipped", stats.SkippedCount),
 		zap.Int("total_chunks", stats.TotalChunks))
 
+	// Bump the collection version so retrieval caches built on the old contents are dropped
+	if version, err := metadataStore.BumpCollectionVersion(kb.CollectionName); err != nil {
+		logger.Warn("Failed to bump collection version", zap.Error(err))
+	} else {
+		stats.CollectionVersion = version
+	}
+
 	// Get metadata store statistics
 	dbStats, err := metadataStore.GetStats()
 	if err != nil {
@@ -356,6 +429,12 @@ func (p *IngestionPipeline) processDocument(
 				"chunk_index":    fmt.Sprintf("%d", i),
 				"chunk_count":    fmt.Sprintf("%d", len(chunks)),
 				"tags":           strings.Join(entry.Tags, ","),
+				"knowledge_base": p.knowledgeBase.Name,
+				// Access control is stamped on every chunk so retrieval can enforce it
+				// even when the metadata store has no entry for the document
+				"classification": entry.Classification,
+				"allowed_groups": strings.Join(entry.AllowedGroups, ","),
+				"allowed_users":  strings.Join(entry.AllowedUsers, ","),
 			},
 		}
 	}
@@ -966,6 +966,31 @@ func processDocumentWithMocks(
 }
 
 // Test IngestionStats struct
+func TestResolveKnowledgeBase(t *testing.T) {
+	cfg := &config.Config{
+		Chroma: config.ChromaConfig{
+			CollectionName: "cloud_assistant",
+			KnowledgeBases: []config.KnowledgeBaseConfig{
+				{Name: "customer", CollectionName: "customer_docs", MetadataNamespace: "customer"},
+			},
+		},
+	}
+
+	kb, err := resolveKnowledgeBase(cfg, "")
+	assert.NoError(t, err)
+	assert.Equal(t, config.DefaultKnowledgeBase, kb.Name)
+	assert.Equal(t, "cloud_assistant", kb.CollectionName)
+
+	kb, err = resolveKnowledgeBase(cfg, "Customer")
+	assert.NoError(t, err)
+	assert.Equal(t, "customer_docs", kb.CollectionName)
+	assert.Equal(t, "customer", kb.MetadataNamespace)
+
+	_, err = resolveKnowledgeBase(cfg, "team")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not configured")
+}
+
 func TestIngestionStats(t *testing.T) {
 	stats := &IngestionStats{
 		ProcessedCount: 5,
@@ -0,0 +1,127 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/your-org/ai-sa-assistant/internal/acl"
+	"github.com/your-org/ai-sa-assistant/internal/chroma"
+	"github.com/your-org/ai-sa-assistant/internal/classifier"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/diagram"
+	"github.com/your-org/ai-sa-assistant/internal/health"
+	"github.com/your-org/ai-sa-assistant/internal/session"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"github.com/your-org/ai-sa-assistant/internal/teams"
+)
+
+// newRestrictedChromaServer serves a public guide and a SOW restricted to the account team
+func newRestrictedChromaServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/v1/collections/")
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(chroma.Collection{Name: path, ID: "uuid-" + path})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(chroma.SearchResponse{
+			IDs:       [][]string{{"public-guide_chunk_0", "acme-sow_chunk_0"}},
+			Documents: [][]string{{"AWS migration guide", "Acme AWS migration statement of work"}},
+			Metadatas: [][]map[string]interface{}{{
+				{"title": "Guide"},
+				{"title": "Acme SOW", metadataKeyAllowedGroups: "acme-account-team"},
+			}},
+			Distances: [][]float64{{0.1, 0.15}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestGroupRestrictedDocumentThroughOrchestrator sends a query through the Teams
+// orchestrator to the retrieve service and checks which documents reach synthesis
+func TestGroupRestrictedDocumentThroughOrchestrator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	synthesizedDocs := func(trustedProxyHeaders bool, identity acl.Identity) []string {
+		deps := newFederatedTestDeps(t, newRestrictedChromaServer(t).URL)
+		deps.Classifier = classifier.NewQueryClassifier()
+		deps.Config.ACL.TrustedProxyHeaders = trustedProxyHeaders
+
+		router := gin.New()
+		router.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+		router.POST("/search", createSearchHandler(deps))
+		retrieveServer := httptest.NewServer(router)
+		t.Cleanup(retrieveServer.Close)
+
+		var docIDs []string
+		synthesizeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			var request struct {
+				Chunks []struct {
+					DocID string `json:"doc_id"`
+				} `json:"chunks"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			for _, chunk := range request.Chunks {
+				docIDs = append(docIDs, chunk.DocID)
+			}
+			_ = json.NewEncoder(w).Encode(synth.SynthesisResponse{MainText: "Answer"})
+		}))
+		t.Cleanup(synthesizeServer.Close)
+
+		sessionManager, err := session.NewManager(session.Config{
+			StorageType: session.MemoryStorageType,
+			DefaultTTL:  30 * time.Minute,
+			MaxSessions: 10,
+		}, logger)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = sessionManager.Close() })
+
+		orchestrator := teams.NewOrchestrator(&config.Config{
+			Services: config.ServicesConfig{RetrieveURL: retrieveServer.URL, SynthesizeURL: synthesizeServer.URL},
+		}, health.NewManager("test", "1.0.0", logger),
+			diagram.NewRenderer(diagram.RendererConfig{MermaidInkURL: "https://mermaid.ink/img", Timeout: 30}, logger),
+			sessionManager, logger)
+
+		result := orchestrator.ProcessQuery(acl.WithIdentity(context.Background(), identity),
+			"What does the Acme AWS migration SOW cover?", identity.UserID)
+		require.NoError(t, result.Error)
+		return docIDs
+	}
+
+	member := acl.Identity{UserID: "alice", Groups: []string{"acme-account-team"}, Clearance: acl.DefaultClassification}
+	outsider := acl.Identity{UserID: "bob", Clearance: acl.DefaultClassification}
+
+	assert.ElementsMatch(t, []string{"public-guide", "acme-sow"}, synthesizedDocs(true, member))
+	assert.Equal(t, []string{"public-guide"}, synthesizedDocs(true, outsider))
+	assert.Equal(t, []string{"public-guide"}, synthesizedDocs(false, member),
+		"without trusted identity headers the retrieve service ignores the forwarded groups")
+}
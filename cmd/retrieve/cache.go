@@ -0,0 +1,177 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/lru"
+	"go.uber.org/zap"
+)
+
+// cachedRetrieval is the knowledge base portion of a search response kept in the cache.
+// Web results are not cached here since the web search service has its own cache.
+type cachedRetrieval struct {
+	Chunks            []SearchChunk
+	TotalResults      int
+	FallbackTriggered bool
+	FallbackReason    string
+	KnowledgeBases    []string
+}
+
+// RetrievalCache caches retrieval results and query embeddings. Both caches are
+// purged whenever a collection version change is observed, which happens after
+// every ingest run.
+type RetrievalCache struct {
+	results    *lru.Cache[cachedRetrieval]
+	embeddings *lru.Cache[[]float32]
+	logger     *zap.Logger
+
+	mu            sync.Mutex
+	versions      map[string]int64
+	invalidations uint64
+}
+
+// NewRetrievalCache creates the retrieval caches, returning nil when caching is disabled
+func NewRetrievalCache(cfg config.RetrievalCacheConfig, logger *zap.Logger) *RetrievalCache {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &RetrievalCache{
+		results:    lru.New[cachedRetrieval](cfg.MaxEntries, time.Duration(cfg.TTLSeconds)*time.Second),
+		embeddings: lru.New[[]float32](cfg.EmbeddingMaxEntries, time.Duration(cfg.EmbeddingTTLSeconds)*time.Second),
+		logger:     logger,
+		versions:   make(map[string]int64),
+	}
+}
+
+// ObserveVersions records the current collection versions and purges both caches
+// when any collection has changed since it was last seen
+func (c *RetrievalCache) ObserveVersions(versions map[string]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := false
+	for collection, version := range versions {
+		previous, seen := c.versions[collection]
+		if seen && previous != version {
+			changed = true
+		}
+		c.versions[collection] = version
+	}
+
+	if changed {
+		c.results.Purge()
+		c.embeddings.Purge()
+		c.invalidations++
+		c.logger.Info("Collection version changed, retrieval caches purged",
+			zap.Any("collection_versions", versions))
+	}
+}
+
+// Stats returns the counters of both caches for the health endpoint
+func (c *RetrievalCache) Stats() map[string]interface{} {
+	c.mu.Lock()
+	invalidations := c.invalidations
+	versions := make(map[string]int64, len(c.versions))
+	for collection, version := range c.versions {
+		versions[collection] = version
+	}
+	c.mu.Unlock()
+
+	return map[string]interface{}{
+		"enabled":             true,
+		"results":             c.results.Stats(),
+		"embeddings":          c.embeddings.Stats(),
+		"invalidations":       invalidations,
+		"collection_versions": versions,
+	}
+}
+
+// normalizeQuery folds case, whitespace and trailing punctuation so that
+// near-identical questions share cache entries
+func normalizeQuery(query string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	return strings.TrimRight(normalized, "?!.")
+}
+
+// retrievalCacheKey builds the cache key for a search from the normalized query, filters,
+// knowledge bases, collection versions and caller identity. The identity is part of the
+// key so cached results never cross access control boundaries.
+func retrievalCacheKey(searchReq SearchRequest, knowledgeBases []*KnowledgeBase, versions map[string]int64) string {
+	kbParts := make([]string, 0, len(knowledgeBases))
+	for _, kb := range knowledgeBases {
+		kbParts = append(kbParts, kb.Name)
+	}
+	sort.Strings(kbParts)
+
+	versionParts := make([]string, 0, len(versions))
+	for collection, version := range versions {
+		versionParts = append(versionParts, fmt.Sprintf("%s=%d", collection, version))
+	}
+	sort.Strings(versionParts)
+
+	groups := make([]string, 0, len(searchReq.Identity.Groups))
+	for _, group := range searchReq.Identity.Groups {
+		groups = append(groups, strings.ToLower(group))
+	}
+	sort.Strings(groups)
+
+	// json.Marshal sorts map keys, giving a stable encoding of the filters
+	filters, err := json.Marshal(searchReq.Filters)
+	if err != nil {
+		filters = []byte(fmt.Sprintf("%v", searchReq.Filters))
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{
+		normalizeQuery(searchReq.Query),
+		string(filters),
+		strings.Join(kbParts, ","),
+		strings.Join(versionParts, ","),
+		strings.ToLower(searchReq.Identity.UserID),
+		strings.Join(groups, ","),
+		string(searchReq.Identity.Clearance),
+	} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// collectionVersions reads the current version of every collection backing the knowledge bases
+func collectionVersions(knowledgeBases []*KnowledgeBase, deps *ServiceDependencies) (map[string]int64, error) {
+	versions := make(map[string]int64, len(knowledgeBases))
+	for _, kb := range knowledgeBases {
+		collection := kb.Collection
+		if collection == "" {
+			collection = deps.Config.Chroma.CollectionName
+		}
+		version, err := deps.MetadataStore.CollectionVersion(collection)
+		if err != nil {
+			return nil, err
+		}
+		versions[collection] = version
+	}
+	return versions, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/your-org/ai-sa-assistant/internal/acl"
+	"github.com/your-org/ai-sa-assistant/internal/classifier"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+)
+
+func TestRetrievalCacheObserveVersions(t *testing.T) {
+	cache := NewRetrievalCache(config.RetrievalCacheConfig{
+		Enabled: true, MaxEntries: 10, TTLSeconds: 60, EmbeddingMaxEntries: 10, EmbeddingTTLSeconds: 60,
+	}, zaptest.NewLogger(t))
+	require.NotNil(t, cache)
+
+	cache.ObserveVersions(map[string]int64{"cloud_assistant": 1})
+	cache.results.Set("key", cachedRetrieval{TotalResults: 3})
+	cache.embeddings.Set("query", []float32{0.1})
+
+	cache.ObserveVersions(map[string]int64{"cloud_assistant": 1})
+	_, ok := cache.results.Get("key")
+	assert.True(t, ok, "unchanged versions keep cached entries")
+
+	cache.ObserveVersions(map[string]int64{"cloud_assistant": 2})
+	_, ok = cache.results.Get("key")
+	assert.False(t, ok)
+	_, ok = cache.embeddings.Get("query")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(1), cache.Stats()["invalidations"])
+
+	assert.Nil(t, NewRetrievalCache(config.RetrievalCacheConfig{Enabled: false}, zaptest.NewLogger(t)))
+}
+
+func TestRetrievalCacheKey(t *testing.T) {
+	kbs := []*KnowledgeBase{{Name: "shared"}, {Name: "customer"}}
+	versions := map[string]int64{"cloud_assistant": 1}
+	base := SearchRequest{Query: "How do I migrate to AWS?", Filters: map[string]interface{}{"platform": "aws"}}
+
+	nearIdentical := base
+	nearIdentical.Query = "  how do I   migrate to aws "
+	assert.Equal(t, retrievalCacheKey(base, kbs, versions), retrievalCacheKey(nearIdentical, kbs, versions))
+
+	reordered := []*KnowledgeBase{kbs[1], kbs[0]}
+	assert.Equal(t, retrievalCacheKey(base, kbs, versions), retrievalCacheKey(base, reordered, versions))
+
+	otherCaller := base
+	otherCaller.Identity = acl.Identity{UserID: "alice", Groups: []string{"acme-account-team"}}
+	assert.NotEqual(t, retrievalCacheKey(base, kbs, versions), retrievalCacheKey(otherCaller, kbs, versions))
+
+	otherFilters := base
+	otherFilters.Filters = map[string]interface{}{"platform": "azure"}
+	assert.NotEqual(t, retrievalCacheKey(base, kbs, versions), retrievalCacheKey(otherFilters, kbs, versions))
+
+	assert.NotEqual(t, retrievalCacheKey(base, kbs, versions),
+		retrievalCacheKey(base, kbs, map[string]int64{"cloud_assistant": 2}))
+}
+
+func TestSearchHandlerUsesRetrievalCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var queryCount atomic.Int32
+	chromaServer := newMockChromaServer(t, map[string][]float64{"shared_docs": {0.1, 0.2}})
+	defer chromaServer.Close()
+	countingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			queryCount.Add(1)
+		}
+		chromaServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer countingServer.Close()
+
+	deps := newFederatedTestDeps(t, countingServer.URL)
+	deps.Classifier = classifier.NewQueryClassifier()
+	deps.Cache = NewRetrievalCache(config.RetrievalCacheConfig{
+		Enabled: true, MaxEntries: 10, TTLSeconds: 60, EmbeddingMaxEntries: 10, EmbeddingTTLSeconds: 60,
+	}, deps.Logger)
+
+	router := gin.New()
+	router.POST("/search", createSearchHandler(deps))
+
+	search := func(query string) SearchResponse {
+		body, err := json.Marshal(SearchRequest{Query: query})
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/search", bytes.NewReader(body)))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+		var response SearchResponse
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		return response
+	}
+
+	first := search("AWS EC2 migration plan")
+	assert.False(t, first.Cached)
+	second := search("aws ec2 migration plan?")
+	assert.True(t, second.Cached)
+	assert.Equal(t, first.Chunks, second.Chunks)
+	assert.Equal(t, int32(1), queryCount.Load())
+
+	// An ingest run bumps the collection version and invalidates the cache
+	_, err := deps.MetadataStore.BumpCollectionVersion("shared_docs")
+	require.NoError(t, err)
+	third := search("AWS EC2 migration plan")
+	assert.False(t, third.Cached)
+	assert.Equal(t, int32(2), queryCount.Load())
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/your-org/ai-sa-assistant/internal/chroma"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"go.uber.org/zap"
+)
+
+// KnowledgeBase binds a configured knowledge base to its ChromaDB client
+type KnowledgeBase struct {
+	Name       string
+	Collection string
+	Namespace  string
+	Client     *chroma.Client
+}
+
+// knowledgeBaseResult holds the outcome of searching a single knowledge base
+type knowledgeBaseResult struct {
+	KnowledgeBase     *KnowledgeBase
+	Chunks            []SearchChunk
+	TotalResults      int
+	FallbackTriggered bool
+	FallbackReason    string
+	Err               error
+}
+
+// initializeKnowledgeBases creates a ChromaDB client for every configured knowledge base
+func initializeKnowledgeBases(cfg *config.Config, logger *zap.Logger) map[string]*KnowledgeBase {
+	knowledgeBases := make(map[string]*KnowledgeBase)
+	for _, kbConfig := range cfg.Chroma.ResolveKnowledgeBases() {
+		knowledgeBases[config.NormalizeKnowledgeBaseName(kbConfig.Name)] = &KnowledgeBase{
+			Name:       kbConfig.Name,
+			Collection: kbConfig.CollectionName,
+			Namespace:  kbConfig.MetadataNamespace,
+			Client:     chroma.NewClientWithOptions(cfg.Chroma.URL, kbConfig.CollectionName, logger),
+		}
+	}
+	return knowledgeBases
+}
+
+// resolveRequestedKnowledgeBases maps the knowledge base names in a request to their
+// clients, defaulting to the shared knowledge base when none are requested
+func resolveRequestedKnowledgeBases(names []string, deps *ServiceDependencies) ([]*KnowledgeBase, error) {
+	available := deps.KnowledgeBases
+	if len(available) == 0 {
+		available = map[string]*KnowledgeBase{
+			config.DefaultKnowledgeBase: {Name: config.DefaultKnowledgeBase, Client: deps.ChromaClient},
+		}
+	}
+
+	if len(names) == 0 {
+		names = []string{config.DefaultKnowledgeBase}
+	}
+
+	seen := make(map[string]bool)
+	var knowledgeBases []*KnowledgeBase
+	var unknown []string
+	for _, name := range names {
+		name = config.NormalizeKnowledgeBaseName(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		kb, ok := available[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		knowledgeBases = append(knowledgeBases, kb)
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown knowledge bases: %s", strings.Join(unknown, ", "))
+	}
+	if len(knowledgeBases) == 0 {
+		return nil, fmt.Errorf("no knowledge bases requested")
+	}
+
+	return knowledgeBases, nil
+}
+
+// searchKnowledgeBases queries every requested knowledge base in parallel. Each knowledge
+// base applies its own metadata namespace, fallback logic and confidence filtering.
+func searchKnowledgeBases(
+	ctx context.Context,
+	searchReq SearchRequest,
+	queryEmbedding []float32,
+	knowledgeBases []*KnowledgeBase,
+	deps *ServiceDependencies,
+) []knowledgeBaseResult {
+	results := make([]knowledgeBaseResult, len(knowledgeBases))
+
+	var wg sync.WaitGroup
+	for i, kb := range knowledgeBases {
+		wg.Add(1)
+		go func(i int, kb *KnowledgeBase) {
+			defer wg.Done()
+			results[i] = searchKnowledgeBase(ctx, searchReq, queryEmbedding, kb, deps)
+		}(i, kb)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// searchKnowledgeBase runs metadata filtering and vector search against a single knowledge base
+func searchKnowledgeBase(
+	ctx context.Context,
+	searchReq SearchRequest,
+	queryEmbedding []float32,
+	kb *KnowledgeBase,
+	deps *ServiceDependencies,
+) knowledgeBaseResult {
+	result := knowledgeBaseResult{KnowledgeBase: kb}
+
+	filteredDocIDs, err := applyMetadataFilters(searchReq, kb.Namespace, deps)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to filter documents: %w", err)
+		return result
+	}
+
+	excludedDocIDs, err := deps.MetadataStore.InaccessibleDocIDs(kb.Namespace, searchReq.Identity)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to resolve document access: %w", err)
+		return result
+	}
+
+	searchResults, fallbackTriggered, fallbackReason, err := performVectorSearchWithFallback(
+		ctx, kb.Client, queryEmbedding, filteredDocIDs, excludedDocIDs, deps)
+	if err != nil {
+		result.Err = fmt.Errorf("vector search failed: %w", err)
+		return result
+	}
+
+	result.TotalResults = len(searchResults)
+	result.FallbackTriggered = fallbackTriggered
+	result.FallbackReason = fallbackReason
+	result.Chunks = buildSearchChunks(searchResults, searchReq.Query, searchReq.Identity, kb.Name, kb.Namespace, deps)
+
+	deps.Logger.Info("Knowledge base search completed",
+		zap.String("knowledge_base", kb.Name),
+		zap.String("collection", kb.Collection),
+		zap.Int("total_results", result.TotalResults),
+		zap.Int("filtered_results", len(result.Chunks)),
+		zap.Bool("fallback_triggered", fallbackTriggered),
+	)
+
+	return result
+}
+
+// rrfRankConstant dampens the lead of the top ranks in reciprocal rank fusion
+const rrfRankConstant = 60
+
+// normalizeChunkScores replaces the similarity scores of a single knowledge base's chunks
+// with reciprocal rank fusion scores, scaled so the best chunk scores 1.0 and ordered best
+// first. The scores depend only on rank, so knowledge bases with different score
+// distributions or numbers of results share one scale; chunks with equal similarity share
+// a rank. The original similarity is preserved in RawScore and breaks ties when merging.
+func normalizeChunkScores(chunks []SearchChunk) {
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Score > chunks[j].Score
+	})
+
+	rank := 0
+	for i := range chunks {
+		if i == 0 || chunks[i].Score != chunks[i-1].RawScore {
+			rank = i + 1
+		}
+		chunks[i].RawScore = chunks[i].Score
+		chunks[i].Score = float64(rrfRankConstant+1) / float64(rrfRankConstant+rank)
+	}
+}
+
+// mergeKnowledgeBaseResults combines per-knowledge-base results into a single ranked list.
+// Scores are only fused by rank when more than one knowledge base contributed, so single
+// knowledge base searches keep their raw similarity scores.
+func mergeKnowledgeBaseResults(results []knowledgeBaseResult, maxChunks int) ([]SearchChunk, bool, string) {
+	var merged []SearchChunk
+	var fallbackReasons []string
+	fallbackTriggered := false
+
+	contributing := 0
+	for _, result := range results {
+		if result.Err == nil && len(result.Chunks) > 0 {
+			contributing++
+		}
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		if result.FallbackTriggered {
+			fallbackTriggered = true
+			fallbackReasons = append(fallbackReasons,
+				fmt.Sprintf("%s: %s", result.KnowledgeBase.Name, result.FallbackReason))
+		}
+		if contributing > 1 {
+			normalizeChunkScores(result.Chunks)
+		}
+		merged = append(merged, result.Chunks...)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].Score != merged[j].Score {
+			return merged[i].Score > merged[j].Score
+		}
+		return merged[i].RawScore > merged[j].RawScore
+	})
+
+	if maxChunks > 0 && len(merged) > maxChunks {
+		merged = merged[:maxChunks]
+	}
+
+	fallbackReason := strings.Join(fallbackReasons, "; ")
+	if len(results) == 1 && fallbackTriggered {
+		fallbackReason = results[0].FallbackReason
+	}
+
+	return merged, fallbackTriggered, fallbackReason
+}
@@ -0,0 +1,312 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/your-org/ai-sa-assistant/internal/acl"
+	"github.com/your-org/ai-sa-assistant/internal/chroma"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/metadata"
+)
+
+// newMockChromaServer serves collection lookups and queries, returning the given
+// distances for each collection name
+func newMockChromaServer(t *testing.T, distances map[string][]float64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/v1/collections/")
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(chroma.Collection{Name: path, ID: "uuid-" + path})
+			return
+		}
+
+		collection := strings.TrimSuffix(strings.TrimPrefix(path, "uuid-"), "/query")
+		var ids, docs []string
+		var metas []map[string]interface{}
+		for i := range distances[collection] {
+			ids = append(ids, collection+"-doc_chunk_"+string(rune('0'+i)))
+			docs = append(docs, "content from "+collection)
+			metas = append(metas, map[string]interface{}{"title": collection})
+		}
+		_ = json.NewEncoder(w).Encode(chroma.SearchResponse{
+			IDs:       [][]string{ids},
+			Documents: [][]string{docs},
+			Metadatas: [][]map[string]interface{}{metas},
+			Distances: [][]float64{distances[collection]},
+		})
+	}))
+}
+
+func newFederatedTestDeps(t *testing.T, serverURL string) *ServiceDependencies {
+	logger := zaptest.NewLogger(t)
+	store, err := metadata.NewStore(":memory:", logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	cfg := &config.Config{
+		Chroma: config.ChromaConfig{
+			URL:            serverURL,
+			CollectionName: "shared_docs",
+			KnowledgeBases: []config.KnowledgeBaseConfig{
+				{Name: "customer", CollectionName: "customer_docs", MetadataNamespace: "customer"},
+				{Name: "team", CollectionName: "team_docs", MetadataNamespace: "team"},
+			},
+		},
+		Retrieval: config.RetrievalConfig{
+			MaxChunks:           5,
+			ConfidenceThreshold: 0.5,
+		},
+	}
+
+	knowledgeBases := initializeKnowledgeBases(cfg, logger)
+	return &ServiceDependencies{
+		MetadataStore:  store,
+		ChromaClient:   knowledgeBases[config.DefaultKnowledgeBase].Client,
+		KnowledgeBases: knowledgeBases,
+		Logger:         logger,
+		Config:         cfg,
+	}
+}
+
+func TestResolveRequestedKnowledgeBases(t *testing.T) {
+	deps := newFederatedTestDeps(t, "http://localhost:8000")
+
+	kbs, err := resolveRequestedKnowledgeBases(nil, deps)
+	require.NoError(t, err)
+	require.Len(t, kbs, 1)
+	assert.Equal(t, config.DefaultKnowledgeBase, kbs[0].Name)
+
+	kbs, err = resolveRequestedKnowledgeBases([]string{"Customer", "team", "customer"}, deps)
+	require.NoError(t, err)
+	require.Len(t, kbs, 2)
+	assert.Equal(t, "customer", kbs[0].Name)
+	assert.Equal(t, "team", kbs[1].Name)
+
+	_, err = resolveRequestedKnowledgeBases([]string{"shared", "partner"}, deps)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "partner")
+
+	// Dependencies without configured knowledge bases fall back to the shared client
+	legacyDeps := &ServiceDependencies{ChromaClient: deps.ChromaClient}
+	kbs, err = resolveRequestedKnowledgeBases(nil, legacyDeps)
+	require.NoError(t, err)
+	assert.Equal(t, deps.ChromaClient, kbs[0].Client)
+}
+
+func TestNormalizeChunkScores(t *testing.T) {
+	chunks := []SearchChunk{{DocID: "a", Score: 0.9}, {DocID: "c", Score: 0.7}, {DocID: "b", Score: 0.8}}
+	normalizeChunkScores(chunks)
+
+	assert.Equal(t, []string{"a", "b", "c"}, []string{chunks[0].DocID, chunks[1].DocID, chunks[2].DocID})
+	assert.InDelta(t, 1.0, chunks[0].Score, 1e-9)
+	assert.InDelta(t, 61.0/62.0, chunks[1].Score, 1e-9)
+	assert.InDelta(t, 61.0/63.0, chunks[2].Score, 1e-9)
+	assert.InDelta(t, 0.7, chunks[2].RawScore, 1e-9)
+
+	single := []SearchChunk{{Score: 0.6}}
+	normalizeChunkScores(single)
+	assert.Equal(t, 1.0, single[0].Score)
+	assert.Equal(t, 0.6, single[0].RawScore)
+
+	equal := []SearchChunk{{Score: 0.55}, {Score: 0.55}, {Score: 0.5}}
+	normalizeChunkScores(equal)
+	assert.Equal(t, 1.0, equal[0].Score)
+	assert.Equal(t, 1.0, equal[1].Score, "equal similarities share a rank")
+	assert.InDelta(t, 61.0/63.0, equal[2].Score, 1e-9)
+}
+
+func TestMergeKnowledgeBaseResultsPutsSingleResultOnSameScale(t *testing.T) {
+	results := []knowledgeBaseResult{
+		{
+			KnowledgeBase: &KnowledgeBase{Name: "shared"},
+			Chunks: []SearchChunk{
+				{DocID: "a1", Score: 0.90, KnowledgeBase: "shared"},
+				{DocID: "a2", Score: 0.89, KnowledgeBase: "shared"},
+				{DocID: "a3", Score: 0.60, KnowledgeBase: "shared"},
+			},
+		},
+		{
+			KnowledgeBase: &KnowledgeBase{Name: "customer"},
+			Chunks:        []SearchChunk{{DocID: "b1", Score: 0.85, KnowledgeBase: "customer"}},
+		},
+	}
+
+	merged, _, _ := mergeKnowledgeBaseResults(results, 5)
+	require.Len(t, merged, 4)
+
+	// Each knowledge base's best chunk ranks first within its fused score, ties broken by
+	// similarity, and the lone result is rescaled like the others rather than kept raw
+	assert.Equal(t, []string{"a1", "b1", "a2", "a3"},
+		[]string{merged[0].DocID, merged[1].DocID, merged[2].DocID, merged[3].DocID})
+	assert.Equal(t, 1.0, findChunk(merged, "b1").Score)
+	assert.Equal(t, 0.85, findChunk(merged, "b1").RawScore)
+	for i := 1; i < len(merged); i++ {
+		assert.LessOrEqual(t, merged[i].Score, merged[i-1].Score, "scores share one scale")
+	}
+}
+
+func TestMergeKnowledgeBaseResults(t *testing.T) {
+	shared := &KnowledgeBase{Name: "shared"}
+	customer := &KnowledgeBase{Name: "customer"}
+	team := &KnowledgeBase{Name: "team"}
+
+	results := []knowledgeBaseResult{
+		{
+			KnowledgeBase: shared,
+			Chunks: []SearchChunk{
+				{DocID: "s1", Score: 0.95, KnowledgeBase: "shared"},
+				{DocID: "s2", Score: 0.75, KnowledgeBase: "shared"},
+			},
+		},
+		{
+			KnowledgeBase: customer,
+			Chunks: []SearchChunk{
+				{DocID: "c1", Score: 0.72, KnowledgeBase: "customer"},
+				{DocID: "c2", Score: 0.62, KnowledgeBase: "customer"},
+			},
+			FallbackTriggered: true,
+			FallbackReason:    "insufficient results (2 < 3)",
+		},
+		{KnowledgeBase: team, Err: errors.New("collection missing")},
+	}
+
+	merged, fallbackTriggered, fallbackReason := mergeKnowledgeBaseResults(results, 3)
+	require.Len(t, merged, 3)
+	assert.True(t, fallbackTriggered)
+	assert.Equal(t, "customer: insufficient results (2 < 3)", fallbackReason)
+
+	// The best chunk of each knowledge base normalizes to 1.0 and ranks ahead of weaker ones
+	assert.Equal(t, 1.0, merged[0].Score)
+	assert.Equal(t, 1.0, merged[1].Score)
+	assert.ElementsMatch(t, []string{"s1", "c1"}, []string{merged[0].DocID, merged[1].DocID})
+	assert.Equal(t, 0.72, findChunk(merged, "c1").RawScore)
+
+	// A single contributing knowledge base keeps raw similarity scores
+	single := []knowledgeBaseResult{{
+		KnowledgeBase: shared,
+		Chunks:        []SearchChunk{{DocID: "s1", Score: 0.95}, {DocID: "s2", Score: 0.75}},
+	}}
+	merged, _, _ = mergeKnowledgeBaseResults(single, 5)
+	assert.Equal(t, 0.95, merged[0].Score)
+	assert.Zero(t, merged[0].RawScore)
+}
+
+func findChunk(chunks []SearchChunk, docID string) SearchChunk {
+	for _, chunk := range chunks {
+		if chunk.DocID == docID {
+			return chunk
+		}
+	}
+	return SearchChunk{}
+}
+
+func TestSearchKnowledgeBasesInParallel(t *testing.T) {
+	server := newMockChromaServer(t, map[string][]float64{
+		"shared_docs":   {0.1, 0.3},
+		"customer_docs": {0.2, 0.8},
+	})
+	defer server.Close()
+
+	deps := newFederatedTestDeps(t, server.URL)
+	kbs, err := resolveRequestedKnowledgeBases([]string{"shared", "customer"}, deps)
+	require.NoError(t, err)
+
+	results := searchKnowledgeBases(context.Background(), SearchRequest{Query: "migration plan"},
+		make([]float32, 4), kbs, deps)
+	require.Len(t, results, 2)
+
+	for _, result := range results {
+		require.NoError(t, result.Err)
+		for _, chunk := range result.Chunks {
+			assert.Equal(t, result.KnowledgeBase.Name, chunk.KnowledgeBase)
+		}
+	}
+
+	// customer_docs has one chunk below the confidence threshold (similarity 0.2)
+	assert.Len(t, results[0].Chunks, 2)
+	assert.Len(t, results[1].Chunks, 1)
+
+	merged, fallbackTriggered, _ := mergeKnowledgeBaseResults(results, deps.Config.Retrieval.MaxChunks)
+	assert.False(t, fallbackTriggered)
+	require.Len(t, merged, 3)
+	assert.Equal(t, 1.0, merged[0].Score)
+}
+
+func TestSearchKnowledgeBaseEnforcesAccessControl(t *testing.T) {
+	var capturedWhere map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(chroma.Collection{Name: "shared_docs", ID: "uuid-shared_docs"})
+			return
+		}
+
+		var body chroma.SearchRequest
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		capturedWhere = body.Where
+
+		// The vector store returns a restricted chunk with no metadata store entry to
+		// exercise the chunk-level policy fallback
+		_ = json.NewEncoder(w).Encode(chroma.SearchResponse{
+			IDs:       [][]string{{"playbook_chunk_0", "unlisted-deck_chunk_0"}},
+			Documents: [][]string{{"migration steps", "board numbers"}},
+			Metadatas: [][]map[string]interface{}{{
+				{"title": "Migration Playbook"},
+				{"title": "Board Deck", "classification": "restricted", "allowed_users": "ceo@example.com"},
+			}},
+			Distances: [][]float64{{0.1, 0.2}},
+		})
+	}))
+	defer server.Close()
+
+	deps := newFederatedTestDeps(t, server.URL)
+	require.NoError(t, deps.MetadataStore.AddMetadata(metadata.Entry{
+		DocID: "playbook", Title: "Migration Playbook", Platform: "aws", Scenario: "migration", Type: "playbook",
+	}))
+	require.NoError(t, deps.MetadataStore.AddMetadata(metadata.Entry{
+		DocID: "acme-sow", Title: "ACME SOW", Platform: "aws", Scenario: "migration", Type: "sow",
+		AllowedGroups: []string{"acme-account-team"}, Classification: "confidential",
+	}))
+
+	searchReq := SearchRequest{
+		Query:    "migration plan",
+		Identity: acl.Identity{UserID: "bob@example.com", Groups: []string{"sa-team"}},
+	}
+	result := searchKnowledgeBase(context.Background(), searchReq, make([]float32, 4),
+		deps.KnowledgeBases[config.DefaultKnowledgeBase], deps)
+	require.NoError(t, result.Err)
+
+	// Documents the caller may not see are excluded from the vector search itself
+	require.NotNil(t, capturedWhere)
+	assert.Equal(t, map[string]interface{}{"$nin": []interface{}{"acme-sow"}}, capturedWhere["doc_id"])
+
+	// Chunks that slip through are dropped before they can be cited
+	require.Len(t, result.Chunks, 1)
+	assert.Equal(t, "playbook_chunk_0", result.Chunks[0].DocID)
+	for _, chunk := range result.Chunks {
+		assert.NotContains(t, chunk.Metadata, "allowed_users")
+		assert.NotEqual(t, "Board Deck", chunk.Metadata["title"])
+	}
+}
@@ -27,12 +27,14 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/your-org/ai-sa-assistant/internal/acl"
 	"github.com/your-org/ai-sa-assistant/internal/chroma"
 	"github.com/your-org/ai-sa-assistant/internal/classifier"
 	"github.com/your-org/ai-sa-assistant/internal/config"
 	"github.com/your-org/ai-sa-assistant/internal/health"
 	"github.com/your-org/ai-sa-assistant/internal/metadata"
 	"github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
 	"github.com/your-org/ai-sa-assistant/internal/websearch"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -49,19 +51,31 @@ const (
 	OpenAIEmbeddingDimension = 1536
 )
 
+// Chunk metadata keys carrying the access control fields stamped at ingest
+const (
+	metadataKeyAllowedGroups  = "allowed_groups"
+	metadataKeyAllowedUsers   = "allowed_users"
+	metadataKeyClassification = "classification"
+)
+
 // SearchRequest represents the JSON payload for search requests
 type SearchRequest struct {
-	Query   string                 `json:"query" binding:"required"`
-	Filters map[string]interface{} `json:"filters,omitempty"`
+	Query          string                 `json:"query" binding:"required"`
+	Filters        map[string]interface{} `json:"filters,omitempty"`
+	KnowledgeBases []string               `json:"knowledge_bases,omitempty"`
+	// Identity is the caller on whose behalf the search runs, taken from the identity headers
+	Identity acl.Identity `json:"-"`
 }
 
 // SearchChunk represents a single search result chunk
 type SearchChunk struct {
-	Text     string                 `json:"text"`
-	Score    float64                `json:"score"`
-	DocID    string                 `json:"doc_id"`
-	SourceID string                 `json:"source_id"`
-	Metadata map[string]interface{} `json:"metadata"`
+	Text          string                 `json:"text"`
+	Score         float64                `json:"score"`
+	RawScore      float64                `json:"raw_score,omitempty"`
+	DocID         string                 `json:"doc_id"`
+	SourceID      string                 `json:"source_id"`
+	KnowledgeBase string                 `json:"knowledge_base,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata"`
 }
 
 // SearchResponse represents the JSON response for search requests
@@ -73,6 +87,11 @@ type SearchResponse struct {
 	FallbackReason    string        `json:"fallback_reason,omitempty"`
 	WebSearchUsed     bool          `json:"web_search_used"`
 	WebResults        []WebResult   `json:"web_results,omitempty"`
+	// ReleaseNotesUsed is set when fresh release notes answered a freshness query in
+	// place of live web search
+	ReleaseNotesUsed bool     `json:"release_notes_used,omitempty"`
+	KnowledgeBases   []string `json:"knowledge_bases,omitempty"`
+	Cached           bool     `json:"cached,omitempty"`
 }
 
 // WebResult represents a web search result
@@ -86,6 +105,8 @@ type WebResult struct {
 // WebSearchRequest represents a request to the web search service
 type WebSearchRequest struct {
 	Query string `json:"query"`
+	// TimeWindow restricts results to the publication window the query's dates ask for
+	TimeWindow *websearch.TimeWindow `json:"time_window,omitempty"`
 }
 
 // WebSearchResponse represents the response from the web search service
@@ -100,12 +121,17 @@ type WebSearchResponse struct {
 type ServiceDependencies struct {
 	MetadataStore   *metadata.Store
 	ChromaClient    *chroma.Client
+	KnowledgeBases  map[string]*KnowledgeBase
 	OpenAIClient    *openai.Client
 	Classifier      *classifier.QueryClassifier
 	Logger          *zap.Logger
 	Config          *config.Config
 	HTTPClient      *http.Client
 	DetectionConfig websearch.DetectionConfig
+	// Cache holds retrieval results and query embeddings; nil when caching is disabled
+	Cache *RetrievalCache
+	// ReleaseNotes is searched first for freshness queries; nil when not configured
+	ReleaseNotes *KnowledgeBase
 }
 
 func main() {
@@ -245,12 +271,9 @@ func initializeDependencies(cfg *config.Config, logger *zap.Logger, testMode boo
 		return nil, fmt.Errorf("failed to initialize metadata store: %w", err)
 	}
 
-	// Initialize ChromaDB client
-	chromaClient := chroma.NewClientWithOptions(
-		cfg.Chroma.URL,
-		cfg.Chroma.CollectionName,
-		logger,
-	)
+	// Initialize ChromaDB clients, one per knowledge base
+	knowledgeBases := initializeKnowledgeBases(cfg, logger)
+	chromaClient := knowledgeBases[config.DefaultKnowledgeBase].Client
 
 	// Initialize OpenAI client (skip in test mode)
 	var openaiClient *openai.Client
@@ -258,7 +281,8 @@ func initializeDependencies(cfg *config.Config, logger *zap.Logger, testMode boo
 		logger.Info("Skipping OpenAI client initialization in test mode")
 		openaiClient = nil
 	} else {
-		openaiClient, err = openai.NewClient(cfg.OpenAI.APIKey, logger)
+		openaiClient, err = openai.NewClientWithEndpoint(cfg.OpenAI.APIKey, cfg.OpenAI.Endpoint, logger,
+			resilience.DefaultTimeoutConfig())
 		if err != nil {
 			return nil, fmt.Errorf("failed to initialize OpenAI client: %w", err)
 		}
@@ -280,12 +304,15 @@ func initializeDependencies(cfg *config.Config, logger *zap.Logger, testMode boo
 	return &ServiceDependencies{
 		MetadataStore:   metadataStore,
 		ChromaClient:    chromaClient,
+		KnowledgeBases:  knowledgeBases,
 		OpenAIClient:    openaiClient,
 		Classifier:      queryClassifier,
 		Logger:          logger,
 		Config:          cfg,
 		HTTPClient:      httpClient,
 		DetectionConfig: detectionConfig,
+		Cache:           NewRetrievalCache(cfg.Retrieval.Cache, logger),
+		ReleaseNotes:    resolveReleaseNotesKnowledgeBase(cfg, knowledgeBases, logger),
 	}, nil
 }
 
@@ -300,12 +327,17 @@ func setupHealthChecks(manager *health.Manager, deps *ServiceDependencies) {
 				Timestamp: time.Now(),
 			}
 		}
+		knowledgeBases := make(map[string]string, len(deps.KnowledgeBases))
+		for name, kb := range deps.KnowledgeBases {
+			knowledgeBases[name] = kb.Collection
+		}
 		return health.CheckResult{
 			Status:    health.StatusHealthy,
 			Timestamp: time.Now(),
 			Metadata: map[string]interface{}{
-				"url":        deps.Config.Chroma.URL,
-				"collection": deps.Config.Chroma.CollectionName,
+				"url":             deps.Config.Chroma.URL,
+				"collection":      deps.Config.Chroma.CollectionName,
+				"knowledge_bases": knowledgeBases,
 			},
 		}
 	})
@@ -355,12 +387,27 @@ func setupHealthChecks(manager *health.Manager, deps *ServiceDependencies) {
 		}
 	})
 
+	// Retrieval cache statistics
+	manager.AddCheckerFunc("cache", func(_ context.Context) health.CheckResult {
+		cacheMetadata := map[string]interface{}{"enabled": false}
+		if deps.Cache != nil {
+			cacheMetadata = deps.Cache.Stats()
+		}
+		return health.CheckResult{
+			Status:    health.StatusHealthy,
+			Timestamp: time.Now(),
+			Metadata:  cacheMetadata,
+		}
+	})
+
 	// Set timeout for health checks
 	manager.SetTimeout(HealthCheckTimeout)
 }
 
-// validateSearchRequest validates and parses the incoming search request
-func validateSearchRequest(c *gin.Context, logger *zap.Logger) (SearchRequest, bool) {
+// validateSearchRequest validates and parses the incoming search request. The identity
+// headers forwarded by the front-end services are only honoured when they are trusted;
+// otherwise the caller is anonymous.
+func validateSearchRequest(c *gin.Context, cfg *config.Config, logger *zap.Logger) (SearchRequest, bool) {
 	var searchReq SearchRequest
 	if err := c.ShouldBindJSON(&searchReq); err != nil {
 		logger.Error("Invalid search request", zap.Error(err))
@@ -377,22 +424,32 @@ func validateSearchRequest(c *gin.Context, logger *zap.Logger) (SearchRequest, b
 		return searchReq, false
 	}
 
+	searchReq.Identity = acl.ForwardedIdentity(c.Request.Header, cfg.ACL.TrustedProxyHeaders)
+
 	logger.Info("Processing search request",
 		zap.String("query", searchReq.Query),
 		zap.Any("filters", searchReq.Filters),
+		zap.Strings("knowledge_bases", searchReq.KnowledgeBases),
+		zap.String("caller_user_id", searchReq.Identity.UserID),
+		zap.Strings("caller_groups", searchReq.Identity.Groups),
+		zap.String("caller_clearance", string(searchReq.Identity.Clearance)),
 	)
 
 	return searchReq, true
 }
 
-// applyMetadataFilters applies metadata filters if present in the request
-func applyMetadataFilters(searchReq SearchRequest, deps *ServiceDependencies) ([]string, error) {
+// applyMetadataFilters applies metadata filters if present in the request, scoped to the
+// metadata namespace of the knowledge base being searched and the documents the caller may see
+func applyMetadataFilters(searchReq SearchRequest, namespace string, deps *ServiceDependencies) ([]string, error) {
 	if len(searchReq.Filters) == 0 {
 		return nil, nil
 	}
 
+	identity := searchReq.Identity
 	filterOpts := metadata.FilterOptions{
 		AndFilters: true,
+		Namespace:  namespace,
+		Identity:   &identity,
 	}
 
 	if platform, ok := searchReq.Filters["platform"].(string); ok {
@@ -418,8 +475,29 @@ func applyMetadataFilters(searchReq SearchRequest, deps *ServiceDependencies) ([
 	return filteredDocIDs, nil
 }
 
-// generateQueryEmbedding generates an embedding for the search query
+// generateQueryEmbedding generates an embedding for the search query, reusing a cached
+// embedding for near-identical queries when the cache is enabled
 func generateQueryEmbedding(ctx context.Context, query string, deps *ServiceDependencies) ([]float32, error) {
+	if deps.Cache == nil {
+		return embedQuery(ctx, query, deps)
+	}
+
+	key := normalizeQuery(query)
+	if embedding, ok := deps.Cache.embeddings.Get(key); ok {
+		deps.Logger.Debug("Query embedding served from cache", zap.String("query", query))
+		return embedding, nil
+	}
+
+	embedding, err := embedQuery(ctx, query, deps)
+	if err != nil {
+		return nil, err
+	}
+	deps.Cache.embeddings.Set(key, embedding)
+	return embedding, nil
+}
+
+// embedQuery calls the embedding API, returning a mock embedding in test mode
+func embedQuery(ctx context.Context, query string, deps *ServiceDependencies) ([]float32, error) {
 	if deps.OpenAIClient == nil {
 		// Return a mock embedding for test mode
 		mockEmbedding := make([]float32, OpenAIEmbeddingDimension)
@@ -434,12 +512,17 @@ func generateQueryEmbedding(ctx context.Context, query string, deps *ServiceDepe
 // performVectorSearchWithFallback performs vector search with intelligent fallback logic
 func performVectorSearchWithFallback(
 	ctx context.Context,
+	chromaClient *chroma.Client,
 	queryEmbedding []float32,
 	filteredDocIDs []string,
+	excludedDocIDs []string,
 	deps *ServiceDependencies,
 ) ([]chroma.SearchResult, bool, string, error) {
 	maxChunks := deps.Config.Retrieval.MaxChunks
-	searchResults, err := deps.ChromaClient.Search(ctx, queryEmbedding, maxChunks, filteredDocIDs)
+	searchResults, err := chromaClient.SearchWithOptions(ctx, queryEmbedding, maxChunks, chroma.SearchOptions{
+		DocIDs:        filteredDocIDs,
+		ExcludeDocIDs: excludedDocIDs,
+	})
 	if err != nil {
 		return nil, false, "", err
 	}
@@ -455,7 +538,8 @@ func performVectorSearchWithFallback(
 	}
 
 	// Perform fallback search
-	fallbackResults, err := performFallbackSearch(ctx, queryEmbedding, maxChunks, fallbackReason, deps)
+	fallbackResults, err := performFallbackSearch(
+		ctx, chromaClient, queryEmbedding, excludedDocIDs, maxChunks, fallbackReason, deps)
 	if err != nil {
 		return searchResults, false, "", nil // Return original results if fallback fails
 	}
@@ -488,10 +572,13 @@ func shouldApplyFallback(searchResults []chroma.SearchResult, config config.Retr
 	return false, ""
 }
 
-// performFallbackSearch performs the fallback search without document ID filter
+// performFallbackSearch performs the fallback search without document ID filter.
+// Documents the caller may not access stay excluded.
 func performFallbackSearch(
 	ctx context.Context,
+	chromaClient *chroma.Client,
 	queryEmbedding []float32,
+	excludedDocIDs []string,
 	maxChunks int,
 	reason string,
 	deps *ServiceDependencies,
@@ -502,7 +589,9 @@ func performFallbackSearch(
 		zap.Float64("fallback_score_threshold", deps.Config.Retrieval.FallbackScoreThreshold),
 	)
 
-	fallbackResults, err := deps.ChromaClient.Search(ctx, queryEmbedding, maxChunks, nil)
+	fallbackResults, err := chromaClient.SearchWithOptions(ctx, queryEmbedding, maxChunks, chroma.SearchOptions{
+		ExcludeDocIDs: excludedDocIDs,
+	})
 	if err != nil {
 		deps.Logger.Error("Fallback search failed", zap.Error(err))
 		return nil, err
@@ -516,16 +605,17 @@ func performFallbackSearch(
 	return fallbackResults, nil
 }
 
-// buildSearchResponse filters results by confidence and builds the final response
-func buildSearchResponse(
+// buildSearchChunks filters results by confidence and caller access and converts them into
+// search chunks tagged with the knowledge base they came from. Document metadata is looked
+// up in the knowledge base's metadata namespace.
+func buildSearchChunks(
 	searchResults []chroma.SearchResult,
 	query string,
-	fallbackTriggered bool,
-	fallbackReason string,
-	webSearchUsed bool,
-	webResults []WebResult,
+	identity acl.Identity,
+	knowledgeBase string,
+	namespace string,
 	deps *ServiceDependencies,
-) SearchResponse {
+) []SearchChunk {
 	confidenceThreshold := deps.Config.Retrieval.ConfidenceThreshold
 	var filteredResults []chroma.SearchResult
 
@@ -549,35 +639,48 @@ func buildSearchResponse(
 		}
 	}
 
-	chunks := make([]SearchChunk, len(filteredResults))
-	for i, result := range filteredResults {
+	chunks := make([]SearchChunk, 0, len(filteredResults))
+	deniedCount := 0
+	for _, result := range filteredResults {
+		// Extract document ID from chunk ID to lookup source metadata
+		docID := extractDocIDFromChunkID(result.ID)
+		metadataEntry := lookupDocumentMetadata(docID, namespace, deps)
+
+		// Enforce access control again on the results themselves so a stale exclusion
+		// list can never surface a document, or its title, the caller may not see
+		if !documentPolicy(result, metadataEntry).Allows(identity) {
+			deniedCount++
+			continue
+		}
+
 		metadataMap := make(map[string]interface{})
 		for k, v := range result.Metadata {
+			if k == metadataKeyAllowedGroups || k == metadataKeyAllowedUsers {
+				continue
+			}
 			metadataMap[k] = v
 		}
 
-		// Extract document ID from chunk ID to lookup source metadata
-		docID := extractDocIDFromChunkID(result.ID)
-		sourceID := getSourceIDForDocument(docID, deps)
-
-		chunks[i] = SearchChunk{
-			Text:     result.Content,
-			Score:    1.0 - result.Distance,
-			DocID:    result.ID,
-			SourceID: sourceID,
-			Metadata: metadataMap,
-		}
+		sourceID := sourceIDForDocument(docID, metadataEntry)
+
+		chunks = append(chunks, SearchChunk{
+			Text:          result.Content,
+			Score:         1.0 - result.Distance,
+			DocID:         result.ID,
+			SourceID:      sourceID,
+			KnowledgeBase: knowledgeBase,
+			Metadata:      metadataMap,
+		})
 	}
 
-	return SearchResponse{
-		Chunks:            chunks,
-		Count:             len(chunks),
-		Query:             query,
-		FallbackTriggered: fallbackTriggered,
-		FallbackReason:    fallbackReason,
-		WebSearchUsed:     webSearchUsed,
-		WebResults:        webResults,
+	if deniedCount > 0 {
+		deps.Logger.Info("Removed results the caller may not access",
+			zap.String("knowledge_base", knowledgeBase),
+			zap.String("caller_user_id", identity.UserID),
+			zap.Int("denied_count", deniedCount))
 	}
+
+	return chunks
 }
 
 // extractDocIDFromChunkID extracts the document ID from a chunk ID
@@ -599,20 +702,39 @@ func extractDocIDFromChunkID(chunkID string) string {
 	return chunkID
 }
 
-// getSourceIDForDocument retrieves the source ID (URL or title) for a document
-func getSourceIDForDocument(docID string, deps *ServiceDependencies) string {
-	// Look up document metadata to get source information
-	metadataEntry, err := deps.MetadataStore.GetMetadataByDocID(docID)
+// lookupDocumentMetadata retrieves the metadata entry for a document in a metadata
+// namespace, returning nil when the document is unknown or the lookup fails
+func lookupDocumentMetadata(docID, namespace string, deps *ServiceDependencies) *metadata.Entry {
+	metadataEntry, err := deps.MetadataStore.GetMetadataByDocIDWithNamespace(docID, namespace)
 	if err != nil {
 		deps.Logger.Warn("Failed to get metadata for document",
 			zap.String("doc_id", docID),
 			zap.Error(err))
-		// Fall back to doc ID if metadata lookup fails
-		return docID
+		return nil
 	}
 
 	if metadataEntry == nil {
 		deps.Logger.Debug("No metadata found for document", zap.String("doc_id", docID))
+	}
+	return metadataEntry
+}
+
+// documentPolicy returns the access policy for a search result, preferring the metadata
+// store and falling back to the ACL fields stamped on the chunk at ingest
+func documentPolicy(result chroma.SearchResult, metadataEntry *metadata.Entry) acl.Policy {
+	if metadataEntry != nil {
+		return metadataEntry.ACLPolicy()
+	}
+	return acl.Policy{
+		AllowedGroups:  acl.SplitList(result.Metadata[metadataKeyAllowedGroups]),
+		AllowedUsers:   acl.SplitList(result.Metadata[metadataKeyAllowedUsers]),
+		Classification: acl.Classification(result.Metadata[metadataKeyClassification]),
+	}
+}
+
+// sourceIDForDocument returns the source ID (URL or title) for a document
+func sourceIDForDocument(docID string, metadataEntry *metadata.Entry) string {
+	if metadataEntry == nil {
 		// Fall back to doc ID if no metadata entry found
 		return docID
 	}
@@ -627,14 +749,25 @@ func getSourceIDForDocument(docID string, deps *ServiceDependencies) string {
 	return docID
 }
 
-// detectFreshnessKeywords checks if the query contains keywords that indicate need for fresh information
-func detectFreshnessKeywords(query string, config websearch.DetectionConfig) bool {
-	result := websearch.DetectFreshnessNeeds(query, config)
-	return result.NeedsFreshInfo
+// detectFreshness checks if the query needs fresh information and which publication
+// window its dates ask for. It reads the detection clock once and returns that time, so
+// callers measure recency against the same "now" the window was resolved with.
+func detectFreshness(query string, config websearch.DetectionConfig) (websearch.DetectionResult, time.Time) {
+	now := time.Now()
+	if config.Now != nil {
+		now = config.Now()
+	}
+	config.Now = func() time.Time { return now }
+	return websearch.DetectFreshnessNeeds(query, config), now
 }
 
 // callWebSearchService makes a request to the web search service
-func callWebSearchService(ctx context.Context, query string, deps *ServiceDependencies) ([]WebResult, error) {
+func callWebSearchService(
+	ctx context.Context,
+	query string,
+	window *websearch.TimeWindow,
+	deps *ServiceDependencies,
+) ([]WebResult, error) {
 	webSearchURL := deps.Config.Services.WebSearchURL
 	if webSearchURL == "" {
 		return nil, fmt.Errorf("web search service URL not configured")
@@ -642,7 +775,8 @@ func callWebSearchService(ctx context.Context, query string, deps *ServiceDepend
 
 	// Create request payload
 	requestPayload := WebSearchRequest{
-		Query: query,
+		Query:      query,
+		TimeWindow: window,
 	}
 
 	jsonPayload, err := json.Marshal(requestPayload)
@@ -702,7 +836,7 @@ func createSearchHandler(deps *ServiceDependencies) gin.HandlerFunc {
 		)
 
 		// Step 1: Validate request
-		searchReq, valid := validateSearchRequest(c, deps.Logger)
+		searchReq, valid := validateSearchRequest(c, deps.Config, deps.Logger)
 		if !valid {
 			return
 		}
@@ -736,70 +870,154 @@ func createSearchHandler(deps *ServiceDependencies) gin.HandlerFunc {
 			zap.Float64("confidence", classificationResult.Confidence),
 		)
 
-		// Step 3: Apply metadata filters
-		filteredDocIDs, err := applyMetadataFilters(searchReq, deps)
+		// Step 3: Resolve the knowledge bases to search
+		knowledgeBases, err := resolveRequestedKnowledgeBases(searchReq.KnowledgeBases, deps)
 		if err != nil {
-			deps.Logger.Error("Failed to filter documents", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to filter documents",
+			deps.Logger.Warn("Invalid knowledge base selection", zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
 			})
 			return
 		}
 
-		// Step 4: Generate query embedding
-		queryEmbedding, err := generateQueryEmbedding(ctx, searchReq.Query, deps)
-		if err != nil {
-			deps.Logger.Error("Failed to generate query embedding", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to generate query embedding",
-			})
-			return
+		// Step 4: Serve knowledge base results from the cache when the collections are unchanged
+		cacheKey := ""
+		if deps.Cache != nil {
+			versions, versionErr := collectionVersions(knowledgeBases, deps)
+			if versionErr != nil {
+				deps.Logger.Warn("Failed to read collection versions, bypassing retrieval cache",
+					zap.Error(versionErr))
+			} else {
+				deps.Cache.ObserveVersions(versions)
+				cacheKey = retrievalCacheKey(searchReq, knowledgeBases, versions)
+			}
 		}
 
-		// Step 5: Perform vector search with fallback
-		searchResults, fallbackTriggered, fallbackReason, err := performVectorSearchWithFallback(
-			ctx, queryEmbedding, filteredDocIDs, deps)
-		if err != nil {
-			deps.Logger.Error("Vector search failed", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Vector search failed",
-			})
-			return
+		retrieval, cacheHit := cachedRetrieval{}, false
+		if cacheKey != "" {
+			retrieval, cacheHit = deps.Cache.results.Get(cacheKey)
 		}
 
-		// Step 6: Check for freshness keywords and perform web search if needed
+		if cacheHit {
+			deps.Logger.Info("Retrieval served from cache", zap.String("query", searchReq.Query))
+		} else {
+			// Step 5: Generate query embedding
+			queryEmbedding, err := generateQueryEmbedding(ctx, searchReq.Query, deps)
+			if err != nil {
+				deps.Logger.Error("Failed to generate query embedding", zap.Error(err))
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Failed to generate query embedding",
+				})
+				return
+			}
+
+			// Step 6: Apply metadata filters and vector search across knowledge bases in parallel
+			kbResults := searchKnowledgeBases(ctx, searchReq, queryEmbedding, knowledgeBases, deps)
+
+			failedCount := 0
+			for _, kbResult := range kbResults {
+				if kbResult.Err != nil {
+					failedCount++
+					deps.Logger.Error("Knowledge base search failed",
+						zap.String("knowledge_base", kbResult.KnowledgeBase.Name),
+						zap.Error(kbResult.Err),
+					)
+					continue
+				}
+				retrieval.TotalResults += kbResult.TotalResults
+				retrieval.KnowledgeBases = append(retrieval.KnowledgeBases, kbResult.KnowledgeBase.Name)
+			}
+
+			if failedCount == len(kbResults) {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Vector search failed",
+				})
+				return
+			}
+
+			retrieval.Chunks, retrieval.FallbackTriggered, retrieval.FallbackReason = mergeKnowledgeBaseResults(
+				kbResults, deps.Config.Retrieval.MaxChunks)
+
+			// Partial results are not cached so a recovered knowledge base is picked up on the next query
+			if cacheKey != "" && failedCount == 0 {
+				deps.Cache.results.Set(cacheKey, retrieval)
+			}
+		}
+
+		chunks := retrieval.Chunks
+		fallbackTriggered := retrieval.FallbackTriggered
+		fallbackReason := retrieval.FallbackReason
+
+		// Step 7: Check for freshness keywords and answer from release notes, falling back
+		// to web search when no release note is fresh enough
 		var webResults []WebResult
 		webSearchUsed := false
+		releaseNotesUsed := false
+		knowledgeBasesUsed := retrieval.KnowledgeBases
+
+		freshness, detectedAt := detectFreshness(searchReq.Query, deps.DetectionConfig)
+		if freshness.NeedsFreshInfo {
+			if deps.ReleaseNotes != nil {
+				releaseNotes, notesErr := searchReleaseNotes(ctx, searchReq, freshness.TimeWindow, detectedAt, deps)
+				if notesErr != nil {
+					deps.Logger.Warn("Release notes search failed, falling back to web search",
+						zap.Error(notesErr),
+					)
+				} else if len(releaseNotes) > 0 {
+					deps.Logger.Info("Freshness keywords detected, answering from release notes",
+						zap.String("query", searchReq.Query),
+						zap.Int("release_notes_count", len(releaseNotes)),
+					)
+					chunks = appendReleaseNotes(chunks, releaseNotes)
+					knowledgeBasesUsed = append(append([]string{}, knowledgeBasesUsed...), deps.ReleaseNotes.Name)
+					releaseNotesUsed = true
+				}
+			}
 
-		if detectFreshnessKeywords(searchReq.Query, deps.DetectionConfig) {
-			deps.Logger.Info("Freshness keywords detected, performing web search",
-				zap.String("query", searchReq.Query),
-			)
-
-			webSearchResults, webErr := callWebSearchService(ctx, searchReq.Query, deps)
-			if webErr != nil {
-				deps.Logger.Warn("Web search failed, continuing with vector search results only",
-					zap.Error(webErr),
+			if !releaseNotesUsed {
+				deps.Logger.Info("Freshness keywords detected, performing web search",
+					zap.String("query", searchReq.Query),
 				)
-			} else {
-				webResults = webSearchResults
-				webSearchUsed = true
+
+				webSearchResults, webErr := callWebSearchService(ctx, searchReq.Query, freshness.TimeWindow, deps)
+				if webErr != nil {
+					deps.Logger.Warn("Web search failed, continuing with vector search results only",
+						zap.Error(webErr),
+					)
+				} else {
+					webResults = webSearchResults
+					webSearchUsed = true
+				}
 			}
 		}
 
-		// Step 7: Filter results by confidence and format response
-		response := buildSearchResponse(searchResults, searchReq.Query, fallbackTriggered, fallbackReason, webSearchUsed, webResults, deps)
+		// Step 8: Format response
+		response := SearchResponse{
+			Chunks:            chunks,
+			Count:             len(chunks),
+			Query:             searchReq.Query,
+			FallbackTriggered: fallbackTriggered,
+			FallbackReason:    fallbackReason,
+			WebSearchUsed:     webSearchUsed,
+			WebResults:        webResults,
+			ReleaseNotesUsed:  releaseNotesUsed,
+			KnowledgeBases:    knowledgeBasesUsed,
+			Cached:            cacheHit,
+		}
 
 		processingTime := time.Since(start)
 		deps.Logger.Info("Search completed successfully",
 			zap.String("query", searchReq.Query),
-			zap.Int("total_results", len(searchResults)),
+			zap.Strings("knowledge_bases", knowledgeBasesUsed),
+			zap.Int("total_results", retrieval.TotalResults),
 			zap.Int("filtered_results", response.Count),
 			zap.Float64("confidence_threshold", deps.Config.Retrieval.ConfidenceThreshold),
 			zap.Bool("fallback_triggered", fallbackTriggered),
 			zap.String("fallback_reason", fallbackReason),
 			zap.Bool("web_search_used", webSearchUsed),
+			zap.Bool("release_notes_used", releaseNotesUsed),
 			zap.Int("web_results_count", len(webResults)),
+			zap.Bool("cache_hit", cacheHit),
 			zap.Duration("processing_time", processingTime),
 		)
 
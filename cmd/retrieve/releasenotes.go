@@ -0,0 +1,122 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/websearch"
+	"go.uber.org/zap"
+)
+
+// metadataKeyPublished is the chunk metadata key holding a release note's RFC 3339 publish date
+const metadataKeyPublished = "published"
+
+// resolveReleaseNotesKnowledgeBase returns the knowledge base holding ingested release
+// notes, or nil when release notes are disabled or the knowledge base is not configured
+func resolveReleaseNotesKnowledgeBase(
+	cfg *config.Config,
+	knowledgeBases map[string]*KnowledgeBase,
+	logger *zap.Logger,
+) *KnowledgeBase {
+	releaseNotes := cfg.WebSearch.ReleaseNotes
+	if !releaseNotes.Enabled {
+		return nil
+	}
+
+	kb, ok := knowledgeBases[config.NormalizeKnowledgeBaseName(releaseNotes.KnowledgeBase)]
+	if !ok {
+		logger.Info("Release notes knowledge base is not configured, freshness queries use web search only",
+			zap.String("knowledge_base", releaseNotes.KnowledgeBase))
+		return nil
+	}
+	return kb
+}
+
+// searchReleaseNotes searches the release-note knowledge base and returns the chunks
+// published within the window the query asks for, or within
+// websearch.release_notes.max_age_days of now when the query names no dates
+func searchReleaseNotes(
+	ctx context.Context,
+	searchReq SearchRequest,
+	window *websearch.TimeWindow,
+	now time.Time,
+	deps *ServiceDependencies,
+) ([]SearchChunk, error) {
+	queryEmbedding, err := generateQueryEmbedding(ctx, searchReq.Query, deps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+
+	// Request filters describe the main knowledge bases and do not apply to release notes
+	releaseNotesReq := searchReq
+	releaseNotesReq.Filters = nil
+
+	result := searchKnowledgeBase(ctx, releaseNotesReq, queryEmbedding, deps.ReleaseNotes, deps)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+
+	if window != nil {
+		return freshChunks(result.Chunks, *window), nil
+	}
+
+	maxAgeDays := deps.Config.WebSearch.ReleaseNotes.MaxAgeDays
+	if maxAgeDays <= 0 {
+		maxAgeDays = config.DefaultReleaseNotesMaxAgeDays
+	}
+	return freshChunks(result.Chunks, websearch.TimeWindow{Start: now.AddDate(0, 0, -maxAgeDays)}), nil
+}
+
+// freshChunks keeps the chunks published within the window. Chunks without a parseable
+// publish date are never considered fresh.
+func freshChunks(chunks []SearchChunk, window websearch.TimeWindow) []SearchChunk {
+	fresh := make([]SearchChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		published, ok := chunk.Metadata[metadataKeyPublished].(string)
+		if !ok || published == "" {
+			continue
+		}
+		publishedAt, err := time.Parse(time.RFC3339, published)
+		if err != nil || !window.Contains(publishedAt) {
+			continue
+		}
+		fresh = append(fresh, chunk)
+	}
+	return fresh
+}
+
+// appendReleaseNotes returns a new slice with the release-note chunks after the knowledge
+// base chunks, skipping chunks already present. The input slices are not modified because
+// they may be shared with the retrieval cache.
+func appendReleaseNotes(chunks, releaseNotes []SearchChunk) []SearchChunk {
+	combined := make([]SearchChunk, 0, len(chunks)+len(releaseNotes))
+	combined = append(combined, chunks...)
+
+	seen := make(map[string]bool, len(chunks))
+	for _, chunk := range chunks {
+		seen[chunk.DocID] = true
+	}
+	for _, chunk := range releaseNotes {
+		if !seen[chunk.DocID] {
+			combined = append(combined, chunk)
+			seen[chunk.DocID] = true
+		}
+	}
+	return combined
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/your-org/ai-sa-assistant/internal/chroma"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/websearch"
+)
+
+func TestResolveReleaseNotesKnowledgeBase(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	cfg := &config.Config{
+		Chroma: config.ChromaConfig{
+			CollectionName: "shared_docs",
+			KnowledgeBases: []config.KnowledgeBaseConfig{
+				{Name: "freshness", CollectionName: "cloud_release_notes", MetadataNamespace: "freshness"},
+			},
+		},
+		WebSearch: config.WebSearchConfig{
+			ReleaseNotes: config.ReleaseNotesConfig{Enabled: true, KnowledgeBase: "Freshness", MaxAgeDays: 30},
+		},
+	}
+	knowledgeBases := initializeKnowledgeBases(cfg, logger)
+
+	kb := resolveReleaseNotesKnowledgeBase(cfg, knowledgeBases, logger)
+	require.NotNil(t, kb)
+	assert.Equal(t, "cloud_release_notes", kb.Collection)
+
+	cfg.WebSearch.ReleaseNotes.KnowledgeBase = "missing"
+	assert.Nil(t, resolveReleaseNotesKnowledgeBase(cfg, knowledgeBases, logger))
+
+	cfg.WebSearch.ReleaseNotes = config.ReleaseNotesConfig{Enabled: false, KnowledgeBase: "freshness"}
+	assert.Nil(t, resolveReleaseNotesKnowledgeBase(cfg, knowledgeBases, logger))
+}
+
+func TestFreshChunks(t *testing.T) {
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	chunks := []SearchChunk{
+		{DocID: "recent", Metadata: map[string]interface{}{"published": "2025-02-20T10:00:00Z"}},
+		{DocID: "old", Metadata: map[string]interface{}{"published": "2024-06-01T10:00:00Z"}},
+		{DocID: "undated", Metadata: map[string]interface{}{"published": ""}},
+		{DocID: "invalid", Metadata: map[string]interface{}{"published": "last week"}},
+		{DocID: "missing", Metadata: map[string]interface{}{}},
+	}
+
+	fresh := freshChunks(chunks, websearch.TimeWindow{Start: now.AddDate(0, 0, -30)})
+	require.Len(t, fresh, 1)
+	assert.Equal(t, "recent", fresh[0].DocID)
+
+	// A bounded window keeps only the notes published inside it
+	fresh = freshChunks(chunks, websearch.TimeWindow{
+		Start: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.Len(t, fresh, 1)
+	assert.Equal(t, "old", fresh[0].DocID)
+}
+
+func TestAppendReleaseNotes(t *testing.T) {
+	chunks := make([]SearchChunk, 1, 4)
+	chunks[0] = SearchChunk{DocID: "playbook_chunk_0"}
+	releaseNotes := []SearchChunk{{DocID: "aws-release-1_chunk_0"}, {DocID: "playbook_chunk_0"}}
+
+	combined := appendReleaseNotes(chunks, releaseNotes)
+	require.Len(t, combined, 2)
+	assert.Equal(t, "aws-release-1_chunk_0", combined[1].DocID)
+
+	// The cached slice's spare capacity is left untouched
+	assert.Equal(t, "", chunks[:2][1].DocID)
+}
+
+func TestSearchReleaseNotesKeepsFreshItems(t *testing.T) {
+	now := time.Now().UTC()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(chroma.Collection{Name: "cloud_release_notes", ID: "uuid-notes"})
+			return
+		}
+
+		var body chroma.SearchRequest
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		// Request filters are not applied to the release notes
+		assert.Nil(t, body.Where)
+
+		_ = json.NewEncoder(w).Encode(chroma.SearchResponse{
+			IDs: [][]string{{"aws-release-new_chunk_0", "aws-release-old_chunk_0"}},
+			Documents: [][]string{{
+				"Amazon EKS now supports Kubernetes version 1.31",
+				"Amazon EKS now supports Kubernetes version 1.27",
+			}},
+			Metadatas: [][]map[string]interface{}{{
+				{"title": "EKS 1.31", "published": now.AddDate(0, 0, -5).Format(time.RFC3339), "classification": "public"},
+				{"title": "EKS 1.27", "published": now.AddDate(-1, 0, 0).Format(time.RFC3339), "classification": "public"},
+			}},
+			Distances: [][]float64{{0.1, 0.15}},
+		})
+	}))
+	defer server.Close()
+
+	deps := newFederatedTestDeps(t, server.URL)
+	deps.Config.WebSearch.ReleaseNotes = config.ReleaseNotesConfig{
+		Enabled: true, KnowledgeBase: "freshness", MaxAgeDays: 90,
+	}
+	deps.ReleaseNotes = &KnowledgeBase{
+		Name:       "freshness",
+		Collection: "cloud_release_notes",
+		Namespace:  "freshness",
+		Client:     chroma.NewClient(server.URL, "cloud_release_notes"),
+	}
+
+	searchReq := SearchRequest{
+		Query:   "latest EKS release",
+		Filters: map[string]interface{}{"platform": "azure"},
+	}
+	chunks, err := searchReleaseNotes(context.Background(), searchReq, nil, now, deps)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, "aws-release-new_chunk_0", chunks[0].DocID)
+	assert.Equal(t, "freshness", chunks[0].KnowledgeBase)
+
+	// The window requested by the query replaces the max age cutoff
+	window := &websearch.TimeWindow{Start: now.AddDate(-1, 0, -7), End: now.AddDate(0, -6, 0)}
+	chunks, err = searchReleaseNotes(context.Background(), searchReq, window, now, deps)
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+	assert.Equal(t, "aws-release-old_chunk_0", chunks[0].DocID)
+}
+
+func TestDetectFreshnessReturnsDetectionClock(t *testing.T) {
+	detectionNow := time.Date(2025, time.June, 15, 0, 0, 0, 0, time.UTC)
+	calls := 0
+	detectionConfig := websearch.DefaultDetectionConfig()
+	detectionConfig.Now = func() time.Time {
+		calls++
+		return detectionNow.Add(time.Duration(calls-1) * time.Hour)
+	}
+
+	freshness, now := detectFreshness("What did AWS launch for EKS since re:Invent?", detectionConfig)
+	assert.Equal(t, 1, calls, "the clock is read once per detection")
+	assert.Equal(t, detectionNow, now)
+	require.NotNil(t, freshness.TimeWindow)
+	assert.Equal(t, now, freshness.TimeWindow.End, "the window is resolved against the returned time")
+}
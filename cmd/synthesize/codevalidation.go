@@ -0,0 +1,87 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/your-org/ai-sa-assistant/internal/codecheck"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"go.uber.org/zap"
+)
+
+// codeValidationActionDrop removes snippets with errors from the answer
+const codeValidationActionDrop = "drop"
+
+// codeValidationSummary counts the snippets validated and the problems found in them
+type codeValidationSummary struct {
+	Validated int `json:"validated"`
+	Errors    int `json:"errors"`
+	Warnings  int `json:"warnings"`
+	// Dropped is the number of snippets removed because they had errors
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// validateAnswerSnippets validates the answer's Terraform, shell and PowerShell snippets and
+// attaches the findings to them. Snippets with errors are removed when the action is "drop".
+// It returns nil when validation is disabled or no snippet is in a validated language.
+func validateAnswerSnippets(
+	synthesisResponse *synth.SynthesisResponse,
+	cfg *config.Config,
+	logger *zap.Logger,
+) *codeValidationSummary {
+	if !cfg.Synthesis.CodeValidation.Enabled {
+		return nil
+	}
+
+	summary := &codeValidationSummary{}
+	snippets := make([]synth.CodeSnippet, 0, len(synthesisResponse.CodeSnippets))
+	for _, snippet := range synthesisResponse.CodeSnippets {
+		if !codecheck.Supports(snippet.Language) {
+			snippets = append(snippets, snippet)
+			continue
+		}
+
+		summary.Validated++
+		snippet.Findings = codecheck.Validate(snippet.Language, snippet.Code)
+		for _, finding := range snippet.Findings {
+			if finding.Severity == codecheck.SeverityError {
+				summary.Errors++
+			} else {
+				summary.Warnings++
+			}
+		}
+		if len(snippet.Findings) > 0 {
+			logger.Info("Generated code snippet has validation findings",
+				zap.String("language", snippet.Language),
+				zap.String("filename", snippet.Filename),
+				zap.Any("findings", snippet.Findings))
+		}
+
+		if cfg.Synthesis.CodeValidation.Action == codeValidationActionDrop && codecheck.HasErrors(snippet.Findings) {
+			summary.Dropped++
+			continue
+		}
+		snippets = append(snippets, snippet)
+	}
+
+	if summary.Validated == 0 {
+		return nil
+	}
+	if summary.Dropped > 0 {
+		logger.Warn("Dropped generated code snippets with validation errors", zap.Int("dropped", summary.Dropped))
+	}
+	synthesisResponse.CodeSnippets = snippets
+	return summary
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+)
+
+func TestSynthesisHandlerCodeValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	answer := "Create the bucket and list the instances.\n\n" +
+		"```terraform\nresource \"aws_s3_bukcet\" \"logs\" {\n  bucket = \"app-logs\"\n}\n```\n\n" +
+		"```bash\naws ec2 describe-instances --region us-east-1\n```"
+
+	tests := []struct {
+		name         string
+		action       string
+		wantSnippets int
+		wantDropped  float64
+	}{
+		{name: "annotate", action: "annotate", wantSnippets: 2},
+		{name: "drop", action: "drop", wantSnippets: 1, wantDropped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(createMockChatResponseWithContent(answer)))
+			}))
+			defer mockServer.Close()
+
+			cfg := createTestConfig()
+			cfg.Synthesis.CodeValidation.Enabled = true
+			cfg.Synthesis.CodeValidation.Action = tt.action
+			handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(mockServer.URL, logger),
+				synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+			reqBody, err := json.Marshal(SynthesisRequest{
+				Query:  "Give me Terraform for a log bucket",
+				Chunks: []ChunkItem{{Text: "Store logs in S3.", DocID: "doc1", SourceID: "logging"}},
+			})
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+			require.NoError(t, err)
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler(c)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+			summary, ok := response["code_validation"].(map[string]interface{})
+			require.True(t, ok, "Expected a code validation summary in the response")
+			assert.Equal(t, float64(2), summary["validated"])
+			assert.Equal(t, float64(1), summary["errors"])
+			if tt.wantDropped > 0 {
+				assert.Equal(t, tt.wantDropped, summary["dropped"])
+			}
+
+			snippets, _ := response["code_snippets"].([]interface{})
+			require.Len(t, snippets, tt.wantSnippets)
+			if tt.action == "annotate" {
+				findings, _ := snippets[0].(map[string]interface{})["findings"].([]interface{})
+				require.Len(t, findings, 1)
+				assert.Equal(t, "unknown-resource", findings[0].(map[string]interface{})["rule"])
+			}
+			for _, snippet := range snippets[tt.wantSnippets-1:] {
+				assert.Nil(t, snippet.(map[string]interface{})["findings"])
+			}
+		})
+	}
+}
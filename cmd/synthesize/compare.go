@@ -0,0 +1,302 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"github.com/your-org/ai-sa-assistant/internal/acl"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+	"go.uber.org/zap"
+)
+
+// SynthesisModeCompare compares cloud platforms side by side: context is retrieved once per
+// platform with a platform filter and the model fills a comparison table through a forced
+// function call
+const SynthesisModeCompare = "compare"
+
+// Comparison defaults used when the comparison settings are not configured
+const (
+	DefaultComparisonPlatformChunks = 5
+	DefaultComparisonMaxTokens      = 3000
+)
+
+// comparisonSettings returns the comparison settings with defaults for unset values
+func comparisonSettings(cfg *config.Config) config.SynthesisComparisonConfig {
+	settings := cfg.Synthesis.Comparison
+	if settings.PlatformChunks == 0 {
+		settings.PlatformChunks = DefaultComparisonPlatformChunks
+	}
+	if settings.MaxTokens == 0 {
+		settings.MaxTokens = DefaultComparisonMaxTokens
+	}
+	return settings
+}
+
+// comparedPlatforms returns the platforms a query compares, or the default pair when it
+// names fewer than two
+func comparedPlatforms(query string) []string {
+	platforms := synth.DetectComparisonPlatforms(query)
+	if len(platforms) < 2 {
+		return synth.DefaultComparisonPlatforms
+	}
+	return platforms
+}
+
+// handleComparisonRequest compares the platforms of a /synthesize request in compare mode.
+// When the model's comparison is unusable the request is answered as a standard synthesis
+// from the same per-platform context, without the comparison table.
+func handleComparisonRequest(
+	c *gin.Context,
+	req SynthesisRequest,
+	startTime time.Time,
+	cfg *config.Config,
+	logger *zap.Logger,
+	openaiClient *internalopenai.Client,
+	priceCatalog *pricing.Catalog,
+	metricsCollector *synthesis.MetricsCollector,
+) {
+	settings := comparisonSettings(cfg)
+	platforms := comparedPlatforms(req.Query)
+	platformChunks := retrieveComparisonChunks(req.Query, platforms, acl.FromHeaders(c.Request.Header), settings, cfg, logger)
+
+	// Sources retrieved for each platform may be cited, so they are checked like request chunks
+	compareReq := req
+	for _, platform := range platforms {
+		var detections []synth.InjectionDetection
+		platformChunks[platform], _, detections = screenUntrustedContent(platformChunks[platform], nil, cfg, openaiClient, logger)
+		compareReq.injectionDetections = mergeInjectionDetections(compareReq.injectionDetections, detections)
+		compareReq.Chunks = mergeChunks(compareReq.Chunks, platformChunks[platform])
+	}
+
+	comparison, response, choice, err := generateComparison(req, platforms, platformChunks, settings, cfg, logger, openaiClient,
+		priceCatalog)
+	if err != nil {
+		handleSynthesisError(c, err, logger, "comparison synthesis")
+		return
+	}
+	compareReq.modelChoice = choice
+
+	var grounding *synth.GroundingReport
+	if comparison == nil {
+		response, compareReq.modelChoice, err = processSynthesisRequest(compareReq, cfg, logger, openaiClient, nil)
+		if err != nil {
+			handleSynthesisError(c, err, logger, "synthesis")
+			return
+		}
+		response, compareReq.modelChoice, grounding = enforceGrounding(compareReq, response, cfg, logger, openaiClient)
+	} else {
+		grounding = verifyAnswerGrounding(response, req.Query, compareReq.Chunks, req.WebResults, cfg, openaiClient, logger)
+	}
+
+	processingTime := time.Since(startTime)
+	logSynthesisCompletion(compareReq, response, processingTime, logger)
+
+	synthesisResponse := buildSynthesisResponse(response, &compareReq, req.Query, detectQueryDomain(req.Query), cfg,
+		processingTime, grounding, metricsCollector, openaiClient, logger)
+	if comparison != nil {
+		synthesisResponse["comparison"] = comparison
+	}
+
+	c.JSON(http.StatusOK, synthesisResponse)
+}
+
+// retrieveComparisonChunks searches the retrieve service once per platform, filtered to
+// the platform's documents, on behalf of the caller. Failed searches are logged and leave
+// the platform with the request's chunks only.
+func retrieveComparisonChunks(
+	query string,
+	platforms []string,
+	identity acl.Identity,
+	settings config.SynthesisComparisonConfig,
+	cfg *config.Config,
+	logger *zap.Logger,
+) map[string][]ChunkItem {
+	platformChunks := make(map[string][]ChunkItem, len(platforms))
+	if cfg.Services.RetrieveURL == "" {
+		return platformChunks
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, platform := range platforms {
+		wg.Add(1)
+		go func(platform string) {
+			defer wg.Done()
+
+			chunks, err := searchRetrieveService(cfg.Services.RetrieveURL, query,
+				map[string]interface{}{"platform": platform}, identity)
+			if err != nil {
+				logger.Warn("Comparison retrieval failed, using the request context only",
+					zap.String("platform", platform),
+					zap.Error(err))
+				return
+			}
+			if len(chunks) > settings.PlatformChunks {
+				chunks = chunks[:settings.PlatformChunks]
+			}
+
+			mu.Lock()
+			platformChunks[platform] = chunks
+			mu.Unlock()
+		}(platform)
+	}
+	wg.Wait()
+
+	return platformChunks
+}
+
+// generateComparison asks the routed model for the comparison through a forced function
+// call and assembles it into the answer text, returning the model that answered. Each
+// platform is priced for the cost row when its workload can be. A nil comparison is
+// returned when the model's comparison is invalid.
+func generateComparison(
+	req SynthesisRequest,
+	platforms []string,
+	platformChunks map[string][]ChunkItem,
+	settings config.SynthesisComparisonConfig,
+	cfg *config.Config,
+	logger *zap.Logger,
+	openaiClient *internalopenai.Client,
+	priceCatalog *pricing.Catalog,
+) (*synth.Comparison, *internalopenai.ChatCompletionResponse, modelChoice, error) {
+	route := routeModel(req, cfg, logger)
+	choice := route.choice()
+
+	params := extractQueryParameters(req.Query)
+	estimates := make(map[string]*pricing.Estimate, len(platforms))
+	for _, platform := range platforms {
+		if estimate := estimateProviderCosts(priceCatalog, platform, params, req.Query, "", cfg, logger); estimate != nil {
+			estimates[platform] = estimate
+		}
+	}
+
+	var comparison synth.Comparison
+	var usage openai.Usage
+	if openaiClient == nil {
+		logger.Info("Using mock comparison for test mode")
+		comparison = mockComparison(req.Query, platforms, platformChunks)
+	} else {
+		platformContext := make(map[string][]synth.ContextItem, len(platforms))
+		for platform, chunks := range platformChunks {
+			platformContext[platform] = convertChunksToContextItems(chunks)
+		}
+		webResultStrings, _ := convertWebResults(req.WebResults)
+		messages := synth.BuildComparisonMessages(req.Query, platforms, platformContext,
+			convertChunksToContextItems(req.Chunks), webResultStrings, synth.DefaultPromptConfig())
+		for _, platform := range platforms {
+			if estimate, ok := estimates[platform]; ok {
+				messages.SystemMessage += "\n\n" + estimate.Context()
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), planCompletionTimeout(cfg))
+		defer cancel()
+
+		var response *internalopenai.ChatCompletionResponse
+		var err error
+		response, choice, err = completeWithFallback(ctx, route, planRetryConfig(cfg), logger,
+			func(ctx context.Context, model string, retryConfig resilience.BackoffConfig) (*internalopenai.ChatCompletionResponse, error) {
+				return openaiClient.CreateChatCompletionWithRetry(ctx, internalopenai.ChatCompletionRequest{
+					Model:       model,
+					MaxTokens:   settings.MaxTokens,
+					Temperature: float32(cfg.Synthesis.Temperature),
+					Messages: []openai.ChatCompletionMessage{
+						{Role: openai.ChatMessageRoleSystem, Content: messages.SystemMessage},
+						{Role: openai.ChatMessageRoleUser, Content: messages.UserMessage},
+					},
+					Function: &openai.FunctionDefinition{
+						Name:        synth.ComparisonFunction,
+						Description: "Submit the side-by-side comparison: summary, one row per dimension with a cell per platform, and a recommendation",
+						Parameters:  synth.ComparisonSchema,
+					},
+				}, retryConfig)
+			})
+		if err != nil {
+			return nil, nil, choice, fmt.Errorf("failed to generate comparison: %w", err)
+		}
+
+		comparison, err = synth.ParseComparison(response.FunctionArguments, platforms)
+		if err != nil {
+			logger.Warn("Comparison was invalid, answering without the comparison table",
+				zap.Error(err),
+				zap.String("finish_reason", response.FinishReason))
+			return nil, nil, choice, nil
+		}
+		usage = response.Usage
+	}
+
+	// Each column cites its own platform's documents plus the request's shared sources
+	shared := availableSources(req.Chunks, req.WebResults)
+	available := make(map[string][]string, len(platforms))
+	for _, platform := range platforms {
+		available[platform] = append(availableSources(platformChunks[platform], nil), shared...)
+	}
+	comparison.RestrictCitations(available)
+	for i, column := range comparison.Platforms {
+		comparison.Platforms[i].CostEstimate = estimates[column.Platform]
+	}
+
+	logger.Info("Generated comparison",
+		zap.String("title", comparison.Title),
+		zap.Strings("platforms", platforms),
+		zap.Int("dimensions", len(comparison.Dimensions)))
+
+	return &comparison, &internalopenai.ChatCompletionResponse{
+		Content:      synth.AssembleComparison(comparison),
+		FinishReason: string(openai.FinishReasonStop),
+		Usage:        usage,
+	}, choice, nil
+}
+
+// mockComparison returns a comparison for test mode, citing each platform's first chunk
+func mockComparison(query string, platforms []string, platformChunks map[string][]ChunkItem) synth.Comparison {
+	names := make([]string, len(platforms))
+	for i, platform := range platforms {
+		names[i] = synth.PlatformName(platform)
+	}
+	comparison := synth.Comparison{
+		Title:          strings.Join(names, " vs "),
+		Summary:        "Mock comparison for: " + strings.TrimSpace(query),
+		Recommendation: "Mock recommendation.",
+	}
+	for _, platform := range platforms {
+		comparison.Platforms = append(comparison.Platforms, synth.ComparisonPlatform{Platform: platform, Name: synth.PlatformName(platform)})
+	}
+	for _, kind := range synth.RequiredComparisonDimensions {
+		dimension := synth.ComparisonDimension{Kind: kind, Title: kind}
+		for _, platform := range platforms {
+			cell := synth.ComparisonCell{Platform: platform, Text: fmt.Sprintf("Mock %s of %s.", kind, synth.PlatformName(platform))}
+			if chunks := platformChunks[platform]; len(chunks) > 0 {
+				cell.Citations = availableSources(chunks[:1], nil)
+			}
+			dimension.Cells = append(dimension.Cells, cell)
+		}
+		comparison.Dimensions = append(comparison.Dimensions, dimension)
+	}
+	return comparison
+}
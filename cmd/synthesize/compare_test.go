@@ -0,0 +1,247 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/your-org/ai-sa-assistant/internal/acl"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+	"go.uber.org/zap"
+)
+
+const mockComparisonArguments = `{
+  "title": "AWS vs Azure for 40 VMs",
+  "summary": "Both platforms rehost the VMs.",
+  "dimensions": [
+    {"kind": "capabilities", "title": "Capabilities", "cells": [
+      {"platform": "aws", "text": "Application Migration Service", "citations": ["aws-mgn", "azure-migrate"]},
+      {"platform": "azure", "text": "Azure Migrate", "citations": ["azure-migrate"]}
+    ]},
+    {"kind": "services_mapping", "title": "Services Mapping", "cells": [
+      {"platform": "aws", "text": "EC2", "citations": []},
+      {"platform": "azure", "text": "Virtual Machines", "citations": []}
+    ]},
+    {"kind": "cost", "title": "Cost", "cells": [
+      {"platform": "aws", "text": "See estimate", "citations": []},
+      {"platform": "azure", "text": "See estimate", "citations": ["inventory"]}
+    ]},
+    {"kind": "complexity", "title": "Complexity", "cells": [
+      {"platform": "aws", "text": "Low", "citations": []},
+      {"platform": "azure", "text": "Low", "citations": []}
+    ]},
+    {"kind": "risks", "title": "Risks", "cells": [
+      {"platform": "aws", "text": "Licensing", "citations": []},
+      {"platform": "azure", "text": "Capacity", "citations": []}
+    ]}
+  ],
+  "recommendation": "Choose Azure for Windows-heavy estates."
+}`
+
+// newComparisonRetrieveServer returns a retrieve service answering each platform filter
+// with one platform document, recording the filters it was asked for
+func newComparisonRetrieveServer(t *testing.T, platforms *[]string) *httptest.Server {
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query   string            `json:"query"`
+			Filters map[string]string `json:"filters"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		platform := body.Filters["platform"]
+		mu.Lock()
+		*platforms = append(*platforms, platform)
+		mu.Unlock()
+
+		sourceID := map[string]string{"aws": "aws-mgn", "azure": "azure-migrate"}[platform]
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"chunks": [{"text": "Migration guide for ` + platform + `", "doc_id": "` + sourceID +
+			`", "source_id": "` + sourceID + `", "metadata": {"platform": "` + platform + `"}}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSynthesisHandlerCompareMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	var retrievedPlatforms []string
+	retrieveServer := newComparisonRetrieveServer(t, &retrievedPlatforms)
+
+	var systemMessage, userMessage, model string
+	openaiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		systemMessage, userMessage, model = body.Messages[0].Content, body.Messages[1].Content, body.Model
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(strings.Replace(createMockFunctionCallResponse(mockComparisonArguments),
+			synth.StructuredAnswerFunction, synth.ComparisonFunction, 1)))
+	}))
+	defer openaiServer.Close()
+
+	cfg := createTestConfig()
+	cfg.Services.RetrieveURL = retrieveServer.URL
+	cfg.Synthesis.CostEstimation.Enabled = true
+	cfg.Synthesis.Routing = config.SynthesisRoutingConfig{Enabled: true, ComplexModel: "gpt-4-turbo"}
+	handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(openaiServer.URL, logger),
+		synthesis.NewMetricsCollector(logger, nil), nil, setupPriceCatalog(cfg, logger))
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  "Should we migrate our 40 VMs to AWS or Azure?",
+		Chunks: []ChunkItem{{Text: "Inventory of 40 VMs", DocID: "inventory", SourceID: "inventory"}},
+		Mode:   SynthesisModeCompare,
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.ElementsMatch(t, []string{"aws", "azure"}, retrievedPlatforms)
+	assert.Contains(t, userMessage, "--- AWS Sources (cite only in aws cells) ---")
+	assert.Contains(t, systemMessage, "Cost estimate computed from the aws price list")
+	assert.Contains(t, systemMessage, "Cost estimate computed from the azure price list")
+
+	var response struct {
+		MainText        string                 `json:"main_text"`
+		Sources         []string               `json:"sources"`
+		Comparison      *synth.Comparison      `json:"comparison"`
+		ProcessingStats map[string]interface{} `json:"processing_stats"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "gpt-4-turbo", model, "comparisons go to the complex model")
+	assert.Equal(t, "gpt-4-turbo", response.ProcessingStats["model_used"])
+	assert.Equal(t, routingReasonComparison, response.ProcessingStats["model_routing_reason"])
+
+	require.NotNil(t, response.Comparison)
+	require.Len(t, response.Comparison.Platforms, 2)
+	aws, azure := response.Comparison.Platforms[0], response.Comparison.Platforms[1]
+	assert.Equal(t, []string{"aws-mgn"}, aws.Sources, "AWS cells must not cite Azure documents")
+	assert.Equal(t, []string{"azure-migrate", "inventory"}, azure.Sources)
+	require.NotNil(t, aws.CostEstimate)
+	require.NotNil(t, azure.CostEstimate)
+	assert.Equal(t, "azure", azure.CostEstimate.Provider)
+
+	assert.Contains(t, response.MainText, "| Dimension | AWS | Azure |")
+	assert.Contains(t, response.MainText, "| Capabilities | Application Migration Service [aws-mgn] | Azure Migrate [azure-migrate] |")
+	assert.Contains(t, response.Sources, "aws-mgn")
+}
+
+func TestSynthesisHandlerCompareModeInvalidComparison(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	var retrievedPlatforms []string
+	retrieveServer := newComparisonRetrieveServer(t, &retrievedPlatforms)
+
+	var answerUserMessage string
+	openaiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Tools    []interface{} `json:"tools"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(body.Tools) > 0 {
+			_, _ = w.Write([]byte(strings.Replace(createMockFunctionCallResponse(`{"title": "Missing rows", "summary": "", "dimensions": [], "recommendation": ""}`),
+				synth.StructuredAnswerFunction, synth.ComparisonFunction, 1)))
+			return
+		}
+		answerUserMessage = body.Messages[len(body.Messages)-1].Content
+		_, _ = w.Write([]byte(createMockChatResponseWithContent("AWS and Azure both rehost the VMs [aws-mgn] [azure-migrate].")))
+	}))
+	defer openaiServer.Close()
+
+	cfg := createTestConfig()
+	cfg.Services.RetrieveURL = retrieveServer.URL
+	handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(openaiServer.URL, logger),
+		synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  "AWS vs Azure for our VMs",
+		Chunks: []ChunkItem{{Text: "Inventory of 40 VMs", DocID: "inventory", SourceID: "inventory"}},
+		Mode:   SynthesisModeCompare,
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, answerUserMessage, "azure-migrate", "the standard answer should use the per-platform context")
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.NotContains(t, response, "comparison")
+	assert.Contains(t, response["main_text"], "both rehost the VMs")
+}
+
+func TestRetrieveComparisonChunksDropsFallbackChunksOfOtherPlatforms(t *testing.T) {
+	// A fallback search ignores the platform filter and answers with every platform's documents
+	retrieveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"fallback_triggered": true, "chunks": [
+			{"text": "AWS MGN", "doc_id": "aws-mgn", "source_id": "aws-mgn", "metadata": {"platform": "aws"}},
+			{"text": "Azure Migrate", "doc_id": "azure-migrate", "source_id": "azure-migrate", "metadata": {"platform": "azure"}},
+			{"text": "Landing zones", "doc_id": "landing-zones", "source_id": "landing-zones", "metadata": {"platform": "multi-cloud"}}
+		]}`))
+	}))
+	defer retrieveServer.Close()
+
+	cfg := createTestConfig()
+	cfg.Services.RetrieveURL = retrieveServer.URL
+	platformChunks := retrieveComparisonChunks("AWS vs Azure for our VMs", []string{"aws", "azure"}, acl.Identity{},
+		comparisonSettings(cfg), cfg, zap.NewNop())
+
+	assert.Equal(t, []ChunkItem{{Text: "AWS MGN", DocID: "aws-mgn", SourceID: "aws-mgn"}}, platformChunks["aws"])
+	assert.Equal(t, []ChunkItem{{Text: "Azure Migrate", DocID: "azure-migrate", SourceID: "azure-migrate"}},
+		platformChunks["azure"])
+}
+
+func TestComparedPlatforms(t *testing.T) {
+	assert.Equal(t, []string{"aws", "azure", "gcp"}, comparedPlatforms("AWS, Azure or GCP for SAP?"))
+	assert.Equal(t, synth.DefaultComparisonPlatforms, comparedPlatforms("Which cloud suits our SAP estate?"))
+}
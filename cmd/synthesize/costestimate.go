@@ -0,0 +1,140 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"go.uber.org/zap"
+)
+
+// costProviders maps the cloud providers extracted from a query to price lists
+var costProviders = map[string]string{
+	"AWS":   "aws",
+	"Azure": "azure",
+}
+
+// setupPriceCatalog loads the price lists used for cost estimates. The bundled snapshots
+// are used when the configured directory cannot be loaded. It returns nil when cost
+// estimation is disabled or no price list can be loaded.
+func setupPriceCatalog(cfg *config.Config, logger *zap.Logger) *pricing.Catalog {
+	if !cfg.Synthesis.CostEstimation.Enabled {
+		return nil
+	}
+
+	directory := cfg.Synthesis.CostEstimation.SnapshotDirectory
+	catalog, err := pricing.NewCatalog(directory)
+	if err != nil {
+		logger.Warn("Failed to load price-list snapshots, using the bundled ones",
+			zap.String("directory", directory),
+			zap.Error(err))
+		catalog, err = pricing.Default()
+	}
+	if err != nil {
+		logger.Error("Failed to load the bundled price-list snapshots", zap.Error(err))
+		return nil
+	}
+	return catalog
+}
+
+// shouldEstimateCosts reports whether a request's answer is priced: business queries, and
+// plans, which always have a costs section
+func shouldEstimateCosts(req SynthesisRequest) bool {
+	return req.Mode == SynthesisModePlan || synth.DetectQueryType(req.Query) == synth.BusinessQuery
+}
+
+// estimateCosts prices the workload described by the query parameters, adding the services
+// that the query or the extra text, such as a plan outline, mentions. It returns nil when
+// cost estimation is disabled or the workload cannot be priced.
+func estimateCosts(catalog *pricing.Catalog, query, text string, cfg *config.Config, logger *zap.Logger) *pricing.Estimate {
+	if !cfg.Synthesis.CostEstimation.Enabled {
+		return nil
+	}
+
+	params := extractQueryParameters(query)
+	provider := costProvider(params)
+	if provider == "" {
+		logger.Debug("No single priced cloud provider in the query, skipping the cost estimate")
+		return nil
+	}
+	return estimateProviderCosts(catalog, provider, params, query, text, cfg, logger)
+}
+
+// estimateProviderCosts prices the workload described by the query parameters with the
+// price list of the given provider. It returns nil when cost estimation is disabled, the
+// provider has no price list or the workload cannot be priced.
+func estimateProviderCosts(
+	catalog *pricing.Catalog,
+	provider string,
+	params QueryParameters,
+	query, text string,
+	cfg *config.Config,
+	logger *zap.Logger,
+) *pricing.Estimate {
+	if !cfg.Synthesis.CostEstimation.Enabled || catalog == nil {
+		return nil
+	}
+	if _, ok := catalog.Snapshot(provider); !ok {
+		logger.Debug("No price list for the provider, skipping the cost estimate", zap.String("provider", provider))
+		return nil
+	}
+
+	estimate, err := catalog.Estimate(pricing.Workload{
+		Provider:         provider,
+		Regions:          params.Regions,
+		VMCount:          params.VmCount,
+		Windows:          containsTechnology(params.Technologies, "Windows") || containsTechnology(params.Technologies, "SQL Server"),
+		DisasterRecovery: detectQueryDomain(query) == DisasterRecovery || params.RTORequirement != "" || params.RPORequirement != "",
+		Services:         pricing.DetectServices(query + "\n" + text),
+	})
+	if err != nil {
+		if !errors.Is(err, pricing.ErrNothingToPrice) {
+			logger.Warn("Failed to estimate costs", zap.String("provider", provider), zap.Error(err))
+		}
+		return nil
+	}
+
+	logger.Info("Estimated costs from the price list",
+		zap.String("provider", estimate.Provider),
+		zap.String("region", estimate.Region),
+		zap.String("price_list_version", estimate.PriceListVersion),
+		zap.Int("lines", len(estimate.Lines)),
+		zap.Float64("monthly_total", estimate.MonthlyTotal))
+	return estimate
+}
+
+// costProvider returns the price list for the query: its only priced cloud provider or,
+// when it names none, the provider of its first region
+func costProvider(params QueryParameters) string {
+	var providers []string
+	for _, provider := range params.CloudProviders {
+		if priced, ok := costProviders[provider]; ok {
+			providers = append(providers, priced)
+		}
+	}
+	switch {
+	case len(providers) == 1:
+		return providers[0]
+	case len(providers) == 0 && len(params.CloudProviders) == 0 && len(params.Regions) > 0:
+		if awsRegionPattern.MatchString(params.Regions[0]) {
+			return "aws"
+		}
+		return "azure"
+	}
+	return ""
+}
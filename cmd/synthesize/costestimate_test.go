@@ -0,0 +1,133 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+	"go.uber.org/zap"
+)
+
+func TestSynthesisHandlerCostEstimate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	var mu sync.Mutex
+	var systemMessages []string
+	openaiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		for _, message := range body.Messages {
+			if message.Role == "system" {
+				systemMessages = append(systemMessages, message.Content)
+			}
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(createMockChatResponseWithContent("Running the estate costs $8,032.00 a month [aws-pricing].")))
+	}))
+	defer openaiServer.Close()
+
+	cfg := createTestConfig()
+	cfg.Synthesis.CostEstimation.Enabled = true
+	handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(openaiServer.URL, logger),
+		synthesis.NewMetricsCollector(logger, nil), nil, setupPriceCatalog(cfg, logger))
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  "What is the monthly cost and ROI of migrating 100 VMs to AWS in us-east-1?",
+		Chunks: []ChunkItem{{Text: "EC2 is billed per second", DocID: "pricing", SourceID: "aws-pricing"}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		CostEstimate *pricing.Estimate `json:"cost_estimate"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotNil(t, response.CostEstimate)
+	assert.Equal(t, "us-east-1", response.CostEstimate.Region)
+	assert.InDelta(t, 8032.00, response.CostEstimate.MonthlyTotal, 0.001)
+	assert.Contains(t, strings.Join(systemMessages, "\n"), "Total: $8,032.00/month, $96,384.00/year")
+}
+
+func TestEstimateCosts(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := createTestConfig()
+	cfg.Synthesis.CostEstimation.Enabled = true
+	catalog := setupPriceCatalog(cfg, logger)
+	require.NotNil(t, catalog)
+
+	estimate := estimateCosts(catalog, "Cost of 20 servers running Windows on Azure in West Europe with ExpressRoute", "", cfg, logger)
+	require.NotNil(t, estimate)
+	assert.Equal(t, "westeurope", estimate.Region)
+	assert.Equal(t, "Standard_D2s_v5-windows", estimate.Lines[0].SKU)
+	assert.Equal(t, pricing.KindInterconnect, estimate.Lines[len(estimate.Lines)-1].Kind)
+
+	estimate = estimateCosts(catalog, "Budget for DR of 10 VMs from us-east-1 to us-west-2 with RPO 15 minutes", "", cfg, logger)
+	require.NotNil(t, estimate)
+	assert.Equal(t, "aws", estimate.Provider)
+	assert.Equal(t, pricing.KindReplication, estimate.Lines[2].Kind)
+
+	assert.Nil(t, estimateCosts(catalog, "Compare the cost of 10 VMs on AWS and Azure", "", cfg, logger))
+	assert.Nil(t, estimateCosts(catalog, "What does AWS cost?", "", cfg, logger))
+
+	cfg.Synthesis.CostEstimation.Enabled = false
+	assert.Nil(t, estimateCosts(catalog, "Cost of 20 VMs on AWS", "", cfg, logger))
+}
+
+func TestShouldEstimateCosts(t *testing.T) {
+	assert.True(t, shouldEstimateCosts(SynthesisRequest{Query: "What is the ROI and monthly cost of moving to AWS?"}))
+	assert.True(t, shouldEstimateCosts(SynthesisRequest{Query: "Migrate 40 VMs", Mode: SynthesisModePlan}))
+	assert.False(t, shouldEstimateCosts(SynthesisRequest{Query: "Show me Terraform for a VPC"}))
+}
+
+func TestSetupPriceCatalog(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := createTestConfig()
+	cfg.Synthesis.CostEstimation.Enabled = false
+	assert.Nil(t, setupPriceCatalog(cfg, logger), "disabled cost estimation loads no price lists")
+
+	cfg.Synthesis.CostEstimation.Enabled = true
+	cfg.Synthesis.CostEstimation.SnapshotDirectory = t.TempDir() + "/missing"
+	catalog := setupPriceCatalog(cfg, logger)
+	require.NotNil(t, catalog, "unloadable snapshots fall back to the bundled price lists")
+	_, ok := catalog.Snapshot("aws")
+	assert.True(t, ok)
+}
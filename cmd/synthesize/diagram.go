@@ -0,0 +1,144 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/diagram"
+	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"go.uber.org/zap"
+)
+
+// diagramModelRepairRule is the repair rule recorded when the model corrected a diagram
+const diagramModelRepairRule = "model-repair"
+
+// diagramRepairMaxTokens bounds the length of a corrected diagram
+const diagramRepairMaxTokens = 1500
+
+// diagramRepairSystemPrompt instructs the model how to correct an invalid diagram
+const diagramRepairSystemPrompt = "You fix syntax errors in Mermaid flowcharts. " +
+	"Return only the corrected diagram, starting with its graph or flowchart declaration, " +
+	"without code fences or commentary. Keep the same nodes, labels, links and subgraphs " +
+	"and change only what the errors require. Quote labels that contain punctuation, " +
+	"for example A[\"Amazon S3 (Standard)\"]."
+
+// checkAnswerDiagram checks the answer's diagram and applies the linter's repairs. A diagram
+// that is still invalid is sent back to the model once with its errors when model repair is
+// enabled, and dropped when that fails too, since a generic template would not match the
+// answer. It returns nil when the answer has no diagram.
+func checkAnswerDiagram(
+	synthesisResponse *synth.SynthesisResponse,
+	cfg *config.Config,
+	openaiClient *internalopenai.Client,
+	logger *zap.Logger,
+) *diagram.DiagramCheck {
+	if synthesisResponse.DiagramCode == "" {
+		return nil
+	}
+
+	options := diagram.LintOptions{MaxNodes: cfg.Diagram.MaxReadableNodes}
+	check := diagram.CheckDiagram(synthesisResponse.DiagramCode, options)
+	if !check.Valid() && cfg.Diagram.ModelRepair && openaiClient != nil {
+		check = repairDiagramWithModel(check, options, cfg, openaiClient, logger)
+	}
+
+	if err := check.Err(); err != nil {
+		logger.Warn("Dropping diagram that could not be repaired", zap.Error(err))
+		synthesisResponse.DiagramCode = ""
+		synthesisResponse.PipelineDecision.ArchitectureDiagram = false
+		return check
+	}
+
+	if len(check.Repairs) > 0 {
+		logger.Info("Repaired generated diagram", zap.Any("repairs", check.Repairs))
+	}
+	if warnings := check.Warnings(); len(warnings) > 0 {
+		logger.Info("Generated diagram has lint warnings", zap.Any("warnings", warnings))
+	}
+	synthesisResponse.DiagramCode = check.Code
+	return check
+}
+
+// repairDiagramWithModel asks the model once to correct a diagram given the errors the linter
+// found. The original check is returned when the request fails or the correction is invalid.
+func repairDiagramWithModel(
+	check *diagram.DiagramCheck,
+	options diagram.LintOptions,
+	cfg *config.Config,
+	openaiClient *internalopenai.Client,
+	logger *zap.Logger,
+) *diagram.DiagramCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), getConfiguredTimeout(cfg))
+	defer cancel()
+
+	response, _, err := completeWithFallback(ctx, checkRoute("", cfg), resilience.DefaultBackoffConfig(), logger,
+		func(ctx context.Context, model string, retryConfig resilience.BackoffConfig) (*internalopenai.ChatCompletionResponse, error) {
+			return openaiClient.CreateChatCompletionWithRetry(ctx, internalopenai.ChatCompletionRequest{
+				Model:       model,
+				MaxTokens:   diagramRepairMaxTokens,
+				Temperature: 0,
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleSystem, Content: diagramRepairSystemPrompt},
+					{Role: openai.ChatMessageRoleUser, Content: buildDiagramRepairPrompt(check)},
+				},
+			}, retryConfig)
+		})
+	if err != nil {
+		logger.Warn("Diagram repair request failed", zap.Error(err))
+		return check
+	}
+
+	repaired := diagram.CheckDiagram(stripCodeFence(response.Content), options)
+	if err := repaired.Err(); err != nil {
+		logger.Warn("Model returned an invalid diagram", zap.Error(err))
+		return check
+	}
+
+	repairs := append([]diagram.Repair{}, check.Repairs...)
+	repairs = append(repairs, diagram.Repair{Rule: diagramModelRepairRule, Message: "corrected by the model"})
+	repaired.Repairs = append(repairs, repaired.Repairs...)
+	return repaired
+}
+
+// buildDiagramRepairPrompt lists the diagram with the errors the linter could not repair
+func buildDiagramRepairPrompt(check *diagram.DiagramCheck) string {
+	var prompt strings.Builder
+	prompt.WriteString("Fix this Mermaid diagram:\n\n```mermaid\n" + check.Code + "\n```\n\nErrors:\n")
+	for _, diagnostic := range check.Diagnostics {
+		if diagnostic.Severity == diagram.SeverityError {
+			prompt.WriteString("- " + diagnostic.String() + "\n")
+		}
+	}
+	return strings.TrimRight(prompt.String(), "\n")
+}
+
+// stripCodeFence removes a markdown code fence the model may have put around a diagram
+func stripCodeFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") {
+		return text
+	}
+	text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	if newline := strings.Index(text, "\n"); newline >= 0 {
+		return strings.TrimSpace(text[newline+1:])
+	}
+	return ""
+}
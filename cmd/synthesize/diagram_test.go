@@ -0,0 +1,142 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+)
+
+// answerWithDiagram returns an answer embedding the given Mermaid diagram
+func answerWithDiagram(code string) string {
+	return "Place the web tier behind a load balancer.\n\n```mermaid\n" + code + "\n```"
+}
+
+func TestSynthesisHandlerDiagramRepair(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	const corrected = "graph TD\n    A[Web] --> B[\"App (Go)\"]"
+
+	tests := []struct {
+		name         string
+		answers      []string
+		wantRequests int
+		wantDiagram  string
+		wantRules    []interface{}
+	}{
+		{
+			name:         "repaired by the linter",
+			answers:      []string{answerWithDiagram("graph TD\n    A[Web] --> B[App (Go)]")},
+			wantRequests: 1,
+			wantDiagram:  corrected,
+			wantRules:    []interface{}{"unquoted-label"},
+		},
+		{
+			name:         "repaired by the model",
+			answers:      []string{answerWithDiagram("graph TD\n    A[Web] -> B[App (Go)]"), "```mermaid\n" + corrected + "\n```"},
+			wantRequests: 2,
+			wantDiagram:  corrected,
+			wantRules:    []interface{}{diagramModelRepairRule},
+		},
+		{
+			name:         "dropped when the model cannot repair it",
+			answers:      []string{answerWithDiagram("graph TD\n    A[Web] -> B[App]"), "graph TD\n    A[Web] -> B[App]"},
+			wantRequests: 2,
+			wantDiagram:  "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			answers := tt.answers
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				requests = append(requests, body)
+
+				answer := answers[0]
+				if len(answers) > 1 {
+					answers = answers[1:]
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(createMockChatResponseWithContent(answer)))
+			}))
+			defer mockServer.Close()
+
+			cfg := createTestConfig()
+			cfg.Diagram.ModelRepair = true
+			handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(mockServer.URL, logger),
+				synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+			reqBody, err := json.Marshal(SynthesisRequest{
+				Query:  "How should I host a web application?",
+				Chunks: []ChunkItem{{Text: "Run web servers behind a load balancer.", DocID: "doc1", SourceID: "web-hosting"}},
+			})
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+			require.NoError(t, err)
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler(c)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Len(t, requests, tt.wantRequests)
+			if tt.wantRequests > 1 {
+				messages, _ := json.Marshal(requests[1]["messages"])
+				assert.Contains(t, string(messages), "line 2, column 12")
+			}
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantDiagram, response["diagram_code"])
+
+			check, ok := response["diagram_check"].(map[string]interface{})
+			require.True(t, ok, "Expected a diagram check in the response")
+			if tt.wantDiagram == "" {
+				assert.NotEmpty(t, check["diagnostics"])
+				return
+			}
+			var rules []interface{}
+			repairs, _ := check["repairs"].([]interface{})
+			for _, repair := range repairs {
+				rules = append(rules, repair.(map[string]interface{})["rule"])
+			}
+			for _, rule := range tt.wantRules {
+				assert.Contains(t, rules, rule)
+			}
+		})
+	}
+}
+
+func TestStripCodeFence(t *testing.T) {
+	assert.Equal(t, "graph TD\n    A --> B", stripCodeFence("```mermaid\ngraph TD\n    A --> B\n```"))
+	assert.Equal(t, "graph TD", stripCodeFence("  graph TD \n"))
+	assert.Equal(t, "", stripCodeFence("```"))
+}
@@ -0,0 +1,285 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"go.uber.org/zap"
+)
+
+// entailmentVerdictFunction is the function the model calls to return entailment verdicts
+const entailmentVerdictFunction = "submit_verdicts"
+
+// entailmentVerdictSchema is the JSON schema of the entailment verdict function arguments
+var entailmentVerdictSchema = json.RawMessage(`{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["verdicts"],
+  "properties": {
+    "verdicts": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["claim", "entailed"],
+        "properties": {
+          "claim": {"type": "integer", "description": "The claim number"},
+          "entailed": {"type": "boolean", "description": "Whether the evidence fully supports the claim"}
+        }
+      }
+    }
+  }
+}`)
+
+// entailmentSystemPrompt instructs the model how to judge claims against their evidence
+const entailmentSystemPrompt = "You check whether statements are supported by source excerpts. " +
+	"For each numbered claim, decide whether its evidence alone fully supports it. " +
+	"A claim is not supported when it adds facts, numbers or guarantees the evidence does not state. " +
+	"Return one verdict for every claim."
+
+// openAIEntailmentJudge judges claim entailment with a single function call per answer
+type openAIEntailmentJudge struct {
+	client      *internalopenai.Client
+	route       modelRoute
+	retryConfig resilience.BackoffConfig
+	logger      *zap.Logger
+}
+
+// JudgeEntailment asks the model for a verdict on every check and returns them in order
+func (j *openAIEntailmentJudge) JudgeEntailment(ctx context.Context, checks []synth.EntailmentCheck) ([]bool, error) {
+	if len(checks) == 0 {
+		return nil, nil
+	}
+
+	response, _, err := completeWithFallback(ctx, j.route, j.retryConfig, j.logger,
+		func(ctx context.Context, model string, retryConfig resilience.BackoffConfig) (*internalopenai.ChatCompletionResponse, error) {
+			return j.client.CreateChatCompletionWithRetry(ctx, internalopenai.ChatCompletionRequest{
+				Model:       model,
+				MaxTokens:   100 + 20*len(checks),
+				Temperature: 0,
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleSystem, Content: entailmentSystemPrompt},
+					{Role: openai.ChatMessageRoleUser, Content: buildEntailmentPrompt(checks)},
+				},
+				Function: &openai.FunctionDefinition{
+					Name:        entailmentVerdictFunction,
+					Description: "Submit whether each numbered claim is supported by its evidence",
+					Parameters:  entailmentVerdictSchema,
+				},
+			}, retryConfig)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("entailment check failed: %w", err)
+	}
+
+	return parseEntailmentVerdicts(response.FunctionArguments, len(checks))
+}
+
+// buildEntailmentPrompt lists the numbered claims with the evidence aligned to each
+func buildEntailmentPrompt(checks []synth.EntailmentCheck) string {
+	var prompt strings.Builder
+	for i, check := range checks {
+		fmt.Fprintf(&prompt, "Claim %d: %s\nEvidence:\n", i+1, check.Claim)
+		for _, evidence := range check.Evidence {
+			prompt.WriteString("- " + evidence + "\n")
+		}
+		prompt.WriteString("\n")
+	}
+	return strings.TrimRight(prompt.String(), "\n")
+}
+
+// parseEntailmentVerdicts strictly decodes the verdict function arguments, requiring
+// exactly one verdict for each of the numbered claims
+func parseEntailmentVerdicts(arguments string, claims int) ([]bool, error) {
+	var payload struct {
+		Verdicts []struct {
+			Claim    *int  `json:"claim"`
+			Entailed *bool `json:"entailed"`
+		} `json:"verdicts"`
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(arguments)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid entailment verdicts: %w", err)
+	}
+
+	verdicts := make([]bool, claims)
+	seen := make([]bool, claims)
+	for _, verdict := range payload.Verdicts {
+		if verdict.Claim == nil || verdict.Entailed == nil {
+			return nil, fmt.Errorf("invalid entailment verdicts: claim and entailed are required")
+		}
+		index := *verdict.Claim - 1
+		if index < 0 || index >= claims {
+			return nil, fmt.Errorf("invalid entailment verdicts: claim %d is out of range", *verdict.Claim)
+		}
+		if seen[index] {
+			return nil, fmt.Errorf("invalid entailment verdicts: claim %d is repeated", *verdict.Claim)
+		}
+		seen[index] = true
+		verdicts[index] = *verdict.Entailed
+	}
+	for i, ok := range seen {
+		if !ok {
+			return nil, fmt.Errorf("invalid entailment verdicts: claim %d has no verdict", i+1)
+		}
+	}
+	return verdicts, nil
+}
+
+// groundingEvidence converts the request's chunks and web results to grounding evidence,
+// identified the same way the answer cites them
+func groundingEvidence(chunks []ChunkItem, webResults []WebResult) []synth.GroundingEvidence {
+	evidence := make([]synth.GroundingEvidence, 0, len(chunks)+len(webResults))
+	for _, chunk := range chunks {
+		id := chunk.SourceID
+		if id == "" {
+			id = chunk.DocID
+		}
+		evidence = append(evidence, synth.GroundingEvidence{ID: id, Text: chunk.Text})
+	}
+	for _, webResult := range webResults {
+		evidence = append(evidence, synth.GroundingEvidence{
+			ID:   webResult.URL,
+			Text: strings.TrimSpace(webResult.Title + ". " + webResult.Snippet),
+		})
+	}
+	return evidence
+}
+
+// verifyAnswerGrounding verifies the answer's claims against the request's context and
+// web results. It returns nil when grounding verification is disabled. Entailment is
+// checked with the model when configured and a client is available; without one, or
+// when the check fails, lexical overlap alone decides support.
+func verifyAnswerGrounding(
+	response *internalopenai.ChatCompletionResponse,
+	query string,
+	chunks []ChunkItem,
+	webResults []WebResult,
+	cfg *config.Config,
+	openaiClient *internalopenai.Client,
+	logger *zap.Logger,
+) *synth.GroundingReport {
+	if cfg == nil || !cfg.Synthesis.Grounding.Enabled {
+		return nil
+	}
+	groundingConfig := cfg.Synthesis.Grounding
+
+	options := synth.DefaultGroundingOptions()
+	if groundingConfig.SupportThreshold > 0 {
+		options.SupportThreshold = groundingConfig.SupportThreshold
+	}
+	if groundingConfig.CandidateThreshold > 0 {
+		options.CandidateThreshold = groundingConfig.CandidateThreshold
+	}
+
+	var judge synth.EntailmentJudge
+	if groundingConfig.EntailmentCheck && openaiClient != nil {
+		judge = &openAIEntailmentJudge{
+			client:      openaiClient,
+			route:       checkRoute("", cfg),
+			retryConfig: resilience.DefaultBackoffConfig(),
+			logger:      logger,
+		}
+	}
+
+	answer := parseSynthesisResponse(response, availableSources(chunks, webResults), query, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), getConfiguredTimeout(cfg))
+	defer cancel()
+
+	report, err := synth.VerifyGrounding(ctx, answer.MainText, groundingEvidence(chunks, webResults), options, judge)
+	if err != nil {
+		logger.Warn("Entailment check failed, using lexical grounding only", zap.Error(err))
+	}
+
+	logger.Info("Answer grounding verified",
+		zap.Float64("score", report.Score),
+		zap.Int("claims", len(report.Claims)),
+		zap.Int("unsupported_claims", len(report.UnsupportedClaims)),
+		zap.Bool("entailment_checked", report.EntailmentChecked))
+
+	return &report
+}
+
+// enforceGrounding verifies the answer and, when the regenerate action is configured
+// and the score is below the minimum, synthesizes the answer once more with feedback
+// naming the unsupported claims. The better grounded of the two answers is returned with
+// the model that generated it.
+func enforceGrounding(
+	req SynthesisRequest,
+	response *internalopenai.ChatCompletionResponse,
+	cfg *config.Config,
+	logger *zap.Logger,
+	openaiClient *internalopenai.Client,
+) (*internalopenai.ChatCompletionResponse, modelChoice, *synth.GroundingReport) {
+	report := verifyAnswerGrounding(response, req.Query, req.Chunks, req.WebResults, cfg, openaiClient, logger)
+	if report == nil || cfg.Synthesis.Grounding.Action != synth.GroundingActionRegenerate ||
+		report.Score >= cfg.Synthesis.Grounding.MinScore || len(report.UnsupportedClaims) == 0 {
+		return response, req.modelChoice, report
+	}
+
+	logger.Info("Regenerating answer with low groundedness",
+		zap.Float64("score", report.Score),
+		zap.Float64("min_score", cfg.Synthesis.Grounding.MinScore))
+
+	retryReq := req
+	retryReq.groundingFeedback = synth.BuildGroundingFeedback(*report)
+	regenerated, choice, err := processSynthesisRequest(retryReq, cfg, logger, openaiClient, nil)
+	if err != nil {
+		logger.Warn("Grounding regeneration failed, keeping the original answer", zap.Error(err))
+		return response, req.modelChoice, report
+	}
+	regenerated.Usage.PromptTokens += response.Usage.PromptTokens
+	regenerated.Usage.CompletionTokens += response.Usage.CompletionTokens
+	regenerated.Usage.TotalTokens += response.Usage.TotalTokens
+
+	regeneratedReport := verifyAnswerGrounding(regenerated, req.Query, req.Chunks, req.WebResults, cfg, openaiClient, logger)
+	if regeneratedReport.Score < report.Score {
+		response.Usage = regenerated.Usage
+		report.Regenerated = true
+		return response, req.modelChoice, report
+	}
+	regeneratedReport.Regenerated = true
+	return regenerated, choice, regeneratedReport
+}
+
+// groundingWithholdsAnswer reports whether the grounding policy may block or regenerate
+// the answer, in which case streamed answers are buffered rather than relayed as tokens
+func groundingWithholdsAnswer(cfg *config.Config) bool {
+	grounding := cfg.Synthesis.Grounding
+	return grounding.Enabled && (grounding.Action == synth.GroundingActionBlock ||
+		grounding.Action == synth.GroundingActionRegenerate)
+}
+
+// applyGroundingPolicy applies the configured grounding action to the answer when a
+// grounding report is available
+func applyGroundingPolicy(synthesisResponse *synth.SynthesisResponse, report *synth.GroundingReport, cfg *config.Config) {
+	if report == nil {
+		return
+	}
+	synth.ApplyGroundingPolicy(synthesisResponse, *report, cfg.Synthesis.Grounding.MinScore, cfg.Synthesis.Grounding.Action)
+}
@@ -0,0 +1,295 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+)
+
+const (
+	groundedAnswer   = "Amazon EKS supports Kubernetes version 1.31 for existing clusters."
+	ungroundedAnswer = groundedAnswer + " Azure Front Door provides a global web application firewall at no extra cost."
+)
+
+// createMockChatResponseWithContent creates a mock chat completion with the given answer text
+func createMockChatResponseWithContent(content string) string {
+	encoded, _ := json.Marshal(content)
+	return `{
+		"id": "chatcmpl-test",
+		"object": "chat.completion",
+		"created": 1234567890,
+		"model": "gpt-4o",
+		"choices": [
+			{
+				"index": 0,
+				"message": {"role": "assistant", "content": ` + string(encoded) + `},
+				"finish_reason": "stop"
+			}
+		],
+		"usage": {"prompt_tokens": 100, "completion_tokens": 50, "total_tokens": 150}
+	}`
+}
+
+func TestParseEntailmentVerdicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments string
+		want      []bool
+		wantError string
+	}{
+		{
+			name:      "verdicts out of order",
+			arguments: `{"verdicts": [{"claim": 2, "entailed": false}, {"claim": 1, "entailed": true}]}`,
+			want:      []bool{true, false},
+		},
+		{
+			name:      "missing verdict",
+			arguments: `{"verdicts": [{"claim": 1, "entailed": true}]}`,
+			wantError: "claim 2 has no verdict",
+		},
+		{
+			name:      "repeated claim",
+			arguments: `{"verdicts": [{"claim": 1, "entailed": true}, {"claim": 1, "entailed": false}]}`,
+			wantError: "claim 1 is repeated",
+		},
+		{
+			name:      "claim out of range",
+			arguments: `{"verdicts": [{"claim": 3, "entailed": true}]}`,
+			wantError: "claim 3 is out of range",
+		},
+		{
+			name:      "missing entailed",
+			arguments: `{"verdicts": [{"claim": 1}, {"claim": 2, "entailed": true}]}`,
+			wantError: "claim and entailed are required",
+		},
+		{
+			name:      "unknown field",
+			arguments: `{"verdicts": [], "reason": "none"}`,
+			wantError: "unknown field",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdicts, err := parseEntailmentVerdicts(tt.arguments, 2)
+			if tt.wantError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, verdicts)
+		})
+	}
+}
+
+func TestGroundingEvidence(t *testing.T) {
+	evidence := groundingEvidence(
+		[]ChunkItem{{Text: "Chunk text", DocID: "doc1"}, {Text: "Other text", DocID: "doc2", SourceID: "source2"}},
+		[]WebResult{{Title: "EKS versions", Snippet: "EKS supports 1.31", URL: "https://aws.amazon.com/eks/"}},
+	)
+
+	require.Len(t, evidence, 3)
+	assert.Equal(t, synth.GroundingEvidence{ID: "doc1", Text: "Chunk text"}, evidence[0])
+	assert.Equal(t, "source2", evidence[1].ID)
+	assert.Equal(t, synth.GroundingEvidence{ID: "https://aws.amazon.com/eks/", Text: "EKS versions. EKS supports 1.31"}, evidence[2])
+}
+
+func TestSynthesisHandlerGrounding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	tests := []struct {
+		name            string
+		action          string
+		entailmentCheck bool
+		answers         []string
+		wantRequests    int
+		checkResponse   func(t *testing.T, response map[string]interface{}, grounding map[string]interface{})
+	}{
+		{
+			name:         "annotate with lexical alignment",
+			action:       synth.GroundingActionAnnotate,
+			answers:      []string{ungroundedAnswer},
+			wantRequests: 1,
+			checkResponse: func(t *testing.T, response map[string]interface{}, grounding map[string]interface{}) {
+				assert.Contains(t, response["main_text"], "Unverified claims")
+				assert.Contains(t, response["main_text"], "> - Azure Front Door provides")
+				assert.Equal(t, 0.5, grounding["score"])
+				assert.Equal(t, synth.GroundingActionAnnotate, grounding["action"])
+				assert.Equal(t, false, grounding["entailment_checked"])
+			},
+		},
+		{
+			name:            "block after entailment check",
+			action:          synth.GroundingActionBlock,
+			entailmentCheck: true,
+			answers:         []string{groundedAnswer},
+			wantRequests:    2,
+			checkResponse: func(t *testing.T, response map[string]interface{}, grounding map[string]interface{}) {
+				assert.Equal(t, synth.BlockedAnswerText, response["main_text"])
+				assert.Equal(t, 0.0, grounding["score"])
+				assert.Equal(t, true, grounding["entailment_checked"])
+				assert.Equal(t, synth.GroundingActionBlock, grounding["action"])
+			},
+		},
+		{
+			name:         "regenerate with feedback",
+			action:       synth.GroundingActionRegenerate,
+			answers:      []string{ungroundedAnswer, groundedAnswer},
+			wantRequests: 2,
+			checkResponse: func(t *testing.T, response map[string]interface{}, grounding map[string]interface{}) {
+				assert.Equal(t, groundedAnswer, strings.TrimSpace(response["main_text"].(string)))
+				assert.Equal(t, 1.0, grounding["score"])
+				assert.Equal(t, true, grounding["regenerated"])
+				assert.Nil(t, grounding["action"])
+
+				metadata := response["metadata"].(map[string]interface{})
+				assert.Equal(t, 300.0, metadata["total_tokens"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			answers := tt.answers
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				requests = append(requests, body)
+
+				w.Header().Set("Content-Type", "application/json")
+				if _, ok := body["tools"]; ok {
+					verdicts := createMockFunctionCallResponse(`{"verdicts": [{"claim": 1, "entailed": false}]}`)
+					verdicts = strings.Replace(verdicts, synth.StructuredAnswerFunction, entailmentVerdictFunction, 1)
+					_, _ = w.Write([]byte(verdicts))
+					return
+				}
+				answer := answers[0]
+				if len(answers) > 1 {
+					answers = answers[1:]
+				}
+				_, _ = w.Write([]byte(createMockChatResponseWithContent(answer)))
+			}))
+			defer mockServer.Close()
+
+			cfg := createTestConfig()
+			cfg.Synthesis.Grounding = config.SynthesisGroundingConfig{
+				Enabled:         true,
+				EntailmentCheck: tt.entailmentCheck,
+				MinScore:        0.7,
+				Action:          tt.action,
+			}
+			handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(mockServer.URL, logger),
+				synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+			reqBody, err := json.Marshal(SynthesisRequest{
+				Query: "Which Kubernetes versions does EKS support?",
+				Chunks: []ChunkItem{{
+					Text:     "Amazon EKS supports Kubernetes version 1.31 for new and existing clusters.",
+					DocID:    "doc1",
+					SourceID: "eks-versions",
+				}},
+			})
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+			require.NoError(t, err)
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler(c)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Len(t, requests, tt.wantRequests)
+			if tt.action == synth.GroundingActionRegenerate {
+				messages, _ := json.Marshal(requests[1]["messages"])
+				assert.Contains(t, string(messages), "Azure Front Door provides")
+			}
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			grounding, ok := response["grounding"].(map[string]interface{})
+			require.True(t, ok, "expected a grounding report, got %v", response["grounding"])
+			tt.checkResponse(t, response, grounding)
+		})
+	}
+}
+
+func TestSynthesisStreamHandlerBuffersWhenGroundingCanBlock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		assert.Nil(t, body["stream"], "the answer must not be streamed when it can be blocked")
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(createMockChatResponseWithContent(ungroundedAnswer)))
+	}))
+	defer mockServer.Close()
+
+	cfg := createTestConfig()
+	cfg.Synthesis.Grounding = config.SynthesisGroundingConfig{
+		Enabled:  true,
+		MinScore: 0.7,
+		Action:   synth.GroundingActionBlock,
+	}
+	handler := createSynthesisStreamHandler(cfg, logger, createTestOpenAIClient(mockServer.URL, logger),
+		synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query: "Which Kubernetes versions does EKS support?",
+		Chunks: []ChunkItem{{
+			Text:     "Amazon EKS supports Kubernetes version 1.31 for new and existing clusters.",
+			DocID:    "doc1",
+			SourceID: "eks-versions",
+		}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize/stream", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	// No tokens of the blocked answer reach the client
+	names, payloads := parseSSEBody(t, w.Body.String())
+	require.Equal(t, []string{"complete"}, names)
+
+	var complete map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(payloads[0]), &complete))
+	assert.Equal(t, synth.BlockedAnswerText, complete["main_text"])
+}
@@ -21,8 +21,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -35,8 +37,10 @@ import (
 	"github.com/your-org/ai-sa-assistant/internal/config"
 	"github.com/your-org/ai-sa-assistant/internal/health"
 	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
 	"github.com/your-org/ai-sa-assistant/internal/resilience"
 	"github.com/your-org/ai-sa-assistant/internal/session"
+	"github.com/your-org/ai-sa-assistant/internal/streaming"
 	"github.com/your-org/ai-sa-assistant/internal/synth"
 	"github.com/your-org/ai-sa-assistant/internal/synthesis"
 )
@@ -72,6 +76,26 @@ type SynthesisRequest struct {
 	Chunks              []ChunkItem       `json:"chunks"`
 	WebResults          []WebResult       `json:"web_results"`
 	ConversationHistory []session.Message `json:"conversation_history,omitempty"`
+	// PromptExperiment selects prompt templates of the named experiment, overriding the
+	// configured experiment
+	PromptExperiment string `json:"prompt_experiment,omitempty"`
+	// Mode is empty for a single answer, "plan" for a long-form plan written in stages,
+	// "scaffold" for an answer with a Terraform project built from its code or "compare"
+	// for a side-by-side comparison of cloud platforms
+	Mode string `json:"mode,omitempty"`
+
+	// promptTemplate is the prompt template selected for the request, nil for the built-in prompt
+	promptTemplate *synth.PromptTemplate
+	// groundingFeedback names unsupported claims when the answer is regenerated for low groundedness
+	groundingFeedback string
+	// scaffoldInstructions asks for complete Terraform code using the project's variables in scaffold mode
+	scaffoldInstructions string
+	// costEstimate is the priced workload given to the model as authoritative cost figures
+	costEstimate *pricing.Estimate
+	// injectionDetections lists the chunks and web results suspected of prompt injection
+	injectionDetections []synth.InjectionDetection
+	// modelChoice is the model that generated the answer and why it was chosen
+	modelChoice modelChoice
 }
 
 // RegenerationRequest represents a request to regenerate a response with different parameters
@@ -82,6 +106,9 @@ type RegenerationRequest struct {
 	ConversationHistory []session.Message `json:"conversation_history,omitempty"`
 	Parameters          GenerationParams  `json:"parameters"`
 	PreviousResponse    *string           `json:"previous_response,omitempty"`
+
+	// injectionDetections lists the chunks and web results suspected of prompt injection
+	injectionDetections []synth.InjectionDetection
 }
 
 // GenerationParams defines parameters for response generation
@@ -116,42 +143,44 @@ const (
 	ConciseMaxTokens  = 1000
 )
 
-// getParameterPresets returns available parameter presets
-func getParameterPresets() map[string]ParameterPreset {
+// getParameterPresets returns available parameter presets with the models routed to
+// the synthesize service
+func getParameterPresets(cfg *config.Config) map[string]ParameterPreset {
+	models := routedModels(cfg)
 	return map[string]ParameterPreset{
 		"creative": {
 			Name:        "creative",
 			Temperature: CreativeTemperature,
 			MaxTokens:   CreativeMaxTokens,
-			Model:       "gpt-4o",
+			Model:       models.Standard,
 			Description: "More creative and varied responses with higher temperature",
 		},
 		"balanced": {
 			Name:        "balanced",
 			Temperature: BalancedTemperature,
 			MaxTokens:   BalancedMaxTokens,
-			Model:       "gpt-4o",
+			Model:       models.Standard,
 			Description: "Balanced approach between creativity and focus",
 		},
 		"focused": {
 			Name:        "focused",
 			Temperature: FocusedTemperature,
 			MaxTokens:   FocusedMaxTokens,
-			Model:       "gpt-4o",
+			Model:       models.Standard,
 			Description: "More focused and deterministic responses",
 		},
 		"detailed": {
 			Name:        "detailed",
 			Temperature: DetailedTemperature,
 			MaxTokens:   DetailedMaxTokens,
-			Model:       "gpt-4o",
+			Model:       models.Standard,
 			Description: "Comprehensive and detailed responses",
 		},
 		"concise": {
 			Name:        "concise",
 			Temperature: ConciseTemperature,
 			MaxTokens:   ConciseMaxTokens,
-			Model:       "gpt-4o-mini",
+			Model:       models.Fast,
 			Description: "Brief and to-the-point responses",
 		},
 	}
@@ -214,11 +243,13 @@ func getAdaptiveTimeout(cfg *config.Config, req SynthesisRequest, logger *zap.Lo
 
 // QueryParameters represents extracted specific parameters from a user query
 type QueryParameters struct {
-	VmCount         int      `json:"vm_count,omitempty"`
-	Technologies    []string `json:"technologies,omitempty"`
-	CloudProviders  []string `json:"cloud_providers,omitempty"`
-	RTORequirement  string   `json:"rto_requirement,omitempty"`
-	RPORequirement  string   `json:"rpo_requirement,omitempty"`
+	VmCount        int      `json:"vm_count,omitempty"`
+	Technologies   []string `json:"technologies,omitempty"`
+	CloudProviders []string `json:"cloud_providers,omitempty"`
+	RTORequirement string   `json:"rto_requirement,omitempty"`
+	RPORequirement string   `json:"rpo_requirement,omitempty"`
+	// Regions are the cloud regions named in the query, in the order they appear
+	Regions         []string `json:"regions,omitempty"`
 	SpecificNumbers []string `json:"specific_numbers,omitempty"`
 	Constraints     []string `json:"constraints,omitempty"`
 	Scenarios       []string `json:"scenarios,omitempty"`
@@ -271,6 +302,8 @@ func extractQueryParameters(query string) QueryParameters {
 		params.Constraints = append(params.Constraints, "RPO: "+matches[0])
 	}
 
+	params.Regions = extractRegions(queryLower)
+
 	// Extract technology indicators
 	techKeywords := map[string][]string{
 		"Windows":    {"windows", "win server", "windows server"},
@@ -363,6 +396,64 @@ func extractQueryParameters(query string) QueryParameters {
 	return params
 }
 
+// awsRegionPattern matches AWS region codes such as us-east-1 and ap-southeast-2
+var awsRegionPattern = regexp.MustCompile(`\b(?:us|eu|ap|sa|ca|me|af|il|mx)-(?:east|west|north|south|central|northeast|northwest|southeast|southwest)-\d\b`)
+
+// azureRegions are the Azure region names recognised in queries, with longer names before the
+// names they start with so that "east us 2" is not read as "east us"
+var azureRegions = []struct{ name, displayName string }{
+	{"eastus2", "east us 2"}, {"eastus", "east us"},
+	{"westus3", "west us 3"}, {"westus2", "west us 2"}, {"westus", "west us"},
+	{"northcentralus", "north central us"}, {"southcentralus", "south central us"},
+	{"westcentralus", "west central us"}, {"centralus", "central us"},
+	{"canadacentral", "canada central"}, {"canadaeast", "canada east"},
+	{"brazilsouth", "brazil south"},
+	{"northeurope", "north europe"}, {"westeurope", "west europe"},
+	{"uksouth", "uk south"}, {"ukwest", "uk west"},
+	{"francecentral", "france central"}, {"germanywestcentral", "germany west central"},
+	{"swedencentral", "sweden central"}, {"switzerlandnorth", "switzerland north"},
+	{"norwayeast", "norway east"}, {"italynorth", "italy north"}, {"polandcentral", "poland central"},
+	{"uaenorth", "uae north"}, {"southafricanorth", "south africa north"},
+	{"centralindia", "central india"}, {"southindia", "south india"},
+	{"southeastasia", "southeast asia"}, {"eastasia", "east asia"},
+	{"japaneast", "japan east"}, {"japanwest", "japan west"}, {"koreacentral", "korea central"},
+	{"australiaeast", "australia east"}, {"australiasoutheast", "australia southeast"},
+}
+
+// extractRegions returns the AWS region codes and Azure region names in a lowercased query,
+// in the order they appear and without duplicates
+func extractRegions(queryLower string) []string {
+	type regionMatch struct {
+		name  string
+		index int
+	}
+	var matches []regionMatch
+	for _, loc := range awsRegionPattern.FindAllStringIndex(queryLower, -1) {
+		matches = append(matches, regionMatch{name: queryLower[loc[0]:loc[1]], index: loc[0]})
+	}
+
+	// Matched names are blanked out so that a shorter name does not match inside a longer one
+	remaining := []byte(queryLower)
+	for _, region := range azureRegions {
+		pattern := regexp.MustCompile(`\b(?:` + region.name + `|` + regexp.QuoteMeta(region.displayName) + `)\b`)
+		for _, loc := range pattern.FindAllIndex(remaining, -1) {
+			matches = append(matches, regionMatch{name: region.name, index: loc[0]})
+			copy(remaining[loc[0]:loc[1]], strings.Repeat(" ", loc[1]-loc[0]))
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].index < matches[j].index })
+	regions := []string{}
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		if !seen[match.name] {
+			seen[match.name] = true
+			regions = append(regions, match.name)
+		}
+	}
+	return regions
+}
+
 // QueryDomain represents the domain/scenario type of a query
 type QueryDomain string
 
@@ -627,6 +718,13 @@ func validateSynthesisRequest(req SynthesisRequest) error {
 		return fmt.Errorf("query is too long (max %d characters)", MaxQueryLength)
 	}
 
+	switch req.Mode {
+	case "", SynthesisModePlan, SynthesisModeScaffold, SynthesisModeCompare:
+	default:
+		return fmt.Errorf("unsupported mode %q (supported: %s, %s, %s)",
+			req.Mode, SynthesisModePlan, SynthesisModeScaffold, SynthesisModeCompare)
+	}
+
 	// In test mode, allow empty chunks and web results for demo purposes
 	if len(req.Chunks) == 0 && len(req.WebResults) == 0 {
 		if os.Getenv("TEST_MODE") != "true" {
@@ -657,7 +755,7 @@ func validateSynthesisRequest(req SynthesisRequest) error {
 }
 
 // validateRegenerationRequest validates the regeneration request
-func validateRegenerationRequest(req RegenerationRequest) error {
+func validateRegenerationRequest(req RegenerationRequest, cfg *config.Config) error {
 	// First validate as a basic synthesis request
 	synthReq := SynthesisRequest{
 		Query:               req.Query,
@@ -670,7 +768,7 @@ func validateRegenerationRequest(req RegenerationRequest) error {
 	}
 
 	// Validate parameters
-	if err := validateGenerationParams(req.Parameters); err != nil {
+	if err := validateGenerationParams(req.Parameters, cfg); err != nil {
 		return fmt.Errorf("parameter validation failed: %w", err)
 	}
 
@@ -678,8 +776,8 @@ func validateRegenerationRequest(req RegenerationRequest) error {
 }
 
 // validateGenerationParams validates generation parameters
-func validateGenerationParams(params GenerationParams) error {
-	presets := getParameterPresets()
+func validateGenerationParams(params GenerationParams, cfg *config.Config) error {
+	presets := getParameterPresets(cfg)
 
 	// If preset is specified, validate it exists
 	if params.Preset != "" {
@@ -703,7 +801,7 @@ func validateGenerationParams(params GenerationParams) error {
 	}
 
 	// Validate model
-	validModels := []string{"gpt-4o", "gpt-4o-mini", "gpt-4-turbo"}
+	validModels := routedModels(cfg).valid()
 	modelValid := false
 	for _, validModel := range validModels {
 		if params.Model == validModel {
@@ -719,12 +817,12 @@ func validateGenerationParams(params GenerationParams) error {
 }
 
 // applyParameterPreset applies a preset to generation parameters
-func applyParameterPreset(params *GenerationParams) {
+func applyParameterPreset(params *GenerationParams, cfg *config.Config) {
 	if params.Preset == "" {
 		return
 	}
 
-	presets := getParameterPresets()
+	presets := getParameterPresets(cfg)
 	if preset, exists := presets[params.Preset]; exists {
 		// Only override if not explicitly set
 		if params.Temperature == 0 {
@@ -807,9 +905,9 @@ func setupServices(cfg *config.Config, logger *zap.Logger) *internalopenai.Clien
 		Logger:         logger,
 	}
 
-	openaiClient, err = internalopenai.NewClientWithTimeout(cfg.OpenAI.APIKey, logger, timeoutConfig)
+	openaiClient, err = newChatClient(cfg, logger, timeoutConfig)
 	if err != nil {
-		logger.Fatal("Failed to initialize OpenAI client", zap.Error(err))
+		logger.Fatal("Failed to initialize chat model client", zap.Error(err))
 	}
 
 	// Log configuration with masked sensitive values
@@ -817,6 +915,7 @@ func setupServices(cfg *config.Config, logger *zap.Logger) *internalopenai.Clien
 	logger.Info("Configuration loaded successfully",
 		zap.String("service", "synthesize"),
 		zap.String("environment", os.Getenv("ENVIRONMENT")),
+		zap.String("chat_provider", openaiClient.ChatProvider()),
 		zap.String("synthesis_model", maskedConfig.Synthesis.Model),
 		zap.Int("max_tokens", maskedConfig.Synthesis.MaxTokens),
 		zap.Float64("temperature", maskedConfig.Synthesis.Temperature),
@@ -856,9 +955,17 @@ func setupRouter(cfg *config.Config, logger *zap.Logger, openaiClient *internalo
 
 	router.GET("/health", gin.WrapH(healthManager.HTTPHandler()))
 	router.GET("/metrics", createMetricsHandler(metricsCollector))
-	router.POST("/synthesize", createSynthesisHandler(cfg, logger, openaiClient, metricsCollector))
+	// Load versioned prompt templates when configured
+	promptRegistry := setupPromptRegistry(cfg, logger)
+	// Load the price lists for cost estimates once
+	priceCatalog := setupPriceCatalog(cfg, logger)
+
+	router.POST("/synthesize", createSynthesisHandler(cfg, logger, openaiClient, metricsCollector, promptRegistry,
+		priceCatalog))
+	router.POST("/synthesize/stream", createSynthesisStreamHandler(cfg, logger, openaiClient, metricsCollector,
+		promptRegistry, priceCatalog))
 	router.POST("/regenerate", createRegenerationHandler(cfg, logger, openaiClient, metricsCollector))
-	router.GET("/presets", createPresetsHandler())
+	router.GET("/presets", createPresetsHandler(cfg))
 
 	return router
 }
@@ -881,7 +988,17 @@ func setupHealthChecks(manager *health.Manager, cfg *config.Config, openaiClient
 			}
 		}
 
-		if _, err := openaiClient.EmbedTexts(ctx, []string{"health check"}); err != nil {
+		// Chat-only providers are not probed, to avoid paying for a completion on every
+		// check; the circuit breaker shows whether their recent requests failed
+		if !openaiClient.SupportsEmbeddings() {
+			if stats := openaiClient.GetCircuitBreakerStats(); stats.State == resilience.CircuitOpen {
+				return health.CheckResult{
+					Status:    health.StatusUnhealthy,
+					Error:     fmt.Sprintf("%s circuit breaker is open", openaiClient.ChatProvider()),
+					Timestamp: time.Now(),
+				}
+			}
+		} else if _, err := openaiClient.EmbedTexts(ctx, []string{"health check"}); err != nil {
 			return health.CheckResult{
 				Status:    health.StatusUnhealthy,
 				Error:     fmt.Sprintf("OpenAI API health check failed: %v", err),
@@ -893,6 +1010,7 @@ func setupHealthChecks(manager *health.Manager, cfg *config.Config, openaiClient
 			Status:    health.StatusHealthy,
 			Timestamp: time.Now(),
 			Metadata: map[string]interface{}{
+				"provider":    openaiClient.ChatProvider(),
 				"model":       cfg.Synthesis.Model,
 				"max_tokens":  cfg.Synthesis.MaxTokens,
 				"temperature": cfg.Synthesis.Temperature,
@@ -956,6 +1074,8 @@ func createSynthesisHandler(
 	logger *zap.Logger,
 	openaiClient *internalopenai.Client,
 	metricsCollector *synthesis.MetricsCollector,
+	promptRegistry *synth.PromptRegistry,
+	priceCatalog *pricing.Catalog,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		startTime := time.Now()
@@ -970,13 +1090,36 @@ func createSynthesisHandler(
 		if !valid {
 			return
 		}
+		req.promptTemplate = selectPromptTemplate(promptRegistry, req, cfg)
+		req.Chunks, req.WebResults, req.injectionDetections = screenUntrustedContent(req.Chunks, req.WebResults,
+			cfg, openaiClient, logger)
+
+		switch req.Mode {
+		case SynthesisModePlan:
+			handlePlanRequest(c, req, startTime, cfg, logger, openaiClient, priceCatalog, metricsCollector)
+			return
+		case SynthesisModeScaffold:
+			handleScaffoldRequest(c, req, startTime, cfg, logger, openaiClient, metricsCollector)
+			return
+		case SynthesisModeCompare:
+			handleComparisonRequest(c, req, startTime, cfg, logger, openaiClient, priceCatalog, metricsCollector)
+			return
+		}
+		if shouldEstimateCosts(req) {
+			req.costEstimate = estimateCosts(priceCatalog, req.Query, "", cfg, logger)
+		}
 
 		// Process the synthesis request
-		response, err := processSynthesisRequest(req, cfg, logger, openaiClient)
+		response, choice, err := processSynthesisRequest(req, cfg, logger, openaiClient, nil)
 		if err != nil {
 			handleSynthesisError(c, err, logger, "synthesis")
 			return
 		}
+		req.modelChoice = choice
+
+		// Verify the answer against its sources, regenerating it once if configured
+		response, choice, grounding := enforceGrounding(req, response, cfg, logger, openaiClient)
+		req.modelChoice = choice
 
 		// Log completion and return response
 		processingTime := time.Since(startTime)
@@ -986,12 +1129,106 @@ func createSynthesisHandler(
 		domain := detectQueryDomain(req.Query)
 
 		// Build synthesis response with metrics collection
-		synthesisResponse := buildSynthesisResponse(response, &req, req.Query, domain, cfg, processingTime, metricsCollector, logger)
+		synthesisResponse := buildSynthesisResponse(response, &req, req.Query, domain, cfg, processingTime,
+			grounding, metricsCollector, openaiClient, logger)
 
 		c.JSON(http.StatusOK, synthesisResponse)
 	}
 }
 
+// createSynthesisStreamHandler creates the streaming synthesis endpoint handler. Answer
+// text is relayed as SSE "token" events while it is generated, followed by a "replace"
+// event with the final answer text, which clients must show in place of the relayed tokens,
+// and a "complete" event with the same body as /synthesize, or an "error" event. When the
+// grounding policy may block or regenerate the answer, no tokens are relayed and only the
+// "complete" event is sent once the policy has run.
+func createSynthesisStreamHandler(
+	cfg *config.Config,
+	logger *zap.Logger,
+	openaiClient *internalopenai.Client,
+	metricsCollector *synthesis.MetricsCollector,
+	promptRegistry *synth.PromptRegistry,
+	priceCatalog *pricing.Catalog,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startTime := time.Now()
+
+		logger.Info("Streaming synthesis request received",
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_agent", c.GetHeader("User-Agent")),
+		)
+
+		req, valid := parseSynthesisRequest(c, logger)
+		if !valid {
+			return
+		}
+		req.promptTemplate = selectPromptTemplate(promptRegistry, req, cfg)
+
+		if req.Mode != "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request",
+				"details": req.Mode + " mode is not supported for streaming, use /synthesize",
+			})
+			return
+		}
+		req.Chunks, req.WebResults, req.injectionDetections = screenUntrustedContent(req.Chunks, req.WebResults,
+			cfg, openaiClient, logger)
+		if shouldEstimateCosts(req) {
+			req.costEstimate = estimateCosts(priceCatalog, req.Query, "", cfg, logger)
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Status(http.StatusOK)
+
+		relayTokens := !groundingWithholdsAnswer(cfg)
+		var onDelta func(delta string) error
+		if relayTokens {
+			onDelta = func(delta string) error {
+				if err := c.Request.Context().Err(); err != nil {
+					return err
+				}
+				c.SSEvent(string(streaming.EventTypeToken), gin.H{"delta": delta})
+				c.Writer.Flush()
+				return nil
+			}
+		}
+
+		response, choice, err := processSynthesisRequest(req, cfg, logger, openaiClient, onDelta)
+		if err != nil {
+			logger.Error("Streaming synthesis failed", zap.Error(err), zap.String("error_type", getErrorType(err)))
+			c.SSEvent(string(streaming.EventTypeError), gin.H{"error": "Synthesis failed", "error_type": getErrorType(err)})
+			c.Writer.Flush()
+			return
+		}
+		req.modelChoice = choice
+
+		var grounding *synth.GroundingReport
+		if relayTokens {
+			grounding = verifyAnswerGrounding(response, req.Query, req.Chunks, req.WebResults, cfg, openaiClient, logger)
+		} else {
+			response, req.modelChoice, grounding = enforceGrounding(req, response, cfg, logger, openaiClient)
+		}
+
+		processingTime := time.Since(startTime)
+		logSynthesisCompletion(req, response, processingTime, logger)
+
+		// Diagram and code extraction run on the assembled text, as for /synthesize
+		domain := detectQueryDomain(req.Query)
+		synthesisResponse := buildSynthesisResponse(response, &req, req.Query, domain, cfg, processingTime,
+			grounding, metricsCollector, openaiClient, logger)
+
+		// Citation stripping and grounding annotations change the relayed text, so the
+		// final answer replaces it
+		if relayTokens {
+			c.SSEvent(string(streaming.EventTypeReplace), gin.H{"main_text": synthesisResponse["main_text"]})
+		}
+		c.SSEvent(string(streaming.EventTypeComplete), synthesisResponse)
+		c.Writer.Flush()
+	}
+}
+
 // createRegenerationHandler creates the regeneration endpoint handler
 func createRegenerationHandler(
 	cfg *config.Config,
@@ -1008,13 +1245,15 @@ func createRegenerationHandler(
 		)
 
 		// Parse and validate regeneration request
-		req, valid := parseRegenerationRequest(c, logger)
+		req, valid := parseRegenerationRequest(c, cfg, logger)
 		if !valid {
 			return
 		}
 
 		// Apply preset parameters
-		applyParameterPreset(&req.Parameters)
+		applyParameterPreset(&req.Parameters, cfg)
+		req.Chunks, req.WebResults, req.injectionDetections = screenUntrustedContent(req.Chunks, req.WebResults,
+			cfg, openaiClient, logger)
 
 		// Process the regeneration request
 		response, err := processRegenerationRequest(req, cfg, logger, openaiClient)
@@ -1026,14 +1265,16 @@ func createRegenerationHandler(
 		// Log completion and return response
 		processingTime := time.Since(startTime)
 		logRegenerationCompletion(req, response, processingTime, logger)
-		c.JSON(http.StatusOK, buildRegenerationResponse(response, &req, req.Parameters, processingTime, req.Query))
+		grounding := verifyAnswerGrounding(response, req.Query, req.Chunks, req.WebResults, cfg, openaiClient, logger)
+		c.JSON(http.StatusOK, buildRegenerationResponse(response, &req, req.Parameters, processingTime, req.Query,
+			grounding, cfg, openaiClient, logger))
 	}
 }
 
 // createPresetsHandler creates the presets endpoint handler
-func createPresetsHandler() gin.HandlerFunc {
+func createPresetsHandler(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		presets := getParameterPresets()
+		presets := getParameterPresets(cfg)
 		c.JSON(http.StatusOK, gin.H{
 			"presets": presets,
 		})
@@ -1073,7 +1314,7 @@ func parseSynthesisRequest(c *gin.Context, logger *zap.Logger) (SynthesisRequest
 }
 
 // parseRegenerationRequest parses and validates the regeneration request
-func parseRegenerationRequest(c *gin.Context, logger *zap.Logger) (RegenerationRequest, bool) {
+func parseRegenerationRequest(c *gin.Context, cfg *config.Config, logger *zap.Logger) (RegenerationRequest, bool) {
 	var req RegenerationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logger.Error("Failed to parse regeneration request", zap.Error(err))
@@ -1084,7 +1325,7 @@ func parseRegenerationRequest(c *gin.Context, logger *zap.Logger) (RegenerationR
 		return req, false
 	}
 
-	if err := validateRegenerationRequest(req); err != nil {
+	if err := validateRegenerationRequest(req, cfg); err != nil {
 		logger.Error("Invalid regeneration request", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid request",
@@ -1102,7 +1343,8 @@ func processSynthesisRequest(
 	cfg *config.Config,
 	logger *zap.Logger,
 	openaiClient *internalopenai.Client,
-) (*internalopenai.ChatCompletionResponse, error) {
+	onDelta internalopenai.ChatCompletionDeltaFunc,
+) (*internalopenai.ChatCompletionResponse, modelChoice, error) {
 	// Convert request to internal format
 	contextItems := convertChunksToContextItems(req.Chunks)
 	webResultStrings, webSourceURLs := convertWebResults(req.WebResults)
@@ -1118,7 +1360,26 @@ func processSynthesisRequest(
 
 	// Build comprehensive prompt with conversation context and optimization
 	var messages []openai.ChatCompletionMessage
-	if cfg != nil && cfg.Synthesis.EnablePromptOptimization {
+	if req.promptTemplate != nil {
+		promptMessages, err := synth.BuildPromptMessagesFromTemplate(req.promptTemplate, req.Query, contextItems,
+			webResultStrings, req.ConversationHistory, templatePromptConfig(req.Query))
+		if err != nil {
+			return nil, modelChoice{}, fmt.Errorf("failed to render prompt template: %w", err)
+		}
+		logger.Info("Using prompt template",
+			zap.String("template_id", promptMessages.TemplateID),
+			zap.Int("template_version", promptMessages.TemplateVersion))
+		messages = []openai.ChatCompletionMessage{
+			{
+				Role:    "system",
+				Content: promptMessages.SystemMessage,
+			},
+			{
+				Role:    "user",
+				Content: promptMessages.UserMessage,
+			},
+		}
+	} else if cfg != nil && cfg.Synthesis.EnablePromptOptimization {
 		prompt := buildOptimizedPrompt(req.Query, contextItems, webResultStrings, req.ConversationHistory, cfg, logger)
 		// Legacy format - convert to single user message for backward compatibility
 		messages = []openai.ChatCompletionMessage{
@@ -1142,10 +1403,32 @@ func processSynthesisRequest(
 		}
 	}
 
-	// Call OpenAI Chat Completion API with adaptive timeout
+	if req.groundingFeedback != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.groundingFeedback,
+		})
+	}
+	if req.scaffoldInstructions != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.scaffoldInstructions,
+		})
+	}
+	if req.costEstimate != nil {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: req.costEstimate.Context(),
+		})
+	}
+
+	// Call OpenAI Chat Completion API with adaptive timeout and the model routed for the query
 	timeoutDuration := getAdaptiveTimeout(cfg, req, logger)
+	route := routeModel(req, cfg, logger)
 	logger.Info("Starting synthesis with adaptive timeout",
 		zap.Duration("timeout_duration", timeoutDuration),
+		zap.String("model", route.Model),
+		zap.String("routing_reason", route.Reason),
 		zap.Int("context_items", len(req.Chunks)),
 		zap.Int("web_results", len(req.WebResults)),
 		zap.Int("query_length", len(req.Query)))
@@ -1158,14 +1441,22 @@ func processSynthesisRequest(
 	// Handle test mode with mock response
 	if openaiClient == nil {
 		logger.Info("Using mock OpenAI response for test mode")
+		content := generateMockSynthesisResponse(req.Query, contextItems)
+		if onDelta != nil {
+			for _, word := range strings.SplitAfter(content, " ") {
+				if err := onDelta(word); err != nil {
+					return nil, modelChoice{}, err
+				}
+			}
+		}
 		return &internalopenai.ChatCompletionResponse{
-			Content: generateMockSynthesisResponse(req.Query, contextItems),
+			Content: content,
 			Usage: openai.Usage{
 				PromptTokens:     100,
 				CompletionTokens: 200,
 				TotalTokens:      300,
 			},
-		}, nil
+		}, route.choice(), nil
 	}
 
 	// Configure custom retry logic for synthesis service with rate limit awareness
@@ -1183,12 +1474,31 @@ func processSynthesisRequest(
 
 	// Track OpenAI API call timing
 	openaiStart := time.Now()
-	response, err := openaiClient.CreateChatCompletionWithRetry(ctx, internalopenai.ChatCompletionRequest{
-		Model:       cfg.Synthesis.Model,
-		MaxTokens:   cfg.Synthesis.MaxTokens,
-		Temperature: float32(cfg.Synthesis.Temperature),
-		Messages:    messages,
-	}, retryConfig)
+	delivered := false
+	response, choice, err := completeWithFallback(ctx, route, retryConfig, logger,
+		func(ctx context.Context, model string, retryConfig resilience.BackoffConfig) (*internalopenai.ChatCompletionResponse, error) {
+			completionReq := internalopenai.ChatCompletionRequest{
+				Model:       model,
+				MaxTokens:   cfg.Synthesis.MaxTokens,
+				Temperature: float32(cfg.Synthesis.Temperature),
+				Messages:    messages,
+			}
+			if onDelta == nil {
+				return createSynthesisCompletion(ctx, openaiClient, completionReq, retryConfig, cfg,
+					availableSources(req.Chunks, req.WebResults), logger)
+			}
+
+			// Streamed answers are always requested as text; structured output is parsed
+			// only once complete and cannot be relayed token by token
+			response, err := openaiClient.CreateChatCompletionStream(ctx, completionReq, retryConfig, func(delta string) error {
+				delivered = true
+				return onDelta(delta)
+			})
+			if err != nil && delivered {
+				return nil, fmt.Errorf("%w: %w", errContentDelivered, err)
+			}
+			return response, err
+		})
 
 	openaiDuration := time.Since(openaiStart)
 	totalDuration := time.Since(performanceStart)
@@ -1198,7 +1508,7 @@ func processSynthesisRequest(
 		errorType := getErrorType(err)
 		logger.Error("Synthesis OpenAI API call failed",
 			zap.Error(err),
-			zap.String("model", cfg.Synthesis.Model),
+			zap.String("model", choice.Model),
 			zap.Duration("openai_duration", openaiDuration),
 			zap.Duration("total_duration", totalDuration),
 			zap.Duration("timeout_duration", timeoutDuration),
@@ -1220,7 +1530,7 @@ func processSynthesisRequest(
 			logger.Error("OpenAI API timeout detected",
 				zap.Duration("timeout_duration", timeoutDuration),
 				zap.Duration("actual_duration", totalDuration),
-				zap.String("model", cfg.Synthesis.Model),
+				zap.String("model", choice.Model),
 				zap.Int("context_items", len(req.Chunks)),
 				zap.Int("web_results", len(req.WebResults)),
 				zap.String("query_complexity", calculateQueryComplexity(req, logger)),
@@ -1228,7 +1538,7 @@ func processSynthesisRequest(
 			)
 		}
 
-		return nil, fmt.Errorf("failed to call OpenAI API: %w", err)
+		return nil, choice, fmt.Errorf("failed to call OpenAI API: %w", err)
 	}
 
 	// Log detailed performance metrics
@@ -1242,9 +1552,12 @@ func processSynthesisRequest(
 		zap.Int("completion_tokens", response.Usage.CompletionTokens),
 		zap.Int("total_tokens", response.Usage.TotalTokens),
 		zap.String("finish_reason", response.FinishReason),
+		zap.String("model", choice.Model),
+		zap.String("routing_reason", choice.Reason),
+		zap.Strings("model_fallbacks", choice.FallbackFrom),
 	)
 
-	return response, err
+	return response, choice, nil
 }
 
 // processRegenerationRequest handles the core regeneration logic with custom parameters
@@ -1350,12 +1663,12 @@ func processRegenerationRequest(
 
 	// Track OpenAI API call timing for regeneration
 	openaiStart := time.Now()
-	response, err := openaiClient.CreateChatCompletionWithRetry(ctx, internalopenai.ChatCompletionRequest{
+	response, err := createSynthesisCompletion(ctx, openaiClient, internalopenai.ChatCompletionRequest{
 		Model:       req.Parameters.Model,
 		MaxTokens:   req.Parameters.MaxTokens,
 		Temperature: req.Parameters.Temperature,
 		Messages:    messages,
-	}, retryConfig)
+	}, retryConfig, cfg, availableSources(req.Chunks, req.WebResults), logger)
 
 	openaiDuration := time.Since(openaiStart)
 	totalDuration := time.Since(performanceStart)
@@ -1519,22 +1832,9 @@ func logSynthesisCompletion(
 	processingTime time.Duration,
 	logger *zap.Logger,
 ) {
-	allAvailableSources := make([]string, 0, len(req.Chunks)+len(req.WebResults))
-	for _, chunk := range req.Chunks {
-		// Prefer SourceID if available, otherwise use DocID
-		if chunk.SourceID != "" {
-			allAvailableSources = append(allAvailableSources, chunk.SourceID)
-		} else if chunk.DocID != "" {
-			allAvailableSources = append(allAvailableSources, chunk.DocID)
-		}
-	}
-	for _, webResult := range req.WebResults {
-		if webResult.URL != "" {
-			allAvailableSources = append(allAvailableSources, webResult.URL)
-		}
-	}
+	allAvailableSources := availableSources(req.Chunks, req.WebResults)
 
-	synthesisResponse := synth.ParseResponseWithQuery(response.Content, allAvailableSources, req.Query)
+	synthesisResponse := parseSynthesisResponse(response, allAvailableSources, req.Query, logger)
 
 	logger.Info("Synthesis completed",
 		zap.String("query", req.Query),
@@ -1558,22 +1858,9 @@ func logRegenerationCompletion(
 	processingTime time.Duration,
 	logger *zap.Logger,
 ) {
-	allAvailableSources := make([]string, 0, len(req.Chunks)+len(req.WebResults))
-	for _, chunk := range req.Chunks {
-		// Prefer SourceID if available, otherwise use DocID
-		if chunk.SourceID != "" {
-			allAvailableSources = append(allAvailableSources, chunk.SourceID)
-		} else if chunk.DocID != "" {
-			allAvailableSources = append(allAvailableSources, chunk.DocID)
-		}
-	}
-	for _, webResult := range req.WebResults {
-		if webResult.URL != "" {
-			allAvailableSources = append(allAvailableSources, webResult.URL)
-		}
-	}
+	allAvailableSources := availableSources(req.Chunks, req.WebResults)
 
-	synthesisResponse := synth.ParseResponseWithQuery(response.Content, allAvailableSources, req.Query)
+	synthesisResponse := parseSynthesisResponse(response, allAvailableSources, req.Query, logger)
 
 	logger.Info("Regeneration completed",
 		zap.String("query", req.Query),
@@ -1603,24 +1890,12 @@ func buildSynthesisResponse(
 	domain QueryDomain,
 	cfg *config.Config,
 	processingTime time.Duration,
+	grounding *synth.GroundingReport,
 	metricsCollector *synthesis.MetricsCollector,
+	openaiClient *internalopenai.Client,
 	logger *zap.Logger,
 ) gin.H {
-	// Build available sources from chunks and web results
-	allAvailableSources := make([]string, 0, len(req.Chunks)+len(req.WebResults))
-	for _, chunk := range req.Chunks {
-		// Prefer SourceID if available, otherwise use DocID
-		if chunk.SourceID != "" {
-			allAvailableSources = append(allAvailableSources, chunk.SourceID)
-		} else if chunk.DocID != "" {
-			allAvailableSources = append(allAvailableSources, chunk.DocID)
-		}
-	}
-	for _, webResult := range req.WebResults {
-		if webResult.URL != "" {
-			allAvailableSources = append(allAvailableSources, webResult.URL)
-		}
-	}
+	allAvailableSources := availableSources(req.Chunks, req.WebResults)
 
 	// DEBUG: Log raw OpenAI response to understand parsing issues
 	logger.Info("Raw OpenAI response content",
@@ -1628,7 +1903,11 @@ func buildSynthesisResponse(
 		zap.Int("content_length", len(response.Content)),
 		zap.String("query", query))
 
-	synthesisResponse := synth.ParseResponseWithQuery(response.Content, allAvailableSources, query)
+	synthesisResponse := parseSynthesisResponse(response, allAvailableSources, query, logger)
+	verifyWebCitations(&synthesisResponse, req.Chunks, req.WebResults, cfg, logger)
+
+	// Repair the diagram, or drop it when it cannot be rendered
+	diagramCheck := checkAnswerDiagram(&synthesisResponse, cfg, openaiClient, logger)
 
 	// Enhanced monitoring for code snippet generation rates
 	logCodeSnippetGeneration(query, synthesisResponse.CodeSnippets, domain)
@@ -1647,7 +1926,7 @@ func buildSynthesisResponse(
 	}
 
 	// Perform quality validation
-	qualityMetrics := validateResponseQuality(response.Content, query, domain)
+	qualityMetrics := validateResponseQuality(responseText(response, synthesisResponse), query, domain)
 
 	// Implement fallback mechanisms for code generation failures
 	if shouldGenerateCodeFallback(query, synthesisResponse, response.FinishReason) {
@@ -1663,6 +1942,14 @@ func buildSynthesisResponse(
 		synthesisResponse.CodeSnippets = append(synthesisResponse.CodeSnippets, fallbackSnippets...)
 	}
 
+	// Check the snippets' syntax, resource and command names, and security policies
+	codeValidation := validateAnswerSnippets(&synthesisResponse, cfg, logger)
+
+	// Annotate or block the answer when too few of its claims are supported
+	applyGroundingPolicy(&synthesisResponse, grounding, cfg)
+	synthesisResponse.PipelineDecision.QueryType = synth.QueryTypeName(synth.DetectQueryType(query))
+	synthesisResponse.PipelineDecision.InjectionDetections = req.injectionDetections
+
 	// Record metrics for code generation
 	domainStr := string(domain)
 	hasCode := len(synthesisResponse.CodeSnippets) > 0
@@ -1686,19 +1973,30 @@ func buildSynthesisResponse(
 	// Record response quality metrics
 	metricsCollector.RecordResponseQuality(qualityMetrics.OverallQualityScore, processingTime, hasCode, hasDiagram)
 
+	processingStats := promptProcessingStats(req, response, cfg)
 	return gin.H{
-		"main_text":     synthesisResponse.MainText,
-		"diagram_code":  synthesisResponse.DiagramCode,
-		"code_snippets": synthesisResponse.CodeSnippets,
-		"sources":       synthesisResponse.Sources,
+		"main_text":         synthesisResponse.MainText,
+		"diagram_code":      synthesisResponse.DiagramCode,
+		"code_snippets":     synthesisResponse.CodeSnippets,
+		"sources":           synthesisResponse.Sources,
+		"web_sources":       synthesisResponse.WebSources,
+		"sections":          synthesisResponse.Sections,
+		"assumptions":       synthesisResponse.Assumptions,
+		"grounding":         synthesisResponse.Grounding,
+		"diagram_check":     diagramCheck,
+		"code_validation":   codeValidation,
+		"cost_estimate":     req.costEstimate,
+		"pipeline_decision": synthesisResponse.PipelineDecision,
 		"metadata": gin.H{
 			"processing_time":   processingTime.Milliseconds(),
 			"total_tokens":      response.Usage.TotalTokens,
 			"prompt_tokens":     response.Usage.PromptTokens,
 			"completion_tokens": response.Usage.CompletionTokens,
-			"model":             cfg.Synthesis.Model,
+			"model":             processingStats.ModelUsed,
+			"output_mode":       responseOutputMode(response),
 		},
-		"quality_metrics": qualityMetrics,
+		"processing_stats": processingStats,
+		"quality_metrics":  qualityMetrics,
 	}
 }
 
@@ -1709,29 +2007,32 @@ func buildRegenerationResponse(
 	params GenerationParams,
 	processingTime time.Duration,
 	query string,
+	grounding *synth.GroundingReport,
+	cfg *config.Config,
+	openaiClient *internalopenai.Client,
+	logger *zap.Logger,
 ) gin.H {
-	// Build available sources from chunks and web results
-	allAvailableSources := make([]string, 0, len(req.Chunks)+len(req.WebResults))
-	for _, chunk := range req.Chunks {
-		// Prefer SourceID if available, otherwise use DocID
-		if chunk.SourceID != "" {
-			allAvailableSources = append(allAvailableSources, chunk.SourceID)
-		} else if chunk.DocID != "" {
-			allAvailableSources = append(allAvailableSources, chunk.DocID)
-		}
-	}
-	for _, webResult := range req.WebResults {
-		if webResult.URL != "" {
-			allAvailableSources = append(allAvailableSources, webResult.URL)
-		}
-	}
-	synthesisResponse := synth.ParseResponseWithQuery(response.Content, allAvailableSources, query)
+	allAvailableSources := availableSources(req.Chunks, req.WebResults)
+	synthesisResponse := parseSynthesisResponse(response, allAvailableSources, query, logger)
+	verifyWebCitations(&synthesisResponse, req.Chunks, req.WebResults, cfg, logger)
+	diagramCheck := checkAnswerDiagram(&synthesisResponse, cfg, openaiClient, logger)
+	codeValidation := validateAnswerSnippets(&synthesisResponse, cfg, logger)
+	applyGroundingPolicy(&synthesisResponse, grounding, cfg)
+	synthesisResponse.PipelineDecision.QueryType = synth.QueryTypeName(synth.DetectQueryType(query))
+	synthesisResponse.PipelineDecision.InjectionDetections = req.injectionDetections
 
 	return gin.H{
-		"main_text":     synthesisResponse.MainText,
-		"diagram_code":  synthesisResponse.DiagramCode,
-		"code_snippets": synthesisResponse.CodeSnippets,
-		"sources":       synthesisResponse.Sources,
+		"main_text":         synthesisResponse.MainText,
+		"diagram_code":      synthesisResponse.DiagramCode,
+		"code_snippets":     synthesisResponse.CodeSnippets,
+		"sources":           synthesisResponse.Sources,
+		"web_sources":       synthesisResponse.WebSources,
+		"sections":          synthesisResponse.Sections,
+		"assumptions":       synthesisResponse.Assumptions,
+		"grounding":         synthesisResponse.Grounding,
+		"diagram_check":     diagramCheck,
+		"code_validation":   codeValidation,
+		"pipeline_decision": synthesisResponse.PipelineDecision,
 		"regeneration": gin.H{
 			"preset":      params.Preset,
 			"temperature": params.Temperature,
@@ -1744,11 +2045,118 @@ func buildRegenerationResponse(
 			"prompt_tokens":     response.Usage.PromptTokens,
 			"completion_tokens": response.Usage.CompletionTokens,
 			"model":             params.Model,
+			"output_mode":       responseOutputMode(response),
 			"is_regeneration":   true,
 		},
 	}
 }
 
+// availableSources returns the source IDs and URLs the answer may cite. Chunks are
+// identified by SourceID when set, otherwise by DocID.
+func availableSources(chunks []ChunkItem, webResults []WebResult) []string {
+	sources := make([]string, 0, len(chunks)+len(webResults))
+	for _, chunk := range chunks {
+		if chunk.SourceID != "" {
+			sources = append(sources, chunk.SourceID)
+		} else if chunk.DocID != "" {
+			sources = append(sources, chunk.DocID)
+		}
+	}
+	for _, webResult := range webResults {
+		if webResult.URL != "" {
+			sources = append(sources, webResult.URL)
+		}
+	}
+	return sources
+}
+
+// createSynthesisCompletion calls the model in the configured output mode. In structured
+// mode the answer is requested through a function call and validated; when the call
+// returns no valid answer the request is repeated in text mode so the markdown parser
+// still produces a response.
+func createSynthesisCompletion(
+	ctx context.Context,
+	openaiClient *internalopenai.Client,
+	req internalopenai.ChatCompletionRequest,
+	retryConfig resilience.BackoffConfig,
+	cfg *config.Config,
+	sources []string,
+	logger *zap.Logger,
+) (*internalopenai.ChatCompletionResponse, error) {
+	if cfg == nil || cfg.Synthesis.OutputMode != synth.OutputModeStructured {
+		return openaiClient.CreateChatCompletionWithRetry(ctx, req, retryConfig)
+	}
+
+	structuredReq := req
+	structuredReq.Messages = append(append([]openai.ChatCompletionMessage{}, req.Messages...), openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: synth.BuildStructuredOutputInstructions(),
+	})
+	structuredReq.Function = &openai.FunctionDefinition{
+		Name:        synth.StructuredAnswerFunction,
+		Description: "Submit the answer to the user's question as structured sections, diagram, code snippets and assumptions",
+		Parameters:  synth.StructuredAnswerSchema,
+	}
+
+	response, err := openaiClient.CreateChatCompletionWithRetry(ctx, structuredReq, retryConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	_, parseErr := synth.ParseStructuredAnswer(response.FunctionArguments, sources)
+	if parseErr == nil {
+		return response, nil
+	}
+
+	logger.Warn("Structured synthesis output was invalid, falling back to text output",
+		zap.Error(parseErr),
+		zap.String("finish_reason", response.FinishReason),
+		zap.Int("arguments_length", len(response.FunctionArguments)))
+
+	fallback, err := openaiClient.CreateChatCompletionWithRetry(ctx, req, retryConfig)
+	if err != nil {
+		return nil, err
+	}
+	fallback.Usage.PromptTokens += response.Usage.PromptTokens
+	fallback.Usage.CompletionTokens += response.Usage.CompletionTokens
+	fallback.Usage.TotalTokens += response.Usage.TotalTokens
+	return fallback, nil
+}
+
+// parseSynthesisResponse converts the model response to a synthesis response, using the
+// structured answer when the model returned one and the text parser otherwise
+func parseSynthesisResponse(
+	response *internalopenai.ChatCompletionResponse,
+	sources []string,
+	query string,
+	logger *zap.Logger,
+) synth.SynthesisResponse {
+	if response.FunctionArguments != "" {
+		answer, err := synth.ParseStructuredAnswer(response.FunctionArguments, sources)
+		if err == nil {
+			return answer.ToSynthesisResponse(query)
+		}
+		logger.Warn("Failed to parse structured answer, using text parser", zap.Error(err))
+	}
+	return synth.ParseResponseWithQuery(response.Content, sources, query)
+}
+
+// responseText returns the answer text used for quality scoring
+func responseText(response *internalopenai.ChatCompletionResponse, synthesisResponse synth.SynthesisResponse) string {
+	if response.FunctionArguments != "" {
+		return synthesisResponse.MainText
+	}
+	return response.Content
+}
+
+// responseOutputMode reports whether the response was produced in structured or text mode
+func responseOutputMode(response *internalopenai.ChatCompletionResponse) string {
+	if response.FunctionArguments != "" {
+		return synth.OutputModeStructured
+	}
+	return synth.OutputModeText
+}
+
 // startServer starts the HTTP server
 func startServer(router *gin.Engine, cfg *config.Config, logger *zap.Logger) {
 	port := ":8082"
@@ -1792,10 +2200,10 @@ func validateSynthesisSourceMetadata(
 
 	// Validate web source URLs
 	invalidURLCount := 0
-	for i, url := range webSourceURLs {
-		if !isValidWebSourceURL(url) {
+	for i, sourceURL := range webSourceURLs {
+		if !isValidWebSourceURL(sourceURL) {
 			invalidURLCount++
-			logger.Debug("Invalid web source URL", zap.Int("url_index", i), zap.String("url", url))
+			logger.Debug("Invalid web source URL", zap.Int("url_index", i), zap.String("url", sourceURL))
 		}
 	}
 
@@ -1818,14 +2226,46 @@ func validateSynthesisSourceMetadata(
 	return nil
 }
 
-// isValidWebSourceURL validates a web source URL
-func isValidWebSourceURL(url string) bool {
-	if strings.TrimSpace(url) == "" {
+// isValidWebSourceURL validates a web source URL. Whether the URL was actually returned
+// by web search is checked separately by verifyWebCitations.
+func isValidWebSourceURL(rawURL string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
 		return false
 	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Hostname() != ""
+}
+
+// verifyWebCitations checks the URLs cited in the answer against the web results sent
+// with the request, stripping or flagging the ones web search did not return. Source
+// URLs of the request's chunks are knowledge base citations and are never stripped.
+func verifyWebCitations(
+	synthesisResponse *synth.SynthesisResponse,
+	chunks []ChunkItem,
+	webResults []WebResult,
+	cfg *config.Config,
+	logger *zap.Logger,
+) {
+	mode := synth.CitationModeStrip
+	if cfg != nil && cfg.Synthesis.UnverifiedWebCitations != "" {
+		mode = cfg.Synthesis.UnverifiedWebCitations
+	}
 
-	url = strings.TrimSpace(url)
-	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+	contextSources := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		if chunk.SourceID != "" {
+			contextSources = append(contextSources, chunk.SourceID)
+		}
+	}
+
+	webResultStrings, _ := convertWebResults(webResults)
+	verification := synth.VerifyWebCitations(synthesisResponse, webResultStrings, contextSources, mode)
+	if len(verification.Unverified) > 0 {
+		logger.Warn("Answer cited web URLs that web search did not return",
+			zap.Strings("unverified_urls", verification.Unverified),
+			zap.Int("verified_count", len(verification.Verified)),
+			zap.String("mode", mode))
+	}
 }
 
 // initializeLogger creates a logger based on configuration settings
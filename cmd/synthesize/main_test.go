@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -407,6 +408,8 @@ func TestIsValidWebSourceURL(t *testing.T) {
 		{name: "Invalid scheme", url: "ftp://example.com", want: false},
 		{name: "No scheme", url: "example.com", want: false},
 		{name: "URL with whitespace", url: "  https://example.com  ", want: true},
+		{name: "Scheme without host", url: "https://", want: false},
+		{name: "Malformed URL", url: "https://exa mple.com/%zz", want: false},
 	}
 
 	for _, tt := range tests {
@@ -417,6 +420,86 @@ func TestIsValidWebSourceURL(t *testing.T) {
 	}
 }
 
+// TestVerifyWebCitations tests that cited URLs are checked against the request's web results
+func TestVerifyWebCitations(t *testing.T) {
+	webResults := []WebResult{
+		{Title: "EKS 1.31", Snippet: "EKS supports 1.31", URL: "https://aws.amazon.com/eks/whats-new"},
+	}
+	answer := "EKS supports 1.31 [https://aws.amazon.com/eks/whats-new] and GKE too [https://made-up.example.com/gke]."
+
+	stripped := synth.SynthesisResponse{MainText: answer}
+	verifyWebCitations(&stripped, nil, webResults, &config.Config{}, zap.NewNop())
+	assert.NotContains(t, stripped.MainText, "made-up.example.com")
+	assert.Contains(t, stripped.MainText, "[https://aws.amazon.com/eks/whats-new]")
+	require.Len(t, stripped.WebSources, 2)
+	assert.True(t, stripped.WebSources[0].Verified)
+	assert.False(t, stripped.WebSources[1].Verified)
+
+	flagged := synth.SynthesisResponse{MainText: answer}
+	cfg := &config.Config{Synthesis: config.SynthesisConfig{UnverifiedWebCitations: synth.CitationModeFlag}}
+	verifyWebCitations(&flagged, nil, webResults, cfg, zap.NewNop())
+	assert.Equal(t, answer, flagged.MainText)
+	require.Len(t, flagged.WebSources, 2)
+	assert.Equal(t, "made-up.example.com", flagged.WebSources[1].Domain)
+
+	// Internal documents use their source URL as source ID and are cited by it
+	internalURL := "https://confluence.example.com/display/SA/eks-runbook"
+	chunks := []ChunkItem{{Text: "Upgrade runbook", DocID: "eks-runbook", SourceID: internalURL}}
+	internal := synth.SynthesisResponse{
+		MainText: "Follow the runbook [" + internalURL + "]. GKE too [https://made-up.example.com/gke].",
+		Sources:  []string{internalURL},
+	}
+	verifyWebCitations(&internal, chunks, webResults, &config.Config{}, zap.NewNop())
+	assert.Contains(t, internal.MainText, "["+internalURL+"]")
+	assert.NotContains(t, internal.MainText, "made-up.example.com")
+	assert.Equal(t, []string{internalURL}, internal.Sources)
+}
+
+// TestSynthesisHandlerKeepsReleaseNoteCitations tests that a freshness answer built only
+// from release notes, which skip web search, keeps its release-note citations
+func TestSynthesisHandlerKeepsReleaseNoteCitations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	releaseNoteURL := "https://aws.amazon.com/about-aws/whats-new/2025/09/amazon-eks-kubernetes-1-34/"
+	mockServer := mockOpenAIServer(t, map[string]string{
+		"chat": createMockChatResponseWithContent(
+			"Amazon EKS added support for Kubernetes 1.34 this month [" + releaseNoteURL + "]."),
+	})
+	defer mockServer.Close()
+
+	handler := createSynthesisHandler(createTestConfig(), logger, createTestOpenAIClient(mockServer.URL, logger),
+		synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+	// Release-note chunks use the feed item link as their source ID
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query: "What changed in EKS this month?",
+		Chunks: []ChunkItem{{
+			Text:     "Amazon EKS now supports Kubernetes version 1.34.",
+			DocID:    "release-note-eks-1-34_chunk_0",
+			SourceID: releaseNoteURL,
+		}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response synth.SynthesisResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Contains(t, response.MainText, "["+releaseNoteURL+"]")
+	assert.Contains(t, response.Sources, releaseNoteURL)
+	for _, source := range response.WebSources {
+		assert.NotEqual(t, releaseNoteURL, source.URL, "release notes are not unverified web sources")
+	}
+}
+
 // TestInitializeLogger tests logger initialization
 func TestInitializeLogger(t *testing.T) {
 	tests := []struct {
@@ -522,7 +605,7 @@ func TestSynthesisHandler(t *testing.T) {
 	testMetricsCollector := synthesis.NewMetricsCollector(logger, nil)
 
 	// Create handler
-	handler := createSynthesisHandler(cfg, logger, openaiClient, testMetricsCollector)
+	handler := createSynthesisHandler(cfg, logger, openaiClient, testMetricsCollector, nil, nil)
 
 	// Set Gin to test mode
 	gin.SetMode(gin.TestMode)
@@ -632,7 +715,7 @@ func TestSynthesisHandlerWithWebResults(t *testing.T) {
 	testMetricsCollector := synthesis.NewMetricsCollector(logger, nil)
 
 	// Create handler
-	handler := createSynthesisHandler(cfg, logger, openaiClient, testMetricsCollector)
+	handler := createSynthesisHandler(cfg, logger, openaiClient, testMetricsCollector, nil, nil)
 
 	// Set Gin to test mode
 	gin.SetMode(gin.TestMode)
@@ -745,7 +828,7 @@ func TestErrorHandling(t *testing.T) {
 	testMetricsCollector := synthesis.NewMetricsCollector(logger, nil)
 
 	// Create handler
-	handler := createSynthesisHandler(cfg, logger, openaiClient, testMetricsCollector)
+	handler := createSynthesisHandler(cfg, logger, openaiClient, testMetricsCollector, nil, nil)
 
 	// Set Gin to test mode
 	gin.SetMode(gin.TestMode)
@@ -803,7 +886,7 @@ func TestInvalidJSON(t *testing.T) {
 	testMetricsCollector := synthesis.NewMetricsCollector(logger, nil)
 
 	// Create handler
-	handler := createSynthesisHandler(cfg, logger, openaiClient, testMetricsCollector)
+	handler := createSynthesisHandler(cfg, logger, openaiClient, testMetricsCollector, nil, nil)
 
 	// Set Gin to test mode
 	gin.SetMode(gin.TestMode)
@@ -916,3 +999,286 @@ func TestConfigurationLoading(t *testing.T) {
 	openaiClient := createTestOpenAIClient(mockServer.URL, logger)
 	assert.NotNil(t, openaiClient)
 }
+
+// createMockFunctionCallResponse creates a mock chat completion answering through a function call
+func createMockFunctionCallResponse(arguments string) string {
+	encoded, _ := json.Marshal(arguments)
+	return `{
+		"id": "chatcmpl-test",
+		"object": "chat.completion",
+		"created": 1234567890,
+		"model": "gpt-4o",
+		"choices": [
+			{
+				"index": 0,
+				"message": {
+					"role": "assistant",
+					"content": "",
+					"tool_calls": [
+						{
+							"id": "call_1",
+							"type": "function",
+							"function": {"name": "` + synth.StructuredAnswerFunction + `", "arguments": ` + string(encoded) + `}
+						}
+					]
+				},
+				"finish_reason": "tool_calls"
+			}
+		],
+		"usage": {
+			"prompt_tokens": 100,
+			"completion_tokens": 50,
+			"total_tokens": 150
+		}
+	}`
+}
+
+// TestSynthesisHandlerStructuredOutput tests synthesis in structured output mode
+func TestSynthesisHandlerStructuredOutput(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	validAnswer := `{
+		"sections": [{"heading": "Overview", "paragraphs": [{"text": "Run the workloads on EKS.", "citations": ["source1"]}]}],
+		"diagram": "graph TD\n  A[Users] --> B[EKS]",
+		"code_snippets": [{"language": "bash", "filename": "scripts/deploy.sh", "purpose": "Deploys the manifests.", "code": "kubectl apply -f k8s/"}],
+		"assumptions": ["The cluster already exists."]
+	}`
+
+	tests := []struct {
+		name          string
+		arguments     string
+		wantMode      string
+		wantRequests  int
+		checkResponse func(t *testing.T, response map[string]interface{})
+	}{
+		{
+			name:         "valid structured answer",
+			arguments:    validAnswer,
+			wantMode:     synth.OutputModeStructured,
+			wantRequests: 1,
+			checkResponse: func(t *testing.T, response map[string]interface{}) {
+				assert.Contains(t, response["main_text"], "Run the workloads on EKS. [source1]")
+				assert.Equal(t, []interface{}{"The cluster already exists."}, response["assumptions"])
+				require.Len(t, response["sections"], 1)
+
+				snippets, ok := response["code_snippets"].([]interface{})
+				require.True(t, ok)
+				require.NotEmpty(t, snippets)
+				snippet := snippets[0].(map[string]interface{})
+				assert.Equal(t, "scripts/deploy.sh", snippet["filename"])
+				assert.Equal(t, "Deploys the manifests.", snippet["purpose"])
+			},
+		},
+		{
+			name:         "invalid structured answer falls back to text",
+			arguments:    `{"sections": [], "diagram": "", "code_snippets": [], "assumptions": []}`,
+			wantMode:     synth.OutputModeText,
+			wantRequests: 2,
+			checkResponse: func(t *testing.T, response map[string]interface{}) {
+				assert.Contains(t, response["main_text"], "comprehensive test response")
+				assert.Nil(t, response["sections"])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []map[string]interface{}
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				requests = append(requests, body)
+
+				w.Header().Set("Content-Type", "application/json")
+				if _, ok := body["tools"]; ok {
+					_, _ = w.Write([]byte(createMockFunctionCallResponse(tt.arguments)))
+					return
+				}
+				_, _ = w.Write([]byte(createMockChatResponse()))
+			}))
+			defer mockServer.Close()
+
+			cfg := createTestConfig()
+			cfg.Synthesis.OutputMode = synth.OutputModeStructured
+			handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(mockServer.URL, logger),
+				synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+			reqBody, err := json.Marshal(SynthesisRequest{
+				Query:  "Deploy our services to EKS",
+				Chunks: []ChunkItem{{Text: "EKS guidance", DocID: "doc1", SourceID: "source1"}},
+			})
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+			require.NoError(t, err)
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler(c)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Len(t, requests, tt.wantRequests)
+			assert.Contains(t, requests[0], "tools")
+			if tt.wantRequests > 1 {
+				assert.NotContains(t, requests[1], "tools")
+			}
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			metadata, ok := response["metadata"].(map[string]interface{})
+			require.True(t, ok)
+			assert.Equal(t, tt.wantMode, metadata["output_mode"])
+			tt.checkResponse(t, response)
+		})
+	}
+}
+
+// parseSSEBody splits a recorded SSE response into event names and data payloads
+func parseSSEBody(t *testing.T, body string) ([]string, []string) {
+	t.Helper()
+	var names, payloads []string
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var name, data string
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			}
+		}
+		names = append(names, name)
+		payloads = append(payloads, data)
+	}
+	return names, payloads
+}
+
+// TestSynthesisStreamHandler tests the streaming synthesis endpoint
+func TestSynthesisStreamHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, true, body["stream"])
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"Deploy to ", "EKS [source1].\n\n```mermaid\ngraph TD\n  A --> B\n```"} {
+			encoded, _ := json.Marshal(delta)
+			_, _ = fmt.Fprintf(w, "data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%s}}]}\n\n", encoded)
+		}
+		_, _ = fmt.Fprint(w, "data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer mockServer.Close()
+
+	handler := createSynthesisStreamHandler(createTestConfig(), logger, createTestOpenAIClient(mockServer.URL, logger),
+		synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  "Deploy our services to EKS",
+		Chunks: []ChunkItem{{Text: "EKS guidance", DocID: "doc1", SourceID: "source1"}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize/stream", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	names, payloads := parseSSEBody(t, w.Body.String())
+	require.Equal(t, []string{"token", "token", "replace", "complete"}, names)
+
+	var token map[string]string
+	require.NoError(t, json.Unmarshal([]byte(payloads[0]), &token))
+	assert.Equal(t, "Deploy to ", token["delta"])
+
+	// The diagram is extracted from the assembled text
+	var complete map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(payloads[3]), &complete))
+	assert.Contains(t, complete["main_text"], "Deploy to EKS")
+	assert.Contains(t, complete["diagram_code"], "graph TD")
+
+	var replace map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(payloads[2]), &replace))
+	assert.Equal(t, complete["main_text"], replace["main_text"])
+}
+
+// TestSynthesisStreamHandlerReplacesStrippedCitations tests that a web citation stripped
+// after streaming is removed from the answer by the replace event
+func TestSynthesisStreamHandlerReplacesStrippedCitations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	unverifiedURL := "https://example.com/made-up-announcement"
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		encoded, _ := json.Marshal("EKS supports Kubernetes 1.34 [" + unverifiedURL + "].")
+		_, _ = fmt.Fprintf(w, "data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%s}}]}\n\n", encoded)
+		_, _ = fmt.Fprint(w, "data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer mockServer.Close()
+
+	handler := createSynthesisStreamHandler(createTestConfig(), logger, createTestOpenAIClient(mockServer.URL, logger),
+		synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  "Which Kubernetes versions does EKS support?",
+		Chunks: []ChunkItem{{Text: "EKS guidance", DocID: "doc1", SourceID: "source1"}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize/stream", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	names, payloads := parseSSEBody(t, w.Body.String())
+	require.Equal(t, []string{"token", "replace", "complete"}, names)
+	assert.Contains(t, payloads[0], unverifiedURL)
+
+	var replace map[string]string
+	require.NoError(t, json.Unmarshal([]byte(payloads[1]), &replace))
+	assert.Contains(t, replace["main_text"], "EKS supports Kubernetes 1.34")
+	assert.NotContains(t, replace["main_text"], unverifiedURL)
+}
+
+// TestSynthesisStreamHandlerTestMode tests that the mock response is streamed without an OpenAI client
+func TestSynthesisStreamHandlerTestMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	handler := createSynthesisStreamHandler(createTestConfig(), logger, nil, synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  "Migrate our VMs to AWS",
+		Chunks: []ChunkItem{{Text: "Migration guidance", DocID: "doc1", SourceID: "source1"}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize/stream", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	names, _ := parseSSEBody(t, w.Body.String())
+	require.Greater(t, len(names), 2)
+	assert.Equal(t, "token", names[0])
+	assert.Equal(t, "complete", names[len(names)-1])
+}
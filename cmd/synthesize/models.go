@@ -0,0 +1,95 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/llm"
+	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
+	"go.uber.org/zap"
+)
+
+// synthesisModels are the chat models the synthesize service may use
+type synthesisModels struct {
+	// Standard is the synthesis model, used by every preset but concise
+	Standard string
+	// Fast is the cheaper model of the concise preset
+	Fast string
+	// Others are the further models a regeneration request may select
+	Others []string
+}
+
+// routedModels returns the synthesis models of the synthesize route. Models the synthesis
+// settings and the route do not name come from the route's provider, and the fast model
+// falls back to the synthesis model when the provider names none either.
+func routedModels(cfg *config.Config) synthesisModels {
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+
+	route, provider, _ := cfg.ChatRoute(config.LLMServiceSynthesize)
+	models := synthesisModels{Standard: cfg.Synthesis.Model, Fast: route.FastModel, Others: route.Models}
+	if models.Standard == "" {
+		models.Standard = provider.Model
+	}
+	if models.Fast == "" {
+		models.Fast = provider.FastModel
+	}
+	if models.Fast == "" {
+		models.Fast = models.Standard
+	}
+	return models
+}
+
+// valid returns every model a request may select
+func (m synthesisModels) valid() []string {
+	valid := []string{m.Standard}
+	for _, model := range append([]string{m.Fast}, m.Others...) {
+		if model != "" && !slices.Contains(valid, model) {
+			valid = append(valid, model)
+		}
+	}
+	return valid
+}
+
+// newChatClient creates the client for the provider the synthesize route names. The
+// openai provider keeps the embedding-capable OpenAI client and its connection check;
+// other providers get a chat-only client.
+func newChatClient(cfg *config.Config, logger *zap.Logger, timeoutConfig resilience.TimeoutConfig) (*internalopenai.Client, error) {
+	_, provider, err := cfg.ChatRoute(config.LLMServiceSynthesize)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider.Type == llm.ProviderOpenAI {
+		return internalopenai.NewClientWithEndpoint(provider.APIKey, provider.Endpoint, logger, timeoutConfig)
+	}
+
+	model, err := llm.NewChatModel(llm.ProviderConfig{
+		Provider:    provider.Type,
+		APIKey:      provider.APIKey,
+		Endpoint:    provider.Endpoint,
+		APIVersion:  provider.APIVersion,
+		Deployments: provider.Deployments,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s chat model: %w", provider.Type, err)
+	}
+	return internalopenai.NewChatClient(model, logger, timeoutConfig), nil
+}
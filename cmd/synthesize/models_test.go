@@ -0,0 +1,148 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/llm"
+	"github.com/your-org/ai-sa-assistant/internal/llm/llmtest"
+	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+	"go.uber.org/zap"
+)
+
+func TestRoutedModels(t *testing.T) {
+	cfg := createTestConfig()
+	models := routedModels(cfg)
+	assert.Equal(t, synthesisModels{Standard: "gpt-4o", Fast: config.DefaultLLMFastModel}, models)
+
+	cfg.Synthesis.Model = "claude-sonnet-4"
+	cfg.LLM = config.LLMConfig{
+		Providers: map[string]config.LLMProviderConfig{"anthropic": {APIKey: llmtest.APIKey}},
+		Routes:    map[string]config.LLMRouteConfig{config.LLMServiceSynthesize: {Provider: "anthropic"}},
+	}
+	models = routedModels(cfg)
+	assert.Equal(t, "claude-sonnet-4", models.Fast, "other providers fall back to the synthesis model")
+
+	cfg.LLM.Routes[config.LLMServiceSynthesize] = config.LLMRouteConfig{
+		Provider: "anthropic", FastModel: "claude-haiku-4", Models: []string{"claude-opus-4", "claude-haiku-4"},
+	}
+	models = routedModels(cfg)
+	assert.Equal(t, []string{"claude-sonnet-4", "claude-haiku-4", "claude-opus-4"}, models.valid())
+	assert.Equal(t, "claude-haiku-4", getParameterPresets(cfg)["concise"].Model)
+	assert.Equal(t, "claude-sonnet-4", getParameterPresets(cfg)["detailed"].Model)
+	assert.Error(t, validateGenerationParams(GenerationParams{Temperature: 0.3, MaxTokens: 1000, Model: "gpt-4o"}, cfg))
+
+	cfg.Synthesis.Model = ""
+	cfg.LLM.Providers["anthropic"] = config.LLMProviderConfig{
+		APIKey: llmtest.APIKey, Model: "claude-sonnet-4", FastModel: "claude-haiku-4",
+	}
+	cfg.LLM.Routes[config.LLMServiceSynthesize] = config.LLMRouteConfig{Provider: "anthropic"}
+	models = routedModels(cfg)
+	assert.Equal(t, synthesisModels{Standard: "claude-sonnet-4", Fast: "claude-haiku-4"}, models,
+		"unset models come from the routed provider rather than OpenAI defaults")
+}
+
+func TestSynthesisHandlerUsesRoutedProvider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	server := llmtest.NewServer()
+	defer server.Close()
+	server.SetReply("Rehost the VMs with AWS MGN [aws-mgn].")
+
+	cfg := createTestConfig()
+	cfg.Synthesis.Model = "gpt-4o"
+	cfg.LLM = config.LLMConfig{
+		Providers: map[string]config.LLMProviderConfig{
+			"contoso": {
+				Type:        llm.ProviderAzure,
+				Endpoint:    server.URL(llmtest.PathAzure),
+				APIKey:      llmtest.APIKey,
+				APIVersion:  llmtest.AzureAPIVersion,
+				Deployments: map[string]string{"gpt-4o": "contoso-gpt4o"},
+			},
+		},
+		Routes: map[string]config.LLMRouteConfig{config.LLMServiceSynthesize: {Provider: "contoso"}},
+	}
+
+	client, err := newChatClient(cfg, logger, resilience.DefaultTimeoutConfig())
+	require.NoError(t, err)
+	assert.Equal(t, llm.ProviderAzure, client.ChatProvider())
+
+	handler := createSynthesisHandler(cfg, logger, client, synthesis.NewMetricsCollector(logger, nil), nil, nil)
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  "How do we rehost 40 VMs on AWS?",
+		Chunks: []ChunkItem{{Text: "AWS MGN replicates servers.", DocID: "aws-mgn", SourceID: "aws-mgn"}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "AWS MGN")
+
+	requests := server.Requests()
+	require.NotEmpty(t, requests)
+	assert.Equal(t, llmtest.PathAzure, requests[0].Provider)
+	assert.Equal(t, "contoso-gpt4o", requests[0].Model)
+}
+
+func TestNewChatClientUsesOpenAIEndpoint(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/embeddings") {
+			_, _ = w.Write([]byte(createMockEmbeddingResponse()))
+			return
+		}
+		_, _ = w.Write([]byte(createMockChatResponseWithContent("Use AWS MGN.")))
+	}))
+	defer server.Close()
+
+	cfg := createTestConfig()
+	cfg.OpenAI.Endpoint = server.URL + "/gateway/v1"
+
+	client, err := newChatClient(cfg, zap.NewNop(), resilience.DefaultTimeoutConfig())
+	require.NoError(t, err)
+	assert.Equal(t, llm.ProviderOpenAI, client.ChatProvider())
+
+	_, err = client.CreateChatCompletion(context.Background(), internalopenai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "How do we rehost?"}},
+		Model:    "gpt-4o",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/gateway/v1/embeddings", "/gateway/v1/chat/completions"}, paths)
+}
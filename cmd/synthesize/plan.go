@@ -0,0 +1,575 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"github.com/your-org/ai-sa-assistant/internal/acl"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+	"go.uber.org/zap"
+)
+
+// SynthesisModePlan generates a long-form plan in stages: an outline, then each of its
+// sections with targeted retrieval, then assembly into one document
+const SynthesisModePlan = "plan"
+
+// Plan defaults used when the plan settings are not configured
+const (
+	DefaultPlanMaxSections         = 8
+	DefaultPlanMaxParallelSections = 3
+	DefaultPlanSectionMaxTokens    = 2000
+	DefaultPlanSectionChunks       = 5
+	// PlanRetrievalTimeout bounds each per-section search of the retrieve service
+	PlanRetrievalTimeout = 60 * time.Second
+)
+
+// finishReasonLength is the finish reason of a completion cut off at the token limit
+const finishReasonLength = "length"
+
+// planReport describes how a plan was generated
+type planReport struct {
+	Title string `json:"title"`
+	// OutlineFallback is set when the generated outline was unusable and the default was used
+	OutlineFallback bool                `json:"outline_fallback"`
+	Sections        []planSectionReport `json:"sections"`
+}
+
+// planSectionReport describes how one plan section was generated
+type planSectionReport struct {
+	Kind            string `json:"kind"`
+	Title           string `json:"title"`
+	RetrievedChunks int    `json:"retrieved_chunks"`
+	Continuations   int    `json:"continuations"`
+	Truncated       bool   `json:"truncated"`
+	// Model is the model that wrote the section
+	Model string `json:"model,omitempty"`
+}
+
+// planResult is an assembled plan with the chunks its sections were written from
+type planResult struct {
+	response *internalopenai.ChatCompletionResponse
+	chunks   []ChunkItem
+	report   planReport
+	// costEstimate is the priced workload the costs sections were written from
+	costEstimate *pricing.Estimate
+	// injectionDetections lists the retrieved chunks suspected of prompt injection
+	injectionDetections []synth.InjectionDetection
+	// model is the model that generated the outline, which the sections continue from
+	model modelChoice
+}
+
+// planSettings returns the plan settings with defaults for unset values
+func planSettings(cfg *config.Config) config.SynthesisPlanConfig {
+	settings := cfg.Synthesis.Plan
+	if settings.MaxSections == 0 {
+		settings.MaxSections = DefaultPlanMaxSections
+	}
+	if settings.MaxParallelSections == 0 {
+		settings.MaxParallelSections = DefaultPlanMaxParallelSections
+	}
+	if settings.SectionMaxTokens == 0 {
+		settings.SectionMaxTokens = DefaultPlanSectionMaxTokens
+	}
+	if settings.SectionChunks == 0 {
+		settings.SectionChunks = DefaultPlanSectionChunks
+	}
+	return settings
+}
+
+// handlePlanRequest generates, verifies and returns a plan for a /synthesize request in plan mode
+func handlePlanRequest(
+	c *gin.Context,
+	req SynthesisRequest,
+	startTime time.Time,
+	cfg *config.Config,
+	logger *zap.Logger,
+	openaiClient *internalopenai.Client,
+	priceCatalog *pricing.Catalog,
+	metricsCollector *synthesis.MetricsCollector,
+) {
+	result, err := processPlanRequest(req, acl.FromHeaders(c.Request.Header), cfg, logger, openaiClient, priceCatalog)
+	if err != nil {
+		handleSynthesisError(c, err, logger, "plan synthesis")
+		return
+	}
+
+	// Sources retrieved for the sections may be cited, so they are checked like request chunks
+	planReq := req
+	planReq.Chunks = result.chunks
+	planReq.costEstimate = result.costEstimate
+	planReq.injectionDetections = mergeInjectionDetections(req.injectionDetections, result.injectionDetections)
+	planReq.modelChoice = result.model
+
+	processingTime := time.Since(startTime)
+	logSynthesisCompletion(planReq, result.response, processingTime, logger)
+
+	// A plan is too long to regenerate, so low groundedness is annotated or blocked
+	grounding := verifyAnswerGrounding(result.response, req.Query, planReq.Chunks, req.WebResults, cfg, openaiClient, logger)
+
+	synthesisResponse := buildSynthesisResponse(result.response, &planReq, req.Query, detectQueryDomain(req.Query), cfg,
+		processingTime, grounding, metricsCollector, openaiClient, logger)
+	synthesisResponse["plan"] = result.report
+
+	c.JSON(http.StatusOK, synthesisResponse)
+}
+
+// processPlanRequest generates the outline, writes its sections concurrently with their
+// own retrieved context and assembles them into a single document
+func processPlanRequest(
+	req SynthesisRequest,
+	identity acl.Identity,
+	cfg *config.Config,
+	logger *zap.Logger,
+	openaiClient *internalopenai.Client,
+	priceCatalog *pricing.Catalog,
+) (*planResult, error) {
+	settings := planSettings(cfg)
+	contextItems := convertChunksToContextItems(req.Chunks)
+	webResultStrings, _ := convertWebResults(req.WebResults)
+
+	// Plans go to the complex model; sections continue from the model the outline fell back to
+	route := routeModel(req, cfg, logger)
+	outline, outlineResponse, choice, err := generatePlanOutline(req.Query, req.promptTemplate, contextItems,
+		webResultStrings, route, settings, cfg, logger, openaiClient)
+	if err != nil {
+		return nil, err
+	}
+	sectionRoute := route.from(choice)
+	report := planReport{Title: outline.Title, OutlineFallback: outlineResponse == nil}
+	usage := openai.Usage{}
+	if outlineResponse != nil {
+		usage = outlineResponse.Usage
+	}
+
+	// Costs sections are written from figures priced for the services the outline plans
+	costEstimate := estimateCosts(priceCatalog, req.Query, planOutlineText(outline), cfg, logger)
+
+	logger.Info("Generating plan sections",
+		zap.String("title", outline.Title),
+		zap.Int("sections", len(outline.Sections)),
+		zap.Bool("outline_fallback", report.OutlineFallback),
+		zap.String("model", sectionRoute.Model))
+
+	sections := make([]synth.PlanSectionResult, len(outline.Sections))
+	sectionReports := make([]planSectionReport, len(outline.Sections))
+	sectionChunks := make([][]ChunkItem, len(outline.Sections))
+	sectionDetections := make([][]synth.InjectionDetection, len(outline.Sections))
+	sectionUsage := make([]openai.Usage, len(outline.Sections))
+	sectionErrs := make([]error, len(outline.Sections))
+
+	semaphore := make(chan struct{}, settings.MaxParallelSections)
+	var wg sync.WaitGroup
+	for i := range outline.Sections {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			section := outline.Sections[index]
+			retrieved := retrievePlanSectionChunks(section, identity, settings, cfg, logger)
+			retrieved, _, sectionDetections[index] = screenUntrustedContent(retrieved, nil, cfg, openaiClient, logger)
+			chunks := mergeChunks(req.Chunks, retrieved)
+			sectionChunks[index] = chunks
+			sectionReports[index] = planSectionReport{Kind: section.Kind, Title: section.Title, RetrievedChunks: len(retrieved)}
+
+			messages, err := buildPlanSectionMessages(req.Query, req.promptTemplate, outline, index,
+				convertChunksToContextItems(chunks), webResultStrings)
+			if err != nil {
+				sectionErrs[index] = fmt.Errorf("failed to build plan section %q prompt: %w", section.Title, err)
+				return
+			}
+			if section.Kind == synth.PlanSectionCosts && costEstimate != nil {
+				messages.SystemMessage += "\n\n" + costEstimate.Context()
+			}
+			response, sectionChoice, continuations, err := generatePlanSection(messages, section, chunks, sectionRoute,
+				settings, cfg, logger, openaiClient)
+			if err != nil {
+				sectionErrs[index] = fmt.Errorf("failed to generate plan section %q: %w", section.Title, err)
+				return
+			}
+
+			sections[index] = synth.PlanSectionResult{
+				Section:       section,
+				Content:       response.Content,
+				Continuations: continuations,
+				Truncated:     response.FinishReason == finishReasonLength,
+			}
+			sectionReports[index].Continuations = continuations
+			sectionReports[index].Truncated = sections[index].Truncated
+			sectionReports[index].Model = sectionChoice.Model
+			sectionUsage[index] = response.Usage
+		}(i)
+	}
+	wg.Wait()
+
+	var chunks []ChunkItem
+	var detections []synth.InjectionDetection
+	for i := range outline.Sections {
+		if sectionErrs[i] != nil {
+			return nil, sectionErrs[i]
+		}
+		chunks = mergeChunks(chunks, sectionChunks[i])
+		detections = mergeInjectionDetections(detections, sectionDetections[i])
+		addUsage(&usage, sectionUsage[i])
+		if sections[i].Truncated {
+			logger.Warn("Plan section still truncated after continuations",
+				zap.String("section", sections[i].Section.Title),
+				zap.Int("continuations", sections[i].Continuations))
+		}
+	}
+	chunks = mergeChunks(req.Chunks, chunks)
+	report.Sections = sectionReports
+
+	document := synth.AssemblePlan(req.Query, outline, sections, availableSources(chunks, req.WebResults))
+	return &planResult{
+		response: &internalopenai.ChatCompletionResponse{
+			Content:      document,
+			FinishReason: string(openai.FinishReasonStop),
+			Usage:        usage,
+		},
+		chunks:              chunks,
+		report:              report,
+		costEstimate:        costEstimate,
+		injectionDetections: detections,
+		model:               choice,
+	}, nil
+}
+
+// planOutlineText returns the diagram and section focuses of an outline, which name the
+// services the plan uses
+func planOutlineText(outline synth.PlanOutline) string {
+	var text strings.Builder
+	text.WriteString(outline.Summary + "\n" + outline.Diagram + "\n")
+	for _, section := range outline.Sections {
+		text.WriteString(section.Title + ": " + section.Focus + "\n")
+	}
+	return text.String()
+}
+
+// generatePlanOutline asks the model for an outline through a forced function call. The
+// default outline is returned with a nil response when the model's outline is invalid.
+func generatePlanOutline(
+	query string,
+	promptTemplate *synth.PromptTemplate,
+	contextItems []synth.ContextItem,
+	webResults []string,
+	route modelRoute,
+	settings config.SynthesisPlanConfig,
+	cfg *config.Config,
+	logger *zap.Logger,
+	openaiClient *internalopenai.Client,
+) (synth.PlanOutline, *internalopenai.ChatCompletionResponse, modelChoice, error) {
+	if openaiClient == nil {
+		logger.Info("Using default plan outline for test mode")
+		return synth.DefaultPlanOutline(query), nil, route.choice(), nil
+	}
+
+	messages := synth.BuildPlanOutlineMessages(query, contextItems, webResults, synth.DefaultPromptConfig())
+	if promptTemplate != nil {
+		var err error
+		messages, err = synth.BuildPlanOutlineMessagesFromTemplate(promptTemplate, query, contextItems, webResults,
+			templatePromptConfig(query))
+		if err != nil {
+			return synth.PlanOutline{}, nil, route.choice(), fmt.Errorf("failed to render prompt template: %w", err)
+		}
+		logger.Info("Using prompt template for the plan outline",
+			zap.String("template_id", messages.TemplateID),
+			zap.Int("template_version", messages.TemplateVersion))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), planCompletionTimeout(cfg))
+	defer cancel()
+
+	response, choice, err := completeWithFallback(ctx, route, planRetryConfig(cfg), logger,
+		func(ctx context.Context, model string, retryConfig resilience.BackoffConfig) (*internalopenai.ChatCompletionResponse, error) {
+			return openaiClient.CreateChatCompletionWithRetry(ctx, internalopenai.ChatCompletionRequest{
+				Model:       model,
+				MaxTokens:   settings.SectionMaxTokens,
+				Temperature: float32(cfg.Synthesis.Temperature),
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleSystem, Content: messages.SystemMessage},
+					{Role: openai.ChatMessageRoleUser, Content: messages.UserMessage},
+				},
+				Function: &openai.FunctionDefinition{
+					Name:        synth.PlanOutlineFunction,
+					Description: "Submit the outline of the plan: title, summary, architecture diagram and ordered sections",
+					Parameters:  synth.PlanOutlineSchema,
+				},
+			}, retryConfig)
+		})
+	if err != nil {
+		return synth.PlanOutline{}, nil, choice, fmt.Errorf("failed to generate plan outline: %w", err)
+	}
+
+	outline, err := synth.ParsePlanOutline(response.FunctionArguments, settings.MaxSections)
+	if err != nil {
+		logger.Warn("Plan outline was invalid, using the default outline",
+			zap.Error(err),
+			zap.String("finish_reason", response.FinishReason))
+		return synth.DefaultPlanOutline(query), nil, choice, nil
+	}
+	return outline, response, choice, nil
+}
+
+// buildPlanSectionMessages builds the prompt of one outline section from the request's
+// prompt template, or the built-in prompt when no template was selected
+func buildPlanSectionMessages(
+	query string,
+	promptTemplate *synth.PromptTemplate,
+	outline synth.PlanOutline,
+	index int,
+	contextItems []synth.ContextItem,
+	webResults []string,
+) (synth.PromptMessages, error) {
+	if promptTemplate == nil {
+		return synth.BuildPlanSectionMessages(query, outline, index, contextItems, webResults,
+			synth.DefaultPromptConfig()), nil
+	}
+	messages, err := synth.BuildPlanSectionMessagesFromTemplate(promptTemplate, query, outline, index,
+		contextItems, webResults, templatePromptConfig(query))
+	if err != nil {
+		return synth.PromptMessages{}, fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return messages, nil
+}
+
+// generatePlanSection writes one section, continuing it when it is cut off at the token limit
+func generatePlanSection(
+	messages synth.PromptMessages,
+	section synth.PlanOutlineSection,
+	chunks []ChunkItem,
+	route modelRoute,
+	settings config.SynthesisPlanConfig,
+	cfg *config.Config,
+	logger *zap.Logger,
+	openaiClient *internalopenai.Client,
+) (*internalopenai.ChatCompletionResponse, modelChoice, int, error) {
+	if openaiClient == nil {
+		content := fmt.Sprintf("Mock %s section: %s.", section.Kind, section.Focus)
+		if len(chunks) > 0 {
+			content += " [" + availableSources(chunks[:1], nil)[0] + "]"
+		}
+		return &internalopenai.ChatCompletionResponse{Content: content, FinishReason: string(openai.FinishReasonStop)},
+			route.choice(), 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), planCompletionTimeout(cfg))
+	defer cancel()
+
+	// The first completion picks the model; continuations stay on it so one model writes
+	// the whole section
+	continuations := 0
+	response, choice, err := completeWithFallback(ctx, route, planRetryConfig(cfg), logger,
+		func(ctx context.Context, model string, retryConfig resilience.BackoffConfig) (*internalopenai.ChatCompletionResponse, error) {
+			response, count, err := completeWithContinuation(ctx, openaiClient, internalopenai.ChatCompletionRequest{
+				Model:       model,
+				MaxTokens:   settings.SectionMaxTokens,
+				Temperature: float32(cfg.Synthesis.Temperature),
+				Messages: []openai.ChatCompletionMessage{
+					{Role: openai.ChatMessageRoleSystem, Content: messages.SystemMessage},
+					{Role: openai.ChatMessageRoleUser, Content: messages.UserMessage},
+				},
+			}, retryConfig, settings.MaxContinuations)
+			continuations = count
+			return response, err
+		})
+	return response, choice, continuations, err
+}
+
+// completeWithContinuation runs a completion and, while it stops at the token limit,
+// asks the model up to maxContinuations times to continue where it stopped. The returned
+// response holds the joined text, the summed usage and the last finish reason.
+func completeWithContinuation(
+	ctx context.Context,
+	openaiClient *internalopenai.Client,
+	req internalopenai.ChatCompletionRequest,
+	retryConfig resilience.BackoffConfig,
+	maxContinuations int,
+) (*internalopenai.ChatCompletionResponse, int, error) {
+	response, err := openaiClient.CreateChatCompletionWithRetry(ctx, req, retryConfig)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	continuations := 0
+	for response.FinishReason == finishReasonLength && continuations < maxContinuations {
+		continuationReq := req
+		continuationReq.Messages = append(append([]openai.ChatCompletionMessage{}, req.Messages...),
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: response.Content},
+			openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: synth.PlanContinuationPrompt},
+		)
+
+		continuation, err := openaiClient.CreateChatCompletionWithRetry(ctx, continuationReq, retryConfig)
+		if err != nil {
+			return nil, continuations, fmt.Errorf("failed to continue truncated completion: %w", err)
+		}
+		continuations++
+
+		response.Content = synth.MergeContinuation(response.Content, continuation.Content)
+		response.FinishReason = continuation.FinishReason
+		addUsage(&response.Usage, continuation.Usage)
+	}
+	return response, continuations, nil
+}
+
+// retrievePlanSectionChunks searches the retrieve service with the section's retrieval
+// query on behalf of the caller. Failures are logged and leave the section with the
+// request's chunks only.
+func retrievePlanSectionChunks(
+	section synth.PlanOutlineSection,
+	identity acl.Identity,
+	settings config.SynthesisPlanConfig,
+	cfg *config.Config,
+	logger *zap.Logger,
+) []ChunkItem {
+	if !settings.SectionRetrieval || cfg.Services.RetrieveURL == "" || section.RetrievalQuery == "" {
+		return nil
+	}
+
+	chunks, err := searchRetrieveService(cfg.Services.RetrieveURL, section.RetrievalQuery, nil, identity)
+	if err != nil {
+		logger.Warn("Plan section retrieval failed, using the request context only",
+			zap.String("section", section.Title),
+			zap.Error(err))
+		return nil
+	}
+	if len(chunks) > settings.SectionChunks {
+		chunks = chunks[:settings.SectionChunks]
+	}
+	return chunks
+}
+
+// searchRetrieveService runs a search on the retrieve service, narrowed by the metadata
+// filters when they are not nil, and returns its chunks. The retrieve service drops the
+// filters when it falls back to a broader search, so chunks whose metadata does not
+// match them are dropped here.
+func searchRetrieveService(retrieveURL, query string, filters map[string]interface{}, identity acl.Identity) ([]ChunkItem, error) {
+	searchRequest := map[string]interface{}{"query": query}
+	if filters != nil {
+		searchRequest["filters"] = filters
+	}
+	body, err := json.Marshal(searchRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal search request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PlanRetrievalTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, retrieveURL+"/search", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create search request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	identity.ApplyHeaders(req.Header)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("retrieve service returned status %d", resp.StatusCode)
+	}
+
+	var searchResponse struct {
+		Chunks []struct {
+			ChunkItem
+			Metadata map[string]interface{} `json:"metadata"`
+		} `json:"chunks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&searchResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode search response: %w", err)
+	}
+
+	chunks := make([]ChunkItem, 0, len(searchResponse.Chunks))
+	for _, chunk := range searchResponse.Chunks {
+		if metadataMatchesFilters(chunk.Metadata, filters) {
+			chunks = append(chunks, chunk.ChunkItem)
+		}
+	}
+	return chunks, nil
+}
+
+// metadataMatchesFilters reports whether a chunk's metadata has every filter value
+func metadataMatchesFilters(metadata, filters map[string]interface{}) bool {
+	for key, want := range filters {
+		got, ok := metadata[key]
+		if !ok || !strings.EqualFold(fmt.Sprint(got), fmt.Sprint(want)) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeChunks appends the extra chunks that are not already in base
+func mergeChunks(base, extra []ChunkItem) []ChunkItem {
+	merged := append([]ChunkItem{}, base...)
+	seen := make(map[ChunkItem]bool, len(base)+len(extra))
+	for _, chunk := range base {
+		seen[chunk] = true
+	}
+	for _, chunk := range extra {
+		if !seen[chunk] {
+			seen[chunk] = true
+			merged = append(merged, chunk)
+		}
+	}
+	return merged
+}
+
+// addUsage adds the token usage of another completion to total
+func addUsage(total *openai.Usage, usage openai.Usage) {
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+}
+
+// planCompletionTimeout bounds each completion of a plan, which is written in several
+// long completions
+func planCompletionTimeout(cfg *config.Config) time.Duration {
+	if cfg.Synthesis.ComplexTimeoutSeconds > 0 {
+		return time.Duration(cfg.Synthesis.ComplexTimeoutSeconds) * time.Second
+	}
+	return getConfiguredTimeout(cfg)
+}
+
+// planRetryConfig returns the rate limit aware retry settings used for plan completions
+func planRetryConfig(cfg *config.Config) resilience.BackoffConfig {
+	return createRateLimitAwareRetryConfig(resilience.BackoffConfig{
+		BaseDelay:   time.Second,
+		MaxRetries:  cfg.Synthesis.MaxRetries,
+		MaxDelay:    30 * time.Second,
+		Multiplier:  cfg.Synthesis.BackoffMultiplier,
+		Jitter:      true,
+		RetryOnFunc: resilience.DefaultRetryOnFunc,
+	})
+}
@@ -0,0 +1,305 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/your-org/ai-sa-assistant/internal/acl"
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+	"go.uber.org/zap"
+)
+
+const mockPlanOutline = `{
+  "title": "Migration of 40 VMs to AWS",
+  "summary": "Rehost the estate in two waves.",
+  "diagram": "graph TD\n  A[Data Center] --> B[AWS MGN]\n  B --> C[EC2]",
+  "sections": [
+    {"kind": "phases", "title": "Phases", "focus": "Assess and migrate", "retrieval_query": "migration phases"},
+    {"kind": "workstreams", "title": "Workstreams", "focus": "Network and apps", "retrieval_query": "migration workstreams"},
+    {"kind": "risks", "title": "Risks", "focus": "Downtime", "retrieval_query": "migration risks"},
+    {"kind": "timeline", "title": "Timeline", "focus": "Eight weeks", "retrieval_query": "migration timeline"},
+    {"kind": "costs", "title": "Costs", "focus": "Monthly EC2 costs", "retrieval_query": "EC2 pricing"}
+  ]
+}`
+
+// createMockChatResponseWithFinishReason creates a chat completion with the given finish reason
+func createMockChatResponseWithFinishReason(content, finishReason string) string {
+	return strings.Replace(createMockChatResponseWithContent(content),
+		`"finish_reason": "stop"`, `"finish_reason": "`+finishReason+`"`, 1)
+}
+
+func TestSynthesisHandlerPlanMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	var mu sync.Mutex
+	var retrieveQueries []string
+	var retrieveUsers []string
+	retrieveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		retrieveQueries = append(retrieveQueries, body["query"])
+		retrieveUsers = append(retrieveUsers, r.Header.Get(acl.HeaderUserID))
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if body["query"] == "EC2 pricing" {
+			_, _ = w.Write([]byte(`{"chunks": [{"text": "EC2 m5.large costs $70 per month", "doc_id": "pricing", "source_id": "aws-ec2-pricing"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"chunks": []}`))
+	}))
+	defer retrieveServer.Close()
+
+	continuations := 0
+	var costsSystemMessage string
+	openaiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Tools    []interface{} `json:"tools"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		userMessage := body.Messages[len(body.Messages)-1].Content
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case len(body.Tools) > 0:
+			_, _ = w.Write([]byte(strings.Replace(createMockFunctionCallResponse(mockPlanOutline),
+				synth.StructuredAnswerFunction, synth.PlanOutlineFunction, 1)))
+		case userMessage == synth.PlanContinuationPrompt:
+			mu.Lock()
+			continuations++
+			mu.Unlock()
+			_, _ = w.Write([]byte(createMockChatResponseWithContent("costs $2,800 per month in total [aws-ec2-pricing].")))
+		case strings.Contains(userMessage, `Write section 5, "Costs"`):
+			mu.Lock()
+			costsSystemMessage = body.Messages[0].Content
+			mu.Unlock()
+			_, _ = w.Write([]byte(createMockChatResponseWithFinishReason("Running 40 m5.large instances ", "length")))
+		default:
+			_, _ = w.Write([]byte(createMockChatResponseWithContent("## Section\n\nSection guidance [migration-guide].\n\n```mermaid\ngraph TD\n  X --> Y\n```")))
+		}
+	}))
+	defer openaiServer.Close()
+
+	cfg := createTestConfig()
+	cfg.Services.RetrieveURL = retrieveServer.URL
+	cfg.Synthesis.Plan.SectionRetrieval = true
+	cfg.Synthesis.Plan.MaxContinuations = 2
+	cfg.Synthesis.CostEstimation.Enabled = true
+	handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(openaiServer.URL, logger),
+		synthesis.NewMetricsCollector(logger, nil), nil, setupPriceCatalog(cfg, logger))
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  "Plan the migration of 40 VMs to AWS",
+		Chunks: []ChunkItem{{Text: "Migrate in waves", DocID: "guide", SourceID: "migration-guide"}},
+		Mode:   SynthesisModePlan,
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.Header.Set(acl.HeaderUserID, "alice")
+
+	handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, retrieveQueries, 5)
+	assert.Contains(t, retrieveQueries, "EC2 pricing")
+	for _, user := range retrieveUsers {
+		assert.Equal(t, "alice", user, "section retrieval should run on behalf of the caller")
+	}
+	assert.Equal(t, 1, continuations)
+
+	var response struct {
+		MainText    string   `json:"main_text"`
+		DiagramCode string   `json:"diagram_code"`
+		Sources     []string `json:"sources"`
+		Plan        struct {
+			Title    string `json:"title"`
+			Sections []struct {
+				Title           string `json:"title"`
+				RetrievedChunks int    `json:"retrieved_chunks"`
+				Continuations   int    `json:"continuations"`
+				Truncated       bool   `json:"truncated"`
+			} `json:"sections"`
+		} `json:"plan"`
+		CostEstimate *pricing.Estimate `json:"cost_estimate"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	require.NotNil(t, response.CostEstimate)
+	assert.Equal(t, "aws", response.CostEstimate.Provider)
+	assert.Equal(t, float64(40*pricing.HoursPerMonth), response.CostEstimate.Lines[0].Quantity)
+	assert.Contains(t, costsSystemMessage, "These figures are authoritative")
+
+	assert.Equal(t, "Migration of 40 VMs to AWS", response.Plan.Title)
+	require.Len(t, response.Plan.Sections, 5)
+	costs := response.Plan.Sections[4]
+	assert.Equal(t, "Costs", costs.Title)
+	assert.Equal(t, 1, costs.RetrievedChunks)
+	assert.Equal(t, 1, costs.Continuations)
+	assert.False(t, costs.Truncated)
+
+	assert.Contains(t, response.MainText, "Running 40 m5.large instances costs $2,800 per month in total")
+	assert.Contains(t, response.DiagramCode, "A[Data Center] --> B[AWS MGN]")
+	assert.NotContains(t, response.DiagramCode, "X --> Y")
+	assert.ElementsMatch(t, []string{"migration-guide", "aws-ec2-pricing"}, response.Sources)
+}
+
+func TestSynthesisHandlerPlanModeUsesPromptTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "concise-architect.v2.yaml"), []byte(conciseExperimentTemplate), 0o600))
+	cfg := createTestConfig()
+	cfg.Synthesis.Plan.SectionRetrieval = false
+	cfg.Synthesis.PromptTemplates.Enabled = true
+	cfg.Synthesis.PromptTemplates.Directory = dir
+	registry := setupPromptRegistry(cfg, logger)
+	require.NotNil(t, registry)
+
+	var mu sync.Mutex
+	var outlineSystem string
+	var sectionSystems []string
+	openaiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Tools    []interface{} `json:"tools"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if len(body.Tools) > 0 {
+			outlineSystem = body.Messages[0].Content
+			_, _ = w.Write([]byte(strings.Replace(createMockFunctionCallResponse(mockPlanOutline),
+				synth.StructuredAnswerFunction, synth.PlanOutlineFunction, 1)))
+			return
+		}
+		sectionSystems = append(sectionSystems, body.Messages[0].Content)
+		_, _ = w.Write([]byte(createMockChatResponseWithContent("Section guidance [migration-guide].")))
+	}))
+	defer openaiServer.Close()
+
+	handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(openaiServer.URL, logger),
+		synthesis.NewMetricsCollector(logger, nil), registry, nil)
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:            "Plan the migration of 40 VMs to AWS",
+		Chunks:           []ChunkItem{{Text: "Migrate in waves", DocID: "guide", SourceID: "migration-guide"}},
+		Mode:             SynthesisModePlan,
+		PromptExperiment: "concise",
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, outlineSystem, "concise Cloud Solutions Architect")
+	assert.Contains(t, outlineSystem, synth.PlanOutlineFunction)
+	require.Len(t, sectionSystems, 5)
+	for _, system := range sectionSystems {
+		assert.Contains(t, system, "concise Cloud Solutions Architect")
+		assert.Contains(t, system, "Write only the requested section")
+	}
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	stats, ok := response["processing_stats"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "concise-architect", stats["prompt_template_id"])
+	assert.Equal(t, float64(2), stats["prompt_template_version"])
+}
+
+func TestSynthesisHandlerPlanModeTestMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	handler := createSynthesisHandler(createTestConfig(), logger, nil, synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  "Plan the migration of 40 VMs to AWS",
+		Chunks: []ChunkItem{{Text: "Migrate in waves", DocID: "guide", SourceID: "migration-guide"}},
+		Mode:   SynthesisModePlan,
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	plan, ok := response["plan"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, true, plan["outline_fallback"])
+	assert.Len(t, plan["sections"], len(synth.RequiredPlanSections))
+}
+
+func TestValidateSynthesisRequestMode(t *testing.T) {
+	req := SynthesisRequest{
+		Query:  "Plan the migration",
+		Chunks: []ChunkItem{{Text: "Migrate in waves", DocID: "guide"}},
+	}
+	assert.NoError(t, validateSynthesisRequest(req))
+
+	req.Mode = SynthesisModePlan
+	assert.NoError(t, validateSynthesisRequest(req))
+
+	req.Mode = SynthesisModeScaffold
+	assert.NoError(t, validateSynthesisRequest(req))
+
+	req.Mode = SynthesisModeCompare
+	assert.NoError(t, validateSynthesisRequest(req))
+
+	req.Mode = "essay"
+	assert.ErrorContains(t, validateSynthesisRequest(req), "unsupported mode")
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"go.uber.org/zap"
+)
+
+// setupPromptRegistry loads the configured prompt templates and, with hot reload enabled,
+// watches them for changes. It returns nil when templates are disabled or cannot be
+// loaded, in which case the built-in prompt is used.
+func setupPromptRegistry(cfg *config.Config, logger *zap.Logger) *synth.PromptRegistry {
+	templateConfig := cfg.Synthesis.PromptTemplates
+	if !templateConfig.Enabled {
+		return nil
+	}
+
+	registry, err := synth.NewPromptRegistry(templateConfig.Directory)
+	if err != nil {
+		logger.Error("Failed to load prompt templates, using the built-in prompt",
+			zap.String("directory", templateConfig.Directory),
+			zap.Error(err))
+		return nil
+	}
+
+	for _, tmpl := range registry.Templates() {
+		logger.Info("Loaded prompt template",
+			zap.String("template_id", tmpl.ID),
+			zap.Int("template_version", tmpl.Version),
+			zap.String("experiment", tmpl.Experiment),
+			zap.String("path", tmpl.Path))
+	}
+
+	if templateConfig.HotReload {
+		err := registry.Watch(context.Background(), func(err error) {
+			if err != nil {
+				logger.Warn("Prompt template reload failed, keeping the previous templates", zap.Error(err))
+				return
+			}
+			logger.Info("Prompt templates reloaded", zap.Int("templates", len(registry.Templates())))
+		})
+		if err != nil {
+			logger.Warn("Prompt template hot reload disabled", zap.Error(err))
+		}
+	}
+
+	return registry
+}
+
+// selectPromptTemplate returns the template for the request's query type, preferring the
+// experiment named in the request over the configured one. It returns nil when the
+// built-in prompt should be used.
+func selectPromptTemplate(registry *synth.PromptRegistry, req SynthesisRequest, cfg *config.Config) *synth.PromptTemplate {
+	if registry == nil {
+		return nil
+	}
+
+	experiment := req.PromptExperiment
+	if experiment == "" && cfg != nil {
+		experiment = cfg.Synthesis.PromptTemplates.Experiment
+	}
+	return registry.Select(synth.DetectQueryType(req.Query), experiment)
+}
+
+// templatePromptConfig returns the prompt settings templates are rendered with: the
+// built-in limits and the query's type
+func templatePromptConfig(query string) synth.PromptConfig {
+	promptConfig := synth.DefaultPromptConfig()
+	promptConfig.QueryType = synth.DetectQueryType(query)
+	return promptConfig
+}
+
+// promptProcessingStats reports the model, token usage and prompt template of an answer.
+// The model is the one the request was routed or fell back to, or the synthesis model
+// when the answer was not generated through the router.
+func promptProcessingStats(
+	req *SynthesisRequest,
+	response *internalopenai.ChatCompletionResponse,
+	cfg *config.Config,
+) synth.ProcessingStats {
+	stats := synth.ProcessingStats{
+		InputTokens:  response.Usage.PromptTokens,
+		OutputTokens: response.Usage.CompletionTokens,
+		TotalTokens:  response.Usage.TotalTokens,
+		ModelUsed:    cfg.Synthesis.Model,
+		Temperature:  cfg.Synthesis.Temperature,
+	}
+	if req.modelChoice.Model != "" {
+		stats.ModelUsed = req.modelChoice.Model
+		stats.ModelRoutingReason = req.modelChoice.Reason
+		stats.ModelFallbacks = req.modelChoice.FallbackFrom
+	}
+	if req.promptTemplate != nil {
+		stats.PromptTemplateID = req.promptTemplate.ID
+		stats.PromptTemplateVersion = req.promptTemplate.Version
+	}
+	return stats
+}
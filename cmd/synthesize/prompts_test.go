@@ -0,0 +1,145 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+	"go.uber.org/zap"
+)
+
+// conciseExperimentTemplate is a prompt template taking part in the "concise" experiment
+const conciseExperimentTemplate = `id: concise-architect
+version: 2
+experiment: concise
+variables: [Query]
+system: |-
+  You are a concise Cloud Solutions Architect assistant.
+  MERMAID.JS DIAGRAM GENERATION INSTRUCTIONS: draw graph TD diagrams in ` + "```mermaid" + ` blocks.
+  CODE GENERATION INSTRUCTIONS: write terraform, AWS CLI, Azure CLI and PowerShell code with
+  meaningful comments. NEVER include hardcoded secrets.
+user: |-
+  User Query: {{ .Query }}
+  Cite sources with [source_id].
+`
+
+func TestSynthesisHandlerPromptTemplates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	dir := t.TempDir()
+	shipped, err := os.ReadFile("../../configs/prompts/solutions-architect.v1.yaml")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "solutions-architect.v1.yaml"), shipped, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "concise-architect.v2.yaml"), []byte(conciseExperimentTemplate), 0o600))
+
+	cfg := createTestConfig()
+	cfg.Synthesis.PromptTemplates.Enabled = true
+	cfg.Synthesis.PromptTemplates.Directory = dir
+	registry := setupPromptRegistry(cfg, logger)
+	require.NotNil(t, registry)
+
+	tests := []struct {
+		name          string
+		experiment    string
+		wantID        string
+		wantVersion   float64
+		wantSystemHas string
+	}{
+		{
+			name:          "default template",
+			wantID:        "solutions-architect",
+			wantVersion:   1,
+			wantSystemHas: "expert Cloud Solutions Architect",
+		},
+		{
+			name:          "experiment template",
+			experiment:    "concise",
+			wantID:        "concise-architect",
+			wantVersion:   2,
+			wantSystemHas: "concise Cloud Solutions Architect",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var systemMessage string
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Messages []struct {
+						Role    string `json:"role"`
+						Content string `json:"content"`
+					} `json:"messages"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				if len(body.Messages) > 0 && body.Messages[0].Role == "system" {
+					systemMessage = body.Messages[0].Content
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(createMockChatResponse()))
+			}))
+			defer mockServer.Close()
+
+			handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(mockServer.URL, logger),
+				synthesis.NewMetricsCollector(logger, nil), registry, nil)
+
+			reqBody, err := json.Marshal(SynthesisRequest{
+				Query:            "Deploy our services to EKS",
+				Chunks:           []ChunkItem{{Text: "EKS guidance", DocID: "doc1", SourceID: "source1"}},
+				PromptExperiment: tt.experiment,
+			})
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+			require.NoError(t, err)
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler(c)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, systemMessage, tt.wantSystemHas)
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			stats, ok := response["processing_stats"].(map[string]interface{})
+			require.True(t, ok)
+			assert.Equal(t, tt.wantID, stats["prompt_template_id"])
+			assert.Equal(t, tt.wantVersion, stats["prompt_template_version"])
+		})
+	}
+}
+
+func TestSetupPromptRegistry(t *testing.T) {
+	logger := zap.NewNop()
+
+	cfg := createTestConfig()
+	assert.Nil(t, setupPromptRegistry(cfg, logger), "disabled templates should use the built-in prompt")
+
+	cfg.Synthesis.PromptTemplates.Enabled = true
+	cfg.Synthesis.PromptTemplates.Directory = filepath.Join(t.TempDir(), "missing")
+	assert.Nil(t, setupPromptRegistry(cfg, logger), "unloadable templates should use the built-in prompt")
+}
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -120,3 +121,24 @@ func TestExtractQueryParameters(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractRegions(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"Set up DR from us-east-1 to us-west-2 with RTO of 4 hours", []string{"us-east-1", "us-west-2"}},
+		{"Replicate from East US 2 to Central US", []string{"eastus2", "centralus"}},
+		{"Fail over from westeurope to north europe and back to westeurope", []string{"westeurope", "northeurope"}},
+		{"Migrate 40 VMs to AWS", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			regions := extractQueryParameters(tt.query).Regions
+			if strings.Join(regions, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected regions %v, got %v", tt.expected, regions)
+			}
+		})
+	}
+}
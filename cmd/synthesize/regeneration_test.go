@@ -21,7 +21,7 @@ import (
 )
 
 func TestGetParameterPresets(t *testing.T) {
-	presets := getParameterPresets()
+	presets := getParameterPresets(nil)
 
 	// Test that all expected presets exist
 	expectedPresets := []string{"creative", "balanced", "focused", "detailed", "concise"}
@@ -130,7 +130,7 @@ func TestValidateGenerationParams(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateGenerationParams(tt.params)
+			err := validateGenerationParams(tt.params, nil)
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -202,7 +202,7 @@ func TestApplyParameterPreset(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			params := tt.params
-			applyParameterPreset(&params)
+			applyParameterPreset(&params, nil)
 			assert.Equal(t, tt.expected, params)
 		})
 	}
@@ -275,7 +275,7 @@ func TestValidateRegenerationRequest(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateRegenerationRequest(tt.req)
+			err := validateRegenerationRequest(tt.req, createTestConfig())
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
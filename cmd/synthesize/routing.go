@@ -0,0 +1,247 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
+	"go.uber.org/zap"
+)
+
+// Reasons recorded for the model that generated an answer
+const (
+	routingReasonConfigured  = "configured_model"
+	routingReasonSimple      = "simple_query"
+	routingReasonMedium      = "medium_query"
+	routingReasonComplex     = "complex_query"
+	routingReasonPlan        = "plan_generation"
+	routingReasonComparison  = "comparison_generation"
+	routingReasonRateLimited = "fallback_rate_limited"
+	routingReasonCircuitOpen = "fallback_circuit_open"
+)
+
+// errContentDelivered marks a failure after part of a streamed answer was relayed, which
+// another model cannot continue
+var errContentDelivered = errors.New("answer content was already delivered")
+
+// modelRoute is the model a request is sent to and the models tried after it
+type modelRoute struct {
+	Model     string
+	Reason    string
+	Fallbacks []string
+}
+
+// modelChoice is the model that generated an answer and why it was used
+type modelChoice struct {
+	Model  string
+	Reason string
+	// FallbackFrom lists the models tried before Model that were unavailable
+	FallbackFrom []string
+}
+
+// chatCompletionFunc runs a completion with the given model and retry configuration
+type chatCompletionFunc func(
+	ctx context.Context,
+	model string,
+	retryConfig resilience.BackoffConfig,
+) (*internalopenai.ChatCompletionResponse, error)
+
+// modelBreakers holds a circuit breaker per model, so one unavailable model does not
+// stop requests to its fallbacks
+var (
+	modelBreakers   = map[string]*resilience.CircuitBreaker{}
+	modelBreakersMu sync.Mutex
+)
+
+// routeModel chooses the synthesis model of a request. With routing enabled, plans,
+// comparisons and complex queries go to the complex model and simple queries to the
+// simple model; other queries use the synthesis model.
+func routeModel(req SynthesisRequest, cfg *config.Config, logger *zap.Logger) modelRoute {
+	settings := cfg.Synthesis.Routing
+	route := modelRoute{Model: cfg.Synthesis.Model, Reason: routingReasonConfigured, Fallbacks: settings.Fallbacks}
+	if !settings.Enabled {
+		return route
+	}
+
+	complexModel := settings.ComplexModel
+	if complexModel == "" {
+		complexModel = cfg.Synthesis.Model
+	}
+	simpleModel := settings.SimpleModel
+	if simpleModel == "" {
+		simpleModel = routedModels(cfg).Fast
+	}
+
+	switch req.Mode {
+	case SynthesisModePlan:
+		route.Model, route.Reason = complexModel, routingReasonPlan
+		return route
+	case SynthesisModeCompare:
+		route.Model, route.Reason = complexModel, routingReasonComparison
+		return route
+	}
+	switch calculateQueryComplexity(req, logger) {
+	case "simple":
+		route.Model, route.Reason = simpleModel, routingReasonSimple
+	case "complex":
+		route.Model, route.Reason = complexModel, routingReasonComplex
+	default:
+		route.Reason = routingReasonMedium
+	}
+	return route
+}
+
+// checkRoute returns the route of completions that check or repair an answer: the given
+// model, or the synthesis model when empty, followed by the configured fallbacks
+func checkRoute(model string, cfg *config.Config) modelRoute {
+	if model == "" {
+		model = cfg.Synthesis.Model
+	}
+	return modelRoute{Model: model, Reason: routingReasonConfigured, Fallbacks: cfg.Synthesis.Routing.Fallbacks}
+}
+
+// chain returns the routed model followed by its fallbacks, without repeats
+func (r modelRoute) chain() []string {
+	chain := []string{r.Model}
+	for _, model := range r.Fallbacks {
+		if model != "" && !slices.Contains(chain, model) {
+			chain = append(chain, model)
+		}
+	}
+	return chain
+}
+
+// from returns the route continued from the model a previous completion fell back to,
+// so later completions of the same answer skip the models that were unavailable
+func (r modelRoute) from(choice modelChoice) modelRoute {
+	chain := r.chain()
+	index := slices.Index(chain, choice.Model)
+	if index < 0 {
+		return r
+	}
+	return modelRoute{Model: choice.Model, Reason: choice.Reason, Fallbacks: chain[index+1:]}
+}
+
+// choice returns the choice of the routed model, used when no completion was needed
+func (r modelRoute) choice() modelChoice {
+	return modelChoice{Model: r.Model, Reason: r.Reason}
+}
+
+// completeWithFallback runs the completion with the routed model and, when the model is
+// rate limited or its circuit breaker is open, with each fallback in turn. Rate limits
+// are only retried on the last model of the chain; earlier models give way to the next.
+func completeWithFallback(
+	ctx context.Context,
+	route modelRoute,
+	retryConfig resilience.BackoffConfig,
+	logger *zap.Logger,
+	complete chatCompletionFunc,
+) (*internalopenai.ChatCompletionResponse, modelChoice, error) {
+	choice := route.choice()
+	chain := route.chain()
+	for i, model := range chain {
+		last := i == len(chain)-1
+		attemptConfig := retryConfig
+		if !last {
+			attemptConfig.RetryOnFunc = retryExceptRateLimits(retryConfig.RetryOnFunc)
+		}
+
+		var response *internalopenai.ChatCompletionResponse
+		err := modelCircuitBreaker(model, logger).Execute(ctx, func(ctx context.Context) error {
+			var err error
+			response, err = complete(ctx, model, attemptConfig)
+			return err
+		})
+		if err == nil {
+			choice.Model = model
+			return response, choice, nil
+		}
+
+		reason := fallbackReason(err)
+		if last || reason == "" || ctx.Err() != nil {
+			return nil, choice, err
+		}
+		logger.Warn("Synthesis model unavailable, falling back",
+			zap.String("model", model),
+			zap.String("fallback_model", chain[i+1]),
+			zap.String("reason", reason),
+			zap.Error(err))
+		choice.Reason = reason
+		choice.FallbackFrom = append(choice.FallbackFrom, model)
+	}
+	return nil, choice, fmt.Errorf("no synthesis model routed")
+}
+
+// fallbackReason returns the routing reason for falling back after err, or "" when the
+// next model would fail the same way
+func fallbackReason(err error) string {
+	if errors.Is(err, errContentDelivered) {
+		return ""
+	}
+	if errors.Is(err, resilience.ErrCircuitBreakerOpen) {
+		return routingReasonCircuitOpen
+	}
+	switch getErrorType(err) {
+	case "rate_limit":
+		return routingReasonRateLimited
+	case "circuit_breaker":
+		return routingReasonCircuitOpen
+	default:
+		return ""
+	}
+}
+
+// retryExceptRateLimits wraps a retry function so rate limits are not retried
+func retryExceptRateLimits(retryOn func(error) bool) func(error) bool {
+	return func(err error) bool {
+		if getErrorType(err) == "rate_limit" {
+			return false
+		}
+		if retryOn != nil {
+			return retryOn(err)
+		}
+		return resilience.DefaultRetryOnFunc(err)
+	}
+}
+
+// modelCircuitBreaker returns the circuit breaker of a model, created on first use. Only
+// rate limits and unavailability count as failures, so bad requests do not open it.
+func modelCircuitBreaker(model string, logger *zap.Logger) *resilience.CircuitBreaker {
+	modelBreakersMu.Lock()
+	defer modelBreakersMu.Unlock()
+
+	breaker, ok := modelBreakers[model]
+	if !ok {
+		cbConfig := resilience.DefaultCircuitBreakerConfig("synthesis-model-" + model)
+		cbConfig.IsFailureFunc = func(err error) bool {
+			switch getErrorType(err) {
+			case "rate_limit", "service_unavailable":
+				return true
+			default:
+				return false
+			}
+		}
+		breaker = resilience.NewCircuitBreaker(cbConfig, logger)
+		modelBreakers[model] = breaker
+	}
+	return breaker
+}
@@ -0,0 +1,251 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/llm"
+	"github.com/your-org/ai-sa-assistant/internal/llm/llmtest"
+	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+	"go.uber.org/zap"
+)
+
+func TestRouteModel(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := createTestConfig()
+	cfg.Synthesis.Routing = config.SynthesisRoutingConfig{Fallbacks: []string{"gpt-4o-mini"}}
+
+	simple := SynthesisRequest{Query: "What is a VPC?"}
+	medium := SynthesisRequest{Query: "How do I configure a VPC subnet on AWS?"}
+	complexReq := SynthesisRequest{Query: "Create an enterprise migration plan for 120 VMs to AWS"}
+	plan := SynthesisRequest{Query: "What is a VPC?", Mode: SynthesisModePlan}
+	compare := SynthesisRequest{Query: "What is a VPC?", Mode: SynthesisModeCompare}
+
+	route := routeModel(complexReq, cfg, logger)
+	assert.Equal(t, modelRoute{Model: "gpt-4o", Reason: routingReasonConfigured, Fallbacks: []string{"gpt-4o-mini"}}, route,
+		"disabled routing uses the synthesis model")
+
+	cfg.Synthesis.Routing.Enabled = true
+	cfg.Synthesis.Routing.ComplexModel = "gpt-4-turbo"
+	tests := []struct {
+		req    SynthesisRequest
+		model  string
+		reason string
+	}{
+		{simple, config.DefaultLLMFastModel, routingReasonSimple},
+		{medium, "gpt-4o", routingReasonMedium},
+		{complexReq, "gpt-4-turbo", routingReasonComplex},
+		{plan, "gpt-4-turbo", routingReasonPlan},
+		{compare, "gpt-4-turbo", routingReasonComparison},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			route := routeModel(tt.req, cfg, logger)
+			assert.Equal(t, tt.model, route.Model)
+			assert.Equal(t, tt.reason, route.Reason)
+		})
+	}
+
+	cfg.Synthesis.Routing.SimpleModel = "gpt-3.5-turbo"
+	assert.Equal(t, "gpt-3.5-turbo", routeModel(simple, cfg, logger).Model)
+}
+
+func TestModelRouteChain(t *testing.T) {
+	route := modelRoute{Model: "gpt-4o", Fallbacks: []string{"gpt-4o-mini", "gpt-4o", "", "gpt-3.5-turbo"}}
+	assert.Equal(t, []string{"gpt-4o", "gpt-4o-mini", "gpt-3.5-turbo"}, route.chain())
+
+	continued := route.from(modelChoice{Model: "gpt-4o-mini", Reason: routingReasonRateLimited})
+	assert.Equal(t, modelRoute{Model: "gpt-4o-mini", Reason: routingReasonRateLimited, Fallbacks: []string{"gpt-3.5-turbo"}},
+		continued)
+}
+
+func TestCompleteWithFallback(t *testing.T) {
+	logger := zap.NewNop()
+	ctx := context.Background()
+
+	completeWith := func(errs map[string]error, called *[]string) chatCompletionFunc {
+		return func(_ context.Context, model string, _ resilience.BackoffConfig) (*internalopenai.ChatCompletionResponse, error) {
+			*called = append(*called, model)
+			if err := errs[model]; err != nil {
+				return nil, err
+			}
+			return &internalopenai.ChatCompletionResponse{Content: "answer from " + model}, nil
+		}
+	}
+	rateLimited := resilience.NewTooManyRequestsError("rate limit exceeded", nil)
+
+	t.Run("rate limited model falls back", func(t *testing.T) {
+		var called []string
+		route := modelRoute{Model: "fallback-test-primary", Reason: routingReasonComplex,
+			Fallbacks: []string{"fallback-test-secondary"}}
+		response, choice, err := completeWithFallback(ctx, route, resilience.DefaultBackoffConfig(), logger,
+			completeWith(map[string]error{"fallback-test-primary": rateLimited}, &called))
+		require.NoError(t, err)
+		assert.Equal(t, "answer from fallback-test-secondary", response.Content)
+		assert.Equal(t, modelChoice{Model: "fallback-test-secondary", Reason: routingReasonRateLimited,
+			FallbackFrom: []string{"fallback-test-primary"}}, choice)
+		assert.Equal(t, []string{"fallback-test-primary", "fallback-test-secondary"}, called)
+	})
+
+	t.Run("open circuit is skipped", func(t *testing.T) {
+		breaker := modelCircuitBreaker("fallback-test-open", logger)
+		for i := 0; i < resilience.DefaultMaxFailures; i++ {
+			_ = breaker.Execute(ctx, func(context.Context) error { return rateLimited })
+		}
+		require.Equal(t, resilience.CircuitOpen, breaker.GetState())
+
+		var called []string
+		route := modelRoute{Model: "fallback-test-open", Reason: routingReasonSimple, Fallbacks: []string{"fallback-test-healthy"}}
+		_, choice, err := completeWithFallback(ctx, route, resilience.DefaultBackoffConfig(), logger, completeWith(nil, &called))
+		require.NoError(t, err)
+		assert.Equal(t, "fallback-test-healthy", choice.Model)
+		assert.Equal(t, routingReasonCircuitOpen, choice.Reason)
+		assert.Equal(t, []string{"fallback-test-healthy"}, called, "the open model is not called")
+	})
+
+	t.Run("other errors do not fall back", func(t *testing.T) {
+		var called []string
+		route := modelRoute{Model: "fallback-test-invalid", Fallbacks: []string{"fallback-test-unused"}}
+		errs := map[string]error{
+			"fallback-test-invalid": resilience.NewBadRequestError("invalid request: context too long", nil),
+		}
+		_, _, err := completeWithFallback(ctx, route, resilience.DefaultBackoffConfig(), logger, completeWith(errs, &called))
+		require.Error(t, err)
+		assert.Equal(t, []string{"fallback-test-invalid"}, called)
+
+		called = nil
+		route = modelRoute{Model: "fallback-test-streamed", Fallbacks: []string{"fallback-test-unused"}}
+		errs = map[string]error{"fallback-test-streamed": fmt.Errorf("%w: %w", errContentDelivered, rateLimited)}
+		_, _, err = completeWithFallback(ctx, route, resilience.DefaultBackoffConfig(), logger, completeWith(errs, &called))
+		require.Error(t, err)
+		assert.Equal(t, []string{"fallback-test-streamed"}, called, "a partly streamed answer is not restarted")
+	})
+
+	t.Run("last model reports its error", func(t *testing.T) {
+		var called []string
+		route := modelRoute{Model: "fallback-test-busy", Fallbacks: []string{"fallback-test-also-busy"}}
+		errs := map[string]error{"fallback-test-busy": rateLimited, "fallback-test-also-busy": rateLimited}
+		_, choice, err := completeWithFallback(ctx, route, resilience.DefaultBackoffConfig(), logger, completeWith(errs, &called))
+		require.Error(t, err)
+		assert.Equal(t, []string{"fallback-test-busy"}, choice.FallbackFrom)
+	})
+}
+
+func TestCheckCompletionsFallBackFromRateLimitedModel(t *testing.T) {
+	logger := zap.NewNop()
+	server := llmtest.NewServer()
+	defer server.Close()
+
+	cfg := createTestConfig()
+	cfg.Synthesis.Model = llmtest.RateLimitedModel
+	cfg.Synthesis.Routing = config.SynthesisRoutingConfig{Fallbacks: []string{"llama3"}}
+	cfg.LLM = config.LLMConfig{
+		Providers: map[string]config.LLMProviderConfig{
+			"local": {Type: llm.ProviderOpenAICompatible, Endpoint: server.URL(llmtest.PathLocal), APIKey: llmtest.APIKey},
+		},
+		Routes: map[string]config.LLMRouteConfig{config.LLMServiceSynthesize: {Provider: "local"}},
+	}
+	client, err := newChatClient(cfg, logger, resilience.DefaultTimeoutConfig())
+	require.NoError(t, err)
+
+	server.SetFunctionArguments(`{"verdicts": [{"claim": 1, "entailed": true}]}`)
+	judge := &openAIEntailmentJudge{client: client, route: checkRoute("", cfg), retryConfig: resilience.DefaultBackoffConfig(),
+		logger: logger}
+	verdicts, err := judge.JudgeEntailment(context.Background(), []synth.EntailmentCheck{{Claim: "A VPC is a network."}})
+	require.NoError(t, err, "the entailment check continues on the fallback model")
+	assert.Equal(t, []bool{true}, verdicts)
+
+	server.SetFunctionArguments(`{"scores": [{"item": 1, "score": 0.1}]}`)
+	classifier := &openAIInjectionClassifier{client: client, route: checkRoute("", cfg),
+		retryConfig: resilience.DefaultBackoffConfig(), logger: logger}
+	scores, err := classifier.ClassifyInjection(context.Background(), []synth.UntrustedItem{{SourceID: "doc", Text: "text"}})
+	require.NoError(t, err, "the injection classifier continues on the fallback model")
+	assert.Equal(t, []float64{0.1}, scores)
+
+	var models []string
+	for _, request := range server.Requests() {
+		models = append(models, request.Model)
+	}
+	assert.Equal(t, []string{llmtest.RateLimitedModel, "llama3", llmtest.RateLimitedModel, "llama3"}, models)
+}
+
+func TestSynthesisHandlerFallsBackFromRateLimitedModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	server := llmtest.NewServer()
+	defer server.Close()
+	server.SetReply("Use a VPC with public and private subnets [aws-vpc].")
+
+	cfg := createTestConfig()
+	cfg.Synthesis.Model = llmtest.RateLimitedModel
+	cfg.Synthesis.Routing = config.SynthesisRoutingConfig{Fallbacks: []string{"llama3"}}
+	cfg.LLM = config.LLMConfig{
+		Providers: map[string]config.LLMProviderConfig{
+			"local": {Type: llm.ProviderOpenAICompatible, Endpoint: server.URL(llmtest.PathLocal), APIKey: llmtest.APIKey},
+		},
+		Routes: map[string]config.LLMRouteConfig{config.LLMServiceSynthesize: {Provider: "local"}},
+	}
+
+	client, err := newChatClient(cfg, logger, resilience.DefaultTimeoutConfig())
+	require.NoError(t, err)
+
+	handler := createSynthesisHandler(cfg, logger, client, synthesis.NewMetricsCollector(logger, nil), nil, nil)
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  "What is a VPC?",
+		Chunks: []ChunkItem{{Text: "A VPC is an isolated virtual network.", DocID: "aws-vpc", SourceID: "aws-vpc"}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler(c)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Metadata        map[string]interface{} `json:"metadata"`
+		ProcessingStats map[string]interface{} `json:"processing_stats"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "llama3", response.ProcessingStats["model_used"])
+	assert.Equal(t, routingReasonRateLimited, response.ProcessingStats["model_routing_reason"])
+	assert.Equal(t, []interface{}{llmtest.RateLimitedModel}, response.ProcessingStats["model_fallbacks"])
+	assert.Equal(t, "llama3", response.Metadata["model"])
+
+	var models []string
+	for _, request := range server.Requests() {
+		models = append(models, request.Model)
+	}
+	assert.Equal(t, []string{llmtest.RateLimitedModel, "llama3"}, models,
+		"the rate limited model is not retried while a fallback is left")
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	internalopenai "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/scaffold"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+	"go.uber.org/zap"
+)
+
+// SynthesisModeScaffold answers with a complete Terraform project built from the answer's
+// code, returned in the response or, when the client accepts application/zip, as an archive
+const SynthesisModeScaffold = "scaffold"
+
+// ScaffoldValidHeader reports on zip responses whether the project passed validation
+const ScaffoldValidHeader = "X-Scaffold-Valid"
+
+// scaffoldProviders maps the cloud providers extracted from a query to Terraform providers
+var scaffoldProviders = map[string]string{
+	"AWS":   "aws",
+	"Azure": "azurerm",
+	"GCP":   "google",
+}
+
+// handleScaffoldRequest generates an answer with complete Terraform code for a /synthesize
+// request in scaffold mode and builds a validated project from it
+func handleScaffoldRequest(
+	c *gin.Context,
+	req SynthesisRequest,
+	startTime time.Time,
+	cfg *config.Config,
+	logger *zap.Logger,
+	openaiClient *internalopenai.Client,
+	metricsCollector *synthesis.MetricsCollector,
+) {
+	params := scaffoldParameters(req.Query)
+	req.scaffoldInstructions = buildScaffoldInstructions(params)
+
+	response, choice, err := processSynthesisRequest(req, cfg, logger, openaiClient, nil)
+	if err != nil {
+		handleSynthesisError(c, err, logger, "scaffold synthesis")
+		return
+	}
+	req.modelChoice = choice
+	response, choice, grounding := enforceGrounding(req, response, cfg, logger, openaiClient)
+	req.modelChoice = choice
+
+	processingTime := time.Since(startTime)
+	logSynthesisCompletion(req, response, processingTime, logger)
+
+	synthesisResponse := buildSynthesisResponse(response, &req, req.Query, detectQueryDomain(req.Query), cfg,
+		processingTime, grounding, metricsCollector, openaiClient, logger)
+
+	snippets, _ := synthesisResponse["code_snippets"].([]synth.CodeSnippet)
+	project, err := scaffold.Build(params, terraformSources(snippets))
+	if err != nil {
+		logger.Warn("Could not scaffold a Terraform project", zap.Error(err))
+		if acceptsZip(c) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Scaffold failed", "details": err.Error()})
+			return
+		}
+		synthesisResponse["scaffold_error"] = err.Error()
+		c.JSON(http.StatusOK, synthesisResponse)
+		return
+	}
+
+	logger.Info("Scaffolded Terraform project",
+		zap.String("project", project.Name),
+		zap.Bool("valid", project.Valid),
+		zap.Int("files", len(project.Files)),
+		zap.Int("notes", len(project.Notes)))
+
+	if acceptsZip(c) {
+		data, err := project.Zip()
+		if err != nil {
+			logger.Error("Failed to archive Terraform project", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Scaffold failed", "details": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", project.ArchiveName()))
+		c.Header(ScaffoldValidHeader, strconv.FormatBool(project.Valid))
+		c.Data(http.StatusOK, scaffold.ContentTypeZip, data)
+		return
+	}
+
+	synthesisResponse["scaffold"] = project
+	c.JSON(http.StatusOK, synthesisResponse)
+}
+
+// scaffoldParameters extracts the project parameters from the query
+func scaffoldParameters(query string) scaffold.Parameters {
+	queryParams := extractQueryParameters(query)
+	params := scaffold.Parameters{
+		Description: query,
+		VMCount:     queryParams.VmCount,
+		Regions:     queryParams.Regions,
+		RTO:         queryParams.RTORequirement,
+		RPO:         queryParams.RPORequirement,
+		DisasterRecovery: detectQueryDomain(query) == DisasterRecovery ||
+			queryParams.RTORequirement != "" || queryParams.RPORequirement != "",
+	}
+	// The provider is left to the generated code when the query names several clouds
+	if len(queryParams.CloudProviders) == 1 {
+		params.Provider = scaffoldProviders[queryParams.CloudProviders[0]]
+	}
+	return params
+}
+
+// buildScaffoldInstructions asks for complete Terraform code that uses the project's variables
+func buildScaffoldInstructions(params scaffold.Parameters) string {
+	var instructions strings.Builder
+	instructions.WriteString("The Terraform code in this answer is assembled into a Terraform project. " +
+		"Include the complete configuration for the solution in ```hcl code blocks: every resource, " +
+		"data source, module, local value and output it needs, not excerpts. " +
+		"Do not write terraform or provider blocks; the project generates them.\n\n" +
+		"The project declares these variables. Use them instead of literal values and do not declare them again:\n")
+	for _, variable := range params.Variables() {
+		fmt.Fprintf(&instructions, "- var.%s (%s, currently %s): %s\n",
+			variable.Name, variable.Type, variable.Default, variable.Description)
+	}
+	if alias := params.ProviderAlias(); alias != "" {
+		fmt.Fprintf(&instructions, "\nSet provider = %s on resources in the disaster recovery region.\n", alias)
+	}
+	instructions.WriteString("\nDeclare any other input variable the code needs with a description.")
+	return instructions.String()
+}
+
+// terraformSources returns the code of the Terraform snippets
+func terraformSources(snippets []synth.CodeSnippet) []string {
+	var sources []string
+	for _, snippet := range snippets {
+		switch strings.ToLower(snippet.Language) {
+		case "terraform", "hcl", "tf":
+			sources = append(sources, snippet.Code)
+		}
+	}
+	return sources
+}
+
+// acceptsZip reports whether the client asked for the project as a zip archive
+func acceptsZip(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), scaffold.ContentTypeZip)
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/your-org/ai-sa-assistant/internal/scaffold"
+	"github.com/your-org/ai-sa-assistant/internal/synthesis"
+	"go.uber.org/zap"
+)
+
+const mockScaffoldAnswer = "Replicate the VMs to us-west-2 with AWS Elastic Disaster Recovery [aws-drs].\n\n" +
+	"```hcl\nresource \"aws_instance\" \"app\" {\n  count         = var.vm_count\n  ami           = var.ami_id\n" +
+	"  instance_type = \"t3.medium\"\n}\n\nresource \"aws_s3_bucket\" \"backup\" {\n  provider = aws.dr\n" +
+	"  bucket   = \"${var.project_name}-backup\"\n}\n```"
+
+// serveScaffoldRequest sends a scaffold mode request to a handler backed by a model that
+// answers with mockScaffoldAnswer and returns the response and the model's system messages
+func serveScaffoldRequest(t *testing.T, query, accept string) (*httptest.ResponseRecorder, []string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	var mu sync.Mutex
+	var systemMessages []string
+	openaiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		for _, message := range body.Messages {
+			if message.Role == "system" {
+				systemMessages = append(systemMessages, message.Content)
+			}
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(createMockChatResponseWithContent(mockScaffoldAnswer)))
+	}))
+	t.Cleanup(openaiServer.Close)
+
+	cfg := createTestConfig()
+	handler := createSynthesisHandler(cfg, logger, createTestOpenAIClient(openaiServer.URL, logger),
+		synthesis.NewMetricsCollector(logger, nil), nil, nil)
+
+	reqBody, err := json.Marshal(SynthesisRequest{
+		Query:  query,
+		Chunks: []ChunkItem{{Text: "AWS DRS replicates servers continuously", DocID: "drs", SourceID: "aws-drs"}},
+		Mode:   SynthesisModeScaffold,
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, err = http.NewRequest(http.MethodPost, "/synthesize", bytes.NewBuffer(reqBody))
+	require.NoError(t, err)
+	c.Request.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		c.Request.Header.Set("Accept", accept)
+	}
+
+	handler(c)
+	return w, systemMessages
+}
+
+func TestSynthesisHandlerScaffoldMode(t *testing.T) {
+	w, systemMessages := serveScaffoldRequest(t,
+		"Terraform for DR of 40 VMs on AWS from us-east-1 to us-west-2 with RTO 4 hours", "")
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, strings.Join(systemMessages, "\n"), "- var.vm_count (number, currently 40)")
+	assert.Contains(t, strings.Join(systemMessages, "\n"), "Set provider = aws.dr")
+
+	var response struct {
+		Scaffold scaffold.Project `json:"scaffold"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	project := response.Scaffold
+	assert.True(t, project.Valid)
+	require.Len(t, project.Files, 7)
+	assert.Equal(t, "main.tf", project.Files[0].Path)
+	assert.Contains(t, project.Files[0].Content, "resource \"aws_instance\" \"app\"")
+	assert.Contains(t, project.Files[1].Content, "default     = \"us-west-2\"")
+	assert.Contains(t, project.Files[1].Content, "default     = 240")
+}
+
+func TestSynthesisHandlerScaffoldModeZip(t *testing.T) {
+	w, _ := serveScaffoldRequest(t, "Terraform to migrate 12 VMs to AWS in eu-west-1", scaffold.ContentTypeZip)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, scaffold.ContentTypeZip, w.Header().Get("Content-Type"))
+	assert.Equal(t, "true", w.Header().Get(ScaffoldValidHeader))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".zip\"")
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range archive.File {
+		names = append(names, entry.Name[strings.Index(entry.Name, "/")+1:])
+	}
+	assert.Contains(t, names, "environments/prod.tfvars")
+	assert.Contains(t, names, "README.md")
+}
+
+func TestScaffoldParameters(t *testing.T) {
+	params := scaffoldParameters("Set up DR for 25 VMs on Azure in East US with RPO 15 minutes")
+	assert.Equal(t, "azurerm", params.Provider)
+	assert.Equal(t, 25, params.VMCount)
+	assert.Equal(t, []string{"eastus"}, params.Regions)
+	assert.True(t, params.DisasterRecovery)
+
+	params = scaffoldParameters("Compare landing zones on AWS and Azure")
+	assert.Empty(t, params.Provider)
+	assert.False(t, params.DisasterRecovery)
+}
@@ -0,0 +1,204 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/export"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"github.com/your-org/ai-sa-assistant/internal/teams"
+	"go.uber.org/zap"
+)
+
+const (
+	// exportDownloadTTL is how long a rendered export stays available for download
+	exportDownloadTTL = time.Hour
+	// maxExportDownloads caps the number of rendered exports held in memory
+	maxExportDownloads = 100
+	// exportTokenBytes is the length of the random download token
+	exportTokenBytes = 16
+)
+
+// ExportRequest represents a request from the export action of an answer card
+type ExportRequest struct {
+	Query      string                  `json:"query"`
+	ResponseID string                  `json:"response_id,omitempty"`
+	Format     string                  `json:"format,omitempty"`
+	Response   synth.SynthesisResponse `json:"response"`
+	Timestamp  string                  `json:"timestamp,omitempty"`
+}
+
+// exportDownload is a rendered export waiting to be downloaded
+type exportDownload struct {
+	file      *export.File
+	expiresAt time.Time
+}
+
+// exportDownloads holds rendered exports behind unguessable tokens, because a card action
+// cannot return a file to Teams directly
+type exportDownloads struct {
+	mu    sync.Mutex
+	files map[string]exportDownload
+	now   func() time.Time
+}
+
+// newExportDownloads creates an empty download store
+func newExportDownloads() *exportDownloads {
+	return &exportDownloads{
+		files: make(map[string]exportDownload),
+		now:   time.Now,
+	}
+}
+
+// Add stores a file and returns its download token
+func (d *exportDownloads) Add(file *export.File) (string, error) {
+	tokenBytes := make([]byte, exportTokenBytes)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate download token: %w", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	var oldestToken string
+	var oldest time.Time
+	for existing, download := range d.files {
+		if now.After(download.expiresAt) {
+			delete(d.files, existing)
+			continue
+		}
+		if oldestToken == "" || download.expiresAt.Before(oldest) {
+			oldestToken, oldest = existing, download.expiresAt
+		}
+	}
+	if len(d.files) >= maxExportDownloads {
+		delete(d.files, oldestToken)
+	}
+
+	d.files[token] = exportDownload{file: file, expiresAt: now.Add(exportDownloadTTL)}
+	return token, nil
+}
+
+// Get returns the file for a token, if it has not expired
+func (d *exportDownloads) Get(token string) (*export.File, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	download, ok := d.files[token]
+	if !ok {
+		return nil, false
+	}
+	if d.now().After(download.expiresAt) {
+		delete(d.files, token)
+		return nil, false
+	}
+	return download.file, true
+}
+
+// handleExport renders an answer as a document and sends Teams a card linking to the download
+func handleExport(
+	c *gin.Context,
+	cfg *config.Config,
+	exporter *export.Exporter,
+	downloads *exportDownloads,
+	logger *zap.Logger,
+) {
+	var exportRequest ExportRequest
+	if err := c.ShouldBindJSON(&exportRequest); err != nil {
+		logger.Error("Failed to parse export request", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export request format"})
+		return
+	}
+	if strings.TrimSpace(exportRequest.Response.MainText) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Response to export is required"})
+		return
+	}
+
+	if exportRequest.Format == "" {
+		exportRequest.Format = string(export.FormatDOCX)
+	}
+	format, err := export.ParseFormat(exportRequest.Format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be one of: docx, pdf, markdown"})
+		return
+	}
+
+	if cfg.Teams.PublicURL == "" {
+		logger.Error("Cannot export without teams.public_url; Teams needs an absolute download URL")
+		sendErrorCardToTeams(cfg, exportRequest.Query, "Export failed: the bot's public URL is not configured", logger)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Exports require teams.public_url to be configured"})
+		return
+	}
+
+	logger.Info("Received export request",
+		zap.String("query", exportRequest.Query),
+		zap.String("format", string(format)),
+		zap.String("response_id", exportRequest.ResponseID))
+
+	document := export.NewResponseDocument(exportRequest.Query, exportRequest.Response)
+	file, err := exporter.Export(c.Request.Context(), document, format)
+	if err != nil {
+		logger.Error("Failed to export response", zap.Error(err))
+		sendErrorCardToTeams(cfg, exportRequest.Query, fmt.Sprintf("Export failed: %v", err), logger)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Export failed"})
+		return
+	}
+
+	token, err := downloads.Add(file)
+	if err != nil {
+		logger.Error("Failed to store export", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Export failed"})
+		return
+	}
+	downloadURL := strings.TrimSuffix(cfg.Teams.PublicURL, "/") + "/teams-export/" + token
+
+	exportCard, err := teams.GenerateExportCard(file.Name, downloadURL)
+	if err != nil {
+		logger.Error("Failed to generate export card", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate export card"})
+		return
+	}
+
+	if err := sendCardToTeams(cfg, exportCard, logger); err != nil {
+		logger.Error("Failed to send export card to Teams", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send export"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Export ready", "download_url": downloadURL})
+}
+
+// handleExportDownload serves a rendered export
+func handleExportDownload(c *gin.Context, downloads *exportDownloads) {
+	file, ok := downloads.Get(c.Param("token"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found or expired"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+	c.Data(http.StatusOK, file.ContentType, file.Data)
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/export"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"go.uber.org/zap"
+)
+
+func TestHandleExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	var sentCard string
+	teamsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sentCard = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer teamsServer.Close()
+
+	cfg := &config.Config{Teams: config.TeamsConfig{WebhookURL: teamsServer.URL, PublicURL: "https://bot.example.com/"}}
+	downloads := newExportDownloads()
+	router := gin.New()
+	router.POST("/teams-export", func(c *gin.Context) {
+		handleExport(c, cfg, export.NewExporter(export.Branding{}, nil, logger), downloads, logger)
+	})
+	router.GET("/teams-export/:token", func(c *gin.Context) {
+		handleExportDownload(c, downloads)
+	})
+
+	body, err := json.Marshal(ExportRequest{
+		Query:    "Plan a migration to AWS",
+		Response: synth.SynthesisResponse{MainText: "Use AWS MGN [aws-guide].", Sources: []string{"aws-guide"}},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/teams-export", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var response struct {
+		DownloadURL string `json:"download_url"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Contains(t, sentCard, "Action.OpenUrl")
+
+	var payload struct {
+		Attachments []struct {
+			Content struct {
+				Actions []struct {
+					Type string `json:"type"`
+					URL  string `json:"url"`
+				} `json:"actions"`
+			} `json:"content"`
+		} `json:"attachments"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(sentCard), &payload))
+	require.Len(t, payload.Attachments, 1)
+	require.Len(t, payload.Attachments[0].Content.Actions, 1)
+	cardURL, err := url.Parse(payload.Attachments[0].Content.Actions[0].URL)
+	require.NoError(t, err)
+	assert.True(t, cardURL.IsAbs(), "card URL %q must be absolute", cardURL)
+	assert.Equal(t, "bot.example.com", cardURL.Host)
+	assert.True(t, strings.HasPrefix(cardURL.Path, "/teams-export/"), cardURL.Path)
+	assert.Equal(t, cardURL.String(), response.DownloadURL)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, response.DownloadURL, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, export.FormatDOCX.ContentType(), w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".docx")
+	_, err = zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.NoError(t, err, "expected a DOCX archive")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/teams-export/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	for _, invalid := range []ExportRequest{
+		{Query: "No response"},
+		{Query: "Bad format", Format: "odt", Response: synth.SynthesisResponse{MainText: "text"}},
+	} {
+		body, _ := json.Marshal(invalid)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/teams-export", bytes.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, invalid.Query)
+	}
+}
+
+func TestHandleExportRequiresPublicURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	var sentCard string
+	teamsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sentCard = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer teamsServer.Close()
+
+	cfg := &config.Config{Teams: config.TeamsConfig{WebhookURL: teamsServer.URL}}
+	downloads := newExportDownloads()
+	router := gin.New()
+	router.POST("/teams-export", func(c *gin.Context) {
+		handleExport(c, cfg, export.NewExporter(export.Branding{}, nil, logger), downloads, logger)
+	})
+
+	body, err := json.Marshal(ExportRequest{
+		Query:    "Plan a migration to AWS",
+		Response: synth.SynthesisResponse{MainText: "Use AWS MGN [aws-guide]."},
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/teams-export", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, sentCard, "Action.OpenUrl", "no download card should be sent")
+	assert.Empty(t, downloads.files, "nothing should be stored for download")
+}
+
+func TestExportDownloadsExpire(t *testing.T) {
+	downloads := newExportDownloads()
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	downloads.now = func() time.Time { return now }
+
+	token, err := downloads.Add(&export.File{Name: "plan.pdf"})
+	require.NoError(t, err)
+	_, ok := downloads.Get(token)
+	assert.True(t, ok)
+
+	now = now.Add(exportDownloadTTL + time.Second)
+	_, ok = downloads.Get(token)
+	assert.False(t, ok, "expected the export to expire")
+}
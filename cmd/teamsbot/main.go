@@ -27,11 +27,13 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/your-org/ai-sa-assistant/internal/acl"
 	"github.com/your-org/ai-sa-assistant/internal/clarification"
 	"github.com/your-org/ai-sa-assistant/internal/classifier"
 	"github.com/your-org/ai-sa-assistant/internal/config"
 	"github.com/your-org/ai-sa-assistant/internal/conversation"
 	"github.com/your-org/ai-sa-assistant/internal/diagram"
+	"github.com/your-org/ai-sa-assistant/internal/export"
 	"github.com/your-org/ai-sa-assistant/internal/feedback"
 	"github.com/your-org/ai-sa-assistant/internal/health"
 	"github.com/your-org/ai-sa-assistant/internal/session"
@@ -96,13 +98,22 @@ func main() {
 
 	// Initialize diagram renderer
 	diagramConfig := diagram.RendererConfig{
+		Backend:        cfg.Diagram.Backend,
 		MermaidInkURL:  cfg.Diagram.MermaidInkURL,
+		PublicURL:      cfg.Diagram.PublicURL,
+		StorageDir:     cfg.Diagram.StorageDir,
 		Timeout:        time.Duration(cfg.Diagram.Timeout) * time.Second,
 		CacheExpiry:    time.Duration(cfg.Diagram.CacheExpiry) * time.Hour,
 		EnableCaching:  cfg.Diagram.EnableCaching,
 		MaxDiagramSize: cfg.Diagram.MaxDiagramSize,
 	}
 	diagramRenderer := diagram.NewRenderer(diagramConfig, logger)
+	if cfg.Diagram.PublicURL == "" {
+		logger.Warn("diagram.public_url is not set; Teams cards need absolute diagram URLs to show images")
+	}
+	if cfg.Teams.PublicURL == "" {
+		logger.Warn("teams.public_url is not set; answer exports are disabled because Teams needs absolute download URLs")
+	}
 
 	// Initialize session manager
 	sessionConfig := session.Config{
@@ -148,6 +159,9 @@ func main() {
 	// Health check endpoint
 	router.GET("/health", gin.WrapH(healthManager.HTTPHandler()))
 
+	// Rendered diagram assets
+	diagram.NewAssetHandler(diagramRenderer.Store(), logger).RegisterRoutes(router)
+
 	// Teams webhook endpoint
 	router.POST("/teams-webhook", func(c *gin.Context) {
 		handleTeamsWebhook(c, cfg, orchestrator, messageParser, webhookValidator, queryClassifier, logger)
@@ -163,6 +177,16 @@ func main() {
 		handleRegeneration(c, cfg, orchestrator, feedbackLogger, logger)
 	})
 
+	// Export endpoints
+	exporter := export.NewExporter(export.BrandingFromConfig(cfg.Export), diagramRenderer, logger)
+	downloads := newExportDownloads()
+	router.POST("/teams-export", func(c *gin.Context) {
+		handleExport(c, cfg, exporter, downloads, logger)
+	})
+	router.GET("/teams-export/:token", func(c *gin.Context) {
+		handleExportDownload(c, downloads)
+	})
+
 	// Clarification endpoint
 	router.POST("/teams-clarify", func(c *gin.Context) {
 		handleClarification(c, cfg, orchestrator, feedbackLogger, logger)
@@ -179,7 +203,8 @@ func main() {
 		zap.String("retrieve_url", cfg.Services.RetrieveURL),
 		zap.String("synthesize_url", cfg.Services.SynthesizeURL),
 		zap.String("websearch_url", cfg.Services.WebSearchURL),
-		zap.String("diagram_renderer_url", cfg.Diagram.MermaidInkURL))
+		zap.String("diagram_backend", diagramRenderer.BackendName()),
+		zap.String("diagram_public_url", cfg.Diagram.PublicURL))
 
 	if err := router.Run(":8080"); err != nil {
 		logger.Fatal("Failed to start server", zap.Error(err))
@@ -409,6 +434,7 @@ func handleTeamsWebhook(
 	const webhookTimeout = 18 * time.Second // Leave 2 seconds buffer for response processing
 	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
 	defer cancel()
+	ctx = acl.WithIdentity(ctx, callerIdentity(c, cfg, userID))
 
 	// Channel to receive orchestration result
 	resultChan := make(chan *teams.OrchestrationResult, 1)
@@ -848,6 +874,12 @@ func sanitizeFeedbackQuery(query string) string {
 	return sanitized
 }
 
+// callerIdentity builds the caller identity used for document access control from the
+// resolved Teams user. Group and clearance headers are only honoured behind a trusted proxy.
+func callerIdentity(c *gin.Context, cfg *config.Config, userID string) acl.Identity {
+	return acl.CallerIdentity(c.Request.Header, userID, cfg.ACL.TrustedProxyHeaders)
+}
+
 // extractUserIDFromRequest extracts user ID from request headers or context
 func extractUserIDFromRequest(c *gin.Context) string {
 	// Try to extract from Teams context if available
@@ -893,7 +925,8 @@ func handleClarification(c *gin.Context, cfg *config.Config, orchestrator *teams
 
 		// Process the enhanced query through normal flow
 		userID := extractUserIDFromRequest(c)
-		result := orchestrator.ProcessQuery(context.Background(), enhancedQuery, userID)
+		ctx := acl.WithIdentity(context.Background(), callerIdentity(c, cfg, userID))
+		result := orchestrator.ProcessQuery(ctx, enhancedQuery, userID)
 		if result.Error != nil {
 			logger.Error("Failed to process enhanced query", zap.Error(result.Error))
 			sendErrorCard(cfg, enhancedQuery, fmt.Sprintf("Processing failed: %v", result.Error), logger)
@@ -1115,7 +1148,8 @@ func setupHealthChecks(manager *health.Manager, cfg *config.Config, diagramRende
 			Status:    health.StatusHealthy,
 			Timestamp: time.Now(),
 			Metadata: map[string]interface{}{
-				"mermaid_ink_url": cfg.Diagram.MermaidInkURL,
+				"backend":         diagramRenderer.BackendName(),
+				"public_url":      cfg.Diagram.PublicURL,
 				"caching_enabled": cfg.Diagram.EnableCaching,
 			},
 		}
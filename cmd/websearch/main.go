@@ -27,46 +27,32 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/sashabaranov/go-openai"
 	"github.com/your-org/ai-sa-assistant/internal/config"
 	"github.com/your-org/ai-sa-assistant/internal/health"
-	openaiPkg "github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/openai"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
 	"github.com/your-org/ai-sa-assistant/internal/websearch"
 	"go.uber.org/zap"
 )
 
 const (
-	searchCacheTimeout   = 5 * time.Minute
 	defaultMaxResults    = 3
 	maxQueryLength       = 500
 	searchRequestTimeout = 30 * time.Second
 	healthCheckTimeout   = 5 * time.Second
-	defaultMaxTokens     = 800
-	defaultTemperature   = 0.3
-	searchPrompt         = `You are a web search assistant. Based on the following query, ` +
-		`provide search results with current, relevant information from reliable sources. ` +
-		`Focus on official documentation, product announcements, and authoritative technical content.
-
-Query: %s
-
-Return your response as a JSON array with this exact structure:
-[
-  {
-    "title": "Source title",
-    "snippet": "Relevant excerpt or summary (2-3 sentences)",
-    "url": "https://example.com/source",
-    "timestamp": "2025-01-01"
-  }
-]
-
-Provide up to 3 high-quality, relevant results. Focus on recent information ` +
-		`when possible, especially for technology-related queries.`
+	// sourceSearchDisabled is reported when no search provider is configured
+	sourceSearchDisabled = "web-search-disabled"
 )
 
 // SearchRequest represents a web search request
 type SearchRequest struct {
 	Query       string `json:"query" binding:"required"`
 	ForceSearch *bool  `json:"force_search,omitempty"`
+	// FetchContent set to false skips page fetching for this request; it cannot
+	// enable fetching when websearch.fetch.enabled is off
+	FetchContent *bool `json:"fetch_content,omitempty"`
+	// TimeWindow overrides the publication window detected from the query's dates
+	TimeWindow *websearch.TimeWindow `json:"time_window,omitempty"`
 }
 
 // SearchResult represents a single web search result
@@ -75,64 +61,121 @@ type SearchResult struct {
 	Snippet   string `json:"snippet"`
 	URL       string `json:"url"`
 	Timestamp string `json:"timestamp"`
+	Domain    string `json:"domain,omitempty"`
+	// Trust is the domain trust from the configured domain policy
+	Trust float64 `json:"trust,omitempty"`
 }
 
 // SearchResponse represents the complete response from a web search operation
 type SearchResponse struct {
-	Results   []SearchResult `json:"results"`
-	Source    string         `json:"source"`
-	Timestamp string         `json:"timestamp"`
-	Cached    bool           `json:"cached"`
+	Results []SearchResult `json:"results"`
+	// Passages are the most relevant excerpts of the fetched result pages, best first
+	Passages  []websearch.Passage `json:"passages,omitempty"`
+	Source    string              `json:"source"`
+	Timestamp string              `json:"timestamp"`
+	Cached    bool                `json:"cached"`
+	// Stale is set when an expired cached response is served because the provider failed
+	Stale bool `json:"stale,omitempty"`
+	// TimeWindow is the publication window results were restricted to
+	TimeWindow *websearch.TimeWindow `json:"time_window,omitempty"`
 }
 
-// CacheEntry represents a cached search response with expiration
-type CacheEntry struct {
-	Response  SearchResponse
-	ExpiresAt time.Time
-}
-
-// WebSearchService provides web search functionality using OpenAI
+// WebSearchService provides web search functionality backed by a live search provider
 type WebSearchService struct {
 	config          *config.Config
 	logger          *zap.Logger
-	openaiClient    *openaiPkg.Client
-	cache           map[string]*CacheEntry
-	cacheMutex      sync.RWMutex
+	provider        websearch.SearchProvider
+	fetcher         *websearch.PageFetcher
+	policy          websearch.DomainPolicy
+	embedder        websearch.Embedder
+	cache           websearch.ResultCache
+	cachePolicy     websearch.CachePolicy
 	detectionConfig websearch.DetectionConfig
 }
 
-// NewWebSearchService creates a new web search service instance
+// NewWebSearchService creates a new web search service instance. Web search is
+// disabled when no provider is configured.
 func NewWebSearchService(cfg *config.Config, logger *zap.Logger) (*WebSearchService, error) {
-	// Check if running in test mode
-	testMode := os.Getenv("TEST_MODE") == "true" || os.Getenv("CI") == "true"
-
-	var client *openaiPkg.Client
-	var err error
-
-	if testMode {
-		logger.Info("Skipping OpenAI client initialization in test mode")
-		client = nil // Set to nil in test mode
+	var provider websearch.SearchProvider
+	if strings.TrimSpace(cfg.WebSearch.Provider) == "" {
+		logger.Warn("No web search provider configured, web search is disabled")
 	} else {
-		client, err = openaiPkg.NewClient(cfg.OpenAI.APIKey, logger)
+		var err error
+		provider, err = websearch.NewSearchProvider(websearch.ProviderConfig{
+			Provider:       cfg.WebSearch.Provider,
+			APIKey:         cfg.WebSearch.APIKey,
+			Endpoint:       cfg.WebSearch.Endpoint,
+			SearchEngineID: cfg.WebSearch.SearchEngineID,
+			Market:         cfg.WebSearch.Market,
+		}, &http.Client{Timeout: time.Duration(cfg.WebSearch.TimeoutSeconds) * time.Second})
 		if err != nil {
-			return nil, fmt.Errorf("failed to create OpenAI client: %w", err)
+			return nil, fmt.Errorf("failed to create web search provider: %w", err)
 		}
+		logger.Info("Web search provider configured", zap.String("provider", provider.Name()))
 	}
 
+	fetchCfg := cfg.WebSearch.Fetch
+	fetcher := websearch.NewPageFetcher(websearch.FetchConfig{
+		Timeout:              time.Duration(fetchCfg.TimeoutSeconds) * time.Second,
+		MaxBytes:             int64(fetchCfg.MaxPageBytes),
+		AllowedDomains:       fetchCfg.AllowedDomains,
+		RespectRobots:        fetchCfg.RespectRobots,
+		UserAgent:            fetchCfg.UserAgent,
+		AllowPrivateNetworks: fetchCfg.AllowPrivateNetworks,
+	}, nil)
+
 	// Create detection config from existing freshness keywords
 	detectionConfig := websearch.ConfigFromSlice(cfg.WebSearch.FreshnessKeywords)
 
+	policy := websearch.DomainPolicy{
+		Allow:     cfg.WebSearch.Domains.Allow,
+		Deny:      cfg.WebSearch.Domains.Deny,
+		Preferred: cfg.WebSearch.Domains.Preferred,
+	}
+
+	cache, err := newResultCache(cfg.WebSearch.Cache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create web search cache: %w", err)
+	}
+
 	return &WebSearchService{
 		config:          cfg,
 		logger:          logger,
-		openaiClient:    client,
-		cache:           make(map[string]*CacheEntry),
-		cacheMutex:      sync.RWMutex{},
+		provider:        provider,
+		fetcher:         fetcher,
+		policy:          policy,
+		cache:           cache,
+		cachePolicy:     newCachePolicy(cfg.WebSearch.Cache),
 		detectionConfig: detectionConfig,
 	}, nil
 }
 
-func (s *WebSearchService) detectFreshnessKeywords(query string) bool {
+// newResultCache creates the configured response cache
+func newResultCache(cacheCfg config.WebCacheConfig) (websearch.ResultCache, error) {
+	if cacheCfg.StorageType == "sqlite" {
+		return websearch.NewSQLiteCache(cacheCfg.DBPath, cacheCfg.MaxEntries)
+	}
+	return websearch.NewMemoryCache(cacheCfg.MaxEntries), nil
+}
+
+// newCachePolicy converts the configured cache lifetimes, keeping defaults for unset values
+func newCachePolicy(cacheCfg config.WebCacheConfig) websearch.CachePolicy {
+	policy := websearch.DefaultCachePolicy()
+	if cacheCfg.TTLSeconds > 0 {
+		policy.TTL = time.Duration(cacheCfg.TTLSeconds) * time.Second
+	}
+	if cacheCfg.ReleaseTTLSeconds > 0 {
+		policy.ReleaseTTL = time.Duration(cacheCfg.ReleaseTTLSeconds) * time.Second
+	}
+	if cacheCfg.StaleSeconds > 0 {
+		policy.StaleFor = time.Duration(cacheCfg.StaleSeconds) * time.Second
+	}
+	return policy
+}
+
+// detectFreshness reports whether the query needs fresh information and which
+// publication window its dates ask for
+func (s *WebSearchService) detectFreshness(query string) websearch.DetectionResult {
 	result := websearch.DetectFreshnessNeeds(query, s.detectionConfig)
 
 	if result.NeedsFreshInfo {
@@ -150,110 +193,258 @@ func (s *WebSearchService) detectFreshnessKeywords(query string) bool {
 		)
 	}
 
-	return result.NeedsFreshInfo
+	return result
 }
 
-func (s *WebSearchService) getCachedResult(query string) (*SearchResponse, bool) {
-	s.cacheMutex.RLock()
-	defer s.cacheMutex.RUnlock()
-
-	entry, exists := s.cache[query]
-	if !exists {
+// getCachedResult returns the cached response for a query while it is fresh
+func (s *WebSearchService) getCachedResult(
+	query string,
+	window websearch.TimeWindow,
+	fetchContent bool,
+) (*SearchResponse, bool) {
+	response, entry, found := s.lookupCache(query, window, fetchContent)
+	if !found || !entry.Fresh(time.Now()) {
 		return nil, false
 	}
+	return response, true
+}
 
-	if time.Now().After(entry.ExpiresAt) {
-		delete(s.cache, query)
+// getStaleResult returns the cached response for a query after it has expired, for use
+// while the provider is failing
+func (s *WebSearchService) getStaleResult(
+	query string,
+	window websearch.TimeWindow,
+	fetchContent bool,
+) (*SearchResponse, bool) {
+	response, entry, found := s.lookupCache(query, window, fetchContent)
+	if !found {
 		return nil, false
 	}
+	response.Stale = !entry.Fresh(time.Now())
+	return response, true
+}
 
-	response := entry.Response
+// lookupCache reads and decodes the cached response for a query. Cache errors are
+// logged and treated as misses.
+func (s *WebSearchService) lookupCache(
+	query string,
+	window websearch.TimeWindow,
+	fetchContent bool,
+) (*SearchResponse, websearch.CacheEntry, bool) {
+	entry, found, err := s.cache.Get(cacheKey(query, window, fetchContent))
+	if err != nil {
+		s.logger.Warn("Failed to read web search cache", zap.Error(err))
+		return nil, entry, false
+	}
+	if !found {
+		return nil, entry, false
+	}
+
+	var response SearchResponse
+	if err := json.Unmarshal(entry.Value, &response); err != nil {
+		s.logger.Warn("Failed to decode cached search response", zap.Error(err))
+		return nil, entry, false
+	}
 	response.Cached = true
-	return &response, true
+	return &response, entry, true
+}
+
+// setCachedResult caches a response with the lifetime for the query's type
+func (s *WebSearchService) setCachedResult(
+	query string,
+	window websearch.TimeWindow,
+	fetchContent bool,
+	response SearchResponse,
+) {
+	value, err := json.Marshal(response)
+	if err != nil {
+		s.logger.Warn("Failed to encode search response for caching", zap.Error(err))
+		return
+	}
+	entry := s.cachePolicy.NewEntry(query, value, time.Now())
+	if err := s.cache.Set(cacheKey(query, window, fetchContent), entry); err != nil {
+		s.logger.Warn("Failed to write web search cache", zap.Error(err))
+	}
 }
 
-func (s *WebSearchService) setCachedResult(query string, response SearchResponse) {
-	s.cacheMutex.Lock()
-	defer s.cacheMutex.Unlock()
+// cacheKey normalizes the query so rephrasings share an entry, and keeps responses for
+// different publication windows and with fetched passages apart
+func cacheKey(query string, window websearch.TimeWindow, fetchContent bool) string {
+	key := websearch.NormalizeCacheKey(query)
+	if !window.IsZero() {
+		// Day granularity so a rolling window such as "last 30 days" is reused within a day
+		key += "\x00" + window.Start.Format("2006-01-02") + ".." + window.End.Format("2006-01-02")
+	}
+	if fetchContent {
+		return key + "\x00fetch"
+	}
+	return key
+}
 
-	s.cache[query] = &CacheEntry{
-		Response:  response,
-		ExpiresAt: time.Now().Add(searchCacheTimeout),
+// shouldFetchContent applies the request override to the configured fetch setting.
+// A request can turn fetching off but never on when the operator disabled it.
+func (s *WebSearchService) shouldFetchContent(req SearchRequest) bool {
+	if s.fetcher == nil || !s.config.WebSearch.Fetch.Enabled {
+		return false
+	}
+	if req.FetchContent != nil {
+		return *req.FetchContent
 	}
+	return true
 }
 
-func (s *WebSearchService) performSearch(ctx context.Context, query string) (*SearchResponse, error) {
+func (s *WebSearchService) performSearch(
+	ctx context.Context,
+	query string,
+	window websearch.TimeWindow,
+	fetchContent bool,
+) (*SearchResponse, error) {
 	if len(query) > maxQueryLength {
 		query = query[:maxQueryLength]
 	}
 
-	prompt := fmt.Sprintf(searchPrompt, query)
-
-	req := openaiPkg.ChatCompletionRequest{
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: prompt,
-			},
-		},
-		MaxTokens:   defaultMaxTokens,
-		Temperature: defaultTemperature,
-		Model:       "gpt-4o",
+	maxResults := s.config.WebSearch.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultMaxResults
 	}
 
-	s.logger.Debug("Sending search request to OpenAI",
+	s.logger.Debug("Sending search request to provider",
 		zap.String("query", query),
-		zap.String("model", req.Model),
+		zap.String("provider", s.provider.Name()),
 	)
 
-	resp, err := s.openaiClient.CreateChatCompletion(ctx, req)
+	// Ask for extra candidates when the domain policy may drop or reorder results
+	requested := maxResults
+	if !s.policy.IsEmpty() {
+		requested *= 2
+	}
+
+	providerResults, err := s.provider.Search(ctx, query, websearch.SearchOptions{
+		MaxResults: requested,
+		Window:     window,
+	})
 	if err != nil {
-		s.logger.Error("Failed to get OpenAI response", zap.Error(err))
+		s.logger.Error("Search provider request failed",
+			zap.String("provider", s.provider.Name()),
+			zap.Error(err))
 		return nil, fmt.Errorf("search API error: %w", err)
 	}
 
-	var results []SearchResult
-	if err := json.Unmarshal([]byte(resp.Content), &results); err != nil {
-		s.logger.Warn("Failed to parse OpenAI response as JSON, treating as text",
-			zap.Error(err),
-			zap.String("content", resp.Content),
-		)
-
-		results = []SearchResult{
-			{
-				Title:     "Web Search Result",
-				Snippet:   resp.Content,
-				URL:       "https://openai.com",
-				Timestamp: time.Now().Format("2006-01-02"),
-			},
+	if !s.policy.IsEmpty() {
+		permitted := s.policy.Apply(providerResults)
+		if dropped := len(providerResults) - len(permitted); dropped > 0 {
+			s.logger.Debug("Dropped results outside the domain policy",
+				zap.String("query", query),
+				zap.Int("dropped", dropped))
 		}
+		providerResults = permitted
 	}
 
-	maxResults := s.config.WebSearch.MaxResults
-	if maxResults <= 0 {
-		maxResults = defaultMaxResults
+	// Not every provider supports a date range, and those that do rely on page dates
+	// they infer, so results dated outside the window are dropped here as well
+	providerResults = websearch.FilterByWindow(providerResults, window)
+
+	results := make([]SearchResult, 0, len(providerResults))
+	for _, result := range providerResults {
+		results = append(results, SearchResult{
+			Title:     result.Title,
+			Snippet:   result.Snippet,
+			URL:       result.URL,
+			Timestamp: result.Published,
+			Domain:    websearch.ResultHost(result.URL),
+			Trust:     result.Trust,
+		})
 	}
 
 	if len(results) > maxResults {
 		results = results[:maxResults]
 	}
 
+	var passages []websearch.Passage
+	if fetchContent {
+		passages = s.fetchPassages(ctx, query, results)
+	}
+
 	response := SearchResponse{
 		Results:   results,
-		Source:    "openai-web-search",
+		Passages:  passages,
+		Source:    s.provider.Name(),
 		Timestamp: time.Now().Format(time.RFC3339),
 		Cached:    false,
 	}
+	if !window.IsZero() {
+		response.TimeWindow = &window
+	}
 
 	s.logger.Info("Search completed successfully",
 		zap.String("query", query),
+		zap.String("provider", s.provider.Name()),
 		zap.Int("results_count", len(results)),
-		zap.Int("completion_tokens", resp.Usage.CompletionTokens),
+		zap.Int("passages_count", len(passages)),
 	)
 
 	return &response, nil
 }
 
+// fetchPassages fetches the top result pages in parallel and returns the passages most
+// relevant to the query. Pages that fail to fetch are skipped, and results without a
+// provider date take the page's published date.
+func (s *WebSearchService) fetchPassages(ctx context.Context, query string, results []SearchResult) []websearch.Passage {
+	fetchCfg := s.config.WebSearch.Fetch
+	maxPages := fetchCfg.MaxPages
+	if maxPages <= 0 {
+		maxPages = config.DefaultWebFetchMaxPages
+	}
+	if maxPages > len(results) {
+		maxPages = len(results)
+	}
+	maxPassages := fetchCfg.MaxPassages
+	if maxPassages <= 0 {
+		maxPassages = config.DefaultWebFetchMaxPassages
+	}
+
+	pages := make([]*websearch.Page, maxPages)
+	var wg sync.WaitGroup
+	for i := 0; i < maxPages; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			page, err := s.fetcher.Fetch(ctx, results[i].URL)
+			if err != nil {
+				s.logger.Debug("Skipping result page",
+					zap.String("url", results[i].URL),
+					zap.Error(err))
+				return
+			}
+			pages[i] = page
+		}(i)
+	}
+	wg.Wait()
+
+	var passages []websearch.Passage
+	for i, page := range pages {
+		if page == nil {
+			continue
+		}
+		if results[i].Timestamp == "" {
+			results[i].Timestamp = page.Published
+		}
+		// Cite the URL the provider returned rather than any redirect target
+		page.URL = results[i].URL
+		if page.Title == "" {
+			page.Title = results[i].Title
+		}
+		passages = append(passages, websearch.SplitPassages(page, fetchCfg.PassageSize)...)
+	}
+
+	ranked, err := websearch.RankPassages(ctx, query, passages, s.embedder, maxPassages)
+	if err != nil {
+		s.logger.Warn("Failed to rank passages by embedding, using keyword ranking", zap.Error(err))
+		ranked, _ = websearch.RankPassages(ctx, query, passages, nil, maxPassages)
+	}
+	return ranked
+}
+
 func (s *WebSearchService) handleSearch(c *gin.Context) {
 	var req SearchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -267,9 +458,15 @@ func (s *WebSearchService) handleSearch(c *gin.Context) {
 		return
 	}
 
-	needsSearch := req.ForceSearch != nil && *req.ForceSearch
-	if !needsSearch {
-		needsSearch = s.detectFreshnessKeywords(req.Query)
+	freshness := s.detectFreshness(req.Query)
+	needsSearch := (req.ForceSearch != nil && *req.ForceSearch) || freshness.NeedsFreshInfo
+
+	var window websearch.TimeWindow
+	switch {
+	case req.TimeWindow != nil:
+		window = *req.TimeWindow
+	case freshness.TimeWindow != nil:
+		window = *freshness.TimeWindow
 	}
 
 	if !needsSearch {
@@ -285,7 +482,21 @@ func (s *WebSearchService) handleSearch(c *gin.Context) {
 		return
 	}
 
-	if cached, found := s.getCachedResult(req.Query); found {
+	if s.provider == nil {
+		s.logger.Debug("Web search requested but no provider is configured",
+			zap.String("query", req.Query),
+		)
+		c.JSON(http.StatusOK, SearchResponse{
+			Results:   []SearchResult{},
+			Source:    sourceSearchDisabled,
+			Timestamp: time.Now().Format(time.RFC3339),
+			Cached:    false,
+		})
+		return
+	}
+
+	fetchContent := s.shouldFetchContent(req)
+	if cached, found := s.getCachedResult(req.Query, window, fetchContent); found {
 		s.logger.Debug("Returning cached search result",
 			zap.String("query", req.Query),
 		)
@@ -296,35 +507,34 @@ func (s *WebSearchService) handleSearch(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), searchRequestTimeout)
 	defer cancel()
 
-	response, err := s.performSearch(ctx, req.Query)
+	response, err := s.performSearch(ctx, req.Query, window, fetchContent)
 	if err != nil {
+		// Serve an expired response rather than failing while the provider is down
+		if stale, found := s.getStaleResult(req.Query, window, fetchContent); found {
+			s.logger.Warn("Search failed, returning stale cached result",
+				zap.Error(err),
+				zap.String("query", req.Query))
+			c.JSON(http.StatusOK, stale)
+			return
+		}
 		s.logger.Error("Search failed", zap.Error(err), zap.String("query", req.Query))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search service temporarily unavailable"})
 		return
 	}
 
-	s.setCachedResult(req.Query, *response)
+	s.setCachedResult(req.Query, window, fetchContent, *response)
 	c.JSON(http.StatusOK, response)
 }
 
 // setupHealthChecks configures health checks for the websearch service
 func (s *WebSearchService) setupHealthChecks(manager *health.Manager) {
-	// OpenAI health check
-	manager.AddCheckerFunc("openai", func(ctx context.Context) health.CheckResult {
-		if s.openaiClient == nil {
-			return health.CheckResult{
-				Status:    health.StatusHealthy,
-				Timestamp: time.Now(),
-				Metadata: map[string]interface{}{
-					"test_mode": true,
-				},
-			}
-		}
-
-		if _, err := s.openaiClient.EmbedQuery(ctx, "health check"); err != nil {
+	// Search provider health check. Providers are not queried here to avoid spending
+	// API quota on health probes.
+	manager.AddCheckerFunc("provider", func(_ context.Context) health.CheckResult {
+		if s.provider == nil {
 			return health.CheckResult{
 				Status:    health.StatusDegraded,
-				Error:     fmt.Sprintf("OpenAI connectivity check failed: %v", err),
+				Error:     "no web search provider configured",
 				Timestamp: time.Now(),
 			}
 		}
@@ -333,23 +543,28 @@ func (s *WebSearchService) setupHealthChecks(manager *health.Manager) {
 			Status:    health.StatusHealthy,
 			Timestamp: time.Now(),
 			Metadata: map[string]interface{}{
-				"endpoint": "openai-api",
+				"provider":           s.provider.Name(),
+				"fetch_enabled":      s.config.WebSearch.Fetch.Enabled,
+				"embedding_passages": s.embedder != nil,
 			},
 		}
 	})
 
 	// Web search cache health check
 	manager.AddCheckerFunc("cache", func(_ context.Context) health.CheckResult {
-		s.cacheMutex.RLock()
-		cacheSize := len(s.cache)
-		s.cacheMutex.RUnlock()
+		storageType := s.config.WebSearch.Cache.StorageType
+		if storageType == "" {
+			storageType = "memory"
+		}
 
 		return health.CheckResult{
 			Status:    health.StatusHealthy,
 			Timestamp: time.Now(),
 			Metadata: map[string]interface{}{
-				"cache_size":    cacheSize,
-				"cache_timeout": searchCacheTimeout.String(),
+				"cache_size":        s.cache.Len(),
+				"storage_type":      storageType,
+				"cache_ttl":         s.cachePolicy.TTL.String(),
+				"release_cache_ttl": s.cachePolicy.ReleaseTTL.String(),
 			},
 		}
 	})
@@ -401,6 +616,19 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to create web search service", zap.Error(err))
 	}
+	defer func() { _ = service.cache.Close() }()
+
+	// Fetched passages are ranked by embedding similarity when OpenAI is available
+	// and by keyword overlap otherwise
+	if !testMode && cfg.OpenAI.APIKey != "" {
+		embeddingClient, err := openai.NewClientWithEndpoint(cfg.OpenAI.APIKey, cfg.OpenAI.Endpoint, logger,
+			resilience.DefaultTimeoutConfig())
+		if err != nil {
+			logger.Warn("Failed to create OpenAI client, passages will be ranked by keywords", zap.Error(err))
+		} else {
+			service.embedder = embeddingClient
+		}
+	}
 
 	router := gin.Default()
 
@@ -414,7 +642,8 @@ func main() {
 	logger.Info("Starting websearch service",
 		zap.Int("max_results", cfg.WebSearch.MaxResults),
 		zap.Int("freshness_keywords_count", len(cfg.WebSearch.FreshnessKeywords)),
-		zap.Duration("cache_timeout", searchCacheTimeout),
+		zap.String("cache_storage", cfg.WebSearch.Cache.StorageType),
+		zap.Duration("cache_ttl", service.cachePolicy.TTL),
 	)
 
 	if err := router.Run(":8083"); err != nil {
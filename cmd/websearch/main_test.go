@@ -29,6 +29,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/your-org/ai-sa-assistant/internal/config"
 	"github.com/your-org/ai-sa-assistant/internal/websearch"
+	"github.com/your-org/ai-sa-assistant/internal/websearch/websearchtest"
 	"go.uber.org/zap"
 )
 
@@ -70,13 +71,15 @@ func setupTestService() *WebSearchService {
 	}
 
 	logger := zap.NewNop()
-	detectionConfig := websearch.ConfigFromSlice(cfg.WebSearch.FreshnessKeywords)
+	detectionConfig := websearch.ConfigFromSliceWithClock(cfg.WebSearch.FreshnessKeywords,
+		func() time.Time { return time.Date(2025, time.June, 15, 0, 0, 0, 0, time.UTC) })
 
 	service := &WebSearchService{
 		config:          cfg,
 		logger:          logger,
-		openaiClient:    nil, // Will be mocked in tests
-		cache:           make(map[string]*CacheEntry),
+		provider:        nil, // Set per test against the fixture server
+		cache:           websearch.NewMemoryCache(100),
+		cachePolicy:     websearch.DefaultCachePolicy(),
 		detectionConfig: detectionConfig,
 	}
 
@@ -115,7 +118,7 @@ func TestDetectFreshnessKeywords(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := service.detectFreshnessKeywords(tt.query)
+			result := service.detectFreshness(tt.query).NeedsFreshInfo
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -140,19 +143,85 @@ func TestCaching(t *testing.T) {
 	}
 
 	// Test cache miss
-	cachedResponse, found := service.getCachedResult(query)
+	cachedResponse, found := service.getCachedResult(query, websearch.TimeWindow{}, false)
 	assert.False(t, found)
 	assert.Nil(t, cachedResponse)
 
 	// Set cache
-	service.setCachedResult(query, response)
+	service.setCachedResult(query, websearch.TimeWindow{}, false, response)
 
 	// Test cache hit
-	cachedResponse, found = service.getCachedResult(query)
+	cachedResponse, found = service.getCachedResult(query, websearch.TimeWindow{}, false)
 	assert.True(t, found)
 	assert.NotNil(t, cachedResponse)
 	assert.True(t, cachedResponse.Cached)
+	assert.False(t, cachedResponse.Stale)
 	assert.Equal(t, response.Results[0].Title, cachedResponse.Results[0].Title)
+
+	// Rephrasings that differ only in case, whitespace and stop words share the entry
+	_, found = service.getCachedResult("  What is the TEST query? ", websearch.TimeWindow{}, false)
+	assert.True(t, found)
+
+	// Responses with fetched passages are cached separately
+	_, found = service.getCachedResult(query, websearch.TimeWindow{}, true)
+	assert.False(t, found)
+}
+
+func TestHandleSearchServesStaleResultWhenProviderFails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fixtureServer := websearchtest.NewServer()
+	defer fixtureServer.Close()
+
+	cfg := &config.Config{
+		WebSearch: config.WebSearchConfig{
+			MaxResults:        2,
+			FreshnessKeywords: []string{"latest"},
+			Provider:          websearch.ProviderBrave,
+			APIKey:            "invalid-key", // pragma: allowlist secret
+			Endpoint:          fixtureServer.URL(websearch.ProviderBrave),
+			TimeoutSeconds:    5,
+		},
+	}
+	service, err := NewWebSearchService(cfg, zap.NewNop())
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/search", service.handleSearch)
+
+	search := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/search", bytes.NewBufferString(`{"query": "latest EKS release"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without a cached response the provider failure is reported
+	assert.Equal(t, http.StatusInternalServerError, search().Code)
+
+	// An expired response inside its stale window is served instead of an error
+	value, err := json.Marshal(SearchResponse{
+		Results: []SearchResult{{Title: "EKS release", URL: "https://aws.amazon.com/eks/"}},
+		Source:  websearch.ProviderBrave,
+	})
+	assert.NoError(t, err)
+	now := time.Now()
+	assert.NoError(t, service.cache.Set(cacheKey("latest EKS release", websearch.TimeWindow{}, false), websearch.CacheEntry{
+		Value:      value,
+		StoredAt:   now.Add(-time.Hour),
+		ExpiresAt:  now.Add(-time.Minute),
+		StaleUntil: now.Add(time.Hour),
+	}))
+
+	w := search()
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response SearchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Cached)
+	assert.True(t, response.Stale)
+	assert.Equal(t, "EKS release", response.Results[0].Title)
+	assert.Len(t, fixtureServer.Requests(), 2)
 }
 
 func TestHandleSearchEndpoint(t *testing.T) {
@@ -347,7 +416,7 @@ func TestForceSearchFlag(t *testing.T) {
 	// Should need search even without freshness keywords
 	needsSearch := req.ForceSearch != nil && *req.ForceSearch
 	if !needsSearch {
-		needsSearch = service.detectFreshnessKeywords(req.Query)
+		needsSearch = service.detectFreshness(req.Query).NeedsFreshInfo
 	}
 	assert.True(t, needsSearch)
 
@@ -356,7 +425,291 @@ func TestForceSearchFlag(t *testing.T) {
 	req.ForceSearch = &forceFalse
 	needsSearch = req.ForceSearch != nil && *req.ForceSearch
 	if !needsSearch {
-		needsSearch = service.detectFreshnessKeywords(req.Query)
+		needsSearch = service.detectFreshness(req.Query).NeedsFreshInfo
 	}
 	assert.False(t, needsSearch)
 }
+
+func TestHandleSearchWithProvider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fixtureServer := websearchtest.NewServer()
+	defer fixtureServer.Close()
+
+	cfg := &config.Config{
+		WebSearch: config.WebSearchConfig{
+			MaxResults:        2,
+			FreshnessKeywords: []string{"latest"},
+			Provider:          websearch.ProviderBrave,
+			APIKey:            websearchtest.APIKey,
+			Endpoint:          fixtureServer.URL(websearch.ProviderBrave),
+			TimeoutSeconds:    5,
+		},
+	}
+	service, err := NewWebSearchService(cfg, zap.NewNop())
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/search", service.handleSearch)
+
+	search := func() SearchResponse {
+		req, _ := http.NewRequest("POST", "/search", bytes.NewBufferString(`{"query": "latest EKS release"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response SearchResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	response := search()
+	assert.Equal(t, websearch.ProviderBrave, response.Source)
+	assert.False(t, response.Cached)
+	assert.Len(t, response.Results, 2)
+	assert.Equal(t, websearchtest.DefaultFixtures[0].URL, response.Results[0].URL)
+	assert.Equal(t, websearchtest.DefaultFixtures[0].Title, response.Results[0].Title)
+	assert.Equal(t, "2024-09-26", response.Results[0].Timestamp)
+
+	// The second identical query is served from the cache without calling the provider
+	cached := search()
+	assert.True(t, cached.Cached)
+	assert.Len(t, fixtureServer.Requests(), 1)
+}
+
+func TestHandleSearchWithoutProvider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	service := setupTestService()
+	router := gin.New()
+	router.POST("/search", service.handleSearch)
+
+	req, _ := http.NewRequest("POST", "/search", bytes.NewBufferString(`{"query": "latest EKS release"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), sourceSearchDisabled)
+	assert.NotContains(t, w.Body.String(), "https://")
+}
+
+func TestHandleSearchProviderFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fixtureServer := websearchtest.NewServer()
+	defer fixtureServer.Close()
+
+	provider, err := websearch.NewSearchProvider(websearch.ProviderConfig{
+		Provider: websearch.ProviderBing,
+		APIKey:   "wrong-key", // pragma: allowlist secret
+		Endpoint: fixtureServer.URL(websearch.ProviderBing),
+	}, fixtureServer.Client())
+	assert.NoError(t, err)
+
+	service := setupTestService()
+	service.provider = provider
+	router := gin.New()
+	router.POST("/search", service.handleSearch)
+
+	req, _ := http.NewRequest("POST", "/search", bytes.NewBufferString(`{"query": "latest EKS release"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "Search service temporarily unavailable")
+}
+
+func TestHandleSearchFetchesPassages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	pageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/eks":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><head><title>EKS news</title>
+				<meta property="article:published_time" content="2024-09-26T10:00:00Z"></head>
+				<body><nav><a href="/">Home</a></nav><article>
+				<p>Amazon EKS now supports Kubernetes 1.31 for new clusters and in-place upgrades.</p>
+				<p>Extended support pricing applies per cluster hour once standard support ends.</p>
+				</article></body></html>`))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><body><p>Kubernetes release notes that should never be fetched.</p></body></html>`))
+		}
+	}))
+	defer pageServer.Close()
+
+	fixtureServer := websearchtest.NewServer(
+		websearchtest.Fixture{Title: "EKS news", URL: pageServer.URL + "/eks", Snippet: "EKS supports 1.31"},
+		websearchtest.Fixture{Title: "Private", URL: pageServer.URL + "/private", Snippet: "Internal notes"},
+	)
+	defer fixtureServer.Close()
+
+	cfg := &config.Config{
+		WebSearch: config.WebSearchConfig{
+			MaxResults:        2,
+			FreshnessKeywords: []string{"latest"},
+			Provider:          websearch.ProviderBrave,
+			APIKey:            websearchtest.APIKey,
+			Endpoint:          fixtureServer.URL(websearch.ProviderBrave),
+			TimeoutSeconds:    5,
+			Fetch: config.WebFetchConfig{
+				Enabled:        true,
+				MaxPages:       2,
+				TimeoutSeconds: 2,
+				MaxPageBytes:   1 << 16,
+				RespectRobots:  true,
+				MaxPassages:    3,
+				PassageSize:    200,
+				// The page server listens on loopback
+				AllowPrivateNetworks: true,
+			},
+		},
+	}
+	service, err := NewWebSearchService(cfg, zap.NewNop())
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/search", service.handleSearch)
+
+	req, _ := http.NewRequest("POST", "/search",
+		bytes.NewBufferString(`{"query": "latest EKS Kubernetes release"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response SearchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Results, 2)
+	// The provider gave no date, so the page's published date is used
+	assert.Equal(t, "2024-09-26", response.Results[0].Timestamp)
+	assert.Empty(t, response.Results[1].Timestamp)
+
+	if assert.NotEmpty(t, response.Passages) {
+		for _, passage := range response.Passages {
+			assert.Equal(t, pageServer.URL+"/eks", passage.URL)
+			assert.Equal(t, "2024-09-26", passage.Published)
+			assert.NotContains(t, passage.Text, "Home")
+		}
+		assert.Contains(t, response.Passages[0].Text, "Kubernetes 1.31")
+	}
+}
+
+func TestHandleSearchAppliesDomainPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fixtureServer := websearchtest.NewServer()
+	defer fixtureServer.Close()
+
+	cfg := &config.Config{
+		WebSearch: config.WebSearchConfig{
+			MaxResults:        2,
+			FreshnessKeywords: []string{"latest"},
+			Provider:          websearch.ProviderSearxNG,
+			Endpoint:          fixtureServer.URL(websearch.ProviderSearxNG),
+			TimeoutSeconds:    5,
+			Domains: config.WebDomainPolicyConfig{
+				Deny:      []string{"aws.amazon.com"},
+				Preferred: []string{"cloud.google.com"},
+			},
+		},
+	}
+	service, err := NewWebSearchService(cfg, zap.NewNop())
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/search", service.handleSearch)
+
+	req, _ := http.NewRequest("POST", "/search", bytes.NewBufferString(`{"query": "latest Kubernetes release"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response SearchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.Len(t, response.Results, 2) {
+		assert.Equal(t, "cloud.google.com", response.Results[0].Domain)
+		assert.Equal(t, websearch.TrustPreferred, response.Results[0].Trust)
+		assert.Equal(t, "learn.microsoft.com", response.Results[1].Domain)
+		assert.Equal(t, websearch.TrustDefault, response.Results[1].Trust)
+	}
+	assert.NotContains(t, w.Body.String(), "aws.amazon.com")
+}
+
+func TestHandleSearchRestrictsResultsToTimeWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fixtureServer := websearchtest.NewServer()
+	defer fixtureServer.Close()
+
+	cfg := &config.Config{
+		WebSearch: config.WebSearchConfig{
+			MaxResults:        3,
+			FreshnessKeywords: []string{"latest"},
+			Provider:          websearch.ProviderSearxNG,
+			Endpoint:          fixtureServer.URL(websearch.ProviderSearxNG),
+			TimeoutSeconds:    5,
+		},
+	}
+	service, err := NewWebSearchService(cfg, zap.NewNop())
+	assert.NoError(t, err)
+	service.detectionConfig.Now = func() time.Time { return time.Date(2025, time.June, 15, 0, 0, 0, 0, time.UTC) }
+
+	router := gin.New()
+	router.POST("/search", service.handleSearch)
+
+	search := func(body string) SearchResponse {
+		req, _ := http.NewRequest("POST", "/search", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response SearchResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	// The quarter in the query becomes the window and the result dated before it is dropped
+	response := search(`{"query": "Kubernetes releases in Q4 2024"}`)
+	if assert.NotNil(t, response.TimeWindow) {
+		assert.Equal(t, time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC), response.TimeWindow.Start)
+		assert.Equal(t, time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), response.TimeWindow.End)
+	}
+	assert.Len(t, response.Results, 2)
+	for _, result := range response.Results {
+		assert.NotEqual(t, "2024-09-26", result.Timestamp)
+	}
+
+	// A window in the request overrides the detected one and is cached separately
+	response = search(`{"query": "Kubernetes releases in Q4 2024",
+		"time_window": {"start": "2024-09-01T00:00:00Z", "end": "2024-10-01T00:00:00Z"}}`)
+	assert.False(t, response.Cached)
+	assert.Len(t, response.Results, 2)
+	for _, result := range response.Results {
+		assert.NotEqual(t, "2024-10-01", result.Timestamp)
+	}
+}
+
+func TestShouldFetchContentOnlyLetsRequestsOptOut(t *testing.T) {
+	enabled, disabled := true, false
+	service := setupTestService()
+	service.fetcher = websearch.NewPageFetcher(websearch.FetchConfig{}, nil)
+
+	service.config.WebSearch.Fetch.Enabled = false
+	assert.False(t, service.shouldFetchContent(SearchRequest{}))
+	assert.False(t, service.shouldFetchContent(SearchRequest{FetchContent: &enabled}),
+		"a request must not enable fetching the operator disabled")
+
+	service.config.WebSearch.Fetch.Enabled = true
+	assert.True(t, service.shouldFetchContent(SearchRequest{}))
+	assert.True(t, service.shouldFetchContent(SearchRequest{FetchContent: &enabled}))
+	assert.False(t, service.shouldFetchContent(SearchRequest{FetchContent: &disabled}))
+}
@@ -25,9 +25,11 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/your-org/ai-sa-assistant/internal/acl"
 	"github.com/your-org/ai-sa-assistant/internal/config"
 	"github.com/your-org/ai-sa-assistant/internal/conversation"
 	"github.com/your-org/ai-sa-assistant/internal/diagram"
+	"github.com/your-org/ai-sa-assistant/internal/export"
 	"github.com/your-org/ai-sa-assistant/internal/health"
 	"github.com/your-org/ai-sa-assistant/internal/session"
 	"github.com/your-org/ai-sa-assistant/internal/streaming"
@@ -99,6 +101,7 @@ type WebUIServer struct {
 	conversationManager *conversation.Manager
 	healthManager       *health.Manager
 	streamManager       *streaming.StreamManager
+	exporter            *export.Exporter
 }
 
 func main() {
@@ -132,7 +135,10 @@ func main() {
 
 	// Initialize diagram renderer (required for orchestrator)
 	diagramConfig := diagram.RendererConfig{
+		Backend:        cfg.Diagram.Backend,
 		MermaidInkURL:  cfg.Diagram.MermaidInkURL,
+		PublicURL:      cfg.Diagram.PublicURL,
+		StorageDir:     cfg.Diagram.StorageDir,
 		Timeout:        time.Duration(cfg.Diagram.Timeout) * time.Second,
 		CacheExpiry:    time.Duration(cfg.Diagram.CacheExpiry) * time.Hour,
 		EnableCaching:  cfg.Diagram.EnableCaching,
@@ -170,6 +176,7 @@ func main() {
 		conversationManager: conversationManager,
 		healthManager:       healthManager,
 		streamManager:       streamManager,
+		exporter:            export.NewExporter(export.BrandingFromConfig(cfg.Export), diagramRenderer, logger),
 	}
 
 	// Set up Gin router
@@ -193,7 +200,9 @@ func main() {
 	router.PUT("/conversations/:id", server.handleUpdateConversation)
 	router.DELETE("/conversations/:id", server.handleDeleteConversation)
 	router.GET("/conversations/:id/export", server.handleExportConversation)
+	router.POST("/export", server.handleExportResponse)
 	router.POST("/conversations/import", server.handleImportConversation)
+	diagram.NewAssetHandler(diagramRenderer.Store(), logger).RegisterRoutes(router)
 
 	// Determine port
 	port := os.Getenv("PORT")
@@ -249,6 +258,7 @@ func (s *WebUIServer) handleChat(c *gin.Context) {
 	// Note: User message will be added by the orchestrator, no need to add it here to avoid duplicates
 
 	// Process message through orchestrator (which handles session management internally)
+	ctx = acl.WithIdentity(ctx, callerIdentity(c, s.config, sess.UserID))
 	result := s.orchestrator.ProcessQuery(ctx, req.Message, sess.UserID)
 	if result.Error != nil {
 		s.logger.Error("Failed to process query through orchestrator", zap.Error(result.Error))
@@ -282,9 +292,22 @@ func (s *WebUIServer) handleChat(c *gin.Context) {
 	if result.Response.DiagramURL != "" {
 		metadata["diagram_url"] = result.Response.DiagramURL
 	}
+	if len(result.Response.DiagramDownloads) > 0 {
+		metadata["diagram_downloads"] = result.Response.DiagramDownloads
+	}
 	if len(result.Response.CodeSnippets) > 0 {
 		metadata["code_snippets"] = result.Response.CodeSnippets
 	}
+	if result.Response.CostEstimate != nil {
+		metadata["cost_estimate"] = result.Response.CostEstimate
+	}
+	if result.Response.Comparison != nil {
+		metadata["comparison"] = result.Response.Comparison
+	}
+	// Pipeline decisions are shown only when untrusted content was flagged
+	if len(result.Response.PipelineDecision.InjectionDetections) > 0 {
+		metadata["pipeline_decision"] = result.Response.PipelineDecision
+	}
 	if len(result.Response.Sources) > 0 {
 		metadata["sources"] = result.Response.Sources
 	}
@@ -434,7 +457,8 @@ func (s *WebUIServer) handleDeleteConversation(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted"})
 }
 
-// handleExportConversation exports a conversation to JSON format
+// handleExportConversation exports a conversation to JSON format, or as a DOCX, PDF or
+// Markdown document when the format query parameter asks for one
 func (s *WebUIServer) handleExportConversation(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.Param("id")
@@ -447,6 +471,16 @@ func (s *WebUIServer) handleExportConversation(c *gin.Context) {
 		return
 	}
 
+	if format := c.DefaultQuery("format", "json"); format != "json" {
+		document, err := export.NewConversationDocument(sess)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Conversation has no answers to export"})
+			return
+		}
+		s.writeExport(c, document, format)
+		return
+	}
+
 	// Create export format
 	exportData := map[string]interface{}{
 		"id":            sess.ID,
@@ -470,6 +504,47 @@ func (s *WebUIServer) handleExportConversation(c *gin.Context) {
 	c.JSON(http.StatusOK, exportData)
 }
 
+// ExportRequest represents a request to export a single answer or plan
+type ExportRequest struct {
+	Query    string                  `json:"query"`
+	Response synth.SynthesisResponse `json:"response"`
+	Format   string                  `json:"format"`
+}
+
+// handleExportResponse exports a single answer or plan as a DOCX, PDF or Markdown document
+func (s *WebUIServer) handleExportResponse(c *gin.Context) {
+	var req ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if strings.TrimSpace(req.Response.MainText) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "response.main_text is required"})
+		return
+	}
+
+	s.writeExport(c, export.NewResponseDocument(req.Query, req.Response), req.Format)
+}
+
+// writeExport renders a document in the requested format and sends it as a download
+func (s *WebUIServer) writeExport(c *gin.Context, document *export.Document, format string) {
+	exportFormat, err := export.ParseFormat(format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of: docx, pdf, markdown, json"})
+		return
+	}
+
+	file, err := s.exporter.Export(c.Request.Context(), document, exportFormat)
+	if err != nil {
+		s.logger.Error("Failed to export document", zap.String("format", format), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export document"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+	c.Data(http.StatusOK, file.ContentType, file.Data)
+}
+
 // handleImportConversation imports a conversation from JSON format
 func (s *WebUIServer) handleImportConversation(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -541,6 +616,12 @@ func (s *WebUIServer) getOrCreateSession(ctx context.Context, id string) (*sessi
 	return s.sessionManager.CreateSession(ctx, s.getUserID(nil))
 }
 
+// callerIdentity builds the caller identity used for document access control from the
+// session user. Group and clearance headers are only honoured behind a trusted proxy.
+func callerIdentity(c *gin.Context, cfg *config.Config, userID string) acl.Identity {
+	return acl.CallerIdentity(c.Request.Header, userID, cfg.ACL.TrustedProxyHeaders)
+}
+
 // getUserID returns a user ID for session management (simplified for demo)
 func (s *WebUIServer) getUserID(_ *gin.Context) string {
 	// In a real application, this would extract user ID from authentication
@@ -580,6 +661,7 @@ func (s *WebUIServer) handleStreamingChat(c *gin.Context) {
 	// Create a completely independent context that is not derived from the HTTP request
 	// This ensures the background processing cannot be affected by HTTP connection state
 	independentCtx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	independentCtx = acl.WithIdentity(independentCtx, callerIdentity(c, s.config, sess.UserID))
 
 	// Start processing in a goroutine with completely isolated context
 	go func() {
@@ -612,8 +694,9 @@ func (s *WebUIServer) handleSSE(c *gin.Context) {
 	c.Header("Access-Control-Allow-Origin", "*")
 	c.Header("Access-Control-Allow-Headers", "Cache-Control")
 
-	// Create a channel to receive events
-	const eventChannelBuffer = 100
+	// Create a channel to receive events. Token events arrive one per generated delta, so
+	// the buffer is sized to absorb bursts while the client catches up.
+	const eventChannelBuffer = 1024
 	eventChan := make(chan streaming.Event, eventChannelBuffer)
 
 	// Add callback to stream
@@ -729,14 +812,21 @@ func (s *WebUIServer) processStreamingQuery(
 
 	// Emit completion with final response
 	executionTime := time.Since(startTime).Milliseconds()
+	response := map[string]interface{}{
+		"main_text":         result.Response.MainText,
+		"diagram_code":      result.Response.DiagramCode,
+		"diagram_url":       result.Response.DiagramURL,
+		"diagram_downloads": result.Response.DiagramDownloads,
+		"code_snippets":     result.Response.CodeSnippets,
+		"cost_estimate":     result.Response.CostEstimate,
+		"comparison":        result.Response.Comparison,
+		"sources":           result.Response.Sources,
+	}
+	if len(result.Response.PipelineDecision.InjectionDetections) > 0 {
+		response["pipeline_decision"] = result.Response.PipelineDecision
+	}
 	eventStream.EmitComplete("✅ Response complete!", map[string]interface{}{
-		"response": map[string]interface{}{
-			"main_text":     result.Response.MainText,
-			"diagram_code":  result.Response.DiagramCode,
-			"diagram_url":   result.Response.DiagramURL,
-			"code_snippets": result.Response.CodeSnippets,
-			"sources":       result.Response.Sources,
-		},
+		"response":          response,
 		"execution_time_ms": executionTime,
 		"services_used":     result.ServicesUsed,
 		"fallback_used":     result.FallbackUsed,
@@ -787,6 +877,8 @@ func (s *WebUIServer) storeAssistantResponse(ctx context.Context, sessionID stri
 		"web_sources":     []interface{}{}, // Will be populated if web sources are available
 		"diagram_code":    response.DiagramCode,
 		"code_snippets":   response.CodeSnippets,
+		// The full response lets the conversation be exported with its diagram and sources
+		export.MessageMetadataResponse: response,
 	}
 
 	// Store the assistant response
@@ -20,16 +20,20 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/your-org/ai-sa-assistant/internal/acl"
 	"github.com/your-org/ai-sa-assistant/internal/config"
 	"github.com/your-org/ai-sa-assistant/internal/conversation"
 	"github.com/your-org/ai-sa-assistant/internal/diagram"
+	"github.com/your-org/ai-sa-assistant/internal/export"
 	"github.com/your-org/ai-sa-assistant/internal/health"
 	"github.com/your-org/ai-sa-assistant/internal/session"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
 	"github.com/your-org/ai-sa-assistant/internal/teams"
 	"go.uber.org/zap"
 )
@@ -69,6 +73,7 @@ func setupTestServer() *WebUIServer {
 		sessionManager:      sessionManager,
 		conversationManager: conversationManager,
 		healthManager:       healthManager,
+		exporter:            export.NewExporter(export.Branding{}, nil, logger),
 	}
 }
 
@@ -182,6 +187,70 @@ func TestHandleGetConversation(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
+func TestHandleExportConversationFormats(t *testing.T) {
+	server := setupTestServer()
+	gin.SetMode(gin.TestMode)
+
+	conversation := createTestConversation(server)
+	ctx := context.Background()
+	assert.NoError(t, server.sessionManager.AddMessage(ctx, conversation.ID, session.UserRole, "Plan a migration to AWS", nil))
+	assert.NoError(t, server.storeAssistantResponse(ctx, conversation.ID, &synth.SynthesisResponse{
+		MainText:     "Use AWS MGN [aws-guide].",
+		DiagramCode:  "graph TD\n  A --> B",
+		CodeSnippets: []synth.CodeSnippet{{Language: "bash", Code: "aws mgn help"}},
+		Sources:      []string{"aws-guide"},
+	}))
+
+	router := gin.New()
+	router.GET("/conversations/:id/export", server.handleExportConversation)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/conversations/"+conversation.ID+"/export", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/conversations/"+conversation.ID+"/export?format=markdown", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".md")
+	for _, want := range []string{"Plan a migration to AWS", "```mermaid\ngraph TD", "```bash\naws mgn help", "[1] aws-guide"} {
+		assert.Contains(t, w.Body.String(), want)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/conversations/"+conversation.ID+"/export?format=pdf", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF")))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/conversations/"+conversation.ID+"/export?format=odt", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleExportResponse(t *testing.T) {
+	server := setupTestServer()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/export", server.handleExportResponse)
+
+	body, _ := json.Marshal(ExportRequest{
+		Query:    "Plan a migration to AWS",
+		Response: synth.SynthesisResponse{MainText: "# Migration Plan\n\nUse AWS MGN."},
+		Format:   "docx",
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/export", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, export.FormatDOCX.ContentType(), w.Header().Get("Content-Type"))
+	assert.True(t, strings.Contains(w.Header().Get("Content-Disposition"), "migration-plan-"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/export", strings.NewReader(`{"format":"pdf"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func TestHandleDeleteConversation(t *testing.T) {
 	server := setupTestServer()
 	gin.SetMode(gin.TestMode)
@@ -317,3 +386,27 @@ func generateConversationTitle(message string) string {
 	}
 	return message[:maxTitleLength-3] + "..."
 }
+
+func TestCallerIdentityIgnoresClientClearance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newContext := func() *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/chat", nil)
+		c.Request.Header.Set(acl.HeaderUserGroups, "acme-account-team")
+		c.Request.Header.Set(acl.HeaderUserClearance, "restricted")
+		return c
+	}
+
+	c := newContext()
+	identity := callerIdentity(c, &config.Config{}, "demo-user")
+	assert.Equal(t, "demo-user", identity.UserID)
+	assert.Empty(t, identity.Groups)
+	assert.Equal(t, acl.DefaultClassification, identity.Clearance)
+	assert.Empty(t, c.Request.Header.Get(acl.HeaderUserClearance))
+
+	trusted := &config.Config{ACL: config.ACLConfig{TrustedProxyHeaders: true}}
+	identity = callerIdentity(newContext(), trusted, "demo-user")
+	assert.Equal(t, acl.ClassificationRestricted, identity.Clearance)
+	assert.Equal(t, []string{"acme-account-team"}, identity.Groups)
+}
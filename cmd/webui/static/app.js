@@ -40,6 +40,8 @@ class ChatApp {
         this.sendBtn = document.getElementById('sendBtn');
         this.conversationTitle = document.getElementById('conversationTitle');
         this.clearChatBtn = document.getElementById('clearChatBtn');
+        this.exportFormat = document.getElementById('exportFormat');
+        this.exportBtn = document.getElementById('exportBtn');
         this.characterCount = document.getElementById('characterCount');
 
         // Loading and toast elements
@@ -61,6 +63,7 @@ class ChatApp {
         this.mobileMenuBtn.addEventListener('click', () => this.toggleSidebar());
         this.sidebarOverlay.addEventListener('click', () => this.closeSidebar());
         this.clearChatBtn.addEventListener('click', () => this.clearCurrentConversation());
+        this.exportBtn.addEventListener('click', () => this.exportCurrentConversation());
 
         // Example question buttons
         document.addEventListener('click', e => {
@@ -293,8 +296,11 @@ class ChatApp {
         // Enhanced text formatting with basic markdown support
         let formattedContent = content;
 
-        // Parse markdown to HTML if marked is available
-        if (typeof marked !== 'undefined') {
+        // A comparison is shown as its own table, with each column's citations
+        if (metadata && metadata.comparison) {
+            formattedContent = this.renderComparison(metadata.comparison);
+        } else if (typeof marked !== 'undefined') {
+            // Parse markdown to HTML
             console.log('Using marked for markdown parsing');
             try {
                 marked.setOptions({
@@ -329,7 +335,7 @@ class ChatApp {
             if (metadata.diagram_code) {
                 console.log('Found diagram_code, rendering diagram:', metadata.diagram_code?.slice(0, 100));
                 try {
-                    const diagramHtml = this.renderMermaidDiagram(metadata.diagram_code, metadata.diagram_url);
+                    const diagramHtml = this.renderMermaidDiagram(metadata.diagram_code, metadata.diagram_url, metadata.diagram_downloads);
                     formattedContent = this.insertContentIntelligently(formattedContent, diagramHtml, ['Architecture Diagram', 'Diagram', 'Architecture']);
                     console.log('Diagram rendered successfully');
                 } catch (error) {
@@ -345,7 +351,7 @@ class ChatApp {
                 try {
                     metadata.code_snippets.forEach((snippet, index) => {
                         console.log(`Rendering code snippet ${index}:`, snippet.language);
-                        const codeHtml = this.renderCodeBlock(snippet.code, snippet.language);
+                        const codeHtml = this.renderCodeBlock(snippet.code, snippet.language, snippet.findings);
                         
                         // Different placement strategies based on language
                         let searchTerms = ['Code', 'Implementation', 'Example'];
@@ -364,6 +370,12 @@ class ChatApp {
             } else {
                 console.log('No code snippets in metadata');
             }
+
+            // Add the cost table priced from the price list
+            if (metadata.cost_estimate && metadata.cost_estimate.lines && metadata.cost_estimate.lines.length > 0) {
+                const costHtml = this.renderCostEstimate(metadata.cost_estimate);
+                formattedContent = this.insertContentIntelligently(formattedContent, costHtml, ['Cost', 'Pricing', 'Budget']);
+            }
         } else {
             console.log('No metadata provided');
         }
@@ -514,11 +526,21 @@ class ChatApp {
             return '';
         }
 
+        let routing = '';
+        if (stats.model_routing_reason) {
+            routing = `<div class="routing-info">Routing: ${this.escapeHtml(stats.model_routing_reason.replace(/_/g, ' '))}`;
+            if (stats.model_fallbacks && stats.model_fallbacks.length > 0) {
+                routing += ` (unavailable: ${stats.model_fallbacks.map(model => this.escapeHtml(model)).join(', ')})`;
+            }
+            routing += '</div>';
+        }
+
         return `
             <div class="llm-synthesis">
                 <h5>🤖 LLM Synthesis</h5>
                 <div class="synthesis-info">
                     <div class="model-info">Model: ${this.escapeHtml(stats.model_used)}</div>
+                    ${routing}
                     <div class="token-info">Tokens: ${stats.input_tokens || 0} input / ${stats.output_tokens || 0} output</div>
                     <div class="temp-info">Temperature: ${stats.temperature || 0}</div>
                 </div>
@@ -561,6 +583,13 @@ class ChatApp {
             html += `<div class="reasoning">Reasoning: ${this.escapeHtml(pipeline.reasoning)}</div>`;
         }
 
+        if (pipeline.injection_detections && pipeline.injection_detections.length > 0) {
+            const detections = pipeline.injection_detections
+                .map(detection => `<li>${this.escapeHtml(detection.source_id)}: ${this.escapeHtml(detection.action)} (score ${Number(detection.score).toFixed(2)})</li>`)
+                .join('');
+            html += `<div class="injection">🛡️ Suspected prompt injection in sources<ul>${detections}</ul></div>`;
+        }
+
         html += `
                 </div>
             </div>
@@ -673,7 +702,7 @@ class ChatApp {
         return mermaidKeywords.some(keyword => code.includes(keyword));
     }
 
-    renderMermaidDiagram(mermaidCode, diagramUrl) {
+    renderMermaidDiagram(mermaidCode, diagramUrl, diagramDownloads) {
         const diagramId = `diagram-${Date.now()}-${Math.random().toString(36).substr(2, 9)}`;
 
         // Create container with loading state
@@ -688,6 +717,7 @@ class ChatApp {
                         <button class="diagram-btn copy-btn" title="Copy Diagram Code" onclick="chatApp.copyDiagramCode('${diagramId}')">
                             📋
                         </button>
+                        ${this.renderDiagramDownloads(diagramDownloads)}
                     </div>
                 </div>
                 <div class="diagram-content" id="${diagramId}">
@@ -706,6 +736,25 @@ class ChatApp {
         return container;
     }
 
+    renderDiagramDownloads(diagramDownloads) {
+        if (!diagramDownloads) {
+            return '';
+        }
+
+        // Editable versions of the diagram with cloud icons, in the order they are offered
+        const formats = [
+            { key: 'drawio', title: 'draw.io' },
+            { key: 'd2', title: 'D2' },
+            { key: 'plantuml', title: 'PlantUML' }
+        ];
+        return formats
+            .filter(format => diagramDownloads[format.key])
+            .map(format => `
+                        <a class="diagram-btn download-btn" href="${this.escapeHtml(diagramDownloads[format.key])}" download
+                           title="Download as ${format.title}">⬇️ ${format.title}</a>`)
+            .join('');
+    }
+
     async renderMermaidAsync(diagramId, mermaidCode, diagramUrl) {
         try {
             // Initialize mermaid if not already done
@@ -783,7 +832,7 @@ class ChatApp {
         element.innerHTML = fallbackContent;
     }
 
-    renderCodeBlock(code, language) {
+    renderCodeBlock(code, language, findings = []) {
         const codeId = `code-${Date.now()}-${Math.random().toString(36).substr(2, 9)}`;
         const displayLang = language || 'text';
 
@@ -798,6 +847,7 @@ class ChatApp {
                     </div>
                 </div>
                 <pre class="code-block"><code id="${codeId}" class="language-${language || 'text'}">${this.escapeHtml(code)}</code></pre>
+                ${this.renderCodeFindings(findings)}
             </div>
         `;
 
@@ -807,6 +857,102 @@ class ChatApp {
         return container;
     }
 
+    // Lists the validation findings of a generated snippet under its code
+    renderCodeFindings(findings) {
+        if (!findings || findings.length === 0) {
+            return '';
+        }
+
+        const items = findings.map(finding => {
+            const severity = finding.severity === 'error' ? 'error' : 'warning';
+            const line = finding.line ? `<span class="code-finding-line">line ${finding.line}</span>` : '';
+            return `<li class="code-finding code-finding-${severity}" title="${this.escapeHtml(finding.rule)}">${line}${this.escapeHtml(finding.message)}</li>`;
+        }).join('');
+
+        return `<ul class="code-findings">${items}</ul>`;
+    }
+
+    // Shows a cost estimate as a table of its line items and totals with its assumptions
+    renderCostEstimate(estimate) {
+        const money = amount => '$' + Number(amount).toLocaleString('en-US', { minimumFractionDigits: 2, maximumFractionDigits: 2 });
+        const rows = estimate.lines.map(line => `
+            <tr>
+                <td title="${this.escapeHtml(line.sku)}">${this.escapeHtml(line.description)}</td>
+                <td>${Number(line.quantity).toLocaleString('en-US')} ${this.escapeHtml(line.unit)}</td>
+                <td class="cost-amount">${money(line.monthly)}</td>
+                <td class="cost-amount">${money(line.annual)}</td>
+            </tr>`).join('');
+        const assumptions = (estimate.assumptions || [])
+            .map(assumption => `<li>${this.escapeHtml(assumption)}</li>`).join('');
+
+        return `
+            <div class="cost-estimate">
+                <table class="cost-table">
+                    <thead><tr><th>Item</th><th>Quantity</th><th>Monthly</th><th>Annual</th></tr></thead>
+                    <tbody>${rows}</tbody>
+                    <tfoot><tr><th colspan="2">Total (${this.escapeHtml(estimate.currency)})</th>
+                        <th class="cost-amount">${money(estimate.monthly_total)}</th>
+                        <th class="cost-amount">${money(estimate.annual_total)}</th></tr></tfoot>
+                </table>
+                <details class="cost-assumptions">
+                    <summary>Assumptions</summary>
+                    <ul>${assumptions}</ul>
+                </details>
+            </div>
+        `;
+    }
+
+    // Shows a comparison as a table with a row per dimension and a column per platform,
+    // ending with the sources each column cites, followed by the recommendation
+    renderComparison(comparison) {
+        const money = amount => '$' + Number(amount).toLocaleString('en-US', { minimumFractionDigits: 2, maximumFractionDigits: 2 });
+        const platforms = comparison.platforms || [];
+        const citations = list => (list || [])
+            .map(citation => ` <span class="comparison-citation">[${this.escapeHtml(citation)}]</span>`).join('');
+
+        const header = platforms.map(platform => `<th>${this.escapeHtml(platform.name)}</th>`).join('');
+        const rows = (comparison.dimensions || []).map(dimension => `
+            <tr>
+                <th scope="row">${this.escapeHtml(dimension.title)}</th>
+                ${(dimension.cells || []).map(cell => `<td>${this.escapeHtml(cell.text)}${citations(cell.citations)}</td>`).join('')}
+            </tr>`).join('');
+
+        let costRow = '';
+        if (platforms.some(platform => platform.cost_estimate)) {
+            const costs = platforms.map(platform => {
+                const estimate = platform.cost_estimate;
+                if (!estimate) {
+                    return '<td>n/a</td>';
+                }
+                return `<td>${money(estimate.monthly_total)}/month
+                    <span class="comparison-note">price list ${this.escapeHtml(estimate.price_list_version)}, ${this.escapeHtml(estimate.region)}</span></td>`;
+            }).join('');
+            costRow = `<tr><th scope="row">Estimated monthly cost</th>${costs}</tr>`;
+        }
+
+        const sources = platforms.map(platform => {
+            const list = (platform.sources || []).map(source => `<li>${this.escapeHtml(source)}</li>`).join('');
+            return `<td>${list ? `<ul class="comparison-sources">${list}</ul>` : 'None'}</td>`;
+        }).join('');
+
+        const recommendation = comparison.recommendation
+            ? `<p class="comparison-recommendation"><strong>Recommendation:</strong> ${this.escapeHtml(comparison.recommendation)}</p>`
+            : '';
+
+        return `
+            <div class="comparison">
+                <h2>${this.escapeHtml(comparison.title)}</h2>
+                <p>${this.escapeHtml(comparison.summary || '')}</p>
+                <table class="comparison-table">
+                    <thead><tr><th>Dimension</th>${header}</tr></thead>
+                    <tbody>${rows}${costRow}</tbody>
+                    <tfoot><tr><th scope="row">Sources</th>${sources}</tr></tfoot>
+                </table>
+                ${recommendation}
+            </div>
+        `;
+    }
+
     async highlightCodeAsync(codeId) {
         try {
             const element = document.getElementById(codeId);
@@ -1099,6 +1245,43 @@ class ChatApp {
         }
     }
 
+    async exportCurrentConversation() {
+        if (!this.currentConversationId) {
+            this.showToast('Start a conversation before exporting', 'info');
+            return;
+        }
+
+        const format = this.exportFormat.value;
+        try {
+            const response = await fetch(
+                `/conversations/${encodeURIComponent(this.currentConversationId)}/export?format=${encodeURIComponent(format)}`
+            );
+            if (!response.ok) {
+                const data = await response.json().catch(() => ({}));
+                this.showToast(data.error || 'Failed to export conversation', 'error');
+                return;
+            }
+
+            const disposition = response.headers.get('Content-Disposition') || '';
+            const match = disposition.match(/filename="?([^";]+)"?/);
+            const filename = match ? match[1] : `conversation.${format === 'markdown' ? 'md' : format}`;
+
+            const url = URL.createObjectURL(await response.blob());
+            const link = document.createElement('a');
+            link.href = url;
+            link.download = filename;
+            document.body.appendChild(link);
+            link.click();
+            link.remove();
+            URL.revokeObjectURL(url);
+
+            this.showToast('Conversation exported', 'success');
+        } catch (error) {
+            console.error('Failed to export conversation:', error);
+            this.showToast('Failed to export conversation', 'error');
+        }
+    }
+
     setActiveConversation(conversationId) {
         // Remove active class from all items
         document.querySelectorAll('.conversation-item').forEach(item => {
@@ -1617,6 +1800,7 @@ class ChatApp {
 
         this.messagesContainer.appendChild(progressElement);
         this.streamingProgressElement = progressElement;
+        this.streamTokenIndex = 0;
         this.scrollToBottom();
 
         // Start timer
@@ -1767,6 +1951,14 @@ class ChatApp {
                 this.handleStreamError(message);
                 break;
 
+            case 'token':
+                this.appendStreamToken(data || {});
+                break;
+
+            case 'replace':
+                this.replaceStreamAnswer(data || {});
+                break;
+
             case 'complete':
                 this.handleStreamComplete(data);
                 break;
@@ -1780,6 +1972,44 @@ class ChatApp {
         }
     }
 
+    appendStreamToken(data) {
+        if (!this.streamingProgressElement || typeof data.delta !== 'string') {
+            return;
+        }
+
+        // Replayed events can repeat tokens already shown
+        if (typeof data.index === 'number') {
+            if (data.index < this.streamTokenIndex) {
+                return;
+            }
+            this.streamTokenIndex = data.index + 1;
+        }
+
+        let answerElement = this.streamingProgressElement.querySelector('.streaming-answer');
+        if (!answerElement) {
+            answerElement = document.createElement('div');
+            answerElement.className = 'streaming-answer';
+            this.streamingProgressElement.querySelector('.message-bubble').appendChild(answerElement);
+        }
+
+        // Shown as plain text until the complete event delivers the formatted answer
+        answerElement.textContent += data.delta;
+        this.scrollToBottom();
+    }
+
+    replaceStreamAnswer(data) {
+        if (!this.streamingProgressElement || typeof data.text !== 'string') {
+            return;
+        }
+
+        // The final answer has had unverified citations stripped and grounding
+        // policies applied, so it must replace the text assembled from tokens
+        const answerElement = this.streamingProgressElement.querySelector('.streaming-answer');
+        if (answerElement) {
+            answerElement.textContent = data.text;
+        }
+    }
+
     handleStreamComplete(data = {}) {
         console.log('=== handleStreamComplete called ===');
         console.log('Data received:', data);
@@ -1817,7 +2047,11 @@ class ChatApp {
                     fallback_used: data.fallback_used,
                     diagram_code: data.response.diagram_code,
                     diagram_url: data.response.diagram_url,
-                    code_snippets: data.response.code_snippets || []
+                    diagram_downloads: data.response.diagram_downloads,
+                    code_snippets: data.response.code_snippets || [],
+                    cost_estimate: data.response.cost_estimate,
+                    comparison: data.response.comparison,
+                    pipeline_decision: data.response.pipeline_decision
                 }
             };
 
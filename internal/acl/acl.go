@@ -0,0 +1,214 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package acl provides document-level access control for the AI SA Assistant.
+// It defines caller identities, classification levels and the policy check used
+// to decide whether a caller may see a document during retrieval.
+package acl
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Classification represents the sensitivity level of a document
+type Classification string
+
+const (
+	// ClassificationPublic marks documents that anyone may read
+	ClassificationPublic Classification = "public"
+	// ClassificationInternal marks documents readable by any authenticated employee
+	ClassificationInternal Classification = "internal"
+	// ClassificationConfidential marks documents limited to callers with confidential clearance
+	ClassificationConfidential Classification = "confidential"
+	// ClassificationRestricted marks documents limited to callers with restricted clearance
+	ClassificationRestricted Classification = "restricted"
+
+	// DefaultClassification is applied to documents and callers without an explicit level
+	DefaultClassification = ClassificationInternal
+)
+
+const (
+	// HeaderUserID carries the caller's user ID between services
+	HeaderUserID = "X-User-ID"
+	// HeaderUserGroups carries the caller's comma-separated group memberships
+	HeaderUserGroups = "X-User-Groups"
+	// HeaderUserClearance carries the caller's highest classification clearance
+	HeaderUserClearance = "X-User-Clearance"
+)
+
+var classificationRanks = map[Classification]int{
+	ClassificationPublic:       0,
+	ClassificationInternal:     1,
+	ClassificationConfidential: 2,
+	ClassificationRestricted:   3,
+}
+
+// ParseClassification normalizes a classification string, returning
+// DefaultClassification for empty or unknown values
+func ParseClassification(value string) Classification {
+	classification := Classification(strings.ToLower(strings.TrimSpace(value)))
+	if _, ok := classificationRanks[classification]; !ok {
+		return DefaultClassification
+	}
+	return classification
+}
+
+// IsValidClassification reports whether value names a known classification level
+func IsValidClassification(value string) bool {
+	_, ok := classificationRanks[Classification(strings.ToLower(strings.TrimSpace(value)))]
+	return ok
+}
+
+// Rank returns the ordinal of the classification, higher being more sensitive
+func (c Classification) Rank() int {
+	return classificationRanks[ParseClassification(string(c))]
+}
+
+// Identity describes the caller on whose behalf a retrieval is performed
+type Identity struct {
+	UserID    string         `json:"user_id,omitempty"`
+	Groups    []string       `json:"groups,omitempty"`
+	Clearance Classification `json:"clearance,omitempty"`
+}
+
+// Policy describes who may access a document
+type Policy struct {
+	AllowedUsers   []string
+	AllowedGroups  []string
+	Classification Classification
+}
+
+// Allows reports whether the identity satisfies the policy. The caller's clearance
+// must cover the document classification and, when the document lists allowed users
+// or groups, the caller must match at least one of them.
+func (p Policy) Allows(identity Identity) bool {
+	if ParseClassification(string(p.Classification)).Rank() > ParseClassification(string(identity.Clearance)).Rank() {
+		return false
+	}
+
+	if len(p.AllowedUsers) == 0 && len(p.AllowedGroups) == 0 {
+		return true
+	}
+
+	if identity.UserID != "" {
+		for _, user := range p.AllowedUsers {
+			if strings.EqualFold(user, identity.UserID) {
+				return true
+			}
+		}
+	}
+
+	for _, group := range p.AllowedGroups {
+		for _, callerGroup := range identity.Groups {
+			if strings.EqualFold(group, callerGroup) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IsRestricted reports whether the policy limits access beyond the default classification
+func (p Policy) IsRestricted() bool {
+	return len(p.AllowedUsers) > 0 || len(p.AllowedGroups) > 0 ||
+		ParseClassification(string(p.Classification)).Rank() > DefaultClassification.Rank()
+}
+
+// FromHeaders builds an identity from the inter-service identity headers
+func FromHeaders(header http.Header) Identity {
+	return Identity{
+		UserID:    strings.TrimSpace(header.Get(HeaderUserID)),
+		Groups:    SplitList(header.Get(HeaderUserGroups)),
+		Clearance: ParseClassification(header.Get(HeaderUserClearance)),
+	}
+}
+
+// CallerIdentity builds the identity of an end user calling a front-end service. The
+// user ID comes from the authenticated session or chat activity. Group and clearance
+// headers are only honoured when trustHeaders is set because an authenticating proxy
+// in front of the service sets them; otherwise they are stripped from the request and
+// the caller gets no groups and the default clearance.
+func CallerIdentity(header http.Header, userID string, trustHeaders bool) Identity {
+	if trustHeaders {
+		identity := FromHeaders(header)
+		identity.UserID = userID
+		return identity
+	}
+
+	StripHeaders(header)
+	return Identity{UserID: userID, Clearance: DefaultClassification}
+}
+
+// ForwardedIdentity builds the identity a front-end service forwarded to a back-end
+// service. Every identity header, including the user ID, is only honoured when
+// trustHeaders is set because the callers are trusted services; otherwise the headers are
+// stripped and the caller is anonymous with the default clearance.
+func ForwardedIdentity(header http.Header, trustHeaders bool) Identity {
+	if trustHeaders {
+		return FromHeaders(header)
+	}
+
+	header.Del(HeaderUserID)
+	StripHeaders(header)
+	return Identity{Clearance: DefaultClassification}
+}
+
+// StripHeaders removes caller-supplied group and clearance headers from a request
+func StripHeaders(header http.Header) {
+	header.Del(HeaderUserGroups)
+	header.Del(HeaderUserClearance)
+}
+
+// ApplyHeaders writes the identity onto outgoing request headers
+func (i Identity) ApplyHeaders(header http.Header) {
+	if i.UserID != "" {
+		header.Set(HeaderUserID, i.UserID)
+	}
+	if len(i.Groups) > 0 {
+		header.Set(HeaderUserGroups, strings.Join(i.Groups, ","))
+	}
+	if i.Clearance != "" {
+		header.Set(HeaderUserClearance, string(ParseClassification(string(i.Clearance))))
+	}
+}
+
+// SplitList splits a comma-separated list, dropping empty entries
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+type identityContextKey struct{}
+
+// WithIdentity returns a context carrying the caller identity
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// FromContext returns the caller identity stored in the context, if any
+func FromContext(ctx context.Context) (Identity, bool) {
+	if ctx == nil {
+		return Identity{}, false
+	}
+	identity, ok := ctx.Value(identityContextKey{}).(Identity)
+	return identity, ok
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClassification(t *testing.T) {
+	assert.Equal(t, ClassificationConfidential, ParseClassification(" Confidential "))
+	assert.Equal(t, ClassificationPublic, ParseClassification("public"))
+	assert.Equal(t, DefaultClassification, ParseClassification(""))
+	assert.Equal(t, DefaultClassification, ParseClassification("top-secret"))
+	assert.True(t, IsValidClassification("restricted"))
+	assert.False(t, IsValidClassification("top-secret"))
+	assert.Less(t, ClassificationInternal.Rank(), ClassificationRestricted.Rank())
+}
+
+func TestPolicyAllows(t *testing.T) {
+	accountTeam := Identity{UserID: "alice@example.com", Groups: []string{"acme-account-team"},
+		Clearance: ClassificationConfidential}
+	otherUser := Identity{UserID: "bob@example.com", Groups: []string{"sa-team"}}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		identity Identity
+		expected bool
+	}{
+		{
+			name:     "unrestricted document is visible to anonymous callers",
+			policy:   Policy{},
+			identity: Identity{},
+			expected: true,
+		},
+		{
+			name:     "group member can read group document",
+			policy:   Policy{AllowedGroups: []string{"ACME-Account-Team"}, Classification: ClassificationConfidential},
+			identity: accountTeam,
+			expected: true,
+		},
+		{
+			name:     "non-member cannot read group document",
+			policy:   Policy{AllowedGroups: []string{"acme-account-team"}},
+			identity: otherUser,
+			expected: false,
+		},
+		{
+			name:     "explicit user is allowed",
+			policy:   Policy{AllowedUsers: []string{"bob@example.com"}},
+			identity: otherUser,
+			expected: true,
+		},
+		{
+			name:     "clearance below classification is denied",
+			policy:   Policy{AllowedUsers: []string{"bob@example.com"}, Classification: ClassificationConfidential},
+			identity: otherUser,
+			expected: false,
+		},
+		{
+			name:     "restricted document needs restricted clearance",
+			policy:   Policy{Classification: ClassificationRestricted},
+			identity: accountTeam,
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.policy.Allows(tt.identity))
+		})
+	}
+}
+
+func TestPolicyIsRestricted(t *testing.T) {
+	assert.False(t, Policy{}.IsRestricted())
+	assert.False(t, Policy{Classification: ClassificationPublic}.IsRestricted())
+	assert.True(t, Policy{Classification: ClassificationConfidential}.IsRestricted())
+	assert.True(t, Policy{AllowedGroups: []string{"team"}}.IsRestricted())
+}
+
+func TestIdentityHeadersRoundTrip(t *testing.T) {
+	identity := Identity{UserID: "alice", Groups: []string{"sa-team", "acme"}, Clearance: ClassificationRestricted}
+
+	header := http.Header{}
+	identity.ApplyHeaders(header)
+	assert.Equal(t, "sa-team,acme", header.Get(HeaderUserGroups))
+	assert.Equal(t, identity, FromHeaders(header))
+
+	anonymous := FromHeaders(http.Header{})
+	assert.Empty(t, anonymous.UserID)
+	assert.Empty(t, anonymous.Groups)
+	assert.Equal(t, DefaultClassification, anonymous.Clearance)
+}
+
+func TestCallerIdentity(t *testing.T) {
+	newHeader := func() http.Header {
+		header := http.Header{}
+		header.Set(HeaderUserGroups, "acme-account-team")
+		header.Set(HeaderUserClearance, "restricted")
+		return header
+	}
+
+	// Caller-supplied headers must not raise clearance without a trusted proxy
+	header := newHeader()
+	identity := CallerIdentity(header, "alice", false)
+	assert.Equal(t, "alice", identity.UserID)
+	assert.Empty(t, identity.Groups)
+	assert.Equal(t, DefaultClassification, identity.Clearance)
+	assert.False(t, Policy{Classification: ClassificationRestricted}.Allows(identity))
+	assert.Empty(t, header.Get(HeaderUserGroups))
+	assert.Empty(t, header.Get(HeaderUserClearance))
+
+	// Behind a trusted proxy the headers carry the caller's groups and clearance
+	identity = CallerIdentity(newHeader(), "alice", true)
+	assert.Equal(t, []string{"acme-account-team"}, identity.Groups)
+	assert.Equal(t, ClassificationRestricted, identity.Clearance)
+}
+
+func TestForwardedIdentity(t *testing.T) {
+	newHeader := func() http.Header {
+		header := http.Header{}
+		header.Set(HeaderUserID, "alice")
+		header.Set(HeaderUserGroups, "acme-account-team")
+		header.Set(HeaderUserClearance, "restricted")
+		return header
+	}
+
+	// An untrusted caller cannot claim another user's identity
+	header := newHeader()
+	identity := ForwardedIdentity(header, false)
+	assert.Equal(t, Identity{Clearance: DefaultClassification}, identity)
+	assert.False(t, Policy{AllowedUsers: []string{"alice"}}.Allows(identity))
+	assert.Empty(t, header.Get(HeaderUserID))
+	assert.Empty(t, header.Get(HeaderUserGroups))
+
+	identity = ForwardedIdentity(newHeader(), true)
+	assert.Equal(t, "alice", identity.UserID)
+	assert.Equal(t, []string{"acme-account-team"}, identity.Groups)
+	assert.Equal(t, ClassificationRestricted, identity.Clearance)
+}
+
+func TestIdentityContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	ctx := WithIdentity(context.Background(), Identity{UserID: "alice"})
+	identity, ok := FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", identity.UserID)
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, SplitList(" a, ,b ,"))
+	assert.Nil(t, SplitList(""))
+}
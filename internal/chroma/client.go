@@ -302,22 +302,41 @@ func (c *Client) AddDocuments(ctx context.Context, documents []Document, embeddi
 	}, "AddDocuments")
 }
 
+// SearchOptions narrows a vector search to a set of documents
+type SearchOptions struct {
+	// DocIDs restricts results to these documents when non-empty
+	DocIDs []string
+	// ExcludeDocIDs removes these documents from the results, e.g. for access control
+	ExcludeDocIDs []string
+}
+
 // Search performs a vector search in ChromaDB
 func (c *Client) Search(
 	ctx context.Context,
 	queryEmbedding []float32,
 	nResults int,
 	docIDs []string,
+) ([]SearchResult, error) {
+	return c.SearchWithOptions(ctx, queryEmbedding, nResults, SearchOptions{DocIDs: docIDs})
+}
+
+// SearchWithOptions performs a vector search in ChromaDB with inclusion and exclusion filters
+func (c *Client) SearchWithOptions(
+	ctx context.Context,
+	queryEmbedding []float32,
+	nResults int,
+	opts SearchOptions,
 ) ([]SearchResult, error) {
 	c.logger.Info("Performing vector search",
 		zap.String("collection", c.collection),
 		zap.Int("n_results", nResults),
-		zap.Int("doc_id_filter_count", len(docIDs)))
+		zap.Int("doc_id_filter_count", len(opts.DocIDs)),
+		zap.Int("doc_id_exclude_count", len(opts.ExcludeDocIDs)))
 
 	var results []SearchResult
 	err := c.executeWithResilience(ctx, func(ctx context.Context) error {
 		// Build search request
-		searchReq := c.buildSearchRequest(queryEmbedding, nResults, docIDs)
+		searchReq := c.buildSearchRequestWithOptions(queryEmbedding, nResults, opts)
 
 		// Execute search request
 		searchResp, err := c.executeSearchRequest(ctx, searchReq)
@@ -340,17 +359,40 @@ func (c *Client) Search(
 
 // buildSearchRequest creates a search request with optional document ID filtering
 func (c *Client) buildSearchRequest(queryEmbedding []float32, nResults int, docIDs []string) SearchRequest {
+	return c.buildSearchRequestWithOptions(queryEmbedding, nResults, SearchOptions{DocIDs: docIDs})
+}
+
+// buildSearchRequestWithOptions creates a search request with optional inclusion and exclusion filters
+func (c *Client) buildSearchRequestWithOptions(queryEmbedding []float32, nResults int, opts SearchOptions) SearchRequest {
 	searchReq := SearchRequest{
 		QueryEmbeddings: [][]float32{queryEmbedding},
 		NResults:        nResults,
 	}
 
-	// Add document ID filter if provided
-	if len(docIDs) > 0 {
-		searchReq.Where = map[string]interface{}{
+	var conditions []map[string]interface{}
+	if len(opts.DocIDs) > 0 {
+		conditions = append(conditions, map[string]interface{}{
+			"doc_id": map[string]interface{}{
+				"$in": opts.DocIDs,
+			},
+		})
+	}
+	if len(opts.ExcludeDocIDs) > 0 {
+		conditions = append(conditions, map[string]interface{}{
 			"doc_id": map[string]interface{}{
-				"$in": docIDs,
+				"$nin": opts.ExcludeDocIDs,
 			},
+		})
+	}
+
+	// ChromaDB requires $and when combining more than one condition
+	switch len(conditions) {
+	case 0:
+	case 1:
+		searchReq.Where = conditions[0]
+	default:
+		searchReq.Where = map[string]interface{}{
+			"$and": conditions,
 		}
 	}
 
@@ -907,6 +907,32 @@ func TestSearchHelperFunctions(t *testing.T) {
 		assert.Nil(t, req.Where)
 	})
 
+	t.Run("buildSearchRequestWithOptions exclusions only", func(t *testing.T) {
+		req := client.buildSearchRequestWithOptions([]float32{0.1}, 5, SearchOptions{
+			ExcludeDocIDs: []string{"secret-doc"},
+		})
+
+		assert.Equal(t, map[string]interface{}{
+			"doc_id": map[string]interface{}{
+				"$nin": []string{"secret-doc"},
+			},
+		}, req.Where)
+	})
+
+	t.Run("buildSearchRequestWithOptions inclusions and exclusions", func(t *testing.T) {
+		req := client.buildSearchRequestWithOptions([]float32{0.1}, 5, SearchOptions{
+			DocIDs:        []string{"doc1"},
+			ExcludeDocIDs: []string{"secret-doc"},
+		})
+
+		assert.Equal(t, map[string]interface{}{
+			"$and": []map[string]interface{}{
+				{"doc_id": map[string]interface{}{"$in": []string{"doc1"}}},
+				{"doc_id": map[string]interface{}{"$nin": []string{"secret-doc"}}},
+			},
+		}, req.Where)
+	})
+
 	t.Run("processSearchResponse", func(t *testing.T) {
 		searchResp := SearchResponse{
 			IDs:       [][]string{{"doc1", "doc2"}},
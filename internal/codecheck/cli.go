@@ -0,0 +1,438 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codecheck
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// placeholderPattern matches placeholders such as <bucket-name> that stand for values the
+// reader has to fill in. Shells read them as redirections.
+var placeholderPattern = regexp.MustCompile(`<[A-Za-z][A-Za-z0-9_\- ]*>`)
+
+// ipPermissionPortPattern finds the ports and protocol in an aws ec2 --ip-permissions value
+// written in shorthand or JSON syntax
+var ipPermissionPortPattern = regexp.MustCompile(`(?i)"?(FromPort|ToPort|IpProtocol)"?\s*[=:]\s*"?(-?\w+)"?`)
+
+// cliWord is an argument of a command line. Literal is false for words with variables or
+// command substitutions, whose value is not known.
+type cliWord struct {
+	Value   string
+	Literal bool
+}
+
+// cliCommand is a simple command from a shell or PowerShell script
+type cliCommand struct {
+	Line  int
+	Words []cliWord
+}
+
+// name returns the command name, or "" when it is not literal
+func (c cliCommand) name() string {
+	if len(c.Words) == 0 || !c.Words[0].Literal {
+		return ""
+	}
+	return c.Words[0].Value
+}
+
+// isFlag reports whether a CLI word is an option name. Negative numbers such as the -1
+// protocol are values.
+func isFlag(word cliWord) bool {
+	if !word.Literal || !strings.HasPrefix(word.Value, "-") || len(word.Value) < 2 {
+		return false
+	}
+	if strings.HasPrefix(word.Value, "--") {
+		return true
+	}
+	_, err := strconv.Atoi(word.Value)
+	return err != nil
+}
+
+// cliOptions maps option names to their values. An option without values is a switch.
+type cliOptions map[string][]string
+
+// parseOptions reads the options of a command line. Option names are matched case
+// insensitively, since PowerShell parameters are.
+func parseOptions(words []cliWord) cliOptions {
+	options := make(cliOptions)
+	current := ""
+	for _, word := range words {
+		if isFlag(word) {
+			name, value, hasValue := strings.Cut(word.Value, "=")
+			if !hasValue {
+				name, value, hasValue = strings.Cut(word.Value, ":")
+			}
+			current = strings.ToLower(name)
+			if _, ok := options[current]; !ok {
+				options[current] = []string{}
+			}
+			if hasValue {
+				options[current] = append(options[current], value)
+			}
+			continue
+		}
+		if current != "" && word.Literal {
+			options[current] = append(options[current], word.Value)
+		} else if current != "" {
+			// A value from a variable is unknown, but it still belongs to the option
+			options[current] = append(options[current], "")
+		}
+	}
+	return options
+}
+
+// has reports whether any of the options is set
+func (o cliOptions) has(names ...string) bool {
+	for _, name := range names {
+		if _, ok := o[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// values returns the values of the first option that is set, splitting comma separated lists
+func (o cliOptions) values(names ...string) []string {
+	for _, name := range names {
+		if values, ok := o[name]; ok {
+			var split []string
+			for _, value := range values {
+				for _, part := range strings.Split(value, ",") {
+					split = append(split, strings.Trim(strings.TrimSpace(part), `"'`))
+				}
+			}
+			return split
+		}
+	}
+	return nil
+}
+
+// value returns the first value of the first option that is set
+func (o cliOptions) value(names ...string) (string, bool) {
+	values := o.values(names...)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// checkCLICommand checks an AWS or Azure CLI command line against the catalogue and the policy
+// rules. Other commands have no findings.
+func (v *Validator) checkCLICommand(command cliCommand) []Finding {
+	switch command.name() {
+	case "aws":
+		return v.checkAWSCommand(command)
+	case "az":
+		return v.checkAzCommand(command)
+	default:
+		return nil
+	}
+}
+
+// checkAWSCommand checks the service and operation of an aws command
+func (v *Validator) checkAWSCommand(command cliCommand) []Finding {
+	var positional []cliWord
+	words := command.Words[1:]
+	for i := 0; i < len(words) && len(positional) < 2; i++ {
+		word := words[i]
+		if isFlag(word) {
+			if contains(v.catalog.AWS.GlobalOptionsWithValues, word.Value) {
+				i++
+			}
+			if len(positional) > 0 {
+				break
+			}
+			continue
+		}
+		positional = append(positional, word)
+	}
+	if len(positional) == 0 || !positional[0].Literal {
+		return nil
+	}
+
+	service := positional[0].Value
+	operations, known := v.catalog.AWS.Services[service]
+	if !known {
+		if suggestion := suggest(service, v.awsServiceNames()); suggestion != "" {
+			return []Finding{unknownCommandFinding(command.Line, "aws "+service, "aws "+suggestion)}
+		}
+		return nil
+	}
+	if len(positional) < 2 {
+		if service == "configure" || service == "help" || hasHelpFlag(words) || len(operations) == 0 {
+			return nil
+		}
+		return []Finding{{Line: command.Line, Severity: SeverityError, Rule: RuleIncompleteCommand,
+			Message: fmt.Sprintf("aws %s needs an operation such as %s", service, operations[0])}}
+	}
+	if !positional[1].Literal || len(operations) == 0 {
+		return v.awsPolicy(command, service, "")
+	}
+
+	operation := positional[1].Value
+	if !contains(operations, operation) && operation != "help" {
+		if suggestion := suggest(operation, operations); suggestion != "" {
+			return []Finding{unknownCommandFinding(command.Line, "aws "+service+" "+operation, "aws "+service+" "+suggestion)}
+		}
+	}
+	return v.awsPolicy(command, service, operation)
+}
+
+// awsServiceNames returns the catalogued AWS CLI services, sorted
+func (v *Validator) awsServiceNames() []string {
+	names := make([]string, 0, len(v.catalog.AWS.Services))
+	for name := range v.catalog.AWS.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkAzCommand walks an az command's words through the catalogue
+func (v *Validator) checkAzCommand(command cliCommand) []Finding {
+	node := v.catalog.azTree
+	var path []string
+	words := command.Words[1:]
+	for _, word := range words {
+		if isFlag(word) || !word.Literal {
+			break
+		}
+		next, ok := node.Children[word.Value]
+		if !ok {
+			if node.Command {
+				// Positional arguments of a complete command
+				break
+			}
+			if suggestion := suggest(word.Value, node.childNames()); suggestion != "" {
+				known := strings.TrimSpace("az " + strings.Join(path, " "))
+				return []Finding{unknownCommandFinding(command.Line, known+" "+word.Value, known+" "+suggestion)}
+			}
+			// Not catalogued
+			return nil
+		}
+		path = append(path, word.Value)
+		node = next
+	}
+
+	if len(path) > 0 && !node.Command && len(node.Children) > 0 && !hasHelpFlag(words) {
+		return []Finding{{Line: command.Line, Severity: SeverityError, Rule: RuleIncompleteCommand,
+			Message: fmt.Sprintf("az %s is a command group; add a subcommand such as %s", strings.Join(path, " "), node.childNames()[0])}}
+	}
+	return v.azPolicy(command, strings.Join(path, " "))
+}
+
+// unknownCommandFinding reports a command that is likely a typo of a catalogued command
+func unknownCommandFinding(line int, command, suggestion string) Finding {
+	return Finding{Line: line, Severity: SeverityError, Rule: RuleUnknownCommand,
+		Message: fmt.Sprintf("%q is not a known command; did you mean %q?", command, suggestion)}
+}
+
+// hasHelpFlag reports whether a command line asks for help
+func hasHelpFlag(words []cliWord) bool {
+	for _, word := range words {
+		if word.Literal && (word.Value == "--help" || word.Value == "-h" || word.Value == "help") {
+			return true
+		}
+	}
+	return false
+}
+
+// awsPolicy runs the policy rules for an aws command
+func (v *Validator) awsPolicy(command cliCommand, service, operation string) []Finding {
+	options := parseOptions(command.Words)
+	line := command.Line
+	var findings []Finding
+
+	switch service + " " + operation {
+	case "ec2 authorize-security-group-ingress":
+		findings = append(findings, awsIngressPolicy(line, options)...)
+	case "s3api create-bucket", "s3api put-bucket-acl", "s3api put-object-acl", "s3 cp", "s3 sync", "s3 mv":
+		if acl, ok := options.value("--acl"); ok && publicS3ACLs[acl] {
+			findings = append(findings, Finding{Line: line, Severity: SeverityError, Rule: RulePublicStorage,
+				Message: fmt.Sprintf("--acl %s makes objects readable outside the account; keep them private and grant access through bucket policies", acl)})
+		}
+	case "s3api delete-public-access-block":
+		findings = append(findings, Finding{Line: line, Severity: SeverityError, Rule: RulePublicStorage,
+			Message: "deleting the public access block allows buckets to be made public"})
+	case "rds create-db-instance", "rds create-db-cluster":
+		if options.has("--publicly-accessible") {
+			findings = append(findings, Finding{Line: line, Severity: SeverityError, Rule: RulePublicStorage,
+				Message: "--publicly-accessible exposes the database to the internet; use --no-publicly-accessible"})
+		}
+		if !options.has("--storage-encrypted") && !options.has("--source-db-instance-identifier") {
+			findings = append(findings, Finding{Line: line, Severity: SeverityWarning, Rule: RuleEncryption,
+				Message: "database storage is not encrypted; add --storage-encrypted"})
+		}
+	case "ec2 create-volume":
+		if !options.has("--encrypted") {
+			findings = append(findings, Finding{Line: line, Severity: SeverityWarning, Rule: RuleEncryption,
+				Message: "EBS volume is not encrypted unless encryption by default is on; add --encrypted"})
+		}
+	}
+	return findings
+}
+
+// awsIngressPolicy reports aws ec2 authorize-security-group-ingress rules that open an
+// administration port to any address
+func awsIngressPolicy(line int, options cliOptions) []Finding {
+	if cidr, ok := options.value("--cidr"); ok && internetSources[cidr] {
+		protocol, _ := options.value("--protocol")
+		ports, _ := options.value("--port")
+		for _, admin := range adminPorts {
+			if protocol == "-1" || protocol == "all" || portRangesInclude([]string{ports}, admin.Port) {
+				return []Finding{openPortFinding(line, admin.Name, admin.Port, cidr)}
+			}
+		}
+		return nil
+	}
+
+	permissions := strings.Join(options["--ip-permissions"], " ")
+	source := ""
+	for _, cidr := range []string{"::/0", "0.0.0.0/0"} {
+		if strings.Contains(permissions, cidr) {
+			source = cidr
+		}
+	}
+	if source == "" {
+		return nil
+	}
+	values := make(map[string]string)
+	for _, match := range ipPermissionPortPattern.FindAllStringSubmatch(permissions, -1) {
+		values[strings.ToLower(match[1])] = match[2]
+	}
+	for _, admin := range adminPorts {
+		spec := values["fromport"] + "-" + values["toport"]
+		if values["ipprotocol"] == "-1" || portRangesInclude([]string{spec}, admin.Port) {
+			return []Finding{openPortFinding(line, admin.Name, admin.Port, source)}
+		}
+	}
+	return nil
+}
+
+// azPolicy runs the policy rules for an az command
+func (v *Validator) azPolicy(command cliCommand, path string) []Finding {
+	options := parseOptions(command.Words)
+	line := command.Line
+	var findings []Finding
+
+	switch path {
+	case "network nsg rule create":
+		findings = append(findings, azNSGRulePolicy(line, options)...)
+	case "vm open-port":
+		ports := options.values("--port")
+		for _, admin := range adminPorts {
+			if portRangesInclude(ports, admin.Port) {
+				findings = append(findings, openPortFinding(line, admin.Name, admin.Port, "*"))
+				break
+			}
+		}
+	case "vm create":
+		nsgRule, hasRule := options.value("--nsg-rule")
+		publicIP, hasPublicIP := options.value("--public-ip-address")
+		if (!hasRule || strings.EqualFold(nsgRule, "SSH") || strings.EqualFold(nsgRule, "RDP")) &&
+			!(hasPublicIP && publicIP == "") && !options.has("--nsg") {
+			findings = append(findings, Finding{Line: line, Severity: SeverityWarning, Rule: RuleOpenAdminPort,
+				Message: "az vm create opens SSH or RDP to the internet by default; pass --nsg-rule NONE and connect through Azure Bastion"})
+		}
+	case "storage account create", "storage account update":
+		if allow, ok := options.value("--allow-blob-public-access"); ok && strings.EqualFold(allow, "true") {
+			findings = append(findings, Finding{Line: line, Severity: SeverityError, Rule: RulePublicStorage,
+				Message: "--allow-blob-public-access true allows anonymous blob reads; set it to false"})
+		}
+		if httpsOnly, ok := options.value("--https-only"); ok && strings.EqualFold(httpsOnly, "false") {
+			findings = append(findings, Finding{Line: line, Severity: SeverityWarning, Rule: RuleEncryption,
+				Message: "--https-only false accepts unencrypted HTTP; set it to true"})
+		}
+		if version, ok := options.value("--min-tls-version"); ok && weakTLSVersions[version] {
+			findings = append(findings, Finding{Line: line, Severity: SeverityWarning, Rule: RuleEncryption,
+				Message: fmt.Sprintf("minimum TLS version %s allows deprecated protocols; use TLS1_2", version)})
+		}
+	case "storage container create", "storage container set-permission":
+		if access, ok := options.value("--public-access"); ok && (access == "blob" || access == "container") {
+			findings = append(findings, Finding{Line: line, Severity: SeverityError, Rule: RulePublicStorage,
+				Message: fmt.Sprintf("--public-access %s allows anonymous reads; use off", access)})
+		}
+	case "sql server firewall-rule create", "postgres flexible-server firewall-rule create", "mysql flexible-server firewall-rule create":
+		start, _ := options.value("--start-ip-address")
+		end, _ := options.value("--end-ip-address")
+		if start == "0.0.0.0" && end == "255.255.255.255" {
+			findings = append(findings, Finding{Line: line, Severity: SeverityError, Rule: RulePublicStorage,
+				Message: "firewall rule allows every internet address to reach the database; restrict it to known addresses or use a private endpoint"})
+		}
+	}
+	return findings
+}
+
+// azNSGRulePolicy reports an az network nsg rule create rule that opens an administration port
+// to any address. The CLI defaults to an inbound allow rule from any source.
+func azNSGRulePolicy(line int, options cliOptions) []Finding {
+	access, ok := options.value("--access")
+	if ok && !strings.EqualFold(access, "Allow") {
+		return nil
+	}
+	direction, ok := options.value("--direction")
+	if ok && !strings.EqualFold(direction, "Inbound") {
+		return nil
+	}
+	protocol, ok := options.value("--protocol")
+	if ok && protocol != "*" && !strings.EqualFold(protocol, "Tcp") {
+		return nil
+	}
+
+	source := "*"
+	if sources := options.values("--source-address-prefixes", "--source-address-prefix"); len(sources) > 0 {
+		source = ""
+		for _, prefix := range sources {
+			if internetSources[strings.ToLower(prefix)] {
+				source = prefix
+			}
+		}
+	}
+	if source == "" {
+		return nil
+	}
+
+	ports := options.values("--destination-port-ranges", "--destination-port-range")
+	for _, admin := range adminPorts {
+		if portRangesInclude(ports, admin.Port) {
+			return []Finding{openPortFinding(line, admin.Name, admin.Port, source)}
+		}
+	}
+	return nil
+}
+
+// replacePlaceholders replaces placeholders such as <bucket-name> with a word of the same
+// length so that the script parses with unchanged positions. It returns the placeholders found.
+func replacePlaceholders(code string) (string, []string) {
+	var placeholders []string
+	replaced := placeholderPattern.ReplaceAllStringFunc(code, func(match string) string {
+		placeholders = append(placeholders, match)
+		return strings.Repeat("X", len(match))
+	})
+	return replaced, placeholders
+}
+
+// placeholderFinding reports placeholders that must be replaced before running a script
+func placeholderFinding(placeholders []string) []Finding {
+	if len(placeholders) == 0 {
+		return nil
+	}
+	return []Finding{{Severity: SeverityWarning, Rule: RulePlaceholder,
+		Message: fmt.Sprintf("replace placeholders such as %s before running; the shell reads them as redirections", placeholders[0])}}
+}
@@ -0,0 +1,170 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package codecheck validates generated Terraform, shell and PowerShell snippets. Terraform is
+// parsed with the HCL parser, checked against bundled provider schemas and linted with policy
+// rules; shell scripts are parsed with a bash parser and their AWS and Azure CLI commands are
+// checked against a bundled command catalogue; PowerShell is tokenized and its Az cmdlets are
+// checked against the same catalogue.
+//
+// The bundled schemas and catalogues cover the commonly used services only, so names missing
+// from them are reported only when they are close to a known name and therefore likely typos.
+package codecheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Severity is how serious a finding is
+type Severity string
+
+const (
+	// SeverityError means the snippet will not run or violates a security policy
+	SeverityError Severity = "error"
+	// SeverityWarning means the snippet runs but is likely to be incomplete or insecure
+	SeverityWarning Severity = "warning"
+)
+
+// Rules reported by Validate
+const (
+	// RuleSyntax is a parse error
+	RuleSyntax = "syntax"
+	// RuleUnknownProvider is a Terraform provider close to a known provider name
+	RuleUnknownProvider = "unknown-provider"
+	// RuleUnknownResource is a Terraform resource or data source type the provider does not have
+	RuleUnknownResource = "unknown-resource"
+	// RuleUnknownArgument is an argument or block the resource schema does not have
+	RuleUnknownArgument = "unknown-argument"
+	// RuleMissingArgument is a required argument or block that is not set
+	RuleMissingArgument = "missing-argument"
+	// RuleUnknownCommand is an AWS or Azure CLI command or Az cmdlet that does not exist
+	RuleUnknownCommand = "unknown-command"
+	// RuleIncompleteCommand is a CLI command group used without a subcommand
+	RuleIncompleteCommand = "incomplete-command"
+	// RulePublicStorage is a storage bucket, container or database open to the public
+	RulePublicStorage = "public-storage"
+	// RuleEncryption is storage or transport without encryption
+	RuleEncryption = "encryption"
+	// RuleOpenAdminPort is SSH or RDP open to the internet
+	RuleOpenAdminPort = "open-admin-port"
+	// RulePlaceholder is a placeholder such as <bucket-name> left in a script
+	RulePlaceholder = "placeholder"
+)
+
+// Finding is a problem found in a snippet. Line is 1-based and zero when the problem concerns
+// the whole snippet.
+type Finding struct {
+	Line     int      `json:"line,omitempty"`
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	Message  string   `json:"message"`
+}
+
+// String formats the finding with its line
+func (f Finding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("line %d: %s", f.Line, f.Message)
+	}
+	return f.Message
+}
+
+// HasErrors reports whether any of the findings is an error
+func HasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Validator validates snippets against the bundled provider schemas and CLI catalogue
+type Validator struct {
+	providers map[string]*providerSchema
+	catalog   *cliCatalog
+}
+
+// NewValidator returns a validator using the bundled provider schemas and CLI catalogue
+func NewValidator() (*Validator, error) {
+	providers, err := loadProviderSchemas()
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := loadCLICatalog()
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{providers: providers, catalog: catalog}, nil
+}
+
+var (
+	defaultValidator     *Validator
+	defaultValidatorErr  error
+	defaultValidatorOnce sync.Once
+)
+
+// Validate validates a snippet with the bundled schemas and catalogue. The bundled data is
+// loaded on first use.
+func Validate(language, code string) []Finding {
+	defaultValidatorOnce.Do(func() {
+		defaultValidator, defaultValidatorErr = NewValidator()
+	})
+	if defaultValidatorErr != nil {
+		return []Finding{{Severity: SeverityWarning, Rule: RuleSyntax,
+			Message: "validation data could not be loaded: " + defaultValidatorErr.Error()}}
+	}
+	return defaultValidator.Validate(language, code)
+}
+
+// Validate returns the findings for a snippet, ordered by line. Languages without a validator
+// have no findings.
+func (v *Validator) Validate(language, code string) []Finding {
+	var findings []Finding
+	switch normalizeLanguage(language) {
+	case "terraform":
+		findings = v.validateTerraform(code)
+	case "bash":
+		findings = v.validateShell(code)
+	case "powershell":
+		findings = v.validatePowerShell(code)
+	default:
+		return nil
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+// Supports reports whether snippets in the language are validated
+func Supports(language string) bool {
+	return normalizeLanguage(language) != ""
+}
+
+// normalizeLanguage maps a code fence language to a validator, or "" when there is none
+func normalizeLanguage(language string) string {
+	switch strings.ToLower(strings.TrimSpace(language)) {
+	case "terraform", "hcl", "tf":
+		return "terraform"
+	case "bash", "sh", "shell", "zsh":
+		return "bash"
+	case "powershell", "ps1", "pwsh", "ps":
+		return "powershell"
+	default:
+		return ""
+	}
+}
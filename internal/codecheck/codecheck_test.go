@@ -0,0 +1,371 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codecheck
+
+import (
+	"strings"
+	"testing"
+)
+
+// validationCase is a snippet and the findings expected for it
+type validationCase struct {
+	name      string
+	code      string
+	wantRules []string
+	// wantText is a fragment the first finding's message must contain
+	wantText string
+	// wantLine is the line of the first finding when non-zero
+	wantLine int
+}
+
+// runValidationCases validates each case's snippet in the language and compares the findings
+func runValidationCases(t *testing.T, language string, tests []validationCase) {
+	t.Helper()
+	validator, err := NewValidator()
+	if err != nil {
+		t.Fatalf("NewValidator() error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := validator.Validate(language, tt.code)
+			rules := make([]string, 0, len(findings))
+			for _, finding := range findings {
+				rules = append(rules, finding.Rule)
+			}
+			if strings.Join(rules, ",") != strings.Join(tt.wantRules, ",") {
+				t.Fatalf("rules = %v, want %v; findings = %v", rules, tt.wantRules, findings)
+			}
+			if len(findings) == 0 {
+				return
+			}
+			if tt.wantText != "" && !strings.Contains(findings[0].Message, tt.wantText) {
+				t.Errorf("message = %q, want it to contain %q", findings[0].Message, tt.wantText)
+			}
+			if tt.wantLine != 0 && findings[0].Line != tt.wantLine {
+				t.Errorf("line = %d, want %d", findings[0].Line, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestValidateTerraform(t *testing.T) {
+	runValidationCases(t, "hcl", []validationCase{
+		{
+			name: "valid configuration",
+			code: `provider "aws" {
+  region = "us-east-1"
+}
+
+resource "aws_vpc" "main" {
+  cidr_block           = "10.0.0.0/16"
+  enable_dns_hostnames = true
+}
+
+resource "aws_subnet" "private" {
+  count             = 2
+  vpc_id            = aws_vpc.main.id
+  cidr_block        = cidrsubnet(aws_vpc.main.cidr_block, 8, count.index)
+  availability_zone = var.azs[count.index]
+}
+
+variable "azs" {
+  type = list(string)
+}`,
+			wantRules: []string{},
+		},
+		{
+			name:      "unclosed block",
+			code:      "resource \"aws_vpc\" \"main\" {\n  cidr_block = \"10.0.0.0/16\"\n",
+			wantRules: []string{RuleSyntax},
+		},
+		{
+			name:      "misspelled resource type",
+			code:      "resource \"aws_s3_bukcet\" \"logs\" {\n  bucket = \"logs\"\n}",
+			wantRules: []string{RuleUnknownResource},
+			wantText:  `"aws_s3_bucket"`,
+			wantLine:  1,
+		},
+		{
+			name:      "wrong provider prefix",
+			code:      "resource \"azure_resource_group\" \"rg\" {\n  name     = \"rg\"\n  location = \"eastus\"\n}",
+			wantRules: []string{RuleUnknownResource},
+			wantText:  `"azurerm_resource_group"`,
+		},
+		{
+			name:      "misspelled argument",
+			code:      "resource \"aws_vpc\" \"main\" {\n  cidr_blok = \"10.0.0.0/16\"\n}",
+			wantRules: []string{RuleUnknownArgument},
+			wantText:  `"cidr_block"`,
+			wantLine:  2,
+		},
+		{
+			name:      "unbundled resource type is not reported",
+			code:      "resource \"aws_appmesh_mesh\" \"mesh\" {\n  name = \"mesh\"\n}",
+			wantRules: []string{},
+		},
+		{
+			name: "public bucket ACL",
+			code: `resource "aws_s3_bucket_acl" "site" {
+  bucket = aws_s3_bucket.site.id
+  acl    = "public-read"
+}`,
+			wantRules: []string{RulePublicStorage},
+			wantLine:  3,
+		},
+		{
+			name: "SSH open to the internet",
+			code: `resource "aws_security_group" "web" {
+  name   = "web"
+  vpc_id = aws_vpc.main.id
+
+  ingress {
+    from_port   = 22
+    to_port     = 22
+    protocol    = "tcp"
+    cidr_blocks = ["0.0.0.0/0"]
+  }
+}`,
+			wantRules: []string{RuleOpenAdminPort},
+			wantText:  "SSH",
+		},
+		{
+			name: "ports from variables are not judged",
+			code: `resource "aws_security_group_rule" "ssh" {
+  type              = "ingress"
+  from_port         = var.port
+  to_port           = var.port
+  protocol          = "tcp"
+  cidr_blocks       = [var.admin_cidr]
+  security_group_id = aws_security_group.web.id
+}`,
+			wantRules: []string{},
+		},
+		{
+			name: "unencrypted public database",
+			code: `resource "aws_db_instance" "db" {
+  identifier          = "app"
+  engine              = "postgres"
+  instance_class      = "db.t3.micro"
+  allocated_storage   = 20
+  username            = "app"
+  password            = var.password
+  publicly_accessible = true
+}`,
+			wantRules: []string{RuleEncryption, RulePublicStorage},
+		},
+		{
+			name: "public storage container",
+			code: `resource "azurerm_storage_container" "web" {
+  name                  = "web"
+  storage_account_name  = azurerm_storage_account.sa.name
+  container_access_type = "blob"
+}`,
+			wantRules: []string{RulePublicStorage},
+		},
+		{
+			name: "RDP open in a network security group",
+			code: `resource "azurerm_network_security_rule" "rdp" {
+  name                        = "rdp"
+  priority                    = 100
+  direction                   = "Inbound"
+  access                      = "Allow"
+  protocol                    = "Tcp"
+  source_port_range           = "*"
+  destination_port_range      = "3389"
+  source_address_prefix       = "*"
+  destination_address_prefix  = "*"
+  resource_group_name         = azurerm_resource_group.rg.name
+  network_security_group_name = azurerm_network_security_group.nsg.name
+}`,
+			wantRules: []string{RuleOpenAdminPort},
+			wantText:  "RDP",
+		},
+	})
+}
+
+func TestValidateShell(t *testing.T) {
+	runValidationCases(t, "bash", []validationCase{
+		{
+			name: "valid script",
+			code: `#!/bin/bash
+set -euo pipefail
+REGION=us-east-1
+VPC_ID=$(aws ec2 create-vpc --cidr-block 10.0.0.0/16 --region "$REGION" --query Vpc.VpcId --output text)
+az group create --name rg-app --location eastus
+az network vnet create -g rg-app -n vnet-app --address-prefix 10.1.0.0/16`,
+			wantRules: []string{},
+		},
+		{
+			name:      "unterminated quote",
+			code:      "aws s3 ls \"s3://bucket\naz group list",
+			wantRules: []string{RuleSyntax},
+		},
+		{
+			name:      "misspelled AWS operation",
+			code:      "aws ec2 describe-instnces --region us-east-1",
+			wantRules: []string{RuleUnknownCommand},
+			wantText:  `"aws ec2 describe-instances"`,
+		},
+		{
+			name:      "misspelled AWS service",
+			code:      "sudo aws dynamodbb list-tables",
+			wantRules: []string{RuleUnknownCommand},
+			wantText:  `"aws dynamodb"`,
+		},
+		{
+			name:      "AWS service without operation",
+			code:      "aws ec2 --region us-east-1",
+			wantRules: []string{RuleIncompleteCommand},
+		},
+		{
+			name:      "misspelled az subcommand",
+			code:      "az network vnet creat --name vnet -g rg",
+			wantRules: []string{RuleUnknownCommand},
+			wantText:  `"az network vnet create"`,
+		},
+		{
+			name:      "az group without subcommand",
+			code:      "az network vnet -g rg",
+			wantRules: []string{RuleIncompleteCommand},
+		},
+		{
+			name:      "placeholders are reported instead of a syntax error",
+			code:      "aws s3api create-bucket --bucket <bucket-name> --region <region>",
+			wantRules: []string{RulePlaceholder},
+			wantText:  "<bucket-name>",
+		},
+		{
+			name:      "SSH open to the internet",
+			code:      "aws ec2 authorize-security-group-ingress --group-id sg-123 --protocol tcp --port 22 --cidr 0.0.0.0/0",
+			wantRules: []string{RuleOpenAdminPort},
+		},
+		{
+			name:      "public NSG rule",
+			code:      "az network nsg rule create -g rg --nsg-name nsg -n rdp --priority 100 --destination-port-ranges 3389",
+			wantRules: []string{RuleOpenAdminPort},
+			wantText:  "RDP",
+		},
+		{
+			name:      "public bucket",
+			code:      "aws s3api put-bucket-acl --bucket site --acl public-read",
+			wantRules: []string{RulePublicStorage},
+		},
+		{
+			name:      "unencrypted volume",
+			code:      "aws ec2 create-volume --size 100 --availability-zone us-east-1a",
+			wantRules: []string{RuleEncryption},
+		},
+		{
+			name:      "public blob access on a storage account",
+			code:      "az storage account create -n sa -g rg --allow-blob-public-access true",
+			wantRules: []string{RulePublicStorage},
+		},
+	})
+}
+
+func TestValidatePowerShell(t *testing.T) {
+	runValidationCases(t, "powershell", []validationCase{
+		{
+			name: "valid script",
+			code: `# Create the network
+$rg = New-AzResourceGroup -Name "rg-app" -Location "eastus" -Tag @{ Environment = "prod" }
+$subnet = New-AzVirtualNetworkSubnetConfig -Name "app" -AddressPrefix "10.0.1.0/24"
+$vnet = New-AzVirtualNetwork -Name "vnet-app" -ResourceGroupName $rg.ResourceGroupName ` + "`" + `
+    -Location "eastus" -AddressPrefix "10.0.0.0/16" -Subnet $subnet
+foreach ($name in @("a", "b")) {
+    Write-Host "Created $name"
+}
+<# block comment with ( unbalanced #>
+$script = @'
+not ( parsed
+'@`,
+			wantRules: []string{},
+		},
+		{
+			name:      "unclosed brace",
+			code:      "if ($true) {\n    Get-AzVM\n",
+			wantRules: []string{RuleSyntax},
+			wantLine:  1,
+		},
+		{
+			name:      "mismatched delimiter",
+			code:      "$list = @(1, 2]\n",
+			wantRules: []string{RuleSyntax},
+		},
+		{
+			name:      "unterminated string",
+			code:      "Write-Host \"hello\nGet-AzVM",
+			wantRules: []string{RuleSyntax},
+		},
+		{
+			name:      "misspelled cmdlet",
+			code:      "$vnet = New-AzVirtualNetwrok -Name vnet",
+			wantRules: []string{RuleUnknownCommand},
+			wantText:  `"New-AzVirtualNetwork"`,
+		},
+		{
+			name:      "public storage account",
+			code:      "New-AzStorageAccount -ResourceGroupName rg -Name sa -Location eastus -SkuName Standard_LRS -AllowBlobPublicAccess $true",
+			wantRules: []string{RulePublicStorage},
+		},
+		{
+			name: "RDP open to the internet",
+			code: `$rule = New-AzNetworkSecurityRuleConfig -Name rdp -Access Allow -Direction Inbound -Priority 100 ` + "`" + `
+    -Protocol Tcp -SourceAddressPrefix Internet -SourcePortRange * -DestinationAddressPrefix * -DestinationPortRange 3389`,
+			wantRules: []string{RuleOpenAdminPort},
+			wantLine:  1,
+		},
+		{
+			name:      "az CLI inside PowerShell",
+			code:      "az group creat --name rg --location eastus",
+			wantRules: []string{RuleUnknownCommand},
+		},
+	})
+}
+
+func TestValidateUnsupportedLanguage(t *testing.T) {
+	if findings := Validate("python", "this is not ( python"); findings != nil {
+		t.Errorf("Validate(python) = %v, want nil", findings)
+	}
+	if Supports("python") || !Supports("Terraform") || !Supports("ps1") {
+		t.Error("Supports() does not match the validated languages")
+	}
+}
+
+func TestHasErrors(t *testing.T) {
+	warnings := []Finding{{Severity: SeverityWarning, Rule: RuleMissingArgument, Message: "missing"}}
+	if HasErrors(warnings) {
+		t.Error("HasErrors() = true for warnings only")
+	}
+	if !HasErrors(append(warnings, Finding{Severity: SeverityError, Rule: RuleSyntax, Message: "bad"})) {
+		t.Error("HasErrors() = false with an error")
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	known := []string{"create", "delete", "list", "show"}
+	tests := map[string]string{
+		"creat":  "create",
+		"dleete": "delete",
+		"Show":   "show",
+		"update": "",
+		"ls":     "",
+	}
+	for name, want := range tests {
+		if got := suggest(name, known); got != want {
+			t.Errorf("suggest(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codecheck
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// adminPorts are the remote administration ports that must not be open to the internet
+var adminPorts = []struct {
+	Port int
+	Name string
+}{
+	{22, "SSH"},
+	{3389, "RDP"},
+}
+
+// publicS3ACLs are the canned ACLs that grant access outside the bucket owner's account
+var publicS3ACLs = map[string]bool{
+	"public-read": true, "public-read-write": true, "authenticated-read": true,
+}
+
+// internetSources are the address prefixes that match any source on the internet
+var internetSources = map[string]bool{
+	"0.0.0.0/0": true, "::/0": true, "*": true, "internet": true, "any": true,
+}
+
+// weakTLSVersions are minimum TLS versions that allow deprecated protocol versions
+var weakTLSVersions = map[string]bool{
+	"TLS1_0": true, "TLS1_1": true, "1.0": true, "1.1": true,
+}
+
+// resourcePolicies are the policy rules for each resource type. Rules only use values that are
+// known without variables; an attribute set from a variable never triggers a finding.
+var resourcePolicies = map[string]func(block *hclsyntax.Block) []Finding{
+	"aws_s3_bucket":                       checkS3BucketACL,
+	"aws_s3_bucket_acl":                   checkS3BucketACL,
+	"aws_s3_bucket_public_access_block":   checkS3PublicAccessBlock,
+	"aws_db_instance":                     checkDatabaseInstance,
+	"aws_rds_cluster":                     requireEnabled("storage_encrypted", "RDS cluster storage is not encrypted; set storage_encrypted = true"),
+	"aws_rds_cluster_instance":            checkPubliclyAccessible,
+	"aws_ebs_volume":                      requireEnabled("encrypted", "EBS volume is not encrypted; set encrypted = true"),
+	"aws_efs_file_system":                 requireEnabled("encrypted", "EFS file system is not encrypted; set encrypted = true"),
+	"aws_instance":                        checkInstanceVolumes,
+	"aws_lb_listener":                     checkListenerProtocol,
+	"aws_security_group":                  checkSecurityGroup,
+	"aws_security_group_rule":             checkSecurityGroupRule,
+	"aws_vpc_security_group_ingress_rule": checkSecurityGroupIngressRule,
+	"azurerm_network_security_group":      checkNetworkSecurityGroup,
+	"azurerm_network_security_rule":       checkNetworkSecurityRule,
+	"azurerm_storage_account":             checkStorageAccount,
+	"azurerm_storage_container":           checkStorageContainer,
+	"azurerm_mssql_database":              checkSQLDatabase,
+	"azurerm_mssql_server":                checkSQLServer,
+}
+
+// checkS3BucketACL reports canned ACLs that make a bucket public
+func checkS3BucketACL(block *hclsyntax.Block) []Finding {
+	acl, ok := staticString(block.Body, "acl")
+	if !ok || !publicS3ACLs[acl] {
+		return nil
+	}
+	return []Finding{{Line: attributeLine(block.Body, "acl"), Severity: SeverityError, Rule: RulePublicStorage,
+		Message: fmt.Sprintf("S3 bucket ACL %q makes objects readable outside the account; use private and grant access through bucket policies", acl)}}
+}
+
+// checkS3PublicAccessBlock reports public access block settings that are off. Terraform
+// defaults each of them to false.
+func checkS3PublicAccessBlock(block *hclsyntax.Block) []Finding {
+	var disabled []string
+	for _, setting := range []string{"block_public_acls", "block_public_policy", "ignore_public_acls", "restrict_public_buckets"} {
+		if notEnabled(block.Body, setting) {
+			disabled = append(disabled, setting)
+		}
+	}
+	if len(disabled) == 0 {
+		return nil
+	}
+	return []Finding{{Line: block.TypeRange.Start.Line, Severity: SeverityError, Rule: RulePublicStorage,
+		Message: "S3 public access block does not enable " + strings.Join(disabled, ", ") + "; set them to true"}}
+}
+
+// checkDatabaseInstance reports public and unencrypted RDS instances. Read replicas inherit
+// encryption from their source.
+func checkDatabaseInstance(block *hclsyntax.Block) []Finding {
+	findings := checkPubliclyAccessible(block)
+	if _, replica := block.Body.Attributes["replicate_source_db"]; !replica {
+		findings = append(findings, requireEnabled("storage_encrypted",
+			"RDS instance storage is not encrypted; set storage_encrypted = true")(block)...)
+	}
+	return findings
+}
+
+// checkPubliclyAccessible reports databases reachable from the internet
+func checkPubliclyAccessible(block *hclsyntax.Block) []Finding {
+	if public, ok := staticBool(block.Body, "publicly_accessible"); !ok || !public {
+		return nil
+	}
+	return []Finding{{Line: attributeLine(block.Body, "publicly_accessible"), Severity: SeverityError, Rule: RulePublicStorage,
+		Message: "database is publicly accessible; set publicly_accessible = false and connect through the VPC"}}
+}
+
+// requireEnabled returns a rule reporting an encryption setting that is missing or false
+func requireEnabled(name, message string) func(block *hclsyntax.Block) []Finding {
+	return func(block *hclsyntax.Block) []Finding {
+		if !notEnabled(block.Body, name) {
+			return nil
+		}
+		line := block.TypeRange.Start.Line
+		if _, ok := block.Body.Attributes[name]; ok {
+			line = attributeLine(block.Body, name)
+		}
+		return []Finding{{Line: line, Severity: SeverityWarning, Rule: RuleEncryption, Message: message}}
+	}
+}
+
+// checkInstanceVolumes reports instance volumes with encryption turned off. Volumes without the
+// setting follow the account's EBS encryption default.
+func checkInstanceVolumes(block *hclsyntax.Block) []Finding {
+	var findings []Finding
+	for _, nested := range block.Body.Blocks {
+		if nested.Type != "root_block_device" && nested.Type != "ebs_block_device" {
+			continue
+		}
+		if encrypted, ok := staticBool(nested.Body, "encrypted"); ok && !encrypted {
+			findings = append(findings, Finding{Line: attributeLine(nested.Body, "encrypted"), Severity: SeverityWarning, Rule: RuleEncryption,
+				Message: fmt.Sprintf("%s is not encrypted; set encrypted = true", nested.Type)})
+		}
+	}
+	return findings
+}
+
+// checkListenerProtocol reports load balancer listeners that serve plain HTTP instead of
+// redirecting to HTTPS
+func checkListenerProtocol(block *hclsyntax.Block) []Finding {
+	if protocol, ok := staticString(block.Body, "protocol"); !ok || !strings.EqualFold(protocol, "HTTP") {
+		return nil
+	}
+	for _, action := range block.Body.Blocks {
+		if action.Type != "default_action" {
+			continue
+		}
+		if actionType, ok := staticString(action.Body, "type"); ok && actionType == "redirect" {
+			return nil
+		}
+	}
+	return []Finding{{Line: attributeLine(block.Body, "protocol"), Severity: SeverityWarning, Rule: RuleEncryption,
+		Message: "listener serves plain HTTP; use HTTPS with a certificate or redirect HTTP to HTTPS"}}
+}
+
+// checkSecurityGroup reports inline ingress rules that open administration ports to the internet
+func checkSecurityGroup(block *hclsyntax.Block) []Finding {
+	var findings []Finding
+	for _, nested := range block.Body.Blocks {
+		if nested.Type == "ingress" {
+			findings = append(findings, checkAWSIngress(nested.Body, "cidr_blocks", "ipv6_cidr_blocks", "protocol")...)
+		}
+	}
+	return findings
+}
+
+// checkSecurityGroupRule reports aws_security_group_rule ingress rules open to the internet
+func checkSecurityGroupRule(block *hclsyntax.Block) []Finding {
+	if ruleType, ok := staticString(block.Body, "type"); !ok || ruleType != "ingress" {
+		return nil
+	}
+	return checkAWSIngress(block.Body, "cidr_blocks", "ipv6_cidr_blocks", "protocol")
+}
+
+// checkSecurityGroupIngressRule reports aws_vpc_security_group_ingress_rule rules open to the
+// internet
+func checkSecurityGroupIngressRule(block *hclsyntax.Block) []Finding {
+	return checkAWSIngress(block.Body, "cidr_ipv4", "cidr_ipv6", "ip_protocol")
+}
+
+// checkAWSIngress reports an AWS ingress rule that allows an administration port from any
+// address. Protocol -1 allows every port.
+func checkAWSIngress(body *hclsyntax.Body, cidrName, ipv6CIDRName, protocolName string) []Finding {
+	var source string
+	for _, name := range []string{cidrName, ipv6CIDRName} {
+		for _, cidr := range staticStrings(body, name) {
+			if internetSources[cidr] {
+				source = cidr
+			}
+		}
+	}
+	if source == "" {
+		return nil
+	}
+
+	protocol, ok := staticString(body, protocolName)
+	if !ok {
+		return nil
+	}
+	allPorts := protocol == "-1" || strings.EqualFold(protocol, "all")
+	if !allPorts && !strings.EqualFold(protocol, "tcp") && protocol != "6" {
+		return nil
+	}
+
+	from, fromOK := staticNumber(body, "from_port")
+	to, toOK := staticNumber(body, "to_port")
+	for _, admin := range adminPorts {
+		if allPorts || (fromOK && toOK && from <= admin.Port && admin.Port <= to) {
+			return []Finding{openPortFinding(body.SrcRange.Start.Line, admin.Name, admin.Port, source)}
+		}
+	}
+	return nil
+}
+
+// checkNetworkSecurityGroup reports inline security rules that open administration ports to the
+// internet
+func checkNetworkSecurityGroup(block *hclsyntax.Block) []Finding {
+	var findings []Finding
+	for _, nested := range block.Body.Blocks {
+		if nested.Type == "security_rule" {
+			findings = append(findings, checkAzureSecurityRule(nested.Body)...)
+		}
+	}
+	return findings
+}
+
+// checkNetworkSecurityRule reports an azurerm_network_security_rule open to the internet
+func checkNetworkSecurityRule(block *hclsyntax.Block) []Finding {
+	return checkAzureSecurityRule(block.Body)
+}
+
+// checkAzureSecurityRule reports an inbound allow rule from any address that includes an
+// administration port
+func checkAzureSecurityRule(body *hclsyntax.Body) []Finding {
+	direction, _ := staticString(body, "direction")
+	access, _ := staticString(body, "access")
+	protocol, _ := staticString(body, "protocol")
+	if !strings.EqualFold(direction, "Inbound") || !strings.EqualFold(access, "Allow") {
+		return nil
+	}
+	if protocol != "*" && !strings.EqualFold(protocol, "Tcp") {
+		return nil
+	}
+
+	var source string
+	for _, name := range []string{"source_address_prefix", "source_address_prefixes"} {
+		for _, prefix := range staticStrings(body, name) {
+			if internetSources[strings.ToLower(prefix)] {
+				source = prefix
+			}
+		}
+	}
+	if source == "" {
+		return nil
+	}
+
+	var ranges []string
+	for _, name := range []string{"destination_port_range", "destination_port_ranges"} {
+		ranges = append(ranges, staticStrings(body, name)...)
+	}
+	for _, admin := range adminPorts {
+		if portRangesInclude(ranges, admin.Port) {
+			return []Finding{openPortFinding(body.SrcRange.Start.Line, admin.Name, admin.Port, source)}
+		}
+	}
+	return nil
+}
+
+// openPortFinding reports an administration port open to the internet
+func openPortFinding(line int, name string, port int, source string) Finding {
+	return Finding{Line: line, Severity: SeverityError, Rule: RuleOpenAdminPort,
+		Message: fmt.Sprintf("rule allows %s (port %d) from %s; restrict the source to a management network or use a bastion", name, port, source)}
+}
+
+// checkStorageAccount reports public blob access and unencrypted transport on storage accounts
+func checkStorageAccount(block *hclsyntax.Block) []Finding {
+	var findings []Finding
+	if public, ok := staticBool(block.Body, "allow_nested_items_to_be_public"); ok && public {
+		findings = append(findings, Finding{Line: attributeLine(block.Body, "allow_nested_items_to_be_public"), Severity: SeverityError, Rule: RulePublicStorage,
+			Message: "storage account allows public blob access; set allow_nested_items_to_be_public = false"})
+	}
+	for _, name := range []string{"https_traffic_only_enabled", "enable_https_traffic_only"} {
+		if httpsOnly, ok := staticBool(block.Body, name); ok && !httpsOnly {
+			findings = append(findings, Finding{Line: attributeLine(block.Body, name), Severity: SeverityWarning, Rule: RuleEncryption,
+				Message: fmt.Sprintf("storage account accepts unencrypted HTTP; set %s = true", name)})
+		}
+	}
+	findings = append(findings, checkMinimumTLS(block.Body, "min_tls_version")...)
+	return findings
+}
+
+// checkStorageContainer reports containers with anonymous read access
+func checkStorageContainer(block *hclsyntax.Block) []Finding {
+	access, ok := staticString(block.Body, "container_access_type")
+	if !ok || access == "private" {
+		return nil
+	}
+	return []Finding{{Line: attributeLine(block.Body, "container_access_type"), Severity: SeverityError, Rule: RulePublicStorage,
+		Message: fmt.Sprintf("container access type %q allows anonymous reads; use private", access)}}
+}
+
+// checkSQLDatabase reports databases with transparent data encryption turned off
+func checkSQLDatabase(block *hclsyntax.Block) []Finding {
+	if enabled, ok := staticBool(block.Body, "transparent_data_encryption_enabled"); !ok || enabled {
+		return nil
+	}
+	return []Finding{{Line: attributeLine(block.Body, "transparent_data_encryption_enabled"), Severity: SeverityWarning, Rule: RuleEncryption,
+		Message: "transparent data encryption is off; set transparent_data_encryption_enabled = true"}}
+}
+
+// checkSQLServer reports SQL servers accepting deprecated TLS versions
+func checkSQLServer(block *hclsyntax.Block) []Finding {
+	return checkMinimumTLS(block.Body, "minimum_tls_version")
+}
+
+// checkMinimumTLS reports a minimum TLS version below 1.2
+func checkMinimumTLS(body *hclsyntax.Body, name string) []Finding {
+	version, ok := staticString(body, name)
+	if !ok || !weakTLSVersions[version] {
+		return nil
+	}
+	return []Finding{{Line: attributeLine(body, name), Severity: SeverityWarning, Rule: RuleEncryption,
+		Message: fmt.Sprintf("minimum TLS version %s allows deprecated protocols; require TLS 1.2", version)}}
+}
+
+// portRangesInclude reports whether port specifications such as "22", "20-30" or "*" include
+// the port
+func portRangesInclude(ranges []string, port int) bool {
+	for _, spec := range ranges {
+		spec = strings.TrimSpace(spec)
+		if spec == "*" {
+			return true
+		}
+		low, high, isRange := strings.Cut(spec, "-")
+		if !isRange {
+			high = low
+		}
+		from, errFrom := strconv.Atoi(strings.TrimSpace(low))
+		to, errTo := strconv.Atoi(strings.TrimSpace(high))
+		if errFrom == nil && errTo == nil && from <= port && port <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeLine returns the line of an attribute, or of the body when it is not set
+func attributeLine(body *hclsyntax.Body, name string) int {
+	if attribute, ok := body.Attributes[name]; ok {
+		return attribute.SrcRange.Start.Line
+	}
+	return body.SrcRange.Start.Line
+}
+
+// staticValue evaluates an attribute without variables. It reports false when the attribute is
+// missing or refers to variables, resources or functions.
+func staticValue(body *hclsyntax.Body, name string) (cty.Value, bool) {
+	attribute, ok := body.Attributes[name]
+	if !ok {
+		return cty.NilVal, false
+	}
+	value, diags := attribute.Expr.Value(nil)
+	if diags.HasErrors() || !value.IsWhollyKnown() || value.IsNull() {
+		return cty.NilVal, false
+	}
+	return value, true
+}
+
+// staticString returns a string attribute's value
+func staticString(body *hclsyntax.Body, name string) (string, bool) {
+	value, ok := staticValue(body, name)
+	if !ok || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// staticBool returns a boolean attribute's value
+func staticBool(body *hclsyntax.Body, name string) (bool, bool) {
+	value, ok := staticValue(body, name)
+	if !ok || value.Type() != cty.Bool {
+		return false, false
+	}
+	return value.True(), true
+}
+
+// staticNumber returns a whole number attribute's value
+func staticNumber(body *hclsyntax.Body, name string) (int, bool) {
+	value, ok := staticValue(body, name)
+	if !ok || value.Type() != cty.Number {
+		return 0, false
+	}
+	number, accuracy := value.AsBigFloat().Int64()
+	if accuracy != big.Exact {
+		return 0, false
+	}
+	return int(number), true
+}
+
+// staticStrings returns the strings in a string or list attribute
+func staticStrings(body *hclsyntax.Body, name string) []string {
+	value, ok := staticValue(body, name)
+	if !ok {
+		return nil
+	}
+	if value.Type() == cty.String {
+		return []string{value.AsString()}
+	}
+	if !value.CanIterateElements() {
+		return nil
+	}
+	var values []string
+	for it := value.ElementIterator(); it.Next(); {
+		_, element := it.Element()
+		if element.IsKnown() && !element.IsNull() && element.Type() == cty.String {
+			values = append(values, element.AsString())
+		}
+	}
+	return values
+}
+
+// notEnabled reports whether a boolean attribute is missing or statically false. Attributes set
+// from variables count as enabled.
+func notEnabled(body *hclsyntax.Body, name string) bool {
+	if _, ok := body.Attributes[name]; !ok {
+		return true
+	}
+	enabled, ok := staticBool(body, name)
+	return ok && !enabled
+}
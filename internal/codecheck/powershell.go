@@ -0,0 +1,408 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codecheck
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// azCmdletPattern matches Az module cmdlet names such as New-AzVirtualNetwork
+var azCmdletPattern = regexp.MustCompile(`^[A-Za-z]+-Az[A-Z][A-Za-z0-9]*$`)
+
+// closingDelimiters maps each opening delimiter to its closing one
+var closingDelimiters = map[rune]rune{'(': ')', '{': '}', '[': ']'}
+
+// psValueConstants are the automatic variables whose value is known
+var psValueConstants = map[string]bool{"$true": true, "$false": true, "$null": true}
+
+// validatePowerShell tokenizes a PowerShell script, reports unbalanced delimiters and
+// unterminated strings, and checks its Az cmdlets and CLI commands
+func (v *Validator) validatePowerShell(code string) []Finding {
+	tokenizer := newPSTokenizer(code)
+	tokenizer.run()
+	if tokenizer.err != nil {
+		return []Finding{*tokenizer.err}
+	}
+
+	var findings []Finding
+	for _, command := range tokenizer.commands {
+		findings = append(findings, v.checkPowerShellCommand(command)...)
+	}
+	return findings
+}
+
+// checkPowerShellCommand checks a cmdlet name against the catalogue and runs the policy rules
+// for Az cmdlets and CLI commands
+func (v *Validator) checkPowerShellCommand(command cliCommand) []Finding {
+	// An assignment such as $vnet = New-AzVirtualNetwork ... runs the command on its right
+	if len(command.Words) > 2 && !command.Words[0].Literal && command.Words[1].Value == "=" {
+		command.Words = command.Words[2:]
+	}
+	name := command.name()
+	if !azCmdletPattern.MatchString(name) {
+		return v.checkCLICommand(command)
+	}
+
+	cmdlet, known := v.catalog.cmdlets[strings.ToLower(name)]
+	if !known {
+		if suggestion := suggest(name, v.catalog.AzPowerShell.Cmdlets); suggestion != "" {
+			return []Finding{{Line: command.Line, Severity: SeverityError, Rule: RuleUnknownCommand,
+				Message: fmt.Sprintf("%q is not a known Az cmdlet; did you mean %q?", name, suggestion)}}
+		}
+		return nil
+	}
+	return azCmdletPolicy(command, cmdlet)
+}
+
+// azCmdletPolicy runs the policy rules for an Az cmdlet
+func azCmdletPolicy(command cliCommand, cmdlet string) []Finding {
+	options := parseOptions(command.Words[1:])
+	line := command.Line
+
+	switch cmdlet {
+	case "New-AzNetworkSecurityRuleConfig", "Add-AzNetworkSecurityRuleConfig", "Set-AzNetworkSecurityRuleConfig":
+		access, _ := options.value("-access")
+		direction, _ := options.value("-direction")
+		protocol, hasProtocol := options.value("-protocol")
+		if !strings.EqualFold(access, "Allow") || !strings.EqualFold(direction, "Inbound") ||
+			(hasProtocol && protocol != "*" && !strings.EqualFold(protocol, "Tcp")) {
+			return nil
+		}
+		for _, source := range options.values("-sourceaddressprefix") {
+			if !internetSources[strings.ToLower(source)] {
+				continue
+			}
+			for _, admin := range adminPorts {
+				if portRangesInclude(options.values("-destinationportrange"), admin.Port) {
+					return []Finding{openPortFinding(line, admin.Name, admin.Port, source)}
+				}
+			}
+		}
+	case "New-AzStorageAccount", "Set-AzStorageAccount":
+		var findings []Finding
+		if allow, ok := options.value("-allowblobpublicaccess"); ok && strings.EqualFold(allow, "$true") {
+			findings = append(findings, Finding{Line: line, Severity: SeverityError, Rule: RulePublicStorage,
+				Message: "-AllowBlobPublicAccess $true allows anonymous blob reads; set it to $false"})
+		}
+		if httpsOnly, ok := options.value("-enablehttpstrafficonly"); ok && strings.EqualFold(httpsOnly, "$false") {
+			findings = append(findings, Finding{Line: line, Severity: SeverityWarning, Rule: RuleEncryption,
+				Message: "-EnableHttpsTrafficOnly $false accepts unencrypted HTTP; set it to $true"})
+		}
+		if version, ok := options.value("-minimumtlsversion"); ok && weakTLSVersions[version] {
+			findings = append(findings, Finding{Line: line, Severity: SeverityWarning, Rule: RuleEncryption,
+				Message: fmt.Sprintf("minimum TLS version %s allows deprecated protocols; use TLS1_2", version)})
+		}
+		return findings
+	case "New-AzStorageContainer", "Set-AzStorageContainerAcl":
+		if permission, ok := options.value("-permission"); ok && (strings.EqualFold(permission, "Blob") || strings.EqualFold(permission, "Container")) {
+			return []Finding{{Line: line, Severity: SeverityError, Rule: RulePublicStorage,
+				Message: fmt.Sprintf("-Permission %s allows anonymous reads; use Off", permission)}}
+		}
+	}
+	return nil
+}
+
+// psTokenizer splits a PowerShell script into simple commands. It understands comments,
+// strings, here-strings, escapes and delimiters, which is enough to find unbalanced code and
+// the words of each command; it is not a full PowerShell parser.
+type psTokenizer struct {
+	source []rune
+	pos    int
+	line   int
+
+	commands []cliCommand
+	current  cliCommand
+	word     strings.Builder
+	inWord   bool
+	literal  bool
+	open     []psDelimiter
+	err      *Finding
+}
+
+// psDelimiter is an open bracket and the line it was opened on
+type psDelimiter struct {
+	char      rune
+	line      int
+	hashtable bool
+}
+
+// newPSTokenizer returns a tokenizer for the script
+func newPSTokenizer(code string) *psTokenizer {
+	return &psTokenizer{source: []rune(code), line: 1}
+}
+
+// peek returns the rune at an offset from the current position, or 0 past the end
+func (t *psTokenizer) peek(offset int) rune {
+	if t.pos+offset < len(t.source) {
+		return t.source[t.pos+offset]
+	}
+	return 0
+}
+
+// fail records the first syntax error
+func (t *psTokenizer) fail(line int, format string, args ...any) {
+	if t.err == nil {
+		t.err = &Finding{Line: line, Severity: SeverityError, Rule: RuleSyntax, Message: fmt.Sprintf(format, args...)}
+	}
+}
+
+// run tokenizes the whole script
+func (t *psTokenizer) run() {
+	for t.pos < len(t.source) && t.err == nil {
+		c := t.source[t.pos]
+		switch {
+		case c == '\n':
+			t.endStatement()
+			t.line++
+			t.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			t.endWord()
+			t.pos++
+		case c == '`':
+			t.escape()
+		case c == '#' && !t.inWord:
+			t.skipLineComment()
+		case c == '<' && t.peek(1) == '#':
+			t.skipBlockComment()
+		case c == '@' && (t.peek(1) == '"' || t.peek(1) == '\'') && !t.inWord:
+			t.readHereString()
+		case c == '\'':
+			t.readSingleQuoted()
+		case c == '"':
+			t.readDoubleQuoted()
+		case c == '@' && t.peek(1) == '{':
+			// A hashtable literal is an argument of the command around it
+			t.endWord()
+			t.open = append(t.open, psDelimiter{char: '{', line: t.line, hashtable: true})
+			t.pos += 2
+		case c == '(' || c == '{':
+			t.endStatement()
+			t.open = append(t.open, psDelimiter{char: c, line: t.line})
+			t.pos++
+		case c == '[':
+			t.endWord()
+			t.open = append(t.open, psDelimiter{char: c, line: t.line})
+			t.pos++
+		case c == ')' || c == '}' || c == ']':
+			if hashtable := t.close(c); hashtable || c == ']' {
+				t.endWord()
+			} else {
+				t.endStatement()
+			}
+			t.pos++
+		case c == ';' || c == '|' || c == '&':
+			t.endStatement()
+			t.pos++
+		default:
+			t.appendWord(c, c != '$')
+			t.pos++
+		}
+	}
+	if t.err != nil {
+		return
+	}
+	t.endStatement()
+	if len(t.open) > 0 {
+		unclosed := t.open[len(t.open)-1]
+		t.fail(unclosed.line, "missing closing '%c' for the '%c' opened here", closingDelimiters[unclosed.char], unclosed.char)
+	}
+}
+
+// startWord starts a word unless one is in progress
+func (t *psTokenizer) startWord() {
+	if !t.inWord {
+		t.inWord, t.literal = true, true
+	}
+}
+
+// appendWord adds a rune to the current word. A word stops being literal once it contains a
+// variable.
+func (t *psTokenizer) appendWord(c rune, literal bool) {
+	t.startWord()
+	t.word.WriteRune(c)
+	t.literal = t.literal && literal
+}
+
+// endWord finishes the current word
+func (t *psTokenizer) endWord() {
+	if !t.inWord {
+		return
+	}
+	value := t.word.String()
+	literal := t.literal || psValueConstants[strings.ToLower(value)]
+	if len(t.current.Words) == 0 {
+		t.current.Line = t.line
+	}
+	t.current.Words = append(t.current.Words, cliWord{Value: value, Literal: literal})
+	t.word.Reset()
+	t.inWord = false
+}
+
+// endStatement finishes the current command
+func (t *psTokenizer) endStatement() {
+	t.endWord()
+	if len(t.current.Words) > 0 {
+		t.commands = append(t.commands, t.current)
+	}
+	t.current = cliCommand{}
+}
+
+// close pops the delimiter closed by c and reports whether it closed a hashtable literal
+func (t *psTokenizer) close(c rune) bool {
+	if len(t.open) == 0 {
+		t.fail(t.line, "unexpected '%c' without a matching opening delimiter", c)
+		return false
+	}
+	top := t.open[len(t.open)-1]
+	if closingDelimiters[top.char] != c {
+		t.fail(t.line, "unexpected '%c'; the '%c' opened on line %d is not closed", c, top.char, top.line)
+		return false
+	}
+	t.open = t.open[:len(t.open)-1]
+	return top.hashtable
+}
+
+// escape handles a backtick, which escapes the next character or continues the line
+func (t *psTokenizer) escape() {
+	next := t.peek(1)
+	switch next {
+	case '\n':
+		t.endWord()
+		t.line++
+		t.pos += 2
+	case '\r':
+		t.endWord()
+		t.pos += 2
+	case 0:
+		t.pos++
+	default:
+		t.appendWord(next, true)
+		t.pos += 2
+	}
+}
+
+// skipLineComment skips a # comment up to the end of the line
+func (t *psTokenizer) skipLineComment() {
+	for t.pos < len(t.source) && t.source[t.pos] != '\n' {
+		t.pos++
+	}
+}
+
+// skipBlockComment skips a <# ... #> comment
+func (t *psTokenizer) skipBlockComment() {
+	start := t.line
+	t.pos += 2
+	for t.pos < len(t.source) {
+		if t.source[t.pos] == '#' && t.peek(1) == '>' {
+			t.pos += 2
+			return
+		}
+		if t.source[t.pos] == '\n' {
+			t.line++
+		}
+		t.pos++
+	}
+	t.fail(start, "block comment is not closed with '#>'")
+}
+
+// readSingleQuoted reads a verbatim string, where ” is an escaped quote
+func (t *psTokenizer) readSingleQuoted() {
+	start := t.line
+	t.startWord()
+	t.pos++
+	for t.pos < len(t.source) {
+		c := t.source[t.pos]
+		if c == '\'' {
+			if t.peek(1) == '\'' {
+				t.word.WriteRune('\'')
+				t.pos += 2
+				continue
+			}
+			t.pos++
+			return
+		}
+		if c == '\n' {
+			t.line++
+		}
+		t.word.WriteRune(c)
+		t.pos++
+	}
+	t.fail(start, "string is missing its closing quote (')")
+}
+
+// readDoubleQuoted reads an expandable string. Strings with variables or subexpressions are
+// not literal.
+func (t *psTokenizer) readDoubleQuoted() {
+	start := t.line
+	t.startWord()
+	t.pos++
+	for t.pos < len(t.source) {
+		c := t.source[t.pos]
+		switch {
+		case c == '`' && t.pos+1 < len(t.source):
+			t.word.WriteRune(t.source[t.pos+1])
+			t.pos += 2
+			continue
+		case c == '"' && t.peek(1) == '"':
+			t.word.WriteRune('"')
+			t.pos += 2
+			continue
+		case c == '"':
+			t.pos++
+			return
+		case c == '$':
+			t.literal = false
+		case c == '\n':
+			t.line++
+		}
+		t.word.WriteRune(c)
+		t.pos++
+	}
+	t.fail(start, "string is missing its closing quote (\")")
+}
+
+// readHereString reads a @' ... '@ or @" ... "@ string. The closing quote has to start a line.
+func (t *psTokenizer) readHereString() {
+	start := t.line
+	quote := t.peek(1)
+	t.pos += 2
+	for t.pos < len(t.source) && t.source[t.pos] != '\n' {
+		if t.source[t.pos] != ' ' && t.source[t.pos] != '\t' && t.source[t.pos] != '\r' {
+			t.fail(start, "here-string header must be followed by a line break")
+			return
+		}
+		t.pos++
+	}
+
+	var content strings.Builder
+	for t.pos < len(t.source) {
+		c := t.source[t.pos]
+		if c == '\n' {
+			t.line++
+			if t.peek(1) == quote && t.peek(2) == '@' {
+				t.pos += 3
+				t.startWord()
+				t.literal = t.literal && quote == '\''
+				t.word.WriteString(strings.TrimPrefix(content.String(), "\n"))
+				return
+			}
+		}
+		content.WriteRune(c)
+		t.pos++
+	}
+	t.fail(start, "here-string is not closed with %c@ at the start of a line", quote)
+}
@@ -0,0 +1,247 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codecheck
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// bundledData holds the provider schemas and the CLI catalogue
+//
+//go:embed data/*.json
+var bundledData embed.FS
+
+// cliCatalogFile is the bundled file with the AWS CLI, Azure CLI and Az PowerShell catalogue
+const cliCatalogFile = "data/cli.json"
+
+// blockSchema lists the arguments and nested blocks of a resource or block. MinItems is the
+// number of times a nested block has to appear.
+type blockSchema struct {
+	Required []string                `json:"required"`
+	Optional []string                `json:"optional"`
+	Blocks   map[string]*blockSchema `json:"blocks"`
+	MinItems int                     `json:"min_items"`
+}
+
+// hasArgument reports whether the block has the argument
+func (b *blockSchema) hasArgument(name string) bool {
+	return contains(b.Required, name) || contains(b.Optional, name)
+}
+
+// argumentNames returns the names of all arguments of the block
+func (b *blockSchema) argumentNames() []string {
+	return append(append([]string{}, b.Required...), b.Optional...)
+}
+
+// blockNames returns the names of the nested blocks, sorted
+func (b *blockSchema) blockNames() []string {
+	names := make([]string, 0, len(b.Blocks))
+	for name := range b.Blocks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providerSchema is a bundled subset of a Terraform provider schema. Resources and data sources
+// that are not bundled are not checked.
+type providerSchema struct {
+	Name              string                  `json:"provider"`
+	Source            string                  `json:"source"`
+	ProviderArguments []string                `json:"provider_arguments"`
+	ProviderBlocks    []string                `json:"provider_blocks"`
+	Resources         map[string]*blockSchema `json:"resources"`
+	DataSources       map[string]*blockSchema `json:"data_sources"`
+}
+
+// loadProviderSchemas reads the bundled provider schemas, keyed by provider name
+func loadProviderSchemas() (map[string]*providerSchema, error) {
+	files, err := bundledData.ReadDir("data")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bundled provider schemas: %w", err)
+	}
+
+	providers := make(map[string]*providerSchema)
+	for _, file := range files {
+		name := path.Join("data", file.Name())
+		if name == cliCatalogFile {
+			continue
+		}
+		data, err := bundledData.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read provider schema %s: %w", name, err)
+		}
+		var schema providerSchema
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return nil, fmt.Errorf("failed to parse provider schema %s: %w", name, err)
+		}
+		if schema.Name == "" {
+			return nil, fmt.Errorf("provider schema %s has no provider name", name)
+		}
+		providers[schema.Name] = &schema
+	}
+	return providers, nil
+}
+
+// cliCatalog lists the AWS CLI services and operations, Azure CLI commands and Az PowerShell
+// cmdlets that snippets are checked against
+type cliCatalog struct {
+	AWS struct {
+		GlobalOptionsWithValues []string            `json:"global_options_with_values"`
+		Services                map[string][]string `json:"services"`
+	} `json:"aws"`
+	Az struct {
+		Commands []string `json:"commands"`
+		Groups   []string `json:"groups"`
+	} `json:"az"`
+	AzPowerShell struct {
+		Cmdlets []string `json:"cmdlets"`
+	} `json:"az_powershell"`
+
+	// azTree indexes the Azure CLI commands by word
+	azTree *commandNode
+	// cmdlets maps lower case cmdlet names to their canonical spelling
+	cmdlets map[string]string
+}
+
+// commandNode is a word in a command path. Command is set when the path up to the node is a
+// complete command.
+type commandNode struct {
+	Children map[string]*commandNode
+	Command  bool
+}
+
+// child returns the node for the word, creating it when needed
+func (n *commandNode) child(word string) *commandNode {
+	if n.Children == nil {
+		n.Children = make(map[string]*commandNode)
+	}
+	next, ok := n.Children[word]
+	if !ok {
+		next = &commandNode{}
+		n.Children[word] = next
+	}
+	return next
+}
+
+// childNames returns the words that can follow the node, sorted
+func (n *commandNode) childNames() []string {
+	names := make([]string, 0, len(n.Children))
+	for name := range n.Children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadCLICatalog reads the bundled CLI catalogue and indexes it
+func loadCLICatalog() (*cliCatalog, error) {
+	data, err := bundledData.ReadFile(cliCatalogFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CLI catalogue: %w", err)
+	}
+	var catalog cliCatalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse CLI catalogue: %w", err)
+	}
+
+	catalog.azTree = &commandNode{}
+	for _, group := range catalog.Az.Groups {
+		node := catalog.azTree
+		for _, word := range strings.Fields(group) {
+			node = node.child(word)
+		}
+	}
+	for _, command := range catalog.Az.Commands {
+		node := catalog.azTree
+		for _, word := range strings.Fields(command) {
+			node = node.child(word)
+		}
+		node.Command = true
+	}
+
+	catalog.cmdlets = make(map[string]string, len(catalog.AzPowerShell.Cmdlets))
+	for _, cmdlet := range catalog.AzPowerShell.Cmdlets {
+		catalog.cmdlets[strings.ToLower(cmdlet)] = cmdlet
+	}
+	return &catalog, nil
+}
+
+// contains reports whether the list has the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns the known name closest to name when it is close enough to be a likely typo,
+// or "" when there is none. Case differences count as typos.
+func suggest(name string, known []string) string {
+	best, bestDistance := "", -1
+	lower := strings.ToLower(name)
+	for _, candidate := range known {
+		if candidate == name {
+			return ""
+		}
+		distance := editDistance(lower, strings.ToLower(candidate))
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if best == "" || !isLikelyTypo(lower, bestDistance) {
+		return ""
+	}
+	return best
+}
+
+// isLikelyTypo reports whether an edit distance is small relative to the name's length. A
+// single edit is a typo in names of three or more characters, two edits in names of six or more.
+func isLikelyTypo(name string, distance int) bool {
+	return distance <= 2 && distance*3 <= len(name)
+}
+
+// editDistance is the Damerau-Levenshtein distance with adjacent transpositions
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codecheck
+
+import (
+	"errors"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// commandPrefixes are commands that run the command following them
+var commandPrefixes = map[string]bool{
+	"sudo": true, "exec": true, "time": true, "command": true, "nohup": true,
+}
+
+// validateShell parses a bash script and checks its AWS and Azure CLI commands
+func (v *Validator) validateShell(code string) []Finding {
+	parser := syntax.NewParser(syntax.Variant(syntax.LangBash))
+	file, err := parser.Parse(strings.NewReader(code), "")
+	var findings []Finding
+	if err != nil {
+		// Placeholders such as <bucket-name> read as redirections; check the script without them
+		replaced, placeholders := replacePlaceholders(code)
+		if len(placeholders) == 0 {
+			return []Finding{shellErrorFinding(err)}
+		}
+		if file, err = parser.Parse(strings.NewReader(replaced), ""); err != nil {
+			return []Finding{shellErrorFinding(err)}
+		}
+		findings = placeholderFinding(placeholders)
+	}
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		call, ok := node.(*syntax.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		command := cliCommand{Line: int(call.Args[0].Pos().Line())}
+		for _, arg := range call.Args {
+			command.Words = append(command.Words, shellWord(arg))
+		}
+		for len(command.Words) > 1 && commandPrefixes[command.name()] {
+			command.Words = command.Words[1:]
+		}
+		findings = append(findings, v.checkCLICommand(command)...)
+		return true
+	})
+	return findings
+}
+
+// shellErrorFinding converts a shell parser error to a finding
+func shellErrorFinding(err error) Finding {
+	finding := Finding{Severity: SeverityError, Rule: RuleSyntax, Message: err.Error()}
+	var parseErr syntax.ParseError
+	var langErr syntax.LangError
+	switch {
+	case errors.As(err, &parseErr):
+		finding.Line, finding.Message = int(parseErr.Pos.Line()), parseErr.Text
+	case errors.As(err, &langErr):
+		finding.Line = int(langErr.Pos.Line())
+		finding.Message = langErr.Feature + " is not supported by bash"
+	}
+	return finding
+}
+
+// shellWord returns the value of a word when it is made of literals and quoted literals only
+func shellWord(word *syntax.Word) cliWord {
+	var value strings.Builder
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			value.WriteString(part.Value)
+		case *syntax.SglQuoted:
+			value.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range part.Parts {
+				lit, ok := inner.(*syntax.Lit)
+				if !ok {
+					return cliWord{}
+				}
+				value.WriteString(lit.Value)
+			}
+		default:
+			return cliWord{}
+		}
+	}
+	return cliWord{Value: value.String(), Literal: true}
+}
@@ -0,0 +1,326 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codecheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// terraformFilename names the snippet in parser diagnostics
+const terraformFilename = "main.tf"
+
+// topLevelBlocks are the block types Terraform accepts at the top level of a module
+var topLevelBlocks = []string{
+	"terraform", "provider", "variable", "output", "locals", "module", "resource", "data",
+	"moved", "import", "removed", "check",
+}
+
+// metaArguments are the arguments every resource and data source accepts
+var metaArguments = map[string]bool{
+	"count": true, "for_each": true, "provider": true, "depends_on": true,
+}
+
+// metaBlocks are the nested blocks every resource accepts. Data sources accept lifecycle only.
+var metaBlocks = map[string]bool{
+	"lifecycle": true, "provisioner": true, "connection": true,
+}
+
+// validateTerraform parses Terraform code and checks it against the bundled provider schemas
+// and the policy rules
+func (v *Validator) validateTerraform(code string) []Finding {
+	file, diags := hclsyntax.ParseConfig([]byte(code), terraformFilename, hcl.InitialPos)
+	findings := diagnosticFindings(diags)
+	if diags.HasErrors() {
+		return findings
+	}
+
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return findings
+	}
+	for name, attribute := range body.Attributes {
+		findings = append(findings, Finding{
+			Line: attribute.SrcRange.Start.Line, Severity: SeverityError, Rule: RuleSyntax,
+			Message: fmt.Sprintf("argument %q is not allowed at the top level of a Terraform file", name),
+		})
+	}
+	for _, block := range body.Blocks {
+		findings = append(findings, v.checkTopLevelBlock(block)...)
+	}
+	return findings
+}
+
+// diagnosticFindings converts HCL parser diagnostics to findings
+func diagnosticFindings(diags hcl.Diagnostics) []Finding {
+	var findings []Finding
+	for _, diag := range diags {
+		finding := Finding{Severity: SeverityWarning, Rule: RuleSyntax, Message: diag.Summary}
+		if diag.Severity == hcl.DiagError {
+			finding.Severity = SeverityError
+		}
+		if diag.Detail != "" {
+			finding.Message += ": " + strings.TrimSuffix(diag.Detail, ".")
+		}
+		if diag.Subject != nil {
+			finding.Line = diag.Subject.Start.Line
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// checkTopLevelBlock checks a resource, data source or provider block against its schema
+func (v *Validator) checkTopLevelBlock(block *hclsyntax.Block) []Finding {
+	line := block.TypeRange.Start.Line
+	switch block.Type {
+	case "resource", "data":
+		if len(block.Labels) != 2 {
+			return []Finding{{Line: line, Severity: SeverityError, Rule: RuleSyntax,
+				Message: fmt.Sprintf("%s block needs a type and a name label", block.Type)}}
+		}
+		return v.checkResource(block)
+	case "provider":
+		if len(block.Labels) != 1 {
+			return []Finding{{Line: line, Severity: SeverityError, Rule: RuleSyntax,
+				Message: "provider block needs the provider name as its only label"}}
+		}
+		return v.checkProvider(block)
+	}
+
+	if contains(topLevelBlocks, block.Type) {
+		return nil
+	}
+	message := fmt.Sprintf("block type %q is not allowed at the top level of a Terraform file", block.Type)
+	if suggestion := suggest(block.Type, topLevelBlocks); suggestion != "" {
+		message += fmt.Sprintf("; did you mean %q?", suggestion)
+	}
+	return []Finding{{Line: line, Severity: SeverityError, Rule: RuleSyntax, Message: message}}
+}
+
+// checkProvider checks the arguments of a provider configuration block
+func (v *Validator) checkProvider(block *hclsyntax.Block) []Finding {
+	name := block.Labels[0]
+	line := block.LabelRanges[0].Start.Line
+	provider, ok := v.providers[name]
+	if !ok {
+		if suggestion := suggest(name, v.providerNames()); suggestion != "" {
+			return []Finding{{Line: line, Severity: SeverityError, Rule: RuleUnknownProvider,
+				Message: fmt.Sprintf("unknown provider %q; did you mean %q?", name, suggestion)}}
+		}
+		return nil
+	}
+
+	schema := &blockSchema{
+		Optional: append([]string{"version"}, provider.ProviderArguments...),
+		Blocks:   make(map[string]*blockSchema),
+	}
+	for _, nested := range provider.ProviderBlocks {
+		schema.Blocks[nested] = nil
+	}
+	return checkBody(block.Body, schema, fmt.Sprintf("provider %q", name), nil)
+}
+
+// checkResource checks a resource or data source against its provider's schema and runs the
+// policy rules for its type
+func (v *Validator) checkResource(block *hclsyntax.Block) []Finding {
+	kind, resourceType := "resource", block.Labels[0]
+	if block.Type == "data" {
+		kind = "data source"
+	}
+	line := block.LabelRanges[0].Start.Line
+
+	schema, findings := v.lookupResource(block.Type, resourceType, line)
+	if schema == nil {
+		return findings
+	}
+
+	allowedMeta := metaBlocks
+	if block.Type == "data" {
+		allowedMeta = map[string]bool{"lifecycle": true}
+	}
+	subject := fmt.Sprintf("%s %q", kind, resourceType)
+	findings = append(findings, checkBody(block.Body, schema, subject, allowedMeta)...)
+
+	if block.Type == "resource" {
+		if policy, ok := resourcePolicies[resourceType]; ok {
+			findings = append(findings, policy(block)...)
+		}
+	}
+	return findings
+}
+
+// lookupResource returns the bundled schema for a resource or data source type. Types that are
+// not bundled return no schema, with a finding when they are likely typos of a bundled type.
+func (v *Validator) lookupResource(blockType, resourceType string, line int) (*blockSchema, []Finding) {
+	kind := "resource"
+	if blockType == "data" {
+		kind = "data source"
+	}
+	prefix, suffix, _ := strings.Cut(resourceType, "_")
+
+	provider, ok := v.providers[prefix]
+	if !ok {
+		// A wrong provider prefix such as azure_virtual_network for azurerm_virtual_network
+		for _, candidate := range v.providerNames() {
+			if _, known := v.providers[candidate].types(blockType)[candidate+"_"+suffix]; known && suffix != "" {
+				return nil, []Finding{{Line: line, Severity: SeverityError, Rule: RuleUnknownResource,
+					Message: fmt.Sprintf("unknown %s type %q; did you mean %q?", kind, resourceType, candidate+"_"+suffix)}}
+			}
+		}
+		return nil, nil
+	}
+
+	types := provider.types(blockType)
+	if schema, ok := types[resourceType]; ok {
+		return schema, nil
+	}
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if suggestion := suggest(resourceType, names); suggestion != "" {
+		return nil, []Finding{{Line: line, Severity: SeverityError, Rule: RuleUnknownResource,
+			Message: fmt.Sprintf("the %s provider has no %s type %q; did you mean %q?", provider.Name, kind, resourceType, suggestion)}}
+	}
+	return nil, nil
+}
+
+// types returns the provider's resources or data sources
+func (p *providerSchema) types(blockType string) map[string]*blockSchema {
+	if blockType == "data" {
+		return p.DataSources
+	}
+	return p.Resources
+}
+
+// providerNames returns the bundled provider names, sorted
+func (v *Validator) providerNames() []string {
+	names := make([]string, 0, len(v.providers))
+	for name := range v.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkBody checks the arguments and nested blocks of a body against its schema. A nil nested
+// block schema means the block's contents are not checked. allowedMeta lists the meta blocks
+// the body accepts and is nil for bodies that take no meta-arguments.
+func checkBody(body *hclsyntax.Body, schema *blockSchema, subject string, allowedMeta map[string]bool) []Finding {
+	var findings []Finding
+	known := append(schema.argumentNames(), schema.blockNames()...)
+
+	blockCounts := make(map[string]int)
+	for _, attribute := range sortedAttributes(body) {
+		name := attribute.Name
+		if allowedMeta != nil && metaArguments[name] {
+			continue
+		}
+		if schema.hasArgument(name) {
+			continue
+		}
+		if _, isBlock := schema.Blocks[name]; isBlock {
+			// Attributes-as-blocks such as ingress = [...] are accepted by Terraform
+			blockCounts[name]++
+			continue
+		}
+		findings = append(findings, unknownName(attribute.SrcRange.Start.Line, "argument", name, subject, known))
+	}
+
+	for _, nested := range body.Blocks {
+		line := nested.TypeRange.Start.Line
+		if allowedMeta[nested.Type] {
+			continue
+		}
+
+		name, content := nested.Type, nested.Body
+		if nested.Type == "dynamic" {
+			if len(nested.Labels) != 1 {
+				findings = append(findings, Finding{Line: line, Severity: SeverityError, Rule: RuleSyntax,
+					Message: "dynamic block needs the name of the block it generates as its label"})
+				continue
+			}
+			name, content = nested.Labels[0], dynamicContent(nested.Body)
+		}
+
+		nestedSchema, ok := schema.Blocks[name]
+		switch {
+		case ok:
+			blockCounts[name]++
+			if nestedSchema != nil && content != nil {
+				findings = append(findings, checkBody(content, nestedSchema, fmt.Sprintf("block %q", name), nil)...)
+			}
+		case schema.hasArgument(name):
+			findings = append(findings, Finding{Line: line, Severity: SeverityError, Rule: RuleUnknownArgument,
+				Message: fmt.Sprintf("%s is an argument of %s, not a block; write %s = ...", name, subject, name)})
+		default:
+			findings = append(findings, unknownName(line, "block", name, subject, known))
+		}
+	}
+
+	line := body.SrcRange.Start.Line
+	for _, name := range schema.Required {
+		if _, ok := body.Attributes[name]; !ok {
+			findings = append(findings, Finding{Line: line, Severity: SeverityWarning, Rule: RuleMissingArgument,
+				Message: fmt.Sprintf("%s is missing the required argument %q", subject, name)})
+		}
+	}
+	for _, name := range schema.blockNames() {
+		if nested := schema.Blocks[name]; nested != nil && blockCounts[name] < nested.MinItems {
+			findings = append(findings, Finding{Line: line, Severity: SeverityWarning, Rule: RuleMissingArgument,
+				Message: fmt.Sprintf("%s is missing the required block %q", subject, name)})
+		}
+	}
+	return findings
+}
+
+// unknownName reports an argument or block the schema does not have. Likely typos are errors;
+// other names may come from a newer provider version than the bundled schema and are warnings.
+func unknownName(line int, what, name, subject string, known []string) Finding {
+	if suggestion := suggest(name, known); suggestion != "" {
+		return Finding{Line: line, Severity: SeverityError, Rule: RuleUnknownArgument,
+			Message: fmt.Sprintf("%s has no %s %q; did you mean %q?", subject, what, name, suggestion)}
+	}
+	return Finding{Line: line, Severity: SeverityWarning, Rule: RuleUnknownArgument,
+		Message: fmt.Sprintf("%s has no %s %q in the bundled provider schema", subject, what, name)}
+}
+
+// dynamicContent returns the content block of a dynamic block
+func dynamicContent(body *hclsyntax.Body) *hclsyntax.Body {
+	for _, block := range body.Blocks {
+		if block.Type == "content" {
+			return block.Body
+		}
+	}
+	return nil
+}
+
+// sortedAttributes returns the attributes of a body in source order
+func sortedAttributes(body *hclsyntax.Body) []*hclsyntax.Attribute {
+	attributes := make([]*hclsyntax.Attribute, 0, len(body.Attributes))
+	for _, attribute := range body.Attributes {
+		attributes = append(attributes, attribute)
+	}
+	sort.Slice(attributes, func(i, j int) bool {
+		return attributes[i].SrcRange.Start.Byte < attributes[j].SrcRange.Start.Byte
+	})
+	return attributes
+}
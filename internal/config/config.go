@@ -20,8 +20,10 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/fsnotify/fsnotify"
@@ -37,8 +39,42 @@ const (
 	DefaultConfidenceThreshold = 0.7
 	// DefaultFallbackScoreThreshold defines the default score threshold for fallback search
 	DefaultFallbackScoreThreshold = 0.7
+	// DefaultRetrievalCacheMaxEntries is the default number of retrieval results kept in the cache
+	DefaultRetrievalCacheMaxEntries = 500
+	// DefaultRetrievalCacheTTLSeconds is the default lifetime of a cached retrieval result
+	DefaultRetrievalCacheTTLSeconds = 300
+	// DefaultEmbeddingCacheMaxEntries is the default number of query embeddings kept in the cache
+	DefaultEmbeddingCacheMaxEntries = 1000
+	// DefaultEmbeddingCacheTTLSeconds is the default lifetime of a cached query embedding
+	DefaultEmbeddingCacheTTLSeconds = 60
 	// DefaultMaxWebSearchResults defines the default maximum number of web search results
 	DefaultMaxWebSearchResults = 3
+	// DefaultWebSearchTimeoutSeconds defines the default timeout for web search provider requests
+	DefaultWebSearchTimeoutSeconds = 10
+	// DefaultWebFetchMaxPages is the default number of result pages fetched for content extraction
+	DefaultWebFetchMaxPages = 3
+	// DefaultWebFetchTimeoutSeconds is the default timeout for fetching a single result page
+	DefaultWebFetchTimeoutSeconds = 5
+	// DefaultWebFetchMaxPageBytes is the default cap on the size of a fetched result page
+	DefaultWebFetchMaxPageBytes = 1 << 20
+	// DefaultWebFetchMaxPassages is the default number of extracted passages returned per search
+	DefaultWebFetchMaxPassages = 5
+	// DefaultWebFetchPassageSize is the default passage length in characters
+	DefaultWebFetchPassageSize = 800
+	// DefaultWebCacheMaxEntries is the default number of web search responses kept in the cache
+	DefaultWebCacheMaxEntries = 1000
+	// DefaultWebCacheTTLSeconds is the default lifetime of a cached web search response
+	DefaultWebCacheTTLSeconds = 1800
+	// DefaultWebCacheReleaseTTLSeconds is the default lifetime of a cached response to a
+	// release or announcement query
+	DefaultWebCacheReleaseTTLSeconds = 300
+	// DefaultReleaseNotesKnowledgeBase is the knowledge base that release-note feeds are ingested into
+	DefaultReleaseNotesKnowledgeBase = "freshness"
+	// DefaultReleaseNotesMaxAgeDays is how old a release note may be and still answer a freshness query
+	DefaultReleaseNotesMaxAgeDays = 90
+	// DefaultWebCacheStaleSeconds is how long past expiry a cached response may be served
+	// when the search provider fails
+	DefaultWebCacheStaleSeconds = 86400
 	// DefaultMaxTokens defines the default maximum number of tokens for responses
 	// Increased from 2000 to 4000 to support code generation and architecture diagrams
 	DefaultMaxTokens = 4000
@@ -56,6 +92,33 @@ const (
 	DefaultDiagramCacheExpiryHours = 24
 	// DefaultMaxDiagramSize is the default maximum size for diagrams in bytes
 	DefaultMaxDiagramSize = 10240
+	// DefaultDiagramBackend renders diagrams in process so diagram source never leaves the service
+	DefaultDiagramBackend = "native"
+	// DefaultMaxReadableNodes is the node count above which diagrams are reported as hard to read
+	DefaultMaxReadableNodes = 30
+
+	// DefaultExportBrandName is the organisation name printed on exported deliverables
+	DefaultExportBrandName = "AI SA Assistant"
+	// DefaultExportBrandColor is the hex heading color used in exported deliverables
+	DefaultExportBrandColor = "1F4E79"
+
+	// DefaultKnowledgeBase is the name of the knowledge base backed by chroma.collection_name
+	DefaultKnowledgeBase = "shared"
+
+	// DefaultOpenAIEndpoint is the OpenAI API base URL used when openai.endpoint is empty
+	DefaultOpenAIEndpoint = "https://api.openai.com/v1"
+
+	// DefaultLLMProvider is the chat model provider backed by the openai section. It is
+	// used by services without a route and needs no entry in llm.providers.
+	DefaultLLMProvider = "openai"
+	// DefaultLLMModel and DefaultLLMFastModel are the chat models of openai providers
+	// that name none
+	DefaultLLMModel     = "gpt-4o"
+	DefaultLLMFastModel = "gpt-4o-mini"
+	// LLMServiceSynthesize is the route name of the synthesis service, the only service
+	// that makes chat completions. Embeddings, which every service creates, always use
+	// the openai section and are not routed.
+	LLMServiceSynthesize = "synthesize"
 )
 
 var (
@@ -68,6 +131,7 @@ var (
 // Config represents the complete application configuration
 type Config struct {
 	OpenAI    OpenAIConfig    `mapstructure:"openai"`
+	LLM       LLMConfig       `mapstructure:"llm"`
 	Teams     TeamsConfig     `mapstructure:"teams"`
 	Services  ServicesConfig  `mapstructure:"services"`
 	Chroma    ChromaConfig    `mapstructure:"chroma"`
@@ -76,9 +140,11 @@ type Config struct {
 	WebSearch WebSearchConfig `mapstructure:"websearch"`
 	Synthesis SynthesisConfig `mapstructure:"synthesis"`
 	Diagram   DiagramConfig   `mapstructure:"diagram"`
+	Export    ExportConfig    `mapstructure:"export"`
 	Logging   LoggingConfig   `mapstructure:"logging"`
 	Feedback  FeedbackConfig  `mapstructure:"feedback"`
 	Session   SessionConfig   `mapstructure:"session"`
+	ACL       ACLConfig       `mapstructure:"acl"`
 }
 
 // OpenAIConfig contains OpenAI API configuration
@@ -87,10 +153,48 @@ type OpenAIConfig struct {
 	Endpoint string `mapstructure:"endpoint"`
 }
 
+// LLMConfig configures the chat model providers and routes each service to one of them
+type LLMConfig struct {
+	// Providers are the chat model providers by name
+	Providers map[string]LLMProviderConfig `mapstructure:"providers"`
+	// Routes assign the synthesize service a provider and the models it may use
+	Routes map[string]LLMRouteConfig `mapstructure:"routes"`
+}
+
+// LLMProviderConfig configures a chat model provider
+type LLMProviderConfig struct {
+	// Type is openai, azure, anthropic or openai_compatible; empty uses the provider name
+	Type     string `mapstructure:"type"`
+	Endpoint string `mapstructure:"endpoint"`
+	APIKey   string `mapstructure:"api_key"`
+	// APIVersion is the Azure OpenAI api-version or the anthropic-version header
+	APIVersion string `mapstructure:"api_version"`
+	// Deployments maps model names to Azure OpenAI deployment names
+	Deployments map[string]string `mapstructure:"deployments"`
+	// Model is the chat model of services routed to the provider that name none, and
+	// FastModel the cheaper model used for short answers
+	Model     string `mapstructure:"model"`
+	FastModel string `mapstructure:"fast_model"`
+}
+
+// LLMRouteConfig routes a service's chat completions to a provider
+type LLMRouteConfig struct {
+	// Provider names an entry in llm.providers, or the default openai provider
+	Provider string `mapstructure:"provider"`
+	// FastModel is the cheaper model used for short answers; empty uses the provider's
+	FastModel string `mapstructure:"fast_model"`
+	// Models are the other models a request may select besides the service's own model
+	// and the fast model
+	Models []string `mapstructure:"models"`
+}
+
 // TeamsConfig contains Microsoft Teams configuration
 type TeamsConfig struct {
 	WebhookURL    string `mapstructure:"webhook_url"`
 	WebhookSecret string `mapstructure:"webhook_secret"`
+	// PublicURL is the externally reachable base URL of the Teams bot, used to build the
+	// absolute /teams-export download links Teams cards open
+	PublicURL string `mapstructure:"public_url"`
 }
 
 // ServicesConfig contains internal service URLs
@@ -102,8 +206,76 @@ type ServicesConfig struct {
 
 // ChromaConfig contains ChromaDB configuration
 type ChromaConfig struct {
-	URL            string `mapstructure:"url"`
-	CollectionName string `mapstructure:"collection_name"`
+	URL            string                `mapstructure:"url"`
+	CollectionName string                `mapstructure:"collection_name"`
+	KnowledgeBases []KnowledgeBaseConfig `mapstructure:"knowledge_bases"`
+}
+
+// KnowledgeBaseConfig maps a named knowledge base to its ChromaDB collection
+// and the metadata namespace its documents are stored under
+type KnowledgeBaseConfig struct {
+	Name              string `mapstructure:"name"`
+	CollectionName    string `mapstructure:"collection_name"`
+	MetadataNamespace string `mapstructure:"metadata_namespace"`
+}
+
+// ResolveKnowledgeBases returns the configured knowledge bases. The shared
+// knowledge base is always present and defaults to chroma.collection_name.
+func (c ChromaConfig) ResolveKnowledgeBases() []KnowledgeBaseConfig {
+	knowledgeBases := make([]KnowledgeBaseConfig, 0, len(c.KnowledgeBases)+1)
+	hasDefault := false
+	for _, kb := range c.KnowledgeBases {
+		if NormalizeKnowledgeBaseName(kb.Name) == DefaultKnowledgeBase {
+			hasDefault = true
+		}
+		knowledgeBases = append(knowledgeBases, kb)
+	}
+
+	if !hasDefault {
+		knowledgeBases = append([]KnowledgeBaseConfig{{
+			Name:           DefaultKnowledgeBase,
+			CollectionName: c.CollectionName,
+		}}, knowledgeBases...)
+	}
+
+	return knowledgeBases
+}
+
+// GetKnowledgeBase returns the knowledge base with the given name, compared case-insensitively
+func (c ChromaConfig) GetKnowledgeBase(name string) (KnowledgeBaseConfig, bool) {
+	name = NormalizeKnowledgeBaseName(name)
+	for _, kb := range c.ResolveKnowledgeBases() {
+		if NormalizeKnowledgeBaseName(kb.Name) == name {
+			return kb, true
+		}
+	}
+	return KnowledgeBaseConfig{}, false
+}
+
+// NormalizeKnowledgeBaseName returns the canonical form of a knowledge base name.
+// Knowledge base names are case-insensitive and stored lowercased.
+func NormalizeKnowledgeBaseName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// normalizeKnowledgeBaseNames lowercases every configured knowledge base name so
+// that lookups by request or ingest name compare case-insensitively
+func normalizeKnowledgeBaseNames(config *Config) {
+	for i := range config.Chroma.KnowledgeBases {
+		config.Chroma.KnowledgeBases[i].Name = NormalizeKnowledgeBaseName(config.Chroma.KnowledgeBases[i].Name)
+	}
+	config.WebSearch.ReleaseNotes.KnowledgeBase = NormalizeKnowledgeBaseName(config.WebSearch.ReleaseNotes.KnowledgeBase)
+}
+
+// resolveSynthesisModel takes the synthesis model from the provider of the synthesize
+// route when synthesis.model is not set
+func resolveSynthesisModel(config *Config) {
+	if config.Synthesis.Model != "" {
+		return
+	}
+	if _, provider, err := config.ChatRoute(LLMServiceSynthesize); err == nil {
+		config.Synthesis.Model = provider.Model
+	}
 }
 
 // MetadataConfig contains metadata store configuration
@@ -113,16 +285,88 @@ type MetadataConfig struct {
 
 // RetrievalConfig contains retrieval-specific settings
 type RetrievalConfig struct {
-	MaxChunks              int     `mapstructure:"max_chunks"`
-	FallbackThreshold      int     `mapstructure:"fallback_threshold"`
-	ConfidenceThreshold    float64 `mapstructure:"confidence_threshold"`
-	FallbackScoreThreshold float64 `mapstructure:"fallback_score_threshold"`
+	MaxChunks              int                  `mapstructure:"max_chunks"`
+	FallbackThreshold      int                  `mapstructure:"fallback_threshold"`
+	ConfidenceThreshold    float64              `mapstructure:"confidence_threshold"`
+	FallbackScoreThreshold float64              `mapstructure:"fallback_score_threshold"`
+	Cache                  RetrievalCacheConfig `mapstructure:"cache"`
+}
+
+// RetrievalCacheConfig contains settings for the retrieval result and query embedding caches
+type RetrievalCacheConfig struct {
+	Enabled             bool `mapstructure:"enabled"`
+	MaxEntries          int  `mapstructure:"max_entries"`
+	TTLSeconds          int  `mapstructure:"ttl_seconds"`
+	EmbeddingMaxEntries int  `mapstructure:"embedding_max_entries"`
+	EmbeddingTTLSeconds int  `mapstructure:"embedding_ttl_seconds"`
 }
 
 // WebSearchConfig contains web search configuration
 type WebSearchConfig struct {
 	MaxResults        int      `mapstructure:"max_results"`
 	FreshnessKeywords []string `mapstructure:"freshness_keywords"`
+	// Provider selects the live search API: bing, brave, google or searxng.
+	// Web search is disabled when no provider is configured.
+	Provider       string `mapstructure:"provider"`
+	APIKey         string `mapstructure:"api_key"`
+	Endpoint       string `mapstructure:"endpoint"`
+	SearchEngineID string `mapstructure:"search_engine_id"`
+	Market         string `mapstructure:"market"`
+	TimeoutSeconds int    `mapstructure:"timeout_seconds"`
+	// Fetch controls fetching and extracting the content of top result pages
+	Fetch WebFetchConfig `mapstructure:"fetch"`
+	// Domains filters results by domain and ranks them by domain trust
+	Domains WebDomainPolicyConfig `mapstructure:"domains"`
+	// Cache controls caching of search responses
+	Cache WebCacheConfig `mapstructure:"cache"`
+	// ReleaseNotes answers freshness queries from ingested release-note feeds before
+	// falling back to live search
+	ReleaseNotes ReleaseNotesConfig `mapstructure:"release_notes"`
+}
+
+// ReleaseNotesConfig contains settings for the release-note knowledge base
+type ReleaseNotesConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// KnowledgeBase must also be listed in chroma.knowledge_bases
+	KnowledgeBase string `mapstructure:"knowledge_base"`
+	// MaxAgeDays is how old a release note may be and still count as fresh. Queries
+	// that name dates use the period they name instead.
+	MaxAgeDays int `mapstructure:"max_age_days"`
+}
+
+// WebCacheConfig contains web search response cache settings
+type WebCacheConfig struct {
+	// StorageType is "memory", or "sqlite" to keep cached responses across restarts
+	StorageType       string `mapstructure:"storage_type"`
+	DBPath            string `mapstructure:"db_path"`
+	MaxEntries        int    `mapstructure:"max_entries"`
+	TTLSeconds        int    `mapstructure:"ttl_seconds"`
+	ReleaseTTLSeconds int    `mapstructure:"release_ttl_seconds"`
+	// StaleSeconds is how long past expiry a response may be served when the provider fails
+	StaleSeconds int `mapstructure:"stale_seconds"`
+}
+
+// WebDomainPolicyConfig lists the domains web results may come from. Each entry also
+// matches its subdomains.
+type WebDomainPolicyConfig struct {
+	Allow     []string `mapstructure:"allow"`
+	Deny      []string `mapstructure:"deny"`
+	Preferred []string `mapstructure:"preferred"`
+}
+
+// WebFetchConfig contains settings for fetching result pages and extracting relevant passages
+type WebFetchConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	MaxPages       int      `mapstructure:"max_pages"`
+	TimeoutSeconds int      `mapstructure:"timeout_seconds"`
+	MaxPageBytes   int      `mapstructure:"max_page_bytes"`
+	AllowedDomains []string `mapstructure:"allowed_domains"`
+	RespectRobots  bool     `mapstructure:"respect_robots"`
+	UserAgent      string   `mapstructure:"user_agent"`
+	MaxPassages    int      `mapstructure:"max_passages"`
+	PassageSize    int      `mapstructure:"passage_size"`
+	// AllowPrivateNetworks permits fetching loopback, private and link-local addresses
+	AllowPrivateNetworks bool `mapstructure:"allow_private_networks"`
 }
 
 // SynthesisConfig contains synthesis service configuration
@@ -138,15 +382,146 @@ type SynthesisConfig struct {
 	BackoffMultiplier        float64 `mapstructure:"backoff_multiplier"`
 	EnableAdaptiveTimeout    bool    `mapstructure:"enable_adaptive_timeout"`
 	EnablePromptOptimization bool    `mapstructure:"enable_prompt_optimization"`
+	// UnverifiedWebCitations is "strip" to remove cited URLs that web search did not
+	// return from the answer, or "flag" to keep them and mark them as unverified
+	UnverifiedWebCitations string `mapstructure:"unverified_web_citations"`
+	// OutputMode is "text" to parse the answer from free-form markdown, or "structured"
+	// to request a schema-validated JSON answer and fall back to text when it is invalid
+	OutputMode      string                        `mapstructure:"output_mode"`
+	Grounding       SynthesisGroundingConfig      `mapstructure:"grounding"`
+	PromptTemplates SynthesisPromptTemplateConfig `mapstructure:"prompt_templates"`
+	Plan            SynthesisPlanConfig           `mapstructure:"plan"`
+	Comparison      SynthesisComparisonConfig     `mapstructure:"comparison"`
+	CodeValidation  SynthesisCodeValidationConfig `mapstructure:"code_validation"`
+	CostEstimation  SynthesisCostEstimationConfig `mapstructure:"cost_estimation"`
+	Injection       SynthesisInjectionConfig      `mapstructure:"injection"`
+	Routing         SynthesisRoutingConfig        `mapstructure:"routing"`
+}
+
+// SynthesisGroundingConfig contains settings for checking answer claims against the
+// context they were synthesized from
+type SynthesisGroundingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// EntailmentCheck confirms claims aligned to context with an LLM entailment check;
+	// without it lexical overlap alone decides whether a claim is supported
+	EntailmentCheck bool `mapstructure:"entailment_check"`
+	// MinScore is the fraction of supported claims below which Action is applied
+	MinScore float64 `mapstructure:"min_score"`
+	// Action is "annotate", "regenerate" or "block"
+	Action             string  `mapstructure:"action"`
+	SupportThreshold   float64 `mapstructure:"support_threshold"`
+	CandidateThreshold float64 `mapstructure:"candidate_threshold"`
+}
+
+// SynthesisPromptTemplateConfig contains settings for loading synthesis prompts from
+// versioned template files instead of the built-in prompt
+type SynthesisPromptTemplateConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Directory string `mapstructure:"directory"`
+	// HotReload reloads the templates when files in Directory change
+	HotReload bool `mapstructure:"hot_reload"`
+	// Experiment selects the templates of the named experiment when they serve the query
+	Experiment string `mapstructure:"experiment"`
+}
+
+// SynthesisPlanConfig contains settings for the plan synthesis mode, which generates an
+// outline and then each of its sections before assembling them into one document.
+// Zero values fall back to the defaults.
+type SynthesisPlanConfig struct {
+	// MaxSections caps the number of sections an outline may have
+	MaxSections int `mapstructure:"max_sections"`
+	// MaxParallelSections is the number of sections generated concurrently
+	MaxParallelSections int `mapstructure:"max_parallel_sections"`
+	SectionMaxTokens    int `mapstructure:"section_max_tokens"`
+	// MaxContinuations is the number of times a section cut off at the token limit is continued
+	MaxContinuations int `mapstructure:"max_continuations"`
+	// SectionRetrieval searches the retrieve service once per section for targeted context
+	SectionRetrieval bool `mapstructure:"section_retrieval"`
+	// SectionChunks is the number of retrieved chunks added to each section's context
+	SectionChunks int `mapstructure:"section_chunks"`
+}
+
+// SynthesisComparisonConfig contains settings for the compare synthesis mode, which
+// retrieves context per cloud platform and returns a side-by-side comparison.
+// Zero values fall back to the defaults.
+type SynthesisComparisonConfig struct {
+	// PlatformChunks is the number of chunks retrieved for each compared platform
+	PlatformChunks int `mapstructure:"platform_chunks"`
+	// MaxTokens is the completion token limit of the comparison
+	MaxTokens int `mapstructure:"max_tokens"`
+}
+
+// SynthesisCodeValidationConfig contains settings for validating generated Terraform, shell
+// and PowerShell snippets against their parsers, bundled provider schemas and policy rules
+type SynthesisCodeValidationConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Action is "annotate" to attach findings to the snippets, or "drop" to also remove
+	// snippets with errors from the answer
+	Action string `mapstructure:"action"`
+}
+
+// SynthesisCostEstimationConfig contains settings for pricing business queries and plans
+// with local price-list snapshots instead of letting the model estimate costs
+type SynthesisCostEstimationConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// SnapshotDirectory holds price-list snapshots that replace bundled ones of older versions
+	SnapshotDirectory string `mapstructure:"snapshot_directory"`
+}
+
+// SynthesisInjectionConfig contains settings for screening retrieved chunks and web
+// results for prompt injection before they are added to the synthesis prompt
+type SynthesisInjectionConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Classifier also scores every item with an LLM classifier; without it the heuristics
+	// alone score the items
+	Classifier bool `mapstructure:"classifier"`
+	// ClassifierModel is the classifier's model; empty uses the synthesis model
+	ClassifierModel string `mapstructure:"classifier_model"`
+	// NeutralizeThreshold is the injection score at which suspicious spans are replaced
+	NeutralizeThreshold float64 `mapstructure:"neutralize_threshold"`
+	// QuarantineThreshold is the injection score at which an item is left out of the prompt
+	QuarantineThreshold float64 `mapstructure:"quarantine_threshold"`
+}
+
+// SynthesisRoutingConfig contains settings for choosing the synthesis model by query
+// complexity and falling back to other models when the chosen one is unavailable
+type SynthesisRoutingConfig struct {
+	// Enabled sends simple queries to SimpleModel and complex queries, plans and
+	// comparisons to ComplexModel; medium queries, and every query when disabled, use synthesis.model
+	Enabled bool `mapstructure:"enabled"`
+	// SimpleModel is the cheaper model for simple queries; empty uses the synthesize
+	// route's fast model
+	SimpleModel string `mapstructure:"simple_model"`
+	// ComplexModel is the stronger model for complex queries, plans and comparisons;
+	// empty uses synthesis.model
+	ComplexModel string `mapstructure:"complex_model"`
+	// Fallbacks are tried in order when a model is rate limited or its circuit breaker is open
+	Fallbacks []string `mapstructure:"fallbacks"`
 }
 
 // DiagramConfig contains diagram rendering configuration
 type DiagramConfig struct {
+	// Backend is "native" (rendered in process) or "mermaid_ink" (sends diagrams to mermaid.ink)
+	Backend        string `mapstructure:"backend"`
 	MermaidInkURL  string `mapstructure:"mermaid_ink_url"`
+	PublicURL      string `mapstructure:"public_url"`
+	StorageDir     string `mapstructure:"storage_dir"`
 	Timeout        int    `mapstructure:"timeout_seconds"`
 	CacheExpiry    int    `mapstructure:"cache_expiry_hours"`
 	EnableCaching  bool   `mapstructure:"enable_caching"`
 	MaxDiagramSize int    `mapstructure:"max_diagram_size"`
+	// MaxReadableNodes is the node count above which generated diagrams are reported as hard to read
+	MaxReadableNodes int `mapstructure:"max_readable_nodes"`
+	// ModelRepair sends diagrams the linter cannot repair back to the model once with their errors
+	ModelRepair bool `mapstructure:"model_repair"`
+}
+
+// ExportConfig contains the branding applied to exported DOCX, PDF and Markdown deliverables
+type ExportConfig struct {
+	BrandName  string `mapstructure:"brand_name"`
+	BrandColor string `mapstructure:"brand_color"`
+	Author     string `mapstructure:"author"`
+	Footer     string `mapstructure:"footer"`
 }
 
 // LoggingConfig contains logging configuration
@@ -163,6 +538,17 @@ type FeedbackConfig struct {
 	DBPath      string `mapstructure:"db_path"`
 }
 
+// ACLConfig contains document access control configuration
+type ACLConfig struct {
+	// TrustedProxyHeaders accepts the X-User-Groups and X-User-Clearance headers on
+	// incoming web UI and Teams requests, and every identity header including X-User-ID
+	// on retrieval requests. Enable on the front ends only when an authenticating proxy
+	// sets these headers and strips any supplied by the client. The retrieve service
+	// needs it for user and group access control to apply, and must then only be
+	// reachable by the front-end services.
+	TrustedProxyHeaders bool `mapstructure:"trusted_proxy_headers"`
+}
+
 // SessionConfig contains session management configuration
 type SessionConfig struct {
 	StorageType           string `mapstructure:"storage_type"`
@@ -237,6 +623,8 @@ func LoadWithOptions(opts LoadOptions) (*Config, error) {
 	if err := v.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	normalizeKnowledgeBaseNames(&config)
+	resolveSynthesisModel(&config)
 
 	// Validate configuration
 	if opts.ValidateRequired && !opts.TestMode {
@@ -251,9 +639,16 @@ func LoadWithOptions(opts LoadOptions) (*Config, error) {
 // setDefaults sets default configuration values
 func setDefaults(v *viper.Viper) {
 	// OpenAI defaults
-	v.SetDefault("openai.endpoint", "https://api.openai.com/v1")
+	v.SetDefault("openai.endpoint", DefaultOpenAIEndpoint)
+
+	// Chat model routing defaults
+	v.SetDefault("llm.routes.synthesize.provider", DefaultLLMProvider)
+	v.SetDefault("llm.routes.synthesize.fast_model", "")
+	v.SetDefault("llm.routes.synthesize.models", []string{"gpt-4-turbo"})
 
 	// Service defaults
+	v.SetDefault("teams.public_url", "")
+
 	v.SetDefault("services.retrieve_url", "http://retrieve:8081")
 	v.SetDefault("services.websearch_url", "http://websearch:8083")
 	v.SetDefault("services.synthesize_url", "http://synthesize:8082")
@@ -270,18 +665,49 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("retrieval.fallback_threshold", DefaultFallbackThreshold)
 	v.SetDefault("retrieval.confidence_threshold", DefaultConfidenceThreshold)
 	v.SetDefault("retrieval.fallback_score_threshold", DefaultFallbackScoreThreshold)
+	v.SetDefault("retrieval.cache.enabled", true)
+	v.SetDefault("retrieval.cache.max_entries", DefaultRetrievalCacheMaxEntries)
+	v.SetDefault("retrieval.cache.ttl_seconds", DefaultRetrievalCacheTTLSeconds)
+	v.SetDefault("retrieval.cache.embedding_max_entries", DefaultEmbeddingCacheMaxEntries)
+	v.SetDefault("retrieval.cache.embedding_ttl_seconds", DefaultEmbeddingCacheTTLSeconds)
 
 	// Web search defaults
 	v.SetDefault("websearch.max_results", DefaultMaxWebSearchResults)
+	v.SetDefault("websearch.provider", "")
+	v.SetDefault("websearch.timeout_seconds", DefaultWebSearchTimeoutSeconds)
+	v.SetDefault("websearch.fetch.enabled", false)
+	v.SetDefault("websearch.fetch.max_pages", DefaultWebFetchMaxPages)
+	v.SetDefault("websearch.fetch.timeout_seconds", DefaultWebFetchTimeoutSeconds)
+	v.SetDefault("websearch.fetch.max_page_bytes", DefaultWebFetchMaxPageBytes)
+	v.SetDefault("websearch.fetch.allowed_domains", []string{})
+	v.SetDefault("websearch.fetch.respect_robots", true)
+	v.SetDefault("websearch.fetch.user_agent", "")
+	v.SetDefault("websearch.fetch.max_passages", DefaultWebFetchMaxPassages)
+	v.SetDefault("websearch.fetch.passage_size", DefaultWebFetchPassageSize)
+	v.SetDefault("websearch.cache.storage_type", "memory")
+	v.SetDefault("websearch.cache.db_path", "./websearch_cache.db")
+	v.SetDefault("websearch.cache.max_entries", DefaultWebCacheMaxEntries)
+	v.SetDefault("websearch.cache.ttl_seconds", DefaultWebCacheTTLSeconds)
+	v.SetDefault("websearch.cache.release_ttl_seconds", DefaultWebCacheReleaseTTLSeconds)
+	v.SetDefault("websearch.cache.stale_seconds", DefaultWebCacheStaleSeconds)
+	v.SetDefault("websearch.release_notes.enabled", true)
+	v.SetDefault("websearch.release_notes.knowledge_base", DefaultReleaseNotesKnowledgeBase)
+	v.SetDefault("websearch.release_notes.max_age_days", DefaultReleaseNotesMaxAgeDays)
+	v.SetDefault("websearch.domains.allow", []string{})
+	v.SetDefault("websearch.domains.deny", []string{})
+	v.SetDefault("websearch.domains.preferred", []string{
+		"aws.amazon.com", "learn.microsoft.com", "cloud.google.com",
+	})
+	// Dates such as "Q3 2025" or "last quarter" are detected relative to the current
+	// date, so they are not listed here
 	v.SetDefault("websearch.freshness_keywords", []string{
 		"latest", "recent", "update", "new", "current", "announced", "release",
-		"Q1 2025", "Q2 2025", "Q3 2025", "Q4 2025", "2025", "2024",
 		"reinvent", "ignite", "build", "preview", "ga", "general availability",
 		"compliance feature", "security update",
 	})
 
 	// Synthesis defaults
-	v.SetDefault("synthesis.model", "gpt-4o")
+	v.SetDefault("synthesis.model", "")
 	v.SetDefault("synthesis.max_tokens", DefaultMaxTokens)
 	v.SetDefault("synthesis.temperature", DefaultTemperature)
 	v.SetDefault("synthesis.timeout_seconds", 30)
@@ -291,14 +717,58 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("synthesis.backoff_multiplier", 2.0)
 	v.SetDefault("synthesis.enable_adaptive_timeout", true)
 	v.SetDefault("synthesis.enable_prompt_optimization", true)
+	v.SetDefault("synthesis.unverified_web_citations", "strip")
+	v.SetDefault("synthesis.output_mode", "text")
+	v.SetDefault("synthesis.grounding.enabled", false)
+	v.SetDefault("synthesis.grounding.entailment_check", true)
+	v.SetDefault("synthesis.grounding.min_score", 0.7)
+	v.SetDefault("synthesis.grounding.action", "annotate")
+	v.SetDefault("synthesis.grounding.support_threshold", 0.6)
+	v.SetDefault("synthesis.grounding.candidate_threshold", 0.25)
+	v.SetDefault("synthesis.prompt_templates.enabled", false)
+	v.SetDefault("synthesis.prompt_templates.directory", "./configs/prompts")
+	v.SetDefault("synthesis.prompt_templates.hot_reload", true)
+	v.SetDefault("synthesis.prompt_templates.experiment", "")
+	v.SetDefault("synthesis.plan.max_sections", 8)
+	v.SetDefault("synthesis.plan.max_parallel_sections", 3)
+	v.SetDefault("synthesis.plan.section_max_tokens", 2000)
+	v.SetDefault("synthesis.plan.max_continuations", 2)
+	v.SetDefault("synthesis.plan.section_retrieval", true)
+	v.SetDefault("synthesis.plan.section_chunks", 5)
+	v.SetDefault("synthesis.comparison.platform_chunks", 5)
+	v.SetDefault("synthesis.comparison.max_tokens", 3000)
+	v.SetDefault("synthesis.code_validation.enabled", true)
+	v.SetDefault("synthesis.code_validation.action", "annotate")
+	v.SetDefault("synthesis.cost_estimation.enabled", true)
+	v.SetDefault("synthesis.cost_estimation.snapshot_directory", "")
+	v.SetDefault("synthesis.injection.enabled", true)
+	v.SetDefault("synthesis.injection.classifier", false)
+	v.SetDefault("synthesis.injection.classifier_model", "")
+	v.SetDefault("synthesis.injection.neutralize_threshold", 0.4)
+	v.SetDefault("synthesis.injection.quarantine_threshold", 0.8)
+	v.SetDefault("synthesis.routing.enabled", false)
+	v.SetDefault("synthesis.routing.simple_model", "")
+	v.SetDefault("synthesis.routing.complex_model", "")
+	v.SetDefault("synthesis.routing.fallbacks", []string{})
 
 	// Diagram defaults
+	v.SetDefault("diagram.backend", DefaultDiagramBackend)
 	v.SetDefault("diagram.mermaid_ink_url", "https://mermaid.ink/img")
+	v.SetDefault("diagram.public_url", "")
+	v.SetDefault("diagram.storage_dir", "")
+	v.SetDefault("diagram.max_readable_nodes", DefaultMaxReadableNodes)
+	v.SetDefault("diagram.model_repair", true)
 	v.SetDefault("diagram.timeout_seconds", DefaultDiagramTimeoutSeconds)
 	v.SetDefault("diagram.cache_expiry_hours", DefaultDiagramCacheExpiryHours)
 	v.SetDefault("diagram.enable_caching", true)
 	v.SetDefault("diagram.max_diagram_size", DefaultMaxDiagramSize)
 
+	// Export defaults
+	v.SetDefault("export.brand_name", DefaultExportBrandName)
+	v.SetDefault("export.brand_color", DefaultExportBrandColor)
+	v.SetDefault("export.author", DefaultExportBrandName)
+	v.SetDefault("export.footer", "")
+
 	// Logging defaults
 	v.SetDefault("logging.level", "info")
 	v.SetDefault("logging.format", "json")
@@ -317,6 +787,9 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("session.cleanup_interval_minutes", 5)
 	v.SetDefault("session.max_history_length", 20)
 	v.SetDefault("session.enable_conversation_api", true)
+
+	// Access control defaults
+	v.SetDefault("acl.trusted_proxy_headers", false)
 }
 
 // setConfigFile sets the configuration file path with fallback logic
@@ -365,18 +838,25 @@ func setConfigFile(v *viper.Viper, configPath string) error {
 func setEnvironmentMappings(v *viper.Viper) {
 	// Map common environment variables
 	envMappings := map[string]string{
-		"OPENAI_API_KEY":       "openai.apikey", // pragma: allowlist secret
-		"OPENAI_ENDPOINT":      "openai.endpoint",
-		"TEAMS_WEBHOOK_URL":    "teams.webhook_url",
-		"TEAMS_WEBHOOK_SECRET": "teams.webhook_secret", // pragma: allowlist secret
-		"CHROMA_URL":           "chroma.url",
-		"METADATA_DB_PATH":     "metadata.db_path",
-		"LOG_LEVEL":            "logging.level",
-		"LOG_FORMAT":           "logging.format",
-		"LOG_OUTPUT":           "logging.output",
-		"SESSION_STORAGE_TYPE": "session.storage_type",
-		"SESSION_REDIS_URL":    "session.redis_url",
-		"SESSION_TTL_MINUTES":  "session.default_ttl_minutes",
+		"OPENAI_API_KEY":        "openai.apikey", // pragma: allowlist secret
+		"OPENAI_ENDPOINT":       "openai.endpoint",
+		"AZURE_OPENAI_API_KEY":  "llm.providers.azure.api_key", // pragma: allowlist secret
+		"AZURE_OPENAI_ENDPOINT": "llm.providers.azure.endpoint",
+		"ANTHROPIC_API_KEY":     "llm.providers.anthropic.api_key", // pragma: allowlist secret
+		"TEAMS_WEBHOOK_URL":     "teams.webhook_url",
+		"TEAMS_WEBHOOK_SECRET":  "teams.webhook_secret", // pragma: allowlist secret
+		"CHROMA_URL":            "chroma.url",
+		"METADATA_DB_PATH":      "metadata.db_path",
+		"LOG_LEVEL":             "logging.level",
+		"LOG_FORMAT":            "logging.format",
+		"LOG_OUTPUT":            "logging.output",
+		"SESSION_STORAGE_TYPE":  "session.storage_type",
+		"SESSION_REDIS_URL":     "session.redis_url",
+		"SESSION_TTL_MINUTES":   "session.default_ttl_minutes",
+		"WEBSEARCH_PROVIDER":    "websearch.provider",
+		"WEBSEARCH_API_KEY":     "websearch.api_key", // pragma: allowlist secret
+		"WEBSEARCH_ENDPOINT":    "websearch.endpoint",
+		"WEBSEARCH_ENGINE_ID":   "websearch.search_engine_id",
 	}
 
 	for envVar, configKey := range envMappings {
@@ -405,6 +885,13 @@ func validateConfig(config *Config) error {
 		})
 	}
 
+	if config.Teams.PublicURL != "" && !isHTTPURL(config.Teams.PublicURL) {
+		errors = append(errors, ValidationError{
+			Field:   "teams.public_url",
+			Message: "public_url must be an absolute http or https URL",
+		})
+	}
+
 	// Validate URLs
 	if config.Chroma.URL == "" {
 		errors = append(errors, ValidationError{
@@ -413,6 +900,31 @@ func validateConfig(config *Config) error {
 		})
 	}
 
+	knowledgeBaseNames := make(map[string]bool)
+	for i, kb := range config.Chroma.KnowledgeBases {
+		field := fmt.Sprintf("chroma.knowledge_bases[%d]", i)
+		name := NormalizeKnowledgeBaseName(kb.Name)
+		if name == "" {
+			errors = append(errors, ValidationError{
+				Field:   field + ".name",
+				Message: "knowledge base name is required",
+			})
+		} else if knowledgeBaseNames[name] {
+			errors = append(errors, ValidationError{
+				Field:   field + ".name",
+				Message: fmt.Sprintf("duplicate knowledge base name: %s", kb.Name),
+			})
+		}
+		knowledgeBaseNames[name] = true
+
+		if kb.CollectionName == "" {
+			errors = append(errors, ValidationError{
+				Field:   field + ".collection_name",
+				Message: "knowledge base collection_name is required",
+			})
+		}
+	}
+
 	// Validate numeric values
 	if config.Retrieval.MaxChunks <= 0 {
 		errors = append(errors, ValidationError{
@@ -442,6 +954,26 @@ func validateConfig(config *Config) error {
 		})
 	}
 
+	if config.Retrieval.Cache.Enabled {
+		cacheLimits := []struct {
+			field string
+			value int
+		}{
+			{"retrieval.cache.max_entries", config.Retrieval.Cache.MaxEntries},
+			{"retrieval.cache.ttl_seconds", config.Retrieval.Cache.TTLSeconds},
+			{"retrieval.cache.embedding_max_entries", config.Retrieval.Cache.EmbeddingMaxEntries},
+			{"retrieval.cache.embedding_ttl_seconds", config.Retrieval.Cache.EmbeddingTTLSeconds},
+		}
+		for _, limit := range cacheLimits {
+			if limit.value <= 0 {
+				errors = append(errors, ValidationError{
+					Field:   limit.field,
+					Message: "must be greater than 0 when the retrieval cache is enabled",
+				})
+			}
+		}
+	}
+
 	// Validate synthesis configuration
 	if config.Synthesis.TimeoutSeconds < 5 || config.Synthesis.TimeoutSeconds > 300 {
 		errors = append(errors, ValidationError{
@@ -478,6 +1010,54 @@ func validateConfig(config *Config) error {
 		})
 	}
 
+	switch config.Synthesis.UnverifiedWebCitations {
+	case "", "strip", "flag":
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.unverified_web_citations",
+			Message: "unverified_web_citations must be one of: strip, flag",
+		})
+	}
+
+	switch config.Synthesis.OutputMode {
+	case "", "text", "structured":
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.output_mode",
+			Message: "output_mode must be one of: text, structured",
+		})
+	}
+
+	errors = append(errors, validateGroundingConfig(config.Synthesis.Grounding)...)
+
+	if config.Synthesis.PromptTemplates.Enabled && strings.TrimSpace(config.Synthesis.PromptTemplates.Directory) == "" {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.prompt_templates.directory",
+			Message: "directory is required when prompt templates are enabled",
+		})
+	}
+
+	errors = append(errors, validatePlanConfig(config.Synthesis.Plan)...)
+	errors = append(errors, validateComparisonConfig(config.Synthesis.Comparison)...)
+	errors = append(errors, validateInjectionConfig(config.Synthesis.Injection)...)
+	errors = append(errors, validateRoutingConfig(config.Synthesis.Routing)...)
+	errors = append(errors, validateLLMConfig(config.LLM, config.OpenAI)...)
+	if config.Synthesis.Model == "" {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.model",
+			Message: "model is required when the provider of llm.routes.synthesize names no model",
+		})
+	}
+
+	switch config.Synthesis.CodeValidation.Action {
+	case "", "annotate", "drop":
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.code_validation.action",
+			Message: "action must be one of: annotate, drop",
+		})
+	}
+
 	if config.WebSearch.MaxResults <= 0 {
 		errors = append(errors, ValidationError{
 			Field:   "websearch.max_results",
@@ -485,6 +1065,59 @@ func validateConfig(config *Config) error {
 		})
 	}
 
+	errors = append(errors, validateWebSearchProvider(config.WebSearch)...)
+
+	deniedDomains := make(map[string]bool)
+	for _, domain := range config.WebSearch.Domains.Deny {
+		deniedDomains[strings.ToLower(strings.TrimSpace(domain))] = true
+	}
+	for _, domain := range append(config.WebSearch.Domains.Allow, config.WebSearch.Domains.Preferred...) {
+		if deniedDomains[strings.ToLower(strings.TrimSpace(domain))] {
+			errors = append(errors, ValidationError{
+				Field:   "websearch.domains.deny",
+				Message: fmt.Sprintf("domain %q is both denied and allowed or preferred", domain),
+			})
+		}
+	}
+
+	if config.WebSearch.Fetch.Enabled {
+		fetchLimits := []struct {
+			field string
+			value int
+		}{
+			{"websearch.fetch.max_pages", config.WebSearch.Fetch.MaxPages},
+			{"websearch.fetch.timeout_seconds", config.WebSearch.Fetch.TimeoutSeconds},
+			{"websearch.fetch.max_page_bytes", config.WebSearch.Fetch.MaxPageBytes},
+			{"websearch.fetch.max_passages", config.WebSearch.Fetch.MaxPassages},
+			{"websearch.fetch.passage_size", config.WebSearch.Fetch.PassageSize},
+		}
+		for _, limit := range fetchLimits {
+			if limit.value <= 0 {
+				errors = append(errors, ValidationError{
+					Field:   limit.field,
+					Message: "must be greater than 0 when page fetching is enabled",
+				})
+			}
+		}
+	}
+
+	errors = append(errors, validateWebCache(config.WebSearch.Cache)...)
+
+	if config.WebSearch.ReleaseNotes.Enabled {
+		if strings.TrimSpace(config.WebSearch.ReleaseNotes.KnowledgeBase) == "" {
+			errors = append(errors, ValidationError{
+				Field:   "websearch.release_notes.knowledge_base",
+				Message: "knowledge_base is required when release notes are enabled",
+			})
+		}
+		if config.WebSearch.ReleaseNotes.MaxAgeDays <= 0 {
+			errors = append(errors, ValidationError{
+				Field:   "websearch.release_notes.max_age_days",
+				Message: "max_age_days must be greater than 0 when release notes are enabled",
+			})
+		}
+	}
+
 	if config.Synthesis.MaxTokens <= 0 {
 		errors = append(errors, ValidationError{
 			Field:   "synthesis.max_tokens",
@@ -500,10 +1133,32 @@ func validateConfig(config *Config) error {
 	}
 
 	// Validate diagram configuration
-	if config.Diagram.MermaidInkURL == "" {
+	validDiagramBackends := []string{"native", "mermaid_ink"}
+	if !contains(validDiagramBackends, config.Diagram.Backend) {
+		errors = append(errors, ValidationError{
+			Field:   "diagram.backend",
+			Message: fmt.Sprintf("diagram backend must be one of: %s", strings.Join(validDiagramBackends, ", ")),
+		})
+	}
+
+	if config.Diagram.Backend == "mermaid_ink" && config.Diagram.MermaidInkURL == "" {
 		errors = append(errors, ValidationError{
 			Field:   "diagram.mermaid_ink_url",
-			Message: "mermaid_ink_url is required",
+			Message: "mermaid_ink_url is required when using the mermaid_ink backend",
+		})
+	}
+
+	if config.Diagram.MaxReadableNodes < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "diagram.max_readable_nodes",
+			Message: "max_readable_nodes must not be negative",
+		})
+	}
+
+	if config.Diagram.PublicURL != "" && !isHTTPURL(config.Diagram.PublicURL) {
+		errors = append(errors, ValidationError{
+			Field:   "diagram.public_url",
+			Message: "public_url must be an absolute http or https URL",
 		})
 	}
 
@@ -528,6 +1183,13 @@ func validateConfig(config *Config) error {
 		})
 	}
 
+	if !isHexColor(config.Export.BrandColor) {
+		errors = append(errors, ValidationError{
+			Field:   "export.brand_color",
+			Message: "brand_color must be a six digit hex color such as 1F4E79",
+		})
+	}
+
 	// Validate enum values
 	validLogLevels := []string{"debug", "info", "warn", "error"}
 	if !contains(validLogLevels, config.Logging.Level) {
@@ -641,13 +1303,435 @@ func (c *Config) MaskSensitiveValues() *Config {
 	if masked.Teams.WebhookSecret != "" {
 		masked.Teams.WebhookSecret = maskValue(masked.Teams.WebhookSecret)
 	}
+	if masked.WebSearch.APIKey != "" {
+		masked.WebSearch.APIKey = maskValue(masked.WebSearch.APIKey)
+	}
 	if masked.Session.RedisURL != "" {
 		masked.Session.RedisURL = maskValue(masked.Session.RedisURL)
 	}
+	if len(masked.LLM.Providers) > 0 {
+		providers := make(map[string]LLMProviderConfig, len(masked.LLM.Providers))
+		for name, provider := range masked.LLM.Providers {
+			if provider.APIKey != "" {
+				provider.APIKey = maskValue(provider.APIKey)
+			}
+			providers[name] = provider
+		}
+		masked.LLM.Providers = providers
+	}
 
 	return &masked
 }
 
+// validateWebSearchProvider checks that the selected web search provider has the settings it needs
+func validateWebSearchProvider(webSearch WebSearchConfig) []ValidationError {
+	var errors []ValidationError
+
+	provider := strings.ToLower(strings.TrimSpace(webSearch.Provider))
+	if provider == "" {
+		return nil
+	}
+
+	switch provider {
+	case "bing", "brave", "google":
+		if webSearch.APIKey == "" {
+			errors = append(errors, ValidationError{
+				Field:   "websearch.api_key",
+				Message: fmt.Sprintf("api_key is required for the %s provider", provider),
+			})
+		}
+		if provider == "google" && webSearch.SearchEngineID == "" {
+			errors = append(errors, ValidationError{
+				Field:   "websearch.search_engine_id",
+				Message: "search_engine_id is required for the google provider",
+			})
+		}
+	case "searxng":
+		if webSearch.Endpoint == "" {
+			errors = append(errors, ValidationError{
+				Field:   "websearch.endpoint",
+				Message: "endpoint is required for the searxng provider",
+			})
+		}
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "websearch.provider",
+			Message: "provider must be one of: bing, brave, google, searxng",
+		})
+	}
+
+	if webSearch.TimeoutSeconds <= 0 {
+		errors = append(errors, ValidationError{
+			Field:   "websearch.timeout_seconds",
+			Message: "timeout_seconds must be greater than 0",
+		})
+	}
+
+	return errors
+}
+
+// validateWebCache validates the web search cache settings. Zero lifetimes and sizes
+// fall back to the websearch package defaults.
+func validateWebCache(cache WebCacheConfig) []ValidationError {
+	var errors []ValidationError
+
+	switch cache.StorageType {
+	case "", "memory":
+	case "sqlite":
+		if strings.TrimSpace(cache.DBPath) == "" {
+			errors = append(errors, ValidationError{
+				Field:   "websearch.cache.db_path",
+				Message: "db_path is required for sqlite cache storage",
+			})
+		}
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "websearch.cache.storage_type",
+			Message: "storage type must be one of: memory, sqlite",
+		})
+	}
+
+	cacheLimits := []struct {
+		field string
+		value int
+	}{
+		{"websearch.cache.max_entries", cache.MaxEntries},
+		{"websearch.cache.ttl_seconds", cache.TTLSeconds},
+		{"websearch.cache.release_ttl_seconds", cache.ReleaseTTLSeconds},
+		{"websearch.cache.stale_seconds", cache.StaleSeconds},
+	}
+	for _, limit := range cacheLimits {
+		if limit.value < 0 {
+			errors = append(errors, ValidationError{
+				Field:   limit.field,
+				Message: "must not be negative",
+			})
+		}
+	}
+
+	return errors
+}
+
+// validateGroundingConfig validates the synthesis grounding settings
+func validateGroundingConfig(grounding SynthesisGroundingConfig) []ValidationError {
+	var errors []ValidationError
+
+	switch grounding.Action {
+	case "", "annotate", "regenerate", "block":
+	default:
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.grounding.action",
+			Message: "action must be one of: annotate, regenerate, block",
+		})
+	}
+
+	fractions := []struct {
+		field string
+		value float64
+	}{
+		{"synthesis.grounding.min_score", grounding.MinScore},
+		{"synthesis.grounding.support_threshold", grounding.SupportThreshold},
+		{"synthesis.grounding.candidate_threshold", grounding.CandidateThreshold},
+	}
+	for _, fraction := range fractions {
+		if fraction.value < 0 || fraction.value > 1 {
+			errors = append(errors, ValidationError{
+				Field:   fraction.field,
+				Message: "must be between 0 and 1",
+			})
+		}
+	}
+
+	if grounding.CandidateThreshold > grounding.SupportThreshold && grounding.SupportThreshold > 0 {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.grounding.candidate_threshold",
+			Message: "candidate_threshold must not exceed support_threshold",
+		})
+	}
+
+	return errors
+}
+
+// isHTTPURL reports whether value is an absolute http or https URL with a host
+func isHTTPURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// isHexColor reports whether value is a six digit hex color, with or without a leading '#'.
+// An empty value selects the default brand color.
+func isHexColor(value string) bool {
+	if value == "" {
+		return true
+	}
+	value = strings.TrimPrefix(value, "#")
+	if len(value) != 6 {
+		return false
+	}
+	for _, r := range value {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validatePlanConfig validates the plan synthesis settings. Zero values select the defaults.
+func validatePlanConfig(plan SynthesisPlanConfig) []ValidationError {
+	var errors []ValidationError
+
+	if plan.MaxSections != 0 && (plan.MaxSections < 5 || plan.MaxSections > 20) {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.plan.max_sections",
+			Message: "max_sections must be between 5 and 20 to cover phases, workstreams, risks, timeline and costs",
+		})
+	}
+	if plan.MaxParallelSections < 0 || plan.MaxParallelSections > 10 {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.plan.max_parallel_sections",
+			Message: "max_parallel_sections must be between 1 and 10",
+		})
+	}
+	if plan.SectionMaxTokens < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.plan.section_max_tokens",
+			Message: "section_max_tokens must not be negative",
+		})
+	}
+	if plan.MaxContinuations < 0 || plan.MaxContinuations > 5 {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.plan.max_continuations",
+			Message: "max_continuations must be between 0 and 5",
+		})
+	}
+	if plan.SectionChunks < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.plan.section_chunks",
+			Message: "section_chunks must not be negative",
+		})
+	}
+
+	return errors
+}
+
+// validateComparisonConfig validates the comparison synthesis settings. Zero values select the defaults.
+func validateComparisonConfig(comparison SynthesisComparisonConfig) []ValidationError {
+	var errors []ValidationError
+
+	if comparison.PlatformChunks < 0 || comparison.PlatformChunks > 20 {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.comparison.platform_chunks",
+			Message: "platform_chunks must be between 1 and 20",
+		})
+	}
+	if comparison.MaxTokens < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.comparison.max_tokens",
+			Message: "max_tokens must not be negative",
+		})
+	}
+
+	return errors
+}
+
+// ChatRoute returns the route of the named service and the settings of its provider,
+// with the provider type filled in. Services without a route use the default openai
+// provider, which takes its endpoint and API key from the openai section unless
+// llm.providers.openai sets them. Openai providers default their models to
+// DefaultLLMModel and DefaultLLMFastModel.
+func (c *Config) ChatRoute(service string) (LLMRouteConfig, LLMProviderConfig, error) {
+	route := c.LLM.Routes[service]
+	route.Provider = strings.ToLower(strings.TrimSpace(route.Provider))
+	if route.Provider == "" {
+		route.Provider = DefaultLLMProvider
+	}
+
+	provider, ok := c.LLM.Providers[route.Provider]
+	if !ok && route.Provider != DefaultLLMProvider {
+		return route, provider, fmt.Errorf("%w: llm.routes.%s.provider names unknown provider %q",
+			ErrInvalidConfigValue, service, route.Provider)
+	}
+	if provider.Type == "" {
+		provider.Type = route.Provider
+	}
+	provider.Type = strings.ToLower(strings.TrimSpace(provider.Type))
+	if provider.Type == DefaultLLMProvider {
+		if provider.APIKey == "" {
+			provider.APIKey = c.OpenAI.APIKey
+		}
+		if provider.Endpoint == "" {
+			provider.Endpoint = c.OpenAI.Endpoint
+		}
+		if provider.Model == "" {
+			provider.Model = DefaultLLMModel
+		}
+		if provider.FastModel == "" {
+			provider.FastModel = DefaultLLMFastModel
+		}
+	}
+	return route, provider, nil
+}
+
+// validateLLMConfig validates the chat model providers and the routes that use them.
+// Settings a provider needs are only required when a route uses it. Embeddings always
+// use the openai section, so an openai provider routed to another endpoint is rejected
+// rather than splitting chat completions and embeddings across two endpoints.
+func validateLLMConfig(llm LLMConfig, openAI OpenAIConfig) []ValidationError {
+	var errors []ValidationError
+
+	providerNames := make([]string, 0, len(llm.Providers))
+	for name := range llm.Providers {
+		providerNames = append(providerNames, name)
+	}
+	sort.Strings(providerNames)
+
+	for _, name := range providerNames {
+		provider := llm.Providers[name]
+		field := "llm.providers." + name
+		providerType := strings.ToLower(strings.TrimSpace(provider.Type))
+		if providerType == "" {
+			providerType = name
+		}
+		if !contains([]string{"openai", "azure", "anthropic", "openai_compatible"}, providerType) {
+			errors = append(errors, ValidationError{
+				Field:   field + ".type",
+				Message: "type must be one of: openai, azure, anthropic, openai_compatible",
+			})
+		}
+		if provider.Endpoint != "" && !isHTTPURL(provider.Endpoint) {
+			errors = append(errors, ValidationError{
+				Field:   field + ".endpoint",
+				Message: "endpoint must be an http or https URL",
+			})
+		}
+	}
+
+	serviceNames := make([]string, 0, len(llm.Routes))
+	for name := range llm.Routes {
+		serviceNames = append(serviceNames, name)
+	}
+	sort.Strings(serviceNames)
+
+	for _, service := range serviceNames {
+		if service != LLMServiceSynthesize {
+			errors = append(errors, ValidationError{
+				Field:   "llm.routes." + service,
+				Message: fmt.Sprintf("only the %s service can be routed; other services only use OpenAI embeddings", LLMServiceSynthesize),
+			})
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(llm.Routes[service].Provider))
+		if name == "" {
+			name = DefaultLLMProvider
+		}
+		provider, ok := llm.Providers[name]
+		if !ok && name == DefaultLLMProvider {
+			continue
+		}
+		if !ok {
+			errors = append(errors, ValidationError{
+				Field:   "llm.routes." + service + ".provider",
+				Message: fmt.Sprintf("unknown provider %q; add it to llm.providers", name),
+			})
+			continue
+		}
+
+		field := "llm.providers." + name
+		providerType := strings.ToLower(strings.TrimSpace(provider.Type))
+		if providerType == "" {
+			providerType = name
+		}
+		if (providerType == "azure" || providerType == "openai_compatible") && provider.Endpoint == "" {
+			errors = append(errors, ValidationError{
+				Field:   field + ".endpoint",
+				Message: fmt.Sprintf("endpoint is required for the %s provider type", providerType),
+			})
+		}
+		if (providerType == "azure" || providerType == "anthropic") && provider.APIKey == "" {
+			errors = append(errors, ValidationError{
+				Field:   field + ".api_key",
+				Message: fmt.Sprintf("api_key is required for the %s provider type", providerType),
+			})
+		}
+		if providerType == DefaultLLMProvider && provider.Endpoint != "" &&
+			normalizeOpenAIEndpoint(provider.Endpoint) != normalizeOpenAIEndpoint(openAI.Endpoint) {
+			errors = append(errors, ValidationError{
+				Field: field + ".endpoint",
+				Message: "embeddings always use openai.endpoint, so an openai provider cannot use another " +
+					"endpoint; use type openai_compatible to send only chat completions there",
+			})
+		}
+	}
+
+	return errors
+}
+
+// normalizeOpenAIEndpoint returns the OpenAI API base URL an endpoint setting resolves to
+func normalizeOpenAIEndpoint(endpoint string) string {
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if endpoint == "" {
+		return DefaultOpenAIEndpoint
+	}
+	return endpoint
+}
+
+// validateInjectionConfig validates the prompt injection screening settings
+func validateInjectionConfig(injection SynthesisInjectionConfig) []ValidationError {
+	var errors []ValidationError
+
+	thresholds := []struct {
+		field string
+		value float64
+	}{
+		{"synthesis.injection.neutralize_threshold", injection.NeutralizeThreshold},
+		{"synthesis.injection.quarantine_threshold", injection.QuarantineThreshold},
+	}
+	for _, threshold := range thresholds {
+		if threshold.value < 0 || threshold.value > 1 {
+			errors = append(errors, ValidationError{
+				Field:   threshold.field,
+				Message: "must be between 0 and 1",
+			})
+		}
+	}
+
+	if injection.QuarantineThreshold > 0 && injection.NeutralizeThreshold > injection.QuarantineThreshold {
+		errors = append(errors, ValidationError{
+			Field:   "synthesis.injection.neutralize_threshold",
+			Message: "must not be greater than quarantine_threshold",
+		})
+	}
+
+	return errors
+}
+
+// validateRoutingConfig validates the synthesis model routing settings
+func validateRoutingConfig(routing SynthesisRoutingConfig) []ValidationError {
+	var errors []ValidationError
+
+	seen := make(map[string]bool, len(routing.Fallbacks))
+	for i, model := range routing.Fallbacks {
+		field := fmt.Sprintf("synthesis.routing.fallbacks[%d]", i)
+		model = strings.TrimSpace(model)
+		if model == "" {
+			errors = append(errors, ValidationError{
+				Field:   field,
+				Message: "fallback model must not be empty",
+			})
+			continue
+		}
+		if seen[model] {
+			errors = append(errors, ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("fallback model %q is listed more than once", model),
+			})
+		}
+		seen[model] = true
+	}
+
+	return errors
+}
+
 // maskValue masks sensitive values, showing only the first 8 characters
 func maskValue(value string) string {
 	if len(value) <= MaskedValueMinLength {
@@ -224,6 +224,7 @@ func TestConfigValidation(t *testing.T) {
 					Temperature: 0.3,
 				},
 				Diagram: DiagramConfig{
+					Backend:        "native",
 					MermaidInkURL:  "https://mermaid.ink",
 					Timeout:        30,
 					CacheExpiry:    24,
@@ -814,3 +815,607 @@ func TestContains(t *testing.T) {
 		t.Error("Expected contains to return false for empty slice")
 	}
 }
+
+func TestResolveKnowledgeBases(t *testing.T) {
+	chromaConfig := ChromaConfig{
+		CollectionName: "cloud_assistant",
+		KnowledgeBases: []KnowledgeBaseConfig{
+			{Name: "customer", CollectionName: "customer_docs", MetadataNamespace: "customer"},
+		},
+	}
+
+	knowledgeBases := chromaConfig.ResolveKnowledgeBases()
+	if len(knowledgeBases) != 2 {
+		t.Fatalf("Expected 2 knowledge bases, got %d", len(knowledgeBases))
+	}
+	if knowledgeBases[0].Name != DefaultKnowledgeBase || knowledgeBases[0].CollectionName != "cloud_assistant" {
+		t.Errorf("Expected implicit shared knowledge base first, got %+v", knowledgeBases[0])
+	}
+
+	kb, ok := chromaConfig.GetKnowledgeBase("customer")
+	if !ok || kb.CollectionName != "customer_docs" || kb.MetadataNamespace != "customer" {
+		t.Errorf("Expected customer knowledge base, got %+v (found=%v)", kb, ok)
+	}
+
+	if _, ok := chromaConfig.GetKnowledgeBase("unknown"); ok {
+		t.Error("Expected unknown knowledge base lookup to fail")
+	}
+
+	// An explicitly configured shared knowledge base overrides the implicit one
+	chromaConfig.KnowledgeBases = append(chromaConfig.KnowledgeBases,
+		KnowledgeBaseConfig{Name: DefaultKnowledgeBase, CollectionName: "shared_docs"})
+	kb, _ = chromaConfig.GetKnowledgeBase(DefaultKnowledgeBase)
+	if kb.CollectionName != "shared_docs" {
+		t.Errorf("Expected configured shared collection 'shared_docs', got '%s'", kb.CollectionName)
+	}
+	if len(chromaConfig.ResolveKnowledgeBases()) != 2 {
+		t.Errorf("Expected no implicit shared knowledge base when one is configured")
+	}
+}
+
+func TestKnowledgeBaseNamesAreCaseInsensitive(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	configContent := `
+chroma:
+  url: "http://chromadb:8000"
+  knowledge_bases:
+    - name: "Customer-Docs"
+      collection_name: "customer_docs"
+websearch:
+  release_notes:
+    knowledge_base: "Freshness"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadWithOptions(LoadOptions{ConfigPath: configPath, ValidateRequired: false})
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if got := config.Chroma.KnowledgeBases[0].Name; got != "customer-docs" {
+		t.Errorf("Expected knowledge base name to be normalized to 'customer-docs', got '%s'", got)
+	}
+	if got := config.WebSearch.ReleaseNotes.KnowledgeBase; got != "freshness" {
+		t.Errorf("Expected release notes knowledge base to be normalized to 'freshness', got '%s'", got)
+	}
+
+	for _, name := range []string{"customer-docs", "Customer-Docs", " CUSTOMER-DOCS "} {
+		if _, ok := config.Chroma.GetKnowledgeBase(name); !ok {
+			t.Errorf("Expected knowledge base lookup for %q to succeed", name)
+		}
+	}
+
+	// Names that differ only in case are duplicates
+	duplicate := Config{
+		Chroma: ChromaConfig{
+			URL: "http://chromadb:8000",
+			KnowledgeBases: []KnowledgeBaseConfig{
+				{Name: "Team", CollectionName: "team_docs"},
+				{Name: "team", CollectionName: "team_docs_2"},
+			},
+		},
+	}
+	if err := validateConfig(&duplicate); err == nil || !strings.Contains(err.Error(), "duplicate knowledge base name: team") {
+		t.Errorf("Expected duplicate name error for names differing in case, got: %v", err)
+	}
+}
+
+func TestKnowledgeBaseValidation(t *testing.T) {
+	config := Config{
+		Chroma: ChromaConfig{
+			URL: "http://chromadb:8000",
+			KnowledgeBases: []KnowledgeBaseConfig{
+				{Name: "team", CollectionName: "team_docs"},
+				{Name: "team", CollectionName: ""},
+			},
+		},
+	}
+
+	err := validateConfig(&config)
+	if err == nil {
+		t.Fatal("Expected validation error for invalid knowledge bases")
+	}
+	if !strings.Contains(err.Error(), "duplicate knowledge base name: team") {
+		t.Errorf("Expected duplicate name error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "chroma.knowledge_bases[1].collection_name") {
+		t.Errorf("Expected missing collection error, got: %v", err)
+	}
+}
+
+func TestRetrievalCacheValidation(t *testing.T) {
+	config := Config{
+		Retrieval: RetrievalConfig{
+			Cache: RetrievalCacheConfig{Enabled: true, MaxEntries: 100, TTLSeconds: 0, EmbeddingMaxEntries: 10},
+		},
+	}
+
+	err := validateConfig(&config)
+	if err == nil {
+		t.Fatal("Expected validation error for invalid retrieval cache settings")
+	}
+	if !strings.Contains(err.Error(), "retrieval.cache.ttl_seconds") {
+		t.Errorf("Expected ttl_seconds error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "retrieval.cache.embedding_ttl_seconds") {
+		t.Errorf("Expected embedding_ttl_seconds error, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "retrieval.cache.max_entries") {
+		t.Errorf("Did not expect max_entries error, got: %v", err)
+	}
+}
+
+func TestWebFetchValidation(t *testing.T) {
+	config := Config{
+		WebSearch: WebSearchConfig{
+			Fetch: WebFetchConfig{Enabled: true, MaxPages: 3, TimeoutSeconds: 5, MaxPageBytes: 0, MaxPassages: 5},
+		},
+	}
+
+	err := validateConfig(&config)
+	if err == nil {
+		t.Fatal("Expected validation error for invalid fetch settings")
+	}
+	if !strings.Contains(err.Error(), "websearch.fetch.max_page_bytes") {
+		t.Errorf("Expected max_page_bytes error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "websearch.fetch.passage_size") {
+		t.Errorf("Expected passage_size error, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "websearch.fetch.max_pages") {
+		t.Errorf("Did not expect max_pages error, got: %v", err)
+	}
+
+	config.WebSearch.Fetch.Enabled = false
+	if err := validateConfig(&config); err != nil && strings.Contains(err.Error(), "websearch.fetch") {
+		t.Errorf("Did not expect fetch errors when fetching is disabled, got: %v", err)
+	}
+}
+
+func TestWebCacheValidation(t *testing.T) {
+	config := Config{
+		WebSearch: WebSearchConfig{
+			Cache: WebCacheConfig{StorageType: "sqlite", DBPath: " ", MaxEntries: 100, TTLSeconds: -1},
+		},
+	}
+
+	err := validateConfig(&config)
+	if err == nil {
+		t.Fatal("Expected validation error for invalid web cache settings")
+	}
+	if !strings.Contains(err.Error(), "websearch.cache.db_path") {
+		t.Errorf("Expected db_path error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "websearch.cache.ttl_seconds") {
+		t.Errorf("Expected ttl_seconds error, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "websearch.cache.max_entries") {
+		t.Errorf("Did not expect max_entries error, got: %v", err)
+	}
+
+	config.WebSearch.Cache = WebCacheConfig{StorageType: "redis"}
+	err = validateConfig(&config)
+	if err == nil || !strings.Contains(err.Error(), "websearch.cache.storage_type") {
+		t.Errorf("Expected storage_type error, got: %v", err)
+	}
+}
+
+func TestReleaseNotesValidation(t *testing.T) {
+	config := Config{
+		WebSearch: WebSearchConfig{
+			ReleaseNotes: ReleaseNotesConfig{Enabled: true, KnowledgeBase: "", MaxAgeDays: 30},
+		},
+	}
+
+	err := validateConfig(&config)
+	if err == nil {
+		t.Fatal("Expected validation error for invalid release notes settings")
+	}
+	if !strings.Contains(err.Error(), "websearch.release_notes.knowledge_base") {
+		t.Errorf("Expected knowledge_base error, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "websearch.release_notes.max_age_days") {
+		t.Errorf("Did not expect max_age_days error, got: %v", err)
+	}
+
+	config.WebSearch.ReleaseNotes.Enabled = false
+	if err := validateConfig(&config); err != nil && strings.Contains(err.Error(), "websearch.release_notes") {
+		t.Errorf("Did not expect release notes errors when disabled, got: %v", err)
+	}
+}
+
+func TestWebDomainPolicyValidation(t *testing.T) {
+	config := Config{
+		WebSearch: WebSearchConfig{
+			Domains: WebDomainPolicyConfig{
+				Deny:      []string{"example.com"},
+				Preferred: []string{"aws.amazon.com", "Example.com"},
+			},
+		},
+		Synthesis: SynthesisConfig{UnverifiedWebCitations: "drop"},
+	}
+
+	err := validateConfig(&config)
+	if err == nil {
+		t.Fatal("Expected validation error for conflicting domain policy")
+	}
+	if !strings.Contains(err.Error(), "websearch.domains.deny") {
+		t.Errorf("Expected domains.deny error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "synthesis.unverified_web_citations") {
+		t.Errorf("Expected unverified_web_citations error, got: %v", err)
+	}
+}
+
+func TestSynthesisOutputModeValidation(t *testing.T) {
+	config := Config{Synthesis: SynthesisConfig{OutputMode: "json"}}
+
+	err := validateConfig(&config)
+	if err == nil || !strings.Contains(err.Error(), "synthesis.output_mode") {
+		t.Errorf("Expected output_mode error, got: %v", err)
+	}
+
+	for _, mode := range []string{"", "text", "structured"} {
+		config.Synthesis.OutputMode = mode
+		if err := validateConfig(&config); err != nil && strings.Contains(err.Error(), "synthesis.output_mode") {
+			t.Errorf("Did not expect output_mode error for %q, got: %v", mode, err)
+		}
+	}
+}
+
+func TestSynthesisGroundingValidation(t *testing.T) {
+	config := Config{
+		Synthesis: SynthesisConfig{
+			Grounding: SynthesisGroundingConfig{
+				Action:             "rewrite",
+				MinScore:           1.5,
+				SupportThreshold:   0.4,
+				CandidateThreshold: 0.5,
+			},
+		},
+	}
+
+	err := validateConfig(&config)
+	if err == nil {
+		t.Fatal("Expected validation errors for grounding settings")
+	}
+	for _, field := range []string{
+		"synthesis.grounding.action",
+		"synthesis.grounding.min_score",
+		"synthesis.grounding.candidate_threshold",
+	} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected %s error, got: %v", field, err)
+		}
+	}
+
+	if errs := validateGroundingConfig(SynthesisGroundingConfig{
+		Enabled: true, Action: "block", MinScore: 0.7, SupportThreshold: 0.6, CandidateThreshold: 0.25,
+	}); len(errs) != 0 {
+		t.Errorf("Expected valid grounding settings, got: %v", errs)
+	}
+}
+
+func TestSynthesisPromptTemplateValidation(t *testing.T) {
+	config := Config{
+		Synthesis: SynthesisConfig{
+			PromptTemplates: SynthesisPromptTemplateConfig{Enabled: true, Directory: " "},
+		},
+	}
+
+	err := validateConfig(&config)
+	if err == nil || !strings.Contains(err.Error(), "synthesis.prompt_templates.directory") {
+		t.Errorf("Expected synthesis.prompt_templates.directory error, got: %v", err)
+	}
+}
+
+func TestSynthesisPlanValidation(t *testing.T) {
+	config := Config{
+		Synthesis: SynthesisConfig{
+			Plan: SynthesisPlanConfig{
+				MaxSections:         3,
+				MaxParallelSections: 11,
+				MaxContinuations:    -1,
+			},
+		},
+	}
+
+	err := validateConfig(&config)
+	if err == nil {
+		t.Fatal("Expected validation errors for plan settings")
+	}
+	for _, field := range []string{
+		"synthesis.plan.max_sections",
+		"synthesis.plan.max_parallel_sections",
+		"synthesis.plan.max_continuations",
+	} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected %s error, got: %v", field, err)
+		}
+	}
+
+	if errs := validatePlanConfig(SynthesisPlanConfig{}); len(errs) != 0 {
+		t.Errorf("Expected zero plan settings to select the defaults, got: %v", errs)
+	}
+}
+
+func TestSynthesisComparisonValidation(t *testing.T) {
+	errs := validateComparisonConfig(SynthesisComparisonConfig{PlatformChunks: 21, MaxTokens: -1})
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 validation errors, got: %v", errs)
+	}
+	if errs[0].Field != "synthesis.comparison.platform_chunks" || errs[1].Field != "synthesis.comparison.max_tokens" {
+		t.Errorf("Unexpected validation errors: %v", errs)
+	}
+
+	if errs := validateComparisonConfig(SynthesisComparisonConfig{}); len(errs) != 0 {
+		t.Errorf("Expected zero comparison settings to select the defaults, got: %v", errs)
+	}
+}
+
+func TestSynthesisInjectionValidation(t *testing.T) {
+	errs := validateInjectionConfig(SynthesisInjectionConfig{NeutralizeThreshold: 1.5, QuarantineThreshold: -0.1})
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 validation errors, got: %v", errs)
+	}
+
+	errs = validateInjectionConfig(SynthesisInjectionConfig{NeutralizeThreshold: 0.9, QuarantineThreshold: 0.5})
+	if len(errs) != 1 || errs[0].Field != "synthesis.injection.neutralize_threshold" {
+		t.Errorf("Expected neutralize_threshold above quarantine_threshold to be rejected, got: %v", errs)
+	}
+
+	if errs := validateInjectionConfig(SynthesisInjectionConfig{Enabled: true, NeutralizeThreshold: 0.4, QuarantineThreshold: 0.8}); len(errs) != 0 {
+		t.Errorf("Expected default injection settings to be valid, got: %v", errs)
+	}
+}
+
+func TestSynthesisRoutingValidation(t *testing.T) {
+	errs := validateRoutingConfig(SynthesisRoutingConfig{Fallbacks: []string{"gpt-4o-mini", " ", "gpt-4o-mini"}})
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 validation errors, got: %v", errs)
+	}
+	if errs[0].Field != "synthesis.routing.fallbacks[1]" || errs[1].Field != "synthesis.routing.fallbacks[2]" {
+		t.Errorf("Unexpected validation errors: %v", errs)
+	}
+
+	routing := SynthesisRoutingConfig{Enabled: true, ComplexModel: "gpt-4-turbo", Fallbacks: []string{"gpt-4o-mini"}}
+	if errs := validateRoutingConfig(routing); len(errs) != 0 {
+		t.Errorf("Expected routing settings to be valid, got: %v", errs)
+	}
+}
+
+func TestSynthesisCodeValidationValidation(t *testing.T) {
+	config := Config{
+		Synthesis: SynthesisConfig{
+			CodeValidation: SynthesisCodeValidationConfig{Enabled: true, Action: "fix"},
+		},
+	}
+
+	err := validateConfig(&config)
+	if err == nil || !strings.Contains(err.Error(), "synthesis.code_validation.action") {
+		t.Errorf("Expected synthesis.code_validation.action error, got: %v", err)
+	}
+}
+
+func TestExportBrandColorValidation(t *testing.T) {
+	for _, color := range []string{"", "1F4E79", "#c00000"} {
+		if !isHexColor(color) {
+			t.Errorf("Expected %q to be accepted as a brand color", color)
+		}
+	}
+
+	err := validateConfig(&Config{Export: ExportConfig{BrandColor: "navy"}})
+	if err == nil || !strings.Contains(err.Error(), "export.brand_color") {
+		t.Errorf("Expected export.brand_color error, got: %v", err)
+	}
+}
+
+func TestWebSearchProviderValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		webSearch     WebSearchConfig
+		expectedField string
+	}{
+		{
+			name:          "unknown provider",
+			webSearch:     WebSearchConfig{Provider: "duckduckgo", TimeoutSeconds: 10},
+			expectedField: "websearch.provider",
+		},
+		{
+			name:          "brave without api key",
+			webSearch:     WebSearchConfig{Provider: "brave", TimeoutSeconds: 10},
+			expectedField: "websearch.api_key",
+		},
+		{
+			name:          "google without search engine id",
+			webSearch:     WebSearchConfig{Provider: "google", APIKey: "key", TimeoutSeconds: 10},
+			expectedField: "websearch.search_engine_id",
+		},
+		{
+			name:          "searxng without endpoint",
+			webSearch:     WebSearchConfig{Provider: "searxng", TimeoutSeconds: 10},
+			expectedField: "websearch.endpoint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := validateWebSearchProvider(tt.webSearch)
+			if len(errors) != 1 || errors[0].Field != tt.expectedField {
+				t.Errorf("Expected a single %s error, got %v", tt.expectedField, errors)
+			}
+		})
+	}
+
+	if errors := validateWebSearchProvider(WebSearchConfig{}); len(errors) != 0 {
+		t.Errorf("Expected no errors when web search is disabled, got %v", errors)
+	}
+}
+
+func TestDiagramBackendValidation(t *testing.T) {
+	tests := []struct {
+		name          string
+		diagram       DiagramConfig
+		expectedField string
+	}{
+		{"unknown backend", DiagramConfig{Backend: "kroki"}, "diagram.backend"},
+		{"mermaid ink without url", DiagramConfig{Backend: "mermaid_ink"}, "diagram.mermaid_ink_url"},
+		{"relative public url", DiagramConfig{Backend: "native", PublicURL: "bot.example.com"}, "diagram.public_url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfig(&Config{Diagram: tt.diagram})
+			if err == nil || !strings.Contains(err.Error(), tt.expectedField) {
+				t.Errorf("Expected %s error, got: %v", tt.expectedField, err)
+			}
+		})
+	}
+
+	err := validateConfig(&Config{Diagram: DiagramConfig{Backend: "native", PublicURL: "https://bot.example.com"}})
+	if err != nil && (strings.Contains(err.Error(), "diagram.backend") ||
+		strings.Contains(err.Error(), "diagram.mermaid_ink_url") || strings.Contains(err.Error(), "diagram.public_url")) {
+		t.Errorf("Expected the native backend to need no mermaid_ink_url, got: %v", err)
+	}
+}
+
+func TestLLMConfigValidation(t *testing.T) {
+	errs := validateLLMConfig(LLMConfig{
+		Providers: map[string]LLMProviderConfig{
+			"bedrock": {},
+			"azure":   {APIKey: "key", Endpoint: "contoso.openai.azure.com"}, // pragma: allowlist secret
+			"claude":  {Type: "anthropic"},
+		},
+		Routes: map[string]LLMRouteConfig{
+			"synthesize": {Provider: "claude"},
+			"teams":      {Provider: "gemini"},
+		},
+	}, OpenAIConfig{})
+	fields := make([]string, 0, len(errs))
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	expected := []string{
+		"llm.providers.azure.endpoint",
+		"llm.providers.bedrock.type",
+		"llm.providers.claude.api_key",
+		"llm.routes.teams",
+	}
+	if strings.Join(fields, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected errors for %v, got: %v", expected, errs)
+	}
+
+	errs = validateLLMConfig(LLMConfig{Routes: map[string]LLMRouteConfig{"synthesize": {Provider: "gemini"}}}, OpenAIConfig{})
+	if len(errs) != 1 || errs[0].Field != "llm.routes.synthesize.provider" {
+		t.Errorf("Expected an error for the unknown provider, got: %v", errs)
+	}
+
+	valid := LLMConfig{
+		Providers: map[string]LLMProviderConfig{
+			"azure": {APIKey: "key", Endpoint: "https://contoso.openai.azure.com"}, // pragma: allowlist secret
+			"local": {Type: "openai_compatible"},
+		},
+		Routes: map[string]LLMRouteConfig{"synthesize": {Provider: "azure"}},
+	}
+	if errs := validateLLMConfig(valid, OpenAIConfig{}); len(errs) != 0 {
+		t.Errorf("Expected providers without routes to need no settings, got: %v", errs)
+	}
+
+	// Embeddings always use openai.endpoint, so routed openai providers must share it
+	openAI := OpenAIConfig{Endpoint: "https://api.openai.com/v1/"}
+	split := LLMConfig{
+		Providers: map[string]LLMProviderConfig{"openai": {Endpoint: "https://proxy.example.com/v1"}},
+		Routes:    map[string]LLMRouteConfig{"synthesize": {Provider: "openai"}},
+	}
+	errs = validateLLMConfig(split, openAI)
+	if len(errs) != 1 || errs[0].Field != "llm.providers.openai.endpoint" {
+		t.Errorf("Expected an error for an openai provider on another endpoint, got: %v", errs)
+	}
+	split.Routes = map[string]LLMRouteConfig{"synthesize": {}}
+	if errs := validateLLMConfig(split, openAI); len(errs) != 1 {
+		t.Errorf("Expected the default route to be checked too, got: %v", errs)
+	}
+
+	shared := LLMConfig{
+		Providers: map[string]LLMProviderConfig{
+			"openai": {Endpoint: "https://api.openai.com/v1", APIKey: "sk-chat"}, // pragma: allowlist secret
+			"proxy":  {Type: "openai_compatible", Endpoint: "https://proxy.example.com/v1"},
+		},
+		Routes: map[string]LLMRouteConfig{"synthesize": {Provider: "openai"}},
+	}
+	if errs := validateLLMConfig(shared, OpenAIConfig{}); len(errs) != 0 {
+		t.Errorf("Expected an openai provider on the embeddings endpoint to be valid, got: %v", errs)
+	}
+	shared.Routes = map[string]LLMRouteConfig{"synthesize": {Provider: "proxy"}}
+	if errs := validateLLMConfig(shared, openAI); len(errs) != 0 {
+		t.Errorf("Expected openai_compatible providers to use their own endpoint, got: %v", errs)
+	}
+}
+
+func TestChatRoute(t *testing.T) {
+	config := Config{
+		OpenAI: OpenAIConfig{APIKey: "sk-openai", Endpoint: "https://api.openai.com/v1"}, // pragma: allowlist secret
+		LLM: LLMConfig{
+			Providers: map[string]LLMProviderConfig{
+				"azure": {Endpoint: "https://contoso.openai.azure.com", Deployments: map[string]string{"gpt-4o": "prod"}},
+			},
+			Routes: map[string]LLMRouteConfig{
+				"synthesize": {Provider: "Azure", FastModel: "gpt-4o-mini"},
+				"teams":      {Provider: "anthropic"},
+			},
+		},
+	}
+
+	route, provider, err := config.ChatRoute(LLMServiceSynthesize)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if route.Provider != "azure" || route.FastModel != "gpt-4o-mini" || provider.Type != "azure" ||
+		provider.Deployments["gpt-4o"] != "prod" || provider.APIKey != "" {
+		t.Errorf("Unexpected synthesize route %+v with provider %+v", route, provider)
+	}
+
+	route, provider, err = config.ChatRoute("retrieve")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if route.Provider != DefaultLLMProvider || provider.Type != DefaultLLMProvider ||
+		provider.APIKey != "sk-openai" || provider.Endpoint != "https://api.openai.com/v1" {
+		t.Errorf("Expected services without a route to use the openai section, got %+v", provider)
+	}
+
+	if _, _, err := config.ChatRoute("teams"); err == nil {
+		t.Error("Expected an error for a route to an unconfigured provider")
+	}
+
+	if provider.Model != DefaultLLMModel || provider.FastModel != DefaultLLMFastModel {
+		t.Errorf("Expected the openai provider to default its models, got %+v", provider)
+	}
+}
+
+func TestResolveSynthesisModel(t *testing.T) {
+	config := Config{LLM: LLMConfig{
+		Providers: map[string]LLMProviderConfig{"anthropic": {Model: "claude-sonnet-4"}},
+		Routes:    map[string]LLMRouteConfig{LLMServiceSynthesize: {Provider: "anthropic"}},
+	}}
+	resolveSynthesisModel(&config)
+	if config.Synthesis.Model != "claude-sonnet-4" {
+		t.Errorf("Expected the synthesis model of the routed provider, got %q", config.Synthesis.Model)
+	}
+
+	config.Synthesis.Model = "claude-opus-4"
+	resolveSynthesisModel(&config)
+	if config.Synthesis.Model != "claude-opus-4" {
+		t.Errorf("Expected synthesis.model to take precedence, got %q", config.Synthesis.Model)
+	}
+
+	config = Config{}
+	resolveSynthesisModel(&config)
+	if config.Synthesis.Model != DefaultLLMModel {
+		t.Errorf("Expected the openai default model, got %q", config.Synthesis.Model)
+	}
+}
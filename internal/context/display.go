@@ -19,6 +19,7 @@ package context
 
 import (
 	"fmt"
+	"html"
 	"strings"
 	"time"
 
@@ -417,6 +418,11 @@ func formatPipelineVisibility(response synth.SynthesisResponse, config DisplayCo
 		htmlBuilder.WriteString(fmt.Sprintf(`<div class="reasoning">Reasoning: %s</div>`, pipeline.Reasoning))
 	}
 
+	if len(pipeline.InjectionDetections) > 0 {
+		htmlBuilder.WriteString(fmt.Sprintf(`<div class="injection">🛡️ Suspected prompt injection: %s</div>`,
+			html.EscapeString(formatInjectionDetections(pipeline.InjectionDetections))))
+	}
+
 	htmlBuilder.WriteString(`</div></div>`)
 
 	// Text version
@@ -437,6 +443,10 @@ func formatPipelineVisibility(response synth.SynthesisResponse, config DisplayCo
 
 	textBuilder.WriteString(fmt.Sprintf("- Context: %d filtered → %d used\n", pipeline.ContextItemsFiltered, pipeline.ContextItemsUsed))
 
+	if len(pipeline.InjectionDetections) > 0 {
+		textBuilder.WriteString(fmt.Sprintf("- Suspected prompt injection: %s\n", formatInjectionDetections(pipeline.InjectionDetections)))
+	}
+
 	// Markdown version
 	markdownBuilder.WriteString("## 🔍 Pipeline Decisions\n\n")
 	markdownBuilder.WriteString(fmt.Sprintf("- **Query Type**: %s\n", pipeline.QueryType))
@@ -456,7 +466,12 @@ func formatPipelineVisibility(response synth.SynthesisResponse, config DisplayCo
 		}
 	}
 
-	markdownBuilder.WriteString(fmt.Sprintf("- **Context Usage**: %d items filtered → %d used\n\n", pipeline.ContextItemsFiltered, pipeline.ContextItemsUsed))
+	markdownBuilder.WriteString(fmt.Sprintf("- **Context Usage**: %d items filtered → %d used\n", pipeline.ContextItemsFiltered, pipeline.ContextItemsUsed))
+
+	if len(pipeline.InjectionDetections) > 0 {
+		markdownBuilder.WriteString(fmt.Sprintf("- **Suspected Prompt Injection**: %s\n", formatInjectionDetections(pipeline.InjectionDetections)))
+	}
+	markdownBuilder.WriteString("\n")
 
 	return PipelineVisibility{
 		HTML:     htmlBuilder.String(),
@@ -465,6 +480,15 @@ func formatPipelineVisibility(response synth.SynthesisResponse, config DisplayCo
 	}
 }
 
+// formatInjectionDetections lists each suspected source with the action taken on it
+func formatInjectionDetections(detections []synth.InjectionDetection) string {
+	parts := make([]string, len(detections))
+	for i, detection := range detections {
+		parts[i] = fmt.Sprintf("%s (%s, score %.2f)", detection.SourceID, detection.Action, detection.Score)
+	}
+	return strings.Join(parts, ", ")
+}
+
 // formatProcessingStats creates formatted processing statistics
 func formatProcessingStats(stats synth.ProcessingStats, config DisplayConfig) ProcessingStatsView {
 	if !config.ShowProcessingTime && !config.ShowTokenUsage {
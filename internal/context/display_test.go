@@ -15,6 +15,7 @@
 package context
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -138,6 +139,25 @@ func TestCalculateTrustIndicators(t *testing.T) {
 	}
 }
 
+func TestFormatPipelineVisibilityInjectionDetections(t *testing.T) {
+	response := synth.SynthesisResponse{
+		PipelineDecision: synth.PipelineDecisionInfo{
+			InjectionDetections: []synth.InjectionDetection{
+				{SourceID: "https://example.com/<b>", Action: synth.InjectionActionQuarantine, Score: 0.9},
+			},
+		},
+	}
+
+	visibility := formatPipelineVisibility(response, DefaultDisplayConfig())
+
+	if !strings.Contains(visibility.Text, "Suspected prompt injection: https://example.com/<b> (quarantine, score 0.90)") {
+		t.Errorf("Expected the detection in the text view, got: %s", visibility.Text)
+	}
+	if !strings.Contains(visibility.HTML, "https://example.com/&lt;b&gt;") {
+		t.Errorf("Expected the source to be escaped in the HTML view, got: %s", visibility.HTML)
+	}
+}
+
 func TestFormatDuration(t *testing.T) {
 	tests := []struct {
 		ms       int
@@ -0,0 +1,150 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// BackendNative renders diagrams in process, so diagram code never leaves the service
+	BackendNative = "native"
+	// BackendMermaidInk renders diagrams with the public mermaid.ink API. It sends the
+	// diagram code to a third party and is only used when explicitly configured.
+	BackendMermaidInk = "mermaid_ink"
+)
+
+// ImageFormat is the image format a diagram is rendered to
+type ImageFormat string
+
+const (
+	// ImagePNG is a PNG raster image
+	ImagePNG ImageFormat = "png"
+	// ImageSVG is an SVG vector image
+	ImageSVG ImageFormat = "svg"
+)
+
+// ContentType returns the MIME type of the image format
+func (f ImageFormat) ContentType() string {
+	if f == ImageSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// DiagramBackend renders Mermaid diagram code to an image
+type DiagramBackend interface {
+	// Name identifies the backend in logs and health checks
+	Name() string
+	// Render renders the diagram code in the given format
+	Render(ctx context.Context, mermaidCode string, format ImageFormat) ([]byte, error)
+}
+
+// NativeBackend parses, lays out and draws Mermaid flowcharts in process
+type NativeBackend struct{}
+
+// NewNativeBackend creates a native diagram backend
+func NewNativeBackend() *NativeBackend {
+	return &NativeBackend{}
+}
+
+// Name implements DiagramBackend
+func (b *NativeBackend) Name() string {
+	return BackendNative
+}
+
+// Render implements DiagramBackend. Only flowchart and graph diagrams are supported.
+func (b *NativeBackend) Render(ctx context.Context, mermaidCode string, format ImageFormat) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	chart, err := ParseFlowchart(mermaidCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse diagram: %w", err)
+	}
+	layout := LayoutFlowchart(chart)
+
+	if format == ImageSVG {
+		return RenderSVG(layout), nil
+	}
+	return RenderPNG(layout)
+}
+
+// MermaidInkBackend renders diagrams with the mermaid.ink API
+type MermaidInkBackend struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewMermaidInkBackend creates a mermaid.ink backend for the image endpoint baseURL, such as
+// https://mermaid.ink/img
+func NewMermaidInkBackend(baseURL string, httpClient *http.Client) *MermaidInkBackend {
+	return &MermaidInkBackend{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// Name implements DiagramBackend
+func (b *MermaidInkBackend) Name() string {
+	return BackendMermaidInk
+}
+
+// Render implements DiagramBackend. PNGs come from the image endpoint and SVGs from the
+// sibling /svg endpoint.
+func (b *MermaidInkBackend) Render(ctx context.Context, mermaidCode string, format ImageFormat) ([]byte, error) {
+	encodedCode := base64.StdEncoding.EncodeToString([]byte(mermaidCode))
+	apiURL := fmt.Sprintf("%s/%s?type=png", b.baseURL, encodedCode)
+	if format == ImageSVG {
+		apiURL = fmt.Sprintf("%s/svg/%s", strings.TrimSuffix(b.baseURL, "/img"), encodedCode)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "AI-SA-Assistant/1.0")
+	req.Header.Set("Accept", format.ContentType())
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, format.ContentType()) {
+		return nil, fmt.Errorf("unexpected content type: %s", contentType)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(resp.Body, MaxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(image) > MaxImageSize {
+		return nil, fmt.Errorf("diagram image too large: more than %d bytes", MaxImageSize)
+	}
+	return image, nil
+}
@@ -0,0 +1,526 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Provider is the cloud a diagram component belongs to
+type Provider string
+
+const (
+	// ProviderGeneric is a component that belongs to no particular cloud, such as users
+	ProviderGeneric Provider = ""
+	// ProviderAWS is Amazon Web Services
+	ProviderAWS Provider = "aws"
+	// ProviderAzure is Microsoft Azure
+	ProviderAzure Provider = "azure"
+)
+
+// maxKeywordWords is the longest keyword phrase, in words, matched against labels
+const maxKeywordWords = 4
+
+// providerWords name a provider explicitly in a label
+var providerWords = map[string]Provider{
+	"aws":       ProviderAWS,
+	"amazon":    ProviderAWS,
+	"azure":     ProviderAzure,
+	"microsoft": ProviderAzure,
+}
+
+// Component is the cloud service or grouping a flowchart node or subgraph stands for
+type Component struct {
+	// Kind identifies the component, for example "aws.ec2" or "azure.expressroute"
+	Kind     string
+	Provider Provider
+	// Title is the official service name, for example "Amazon EC2"
+	Title string
+	// Group is true for components drawn around others, such as a VPC or subnet
+	Group bool
+}
+
+// componentType describes one kind of component and how each export format draws it
+type componentType struct {
+	Component
+	// keywords are lowercase phrases matched against node labels and IDs
+	keywords []string
+	// drawio is the draw.io cell style
+	drawio string
+	// pumlInclude is the PlantUML standard library file defining pumlMacro. Generic
+	// components use C4 macros, which need no extra include.
+	pumlInclude string
+	pumlMacro   string
+	// d2Icon is the icon path on icons.terrastruct.com, and d2Shape a built-in D2 shape
+	d2Icon  string
+	d2Shape string
+}
+
+// awsResource describes an AWS service drawn with its AWS Architecture Icon
+func awsResource(kind, title, fill, icon, puml, d2Icon string, keywords ...string) *componentType {
+	return &componentType{
+		Component: Component{Kind: "aws." + kind, Provider: ProviderAWS, Title: title},
+		keywords:  keywords,
+		drawio: "sketch=0;outlineConnect=0;fontColor=#232F3E;gradientColor=none;strokeColor=#ffffff;" +
+			"fillColor=" + fill + ";dashed=0;verticalLabelPosition=bottom;verticalAlign=top;align=center;" +
+			"fontSize=12;fontStyle=0;aspect=fixed;shape=mxgraph.aws4.resourceIcon;resIcon=mxgraph.aws4." + icon + ";",
+		pumlInclude: "awslib14/" + puml,
+		pumlMacro:   puml[strings.LastIndex(puml, "/")+1:],
+		d2Icon:      "aws/" + d2Icon,
+	}
+}
+
+// awsGroup describes an AWS grouping drawn as an AWS group box
+func awsGroup(kind, title, style, puml, d2Icon string, keywords ...string) *componentType {
+	return &componentType{
+		Component: Component{Kind: "aws." + kind, Provider: ProviderAWS, Title: title, Group: true},
+		keywords:  keywords,
+		drawio: "points=[];outlineConnect=0;gradientColor=none;fontSize=12;fontStyle=0;container=1;" +
+			"pointerEvents=0;collapsible=0;recursiveResize=0;verticalAlign=top;align=left;spacingLeft=30;" + style,
+		pumlInclude: "awslib14/Groups/" + puml,
+		pumlMacro:   puml + "Group",
+		d2Icon:      "aws/" + d2Icon,
+	}
+}
+
+// azureResource describes an Azure service drawn with its Azure icon
+func azureResource(kind, title, image, puml, d2Icon string, keywords ...string) *componentType {
+	return &componentType{
+		Component: Component{Kind: "azure." + kind, Provider: ProviderAzure, Title: title},
+		keywords:  keywords,
+		drawio: "aspect=fixed;points=[];align=center;fontSize=12;verticalLabelPosition=bottom;verticalAlign=top;" +
+			"shape=image;image=img/lib/azure2/" + image + ";",
+		pumlInclude: "azure/" + puml,
+		pumlMacro:   puml[strings.LastIndex(puml, "/")+1:],
+		d2Icon:      "azure/" + d2Icon,
+	}
+}
+
+// azureGroup describes an Azure grouping. Azure has no group shapes, so it is drawn as a
+// dashed box in the Azure colour, and as a C4 boundary in PlantUML.
+func azureGroup(kind, title, d2Icon string, keywords ...string) *componentType {
+	return &componentType{
+		Component: Component{Kind: "azure." + kind, Provider: ProviderAzure, Title: title, Group: true},
+		keywords:  keywords,
+		drawio: "container=1;collapsible=0;recursiveResize=0;fillColor=none;strokeColor=#0078D4;dashed=1;" +
+			"verticalAlign=top;align=left;spacingLeft=10;fontSize=12;fontColor=#0078D4;",
+		d2Icon: "azure/" + d2Icon,
+	}
+}
+
+// genericComponent describes a component that belongs to no cloud
+func genericComponent(kind, title, icon, pumlMacro, d2Shape string, keywords ...string) *componentType {
+	return &componentType{
+		Component: Component{Kind: "generic." + kind, Title: title},
+		keywords:  keywords,
+		drawio: "sketch=0;outlineConnect=0;fontColor=#232F3E;gradientColor=none;fillColor=#232F3D;strokeColor=none;" +
+			"dashed=0;verticalLabelPosition=bottom;verticalAlign=top;align=center;fontSize=12;fontStyle=0;" +
+			"aspect=fixed;pointerEvents=1;shape=mxgraph.aws4." + icon + ";",
+		pumlMacro: pumlMacro,
+		d2Shape:   d2Shape,
+	}
+}
+
+// AWS category colours from the AWS Architecture Icons
+const (
+	awsCompute     = "#ED7100"
+	awsStorage     = "#7AA116"
+	awsDatabase    = "#C925D1"
+	awsNetworking  = "#8C4FFF"
+	awsIntegration = "#E7157B"
+	awsSecurity    = "#DD344C"
+)
+
+// componentCatalog lists the components we recognise. When several match a label, the first
+// one for the label's provider wins, so specific entries come before general ones.
+var componentCatalog = []*componentType{
+	awsGroup("region", "AWS Region",
+		"shape=mxgraph.aws4.group;grIcon=mxgraph.aws4.group_region;strokeColor=#00A4A6;fillColor=none;fontColor=#147EBA;dashed=1;",
+		"Region", "_Group Icons/Region_light-bg.svg", "aws region", "region"),
+	awsGroup("availability-zone", "Availability Zone",
+		"fillColor=none;strokeColor=#147EBA;dashed=1;fontColor=#147EBA;spacingLeft=10;",
+		"AvailabilityZone", "_Group Icons/Availability-Zone_light-bg.svg", "availability zone", "az"),
+	awsGroup("vpc", "Amazon VPC",
+		"shape=mxgraph.aws4.group;grIcon=mxgraph.aws4.group_vpc2;strokeColor=#8C4FFF;fillColor=none;fontColor=#AAB7B8;dashed=0;",
+		"VPC", "_Group Icons/VPC_light-bg.svg", "vpc", "virtual private cloud"),
+	awsGroup("public-subnet", "Public subnet",
+		"shape=mxgraph.aws4.group;grIcon=mxgraph.aws4.group_security_group;grStroke=0;strokeColor=#7AA116;fillColor=#F2F6E8;fontColor=#248814;dashed=0;",
+		"PublicSubnet", "_Group Icons/Public-subnet_light-bg.svg", "public subnet", "dmz"),
+	awsGroup("private-subnet", "Private subnet",
+		"shape=mxgraph.aws4.group;grIcon=mxgraph.aws4.group_security_group;grStroke=0;strokeColor=#00A4A6;fillColor=#E6F6F7;fontColor=#147EBA;dashed=0;",
+		"PrivateSubnet", "_Group Icons/Private-subnet_light-bg.svg", "private subnet", "subnet"),
+	awsGroup("auto-scaling-group", "Auto Scaling group",
+		"shape=mxgraph.aws4.groupCenter;grIcon=mxgraph.aws4.group_auto_scaling_group;grStroke=1;strokeColor=#D86613;fillColor=none;fontColor=#D86613;dashed=1;",
+		"AutoScalingGroup", "_Group Icons/Auto-Scaling-group_light-bg.svg", "auto scaling group", "asg"),
+	awsGroup("cloud", "AWS Cloud",
+		"shape=mxgraph.aws4.group;grIcon=mxgraph.aws4.group_aws_cloud_alt;strokeColor=#232F3E;fillColor=none;fontColor=#232F3E;dashed=0;",
+		"AWSCloud", "_Group Icons/AWS-Cloud_light-bg.svg", "aws cloud", "aws", "aws account", "amazon web services"),
+
+	awsResource("ec2", "Amazon EC2", awsCompute, "ec2", "Compute/EC2", "Compute/Amazon-EC2.svg",
+		"ec2", "ec2 instance", "instance", "virtual machine", "vm", "server", "web server", "app server", "bastion"),
+	awsResource("lambda", "AWS Lambda", awsCompute, "lambda", "Compute/Lambda", "Compute/AWS-Lambda.svg",
+		"lambda", "function", "serverless function"),
+	awsResource("eks", "Amazon EKS", awsCompute, "eks", "Containers/ElasticKubernetesService",
+		"Compute/Amazon-Elastic-Kubernetes-Service.svg", "eks", "kubernetes", "k8s"),
+	awsResource("ecs", "Amazon ECS", awsCompute, "ecs", "Containers/ElasticContainerService",
+		"Compute/Amazon-Elastic-Container-Service.svg", "ecs", "fargate", "container service"),
+	awsResource("s3", "Amazon S3", awsStorage, "s3", "Storage/SimpleStorageService",
+		"Storage/Amazon-Simple-Storage-Service-S3.svg", "s3", "bucket", "object storage", "simple storage service"),
+	awsResource("efs", "Amazon EFS", awsStorage, "elastic_file_system", "Storage/EFS",
+		"Storage/Amazon-Elastic-File-System_EFS.svg", "efs", "elastic file system", "file share"),
+	awsResource("aurora", "Amazon Aurora", awsDatabase, "aurora", "Database/Aurora", "Database/Amazon-Aurora.svg",
+		"aurora"),
+	awsResource("dynamodb", "Amazon DynamoDB", awsDatabase, "dynamodb", "Database/DynamoDB",
+		"Database/Amazon-DynamoDB.svg", "dynamodb", "dynamo", "nosql"),
+	awsResource("elasticache", "Amazon ElastiCache", awsDatabase, "elasticache", "Database/ElastiCache",
+		"Database/Amazon-ElastiCache.svg", "elasticache", "redis", "memcached", "cache"),
+	awsResource("rds", "Amazon RDS", awsDatabase, "rds", "Database/RDS", "Database/Amazon-RDS.svg",
+		"rds", "database", "db", "sql database", "mysql", "postgres", "postgresql", "sql server", "oracle"),
+	awsResource("elb", "Elastic Load Balancing", awsNetworking, "elastic_load_balancing",
+		"NetworkingContentDelivery/ElasticLoadBalancing",
+		"Networking & Content Delivery/Elastic-Load-Balancing.svg",
+		"elb", "alb", "nlb", "load balancer", "application load balancer", "network load balancer"),
+	awsResource("cloudfront", "Amazon CloudFront", awsNetworking, "cloudfront", "NetworkingContentDelivery/CloudFront",
+		"Networking & Content Delivery/Amazon-CloudFront.svg", "cloudfront", "cdn"),
+	awsResource("route53", "Amazon Route 53", awsNetworking, "route_53", "NetworkingContentDelivery/Route53",
+		"Networking & Content Delivery/Amazon-Route-53.svg", "route 53", "route53", "dns"),
+	awsResource("api-gateway", "Amazon API Gateway", awsIntegration, "api_gateway", "NetworkingContentDelivery/APIGateway",
+		"Networking & Content Delivery/Amazon-API-Gateway.svg", "api gateway", "apigw"),
+	awsResource("direct-connect", "AWS Direct Connect", awsNetworking, "direct_connect",
+		"NetworkingContentDelivery/DirectConnect", "Networking & Content Delivery/AWS-Direct-Connect.svg",
+		"direct connect", "dx", "private circuit"),
+	awsResource("transit-gateway", "AWS Transit Gateway", awsNetworking, "transit_gateway",
+		"NetworkingContentDelivery/TransitGateway", "Networking & Content Delivery/AWS-Transit-Gateway.svg",
+		"transit gateway", "tgw", "hub"),
+	awsResource("vpn", "AWS Site-to-Site VPN", awsNetworking, "site_to_site_vpn",
+		"NetworkingContentDelivery/SiteToSiteVPN", "Networking & Content Delivery/AWS-Site-to-Site-VPN.svg",
+		"site to site vpn", "vpn gateway", "vpn", "virtual private gateway", "vgw"),
+	awsResource("internet-gateway", "Internet gateway", awsNetworking, "internet_gateway",
+		"NetworkingContentDelivery/VPCInternetGateway", "Networking & Content Delivery/Internet-Gateway.svg",
+		"internet gateway", "igw"),
+	awsResource("nat-gateway", "NAT gateway", awsNetworking, "nat_gateway",
+		"NetworkingContentDelivery/VPCNATGateway", "Networking & Content Delivery/NAT-Gateway.svg",
+		"nat gateway", "nat"),
+	awsResource("sqs", "Amazon SQS", awsIntegration, "sqs", "ApplicationIntegration/SimpleQueueService",
+		"Application Integration/Amazon-Simple-Queue-Service-SQS.svg", "sqs", "queue", "message queue"),
+	awsResource("sns", "Amazon SNS", awsIntegration, "sns", "ApplicationIntegration/SimpleNotificationService",
+		"Application Integration/Amazon-Simple-Notification-Service-SNS.svg", "sns", "notification", "notifications", "topic"),
+	awsResource("cloudwatch", "Amazon CloudWatch", awsIntegration, "cloudwatch_2", "ManagementGovernance/CloudWatch",
+		"Management & Governance/Amazon-CloudWatch.svg", "cloudwatch", "monitoring", "logs", "logging"),
+	awsResource("waf", "AWS WAF", awsSecurity, "waf", "SecurityIdentityCompliance/WAF",
+		"Security, Identity, & Compliance/AWS-WAF.svg", "waf", "web application firewall", "firewall"),
+	awsResource("kms", "AWS KMS", awsSecurity, "key_management_service", "SecurityIdentityCompliance/KeyManagementService",
+		"Security, Identity, & Compliance/AWS-Key-Management-Service.svg", "kms", "key management", "keys", "secrets"),
+	awsResource("iam", "AWS IAM", awsSecurity, "identity_and_access_management",
+		"SecurityIdentityCompliance/IdentityandAccessManagement",
+		"Security, Identity, & Compliance/AWS-Identity-and-Access-Management_IAM.svg",
+		"iam", "identity", "identity and access management", "sso"),
+
+	azureGroup("region", "Azure region", "General Service Icons/Region.svg", "azure region", "region"),
+	azureGroup("resource-group", "Resource group", "General Service Icons/Resource Groups.svg", "resource group", "rg"),
+	azureGroup("vnet", "Azure Virtual Network", "Networking Service Color/Virtual Networks.svg",
+		"vnet", "virtual network", "hub vnet", "spoke vnet", "hub", "spoke"),
+	azureGroup("subnet", "Subnet", "Networking Service Color/Subnet.svg", "subnet", "gateway subnet", "dmz"),
+
+	azureResource("expressroute", "Azure ExpressRoute", "networking/ExpressRoute_Circuits.svg",
+		"Networking/AzureExpressRoute", "Networking Service Color/ExpressRoute Circuits.svg",
+		"expressroute", "express route", "private circuit"),
+	azureResource("vpn-gateway", "Azure VPN Gateway", "networking/Virtual_Network_Gateways.svg",
+		"Networking/AzureVPNGateway", "Networking Service Color/Virtual Network Gateways.svg",
+		"vpn gateway", "vpn", "virtual network gateway", "site to site vpn"),
+	azureResource("firewall", "Azure Firewall", "networking/Firewalls.svg", "Networking/AzureFirewall",
+		"Networking Service Color/Firewalls.svg", "azure firewall", "firewall", "nva"),
+	azureResource("application-gateway", "Azure Application Gateway", "networking/Application_Gateways.svg",
+		"Networking/AzureApplicationGateway", "Networking Service Color/Application Gateways.svg",
+		"application gateway", "app gateway", "appgw", "waf", "web application firewall"),
+	azureResource("front-door", "Azure Front Door", "networking/Front_Doors.svg", "Networking/AzureFrontDoor",
+		"Networking Service Color/Front Doors.svg", "front door", "afd", "cdn"),
+	azureResource("load-balancer", "Azure Load Balancer", "networking/Load_Balancers.svg",
+		"Networking/AzureLoadBalancer", "Networking Service Color/Load Balancers.svg", "load balancer", "lb"),
+	azureResource("dns", "Azure DNS", "networking/DNS_Zones.svg", "Networking/AzureDNS",
+		"Networking Service Color/DNS Zones.svg", "azure dns", "dns", "private dns"),
+	azureResource("vm", "Azure Virtual Machine", "compute/Virtual_Machine.svg", "Compute/AzureVirtualMachine",
+		"Compute Service Color/VM/VM.svg", "virtual machine", "vm", "vms", "server", "web server", "app server",
+		"instance", "bastion"),
+	azureResource("functions", "Azure Functions", "compute/Function_Apps.svg", "Compute/AzureFunction",
+		"Compute Service Color/Function Apps.svg", "azure functions", "function app", "functions", "function"),
+	azureResource("app-service", "Azure App Service", "app_services/App_Services.svg", "Web/AzureAppService",
+		"Web Service Color/App Services.svg", "app service", "web app", "app services"),
+	azureResource("aks", "Azure Kubernetes Service", "containers/Kubernetes_Services.svg",
+		"Containers/AzureKubernetesService", "Container Service Color/Kubernetes Services.svg",
+		"aks", "kubernetes", "k8s"),
+	azureResource("sql-database", "Azure SQL Database", "databases/SQL_Database.svg", "Databases/AzureSqlDatabase",
+		"Databases Service Color/SQL Databases.svg", "sql database", "azure sql", "sql server", "sql mi",
+		"managed instance", "database", "db"),
+	azureResource("cosmos-db", "Azure Cosmos DB", "databases/Azure_Cosmos_DB.svg", "Databases/AzureCosmosDb",
+		"Databases Service Color/Azure Cosmos DB.svg", "cosmos db", "cosmosdb", "cosmos", "nosql"),
+	azureResource("cache", "Azure Cache for Redis", "databases/Cache_Redis.svg", "Databases/AzureRedisCache",
+		"Databases Service Color/Cache Redis.svg", "redis", "cache"),
+	azureResource("storage", "Azure Storage", "storage/Storage_Accounts.svg", "Storage/AzureStorage",
+		"Storage Service Color/Storage Accounts.svg", "storage account", "blob storage", "blob", "storage",
+		"file share"),
+	azureResource("service-bus", "Azure Service Bus", "integration/Service_Bus.svg", "Integration/AzureServiceBus",
+		"Integration Service Color/Service Bus.svg", "service bus", "queue", "message queue", "topic"),
+	azureResource("key-vault", "Azure Key Vault", "security/Key_Vaults.svg", "Security/AzureKeyVault",
+		"Security Service Color/Key Vaults.svg", "key vault", "keyvault", "keys", "secrets"),
+	azureResource("monitor", "Azure Monitor", "management_governance/Monitor.svg", "Management/AzureMonitor",
+		"Management + Governance Service Color/Monitor.svg", "azure monitor", "log analytics", "monitoring",
+		"logs", "logging"),
+	azureResource("entra-id", "Microsoft Entra ID", "identity/Azure_Active_Directory.svg",
+		"Identity/AzureActiveDirectory", "Identity Service Color/Azure Active Directory.svg",
+		"entra id", "entra", "azure ad", "aad", "active directory", "identity", "sso"),
+
+	genericComponent("users", "Users", "users", "Person", "person",
+		"user", "users", "client", "clients", "customer", "customers", "end user", "end users", "browser"),
+	genericComponent("internet", "Internet", "internet", "System_Ext", "cloud", "internet", "public internet"),
+	genericComponent("on-premises", "On-premises data center", "corporate_data_center", "System_Ext", "",
+		"on premises", "on prem", "onprem", "data center", "datacenter", "corporate network", "branch office"),
+}
+
+// Architecture is a parsed flowchart with its nodes and subgraphs typed as cloud components
+type Architecture struct {
+	Chart *Flowchart
+	// Provider is the cloud most of the diagram is about, if any
+	Provider Provider
+
+	nodes  map[string]*componentType
+	groups map[string]*componentType
+}
+
+// BuildArchitecture types the nodes and subgraphs of a flowchart from their labels and IDs.
+// Phrases that several clouds share, such as "subnet" or "VPN gateway", are resolved with
+// the provider named in the label, an enclosing subgraph or the rest of the diagram.
+func BuildArchitecture(chart *Flowchart) *Architecture {
+	arch := &Architecture{
+		Chart:  chart,
+		nodes:  make(map[string]*componentType),
+		groups: make(map[string]*componentType),
+	}
+
+	nodeCandidates := make(map[string][]*componentType, len(chart.Nodes))
+	groupCandidates := make(map[string][]*componentType, len(chart.Subgraphs))
+	votes := make(map[Provider]int)
+	for _, subgraph := range chart.Subgraphs {
+		words := componentWords(subgraph.Label + " " + subgraph.ID)
+		groupCandidates[subgraph.ID] = matchComponents(words, true)
+		vote(votes, words, groupCandidates[subgraph.ID])
+	}
+	for _, node := range chart.Nodes {
+		words := componentWords(node.Label + " " + node.ID)
+		nodeCandidates[node.ID] = matchComponents(words, false)
+		vote(votes, words, nodeCandidates[node.ID])
+	}
+	arch.Provider = majorityProvider(votes)
+
+	// Subgraphs are declared before the subgraphs nested in them, so parents are typed first
+	hints := make(map[string]Provider)
+	for _, subgraph := range chart.Subgraphs {
+		hint := explicitProvider(componentWords(subgraph.Label + " " + subgraph.ID))
+		if hint == ProviderGeneric {
+			hint = arch.Provider
+			if parent, ok := hints[subgraph.Parent]; ok {
+				hint = parent
+			}
+		}
+		if group := pickComponent(groupCandidates[subgraph.ID], hint); group != nil {
+			arch.groups[subgraph.ID] = group
+			if group.Provider != ProviderGeneric {
+				hint = group.Provider
+			}
+		}
+		hints[subgraph.ID] = hint
+	}
+
+	for _, node := range chart.Nodes {
+		hint := explicitProvider(componentWords(node.Label + " " + node.ID))
+		if hint == ProviderGeneric {
+			hint = arch.Provider
+			if group, ok := hints[node.Subgraph]; ok {
+				hint = group
+			}
+		}
+		if component := pickComponent(nodeCandidates[node.ID], hint); component != nil {
+			arch.nodes[node.ID] = component
+		}
+	}
+	return arch
+}
+
+// Component returns the component a node stands for
+func (a *Architecture) Component(nodeID string) (Component, bool) {
+	component, ok := a.nodes[nodeID]
+	if !ok {
+		return Component{}, false
+	}
+	return component.Component, true
+}
+
+// Group returns the component a subgraph stands for
+func (a *Architecture) Group(subgraphID string) (Component, bool) {
+	group, ok := a.groups[subgraphID]
+	if !ok {
+		return Component{}, false
+	}
+	return group.Component, true
+}
+
+// Providers returns the clouds whose components appear in the diagram, AWS first
+func (a *Architecture) Providers() []Provider {
+	seen := make(map[Provider]bool)
+	for _, component := range a.nodes {
+		seen[component.Provider] = true
+	}
+	for _, group := range a.groups {
+		seen[group.Provider] = true
+	}
+
+	var providers []Provider
+	for _, provider := range []Provider{ProviderAWS, ProviderAzure} {
+		if seen[provider] {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+// componentWords splits a label or ID into lowercase words, breaking camelCase IDs apart
+func componentWords(text string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+
+	runes := []rune(text)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+			flush()
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+// matchComponents returns the catalog entries with a keyword in words, in catalog order.
+// Keywords match consecutive words with or without spaces, so "ExpressRoute", "express route"
+// and "expressroute" are the same.
+func matchComponents(words []string, groups bool) []*componentType {
+	phrases := make(map[string]bool)
+	for i := range words {
+		phrase := ""
+		for j := i; j < len(words) && j < i+maxKeywordWords; j++ {
+			phrase += words[j]
+			phrases[phrase] = true
+		}
+	}
+
+	var matches []*componentType
+	for _, component := range componentCatalog {
+		if component.Group != groups {
+			continue
+		}
+		for _, keyword := range component.keywords {
+			if phrases[strings.ReplaceAll(keyword, " ", "")] {
+				matches = append(matches, component)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// explicitProvider returns the provider a label names, if it names exactly one
+func explicitProvider(words []string) Provider {
+	found := ProviderGeneric
+	for _, word := range words {
+		provider, ok := providerWords[word]
+		if !ok {
+			continue
+		}
+		if found != ProviderGeneric && found != provider {
+			return ProviderGeneric
+		}
+		found = provider
+	}
+	return found
+}
+
+// vote counts the providers a label names or whose services it unambiguously matches
+func vote(votes map[Provider]int, words []string, candidates []*componentType) {
+	if provider := explicitProvider(words); provider != ProviderGeneric {
+		votes[provider]++
+		return
+	}
+	if provider, ok := singleProvider(candidates); ok && provider != ProviderGeneric {
+		votes[provider]++
+	}
+}
+
+// majorityProvider returns the provider with the most votes, or no provider on a tie
+func majorityProvider(votes map[Provider]int) Provider {
+	aws, azure := votes[ProviderAWS], votes[ProviderAzure]
+	switch {
+	case aws > azure:
+		return ProviderAWS
+	case azure > aws:
+		return ProviderAzure
+	default:
+		return ProviderGeneric
+	}
+}
+
+// singleProvider reports whether all candidates belong to the same provider
+func singleProvider(candidates []*componentType) (Provider, bool) {
+	if len(candidates) == 0 {
+		return ProviderGeneric, false
+	}
+	for _, candidate := range candidates[1:] {
+		if candidate.Provider != candidates[0].Provider {
+			return ProviderGeneric, false
+		}
+	}
+	return candidates[0].Provider, true
+}
+
+// pickComponent chooses among the matching components using the provider hint. Without a
+// hint, a phrase shared by several clouds stays untyped; with one, another cloud's service
+// is not drawn inside it unless the label names that cloud.
+func pickComponent(candidates []*componentType, hint Provider) *componentType {
+	for _, candidate := range candidates {
+		if hint != ProviderGeneric && candidate.Provider == hint {
+			return candidate
+		}
+	}
+	for _, candidate := range candidates {
+		if candidate.Provider == ProviderGeneric {
+			return candidate
+		}
+	}
+	if hint == ProviderGeneric {
+		if _, ok := singleProvider(candidates); ok {
+			return candidates[0]
+		}
+	}
+	return nil
+}
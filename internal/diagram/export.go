@@ -0,0 +1,569 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ExportFormat is an editable diagram format an architecture can be exported to
+type ExportFormat string
+
+const (
+	// ExportDrawIO is a draw.io (diagrams.net) file using the AWS and Azure icon libraries
+	ExportDrawIO ExportFormat = "drawio"
+	// ExportD2 is a D2 source file with icons from icons.terrastruct.com
+	ExportD2 ExportFormat = "d2"
+	// ExportPlantUML is a PlantUML source file using C4 and the AWS and Azure standard libraries
+	ExportPlantUML ExportFormat = "plantuml"
+)
+
+// ExportFormats lists the supported export formats in the order they are offered
+var ExportFormats = []ExportFormat{ExportDrawIO, ExportD2, ExportPlantUML}
+
+const (
+	// d2IconBaseURL serves the icons referenced by D2 exports
+	d2IconBaseURL = "https://icons.terrastruct.com/"
+	// drawioIconSize is the width and height of an icon in draw.io exports
+	drawioIconSize = 48.0
+)
+
+// exportAliasPattern matches characters that are not allowed in D2 keys and PlantUML aliases
+var exportAliasPattern = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ContentType returns the MIME type of the format
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportDrawIO:
+		return "application/vnd.jgraph.mxfile"
+	case ExportD2:
+		return "text/vnd.d2"
+	default:
+		return "text/vnd.plantuml"
+	}
+}
+
+// Extension returns the file extension of the format, including the dot
+func (f ExportFormat) Extension() string {
+	switch f {
+	case ExportDrawIO:
+		return ".drawio"
+	case ExportD2:
+		return ".d2"
+	default:
+		return ".puml"
+	}
+}
+
+// Title returns the name of the format shown to users
+func (f ExportFormat) Title() string {
+	switch f {
+	case ExportDrawIO:
+		return "draw.io"
+	case ExportD2:
+		return "D2"
+	default:
+		return "PlantUML"
+	}
+}
+
+// ParseExportFormat returns the export format with the given name
+func ParseExportFormat(name string) (ExportFormat, error) {
+	for _, format := range ExportFormats {
+		if string(format) == strings.ToLower(name) {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported diagram export format: %q", name)
+}
+
+// exportFormatForContentType returns the export format stored with a content type
+func exportFormatForContentType(contentType string) (ExportFormat, bool) {
+	for _, format := range ExportFormats {
+		if format.ContentType() == contentType {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// ExportArchitecture converts Mermaid flowchart code into an editable diagram with cloud icons
+func ExportArchitecture(mermaidCode string, format ExportFormat) ([]byte, error) {
+	chart, err := ParseFlowchart(mermaidCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse diagram: %w", err)
+	}
+	arch := BuildArchitecture(chart)
+
+	switch format {
+	case ExportDrawIO:
+		return arch.DrawIO()
+	case ExportD2:
+		return arch.D2(), nil
+	case ExportPlantUML:
+		return arch.PlantUML(), nil
+	default:
+		return nil, fmt.Errorf("unsupported diagram export format: %q", format)
+	}
+}
+
+// aliases returns identifiers for the nodes and subgraphs that are valid in D2 and PlantUML.
+// Node and subgraph IDs share one namespace so that no alias is used twice.
+func (a *Architecture) aliases() (map[string]string, map[string]string) {
+	used := make(map[string]bool)
+	alias := func(id string) string {
+		base := exportAliasPattern.ReplaceAllString(id, "_")
+		if base == "" || (base[0] >= '0' && base[0] <= '9') {
+			base = "n_" + base
+		}
+		candidate := base
+		for i := 2; used[candidate]; i++ {
+			candidate = fmt.Sprintf("%s_%d", base, i)
+		}
+		used[candidate] = true
+		return candidate
+	}
+
+	groups := make(map[string]string, len(a.Chart.Subgraphs))
+	for _, subgraph := range a.Chart.Subgraphs {
+		groups[subgraph.ID] = alias(subgraph.ID)
+	}
+	nodes := make(map[string]string, len(a.Chart.Nodes))
+	for _, node := range a.Chart.Nodes {
+		nodes[node.ID] = alias(node.ID)
+	}
+	return nodes, groups
+}
+
+// childGroups returns the subgraphs directly inside parent, or the top level ones for ""
+func (a *Architecture) childGroups(parent string) []*FlowSubgraph {
+	var children []*FlowSubgraph
+	for _, subgraph := range a.Chart.Subgraphs {
+		if subgraph.Parent == parent {
+			children = append(children, subgraph)
+		}
+	}
+	return children
+}
+
+// childNodes returns the nodes declared directly inside a subgraph, or the top level ones for ""
+func (a *Architecture) childNodes(subgraph string) []*FlowNode {
+	var children []*FlowNode
+	for _, node := range a.Chart.Nodes {
+		if node.Subgraph == subgraph {
+			children = append(children, node)
+		}
+	}
+	return children
+}
+
+// D2 writes the architecture as D2 source. Nodes are nested in their subgraphs, and typed
+// components are drawn with their provider icon.
+func (a *Architecture) D2() []byte {
+	nodeAliases, groupAliases := a.aliases()
+	var out bytes.Buffer
+
+	direction := map[Direction]string{DirectionTB: "down", DirectionBT: "up", DirectionLR: "right", DirectionRL: "left"}
+	fmt.Fprintf(&out, "direction: %s\n", direction[a.Chart.Direction])
+
+	var writeGroup func(subgraph string, indent string)
+	writeGroup = func(subgraph string, indent string) {
+		for _, child := range a.childGroups(subgraph) {
+			fmt.Fprintf(&out, "\n%s%s: %s {\n", indent, groupAliases[child.ID], d2String(child.Label))
+			if group, ok := a.groups[child.ID]; ok {
+				writeD2Component(&out, group, indent+"  ")
+			}
+			writeGroup(child.ID, indent+"  ")
+			fmt.Fprintf(&out, "%s}\n", indent)
+		}
+		for _, node := range a.childNodes(subgraph) {
+			component, typed := a.nodes[node.ID]
+			shape := d2Shape(node.Shape)
+			if !typed && shape == "" {
+				fmt.Fprintf(&out, "%s%s: %s\n", indent, nodeAliases[node.ID], d2String(node.Label))
+				continue
+			}
+			fmt.Fprintf(&out, "%s%s: %s {\n", indent, nodeAliases[node.ID], d2String(node.Label))
+			if typed {
+				writeD2Component(&out, component, indent+"  ")
+			} else {
+				fmt.Fprintf(&out, "%s  shape: %s\n", indent, shape)
+			}
+			fmt.Fprintf(&out, "%s}\n", indent)
+		}
+	}
+	writeGroup("", "")
+
+	if len(a.Chart.Edges) > 0 {
+		out.WriteString("\n")
+	}
+	path := func(id string) string {
+		node, _ := a.Chart.Node(id)
+		parts := []string{nodeAliases[id]}
+		for _, subgraph := range subgraphChain(a.Chart, node.Subgraph) {
+			parts = append([]string{groupAliases[subgraph]}, parts...)
+		}
+		return strings.Join(parts, ".")
+	}
+	for _, edge := range a.Chart.Edges {
+		connection := "--"
+		switch {
+		case edge.Arrow && edge.ArrowBack:
+			connection = "<->"
+		case edge.Arrow:
+			connection = "->"
+		case edge.ArrowBack:
+			connection = "<-"
+		}
+		fmt.Fprintf(&out, "%s %s %s", path(edge.From), connection, path(edge.To))
+		if edge.Label != "" {
+			fmt.Fprintf(&out, ": %s", d2String(edge.Label))
+		}
+		switch edge.Style {
+		case EdgeDotted:
+			out.WriteString(" {style.stroke-dash: 3}")
+		case EdgeThick:
+			out.WriteString(" {style.stroke-width: 4}")
+		}
+		out.WriteString("\n")
+	}
+	return out.Bytes()
+}
+
+// writeD2Component writes the icon or shape of a typed component
+func writeD2Component(out *bytes.Buffer, component *componentType, indent string) {
+	if component.d2Icon != "" {
+		iconURL := d2IconBaseURL + url.PathEscape(component.d2Icon)
+		fmt.Fprintf(out, "%sicon: %s\n", indent, d2String(iconURL))
+		if !component.Group {
+			fmt.Fprintf(out, "%sshape: image\n", indent)
+		}
+	} else if component.d2Shape != "" {
+		fmt.Fprintf(out, "%sshape: %s\n", indent, component.d2Shape)
+	}
+	fmt.Fprintf(out, "%stooltip: %s\n", indent, d2String(component.Title))
+}
+
+// d2Shape returns the D2 shape for a flowchart shape, or "" for a rectangle
+func d2Shape(shape NodeShape) string {
+	switch shape {
+	case ShapeCylinder:
+		return "cylinder"
+	case ShapeCircle:
+		return "circle"
+	case ShapeDiamond:
+		return "diamond"
+	case ShapeHexagon:
+		return "hexagon"
+	case ShapeParallelogram:
+		return "parallelogram"
+	case ShapeStadium:
+		return "oval"
+	default:
+		return ""
+	}
+}
+
+// d2String quotes a label for D2
+func d2String(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
+
+// PlantUML writes the architecture as PlantUML source. Typed components use the AWS and
+// Azure standard library sprites, and everything else is drawn with C4 macros.
+func (a *Architecture) PlantUML() []byte {
+	nodeAliases, groupAliases := a.aliases()
+	var out bytes.Buffer
+
+	out.WriteString("@startuml\n")
+	out.WriteString("!include <C4/C4_Container>\n")
+	includes := make(map[string]bool)
+	for _, component := range a.nodes {
+		includes[component.pumlInclude] = true
+	}
+	for _, group := range a.groups {
+		includes[group.pumlInclude] = true
+	}
+	for _, provider := range a.Providers() {
+		if provider == ProviderAWS {
+			out.WriteString("!include <awslib14/AWSCommon>\n")
+		} else {
+			out.WriteString("!include <azure/AzureCommon>\n")
+		}
+	}
+	var files []string
+	for include := range includes {
+		if include != "" {
+			files = append(files, include)
+		}
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		fmt.Fprintf(&out, "!include <%s>\n", file)
+	}
+
+	if a.Chart.Direction == DirectionLR || a.Chart.Direction == DirectionRL {
+		out.WriteString("\nLAYOUT_LEFT_RIGHT()\n")
+	} else {
+		out.WriteString("\nLAYOUT_TOP_DOWN()\n")
+	}
+
+	var writeGroup func(subgraph string, indent string)
+	writeGroup = func(subgraph string, indent string) {
+		for _, child := range a.childGroups(subgraph) {
+			alias, label := groupAliases[child.ID], pumlString(child.Label)
+			if group, ok := a.groups[child.ID]; ok && group.pumlMacro != "" {
+				fmt.Fprintf(&out, "\n%s%s(%s, %s) {\n", indent, group.pumlMacro, alias, label)
+			} else if ok {
+				fmt.Fprintf(&out, "\n%sBoundary(%s, %s, %s) {\n", indent, alias, label, pumlString(group.Title))
+			} else {
+				fmt.Fprintf(&out, "\n%sBoundary(%s, %s) {\n", indent, alias, label)
+			}
+			writeGroup(child.ID, indent+"  ")
+			fmt.Fprintf(&out, "%s}\n", indent)
+		}
+		for _, node := range a.childNodes(subgraph) {
+			alias, label := nodeAliases[node.ID], pumlString(node.Label)
+			component, typed := a.nodes[node.ID]
+			switch {
+			case typed && component.pumlInclude != "":
+				fmt.Fprintf(&out, "%s%s(%s, %s, %s)\n", indent, component.pumlMacro, alias, label, pumlString(component.Title))
+			case typed:
+				fmt.Fprintf(&out, "%s%s(%s, %s)\n", indent, component.pumlMacro, alias, label)
+			case node.Shape == ShapeCylinder:
+				fmt.Fprintf(&out, "%sContainerDb(%s, %s)\n", indent, alias, label)
+			default:
+				fmt.Fprintf(&out, "%sContainer(%s, %s)\n", indent, alias, label)
+			}
+		}
+	}
+	writeGroup("", "")
+
+	if len(a.Chart.Edges) > 0 {
+		out.WriteString("\n")
+	}
+	for _, edge := range a.Chart.Edges {
+		from, to := nodeAliases[edge.From], nodeAliases[edge.To]
+		label := pumlString(edge.Label)
+		switch {
+		case edge.Arrow && edge.ArrowBack:
+			fmt.Fprintf(&out, "BiRel(%s, %s, %s)\n", from, to, label)
+		case edge.Arrow:
+			fmt.Fprintf(&out, "Rel(%s, %s, %s)\n", from, to, label)
+		case edge.ArrowBack:
+			fmt.Fprintf(&out, "Rel(%s, %s, %s)\n", to, from, label)
+		default:
+			fmt.Fprintf(&out, "%s -- %s", from, to)
+			if edge.Label != "" {
+				fmt.Fprintf(&out, " : %s", strings.Trim(label, `"`))
+			}
+			out.WriteString("\n")
+		}
+	}
+
+	out.WriteString("@enduml\n")
+	return out.Bytes()
+}
+
+// pumlString quotes a label for a PlantUML macro argument. PlantUML has no escape for double
+// quotes, so they become single quotes, and line breaks become \n.
+func pumlString(value string) string {
+	value = strings.NewReplacer(`"`, `'`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
+
+// mxFile is the root of a draw.io document
+type mxFile struct {
+	XMLName xml.Name  `xml:"mxfile"`
+	Host    string    `xml:"host,attr"`
+	Diagram mxDiagram `xml:"diagram"`
+}
+
+// mxDiagram is one page of a draw.io document
+type mxDiagram struct {
+	ID    string       `xml:"id,attr"`
+	Name  string       `xml:"name,attr"`
+	Model mxGraphModel `xml:"mxGraphModel"`
+}
+
+// mxGraphModel holds the cells of a draw.io page
+type mxGraphModel struct {
+	Grid       string   `xml:"grid,attr"`
+	GridSize   string   `xml:"gridSize,attr"`
+	Guides     string   `xml:"guides,attr"`
+	Connect    string   `xml:"connect,attr"`
+	Arrows     string   `xml:"arrows,attr"`
+	Page       string   `xml:"page,attr"`
+	PageWidth  string   `xml:"pageWidth,attr"`
+	PageHeight string   `xml:"pageHeight,attr"`
+	Cells      []mxCell `xml:"root>mxCell"`
+}
+
+// mxCell is a vertex or edge of a draw.io page
+type mxCell struct {
+	ID       string      `xml:"id,attr"`
+	Value    string      `xml:"value,attr,omitempty"`
+	Style    string      `xml:"style,attr,omitempty"`
+	Vertex   string      `xml:"vertex,attr,omitempty"`
+	Edge     string      `xml:"edge,attr,omitempty"`
+	Parent   string      `xml:"parent,attr,omitempty"`
+	Source   string      `xml:"source,attr,omitempty"`
+	Target   string      `xml:"target,attr,omitempty"`
+	Geometry *mxGeometry `xml:"mxGeometry,omitempty"`
+}
+
+// mxGeometry positions a cell. Children of a container are positioned relative to it.
+type mxGeometry struct {
+	X        string `xml:"x,attr,omitempty"`
+	Y        string `xml:"y,attr,omitempty"`
+	Width    string `xml:"width,attr,omitempty"`
+	Height   string `xml:"height,attr,omitempty"`
+	Relative string `xml:"relative,attr,omitempty"`
+	As       string `xml:"as,attr"`
+}
+
+// DrawIO writes the architecture as an uncompressed draw.io document. It is positioned with
+// the native flowchart layout, subgraphs become containers and typed components use the
+// AWS and Azure icon libraries that ship with draw.io.
+func (a *Architecture) DrawIO() ([]byte, error) {
+	layout := LayoutFlowchart(a.Chart)
+	nodeAliases, groupAliases := a.aliases()
+
+	origins := map[string]Point{"": {}}
+	cellIDs := map[string]string{"": "1"}
+	cells := []mxCell{{ID: "0"}, {ID: "1", Parent: "0"}}
+
+	// Clusters are ordered outermost first, so each container exists before its children
+	for _, cluster := range layout.Clusters {
+		subgraph := cluster.Subgraph
+		parent := subgraph.Parent
+		if _, ok := cellIDs[parent]; !ok {
+			parent = ""
+		}
+		origin := origins[parent]
+		style := "container=1;collapsible=0;recursiveResize=0;fillColor=#FFFFDE;strokeColor=#AAAA33;" +
+			"verticalAlign=top;align=left;spacingLeft=10;fontSize=12;"
+		if group, ok := a.groups[subgraph.ID]; ok {
+			style = group.drawio
+		}
+		id := "group-" + groupAliases[subgraph.ID]
+		cells = append(cells, mxCell{
+			ID: id, Value: subgraph.Label, Style: style, Vertex: "1", Parent: cellIDs[parent],
+			Geometry: &mxGeometry{X: num(cluster.X - origin.X), Y: num(cluster.Y - origin.Y),
+				Width: num(cluster.Width), Height: num(cluster.Height), As: "geometry"},
+		})
+		cellIDs[subgraph.ID] = id
+		origins[subgraph.ID] = Point{cluster.X, cluster.Y}
+	}
+
+	for _, node := range layout.Nodes {
+		parent := node.Node.Subgraph
+		if _, ok := cellIDs[parent]; !ok {
+			parent = ""
+		}
+		origin := origins[parent]
+		style := drawioShapeStyle(node.Node.Shape)
+		width, height := node.Width, node.Height
+		if component, ok := a.nodes[node.Node.ID]; ok {
+			style = component.drawio
+			width, height = drawioIconSize, drawioIconSize
+		}
+		cells = append(cells, mxCell{
+			ID: "node-" + nodeAliases[node.Node.ID], Value: node.Node.Label, Style: style, Vertex: "1",
+			Parent: cellIDs[parent],
+			Geometry: &mxGeometry{X: num(node.X - width/2 - origin.X), Y: num(node.Y - height/2 - origin.Y),
+				Width: num(width), Height: num(height), As: "geometry"},
+		})
+	}
+
+	for i, edge := range a.Chart.Edges {
+		cells = append(cells, mxCell{
+			ID: fmt.Sprintf("edge-%d", i), Value: edge.Label, Style: drawioEdgeStyle(edge), Edge: "1", Parent: "1",
+			Source: "node-" + nodeAliases[edge.From], Target: "node-" + nodeAliases[edge.To],
+			Geometry: &mxGeometry{Relative: "1", As: "geometry"},
+		})
+	}
+
+	document := mxFile{
+		Host: "ai-sa-assistant",
+		Diagram: mxDiagram{
+			ID: "architecture", Name: "Architecture",
+			Model: mxGraphModel{
+				Grid: "1", GridSize: "10", Guides: "1", Connect: "1", Arrows: "1", Page: "1",
+				PageWidth: num(layout.Width), PageHeight: num(layout.Height), Cells: cells,
+			},
+		},
+	}
+	data, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode draw.io document: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// drawioShapeStyle returns the draw.io style for an untyped node's flowchart shape
+func drawioShapeStyle(shape NodeShape) string {
+	const base = "whiteSpace=wrap;fillColor=#ECECFF;strokeColor=#9370DB;fontSize=12;"
+	switch shape {
+	case ShapeRound:
+		return "rounded=1;" + base
+	case ShapeStadium:
+		return "rounded=1;arcSize=50;" + base
+	case ShapeSubroutine:
+		return "shape=process;" + base
+	case ShapeCylinder:
+		return "shape=cylinder3;boundedLbl=1;size=8;" + base
+	case ShapeCircle:
+		return "ellipse;" + base
+	case ShapeDiamond:
+		return "rhombus;" + base
+	case ShapeHexagon:
+		return "shape=hexagon;perimeter=hexagonPerimeter2;" + base
+	case ShapeAsymmetric:
+		return "shape=step;perimeter=stepPerimeter;" + base
+	case ShapeParallelogram:
+		return "shape=parallelogram;perimeter=parallelogramPerimeter;" + base
+	case ShapeTrapezoid:
+		return "shape=trapezoid;perimeter=trapezoidPerimeter;" + base
+	default:
+		return "rounded=0;" + base
+	}
+}
+
+// drawioEdgeStyle returns the draw.io style for an edge
+func drawioEdgeStyle(edge FlowEdge) string {
+	style := "edgeStyle=orthogonalEdgeStyle;rounded=0;fontSize=11;"
+	switch edge.Style {
+	case EdgeDotted:
+		style += "dashed=1;"
+	case EdgeThick:
+		style += "strokeWidth=3;"
+	}
+	end, start := "none", "none"
+	if edge.Arrow {
+		end = "classic"
+	}
+	if edge.ArrowBack {
+		start = "classic"
+	}
+	return style + "endArrow=" + end + ";startArrow=" + start + ";"
+}
@@ -0,0 +1,260 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// hybridDiagram is an Azure hub and spoke network connected to an on-premises data center
+const hybridDiagram = `graph LR
+    DC[On-Premises Data Center] -->|private peering| ER[ExpressRoute]
+    subgraph hub [Hub VNet]
+        subgraph gw [GatewaySubnet]
+            ERGW[VPN Gateway]
+        end
+        FW[Azure Firewall]
+    end
+    ER --> ERGW --> FW
+    FW -.-> VM1[App Server]
+    FW -.-> SQL[(SQL Database)]`
+
+// awsDiagram is a three tier web application on AWS
+const awsDiagram = `graph TD
+    Users((Users)) --> CF[CloudFront]
+    subgraph vpc [Production VPC]
+        subgraph public [Public Subnet]
+            ALB[Application Load Balancer]
+        end
+        subgraph private [Private Subnet]
+            web-1[EC2 Web Server]
+            DB[(RDS "Primary")]
+        end
+    end
+    CF --> ALB --> web-1 ==> DB
+    web-1 --- Worker[Report builder]`
+
+func buildTestArchitecture(t *testing.T, code string) *Architecture {
+	t.Helper()
+	chart, err := ParseFlowchart(code)
+	if err != nil {
+		t.Fatalf("ParseFlowchart() error = %v", err)
+	}
+	return BuildArchitecture(chart)
+}
+
+func TestBuildArchitecture(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		provider   Provider
+		nodes      map[string]string
+		groups     map[string]string
+		untypedIDs []string
+	}{
+		{
+			name:     "azure hybrid network",
+			code:     hybridDiagram,
+			provider: ProviderAzure,
+			nodes: map[string]string{
+				"DC": "generic.on-premises", "ER": "azure.expressroute", "ERGW": "azure.vpn-gateway",
+				"FW": "azure.firewall", "VM1": "azure.vm", "SQL": "azure.sql-database",
+			},
+			groups: map[string]string{"hub": "azure.vnet", "gw": "azure.subnet"},
+		},
+		{
+			name:     "aws three tier application",
+			code:     awsDiagram,
+			provider: ProviderAWS,
+			nodes: map[string]string{
+				"Users": "generic.users", "CF": "aws.cloudfront", "ALB": "aws.elb", "web-1": "aws.ec2", "DB": "aws.rds",
+			},
+			groups:     map[string]string{"vpc": "aws.vpc", "public": "aws.public-subnet", "private": "aws.private-subnet"},
+			untypedIDs: []string{"Worker"},
+		},
+		{
+			name:       "shared phrases stay untyped without a provider",
+			code:       "graph TD\n    LB[Load Balancer] --> App[App Server]",
+			provider:   ProviderGeneric,
+			untypedIDs: []string{"LB", "App"},
+		},
+		{
+			name:     "label names the provider",
+			code:     "graph TD\n    LB[Azure Load Balancer] --> App[App Server]",
+			provider: ProviderAzure,
+			nodes:    map[string]string{"LB": "azure.load-balancer", "App": "azure.vm"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arch := buildTestArchitecture(t, tt.code)
+			if arch.Provider != tt.provider {
+				t.Errorf("Expected provider %q, got %q", tt.provider, arch.Provider)
+			}
+			for id, kind := range tt.nodes {
+				if component, ok := arch.Component(id); !ok || component.Kind != kind {
+					t.Errorf("Node %s: expected %s, got %+v", id, kind, component)
+				}
+			}
+			for id, kind := range tt.groups {
+				if group, ok := arch.Group(id); !ok || group.Kind != kind || !group.Group {
+					t.Errorf("Subgraph %s: expected %s, got %+v", id, kind, group)
+				}
+			}
+			for _, id := range tt.untypedIDs {
+				if component, ok := arch.Component(id); ok {
+					t.Errorf("Expected node %s to stay untyped, got %+v", id, component)
+				}
+			}
+		})
+	}
+}
+
+func TestArchitectureDrawIO(t *testing.T) {
+	data, err := ExportArchitecture(awsDiagram, ExportDrawIO)
+	if err != nil {
+		t.Fatalf("ExportArchitecture() error = %v", err)
+	}
+
+	var document mxFile
+	if err := xml.Unmarshal(data, &document); err != nil {
+		t.Fatalf("Expected a well formed draw.io document, got %v", err)
+	}
+	cells := make(map[string]mxCell)
+	for _, cell := range document.Diagram.Model.Cells {
+		if _, exists := cells[cell.ID]; exists {
+			t.Errorf("Duplicate cell ID %s", cell.ID)
+		}
+		cells[cell.ID] = cell
+	}
+
+	for _, cell := range document.Diagram.Model.Cells {
+		if cell.Parent != "" && cells[cell.Parent].ID == "" {
+			t.Errorf("Cell %s has unknown parent %s", cell.ID, cell.Parent)
+		}
+		if cell.Edge == "1" && (cells[cell.Source].Vertex != "1" || cells[cell.Target].Vertex != "1") {
+			t.Errorf("Edge %s does not connect two vertices", cell.ID)
+		}
+	}
+
+	checks := []struct {
+		id, parent, style string
+	}{
+		{"group-vpc", "1", "grIcon=mxgraph.aws4.group_vpc2"},
+		{"group-public", "group-vpc", "grIcon=mxgraph.aws4.group_security_group"},
+		{"node-web_1", "group-private", "resIcon=mxgraph.aws4.ec2"},
+		{"node-DB", "group-private", "resIcon=mxgraph.aws4.rds"},
+		{"node-Users", "1", "shape=mxgraph.aws4.users"},
+		{"node-Worker", "1", "rounded=0"},
+	}
+	for _, check := range checks {
+		cell, ok := cells[check.id]
+		if !ok {
+			t.Errorf("Expected cell %s", check.id)
+			continue
+		}
+		if cell.Parent != check.parent || !strings.Contains(cell.Style, check.style) {
+			t.Errorf("Cell %s: expected parent %s and style with %q, got %+v", check.id, check.parent, check.style, cell)
+		}
+	}
+	if db := cells["node-DB"]; db.Value != `RDS "Primary"` {
+		t.Errorf("Expected the label to round trip through XML escaping, got %q", db.Value)
+	}
+}
+
+func TestArchitectureD2(t *testing.T) {
+	d2 := string(buildTestArchitecture(t, awsDiagram).D2())
+
+	for _, want := range []string{
+		"direction: down\n",
+		"vpc: \"Production VPC\" {\n  icon: \"https://icons.terrastruct.com/aws%2F_Group%20Icons%2FVPC_light-bg.svg\"\n",
+		"\n  private: \"Private Subnet\" {\n",
+		"    DB: \"RDS \\\"Primary\\\"\" {\n      icon: \"https://icons.terrastruct.com/aws%2FDatabase%2FAmazon-RDS.svg\"\n      shape: image\n",
+		"Users: \"Users\" {\n  shape: person\n",
+		"Worker: \"Report builder\"\n",
+		"vpc.public.ALB -> vpc.private.web_1\n",
+		"vpc.private.web_1 -> vpc.private.DB {style.stroke-width: 4}\n",
+		"vpc.private.web_1 -- Worker\n",
+	} {
+		if !strings.Contains(d2, want) {
+			t.Errorf("Expected D2 output to contain %q, got\n%s", want, d2)
+		}
+	}
+}
+
+func TestArchitecturePlantUML(t *testing.T) {
+	puml := string(buildTestArchitecture(t, hybridDiagram).PlantUML())
+
+	for _, want := range []string{
+		"@startuml\n!include <C4/C4_Container>\n!include <azure/AzureCommon>\n",
+		"!include <azure/Networking/AzureExpressRoute>\n",
+		"LAYOUT_LEFT_RIGHT()\n",
+		"Boundary(hub, \"Hub VNet\", \"Azure Virtual Network\") {\n\n  Boundary(gw, \"GatewaySubnet\", \"Subnet\") {\n" +
+			"    AzureVPNGateway(ERGW, \"VPN Gateway\", \"Azure VPN Gateway\")\n  }\n",
+		"System_Ext(DC, \"On-Premises Data Center\")\n",
+		"AzureExpressRoute(ER, \"ExpressRoute\", \"Azure ExpressRoute\")\n",
+		"Rel(DC, ER, \"private peering\")\n",
+		"Rel(FW, SQL, \"\")\n",
+		"@enduml\n",
+	} {
+		if !strings.Contains(puml, want) {
+			t.Errorf("Expected PlantUML output to contain %q, got\n%s", want, puml)
+		}
+	}
+	if strings.Contains(puml, "awslib") {
+		t.Error("Expected no AWS includes in an Azure diagram")
+	}
+}
+
+func TestRendererExportDiagram(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	renderer := NewRenderer(DefaultRendererConfig(), zap.NewNop())
+	router := gin.New()
+	NewAssetHandler(renderer.Store(), zap.NewNop()).RegisterRoutes(router)
+
+	downloads := renderer.ExportDiagramFormats(context.Background(), hybridDiagram)
+	if len(downloads) != len(ExportFormats) {
+		t.Fatalf("Expected a download per format, got %v", downloads)
+	}
+
+	for _, format := range ExportFormats {
+		url := downloads[string(format)]
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != format.ContentType() {
+			t.Errorf("%s: expected the export to be served, got %d %s", format, w.Code, w.Header().Get("Content-Type"))
+		}
+		wantDisposition := "attachment; filename=\"architecture-" + url[len(AssetPath)+1:][:12] + format.Extension() + "\""
+		if got := w.Header().Get("Content-Disposition"); got != wantDisposition {
+			t.Errorf("%s: expected Content-Disposition %q, got %q", format, wantDisposition, got)
+		}
+	}
+
+	if _, err := renderer.ExportDiagram(context.Background(), "graph TD\n    A -> B", ExportD2); err == nil {
+		t.Error("Expected invalid diagram code to be rejected")
+	}
+	if _, err := ParseExportFormat("visio"); err == nil {
+		t.Error("Expected an unsupported format to be rejected")
+	}
+}
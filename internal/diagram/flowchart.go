@@ -0,0 +1,747 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxFlowchartNodes bounds the number of nodes the native renderer lays out
+const MaxFlowchartNodes = 200
+
+// Direction is the rank direction of a flowchart
+type Direction string
+
+const (
+	// DirectionTB lays ranks out top to bottom
+	DirectionTB Direction = "TB"
+	// DirectionBT lays ranks out bottom to top
+	DirectionBT Direction = "BT"
+	// DirectionLR lays ranks out left to right
+	DirectionLR Direction = "LR"
+	// DirectionRL lays ranks out right to left
+	DirectionRL Direction = "RL"
+)
+
+// NodeShape is the outline of a flowchart node
+type NodeShape int
+
+const (
+	// ShapeRect is A[text]
+	ShapeRect NodeShape = iota
+	// ShapeRound is A(text)
+	ShapeRound
+	// ShapeStadium is A([text])
+	ShapeStadium
+	// ShapeSubroutine is A[[text]]
+	ShapeSubroutine
+	// ShapeCylinder is A[(text)]
+	ShapeCylinder
+	// ShapeCircle is A((text))
+	ShapeCircle
+	// ShapeDiamond is A{text}
+	ShapeDiamond
+	// ShapeHexagon is A{{text}}
+	ShapeHexagon
+	// ShapeAsymmetric is A>text]
+	ShapeAsymmetric
+	// ShapeParallelogram is A[/text/]
+	ShapeParallelogram
+	// ShapeTrapezoid is A[/text\]
+	ShapeTrapezoid
+)
+
+// EdgeStyle is the stroke of a flowchart edge
+type EdgeStyle int
+
+const (
+	// EdgeSolid is --> or ---
+	EdgeSolid EdgeStyle = iota
+	// EdgeDotted is -.-> or -.-
+	EdgeDotted
+	// EdgeThick is ==> or ===
+	EdgeThick
+)
+
+// FlowNode is a node of a flowchart
+type FlowNode struct {
+	ID    string
+	Label string
+	Shape NodeShape
+	// Subgraph is the ID of the innermost subgraph the node was declared in, if any
+	Subgraph string
+}
+
+// FlowEdge is a link between two flowchart nodes
+type FlowEdge struct {
+	From  string
+	To    string
+	Label string
+	Style EdgeStyle
+	// Arrow is true when the edge has an arrowhead at its target
+	Arrow bool
+	// ArrowBack is true when the edge also has an arrowhead at its source
+	ArrowBack bool
+	// Line is the source line the edge was declared on
+	Line int
+}
+
+// FlowSubgraph is a titled group of flowchart nodes
+type FlowSubgraph struct {
+	ID     string
+	Label  string
+	Parent string
+	Nodes  []string
+}
+
+// Flowchart is a parsed Mermaid flowchart or graph diagram
+type Flowchart struct {
+	Direction Direction
+	Nodes     []*FlowNode
+	Edges     []FlowEdge
+	Subgraphs []*FlowSubgraph
+
+	nodes     map[string]*FlowNode
+	subgraphs map[string]*FlowSubgraph
+	// refs and issues locate node IDs and Mermaid incompatibilities in the source for the linter
+	refs   []nodeRef
+	issues []sourceEdit
+}
+
+// nodeRef is one occurrence of a node ID in the diagram source
+type nodeRef struct {
+	id     string
+	line   int
+	column int
+	// start is the byte offset of the ID in its source line
+	start int
+	// declared is true when this occurrence gives the node a shape and label
+	declared bool
+	label    string
+}
+
+// sourceEdit replaces length bytes at offset in a source line. The parser records edits for
+// constructs it accepts but Mermaid itself rejects.
+type sourceEdit struct {
+	rule        string
+	line        int
+	column      int
+	offset      int
+	length      int
+	replacement string
+	message     string
+}
+
+// Node returns the node with the given ID
+func (f *Flowchart) Node(id string) (*FlowNode, bool) {
+	node, ok := f.nodes[id]
+	return node, ok
+}
+
+// Subgraph returns the subgraph with the given ID
+func (f *Flowchart) Subgraph(id string) (*FlowSubgraph, bool) {
+	subgraph, ok := f.subgraphs[id]
+	return subgraph, ok
+}
+
+// ParseError is a syntax error in Mermaid diagram code. Line and Column are 1-based and zero
+// when the error is not tied to a position.
+type ParseError struct {
+	Line    int
+	Column  int
+	Message string
+
+	// openSubgraphs is the number of subgraphs left without an 'end'
+	openSubgraphs int
+}
+
+// Error implements the error interface
+func (e *ParseError) Error() string {
+	switch {
+	case e.Line == 0:
+		return e.Message
+	case e.Column == 0:
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	default:
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+	}
+}
+
+// statementPos locates a statement in its source line, so that errors and edits can point
+// at a column
+type statementPos struct {
+	line   int
+	source string
+	// offset is the byte offset of the statement in source
+	offset    int
+	statement string
+}
+
+// offsetOf returns the byte offset in the source line of rest, a suffix of the statement
+func (p statementPos) offsetOf(rest string) int {
+	return p.offset + len(p.statement) - len(rest)
+}
+
+// columnAt returns the 1-based column of a byte offset in the source line
+func (p statementPos) columnAt(offset int) int {
+	return utf8.RuneCountInString(p.source[:offset]) + 1
+}
+
+// errorAt returns a parse error positioned at rest, a suffix of the statement
+func (p statementPos) errorAt(rest, message string) *ParseError {
+	return &ParseError{Line: p.line, Column: p.columnAt(p.offsetOf(rest)), Message: message}
+}
+
+var (
+	headerPattern   = regexp.MustCompile(`^(graph|flowchart)(?:\s+(TD|TB|BT|LR|RL))?\s*;?$`)
+	linkPattern     = regexp.MustCompile(`^(<?)(-{2,}>|-{3,}|-\.+->|-\.+-|={2,}>|={3,}|--[ox]\s|==[ox]\s)`)
+	textLinkPattern = regexp.MustCompile(`^(<?)(--|==|-\.)\s*([^\s|>-][^|]*?)\s*(-{2,}>|-{3,}|\.+->|\.+-|={2,}>|={3,})`)
+	pipeTextPattern = regexp.MustCompile(`^\s*\|([^|]*)\|`)
+	subgraphPattern = regexp.MustCompile(`^([\p{L}\p{N}_-]+)\s*\[(.*)\]$`)
+	ignoredPrefixes = []string{"classDef ", "class ", "style ", "linkStyle ", "click ", "direction ", "accTitle", "accDescr"}
+	labelBreaks     = strings.NewReplacer("<br/>", "\n", "<br />", "\n", "<br>", "\n", "#quot;", "\"", "#amp;", "&")
+)
+
+// shapeDelimiters maps opening delimiters to node shapes, longest first so that A([x]) is not
+// read as A(...)
+var shapeDelimiters = []struct {
+	open  string
+	close []string
+	shape NodeShape
+}{
+	{"(((", []string{")))"}, ShapeCircle},
+	{"((", []string{"))"}, ShapeCircle},
+	{"([", []string{"])"}, ShapeStadium},
+	{"[[", []string{"]]"}, ShapeSubroutine},
+	{"[(", []string{")]"}, ShapeCylinder},
+	{"[/", []string{"/]", `\]`}, ShapeParallelogram},
+	{`[\`, []string{`\]`, "/]"}, ShapeTrapezoid},
+	{"{{", []string{"}}"}, ShapeHexagon},
+	{"(", []string{")"}, ShapeRound},
+	{"[", []string{"]"}, ShapeRect},
+	{"{", []string{"}"}, ShapeDiamond},
+	{">", []string{"]"}, ShapeAsymmetric},
+}
+
+// ParseFlowchart parses Mermaid flowchart ("graph" or "flowchart") syntax. Styling statements
+// are accepted and ignored, since the native renderer applies one consistent theme.
+func ParseFlowchart(code string) (*Flowchart, error) {
+	chart := &Flowchart{
+		nodes:     make(map[string]*FlowNode),
+		subgraphs: make(map[string]*FlowSubgraph),
+	}
+
+	var stack []*FlowSubgraph
+	var opened []statementPos
+	headerSeen := false
+
+	for index, rawLine := range strings.Split(code, "\n") {
+		for _, part := range splitStatements(stripComment(rawLine)) {
+			statement := strings.TrimSpace(part.text)
+			if statement == "" {
+				continue
+			}
+			pos := statementPos{
+				line:      index + 1,
+				source:    rawLine,
+				offset:    part.offset + len(part.text) - len(strings.TrimLeftFunc(part.text, unicode.IsSpace)),
+				statement: statement,
+			}
+
+			if !headerSeen {
+				match := headerPattern.FindStringSubmatch(statement)
+				if match == nil {
+					return nil, pos.errorAt(statement, "expected a graph or flowchart declaration")
+				}
+				chart.Direction = parseDirection(match[2])
+				headerSeen = true
+				continue
+			}
+
+			switch {
+			case statement == "end":
+				if len(stack) == 0 {
+					return nil, pos.errorAt(statement, "'end' without a matching subgraph")
+				}
+				stack, opened = stack[:len(stack)-1], opened[:len(opened)-1]
+			case statement == "subgraph" || strings.HasPrefix(statement, "subgraph "):
+				subgraph := chart.addSubgraph(strings.TrimSpace(strings.TrimPrefix(statement, "subgraph")), stack)
+				stack, opened = append(stack, subgraph), append(opened, pos)
+			case isIgnoredStatement(statement):
+				continue
+			default:
+				current := ""
+				if len(stack) > 0 {
+					current = stack[len(stack)-1].ID
+				}
+				if err := chart.parseStatement(pos, current); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if !headerSeen {
+		return nil, &ParseError{Message: "diagram is empty"}
+	}
+	if len(stack) > 0 {
+		err := opened[len(opened)-1].errorAt(opened[len(opened)-1].statement,
+			fmt.Sprintf("subgraph %q is missing its 'end'", stack[len(stack)-1].Label))
+		err.openSubgraphs = len(stack)
+		return nil, err
+	}
+	chart.resolveSubgraphLinks()
+	if len(chart.Nodes) == 0 {
+		return nil, &ParseError{Message: "diagram has no nodes"}
+	}
+	if len(chart.Nodes) > MaxFlowchartNodes {
+		return nil, &ParseError{Message: fmt.Sprintf("diagram has %d nodes (max: %d)", len(chart.Nodes), MaxFlowchartNodes)}
+	}
+	return chart, nil
+}
+
+// parseDirection normalises a Mermaid direction keyword
+func parseDirection(value string) Direction {
+	switch value {
+	case "BT":
+		return DirectionBT
+	case "LR":
+		return DirectionLR
+	case "RL":
+		return DirectionRL
+	default:
+		return DirectionTB
+	}
+}
+
+// stripComment removes a %% comment that is not inside a quoted label
+func stripComment(line string) string {
+	inQuote := false
+	for i := 0; i < len(line)-1; i++ {
+		switch {
+		case line[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && line[i] == '%' && line[i+1] == '%':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// linePart is a statement of a source line and its byte offset in the line
+type linePart struct {
+	text   string
+	offset int
+}
+
+// splitStatements splits a line on semicolons outside quoted labels
+func splitStatements(line string) []linePart {
+	var statements []linePart
+	inQuote := false
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			inQuote = !inQuote
+		case ';':
+			if !inQuote {
+				statements = append(statements, linePart{line[start:i], start})
+				start = i + 1
+			}
+		}
+	}
+	return append(statements, linePart{line[start:], start})
+}
+
+// isIgnoredStatement reports whether a statement only affects styling or interaction. A
+// keyword followed by a link, as in "class --> B", is a node named after the keyword.
+func isIgnoredStatement(statement string) bool {
+	for _, prefix := range ignoredPrefixes {
+		if strings.HasPrefix(statement, prefix) {
+			_, _, isLink := parseLink(strings.TrimSpace(statement[len(prefix):]))
+			return !isLink
+		}
+	}
+	return false
+}
+
+// addSubgraph declares a subgraph from the text following the subgraph keyword
+func (f *Flowchart) addSubgraph(header string, stack []*FlowSubgraph) *FlowSubgraph {
+	id, label := "", ""
+	if match := subgraphPattern.FindStringSubmatch(header); match != nil {
+		id, label = match[1], cleanLabel(match[2])
+	} else if strings.HasPrefix(header, "\"") {
+		label = cleanLabel(header)
+	} else if isIdentifier(header) {
+		id, label = header, header
+	} else {
+		label = cleanLabel(header)
+	}
+	if id == "" {
+		id = fmt.Sprintf("subgraph%d", len(f.Subgraphs)+1)
+	}
+
+	subgraph := &FlowSubgraph{ID: id, Label: label}
+	if len(stack) > 0 {
+		subgraph.Parent = stack[len(stack)-1].ID
+	}
+	f.Subgraphs = append(f.Subgraphs, subgraph)
+	f.subgraphs[id] = subgraph
+	return subgraph
+}
+
+// parseStatement parses a node declaration or a chain of links such as A & B --> C -- text --> D
+func (f *Flowchart) parseStatement(pos statementPos, subgraph string) error {
+	from, rest, err := f.parseNodeGroup(pos.statement, subgraph, pos)
+	if err != nil {
+		return err
+	}
+
+	for {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			return nil
+		}
+
+		edge, remaining, ok := parseLink(rest)
+		if !ok {
+			return pos.errorAt(rest, fmt.Sprintf("unexpected %q", truncateText(rest, 20)))
+		}
+		f.checkLinkEnd(rest, remaining, pos)
+
+		var to []string
+		to, rest, err = f.parseNodeGroup(remaining, subgraph, pos)
+		if err != nil {
+			return err
+		}
+
+		for _, source := range from {
+			for _, target := range to {
+				linked := edge
+				linked.From, linked.To, linked.Line = source, target, pos.line
+				f.Edges = append(f.Edges, linked)
+			}
+		}
+		from = to
+	}
+}
+
+// checkLinkEnd records a missing space between an open link and a node ID starting with o or
+// x, which Mermaid reads as a circle or cross edge ("A---oB")
+func (f *Flowchart) checkLinkEnd(link, remaining string, pos statementPos) {
+	end := strings.TrimRightFunc(link[:len(link)-len(remaining)], unicode.IsSpace)
+	if len(end) != len(link)-len(remaining) || !strings.HasSuffix(end, "-") && !strings.HasSuffix(end, "=") {
+		return
+	}
+	if remaining == "" || (remaining[0] != 'o' && remaining[0] != 'x') || identifierEnd(remaining) == 0 {
+		return
+	}
+	offset := pos.offsetOf(remaining)
+	f.issues = append(f.issues, sourceEdit{
+		rule:        RuleLinkLetter,
+		line:        pos.line,
+		column:      pos.columnAt(offset),
+		offset:      offset,
+		replacement: " ",
+		message:     fmt.Sprintf("separated node %q from its link so it is not read as a circle or cross edge", remaining[:identifierEnd(remaining)]),
+	})
+}
+
+// parseNodeGroup parses one node, or several joined with &
+func (f *Flowchart) parseNodeGroup(text, subgraph string, pos statementPos) ([]string, string, error) {
+	var ids []string
+	rest := text
+	for {
+		id, remaining, err := f.parseNode(strings.TrimLeftFunc(rest, unicode.IsSpace), subgraph, pos)
+		if err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, id)
+		rest = strings.TrimLeftFunc(remaining, unicode.IsSpace)
+		if !strings.HasPrefix(rest, "&") {
+			return ids, remaining, nil
+		}
+		rest = rest[1:]
+	}
+}
+
+// parseNode parses a node reference with an optional shape and label
+func (f *Flowchart) parseNode(text, subgraph string, pos statementPos) (string, string, error) {
+	end := identifierEnd(text)
+	if end == 0 {
+		if text == "" {
+			return "", "", pos.errorAt(text, "expected a node after the link")
+		}
+		return "", "", pos.errorAt(text, fmt.Sprintf("expected a node ID at %q", truncateText(text, 20)))
+	}
+	id := text[:end]
+	rest := text[end:]
+	start := pos.offsetOf(text)
+
+	label, shape, hasShape := "", ShapeRect, false
+	for _, delimiter := range shapeDelimiters {
+		if !strings.HasPrefix(rest, delimiter.open) {
+			continue
+		}
+		body := rest[len(delimiter.open):]
+		content, after, ok := readDelimited(body, delimiter.close)
+		if !ok {
+			return "", "", pos.errorAt(rest, fmt.Sprintf("node %q has an unclosed %q", id, delimiter.open))
+		}
+		label, shape, hasShape, rest = cleanLabel(content), delimiter.shape, true, after
+		f.checkLabelQuoting(id, content, pos.offsetOf(body), pos)
+		break
+	}
+	f.refs = append(f.refs, nodeRef{
+		id: id, line: pos.line, column: pos.columnAt(start), start: start, declared: hasShape, label: label,
+	})
+
+	if strings.HasPrefix(rest, ":::") {
+		rest = rest[3:]
+		rest = rest[identifierEnd(rest):]
+	}
+
+	node, exists := f.nodes[id]
+	if !exists {
+		node = &FlowNode{ID: id, Label: id, Shape: ShapeRect, Subgraph: subgraph}
+		f.nodes[id] = node
+		f.Nodes = append(f.Nodes, node)
+		if subgraph != "" {
+			f.subgraphs[subgraph].Nodes = append(f.subgraphs[subgraph].Nodes, id)
+		}
+	}
+	if hasShape {
+		node.Label, node.Shape = label, shape
+		if node.Label == "" {
+			node.Label = id
+		}
+	}
+	return id, rest, nil
+}
+
+// checkLabelQuoting records an unquoted label containing brackets, which Mermaid reads as the
+// end of the node's shape, and the quotes that fix it
+func (f *Flowchart) checkLabelQuoting(id, content string, offset int, pos statementPos) {
+	if strings.HasPrefix(strings.TrimSpace(content), "\"") || !strings.ContainsAny(content, "()[]{}") {
+		return
+	}
+	f.issues = append(f.issues, sourceEdit{
+		rule:        RuleUnquotedLabel,
+		line:        pos.line,
+		column:      pos.columnAt(offset),
+		offset:      offset,
+		length:      len(content),
+		replacement: "\"" + strings.ReplaceAll(strings.TrimSpace(content), "\"", "#quot;") + "\"",
+		message:     fmt.Sprintf("quoted the label of node %q because it contains brackets", id),
+	})
+}
+
+// readDelimited reads a label up to its closing delimiter. Quoted labels may contain the
+// delimiters; unquoted labels may contain balanced brackets, as in A(Amazon S3 (Standard)).
+func readDelimited(body string, closers []string) (string, string, bool) {
+	if strings.HasPrefix(body, "\"") {
+		if end := strings.Index(body[1:], "\""); end >= 0 {
+			after := body[end+2:]
+			for _, closer := range closers {
+				if strings.HasPrefix(after, closer) {
+					return body[:end+2], after[len(closer):], true
+				}
+			}
+		}
+	}
+
+	depth := 0
+	for i := 0; i < len(body); i++ {
+		if depth == 0 {
+			for _, closer := range closers {
+				if strings.HasPrefix(body[i:], closer) {
+					return body[:i], body[i+len(closer):], true
+				}
+			}
+		}
+		switch body[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+
+	// Unbalanced brackets end the label at the first closing delimiter
+	best, bestCloser := -1, ""
+	for _, closer := range closers {
+		if index := strings.Index(body, closer); index >= 0 && (best < 0 || index < best) {
+			best, bestCloser = index, closer
+		}
+	}
+	if best < 0 {
+		return "", "", false
+	}
+	return body[:best], body[best+len(bestCloser):], true
+}
+
+// parseLink parses a link and its optional label at the start of text
+func parseLink(text string) (FlowEdge, string, bool) {
+	if match := linkPattern.FindStringSubmatch(text); match != nil {
+		arrow := strings.TrimSpace(match[2])
+		edge := linkEdge(arrow, match[1] == "<")
+		rest := text[len(match[0]):]
+		if pipe := pipeTextPattern.FindStringSubmatch(rest); pipe != nil {
+			edge.Label = cleanLabel(pipe[1])
+			rest = rest[len(pipe[0]):]
+		}
+		return edge, rest, true
+	}
+
+	if match := textLinkPattern.FindStringSubmatch(text); match != nil {
+		edge := linkEdge(match[2]+match[4], match[1] == "<")
+		edge.Label = cleanLabel(match[3])
+		return edge, text[len(match[0]):], true
+	}
+
+	return FlowEdge{}, text, false
+}
+
+// linkEdge builds an edge from link syntax such as -.-> or ===
+func linkEdge(link string, arrowBack bool) FlowEdge {
+	edge := FlowEdge{ArrowBack: arrowBack}
+	switch {
+	case strings.Contains(link, "."):
+		edge.Style = EdgeDotted
+	case strings.Contains(link, "="):
+		edge.Style = EdgeThick
+	}
+	edge.Arrow = strings.HasSuffix(link, ">")
+	return edge
+}
+
+// resolveSubgraphLinks redirects links that target a subgraph to its first node, and drops
+// the placeholder nodes those links created
+func (f *Flowchart) resolveSubgraphLinks() {
+	redirect := make(map[string]string)
+	for _, subgraph := range f.Subgraphs {
+		node, isNode := f.nodes[subgraph.ID]
+		if !isNode || node.Label != node.ID {
+			continue
+		}
+		if first := f.firstSubgraphNode(subgraph); first != "" && first != subgraph.ID {
+			redirect[subgraph.ID] = first
+		}
+	}
+	if len(redirect) == 0 {
+		return
+	}
+
+	for i := range f.Edges {
+		if target, ok := redirect[f.Edges[i].From]; ok {
+			f.Edges[i].From = target
+		}
+		if target, ok := redirect[f.Edges[i].To]; ok {
+			f.Edges[i].To = target
+		}
+	}
+
+	nodes := f.Nodes[:0]
+	for _, node := range f.Nodes {
+		if _, ok := redirect[node.ID]; ok {
+			delete(f.nodes, node.ID)
+			if parent, ok := f.subgraphs[node.Subgraph]; ok {
+				parent.Nodes = removeString(parent.Nodes, node.ID)
+			}
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	f.Nodes = nodes
+}
+
+// firstSubgraphNode returns the first node declared in a subgraph or its nested subgraphs
+func (f *Flowchart) firstSubgraphNode(subgraph *FlowSubgraph) string {
+	for _, id := range subgraph.Nodes {
+		if id != subgraph.ID {
+			return id
+		}
+	}
+	for _, child := range f.Subgraphs {
+		if child.Parent == subgraph.ID {
+			if first := f.firstSubgraphNode(child); first != "" {
+				return first
+			}
+		}
+	}
+	return ""
+}
+
+// identifierEnd returns the length of the node ID at the start of text. A '-' belongs to the
+// ID only when it is not the start of a link.
+func identifierEnd(text string) int {
+	for i, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			continue
+		case r == '-' && i > 0 && i+1 < len(text) && text[i+1] != '-' && text[i+1] != '.' &&
+			text[i+1] != '>' && text[i+1] != '=':
+			continue
+		default:
+			return i
+		}
+	}
+	return len(text)
+}
+
+// isIdentifier reports whether text is a single node or subgraph ID
+func isIdentifier(text string) bool {
+	return text != "" && identifierEnd(text) == len(text)
+}
+
+// cleanLabel unquotes a label and converts Mermaid line breaks and entities
+func cleanLabel(label string) string {
+	label = strings.TrimSpace(label)
+	if len(label) >= 2 && strings.HasPrefix(label, "\"") && strings.HasSuffix(label, "\"") {
+		label = label[1 : len(label)-1]
+	}
+	label = labelBreaks.Replace(label)
+	lines := strings.Split(label, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// truncateText shortens text for error messages
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "..."
+}
+
+// removeString returns values without the given value
+func removeString(values []string, value string) []string {
+	result := values[:0]
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
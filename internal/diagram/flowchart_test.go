@@ -0,0 +1,205 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseFlowchart(t *testing.T) {
+	code := `flowchart LR
+    %% Entry point
+    User((User)) --> ALB[Load Balancer]
+    subgraph VPC["Production VPC"]
+        ALB -->|HTTPS| App(App Server) & Worker{{Worker}}
+        App -.-> DB[(Database)]
+        App == replicate ==> Replica[(Read Replica)]
+    end
+    Worker --- Queue>Queue]; Queue -- drains --> Worker
+    classDef aws fill:#f90
+    class ALB aws`
+
+	chart, err := ParseFlowchart(code)
+	if err != nil {
+		t.Fatalf("ParseFlowchart() error = %v", err)
+	}
+
+	if chart.Direction != DirectionLR {
+		t.Errorf("Expected direction LR, got %s", chart.Direction)
+	}
+
+	wantShapes := map[string]NodeShape{
+		"User": ShapeCircle, "ALB": ShapeRect, "App": ShapeRound, "Worker": ShapeHexagon,
+		"DB": ShapeCylinder, "Replica": ShapeCylinder, "Queue": ShapeAsymmetric,
+	}
+	if len(chart.Nodes) != len(wantShapes) {
+		t.Errorf("Expected %d nodes, got %d", len(wantShapes), len(chart.Nodes))
+	}
+	for id, shape := range wantShapes {
+		node, ok := chart.Node(id)
+		if !ok {
+			t.Errorf("Expected node %s", id)
+			continue
+		}
+		if node.Shape != shape {
+			t.Errorf("Node %s: expected shape %d, got %d", id, shape, node.Shape)
+		}
+	}
+
+	alb, _ := chart.Node("ALB")
+	if alb.Label != "Load Balancer" || alb.Subgraph != "" {
+		t.Errorf("Expected ALB declared outside the subgraph with its label, got %+v", alb)
+	}
+	app, _ := chart.Node("App")
+	if app.Subgraph != "VPC" {
+		t.Errorf("Expected App in subgraph VPC, got %q", app.Subgraph)
+	}
+	vpc, ok := chart.Subgraph("VPC")
+	if !ok || vpc.Label != "Production VPC" {
+		t.Errorf("Expected subgraph VPC titled Production VPC, got %+v", vpc)
+	}
+
+	type edgeKey struct{ from, to string }
+	edges := make(map[edgeKey]FlowEdge)
+	for _, edge := range chart.Edges {
+		edges[edgeKey{edge.From, edge.To}] = edge
+	}
+	checks := []struct {
+		from, to string
+		label    string
+		style    EdgeStyle
+		arrow    bool
+	}{
+		{"User", "ALB", "", EdgeSolid, true},
+		{"ALB", "App", "HTTPS", EdgeSolid, true},
+		{"ALB", "Worker", "HTTPS", EdgeSolid, true},
+		{"App", "DB", "", EdgeDotted, true},
+		{"App", "Replica", "replicate", EdgeThick, true},
+		{"Worker", "Queue", "", EdgeSolid, false},
+		{"Queue", "Worker", "drains", EdgeSolid, true},
+	}
+	if len(chart.Edges) != len(checks) {
+		t.Errorf("Expected %d edges, got %d", len(checks), len(chart.Edges))
+	}
+	for _, check := range checks {
+		edge, ok := edges[edgeKey{check.from, check.to}]
+		if !ok {
+			t.Errorf("Expected edge %s -> %s", check.from, check.to)
+			continue
+		}
+		if edge.Label != check.label || edge.Style != check.style || edge.Arrow != check.arrow {
+			t.Errorf("Edge %s -> %s: got %+v", check.from, check.to, edge)
+		}
+	}
+}
+
+func TestParseFlowchartLabels(t *testing.T) {
+	chart, err := ParseFlowchart(`graph TD
+    A["Amazon S3 (Standard)"] --> B[API-Gateway<br/>Regional]
+    api-gw --> B`)
+	if err != nil {
+		t.Fatalf("ParseFlowchart() error = %v", err)
+	}
+
+	a, _ := chart.Node("A")
+	if a.Label != "Amazon S3 (Standard)" {
+		t.Errorf("Expected quoted label, got %q", a.Label)
+	}
+	b, _ := chart.Node("B")
+	if b.Label != "API-Gateway\nRegional" {
+		t.Errorf("Expected line break in label, got %q", b.Label)
+	}
+	if _, ok := chart.Node("api-gw"); !ok {
+		t.Error("Expected a hyphenated node ID")
+	}
+}
+
+func TestParseFlowchartSubgraphLinks(t *testing.T) {
+	chart, err := ParseFlowchart(`graph TD
+    subgraph onprem [On-Premises]
+        DC[Data Center]
+    end
+    subgraph cloud [Azure]
+        VNet[Hub VNet]
+    end
+    onprem --> cloud`)
+	if err != nil {
+		t.Fatalf("ParseFlowchart() error = %v", err)
+	}
+
+	if len(chart.Nodes) != 2 {
+		t.Errorf("Expected subgraph links not to create nodes, got %d nodes", len(chart.Nodes))
+	}
+	if len(chart.Edges) != 1 || chart.Edges[0].From != "DC" || chart.Edges[0].To != "VNet" {
+		t.Errorf("Expected the subgraph link redirected to member nodes, got %+v", chart.Edges)
+	}
+}
+
+func TestParseFlowchartErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		wantLine   int
+		wantColumn int
+		contains   string
+	}{
+		{"missing header", "A --> B", 1, 1, "graph or flowchart"},
+		{"unsupported diagram", "sequenceDiagram\n  A->>B: hi", 1, 1, "graph or flowchart"},
+		{"unclosed shape", "graph TD\n  A[Start --> B", 2, 4, "unclosed"},
+		{"dangling link", "graph TD\n  A -->", 2, 8, "expected a node"},
+		{"second statement", "graph TD\n  A --> B; B --> ?", 2, 18, "expected a node ID"},
+		{"unmatched end", "graph TD\n  A --> B\nend", 3, 1, "without a matching subgraph"},
+		{"unterminated subgraph", "graph TD\nsubgraph X\n  A --> B", 2, 1, "missing its 'end'"},
+		{"empty", "", 0, 0, "empty"},
+		{"no nodes", "graph TD", 0, 0, "no nodes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFlowchart(tt.code)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Expected a ParseError, got %v", err)
+			}
+			if parseErr.Line != tt.wantLine {
+				t.Errorf("Expected line %d, got %d", tt.wantLine, parseErr.Line)
+			}
+			if parseErr.Column != tt.wantColumn {
+				t.Errorf("Expected column %d, got %d", tt.wantColumn, parseErr.Column)
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error to contain %q, got %q", tt.contains, err.Error())
+			}
+		})
+	}
+}
+
+func TestParseFlowchartNodeLimit(t *testing.T) {
+	var code strings.Builder
+	code.WriteString("graph TD\n")
+	for i := 0; i <= MaxFlowchartNodes; i++ {
+		code.WriteString("N")
+		code.WriteString(strings.Repeat("x", i%7))
+		code.WriteString(string(rune('a' + i%26)))
+		code.WriteString(strings.Repeat("y", i/26))
+		code.WriteString("\n")
+	}
+
+	if _, err := ParseFlowchart(code.String()); err == nil || !strings.Contains(err.Error(), "max") {
+		t.Errorf("Expected a node limit error, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AssetPath is the route prefix rendered diagrams are served from
+const AssetPath = "/diagrams"
+
+// AssetHandler serves rendered diagrams from an asset store
+type AssetHandler struct {
+	store  AssetStore
+	logger *zap.Logger
+}
+
+// NewAssetHandler creates a handler serving the assets in store
+func NewAssetHandler(store AssetStore, logger *zap.Logger) *AssetHandler {
+	return &AssetHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes registers the diagram asset route with the Gin router
+func (h *AssetHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET(AssetPath+"/:hash", h.getAsset)
+}
+
+// getAsset handles GET /diagrams/:hash. Assets never change for a hash, so they are cached
+// indefinitely; SVGs get a restrictive content security policy in case they are opened
+// directly.
+func (h *AssetHandler) getAsset(c *gin.Context) {
+	hash := c.Param("hash")
+	if !IsAssetHash(hash) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Diagram not found"})
+		return
+	}
+
+	asset, err := h.store.Get(hash)
+	if err != nil {
+		if !errors.Is(err, ErrAssetNotFound) {
+			h.logger.Error("Failed to read diagram asset", zap.String("hash", hash), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read diagram"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Diagram not found"})
+		return
+	}
+
+	etag := `"` + hash + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	if asset.ContentType == ImageSVG.ContentType() {
+		c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	}
+	if format, ok := exportFormatForContentType(asset.ContentType); ok {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="architecture-%s%s"`, hash[:12], format.Extension()))
+	}
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, asset.ContentType, asset.Data)
+}
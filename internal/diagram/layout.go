@@ -0,0 +1,974 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Layout metrics, in SVG user units. The PNG rasterizer scales them up.
+const (
+	charWidth      = 7.0
+	lineHeight     = 16.0
+	nodePaddingX   = 16.0
+	nodePaddingY   = 10.0
+	minNodeWidth   = 60.0
+	maxLabelChars  = 28
+	nodeSeparation = 30.0
+	rankSeparation = 50.0
+	clusterPadding = 14.0
+	clusterTitle   = 22.0
+	diagramMargin  = 16.0
+	labelPadding   = 4.0
+	orderingPasses = 8
+	positionPasses = 6
+)
+
+// Point is a position in the diagram
+type Point struct {
+	X, Y float64
+}
+
+// LayoutNode is a positioned flowchart node. X and Y are the node center.
+type LayoutNode struct {
+	Node          *FlowNode
+	Lines         []string
+	X, Y          float64
+	Width, Height float64
+}
+
+// LayoutEdge is a routed flowchart edge
+type LayoutEdge struct {
+	Edge   FlowEdge
+	Points []Point
+	// Label is the center of the edge label, when the edge has one
+	Label       Point
+	LabelLines  []string
+	LabelWidth  float64
+	LabelHeight float64
+}
+
+// LayoutCluster is the box drawn around a subgraph. X and Y are the top left corner.
+type LayoutCluster struct {
+	Subgraph      *FlowSubgraph
+	X, Y          float64
+	Width, Height float64
+	Depth         int
+}
+
+// Layout is a flowchart positioned for drawing
+type Layout struct {
+	Width, Height float64
+	Nodes         []LayoutNode
+	Edges         []LayoutEdge
+	Clusters      []LayoutCluster
+}
+
+// layoutVertex is a node in the layered graph: a flowchart node, or a dummy vertex that routes
+// a long edge through an intermediate rank. Sizes are in rank space, where ranks run down the
+// main axis and each rank is ordered along the cross axis.
+type layoutVertex struct {
+	node  int
+	edge  int
+	rank  int
+	order int
+	group string
+	// clusters lists the subgraphs containing a node vertex, innermost first
+	clusters []string
+	cross    float64
+	main     float64
+	crossSz  float64
+	mainSz   float64
+}
+
+// layoutGraph is the working state of the layered layout
+type layoutGraph struct {
+	chart    *Flowchart
+	vertices []*layoutVertex
+	// chains holds, per flowchart edge, the vertex path from source to target
+	chains [][]int
+	// reversed marks edges that were reversed to break cycles
+	reversed []bool
+	ranks    [][]int
+	up       [][]int
+	down     [][]int
+}
+
+// LayoutFlowchart positions a flowchart with a layered (Sugiyama) layout: cycles are broken,
+// nodes are assigned to ranks by longest path, long edges are split with dummy vertices,
+// crossings are reduced with barycenter sweeps and coordinates are balanced against each
+// node's neighbours.
+func LayoutFlowchart(chart *Flowchart) *Layout {
+	horizontal := chart.Direction == DirectionLR || chart.Direction == DirectionRL
+	graph := &layoutGraph{chart: chart}
+
+	nodeLines := make([][]string, len(chart.Nodes))
+	nodeIndex := make(map[string]int, len(chart.Nodes))
+	for i, node := range chart.Nodes {
+		nodeIndex[node.ID] = i
+		nodeLines[i] = wrapLabel(node.Label)
+		width, height := nodeSize(node.Shape, nodeLines[i])
+		clusters := subgraphChain(chart, node.Subgraph)
+		vertex := &layoutVertex{node: i, edge: -1, clusters: clusters}
+		if len(clusters) > 0 {
+			vertex.group = clusters[len(clusters)-1]
+		}
+		vertex.crossSz, vertex.mainSz = width, height
+		if horizontal {
+			vertex.crossSz, vertex.mainSz = height, width
+		}
+		graph.vertices = append(graph.vertices, vertex)
+	}
+
+	graph.breakCycles(nodeIndex)
+	graph.assignRanks(nodeIndex)
+	graph.splitLongEdges(nodeIndex, horizontal)
+	graph.orderRanks()
+	graph.assignCoordinates()
+	graph.separateClusters()
+
+	return graph.build(nodeLines, horizontal)
+}
+
+// subgraphChain returns a subgraph and its ancestors, innermost first
+func subgraphChain(chart *Flowchart, id string) []string {
+	var chain []string
+	for id != "" {
+		subgraph, ok := chart.subgraphs[id]
+		if !ok {
+			break
+		}
+		chain = append(chain, id)
+		id = subgraph.Parent
+	}
+	return chain
+}
+
+// wrapLabel splits a label into lines, wrapping long lines at word boundaries
+func wrapLabel(label string) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(label, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) > maxLabelChars:
+				lines = append(lines, line)
+				line = word
+			default:
+				line += " " + word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// textSize returns the size of a block of label lines
+func textSize(lines []string) (float64, float64) {
+	longest := 0
+	for _, line := range lines {
+		if n := len([]rune(line)); n > longest {
+			longest = n
+		}
+	}
+	return float64(longest) * charWidth, float64(len(lines)) * lineHeight
+}
+
+// nodeSize returns the outline size of a node that fits its label
+func nodeSize(shape NodeShape, lines []string) (float64, float64) {
+	textWidth, textHeight := textSize(lines)
+	width := math.Max(textWidth+2*nodePaddingX, minNodeWidth)
+	height := textHeight + 2*nodePaddingY
+
+	switch shape {
+	case ShapeCircle:
+		diameter := math.Max(width, height) * 1.05
+		return diameter, diameter
+	case ShapeDiamond:
+		return width * 1.5, height * 1.6
+	case ShapeHexagon, ShapeParallelogram, ShapeTrapezoid:
+		return width + height, height
+	case ShapeStadium, ShapeAsymmetric:
+		return width + height/2, height
+	case ShapeSubroutine:
+		return width + 16, height
+	case ShapeCylinder:
+		return width, height + 16
+	default:
+		return width, height
+	}
+}
+
+// breakCycles reverses the back edges found by a depth first search, so that the graph is
+// acyclic. Reversed edges are drawn in their original direction.
+func (g *layoutGraph) breakCycles(nodeIndex map[string]int) {
+	edges := g.chart.Edges
+	g.reversed = make([]bool, len(edges))
+	outgoing := make([][]int, len(g.chart.Nodes))
+	for i, edge := range edges {
+		outgoing[nodeIndex[edge.From]] = append(outgoing[nodeIndex[edge.From]], i)
+	}
+
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := make([]int, len(g.chart.Nodes))
+	var visit func(int)
+	visit = func(v int) {
+		state[v] = active
+		for _, e := range outgoing[v] {
+			target := nodeIndex[edges[e].To]
+			switch state[target] {
+			case unvisited:
+				visit(target)
+			case active:
+				g.reversed[e] = true
+			}
+		}
+		state[v] = done
+	}
+	for v := range g.chart.Nodes {
+		if state[v] == unvisited {
+			visit(v)
+		}
+	}
+}
+
+// edgeEnds returns the source and target of an edge in the acyclic graph
+func (g *layoutGraph) edgeEnds(e int, nodeIndex map[string]int) (int, int) {
+	edge := g.chart.Edges[e]
+	from, to := nodeIndex[edge.From], nodeIndex[edge.To]
+	if g.reversed[e] {
+		return to, from
+	}
+	return from, to
+}
+
+// edgeLength is the minimum number of ranks an edge spans. Labelled edges span two ranks so
+// the label gets a rank of its own.
+func (g *layoutGraph) edgeLength(e int) int {
+	if g.chart.Edges[e].Label != "" {
+		return 2
+	}
+	return 1
+}
+
+// assignRanks places every node on the longest path from a source node
+func (g *layoutGraph) assignRanks(nodeIndex map[string]int) {
+	count := len(g.chart.Nodes)
+	incoming := make([]int, count)
+	outgoing := make([][]int, count)
+	for e := range g.chart.Edges {
+		from, to := g.edgeEnds(e, nodeIndex)
+		if from == to {
+			continue
+		}
+		incoming[to]++
+		outgoing[from] = append(outgoing[from], e)
+	}
+
+	queue := make([]int, 0, count)
+	for v := 0; v < count; v++ {
+		if incoming[v] == 0 {
+			queue = append(queue, v)
+		}
+	}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, e := range outgoing[v] {
+			_, to := g.edgeEnds(e, nodeIndex)
+			if rank := g.vertices[v].rank + g.edgeLength(e); rank > g.vertices[to].rank {
+				g.vertices[to].rank = rank
+			}
+			incoming[to]--
+			if incoming[to] == 0 {
+				queue = append(queue, to)
+			}
+		}
+	}
+
+	// Pull sources down next to their first successor, so that an isolated entry point does
+	// not sit ranks above the node it feeds.
+	for v := count - 1; v >= 0; v-- {
+		if len(outgoing[v]) == 0 {
+			continue
+		}
+		minRank := math.MaxInt
+		for _, e := range outgoing[v] {
+			_, to := g.edgeEnds(e, nodeIndex)
+			if rank := g.vertices[to].rank - g.edgeLength(e); rank < minRank {
+				minRank = rank
+			}
+		}
+		if minRank > g.vertices[v].rank && !g.hasIncoming(v, nodeIndex) {
+			g.vertices[v].rank = minRank
+		}
+	}
+}
+
+// hasIncoming reports whether any edge of the acyclic graph ends at node v
+func (g *layoutGraph) hasIncoming(v int, nodeIndex map[string]int) bool {
+	for e := range g.chart.Edges {
+		from, to := g.edgeEnds(e, nodeIndex)
+		if to == v && from != v {
+			return true
+		}
+	}
+	return false
+}
+
+// splitLongEdges replaces edges spanning several ranks with chains of dummy vertices. The
+// middle dummy of a labelled edge is sized to hold the label.
+func (g *layoutGraph) splitLongEdges(nodeIndex map[string]int, horizontal bool) {
+	g.chains = make([][]int, len(g.chart.Edges))
+	maxRank := 0
+	for _, vertex := range g.vertices {
+		if vertex.rank > maxRank {
+			maxRank = vertex.rank
+		}
+	}
+
+	for e, edge := range g.chart.Edges {
+		from, to := g.edgeEnds(e, nodeIndex)
+		if from == to {
+			g.chains[e] = []int{from}
+			continue
+		}
+
+		group := ""
+		if g.vertices[from].group == g.vertices[to].group {
+			group = g.vertices[from].group
+		}
+
+		chain := []int{from}
+		span := g.vertices[to].rank - g.vertices[from].rank
+		labelRank := g.vertices[from].rank + span/2
+		for rank := g.vertices[from].rank + 1; rank < g.vertices[to].rank; rank++ {
+			dummy := &layoutVertex{node: -1, edge: e, rank: rank, group: group}
+			if edge.Label != "" && rank == labelRank {
+				width, height := textSize(wrapLabel(edge.Label))
+				width += 2 * labelPadding
+				height += 2 * labelPadding
+				dummy.crossSz, dummy.mainSz = width, height
+				if horizontal {
+					dummy.crossSz, dummy.mainSz = height, width
+				}
+			}
+			g.vertices = append(g.vertices, dummy)
+			chain = append(chain, len(g.vertices)-1)
+		}
+		chain = append(chain, to)
+		g.chains[e] = chain
+	}
+
+	g.ranks = make([][]int, maxRank+1)
+	g.up = make([][]int, len(g.vertices))
+	g.down = make([][]int, len(g.vertices))
+	for _, chain := range g.chains {
+		for i := 1; i < len(chain); i++ {
+			g.down[chain[i-1]] = append(g.down[chain[i-1]], chain[i])
+			g.up[chain[i]] = append(g.up[chain[i]], chain[i-1])
+		}
+	}
+	for v, vertex := range g.vertices {
+		g.ranks[vertex.rank] = append(g.ranks[vertex.rank], v)
+	}
+	for _, rank := range g.ranks {
+		for i, v := range rank {
+			g.vertices[v].order = i
+		}
+	}
+}
+
+// orderRanks reduces edge crossings with alternating downward and upward barycenter sweeps,
+// keeping the ordering with the fewest crossings. Vertices of one subgraph stay adjacent.
+func (g *layoutGraph) orderRanks() {
+	best := g.snapshotOrder()
+	bestCrossings := g.crossings()
+
+	for pass := 0; pass < orderingPasses && bestCrossings > 0; pass++ {
+		if pass%2 == 0 {
+			for r := 1; r < len(g.ranks); r++ {
+				g.sortRank(r, g.up)
+			}
+		} else {
+			for r := len(g.ranks) - 2; r >= 0; r-- {
+				g.sortRank(r, g.down)
+			}
+		}
+		if crossings := g.crossings(); crossings < bestCrossings {
+			best, bestCrossings = g.snapshotOrder(), crossings
+		}
+	}
+	g.restoreOrder(best)
+}
+
+// sortRank orders a rank by the mean position of each vertex's neighbours in the adjacent
+// rank. Subgraph members are sorted as a block by their mean barycenter.
+func (g *layoutGraph) sortRank(r int, neighbours [][]int) {
+	rank := g.ranks[r]
+	barycenter := make(map[int]float64, len(rank))
+	for _, v := range rank {
+		if len(neighbours[v]) == 0 {
+			barycenter[v] = float64(g.vertices[v].order)
+			continue
+		}
+		sum := 0.0
+		for _, n := range neighbours[v] {
+			sum += float64(g.vertices[n].order)
+		}
+		barycenter[v] = sum / float64(len(neighbours[v]))
+	}
+
+	groupSum := make(map[string]float64)
+	groupCount := make(map[string]int)
+	for _, v := range rank {
+		if group := g.vertices[v].group; group != "" {
+			groupSum[group] += barycenter[v]
+			groupCount[group]++
+		}
+	}
+	key := func(v int) float64 {
+		if group := g.vertices[v].group; group != "" {
+			return groupSum[group] / float64(groupCount[group])
+		}
+		return barycenter[v]
+	}
+
+	sort.SliceStable(rank, func(i, j int) bool {
+		a, b := rank[i], rank[j]
+		if ka, kb := key(a), key(b); ka != kb {
+			return ka < kb
+		}
+		if ga, gb := g.vertices[a].group, g.vertices[b].group; ga != gb {
+			return ga < gb
+		}
+		return barycenter[a] < barycenter[b]
+	})
+	for i, v := range rank {
+		g.vertices[v].order = i
+	}
+}
+
+// crossings counts edge crossings between adjacent ranks
+func (g *layoutGraph) crossings() int {
+	total := 0
+	for r := 0; r+1 < len(g.ranks); r++ {
+		type segment struct{ top, bottom int }
+		var segments []segment
+		for _, v := range g.ranks[r] {
+			for _, n := range g.down[v] {
+				segments = append(segments, segment{g.vertices[v].order, g.vertices[n].order})
+			}
+		}
+		for i := range segments {
+			for j := i + 1; j < len(segments); j++ {
+				a, b := segments[i], segments[j]
+				if (a.top-b.top)*(a.bottom-b.bottom) < 0 {
+					total++
+				}
+			}
+		}
+	}
+	return total
+}
+
+// snapshotOrder copies the current rank orderings
+func (g *layoutGraph) snapshotOrder() [][]int {
+	snapshot := make([][]int, len(g.ranks))
+	for r, rank := range g.ranks {
+		snapshot[r] = append([]int(nil), rank...)
+	}
+	return snapshot
+}
+
+// restoreOrder applies a saved rank ordering
+func (g *layoutGraph) restoreOrder(snapshot [][]int) {
+	g.ranks = snapshot
+	for _, rank := range g.ranks {
+		for i, v := range rank {
+			g.vertices[v].order = i
+		}
+	}
+}
+
+// separation is the minimum cross axis distance between the centers of adjacent vertices
+func (g *layoutGraph) separation(a, b *layoutVertex) float64 {
+	gap := nodeSeparation
+	if a.node < 0 && b.node < 0 {
+		gap = nodeSeparation / 2
+	}
+	if a.group != b.group {
+		gap += clusterPadding * 2
+	}
+	return (a.crossSz+b.crossSz)/2 + gap
+}
+
+// assignCoordinates packs each rank along the cross axis, then repeatedly moves vertices
+// towards the mean position of their neighbours while keeping the rank order and spacing.
+// Ranks are stacked along the main axis by their tallest vertex.
+func (g *layoutGraph) assignCoordinates() {
+	for _, rank := range g.ranks {
+		position := 0.0
+		for i, v := range rank {
+			if i > 0 {
+				position += g.separation(g.vertices[rank[i-1]], g.vertices[v])
+			}
+			g.vertices[v].cross = position
+		}
+		offset := position / 2
+		for _, v := range rank {
+			g.vertices[v].cross -= offset
+		}
+	}
+
+	for pass := 0; pass < positionPasses; pass++ {
+		if pass%2 == 0 {
+			for r := 1; r < len(g.ranks); r++ {
+				g.balanceRank(r, g.up)
+			}
+		} else {
+			for r := len(g.ranks) - 2; r >= 0; r-- {
+				g.balanceRank(r, g.down)
+			}
+		}
+	}
+
+	minCross := math.Inf(1)
+	for _, vertex := range g.vertices {
+		minCross = math.Min(minCross, vertex.cross-vertex.crossSz/2)
+	}
+	for _, vertex := range g.vertices {
+		vertex.cross -= minCross
+	}
+
+	opening, closing := g.clusterBoundaries()
+	position := 0.0
+	for r, rank := range g.ranks {
+		size := 0.0
+		for _, v := range rank {
+			size = math.Max(size, g.vertices[v].mainSz)
+		}
+		if r > 0 {
+			clusterSpace := float64(closing[r-1])*clusterPadding +
+				float64(opening[r])*(clusterPadding+clusterTitle) + nodeSeparation/2
+			position += math.Max(rankSeparation, clusterSpace)
+		}
+		for _, v := range rank {
+			g.vertices[v].main = position + size/2
+		}
+		position += size
+	}
+}
+
+// clusterRanks returns the first and last rank holding a node of each subgraph
+func (g *layoutGraph) clusterRanks() map[string][2]int {
+	spans := make(map[string][2]int)
+	for _, vertex := range g.vertices {
+		for _, id := range vertex.clusters {
+			span, ok := spans[id]
+			if !ok {
+				span = [2]int{vertex.rank, vertex.rank}
+			}
+			if vertex.rank < span[0] {
+				span[0] = vertex.rank
+			}
+			if vertex.rank > span[1] {
+				span[1] = vertex.rank
+			}
+			spans[id] = span
+		}
+	}
+	return spans
+}
+
+// clusterBoundaries counts, per rank, the subgraph boxes whose top edge lies just above it
+// and whose bottom edge lies just below it, so the gap between ranks can make room for them
+func (g *layoutGraph) clusterBoundaries() ([]int, []int) {
+	opening := make([]int, len(g.ranks))
+	closing := make([]int, len(g.ranks))
+	for _, span := range g.clusterRanks() {
+		opening[span[0]]++
+		closing[span[1]]++
+	}
+	return opening, closing
+}
+
+// separateClusters pushes vertices that are not in a subgraph out of the subgraph's box on
+// every rank it spans, shifting their neighbours along so that rank order is kept. Vertices
+// sandwiched between members cannot be moved out without reordering and are left in place.
+func (g *layoutGraph) separateClusters() {
+	spans := g.clusterRanks()
+	margin := clusterPadding + nodeSeparation/2
+
+	for _, subgraph := range g.chart.Subgraphs {
+		span, ok := spans[subgraph.ID]
+		if !ok {
+			continue
+		}
+		for r := span[0]; r <= span[1]; r++ {
+			low, high := g.clusterExtent(subgraph.ID)
+			rank := g.ranks[r]
+			first, last := -1, -1
+			for i, v := range rank {
+				if containsString(g.vertices[v].clusters, subgraph.ID) {
+					if first < 0 {
+						first = i
+					}
+					last = i
+				}
+			}
+
+			for i, v := range rank {
+				vertex := g.vertices[v]
+				if vertex.node < 0 || containsString(vertex.clusters, subgraph.ID) {
+					continue
+				}
+				left, right := vertex.cross-vertex.crossSz/2, vertex.cross+vertex.crossSz/2
+				if right <= low-margin || left >= high+margin {
+					continue
+				}
+
+				pushRight := vertex.cross >= (low+high)/2
+				if first >= 0 {
+					if i > first && i < last {
+						continue
+					}
+					pushRight = i > last
+				}
+				if pushRight {
+					g.shiftRank(rank[i:], high+margin-left)
+				} else {
+					g.shiftRank(rank[:i+1], low-margin-right)
+				}
+			}
+		}
+	}
+}
+
+// clusterExtent returns the cross axis extent of the nodes in a subgraph
+func (g *layoutGraph) clusterExtent(id string) (float64, float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, vertex := range g.vertices {
+		if containsString(vertex.clusters, id) {
+			low = math.Min(low, vertex.cross-vertex.crossSz/2)
+			high = math.Max(high, vertex.cross+vertex.crossSz/2)
+		}
+	}
+	return low, high
+}
+
+// shiftRank moves vertices along the cross axis
+func (g *layoutGraph) shiftRank(vertices []int, delta float64) {
+	for _, v := range vertices {
+		g.vertices[v].cross += delta
+	}
+}
+
+// balanceRank moves each vertex of a rank towards its neighbours in the adjacent rank and
+// then resolves overlaps, splitting the correction evenly between left and right passes
+func (g *layoutGraph) balanceRank(r int, neighbours [][]int) {
+	rank := g.ranks[r]
+	if len(rank) == 0 {
+		return
+	}
+
+	desired := make([]float64, len(rank))
+	for i, v := range rank {
+		desired[i] = g.vertices[v].cross
+		if len(neighbours[v]) == 0 {
+			continue
+		}
+		sum := 0.0
+		for _, n := range neighbours[v] {
+			sum += g.vertices[n].cross
+		}
+		desired[i] = sum / float64(len(neighbours[v]))
+	}
+
+	left := append([]float64(nil), desired...)
+	for i := 1; i < len(rank); i++ {
+		minimum := left[i-1] + g.separation(g.vertices[rank[i-1]], g.vertices[rank[i]])
+		left[i] = math.Max(left[i], minimum)
+	}
+	right := append([]float64(nil), desired...)
+	for i := len(rank) - 2; i >= 0; i-- {
+		maximum := right[i+1] - g.separation(g.vertices[rank[i]], g.vertices[rank[i+1]])
+		right[i] = math.Min(right[i], maximum)
+	}
+
+	for i, v := range rank {
+		g.vertices[v].cross = (left[i] + right[i]) / 2
+	}
+	for i := 1; i < len(rank); i++ {
+		minimum := g.vertices[rank[i-1]].cross + g.separation(g.vertices[rank[i-1]], g.vertices[rank[i]])
+		if g.vertices[rank[i]].cross < minimum {
+			g.vertices[rank[i]].cross = minimum
+		}
+	}
+}
+
+// build converts rank space coordinates into the drawing direction and routes the edges
+func (g *layoutGraph) build(nodeLines [][]string, horizontal bool) *Layout {
+	width, height := 0.0, 0.0
+	for _, vertex := range g.vertices {
+		width = math.Max(width, vertex.cross+vertex.crossSz/2)
+		height = math.Max(height, vertex.main+vertex.mainSz/2)
+	}
+
+	toPoint := func(cross, main float64) Point {
+		switch g.chart.Direction {
+		case DirectionBT:
+			return Point{cross, height - main}
+		case DirectionLR:
+			return Point{main, cross}
+		case DirectionRL:
+			return Point{height - main, cross}
+		default:
+			return Point{cross, main}
+		}
+	}
+
+	layout := &Layout{}
+	for i, node := range g.chart.Nodes {
+		vertex := g.vertices[i]
+		center := toPoint(vertex.cross, vertex.main)
+		placed := LayoutNode{Node: node, Lines: nodeLines[i], X: center.X, Y: center.Y,
+			Width: vertex.crossSz, Height: vertex.mainSz}
+		if horizontal {
+			placed.Width, placed.Height = vertex.mainSz, vertex.crossSz
+		}
+		layout.Nodes = append(layout.Nodes, placed)
+	}
+
+	for e, edge := range g.chart.Edges {
+		chain := g.chains[e]
+		routed := LayoutEdge{Edge: edge}
+		if len(chain) == 1 {
+			routed.Points = selfLoop(layout.Nodes[chain[0]])
+		} else {
+			points := make([]Point, len(chain))
+			for i, v := range chain {
+				points[i] = toPoint(g.vertices[v].cross, g.vertices[v].main)
+			}
+			if g.reversed[e] {
+				reversePoints(points)
+				chain = reverseInts(chain)
+			}
+			points[0] = clipToNode(layout.Nodes[chain[0]], points[1])
+			points[len(points)-1] = clipToNode(layout.Nodes[chain[len(chain)-1]], points[len(points)-2])
+			routed.Points = points
+		}
+
+		if edge.Label != "" {
+			routed.LabelLines = wrapLabel(edge.Label)
+			routed.LabelWidth, routed.LabelHeight = textSize(routed.LabelLines)
+			routed.LabelWidth += 2 * labelPadding
+			routed.LabelHeight += 2 * labelPadding
+			routed.Label = midpoint(routed.Points)
+			for _, v := range chain {
+				if vertex := g.vertices[v]; vertex.node < 0 && vertex.crossSz > 0 {
+					routed.Label = toPoint(vertex.cross, vertex.main)
+				}
+			}
+		}
+		layout.Edges = append(layout.Edges, routed)
+	}
+
+	layout.Clusters = g.clusters(layout)
+	layout.offset(diagramMargin)
+	return layout
+}
+
+// clusters computes the subgraph boxes around their member nodes, innermost first so that
+// each parent box encloses its children
+func (g *layoutGraph) clusters(layout *Layout) []LayoutCluster {
+	boxes := make(map[string]LayoutCluster)
+	depth := func(subgraph *FlowSubgraph) int {
+		d := 0
+		for parent := subgraph.Parent; parent != ""; d++ {
+			parent = g.chart.subgraphs[parent].Parent
+		}
+		return d
+	}
+
+	subgraphs := append([]*FlowSubgraph(nil), g.chart.Subgraphs...)
+	sort.SliceStable(subgraphs, func(i, j int) bool { return depth(subgraphs[i]) > depth(subgraphs[j]) })
+
+	var clusters []LayoutCluster
+	for _, subgraph := range subgraphs {
+		minX, minY := math.Inf(1), math.Inf(1)
+		maxX, maxY := math.Inf(-1), math.Inf(-1)
+		extend := func(x0, y0, x1, y1 float64) {
+			minX, minY = math.Min(minX, x0), math.Min(minY, y0)
+			maxX, maxY = math.Max(maxX, x1), math.Max(maxY, y1)
+		}
+		for _, node := range layout.Nodes {
+			if node.Node.Subgraph == subgraph.ID {
+				extend(node.X-node.Width/2, node.Y-node.Height/2, node.X+node.Width/2, node.Y+node.Height/2)
+			}
+		}
+		for _, child := range g.chart.Subgraphs {
+			if box, ok := boxes[child.ID]; ok && child.Parent == subgraph.ID {
+				extend(box.X, box.Y, box.X+box.Width, box.Y+box.Height)
+			}
+		}
+		if math.IsInf(minX, 1) {
+			continue
+		}
+
+		titleWidth, _ := textSize([]string{subgraph.Label})
+		box := LayoutCluster{
+			Subgraph: subgraph,
+			X:        minX - clusterPadding,
+			Y:        minY - clusterPadding - clusterTitle,
+			Width:    math.Max(maxX-minX+2*clusterPadding, titleWidth+2*clusterPadding),
+			Height:   maxY - minY + 2*clusterPadding + clusterTitle,
+			Depth:    depth(subgraph),
+		}
+		boxes[subgraph.ID] = box
+		clusters = append(clusters, box)
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Depth < clusters[j].Depth })
+	return clusters
+}
+
+// offset shifts the layout so that everything, clusters included, sits inside the margin
+func (l *Layout) offset(margin float64) {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	extend := func(x0, y0, x1, y1 float64) {
+		minX, minY = math.Min(minX, x0), math.Min(minY, y0)
+		maxX, maxY = math.Max(maxX, x1), math.Max(maxY, y1)
+	}
+	for _, node := range l.Nodes {
+		extend(node.X-node.Width/2, node.Y-node.Height/2, node.X+node.Width/2, node.Y+node.Height/2)
+	}
+	for _, cluster := range l.Clusters {
+		extend(cluster.X, cluster.Y, cluster.X+cluster.Width, cluster.Y+cluster.Height)
+	}
+	for _, edge := range l.Edges {
+		for _, p := range edge.Points {
+			extend(p.X, p.Y, p.X, p.Y)
+		}
+		if len(edge.LabelLines) > 0 {
+			extend(edge.Label.X-edge.LabelWidth/2, edge.Label.Y-edge.LabelHeight/2,
+				edge.Label.X+edge.LabelWidth/2, edge.Label.Y+edge.LabelHeight/2)
+		}
+	}
+
+	dx, dy := margin-minX, margin-minY
+	for i := range l.Nodes {
+		l.Nodes[i].X += dx
+		l.Nodes[i].Y += dy
+	}
+	for i := range l.Clusters {
+		l.Clusters[i].X += dx
+		l.Clusters[i].Y += dy
+	}
+	for i := range l.Edges {
+		for j := range l.Edges[i].Points {
+			l.Edges[i].Points[j].X += dx
+			l.Edges[i].Points[j].Y += dy
+		}
+		l.Edges[i].Label.X += dx
+		l.Edges[i].Label.Y += dy
+	}
+	l.Width = maxX - minX + 2*margin
+	l.Height = maxY - minY + 2*margin
+}
+
+// selfLoop routes an edge from a node back to itself around its right side
+func selfLoop(node LayoutNode) []Point {
+	right := node.X + node.Width/2
+	top := node.Y - node.Height/4
+	bottom := node.Y + node.Height/4
+	return []Point{{right, top}, {right + 20, top}, {right + 20, bottom}, {right, bottom}}
+}
+
+// clipToNode returns where the line from the node center towards p leaves the node outline
+func clipToNode(node LayoutNode, p Point) Point {
+	dx, dy := p.X-node.X, p.Y-node.Y
+	if dx == 0 && dy == 0 {
+		return Point{node.X, node.Y}
+	}
+	hw, hh := node.Width/2, node.Height/2
+
+	var scale float64
+	switch node.Node.Shape {
+	case ShapeCircle:
+		scale = hw / math.Hypot(dx, dy)
+	case ShapeDiamond:
+		scale = 1 / (math.Abs(dx)/hw + math.Abs(dy)/hh)
+	default:
+		scale = math.Min(hw/math.Max(math.Abs(dx), 1e-9), hh/math.Max(math.Abs(dy), 1e-9))
+	}
+	return Point{node.X + dx*scale, node.Y + dy*scale}
+}
+
+// midpoint returns the point halfway along a polyline
+func midpoint(points []Point) Point {
+	total := 0.0
+	for i := 1; i < len(points); i++ {
+		total += math.Hypot(points[i].X-points[i-1].X, points[i].Y-points[i-1].Y)
+	}
+	remaining := total / 2
+	for i := 1; i < len(points); i++ {
+		length := math.Hypot(points[i].X-points[i-1].X, points[i].Y-points[i-1].Y)
+		if length >= remaining && length > 0 {
+			t := remaining / length
+			return Point{
+				points[i-1].X + (points[i].X-points[i-1].X)*t,
+				points[i-1].Y + (points[i].Y-points[i-1].Y)*t,
+			}
+		}
+		remaining -= length
+	}
+	return points[0]
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// reversePoints reverses a polyline in place
+func reversePoints(points []Point) {
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+}
+
+// reverseInts returns a reversed copy of values
+func reverseInts(values []int) []int {
+	reversed := make([]int, len(values))
+	for i, v := range values {
+		reversed[len(values)-1-i] = v
+	}
+	return reversed
+}
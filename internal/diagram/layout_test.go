@@ -0,0 +1,249 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+// layoutNode returns the placed node with the given ID
+func layoutNode(t *testing.T, layout *Layout, id string) LayoutNode {
+	t.Helper()
+	for _, node := range layout.Nodes {
+		if node.Node.ID == id {
+			return node
+		}
+	}
+	t.Fatalf("node %s not in layout", id)
+	return LayoutNode{}
+}
+
+// overlaps reports whether two placed nodes overlap
+func overlaps(a, b LayoutNode) bool {
+	return a.X-a.Width/2 < b.X+b.Width/2 && b.X-b.Width/2 < a.X+a.Width/2 &&
+		a.Y-a.Height/2 < b.Y+b.Height/2 && b.Y-b.Height/2 < a.Y+a.Height/2
+}
+
+func parseAndLayout(t *testing.T, code string) *Layout {
+	t.Helper()
+	chart, err := ParseFlowchart(code)
+	if err != nil {
+		t.Fatalf("ParseFlowchart() error = %v", err)
+	}
+	return LayoutFlowchart(chart)
+}
+
+func TestLayoutFlowchartRanks(t *testing.T) {
+	layout := parseAndLayout(t, `graph TD
+    A[Client] --> B[Gateway]
+    B --> C[Service One]
+    B --> D[Service Two]
+    C --> E[(Database)]
+    D --> E
+    A --> E`)
+
+	a, b, e := layoutNode(t, layout, "A"), layoutNode(t, layout, "B"), layoutNode(t, layout, "E")
+	c, d := layoutNode(t, layout, "C"), layoutNode(t, layout, "D")
+	if !(a.Y < b.Y && b.Y < c.Y && c.Y < e.Y) {
+		t.Errorf("Expected ranks to run top to bottom, got A=%v B=%v C=%v E=%v", a.Y, b.Y, c.Y, e.Y)
+	}
+	if c.Y != d.Y {
+		t.Errorf("Expected siblings on one rank, got %v and %v", c.Y, d.Y)
+	}
+
+	for i, x := range layout.Nodes {
+		for _, y := range layout.Nodes[i+1:] {
+			if overlaps(x, y) {
+				t.Errorf("Nodes %s and %s overlap", x.Node.ID, y.Node.ID)
+			}
+		}
+	}
+
+	for _, edge := range layout.Edges {
+		if edge.Edge.From == "A" && edge.Edge.To == "E" && len(edge.Points) != 4 {
+			t.Errorf("Expected the long edge routed through two dummy vertices, got %d points", len(edge.Points))
+		}
+	}
+}
+
+func TestLayoutFlowchartDirections(t *testing.T) {
+	for direction, check := range map[string]func(a, b LayoutNode) bool{
+		"TD": func(a, b LayoutNode) bool { return a.Y < b.Y },
+		"BT": func(a, b LayoutNode) bool { return a.Y > b.Y },
+		"LR": func(a, b LayoutNode) bool { return a.X < b.X },
+		"RL": func(a, b LayoutNode) bool { return a.X > b.X },
+	} {
+		layout := parseAndLayout(t, "graph "+direction+"\n    A[Start] --> B[End]")
+		if !check(layoutNode(t, layout, "A"), layoutNode(t, layout, "B")) {
+			t.Errorf("Direction %s: nodes placed in the wrong order", direction)
+		}
+	}
+}
+
+func TestLayoutFlowchartCycles(t *testing.T) {
+	layout := parseAndLayout(t, `graph LR
+    A --> B --> C --> A
+    C --> C`)
+
+	if len(layout.Edges) != 4 {
+		t.Fatalf("Expected 4 edges, got %d", len(layout.Edges))
+	}
+	for _, edge := range layout.Edges {
+		from, to := layoutNode(t, layout, edge.Edge.From), layoutNode(t, layout, edge.Edge.To)
+		first, last := edge.Points[0], edge.Points[len(edge.Points)-1]
+		if distance(first, from) > distance(first, to) && edge.Edge.From != edge.Edge.To {
+			t.Errorf("Edge %s -> %s should start at its source", edge.Edge.From, edge.Edge.To)
+		}
+		if distance(last, to) > distance(last, from) && edge.Edge.From != edge.Edge.To {
+			t.Errorf("Edge %s -> %s should end at its target", edge.Edge.From, edge.Edge.To)
+		}
+	}
+}
+
+func distance(p Point, node LayoutNode) float64 {
+	dx, dy := p.X-node.X, p.Y-node.Y
+	return dx*dx + dy*dy
+}
+
+func TestLayoutFlowchartClusters(t *testing.T) {
+	layout := parseAndLayout(t, `graph TD
+    Internet[Internet] --> LB[Load Balancer]
+    subgraph VPC [VPC]
+        subgraph Private [Private Subnet]
+            LB --> App1[App 1]
+            LB --> App2[App 2]
+        end
+        App1 --> Cache[Cache]
+    end
+    App2 --> Monitor[Monitoring]`)
+
+	if len(layout.Clusters) != 2 {
+		t.Fatalf("Expected 2 clusters, got %d", len(layout.Clusters))
+	}
+
+	boxes := make(map[string]LayoutCluster)
+	for _, cluster := range layout.Clusters {
+		boxes[cluster.Subgraph.ID] = cluster
+	}
+	inside := func(node LayoutNode, box LayoutCluster) bool {
+		return node.X-node.Width/2 >= box.X && node.X+node.Width/2 <= box.X+box.Width &&
+			node.Y-node.Height/2 >= box.Y && node.Y+node.Height/2 <= box.Y+box.Height
+	}
+	overlapsBox := func(node LayoutNode, box LayoutCluster) bool {
+		return node.X-node.Width/2 < box.X+box.Width && box.X < node.X+node.Width/2 &&
+			node.Y-node.Height/2 < box.Y+box.Height && box.Y < node.Y+node.Height/2
+	}
+
+	for _, id := range []string{"App1", "App2", "Cache"} {
+		if !inside(layoutNode(t, layout, id), boxes["VPC"]) {
+			t.Errorf("Expected %s inside the VPC box", id)
+		}
+	}
+	for _, id := range []string{"App1", "App2"} {
+		if !inside(layoutNode(t, layout, id), boxes["Private"]) {
+			t.Errorf("Expected %s inside the Private box", id)
+		}
+	}
+	for _, id := range []string{"Internet", "LB", "Monitor"} {
+		if overlapsBox(layoutNode(t, layout, id), boxes["VPC"]) {
+			t.Errorf("Expected %s outside the VPC box", id)
+		}
+	}
+	if !inside(LayoutNode{X: boxes["Private"].X + 1, Y: boxes["Private"].Y + 1}, boxes["VPC"]) {
+		t.Error("Expected the nested box inside its parent")
+	}
+}
+
+func TestNativeBackendRender(t *testing.T) {
+	backend := NewNativeBackend()
+	code := `graph TD
+    A["<script>alert(1)</script> & Co"] -->|"a < b"| B{Valid?}
+    B -.-> C([Done])`
+
+	svg, err := backend.Render(context.Background(), code, ImageSVG)
+	if err != nil {
+		t.Fatalf("Render(svg) error = %v", err)
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if err != io.EOF {
+				t.Errorf("Expected well formed SVG, got %v", err)
+			}
+			break
+		}
+	}
+	if strings.Contains(string(svg), "<script") {
+		t.Error("Expected label markup to be escaped")
+	}
+	for _, want := range []string{"&lt;script&gt;", "&amp;", "a &lt; b", "stroke-dasharray", "Valid?"} {
+		if !strings.Contains(string(svg), want) {
+			t.Errorf("Expected SVG to contain %q", want)
+		}
+	}
+
+	data, err := backend.Render(context.Background(), code, ImagePNG)
+	if err != nil {
+		t.Fatalf("Render(png) error = %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected a decodable PNG, got %v", err)
+	}
+	layout := parseAndLayout(t, code)
+	if got, want := img.Bounds().Dx(), int(layout.Width*pngScale+0.999); got != want {
+		t.Errorf("Expected PNG width %d, got %d", want, got)
+	}
+
+	if _, err := backend.Render(context.Background(), "pie title Pets", ImagePNG); err == nil {
+		t.Error("Expected an error for an unsupported diagram type")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := backend.Render(ctx, code, ImagePNG); err == nil {
+		t.Error("Expected an error for a cancelled context")
+	}
+}
+
+func TestRenderPNGLimitsSize(t *testing.T) {
+	var code strings.Builder
+	code.WriteString("graph LR\n")
+	for i := 0; i < 60; i++ {
+		code.WriteString("    N")
+		code.WriteString(strings.Repeat("x", i))
+		code.WriteString(" --> N")
+		code.WriteString(strings.Repeat("x", i+1))
+		code.WriteString("\n")
+	}
+
+	data, err := NewNativeBackend().Render(context.Background(), code.String(), ImagePNG)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected a decodable PNG, got %v", err)
+	}
+	if img.Bounds().Dx() > maxPNGDimension || img.Bounds().Dy() > maxPNGDimension {
+		t.Errorf("Expected PNG within %d pixels, got %v", maxPNGDimension, img.Bounds())
+	}
+}
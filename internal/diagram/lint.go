@@ -0,0 +1,382 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxReadableNodes is the node count above which a diagram is reported as hard to read
+const DefaultMaxReadableNodes = 30
+
+// maxRepairPasses bounds how often CheckDiagram re-parses code after applying repairs
+const maxRepairPasses = 4
+
+// Severity is how serious a diagnostic is
+type Severity string
+
+const (
+	// SeverityError means the diagram cannot be rendered
+	SeverityError Severity = "error"
+	// SeverityWarning means the diagram renders but is likely to be hard to read or wrong
+	SeverityWarning Severity = "warning"
+)
+
+// Rules reported by CheckDiagram
+const (
+	// RuleSyntax is a syntax error that could not be repaired automatically
+	RuleSyntax = "syntax"
+	// RuleUnquotedLabel is a label containing brackets without quotes
+	RuleUnquotedLabel = "unquoted-label"
+	// RuleReservedID is a node ID that Mermaid reads as a keyword
+	RuleReservedID = "reserved-id"
+	// RuleMissingEnd is a subgraph without its closing 'end'
+	RuleMissingEnd = "missing-end"
+	// RuleDuplicateID is a node ID declared again with a different label
+	RuleDuplicateID = "duplicate-id"
+	// RuleLinkLetter is a node ID starting with o or x directly after an open link
+	RuleLinkLetter = "link-letter"
+	// RuleTooManyNodes is a diagram with more nodes than can be read at a glance
+	RuleTooManyNodes = "too-many-nodes"
+	// RuleDanglingEdge is a link to a node that is never declared, usually a typo
+	RuleDanglingEdge = "dangling-edge"
+	// RuleIsolatedNode is a node without links in a diagram that has links
+	RuleIsolatedNode = "isolated-node"
+	// RuleEmptySubgraph is a subgraph without nodes
+	RuleEmptySubgraph = "empty-subgraph"
+)
+
+// reservedIDs are keywords that break a Mermaid flowchart when used as node IDs. Mermaid
+// matches them case sensitively, so "End" is a valid ID.
+var reservedIDs = map[string]bool{
+	"end": true, "graph": true, "flowchart": true, "subgraph": true, "style": true,
+	"class": true, "classDef": true, "click": true, "linkStyle": true,
+}
+
+// Diagnostic is a problem found in diagram code. Line and Column are 1-based and zero when the
+// problem concerns the whole diagram.
+type Diagnostic struct {
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	Message  string   `json:"message"`
+}
+
+// String formats the diagnostic with its position
+func (d Diagnostic) String() string {
+	return (&ParseError{Line: d.Line, Column: d.Column, Message: d.Message}).Error()
+}
+
+// Repair is an automatic fix applied to diagram code. Line is the line of the original code
+// the fix was made on, or zero for fixes to the whole diagram.
+type Repair struct {
+	Line    int    `json:"line,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// LintOptions configures the readability checks of CheckDiagram
+type LintOptions struct {
+	// MaxNodes is the node count above which a diagram is reported as hard to read
+	MaxNodes int
+}
+
+// DefaultLintOptions returns the default lint options
+func DefaultLintOptions() LintOptions {
+	return LintOptions{MaxNodes: DefaultMaxReadableNodes}
+}
+
+// DiagramCheck is the result of checking Mermaid diagram code
+type DiagramCheck struct {
+	// Code is the diagram code with all repairs applied
+	Code        string       `json:"-"`
+	Repairs     []Repair     `json:"repairs,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// Valid reports whether the checked code has no errors
+func (c *DiagramCheck) Valid() bool {
+	return c.Err() == nil
+}
+
+// Err returns the errors found in the code, one per line, or nil when there are none
+func (c *DiagramCheck) Err() error {
+	var errs []error
+	for _, diagnostic := range c.Diagnostics {
+		if diagnostic.Severity == SeverityError {
+			errs = append(errs, errors.New(diagnostic.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Warnings returns the warning diagnostics
+func (c *DiagramCheck) Warnings() []Diagnostic {
+	var warnings []Diagnostic
+	for _, diagnostic := range c.Diagnostics {
+		if diagnostic.Severity == SeverityWarning {
+			warnings = append(warnings, diagnostic)
+		}
+	}
+	return warnings
+}
+
+// CheckDiagram validates Mermaid flowchart code and repairs the mistakes language models
+// commonly make: unquoted labels with brackets, keywords used as node IDs, subgraphs missing
+// their 'end', node IDs reused for different nodes and node IDs starting with o or x after an
+// open link. The repaired code is then linted for diagrams that render but read poorly.
+// Errors that cannot be repaired are reported with their line and column.
+func CheckDiagram(code string, options LintOptions) *DiagramCheck {
+	check := &DiagramCheck{Code: strings.TrimSpace(strings.ReplaceAll(code, "\r\n", "\n"))}
+
+	for pass := 0; pass < maxRepairPasses; pass++ {
+		chart, err := ParseFlowchart(check.Code)
+		if err != nil {
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) && parseErr.openSubgraphs > 0 {
+				check.closeSubgraphs(parseErr.openSubgraphs)
+				continue
+			}
+			check.addParseError(err)
+			return check
+		}
+
+		edits := chart.issues
+		if renames := reservedIDEdits(chart); len(renames) > 0 {
+			edits = append(edits, renames...)
+		} else {
+			edits = append(edits, duplicateIDEdits(chart)...)
+		}
+		if len(edits) == 0 {
+			check.lint(chart, options)
+			return check
+		}
+		check.applyEdits(edits)
+	}
+
+	check.Diagnostics = append(check.Diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Rule:     RuleSyntax,
+		Message:  "diagram could not be repaired",
+	})
+	return check
+}
+
+// addParseError records a parse error as an error diagnostic
+func (c *DiagramCheck) addParseError(err error) {
+	diagnostic := Diagnostic{Severity: SeverityError, Rule: RuleSyntax, Message: err.Error()}
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		diagnostic.Line, diagnostic.Column, diagnostic.Message = parseErr.Line, parseErr.Column, parseErr.Message
+	}
+	c.Diagnostics = append(c.Diagnostics, diagnostic)
+}
+
+// closeSubgraphs appends the missing 'end' lines of unclosed subgraphs
+func (c *DiagramCheck) closeSubgraphs(count int) {
+	c.Code += strings.Repeat("\n    end", count)
+	c.Repairs = append(c.Repairs, Repair{
+		Rule:    RuleMissingEnd,
+		Message: fmt.Sprintf("closed %d subgraph(s) missing their 'end'", count),
+	})
+}
+
+// applyEdits applies source edits, latest on a line first so earlier offsets stay valid
+func (c *DiagramCheck) applyEdits(edits []sourceEdit) {
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].line != edits[j].line {
+			return edits[i].line < edits[j].line
+		}
+		return edits[i].offset > edits[j].offset
+	})
+
+	lines := strings.Split(c.Code, "\n")
+	for _, edit := range edits {
+		line := lines[edit.line-1]
+		lines[edit.line-1] = line[:edit.offset] + edit.replacement + line[edit.offset+edit.length:]
+	}
+	c.Code = strings.Join(lines, "\n")
+
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].line != edits[j].line {
+			return edits[i].line < edits[j].line
+		}
+		return edits[i].offset < edits[j].offset
+	})
+	seen := make(map[string]bool)
+	for _, edit := range edits {
+		// A renamed ID is edited at every reference but reported once
+		if seen[edit.message] {
+			continue
+		}
+		seen[edit.message] = true
+		c.Repairs = append(c.Repairs, Repair{Line: edit.line, Rule: edit.rule, Message: edit.message})
+	}
+}
+
+// reservedIDEdits renames nodes whose IDs are Mermaid keywords at every reference. A node
+// without a declared label keeps its ID as its label.
+func reservedIDEdits(chart *Flowchart) []sourceEdit {
+	var edits []sourceEdit
+	renamed := make(map[string]string)
+	labelled := make(map[string]bool)
+	for _, ref := range chart.refs {
+		if !reservedIDs[ref.id] {
+			continue
+		}
+		newID, ok := renamed[ref.id]
+		if !ok {
+			newID = uniqueID(chart, ref.id+"Node")
+			renamed[ref.id] = newID
+		}
+
+		replacement := newID
+		if !labelled[ref.id] && !isDeclared(chart, ref.id) {
+			replacement += "[" + ref.id + "]"
+			labelled[ref.id] = true
+		}
+		edits = append(edits, sourceEdit{
+			rule:        RuleReservedID,
+			line:        ref.line,
+			column:      ref.column,
+			offset:      ref.start,
+			length:      len(ref.id),
+			replacement: replacement,
+			message:     fmt.Sprintf("renamed node %q to %q because %q is a Mermaid keyword", ref.id, newID, ref.id),
+		})
+	}
+	return edits
+}
+
+// duplicateIDEdits gives a new ID to each declaration that reuses the ID of an earlier node
+// with a different label, so that the two are drawn as separate nodes
+func duplicateIDEdits(chart *Flowchart) []sourceEdit {
+	var edits []sourceEdit
+	labels := make(map[string]string)
+	taken := make(map[string]bool)
+	for _, ref := range chart.refs {
+		if !ref.declared {
+			continue
+		}
+		first, seen := labels[ref.id]
+		if !seen {
+			labels[ref.id] = ref.label
+			continue
+		}
+		if ref.label == first {
+			continue
+		}
+
+		newID := ""
+		for n := 2; newID == "" || taken[newID]; n++ {
+			newID = uniqueID(chart, fmt.Sprintf("%s_%d", ref.id, n))
+		}
+		taken[newID] = true
+		edits = append(edits, sourceEdit{
+			rule:        RuleDuplicateID,
+			line:        ref.line,
+			column:      ref.column,
+			offset:      ref.start,
+			length:      len(ref.id),
+			replacement: newID,
+			message: fmt.Sprintf("renamed the second node %q (%q) to %q; it was declared earlier as %q",
+				ref.id, ref.label, newID, first),
+		})
+	}
+	return edits
+}
+
+// lint reports diagrams that render but are likely to be hard to read or wrong
+func (c *DiagramCheck) lint(chart *Flowchart, options LintOptions) {
+	if options.MaxNodes > 0 && len(chart.Nodes) > options.MaxNodes {
+		c.warn(0, 0, RuleTooManyNodes, fmt.Sprintf("diagram has %d nodes; more than %d are hard to read, consider splitting it",
+			len(chart.Nodes), options.MaxNodes))
+	}
+
+	linked := make(map[string]bool)
+	for _, edge := range chart.Edges {
+		linked[edge.From], linked[edge.To] = true, true
+	}
+
+	// Undeclared nodes are only suspicious when the diagram labels its other nodes
+	labelled := false
+	for _, ref := range chart.refs {
+		labelled = labelled || ref.declared
+	}
+
+	reported := make(map[string]bool)
+	for _, ref := range chart.refs {
+		if reported[ref.id] {
+			continue
+		}
+		if _, isNode := chart.nodes[ref.id]; !isNode {
+			continue
+		}
+		switch {
+		case labelled && linked[ref.id] && !isDeclared(chart, ref.id):
+			c.warn(ref.line, ref.column, RuleDanglingEdge,
+				fmt.Sprintf("node %q is linked but never declared with a label; check for a typo", ref.id))
+		case len(chart.Edges) > 0 && !linked[ref.id]:
+			c.warn(ref.line, ref.column, RuleIsolatedNode, fmt.Sprintf("node %q is not linked to any other node", ref.id))
+		default:
+			continue
+		}
+		reported[ref.id] = true
+	}
+
+	parents := make(map[string]bool)
+	for _, subgraph := range chart.Subgraphs {
+		parents[subgraph.Parent] = true
+	}
+	for _, subgraph := range chart.Subgraphs {
+		if len(subgraph.Nodes) == 0 && !parents[subgraph.ID] {
+			c.warn(0, 0, RuleEmptySubgraph, fmt.Sprintf("subgraph %q has no nodes", subgraph.Label))
+		}
+	}
+}
+
+// warn records a warning diagnostic
+func (c *DiagramCheck) warn(line, column int, rule, message string) {
+	c.Diagnostics = append(c.Diagnostics, Diagnostic{
+		Line: line, Column: column, Severity: SeverityWarning, Rule: rule, Message: message,
+	})
+}
+
+// isDeclared reports whether any reference to the node gives it a shape and label
+func isDeclared(chart *Flowchart, id string) bool {
+	for _, ref := range chart.refs {
+		if ref.id == id && ref.declared {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueID returns id, with a numeric suffix when a node or subgraph already uses it
+func uniqueID(chart *Flowchart, id string) string {
+	candidate := id
+	for n := 2; ; n++ {
+		_, isNode := chart.nodes[candidate]
+		_, isSubgraph := chart.subgraphs[candidate]
+		if !isNode && !isSubgraph {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s%d", id, n)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// repairRules returns the rules of the repairs applied by a check
+func repairRules(check *DiagramCheck) []string {
+	rules := make([]string, 0, len(check.Repairs))
+	for _, repair := range check.Repairs {
+		rules = append(rules, repair.Rule)
+	}
+	return rules
+}
+
+func TestCheckDiagramRepairs(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      string
+		want      string
+		wantRules []string
+	}{
+		{
+			name:      "unquoted parentheses",
+			code:      "graph TD\n    A[Amazon S3 (Standard)] --> B(Lambda (Python))",
+			want:      "graph TD\n    A[\"Amazon S3 (Standard)\"] --> B(\"Lambda (Python)\")",
+			wantRules: []string{RuleUnquotedLabel, RuleUnquotedLabel},
+		},
+		{
+			name:      "reserved word as ID",
+			code:      "graph LR\n    start[Start] --> end\n    end --> class --> Done[Done]",
+			want:      "graph LR\n    start[Start] --> endNode[end]\n    endNode --> classNode[class] --> Done[Done]",
+			wantRules: []string{RuleReservedID, RuleReservedID},
+		},
+		{
+			name:      "declared reserved ID keeps its label",
+			code:      "graph TD\n    A --> end[Finish]",
+			want:      "graph TD\n    A --> endNode[Finish]",
+			wantRules: []string{RuleReservedID},
+		},
+		{
+			name:      "missing end",
+			code:      "graph TD\n    subgraph VPC\n        subgraph Subnet\n            A[App] --> B[DB]",
+			want:      "graph TD\n    subgraph VPC\n        subgraph Subnet\n            A[App] --> B[DB]\n    end\n    end",
+			wantRules: []string{RuleMissingEnd},
+		},
+		{
+			name:      "duplicate IDs",
+			code:      "graph TD\n    A[Users] --> B[ALB]\n    B --> C[EC2]\n    C --> B[RDS]\n    B[ALB] --> D[Logs]",
+			want:      "graph TD\n    A[Users] --> B[ALB]\n    B --> C[EC2]\n    C --> B_2[RDS]\n    B[ALB] --> D[Logs]",
+			wantRules: []string{RuleDuplicateID},
+		},
+		{
+			name:      "letter after open link",
+			code:      "graph LR\n    dev---ops",
+			want:      "graph LR\n    dev--- ops",
+			wantRules: []string{RuleLinkLetter},
+		},
+		{
+			name:      "valid diagram is unchanged",
+			code:      "graph TD\r\n    A[\"Quoted (ok)\"] --> End[End]\r\n",
+			want:      "graph TD\n    A[\"Quoted (ok)\"] --> End[End]",
+			wantRules: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := CheckDiagram(tt.code, DefaultLintOptions())
+			if err := check.Err(); err != nil {
+				t.Fatalf("Expected a valid diagram, got %v", err)
+			}
+			if check.Code != tt.want {
+				t.Errorf("Expected repaired code\n%s\ngot\n%s", tt.want, check.Code)
+			}
+			if got := repairRules(check); strings.Join(got, ",") != strings.Join(tt.wantRules, ",") {
+				t.Errorf("Expected repairs %v, got %v", tt.wantRules, check.Repairs)
+			}
+			if _, err := ParseFlowchart(check.Code); err != nil {
+				t.Errorf("Expected repaired code to parse, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckDiagramErrors(t *testing.T) {
+	check := CheckDiagram("graph TD\n    A[Web] --> B[App]\n    B -> C[DB]", DefaultLintOptions())
+	if check.Valid() {
+		t.Fatal("Expected an invalid diagram")
+	}
+	if len(check.Diagnostics) != 1 {
+		t.Fatalf("Expected one diagnostic, got %+v", check.Diagnostics)
+	}
+	diagnostic := check.Diagnostics[0]
+	if diagnostic.Line != 3 || diagnostic.Column != 7 || diagnostic.Rule != RuleSyntax {
+		t.Errorf("Expected a syntax error at line 3, column 7, got %+v", diagnostic)
+	}
+	if !strings.HasPrefix(check.Err().Error(), "line 3, column 7: ") {
+		t.Errorf("Expected the error to name its position, got %q", check.Err())
+	}
+}
+
+func TestCheckDiagramLint(t *testing.T) {
+	check := CheckDiagram(`graph TD
+    A[Web] --> B[App]
+    B --> Cache
+    Orphan[Reporting]
+    subgraph Empty [Unused]
+    end`, DefaultLintOptions())
+	if !check.Valid() {
+		t.Fatalf("Expected lint findings to be warnings, got %v", check.Err())
+	}
+
+	rules := make(map[string]Diagnostic)
+	for _, warning := range check.Warnings() {
+		rules[warning.Rule] = warning
+	}
+	if dangling, ok := rules[RuleDanglingEdge]; !ok || dangling.Line != 3 || dangling.Column != 11 {
+		t.Errorf("Expected a dangling edge warning at line 3, column 11, got %+v", dangling)
+	}
+	if isolated, ok := rules[RuleIsolatedNode]; !ok || !strings.Contains(isolated.Message, "Orphan") {
+		t.Errorf("Expected an isolated node warning, got %+v", isolated)
+	}
+	if _, ok := rules[RuleEmptySubgraph]; !ok {
+		t.Error("Expected an empty subgraph warning")
+	}
+
+	var code strings.Builder
+	code.WriteString("graph LR\n")
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&code, "    N%d --> N%d\n", i, i+1)
+	}
+	check = CheckDiagram(code.String(), LintOptions{MaxNodes: 4})
+	if warnings := check.Warnings(); len(warnings) != 1 || warnings[0].Rule != RuleTooManyNodes {
+		t.Errorf("Expected only a too-many-nodes warning for an unlabelled chain, got %+v", warnings)
+	}
+}
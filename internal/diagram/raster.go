@@ -0,0 +1,311 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	// pngScale is the number of pixels per layout unit, so PNGs stay sharp on high DPI screens
+	pngScale = 2.0
+	// maxPNGDimension bounds the width and height of a rendered PNG
+	maxPNGDimension = 4096
+)
+
+// RenderPNG rasterizes a laid out flowchart with the same geometry as RenderSVG. Text is
+// drawn with a built-in bitmap font so that rendering needs no font files.
+func RenderPNG(layout *Layout) ([]byte, error) {
+	scale := pngScale
+	if largest := math.Max(layout.Width, layout.Height) * scale; largest > maxPNGDimension {
+		scale *= maxPNGDimension / largest
+	}
+	width := int(math.Ceil(layout.Width * scale))
+	height := int(math.Ceil(layout.Height * scale))
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("diagram has no area")
+	}
+
+	c := &canvas{
+		img:        image.NewRGBA(image.Rect(0, 0, width, height)),
+		scale:      scale,
+		glyphScale: int(math.Max(1, math.Floor(scale))),
+	}
+	c.fill(hexColor(colorBackground))
+
+	for _, cluster := range layout.Clusters {
+		box := []Point{
+			{cluster.X, cluster.Y}, {cluster.X + cluster.Width, cluster.Y},
+			{cluster.X + cluster.Width, cluster.Y + cluster.Height}, {cluster.X, cluster.Y + cluster.Height},
+		}
+		c.fillPolygon(box, hexColor(colorClusterFill))
+		c.strokePolyline(closePath(box), 1, 0, hexColor(colorClusterEdge))
+	}
+
+	for _, edge := range layout.Edges {
+		points, heads := edgeGeometry(edge)
+		dash := 0.0
+		if edge.Edge.Style == EdgeDotted {
+			dash = dottedDashLength
+		}
+		c.strokePolyline(points, edgeStrokeWidth(edge.Edge.Style), dash, hexColor(colorEdge))
+		for _, head := range heads {
+			c.fillPolygon(head, hexColor(colorEdge))
+		}
+	}
+
+	for _, cluster := range layout.Clusters {
+		c.drawText([]string{cluster.Subgraph.Label}, cluster.X+cluster.Width/2, cluster.Y+clusterTitle/2+2,
+			hexColor(colorText))
+	}
+
+	for _, node := range layout.Nodes {
+		outline, details := shapeGeometry(node)
+		c.fillPolygon(outline, hexColor(colorNodeFill))
+		c.strokePolyline(closePath(outline), strokeWidth, 0, hexColor(colorNodeStroke))
+		for _, detail := range details {
+			c.strokePolyline(detail, strokeWidth, 0, hexColor(colorNodeStroke))
+		}
+		textY := node.Y
+		if node.Node.Shape == ShapeCylinder {
+			textY += cylinderCapHeight / 2
+		}
+		c.drawText(node.Lines, node.X, textY, hexColor(colorText))
+	}
+
+	for _, edge := range layout.Edges {
+		if len(edge.LabelLines) == 0 {
+			continue
+		}
+		left, top := edge.Label.X-edge.LabelWidth/2, edge.Label.Y-edge.LabelHeight/2
+		c.fillPolygon([]Point{
+			{left, top}, {left + edge.LabelWidth, top},
+			{left + edge.LabelWidth, top + edge.LabelHeight}, {left, top + edge.LabelHeight},
+		}, hexColor(colorLabelFill))
+		c.drawText(edge.LabelLines, edge.Label.X, edge.Label.Y, hexColor(colorText))
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, c.img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// canvas draws anti-aliased strokes, filled polygons and bitmap text. Coordinates are layout
+// units and are scaled to pixels.
+type canvas struct {
+	img        *image.RGBA
+	scale      float64
+	glyphScale int
+}
+
+// fill paints the whole canvas
+func (c *canvas) fill(col color.RGBA) {
+	for i := 0; i < len(c.img.Pix); i += 4 {
+		c.img.Pix[i], c.img.Pix[i+1], c.img.Pix[i+2], c.img.Pix[i+3] = col.R, col.G, col.B, 255
+	}
+}
+
+// blend mixes a color into a pixel with the given coverage
+func (c *canvas) blend(x, y int, col color.RGBA, coverage float64) {
+	if coverage <= 0 || !(image.Point{x, y}.In(c.img.Rect)) {
+		return
+	}
+	if coverage > 1 {
+		coverage = 1
+	}
+	offset := c.img.PixOffset(x, y)
+	pix := c.img.Pix[offset : offset+3 : offset+3]
+	pix[0] = uint8(float64(pix[0])*(1-coverage) + float64(col.R)*coverage + 0.5)
+	pix[1] = uint8(float64(pix[1])*(1-coverage) + float64(col.G)*coverage + 0.5)
+	pix[2] = uint8(float64(pix[2])*(1-coverage) + float64(col.B)*coverage + 0.5)
+}
+
+// fillPolygon fills a polygon with the even-odd rule, sampling each pixel row at its center
+func (c *canvas) fillPolygon(points []Point, col color.RGBA) {
+	if len(points) < 3 {
+		return
+	}
+	scaled := c.toPixels(points)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, p := range scaled {
+		minY, maxY = math.Min(minY, p.Y), math.Max(maxY, p.Y)
+	}
+
+	var crossings []float64
+	for y := int(math.Floor(minY)); y <= int(math.Ceil(maxY)); y++ {
+		sampleY := float64(y) + 0.5
+		crossings = crossings[:0]
+		for i := range scaled {
+			a, b := scaled[i], scaled[(i+1)%len(scaled)]
+			if (a.Y <= sampleY) == (b.Y <= sampleY) {
+				continue
+			}
+			crossings = append(crossings, a.X+(sampleY-a.Y)*(b.X-a.X)/(b.Y-a.Y))
+		}
+		sort.Float64s(crossings)
+		for i := 0; i+1 < len(crossings); i += 2 {
+			for x := int(math.Ceil(crossings[i] - 0.5)); float64(x)+0.5 <= crossings[i+1]; x++ {
+				c.blend(x, y, col, 1)
+			}
+		}
+	}
+}
+
+// strokePolyline draws an anti-aliased polyline. A positive dash length draws it dashed.
+// Coverage is accumulated per pixel before blending, so joints are not drawn twice.
+func (c *canvas) strokePolyline(points []Point, width, dash float64, col color.RGBA) {
+	if len(points) < 2 {
+		return
+	}
+	scaled := c.toPixels(points)
+	segments := toSegments(scaled)
+	if dash > 0 {
+		segments = dashSegments(segments, dash*c.scale)
+	}
+
+	half := width * c.scale / 2
+	coverage := make(map[image.Point]float64)
+	for _, segment := range segments {
+		a, b := segment[0], segment[1]
+		x0 := int(math.Floor(math.Min(a.X, b.X) - half - 1))
+		x1 := int(math.Ceil(math.Max(a.X, b.X) + half + 1))
+		y0 := int(math.Floor(math.Min(a.Y, b.Y) - half - 1))
+		y1 := int(math.Ceil(math.Max(a.Y, b.Y) + half + 1))
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				d := segmentDistance(Point{float64(x) + 0.5, float64(y) + 0.5}, a, b)
+				if value := half + 0.5 - d; value > 0 {
+					p := image.Point{x, y}
+					coverage[p] = math.Max(coverage[p], math.Min(value, 1))
+				}
+			}
+		}
+	}
+	for p, value := range coverage {
+		c.blend(p.X, p.Y, col, value)
+	}
+}
+
+// drawText draws lines of text centered on (x, y) with the bitmap font
+func (c *canvas) drawText(lines []string, x, y float64, col color.RGBA) {
+	advance := charWidth * c.scale
+	linePixels := lineHeight * c.scale
+	glyphWidth := float64(glyphColumns * c.glyphScale)
+	glyphHeight := float64(glyphRows * c.glyphScale)
+
+	top := y*c.scale - float64(len(lines))*linePixels/2
+	for i, line := range lines {
+		runes := []rune(line)
+		lineWidth := float64(len(runes))*advance - (advance - glyphWidth)
+		left := x*c.scale - lineWidth/2
+		baseY := top + float64(i)*linePixels + (linePixels-glyphHeight)/2
+		for j, r := range runes {
+			c.drawGlyph(glyphFor(r), int(math.Round(left+float64(j)*advance)), int(math.Round(baseY)), col)
+		}
+	}
+}
+
+// drawGlyph draws one bitmap glyph with its top left corner at (x, y)
+func (c *canvas) drawGlyph(glyph [glyphColumns]byte, x, y int, col color.RGBA) {
+	for column, bits := range glyph {
+		for row := 0; row < glyphRows; row++ {
+			if bits&(1<<row) == 0 {
+				continue
+			}
+			for dy := 0; dy < c.glyphScale; dy++ {
+				for dx := 0; dx < c.glyphScale; dx++ {
+					c.blend(x+column*c.glyphScale+dx, y+row*c.glyphScale+dy, col, 1)
+				}
+			}
+		}
+	}
+}
+
+// toPixels scales layout points to pixel coordinates
+func (c *canvas) toPixels(points []Point) []Point {
+	scaled := make([]Point, len(points))
+	for i, p := range points {
+		scaled[i] = Point{p.X * c.scale, p.Y * c.scale}
+	}
+	return scaled
+}
+
+// toSegments splits a polyline into its line segments
+func toSegments(points []Point) [][2]Point {
+	segments := make([][2]Point, 0, len(points)-1)
+	for i := 1; i < len(points); i++ {
+		segments = append(segments, [2]Point{points[i-1], points[i]})
+	}
+	return segments
+}
+
+// dashSegments cuts segments into dashes of the given length, with equal gaps, continuing the
+// pattern across segment joints
+func dashSegments(segments [][2]Point, dash float64) [][2]Point {
+	var dashes [][2]Point
+	on, remaining := true, dash
+	for _, segment := range segments {
+		a, b := segment[0], segment[1]
+		length := math.Hypot(b.X-a.X, b.Y-a.Y)
+		position := 0.0
+		for position < length {
+			step := math.Min(remaining, length-position)
+			if on {
+				from, to := position/length, (position+step)/length
+				dashes = append(dashes, [2]Point{
+					{a.X + (b.X-a.X)*from, a.Y + (b.Y-a.Y)*from},
+					{a.X + (b.X-a.X)*to, a.Y + (b.Y-a.Y)*to},
+				})
+			}
+			position += step
+			remaining -= step
+			if remaining <= 0 {
+				on, remaining = !on, dash
+			}
+		}
+	}
+	return dashes
+}
+
+// segmentDistance returns the distance from p to the segment ab
+func segmentDistance(p, a, b Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	lengthSquared := dx*dx + dy*dy
+	if lengthSquared == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+	t := math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/lengthSquared))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+// closePath returns the outline with its first point repeated at the end
+func closePath(points []Point) []Point {
+	return append(append([]Point(nil), points...), points[0])
+}
+
+// hexColor parses a #RRGGBB color
+func hexColor(value string) color.RGBA {
+	rgb, _ := strconv.ParseUint(value[1:], 16, 32)
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}
+}
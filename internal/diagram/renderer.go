@@ -12,21 +12,22 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package diagram provides functionality for rendering Mermaid diagrams as images
-// using the mermaid.ink API service. It includes caching, error handling, and
-// security validation for diagram rendering in Teams Adaptive Cards.
+// Package diagram renders Mermaid diagrams as images for Teams Adaptive Cards, the web UI
+// and exports. Flowcharts are parsed, laid out and drawn in process by default, and the
+// images are kept in content-addressed storage served from our own /diagrams endpoint.
+// The public mermaid.ink API remains available as an opt-in backend. Flowcharts can also be
+// exported as editable draw.io, D2 and PlantUML diagrams drawn with AWS and Azure icons.
 package diagram
 
 import (
 	"bytes"
 	"context"
 	"crypto/md5" // #nosec G501 - MD5 used only for cache key generation, not security
-	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -45,12 +46,26 @@ const (
 	MaxDiagramSize = 10 * 1024 // 10KB
 	// MaxCacheSize is the maximum number of cached diagrams
 	MaxCacheSize = 1000
+	// MaxImageSize is the maximum size of a downloaded diagram image
+	MaxImageSize = 5 * 1024 * 1024 // 5MB
+	// DefaultBackend is the diagram backend used when none is configured
+	DefaultBackend = BackendNative
 )
 
+// diagramHeaderPattern matches the flowchart declaration that starts a supported diagram
+var diagramHeaderPattern = regexp.MustCompile(`^(graph|flowchart)\b`)
+
 // RendererConfig holds configuration for the diagram renderer
 type RendererConfig struct {
-	// MermaidInkURL is the mermaid.ink API endpoint
+	// Backend selects the renderer: "native" (default) or "mermaid_ink"
+	Backend string `mapstructure:"backend"`
+	// MermaidInkURL is the mermaid.ink API endpoint, used only by the mermaid_ink backend
 	MermaidInkURL string `mapstructure:"mermaid_ink_url"`
+	// PublicURL is the externally reachable base URL of the service serving /diagrams.
+	// When empty, rendered diagram URLs are relative paths.
+	PublicURL string `mapstructure:"public_url"`
+	// StorageDir stores rendered diagrams on disk. When empty they are kept in memory.
+	StorageDir string `mapstructure:"storage_dir"`
 	// Timeout is the HTTP timeout for rendering requests
 	Timeout time.Duration `mapstructure:"timeout"`
 	// CacheExpiry is the cache expiry time for rendered diagrams
@@ -64,6 +79,7 @@ type RendererConfig struct {
 // DefaultRendererConfig returns default configuration for the diagram renderer
 func DefaultRendererConfig() RendererConfig {
 	return RendererConfig{
+		Backend:        DefaultBackend,
 		MermaidInkURL:  DefaultMermaidInkURL,
 		Timeout:        DefaultTimeout,
 		CacheExpiry:    DefaultCacheExpiry,
@@ -78,48 +94,99 @@ type CacheEntry struct {
 	ExpiresAt time.Time
 }
 
-// Renderer handles diagram rendering using mermaid.ink API
+// Renderer renders diagrams with the configured backend and stores the images
 type Renderer struct {
 	config     RendererConfig
 	httpClient *http.Client
+	backend    DiagramBackend
+	store      AssetStore
 	cache      map[string]CacheEntry
 	cacheMutex sync.RWMutex
 	logger     *zap.Logger
 }
 
-// NewRenderer creates a new diagram renderer with the given configuration
+// NewRenderer creates a new diagram renderer with the given configuration. An unusable
+// storage directory falls back to in-memory storage rather than disabling diagrams.
 func NewRenderer(config RendererConfig, logger *zap.Logger) *Renderer {
+	httpClient := &http.Client{
+		Timeout: config.Timeout,
+	}
+
+	var backend DiagramBackend = NewNativeBackend()
+	if config.Backend == BackendMermaidInk {
+		backend = NewMermaidInkBackend(config.MermaidInkURL, httpClient)
+	}
+
+	var store AssetStore = NewMemoryAssetStore(MaxStoredAssets)
+	if config.StorageDir != "" {
+		fileStore, err := NewFileAssetStore(config.StorageDir)
+		if err != nil {
+			logger.Warn("Falling back to in-memory diagram storage", zap.Error(err))
+		} else {
+			store = fileStore
+		}
+	}
+
 	return &Renderer{
-		config: config,
-		httpClient: &http.Client{
-			Timeout: config.Timeout,
-		},
-		cache:  make(map[string]CacheEntry),
-		logger: logger,
+		config:     config,
+		httpClient: httpClient,
+		backend:    backend,
+		store:      store,
+		cache:      make(map[string]CacheEntry),
+		logger:     logger,
 	}
 }
 
-// RenderDiagram renders a Mermaid diagram to an image URL
+// BackendName returns the name of the configured diagram backend
+func (r *Renderer) BackendName() string {
+	return r.backend.Name()
+}
+
+// Store returns the asset store holding rendered diagrams, for serving them over HTTP
+func (r *Renderer) Store() AssetStore {
+	return r.store
+}
+
+// AssetURL returns the URL a stored diagram is served from
+func (r *Renderer) AssetURL(hash string) string {
+	return strings.TrimSuffix(r.config.PublicURL, "/") + AssetPath + "/" + hash
+}
+
+// RenderDiagram renders a Mermaid diagram to a PNG image URL
 func (r *Renderer) RenderDiagram(ctx context.Context, mermaidCode string) (string, error) {
+	return r.RenderDiagramFormat(ctx, mermaidCode, ImagePNG)
+}
+
+// RenderDiagramFormat renders a Mermaid diagram in the given format, stores the image and
+// returns its URL
+func (r *Renderer) RenderDiagramFormat(ctx context.Context, mermaidCode string, format ImageFormat) (string, error) {
 	// Validate input
-	if err := r.validateDiagramCode(mermaidCode); err != nil {
+	code, err := r.prepareDiagramCode(mermaidCode)
+	if err != nil {
 		return "", fmt.Errorf("invalid diagram code: %w", err)
 	}
 
-	// Check cache first
+	// Check cache first, making sure the image is still stored
+	cacheSubject := string(format) + "\n" + mermaidCode
 	if r.config.EnableCaching {
-		if url, found := r.getCachedDiagram(mermaidCode); found {
+		if url, found := r.getCachedDiagram(cacheSubject); found && r.isStored(url) {
 			r.logger.Debug("Found cached diagram", zap.String("url", url))
 			return url, nil
 		}
 	}
 
 	// Render diagram
-	url, err := r.renderDiagramViaAPI(ctx, mermaidCode)
+	image, err := r.backend.Render(ctx, code, format)
 	if err != nil {
 		return "", fmt.Errorf("failed to render diagram: %w", err)
 	}
 
+	hash, err := r.store.Put(image, format.ContentType())
+	if err != nil {
+		return "", fmt.Errorf("failed to store diagram: %w", err)
+	}
+	url := r.AssetURL(hash)
+
 	// Validate rendered URL
 	if err := r.validateRenderedURL(url); err != nil {
 		return "", fmt.Errorf("invalid rendered URL: %w", err)
@@ -127,13 +194,39 @@ func (r *Renderer) RenderDiagram(ctx context.Context, mermaidCode string) (strin
 
 	// Cache the result
 	if r.config.EnableCaching {
-		r.cacheDiagram(mermaidCode, url)
+		r.cacheDiagram(cacheSubject, url)
 	}
 
-	r.logger.Info("Successfully rendered diagram", zap.String("url", url))
+	r.logger.Info("Successfully rendered diagram",
+		zap.String("url", url),
+		zap.String("backend", r.backend.Name()),
+		zap.Int("bytes", len(image)))
 	return url, nil
 }
 
+// isStored reports whether the asset behind a diagram URL is still in the store
+func (r *Renderer) isStored(url string) bool {
+	_, err := r.store.Get(url[strings.LastIndex(url, "/")+1:])
+	return err == nil
+}
+
+// prepareDiagramCode validates Mermaid diagram code and returns it with the linter's
+// automatic repairs applied
+func (r *Renderer) prepareDiagramCode(code string) (string, error) {
+	if err := r.validateDiagramCode(code); err != nil {
+		return "", err
+	}
+
+	check := CheckDiagram(code, DefaultLintOptions())
+	if err := check.Err(); err != nil {
+		return "", err
+	}
+	if len(check.Repairs) > 0 {
+		r.logger.Info("Repaired diagram code", zap.Any("repairs", check.Repairs))
+	}
+	return check.Code, nil
+}
+
 // validateDiagramCode validates the Mermaid diagram code
 func (r *Renderer) validateDiagramCode(code string) error {
 	if strings.TrimSpace(code) == "" {
@@ -145,7 +238,7 @@ func (r *Renderer) validateDiagramCode(code string) error {
 	}
 
 	// Basic Mermaid syntax validation
-	if !strings.Contains(code, "graph TD") && !strings.Contains(code, "graph LR") {
+	if !diagramHeaderPattern.MatchString(firstStatement(code)) {
 		return fmt.Errorf("diagram code must contain valid Mermaid graph syntax")
 	}
 
@@ -181,45 +274,69 @@ func containsMaliciousContent(code string) bool {
 	return false
 }
 
-// renderDiagramViaAPI renders the diagram using the mermaid.ink API
-func (r *Renderer) renderDiagramViaAPI(ctx context.Context, mermaidCode string) (string, error) {
-	// Encode diagram code to base64
-	encodedCode := base64.StdEncoding.EncodeToString([]byte(mermaidCode))
+// firstStatement returns the first line of diagram code that is not blank or a comment
+func firstStatement(code string) string {
+	for _, line := range strings.Split(code, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "%%") {
+			return line
+		}
+	}
+	return ""
+}
 
-	// Construct API URL
-	apiURL := fmt.Sprintf("%s/%s", r.config.MermaidInkURL, encodedCode)
+// RenderDiagramPNG renders a Mermaid diagram and returns the PNG image bytes, for embedding
+// the diagram in documents that cannot reference a URL
+func (r *Renderer) RenderDiagramPNG(ctx context.Context, mermaidCode string) ([]byte, error) {
+	code, err := r.prepareDiagramCode(mermaidCode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid diagram code: %w", err)
+	}
 
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	image, err := r.backend.Render(ctx, code, ImagePNG)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to render diagram: %w", err)
 	}
 
-	// Set headers
-	req.Header.Set("User-Agent", "AI-SA-Assistant/1.0")
-	req.Header.Set("Accept", "image/svg+xml,image/png,image/*")
+	r.logger.Debug("Rendered diagram image", zap.Int("bytes", len(image)))
+	return image, nil
+}
 
-	// Make request
-	resp, err := r.httpClient.Do(req)
+// ExportDiagram converts a Mermaid diagram into an editable diagram with cloud icons, stores
+// it and returns its download URL. Exports are converted in process whatever the backend.
+func (r *Renderer) ExportDiagram(ctx context.Context, mermaidCode string, format ExportFormat) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	code, err := r.prepareDiagramCode(mermaidCode)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %w", err)
+		return "", fmt.Errorf("invalid diagram code: %w", err)
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	data, err := ExportArchitecture(code, format)
+	if err != nil {
+		return "", fmt.Errorf("failed to export diagram: %w", err)
 	}
-
-	// Verify response content type
-	contentType := resp.Header.Get("Content-Type")
-	if !strings.HasPrefix(contentType, "image/") {
-		return "", fmt.Errorf("unexpected content type: %s", contentType)
+	hash, err := r.store.Put(data, format.ContentType())
+	if err != nil {
+		return "", fmt.Errorf("failed to store diagram: %w", err)
 	}
+	return r.AssetURL(hash), nil
+}
 
-	// Return the URL (mermaid.ink returns the image directly, so we return the API URL)
-	return apiURL, nil
+// ExportDiagramFormats exports a Mermaid diagram in every export format and returns the
+// download URLs by format name. Formats that fail are logged and left out.
+func (r *Renderer) ExportDiagramFormats(ctx context.Context, mermaidCode string) map[string]string {
+	downloads := make(map[string]string, len(ExportFormats))
+	for _, format := range ExportFormats {
+		url, err := r.ExportDiagram(ctx, mermaidCode, format)
+		if err != nil {
+			r.logger.Warn("Failed to export diagram", zap.String("format", string(format)), zap.Error(err))
+			continue
+		}
+		downloads[string(format)] = url
+	}
+	return downloads
 }
 
 // validateRenderedURL validates the rendered image URL
@@ -234,27 +351,45 @@ func (r *Renderer) validateRenderedURL(imageURL string) error {
 		return fmt.Errorf("invalid URL format: %w", err)
 	}
 
+	// Only our own diagram endpoint is allowed: a relative path when no public URL is
+	// configured, otherwise the public URL's scheme and host
+	if !strings.HasPrefix(parsedURL.Path, strings.TrimSuffix(r.publicPath(), "/")+AssetPath+"/") {
+		return fmt.Errorf("invalid diagram path: %s", parsedURL.Path)
+	}
+
+	if r.config.PublicURL == "" {
+		if parsedURL.Scheme != "" || parsedURL.Host != "" {
+			return fmt.Errorf("unexpected absolute diagram URL: %s", imageURL)
+		}
+		return nil
+	}
+
 	// Check scheme
 	if parsedURL.Scheme != "https" && parsedURL.Scheme != "http" {
 		return fmt.Errorf("invalid URL scheme: %s", parsedURL.Scheme)
 	}
 
-	// Check host (only allow mermaid.ink domains)
-	allowedHosts := []string{"mermaid.ink", "www.mermaid.ink"}
-	hostAllowed := false
-	for _, allowedHost := range allowedHosts {
-		if parsedURL.Host == allowedHost {
-			hostAllowed = true
-			break
-		}
-	}
-	if !hostAllowed {
+	// Check host
+	publicURL, err := url.Parse(r.config.PublicURL)
+	if err != nil || parsedURL.Host != publicURL.Host || parsedURL.Scheme != publicURL.Scheme {
 		return fmt.Errorf("invalid host: %s", parsedURL.Host)
 	}
 
 	return nil
 }
 
+// publicPath returns the path component of the public URL
+func (r *Renderer) publicPath() string {
+	if r.config.PublicURL == "" {
+		return ""
+	}
+	publicURL, err := url.Parse(r.config.PublicURL)
+	if err != nil {
+		return ""
+	}
+	return publicURL.Path
+}
+
 // getCachedDiagram retrieves a cached diagram URL if available and not expired
 func (r *Renderer) getCachedDiagram(mermaidCode string) (string, bool) {
 	r.cacheMutex.RLock()
@@ -349,14 +484,14 @@ func (r *Renderer) GetCacheStats() map[string]interface{} {
 	}
 }
 
-// TestConnection tests the connection to the mermaid.ink API
+// TestConnection checks that the configured backend can render a diagram
 func (r *Renderer) TestConnection(ctx context.Context) error {
 	// Test with a simple diagram
 	testDiagram := "graph TD\n    A[Test] --> B[Connection]"
 
-	_, err := r.renderDiagramViaAPI(ctx, testDiagram)
+	_, err := r.backend.Render(ctx, testDiagram, ImagePNG)
 	if err != nil {
-		return fmt.Errorf("mermaid.ink API test failed: %w", err)
+		return fmt.Errorf("%s diagram backend test failed: %w", r.backend.Name(), err)
 	}
 
 	return nil
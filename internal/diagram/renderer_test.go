@@ -16,6 +16,7 @@ package diagram
 
 import (
 	"context"
+	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -157,29 +158,31 @@ func TestContainsMaliciousContent(t *testing.T) {
 }
 
 func TestValidateRenderedURL(t *testing.T) {
-	config := DefaultRendererConfig()
+	hash := AssetHash([]byte("diagram"))
 	logger := zap.NewNop()
-	renderer := NewRenderer(config, logger)
 
 	tests := []struct {
-		name    string
-		url     string
-		wantErr bool
+		name      string
+		publicURL string
+		url       string
+		wantErr   bool
 	}{
 		{
-			name:    "Valid mermaid.ink URL",
-			url:     "https://mermaid.ink/img/base64code",
+			name:    "Relative diagram URL",
+			url:     "/diagrams/" + hash,
 			wantErr: false,
 		},
 		{
-			name:    "Valid www.mermaid.ink URL",
-			url:     "https://www.mermaid.ink/img/base64code",
-			wantErr: false,
+			name:      "Public diagram URL",
+			publicURL: "https://bot.example.com",
+			url:       "https://bot.example.com/diagrams/" + hash,
+			wantErr:   false,
 		},
 		{
-			name:    "HTTP URL (allowed)",
-			url:     "http://mermaid.ink/img/base64code",
-			wantErr: false,
+			name:      "Public diagram URL with a path prefix",
+			publicURL: "https://example.com/assistant/",
+			url:       "https://example.com/assistant/diagrams/" + hash,
+			wantErr:   false,
 		},
 		{
 			name:    "Empty URL",
@@ -187,14 +190,27 @@ func TestValidateRenderedURL(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name:    "Invalid scheme",
-			url:     "ftp://mermaid.ink/img/base64code",
+			name:    "Absolute URL without a public URL",
+			url:     "https://mermaid.ink/img/base64code",
 			wantErr: true,
 		},
 		{
-			name:    "Invalid host",
-			url:     "https://malicious.com/img/base64code",
-			wantErr: true,
+			name:      "Invalid scheme",
+			publicURL: "https://bot.example.com",
+			url:       "ftp://bot.example.com/diagrams/" + hash,
+			wantErr:   true,
+		},
+		{
+			name:      "Invalid host",
+			publicURL: "https://bot.example.com",
+			url:       "https://malicious.com/diagrams/" + hash,
+			wantErr:   true,
+		},
+		{
+			name:      "Third party renderer URL",
+			publicURL: "https://bot.example.com",
+			url:       "https://mermaid.ink/img/base64code",
+			wantErr:   true,
 		},
 		{
 			name:    "Invalid URL format",
@@ -205,6 +221,10 @@ func TestValidateRenderedURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultRendererConfig()
+			config.PublicURL = tt.publicURL
+			renderer := NewRenderer(config, logger)
+
 			err := renderer.validateRenderedURL(tt.url)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("validateRenderedURL() error = %v, wantErr %v", err, tt.wantErr)
@@ -275,7 +295,7 @@ func TestGenerateCacheKey(t *testing.T) {
 	}
 }
 
-func TestRenderDiagramViaAPI(t *testing.T) {
+func TestMermaidInkBackend(t *testing.T) {
 	// Create a mock server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check headers
@@ -283,39 +303,41 @@ func TestRenderDiagramViaAPI(t *testing.T) {
 			t.Error("Expected proper User-Agent header")
 		}
 
-		// Check URL path
-		if !strings.HasPrefix(r.URL.Path, "/img/") {
-			t.Error("Expected URL path to start with /img/")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/img/") && r.URL.Query().Get("type") == "png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("png"))
+		case strings.HasPrefix(r.URL.Path, "/svg/"):
+			w.Header().Set("Content-Type", "image/svg+xml")
+			_, _ = w.Write([]byte(`<svg>test</svg>`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
 		}
-
-		// Return a mock SVG
-		w.Header().Set("Content-Type", "image/svg+xml")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(`<svg>test</svg>`))
 	}))
 	defer server.Close()
 
-	// Configure renderer to use mock server
-	config := DefaultRendererConfig()
-	config.MermaidInkURL = server.URL + "/img"
-	logger := zap.NewNop()
-	renderer := NewRenderer(config, logger)
-
-	// Test successful rendering
-	diagram := testDiagram
+	backend := NewMermaidInkBackend(server.URL+"/img", server.Client())
 	ctx := context.Background()
 
-	url, err := renderer.renderDiagramViaAPI(ctx, diagram)
+	image, err := backend.Render(ctx, testDiagram, ImagePNG)
 	if err != nil {
-		t.Errorf("Expected no error, got %v", err)
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(image) != "png" {
+		t.Errorf("Expected PNG bytes, got %q", image)
 	}
 
-	if !strings.HasPrefix(url, server.URL+"/img/") {
-		t.Errorf("Expected URL to start with %s/img/, got %s", server.URL, url)
+	image, err = backend.Render(ctx, testDiagram, ImageSVG)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(image) != `<svg>test</svg>` {
+		t.Errorf("Expected SVG bytes, got %q", image)
 	}
 }
 
-func TestRenderDiagramViaAPI_ErrorHandling(t *testing.T) {
+func TestMermaidInkBackend_ErrorHandling(t *testing.T) {
 	// Create a mock server that returns errors
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -323,19 +345,11 @@ func TestRenderDiagramViaAPI_ErrorHandling(t *testing.T) {
 	}))
 	defer server.Close()
 
-	// Configure renderer to use mock server
-	config := DefaultRendererConfig()
-	config.MermaidInkURL = server.URL + "/img"
-	logger := zap.NewNop()
-	renderer := NewRenderer(config, logger)
+	backend := NewMermaidInkBackend(server.URL+"/img", server.Client())
 
-	// Test error handling
-	diagram := testDiagram
-	ctx := context.Background()
-
-	_, err := renderer.renderDiagramViaAPI(ctx, diagram)
+	_, err := backend.Render(context.Background(), testDiagram, ImagePNG)
 	if err == nil {
-		t.Error("Expected error for server error response")
+		t.Fatal("Expected error for server error response")
 	}
 
 	if !strings.Contains(err.Error(), "500") {
@@ -343,6 +357,70 @@ func TestRenderDiagramViaAPI_ErrorHandling(t *testing.T) {
 	}
 }
 
+func TestRenderDiagramPNG(t *testing.T) {
+	pngData := []byte("\x89PNG\r\n\x1a\nimage")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") != "png" {
+			w.Header().Set("Content-Type", "image/jpeg")
+			_, _ = w.Write([]byte("jpeg"))
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(pngData)
+	}))
+	defer server.Close()
+
+	config := DefaultRendererConfig()
+	config.Backend = BackendMermaidInk
+	config.MermaidInkURL = server.URL + "/img"
+	renderer := NewRenderer(config, zap.NewNop())
+
+	image, err := renderer.RenderDiagramPNG(context.Background(), testDiagram)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(image) != string(pngData) {
+		t.Errorf("Expected PNG bytes, got %q", image)
+	}
+
+	if _, err := renderer.RenderDiagramPNG(context.Background(), ""); err == nil {
+		t.Error("Expected error for empty diagram code")
+	}
+}
+
+func TestRenderDiagramRepairsCode(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.Path
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("\x89PNG\r\n\x1a\nimage"))
+	}))
+	defer server.Close()
+
+	config := DefaultRendererConfig()
+	config.Backend = BackendMermaidInk
+	config.MermaidInkURL = server.URL + "/img"
+	renderer := NewRenderer(config, zap.NewNop())
+
+	code := "graph TD\n    subgraph AWS\n        A[Amazon S3 (Standard)] --> end"
+	if _, err := renderer.RenderDiagramPNG(context.Background(), code); err != nil {
+		t.Fatalf("Expected the diagram to be repaired, got %v", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(received, "/img/"))
+	if err != nil {
+		t.Fatalf("Failed to decode the rendered diagram: %v", err)
+	}
+	want := "graph TD\n    subgraph AWS\n        A[\"Amazon S3 (Standard)\"] --> endNode[end]\n    end"
+	if string(decoded) != want {
+		t.Errorf("Expected the repaired diagram to be rendered, got %q", decoded)
+	}
+
+	_, err = renderer.RenderDiagramPNG(context.Background(), "graph TD\n    A --> B\n    B => C")
+	if err == nil || !strings.Contains(err.Error(), "line 3, column 7") {
+		t.Errorf("Expected a positioned syntax error, got %v", err)
+	}
+}
+
 func TestRenderDiagramWithFallback(t *testing.T) {
 	// Create a mock server that fails
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
@@ -353,6 +431,7 @@ func TestRenderDiagramWithFallback(t *testing.T) {
 
 	// Configure renderer to use mock server
 	config := DefaultRendererConfig()
+	config.Backend = BackendMermaidInk
 	config.MermaidInkURL = server.URL + "/img"
 	logger := zap.NewNop()
 	renderer := NewRenderer(config, logger)
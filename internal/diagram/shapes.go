@@ -0,0 +1,160 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import "math"
+
+// Theme colors shared by the SVG and PNG output, close to Mermaid's default theme
+const (
+	colorBackground   = "#FFFFFF"
+	colorNodeFill     = "#ECECFF"
+	colorNodeStroke   = "#9370DB"
+	colorClusterFill  = "#FFFFDE"
+	colorClusterEdge  = "#AAAA33"
+	colorEdge         = "#333333"
+	colorText         = "#333333"
+	colorLabelFill    = "#E8E8E8"
+	arrowLength       = 9.0
+	arrowWidth        = 7.0
+	curveSegments     = 12
+	strokeWidth       = 1.5
+	thickStrokeWidth  = 3.0
+	dottedDashLength  = 3.0
+	cylinderCapHeight = 8.0
+)
+
+// shapeGeometry returns the closed outline of a node and any extra open strokes drawn on top
+// of it, such as the inner bars of a subroutine or the front rim of a cylinder
+func shapeGeometry(node LayoutNode) ([]Point, [][]Point) {
+	x, y := node.X, node.Y
+	hw, hh := node.Width/2, node.Height/2
+	left, right, top, bottom := x-hw, x+hw, y-hh, y+hh
+
+	switch node.Node.Shape {
+	case ShapeRound:
+		return roundedRect(left, top, right, bottom, 6), nil
+	case ShapeStadium:
+		return roundedRect(left, top, right, bottom, hh), nil
+	case ShapeSubroutine:
+		return []Point{{left, top}, {right, top}, {right, bottom}, {left, bottom}},
+			[][]Point{{{left + 8, top}, {left + 8, bottom}}, {{right - 8, top}, {right - 8, bottom}}}
+	case ShapeCylinder:
+		capRy := cylinderCapHeight / 2
+		outline := arc(x, top+capRy, hw, capRy, math.Pi, 2*math.Pi)
+		outline = append(outline, arc(x, bottom-capRy, hw, capRy, 0, math.Pi)...)
+		rim := arc(x, top+capRy, hw, capRy, 0, math.Pi)
+		return outline, [][]Point{rim}
+	case ShapeCircle:
+		return arc(x, y, hw, hh, 0, 2*math.Pi), nil
+	case ShapeDiamond:
+		return []Point{{x, top}, {right, y}, {x, bottom}, {left, y}}, nil
+	case ShapeHexagon:
+		inset := hh
+		return []Point{{left, y}, {left + inset, top}, {right - inset, top}, {right, y},
+			{right - inset, bottom}, {left + inset, bottom}}, nil
+	case ShapeAsymmetric:
+		return []Point{{left, top}, {right, top}, {right, bottom}, {left, bottom}, {left + hh, y}}, nil
+	case ShapeParallelogram:
+		inset := hh
+		return []Point{{left + inset, top}, {right, top}, {right - inset, bottom}, {left, bottom}}, nil
+	case ShapeTrapezoid:
+		inset := hh
+		return []Point{{left + inset, top}, {right - inset, top}, {right, bottom}, {left, bottom}}, nil
+	default:
+		return []Point{{left, top}, {right, top}, {right, bottom}, {left, bottom}}, nil
+	}
+}
+
+// roundedRect returns the outline of a rectangle with rounded corners
+func roundedRect(left, top, right, bottom, radius float64) []Point {
+	radius = math.Min(radius, math.Min(right-left, bottom-top)/2)
+	var points []Point
+	points = append(points, arc(right-radius, top+radius, radius, radius, 1.5*math.Pi, 2*math.Pi)...)
+	points = append(points, arc(right-radius, bottom-radius, radius, radius, 0, 0.5*math.Pi)...)
+	points = append(points, arc(left+radius, bottom-radius, radius, radius, 0.5*math.Pi, math.Pi)...)
+	points = append(points, arc(left+radius, top+radius, radius, radius, math.Pi, 1.5*math.Pi)...)
+	return points
+}
+
+// arc approximates an elliptical arc with line segments. Angles grow clockwise on screen.
+func arc(cx, cy, rx, ry, start, end float64) []Point {
+	segments := curveSegments
+	if end-start > math.Pi {
+		segments *= 2
+	}
+	points := make([]Point, 0, segments+1)
+	for i := 0; i <= segments; i++ {
+		angle := start + (end-start)*float64(i)/float64(segments)
+		points = append(points, Point{cx + rx*math.Cos(angle), cy + ry*math.Sin(angle)})
+	}
+	return points
+}
+
+// arrowHead returns the triangle at the end of a polyline, and the polyline shortened so that
+// its stroke stops at the base of the arrow
+func arrowHead(points []Point) ([]Point, []Point) {
+	n := len(points)
+	tip, from := points[n-1], points[n-2]
+	dx, dy := tip.X-from.X, tip.Y-from.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return nil, points
+	}
+	ux, uy := dx/length, dy/length
+	base := Point{tip.X - ux*arrowLength, tip.Y - uy*arrowLength}
+	triangle := []Point{
+		tip,
+		{base.X - uy*arrowWidth/2, base.Y + ux*arrowWidth/2},
+		{base.X + uy*arrowWidth/2, base.Y - ux*arrowWidth/2},
+	}
+
+	shortened := append([]Point(nil), points...)
+	if length > arrowLength {
+		shortened[n-1] = base
+	}
+	return triangle, shortened
+}
+
+// edgeStrokeWidth returns the stroke width of an edge style
+func edgeStrokeWidth(style EdgeStyle) float64 {
+	if style == EdgeThick {
+		return thickStrokeWidth
+	}
+	return strokeWidth
+}
+
+// edgeGeometry returns the stroked polyline of an edge and its arrowheads
+func edgeGeometry(edge LayoutEdge) ([]Point, [][]Point) {
+	points := edge.Points
+	var heads [][]Point
+	if edge.Edge.Arrow && len(points) >= 2 {
+		var head []Point
+		head, points = arrowHead(points)
+		if head != nil {
+			heads = append(heads, head)
+		}
+	}
+	if edge.Edge.ArrowBack && len(points) >= 2 {
+		reversed := append([]Point(nil), points...)
+		reversePoints(reversed)
+		head, shortened := arrowHead(reversed)
+		if head != nil {
+			heads = append(heads, head)
+			reversePoints(shortened)
+			points = shortened
+		}
+	}
+	return points, heads
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// MaxStoredAssets is the number of rendered diagrams kept by the in-memory asset store
+const MaxStoredAssets = 500
+
+// ErrAssetNotFound is returned for a hash that is not in the asset store
+var ErrAssetNotFound = errors.New("diagram asset not found")
+
+var assetHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// assetExtensions maps stored content types to file extensions
+var assetExtensions = map[string]string{
+	ImagePNG.ContentType(): ".png",
+	ImageSVG.ContentType(): ".svg",
+
+	ExportDrawIO.ContentType():   ExportDrawIO.Extension(),
+	ExportD2.ContentType():       ExportD2.Extension(),
+	ExportPlantUML.ContentType(): ExportPlantUML.Extension(),
+}
+
+// Asset is a rendered diagram image
+type Asset struct {
+	Hash        string
+	ContentType string
+	Data        []byte
+}
+
+// AssetStore is content-addressed storage for rendered diagrams. Assets are keyed by the
+// SHA-256 of their bytes, so a hash always identifies the same image.
+type AssetStore interface {
+	// Put stores an asset and returns its hash
+	Put(data []byte, contentType string) (string, error)
+	// Get returns the asset with the given hash, or ErrAssetNotFound
+	Get(hash string) (*Asset, error)
+}
+
+// AssetHash returns the content address of asset data
+func AssetHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAssetHash reports whether value is a well formed asset hash
+func IsAssetHash(value string) bool {
+	return assetHashPattern.MatchString(value)
+}
+
+// MemoryAssetStore keeps assets in memory, evicting the oldest beyond its capacity
+type MemoryAssetStore struct {
+	mu         sync.RWMutex
+	assets     map[string]*Asset
+	order      []string
+	maxEntries int
+}
+
+// NewMemoryAssetStore creates an in-memory asset store holding up to maxEntries assets
+func NewMemoryAssetStore(maxEntries int) *MemoryAssetStore {
+	if maxEntries <= 0 {
+		maxEntries = MaxStoredAssets
+	}
+	return &MemoryAssetStore{
+		assets:     make(map[string]*Asset),
+		maxEntries: maxEntries,
+	}
+}
+
+// Put implements AssetStore
+func (s *MemoryAssetStore) Put(data []byte, contentType string) (string, error) {
+	hash := AssetHash(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.assets[hash]; exists {
+		return hash, nil
+	}
+	for len(s.order) >= s.maxEntries {
+		delete(s.assets, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.assets[hash] = &Asset{Hash: hash, ContentType: contentType, Data: data}
+	s.order = append(s.order, hash)
+	return hash, nil
+}
+
+// Get implements AssetStore
+func (s *MemoryAssetStore) Get(hash string) (*Asset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	asset, ok := s.assets[hash]
+	if !ok {
+		return nil, ErrAssetNotFound
+	}
+	return asset, nil
+}
+
+// FileAssetStore keeps assets as files named by their hash, so they survive restarts and can
+// be shared by services mounting the same directory
+type FileAssetStore struct {
+	dir string
+}
+
+// NewFileAssetStore creates a file asset store in dir, creating the directory if needed
+func NewFileAssetStore(dir string) (*FileAssetStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create diagram storage directory: %w", err)
+	}
+	return &FileAssetStore{dir: dir}, nil
+}
+
+// Put implements AssetStore. Files are written atomically through a temporary file.
+func (s *FileAssetStore) Put(data []byte, contentType string) (string, error) {
+	extension, ok := assetExtensions[contentType]
+	if !ok {
+		return "", fmt.Errorf("unsupported diagram content type: %s", contentType)
+	}
+	hash := AssetHash(data)
+	path := filepath.Join(s.dir, hash+extension)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	tmp, err := os.CreateTemp(s.dir, hash+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to store diagram: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to store diagram: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to store diagram: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to store diagram: %w", err)
+	}
+	return hash, nil
+}
+
+// Get implements AssetStore
+func (s *FileAssetStore) Get(hash string) (*Asset, error) {
+	if !IsAssetHash(hash) {
+		return nil, ErrAssetNotFound
+	}
+	for contentType, extension := range assetExtensions {
+		data, err := os.ReadFile(filepath.Join(s.dir, hash+extension)) // #nosec G304 - hash is validated hex
+		if err == nil {
+			return &Asset{Hash: hash, ContentType: contentType, Data: data}, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read diagram: %w", err)
+		}
+	}
+	return nil, ErrAssetNotFound
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestAssetStores(t *testing.T) {
+	fileStore, err := NewFileAssetStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileAssetStore() error = %v", err)
+	}
+
+	for name, store := range map[string]AssetStore{
+		"memory": NewMemoryAssetStore(10),
+		"file":   fileStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			data := []byte("<svg/>")
+			hash, err := store.Put(data, ImageSVG.ContentType())
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			if hash != AssetHash(data) || !IsAssetHash(hash) {
+				t.Errorf("Expected the SHA-256 content address, got %s", hash)
+			}
+
+			again, err := store.Put(data, ImageSVG.ContentType())
+			if err != nil || again != hash {
+				t.Errorf("Expected identical content to share a hash, got %s, %v", again, err)
+			}
+
+			asset, err := store.Get(hash)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if string(asset.Data) != string(data) || asset.ContentType != ImageSVG.ContentType() {
+				t.Errorf("Unexpected asset %+v", asset)
+			}
+
+			if _, err := store.Get(AssetHash([]byte("missing"))); !errors.Is(err, ErrAssetNotFound) {
+				t.Errorf("Expected ErrAssetNotFound, got %v", err)
+			}
+		})
+	}
+
+	if _, err := fileStore.Get("../../etc/passwd"); !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("Expected a malformed hash to be rejected, got %v", err)
+	}
+}
+
+func TestMemoryAssetStoreEviction(t *testing.T) {
+	store := NewMemoryAssetStore(2)
+	first, _ := store.Put([]byte("1"), ImagePNG.ContentType())
+	_, _ = store.Put([]byte("2"), ImagePNG.ContentType())
+	_, _ = store.Put([]byte("3"), ImagePNG.ContentType())
+
+	if _, err := store.Get(first); !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("Expected the oldest asset to be evicted, got %v", err)
+	}
+}
+
+func TestAssetHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewMemoryAssetStore(10)
+	router := gin.New()
+	NewAssetHandler(store, zap.NewNop()).RegisterRoutes(router)
+
+	svgHash, _ := store.Put([]byte("<svg/>"), ImageSVG.ContentType())
+	pngHash, _ := store.Put([]byte("png"), ImagePNG.ContentType())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/diagrams/"+svgHash, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if w.Header().Get("Content-Type") != "image/svg+xml" || w.Body.String() != "<svg/>" {
+		t.Errorf("Unexpected response %q %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+	if !strings.Contains(w.Header().Get("Content-Security-Policy"), "default-src 'none'") {
+		t.Error("Expected SVGs to be served with a restrictive content security policy")
+	}
+	if !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Error("Expected content-addressed assets to be cached as immutable")
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/diagrams/"+pngHash, nil)
+	request.Header.Set("If-None-Match", `"`+pngHash+`"`)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching ETag, got %d", w.Code)
+	}
+
+	for _, path := range []string{"/diagrams/" + AssetHash([]byte("missing")), "/diagrams/not-a-hash"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestRenderDiagramNative(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config := DefaultRendererConfig()
+	config.PublicURL = "https://bot.example.com/"
+	config.MermaidInkURL = "http://127.0.0.1:1/unreachable"
+	renderer := NewRenderer(config, zap.NewNop())
+
+	if renderer.BackendName() != BackendNative {
+		t.Errorf("Expected the native backend by default, got %s", renderer.BackendName())
+	}
+	if err := renderer.TestConnection(context.Background()); err != nil {
+		t.Errorf("Expected the native backend to work offline, got %v", err)
+	}
+
+	url, err := renderer.RenderDiagram(context.Background(), testDiagram)
+	if err != nil {
+		t.Fatalf("RenderDiagram() error = %v", err)
+	}
+	if !strings.HasPrefix(url, "https://bot.example.com/diagrams/") {
+		t.Fatalf("Expected a self-hosted URL, got %s", url)
+	}
+
+	cached, err := renderer.RenderDiagram(context.Background(), testDiagram)
+	if err != nil || cached != url {
+		t.Errorf("Expected the cached URL, got %s, %v", cached, err)
+	}
+
+	svgURL, err := renderer.RenderDiagramFormat(context.Background(), testDiagram, ImageSVG)
+	if err != nil || svgURL == url {
+		t.Errorf("Expected a distinct SVG asset, got %s, %v", svgURL, err)
+	}
+
+	router := gin.New()
+	NewAssetHandler(renderer.Store(), zap.NewNop()).RegisterRoutes(router)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(url, "https://bot.example.com"), nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected the PNG to be served, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	image, err := renderer.RenderDiagramPNG(context.Background(), testDiagram)
+	if err != nil || !strings.HasPrefix(string(image), "\x89PNG") {
+		t.Errorf("Expected PNG bytes, got %v", err)
+	}
+}
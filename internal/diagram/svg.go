@@ -0,0 +1,116 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagram
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// svgFontSize is the label font size, chosen so that its average glyph width matches charWidth
+const svgFontSize = 12.0
+
+// RenderSVG draws a laid out flowchart as a standalone SVG document. All label text is XML
+// escaped and the document contains no scripts or external references.
+func RenderSVG(layout *Layout) []byte {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s">`,
+		num(layout.Width), num(layout.Height), num(layout.Width), num(layout.Height))
+	out.WriteString("\n")
+	fmt.Fprintf(&out, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", colorBackground)
+	fmt.Fprintf(&out, `<g font-family="Helvetica, Arial, sans-serif" font-size="%s" fill="%s">`+"\n",
+		num(svgFontSize), colorText)
+
+	for _, cluster := range layout.Clusters {
+		fmt.Fprintf(&out, `<rect x="%s" y="%s" width="%s" height="%s" rx="4" fill="%s" stroke="%s"/>`+"\n",
+			num(cluster.X), num(cluster.Y), num(cluster.Width), num(cluster.Height), colorClusterFill, colorClusterEdge)
+	}
+
+	for _, edge := range layout.Edges {
+		points, heads := edgeGeometry(edge)
+		dash := ""
+		if edge.Edge.Style == EdgeDotted {
+			dash = fmt.Sprintf(` stroke-dasharray="%s %s"`, num(dottedDashLength), num(dottedDashLength))
+		}
+		fmt.Fprintf(&out, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%s"%s/>`+"\n",
+			svgPoints(points), colorEdge, num(edgeStrokeWidth(edge.Edge.Style)), dash)
+		for _, head := range heads {
+			fmt.Fprintf(&out, `<polygon points="%s" fill="%s"/>`+"\n", svgPoints(head), colorEdge)
+		}
+	}
+
+	for _, cluster := range layout.Clusters {
+		writeSVGText(&out, []string{cluster.Subgraph.Label}, cluster.X+cluster.Width/2, cluster.Y+clusterTitle/2+2)
+	}
+
+	for _, node := range layout.Nodes {
+		outline, details := shapeGeometry(node)
+		fmt.Fprintf(&out, `<polygon points="%s" fill="%s" stroke="%s" stroke-width="%s"/>`+"\n",
+			svgPoints(outline), colorNodeFill, colorNodeStroke, num(strokeWidth))
+		for _, detail := range details {
+			fmt.Fprintf(&out, `<polyline points="%s" fill="none" stroke="%s" stroke-width="%s"/>`+"\n",
+				svgPoints(detail), colorNodeStroke, num(strokeWidth))
+		}
+		textY := node.Y
+		if node.Node.Shape == ShapeCylinder {
+			textY += cylinderCapHeight / 2
+		}
+		writeSVGText(&out, node.Lines, node.X, textY)
+	}
+
+	for _, edge := range layout.Edges {
+		if len(edge.LabelLines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s" opacity="0.9"/>`+"\n",
+			num(edge.Label.X-edge.LabelWidth/2), num(edge.Label.Y-edge.LabelHeight/2),
+			num(edge.LabelWidth), num(edge.LabelHeight), colorLabelFill)
+		writeSVGText(&out, edge.LabelLines, edge.Label.X, edge.Label.Y)
+	}
+
+	out.WriteString("</g>\n</svg>\n")
+	return out.Bytes()
+}
+
+// writeSVGText writes centered lines of text around (x, y). Baselines are computed explicitly
+// rather than with dominant-baseline, which not every SVG consumer supports.
+func writeSVGText(out *bytes.Buffer, lines []string, x, y float64) {
+	first := y - float64(len(lines)-1)*lineHeight/2 + svgFontSize*0.35
+	fmt.Fprintf(out, `<text text-anchor="middle">`)
+	for i, line := range lines {
+		fmt.Fprintf(out, `<tspan x="%s" y="%s">`, num(x), num(first+float64(i)*lineHeight))
+		_ = xml.EscapeText(out, []byte(line))
+		out.WriteString("</tspan>")
+	}
+	out.WriteString("</text>\n")
+}
+
+// svgPoints formats a polyline for a points attribute
+func svgPoints(points []Point) string {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = num(p.X) + "," + num(p.Y)
+	}
+	return strings.Join(parts, " ")
+}
+
+// num formats a coordinate rounded to two decimals
+func num(value float64) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
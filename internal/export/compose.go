@@ -0,0 +1,479 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+)
+
+// blockKind is the kind of a document block
+type blockKind int
+
+const (
+	blockTitle blockKind = iota
+	blockSubtitle
+	blockHeading
+	blockParagraph
+	blockBullet
+	blockNumbered
+	blockCode
+	blockTable
+	blockDiagram
+	blockRule
+)
+
+// maxHeadingLevel is the deepest heading level used below the document title
+const maxHeadingLevel = 3
+
+// block is one element of a composed document. Paragraph, list and heading text keeps its
+// inline Markdown; the DOCX and PDF writers split it into runs with parseInline.
+type block struct {
+	kind     blockKind
+	level    int
+	text     string
+	marker   string
+	language string
+	rows     [][]string
+	image    []byte
+}
+
+var (
+	headingPattern  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletPattern   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	numberedPattern = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	rulePattern     = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	separatorCell   = regexp.MustCompile(`^:?-+:?$`)
+)
+
+// composeDocument lays out a document as blocks shared by every export format
+func composeDocument(document *Document, branding Branding) []block {
+	blocks := []block{
+		{kind: blockTitle, text: document.Metadata.Title},
+		{kind: blockSubtitle, text: subtitle(document.Metadata, branding)},
+	}
+
+	appendix := &codeAppendix{}
+	multiple := len(document.Entries) > 1
+	for i, entry := range document.Entries {
+		switch {
+		case multiple && entry.Query != "":
+			blocks = append(blocks, block{kind: blockHeading, level: 1,
+				text: fmt.Sprintf("%d. %s", i+1, truncateTitle(entry.Query))})
+		case multiple:
+			blocks = append(blocks, block{kind: blockHeading, level: 1, text: fmt.Sprintf("Answer %d", i+1)})
+		case entry.Query != "" && entry.Query != document.Metadata.Title:
+			blocks = append(blocks, block{kind: blockParagraph, text: "**Question:** " + entry.Query})
+		}
+		blocks = append(blocks, composeEntry(entry, document.Metadata.Title, multiple, appendix)...)
+	}
+
+	if len(appendix.snippets) > 0 {
+		blocks = append(blocks, block{kind: blockHeading, level: 1, text: "Appendix A: Code"})
+		for i, snippet := range appendix.snippets {
+			blocks = append(blocks,
+				block{kind: blockHeading, level: 2, text: fmt.Sprintf("A.%d %s", i+1, snippetCaption(snippet))},
+				block{kind: blockCode, language: snippet.Language, text: snippet.Code})
+		}
+	}
+
+	if sources := bibliography(document.Entries); len(sources) > 0 {
+		blocks = append(blocks, block{kind: blockHeading, level: 1, text: "Sources"})
+		for i, source := range sources {
+			blocks = append(blocks, block{kind: blockNumbered, marker: fmt.Sprintf("[%d]", i+1), text: source})
+		}
+	}
+
+	return blocks
+}
+
+// subtitle describes who prepared the document and when
+func subtitle(metadata Metadata, branding Branding) string {
+	organization := metadata.Organization
+	if organization == "" {
+		organization = branding.Name
+	}
+	return fmt.Sprintf("Prepared by %s · %s", organization, metadata.CreatedAt.Format("2 January 2006"))
+}
+
+// composeEntry lays out the body and diagram of one answer. Headings are demoted below the
+// entry heading, the Sources section is replaced by the bibliography, and fenced code moves to
+// the appendix.
+func composeEntry(entry Entry, title string, nested bool, appendix *codeAppendix) []block {
+	body := parseMarkdown(entry.Response.MainText)
+	diagramCode := entry.Response.DiagramCode
+
+	titleIndex := -1
+	minLevel := 0
+	for i, b := range body {
+		if b.kind != blockHeading {
+			continue
+		}
+		if titleIndex < 0 && b.level == 1 && stripInline(b.text) == title {
+			titleIndex = i
+			continue
+		}
+		if minLevel == 0 || b.level < minLevel {
+			minLevel = b.level
+		}
+	}
+	topLevel := 1
+	if nested {
+		topLevel = 2
+	}
+
+	var blocks []block
+	skipLevel := 0
+	for i, b := range body {
+		if i == titleIndex {
+			continue
+		}
+		if b.kind == blockHeading {
+			if skipLevel > 0 && b.level > skipLevel {
+				continue
+			}
+			skipLevel = 0
+			if strings.EqualFold(stripInline(b.text), "sources") {
+				skipLevel = b.level
+				continue
+			}
+			b.level = min(b.level-minLevel+topLevel, maxHeadingLevel)
+		} else if skipLevel > 0 {
+			continue
+		}
+
+		if b.kind == blockCode {
+			if isMermaid(b.language) {
+				if diagramCode == "" {
+					diagramCode = b.text
+				}
+				continue
+			}
+			number := appendix.add(synth.CodeSnippet{Language: b.language, Code: b.text})
+			blocks = append(blocks, block{kind: blockParagraph,
+				text: fmt.Sprintf("_See Appendix A.%d (%s)._", number, languageName(b.language))})
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+
+	for _, snippet := range entry.Response.CodeSnippets {
+		if !isMermaid(snippet.Language) {
+			appendix.add(snippet)
+		}
+	}
+
+	if strings.TrimSpace(diagramCode) != "" {
+		blocks = append(blocks,
+			block{kind: blockHeading, level: topLevel, text: "Architecture Diagram"},
+			block{kind: blockDiagram, text: strings.TrimSpace(diagramCode), image: entry.DiagramImage})
+	}
+	return blocks
+}
+
+// codeAppendix collects the code of every entry, numbering each distinct snippet once
+type codeAppendix struct {
+	snippets []synth.CodeSnippet
+}
+
+// add registers a snippet and returns its appendix number
+func (a *codeAppendix) add(snippet synth.CodeSnippet) int {
+	code := strings.TrimSpace(snippet.Code)
+	for i, existing := range a.snippets {
+		if strings.TrimSpace(existing.Code) != code {
+			continue
+		}
+		if existing.Filename == "" {
+			a.snippets[i].Filename = snippet.Filename
+		}
+		if existing.Purpose == "" {
+			a.snippets[i].Purpose = snippet.Purpose
+		}
+		return i + 1
+	}
+	snippet.Code = strings.TrimRight(snippet.Code, "\n")
+	a.snippets = append(a.snippets, snippet)
+	return len(a.snippets)
+}
+
+// snippetCaption describes a code snippet in its appendix heading
+func snippetCaption(snippet synth.CodeSnippet) string {
+	caption := snippet.Filename
+	if caption == "" {
+		caption = languageName(snippet.Language)
+	}
+	if snippet.Purpose != "" {
+		caption += " - " + snippet.Purpose
+	}
+	return caption
+}
+
+// languageName returns a readable name for a code fence language
+func languageName(language string) string {
+	if language == "" {
+		return "code"
+	}
+	return language
+}
+
+// isMermaid reports whether a code fence language is a Mermaid diagram
+func isMermaid(language string) bool {
+	return strings.EqualFold(language, "mermaid")
+}
+
+// bibliography lists the internal and web sources cited across all entries
+func bibliography(entries []Entry) []string {
+	var sources []string
+	seen := make(map[string]bool)
+	add := func(key, text string) {
+		if key == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		sources = append(sources, text)
+	}
+
+	for _, entry := range entries {
+		response := entry.Response
+		details := make(map[string]synth.ContextSourceInfo, len(response.ContextSources))
+		for _, source := range response.ContextSources {
+			details[source.SourceID] = source
+		}
+
+		for _, sourceID := range response.Sources {
+			if strings.HasPrefix(sourceID, "http://") || strings.HasPrefix(sourceID, "https://") {
+				add(sourceID, sourceID)
+				continue
+			}
+			text := sourceID
+			if info, ok := details[sourceID]; ok && info.Title != "" {
+				text = fmt.Sprintf("%s [%s]", info.Title, sourceID)
+				if info.SourceType != "" {
+					text += ", " + info.SourceType
+				}
+			}
+			add(sourceID, text)
+		}
+
+		for _, source := range response.WebSources {
+			if !source.Used && !strings.Contains(response.MainText, source.URL) {
+				continue
+			}
+			text := source.URL
+			if source.Title != "" {
+				text = fmt.Sprintf("%s, %s", source.Title, source.URL)
+			}
+			add(source.URL, text)
+		}
+	}
+	return sources
+}
+
+// parseMarkdown splits markdown into blocks
+func parseMarkdown(markdown string) []block {
+	var blocks []block
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, block{kind: blockParagraph, text: strings.Join(paragraph, " ")})
+			paragraph = nil
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") {
+			flush()
+			language := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, block{kind: blockCode, language: language, text: strings.Join(code, "\n")})
+			continue
+		}
+
+		if trimmed == "" {
+			flush()
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "|") {
+			flush()
+			var rows [][]string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				if cells := tableCells(lines[i]); cells != nil {
+					rows = append(rows, cells)
+				}
+			}
+			i--
+			blocks = append(blocks, block{kind: blockTable, rows: rows})
+			continue
+		}
+
+		if match := headingPattern.FindStringSubmatch(trimmed); match != nil {
+			flush()
+			blocks = append(blocks, block{kind: blockHeading, level: len(match[1]), text: strings.TrimSpace(match[2])})
+			continue
+		}
+
+		if rulePattern.MatchString(line) {
+			flush()
+			blocks = append(blocks, block{kind: blockRule})
+			continue
+		}
+
+		if match := bulletPattern.FindStringSubmatch(line); match != nil {
+			flush()
+			blocks = append(blocks, block{kind: blockBullet, level: indentLevel(match[1]), text: match[2]})
+			continue
+		}
+
+		if match := numberedPattern.FindStringSubmatch(line); match != nil {
+			flush()
+			blocks = append(blocks, block{kind: blockNumbered, level: indentLevel(match[1]), marker: match[2], text: match[3]})
+			continue
+		}
+
+		paragraph = append(paragraph, strings.TrimSpace(strings.TrimPrefix(trimmed, ">")))
+	}
+	flush()
+
+	return blocks
+}
+
+// indentLevel converts list indentation to a nesting level
+func indentLevel(indent string) int {
+	indent = strings.ReplaceAll(indent, "\t", "    ")
+	return min(len(indent)/2, 3)
+}
+
+// tableCells splits a markdown table row into cells, returning nil for the separator row
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	cells := strings.Split(line, "|")
+	separator := true
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(cell)
+		if !separatorCell.MatchString(cells[i]) {
+			separator = false
+		}
+	}
+	if separator {
+		return nil
+	}
+	return cells
+}
+
+// run is a span of text with uniform formatting
+type run struct {
+	text   string
+	bold   bool
+	italic bool
+	code   bool
+}
+
+// parseInline splits inline markdown into formatted runs. Links become "text (url)".
+func parseInline(text string) []run {
+	var runs []run
+	var current strings.Builder
+	bold, italic := false, false
+	emit := func() {
+		if current.Len() > 0 {
+			runs = append(runs, run{text: current.String(), bold: bold, italic: italic})
+			current.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '`':
+			end := strings.IndexByte(text[i+1:], '`')
+			if end < 0 {
+				current.WriteByte(text[i])
+				continue
+			}
+			emit()
+			runs = append(runs, run{text: text[i+1 : i+1+end], code: true, bold: bold})
+			i += end + 1
+		case strings.HasPrefix(text[i:], "**") || strings.HasPrefix(text[i:], "__"):
+			emit()
+			bold = !bold
+			i++
+		case text[i] == '*' || (text[i] == '_' && wordBoundary(text, i)):
+			emit()
+			italic = !italic
+		case text[i] == '[':
+			label, target, length := parseLink(text[i:])
+			if length == 0 {
+				current.WriteByte(text[i])
+				continue
+			}
+			current.WriteString(label)
+			if target != label {
+				current.WriteString(" (" + target + ")")
+			}
+			i += length - 1
+		default:
+			current.WriteByte(text[i])
+		}
+	}
+	emit()
+
+	return runs
+}
+
+// wordBoundary reports whether the underscore at i opens or closes emphasis rather than
+// sitting inside an identifier such as snake_case
+func wordBoundary(text string, i int) bool {
+	before := i == 0 || !isWordByte(text[i-1])
+	after := i == len(text)-1 || !isWordByte(text[i+1])
+	return before || after
+}
+
+// isWordByte reports whether b is an ASCII letter or digit
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+// parseLink parses a markdown link at the start of text and returns its label, target and
+// length, or a zero length when text does not start with a link
+func parseLink(text string) (label, target string, length int) {
+	closeLabel := strings.Index(text, "](")
+	if closeLabel < 0 || strings.ContainsAny(text[1:closeLabel], "[]") {
+		return "", "", 0
+	}
+	closeTarget := strings.IndexByte(text[closeLabel:], ')')
+	if closeTarget < 0 {
+		return "", "", 0
+	}
+	return text[1:closeLabel], text[closeLabel+2 : closeLabel+closeTarget], closeLabel + closeTarget + 1
+}
+
+// stripInline removes inline markdown formatting from text
+func stripInline(text string) string {
+	var plain strings.Builder
+	for _, r := range parseInline(text) {
+		plain.WriteString(r.text)
+	}
+	return strings.TrimSpace(plain.String())
+}
@@ -0,0 +1,415 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	_ "image/png" // register the PNG decoder for diagram dimensions
+	"strings"
+)
+
+const (
+	// emuPerPixel converts 96 DPI pixels to English Metric Units
+	emuPerPixel = 9525
+	// docxMaxImageWidth and docxMaxImageHeight bound a diagram to the A4 text area, in EMU
+	docxMaxImageWidth  = 6 * 914400
+	docxMaxImageHeight = 8 * 914400
+	// docxListIndent is the indentation of one list level, in twentieths of a point
+	docxListIndent = 360
+)
+
+// docxWriter accumulates the main document part and its embedded images
+type docxWriter struct {
+	branding Branding
+	body     strings.Builder
+	images   [][]byte
+}
+
+// renderDOCX renders blocks as an Office Open XML word processing document
+func renderDOCX(document *Document, branding Branding, blocks []block) ([]byte, error) {
+	w := &docxWriter{branding: branding}
+	for _, b := range blocks {
+		if err := w.writeBlock(b); err != nil {
+			return nil, err
+		}
+	}
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxPackageRelationships},
+		{"docProps/core.xml", docxCoreProperties(document.Metadata)},
+		{"docProps/app.xml", docxAppProperties(branding)},
+		{"word/document.xml", w.document()},
+		{"word/styles.xml", docxStyles(branding)},
+		{"word/footer1.xml", docxFooter(branding)},
+		{"word/_rels/document.xml.rels", w.relationships()},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, part := range parts {
+		if err := writeZipEntry(archive, part.name, []byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	for i, data := range w.images {
+		if err := writeZipEntry(archive, fmt.Sprintf("word/media/image%d.png", i+1), data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish DOCX archive: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeZipEntry adds one file to the package
+func writeZipEntry(archive *zip.Writer, name string, data []byte) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := entry.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeBlock appends the XML for one block to the document body
+func (w *docxWriter) writeBlock(b block) error {
+	switch b.kind {
+	case blockTitle:
+		w.paragraph("Title", "", []run{{text: b.text}})
+	case blockSubtitle:
+		w.paragraph("Subtitle", "", []run{{text: b.text}})
+	case blockHeading:
+		w.paragraph(fmt.Sprintf("Heading%d", b.level), "", parseInline(b.text))
+	case blockParagraph:
+		w.paragraph("", "", parseInline(b.text))
+	case blockBullet, blockNumbered:
+		marker := "•"
+		if b.kind == blockNumbered {
+			marker = b.marker
+		}
+		indent := fmt.Sprintf(`<w:ind w:left="%d" w:hanging="%d"/>`, docxListIndent*(b.level+2), docxListIndent)
+		w.paragraph("ListParagraph", indent, append([]run{{text: marker + "\t"}}, parseInline(b.text)...))
+	case blockCode:
+		w.code(b.text)
+	case blockTable:
+		w.table(b.rows)
+	case blockDiagram:
+		if len(b.image) == 0 {
+			w.paragraph("Caption", "", []run{{text: "Diagram source (Mermaid)", italic: true}})
+			w.code(b.text)
+			return nil
+		}
+		if err := w.image(b.image); err != nil {
+			return err
+		}
+	case blockRule:
+		w.paragraph("", `<w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="BFBFBF"/></w:pBdr>`, nil)
+	}
+	return nil
+}
+
+// paragraph appends a paragraph with an optional style and extra paragraph properties
+func (w *docxWriter) paragraph(style, properties string, runs []run) {
+	w.body.WriteString("<w:p>")
+	if style != "" || properties != "" {
+		w.body.WriteString("<w:pPr>")
+		if style != "" {
+			w.body.WriteString(`<w:pStyle w:val="` + style + `"/>`)
+		}
+		w.body.WriteString(properties)
+		w.body.WriteString("</w:pPr>")
+	}
+	for _, r := range runs {
+		w.body.WriteString(docxRun(r))
+	}
+	w.body.WriteString("</w:p>")
+}
+
+// docxRun renders a formatted run of text
+func docxRun(r run) string {
+	var properties strings.Builder
+	if r.code {
+		properties.WriteString(`<w:rStyle w:val="CodeChar"/>`)
+	}
+	if r.bold {
+		properties.WriteString("<w:b/>")
+	}
+	if r.italic {
+		properties.WriteString("<w:i/>")
+	}
+
+	var out strings.Builder
+	out.WriteString("<w:r>")
+	if properties.Len() > 0 {
+		out.WriteString("<w:rPr>" + properties.String() + "</w:rPr>")
+	}
+	for i, part := range strings.Split(r.text, "\t") {
+		if i > 0 {
+			out.WriteString("<w:tab/>")
+		}
+		if part != "" {
+			out.WriteString(`<w:t xml:space="preserve">` + xmlEscape(part) + "</w:t>")
+		}
+	}
+	out.WriteString("</w:r>")
+	return out.String()
+}
+
+// code appends a code block as one shaded paragraph with a line break per source line
+func (w *docxWriter) code(code string) {
+	w.body.WriteString(`<w:p><w:pPr><w:pStyle w:val="Code"/></w:pPr><w:r>`)
+	for i, line := range strings.Split(code, "\n") {
+		if i > 0 {
+			w.body.WriteString("<w:br/>")
+		}
+		line = strings.ReplaceAll(line, "\t", "    ")
+		w.body.WriteString(`<w:t xml:space="preserve">` + xmlEscape(line) + "</w:t>")
+	}
+	w.body.WriteString("</w:r></w:p>")
+}
+
+// table appends a bordered table whose first row is a branded header
+func (w *docxWriter) table(rows [][]string) {
+	if len(rows) == 0 {
+		return
+	}
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+
+	w.body.WriteString(`<w:tbl><w:tblPr><w:tblStyle w:val="TableGrid"/><w:tblW w:w="5000" w:type="pct"/></w:tblPr><w:tblGrid>`)
+	for i := 0; i < columns; i++ {
+		w.body.WriteString("<w:gridCol/>")
+	}
+	w.body.WriteString("</w:tblGrid>")
+
+	for i, row := range rows {
+		w.body.WriteString("<w:tr>")
+		for c := 0; c < columns; c++ {
+			cell := ""
+			if c < len(row) {
+				cell = row[c]
+			}
+			w.body.WriteString("<w:tc><w:tcPr>")
+			if i == 0 {
+				w.body.WriteString(`<w:shd w:val="clear" w:color="auto" w:fill="` + w.branding.Color + `"/>`)
+			}
+			w.body.WriteString("</w:tcPr><w:p>")
+			for _, r := range parseInline(cell) {
+				if i == 0 {
+					w.body.WriteString(strings.Replace(docxRun(run{text: r.text, bold: true}),
+						"<w:b/>", `<w:b/><w:color w:val="FFFFFF"/>`, 1))
+					continue
+				}
+				w.body.WriteString(docxRun(r))
+			}
+			w.body.WriteString("</w:p></w:tc>")
+		}
+		w.body.WriteString("</w:tr>")
+	}
+	w.body.WriteString("</w:tbl>")
+	w.paragraph("", "", nil)
+}
+
+// image embeds a PNG as a centered inline picture scaled to the text area
+func (w *docxWriter) image(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to read diagram image: %w", err)
+	}
+
+	width := int64(config.Width) * emuPerPixel
+	height := int64(config.Height) * emuPerPixel
+	if width > docxMaxImageWidth {
+		height = height * docxMaxImageWidth / width
+		width = docxMaxImageWidth
+	}
+	if height > docxMaxImageHeight {
+		width = width * docxMaxImageHeight / height
+		height = docxMaxImageHeight
+	}
+
+	w.images = append(w.images, data)
+	id := len(w.images)
+	w.body.WriteString(fmt.Sprintf(`<w:p><w:pPr><w:jc w:val="center"/></w:pPr><w:r><w:drawing>`+
+		`<wp:inline distT="0" distB="0" distL="0" distR="0"><wp:extent cx="%[2]d" cy="%[3]d"/>`+
+		`<wp:docPr id="%[1]d" name="Diagram %[1]d" descr="Architecture diagram"/>`+
+		`<wp:cNvGraphicFramePr><a:graphicFrameLocks noChangeAspect="1"/></wp:cNvGraphicFramePr>`+
+		`<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture">`+
+		`<pic:pic><pic:nvPicPr><pic:cNvPr id="%[1]d" name="image%[1]d.png"/><pic:cNvPicPr/></pic:nvPicPr>`+
+		`<pic:blipFill><a:blip r:embed="rIdImage%[1]d"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>`+
+		`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%[2]d" cy="%[3]d"/></a:xfrm>`+
+		`<a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr></pic:pic>`+
+		`</a:graphicData></a:graphic></wp:inline></w:drawing></w:r></w:p>`, id, width, height))
+	return nil
+}
+
+// document returns the main document part
+func (w *docxWriter) document() string {
+	return xml.Header +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"` +
+		` xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"` +
+		` xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"` +
+		` xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"` +
+		` xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture"><w:body>` +
+		w.body.String() +
+		`<w:sectPr><w:footerReference w:type="default" r:id="rIdFooter"/>` +
+		`<w:pgSz w:w="11906" w:h="16838"/>` +
+		`<w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="708" w:footer="708" w:gutter="0"/>` +
+		`</w:sectPr></w:body></w:document>`
+}
+
+// relationships returns the main document relationships, including one per image
+func (w *docxWriter) relationships() string {
+	var out strings.Builder
+	out.WriteString(xml.Header)
+	out.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	out.WriteString(`<Relationship Id="rIdStyles" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`)
+	out.WriteString(`<Relationship Id="rIdFooter" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/footer" Target="footer1.xml"/>`)
+	for i := range w.images {
+		out.WriteString(fmt.Sprintf(`<Relationship Id="rIdImage%[1]d" `+
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/image%[1]d.png"/>`, i+1))
+	}
+	out.WriteString("</Relationships>")
+	return out.String()
+}
+
+const docxContentTypes = xml.Header +
+	`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Default Extension="png" ContentType="image/png"/>` +
+	`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+	`<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>` +
+	`<Override PartName="/word/footer1.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.footer+xml"/>` +
+	`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>` +
+	`<Override PartName="/docProps/app.xml" ContentType="application/vnd.openxmlformats-officedocument.extended-properties+xml"/>` +
+	`</Types>`
+
+const docxPackageRelationships = xml.Header +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+	`<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/extended-properties" Target="docProps/app.xml"/>` +
+	`</Relationships>`
+
+// docxCoreProperties returns the document metadata part
+func docxCoreProperties(metadata Metadata) string {
+	created := metadata.CreatedAt.UTC().Format("2006-01-02T15:04:05Z")
+	description := ""
+	if metadata.ConversationID != "" {
+		description = "Conversation " + metadata.ConversationID
+	}
+	return xml.Header +
+		`<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties"` +
+		` xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/"` +
+		` xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+		"<dc:title>" + xmlEscape(metadata.Title) + "</dc:title>" +
+		"<dc:subject>" + xmlEscape(metadata.Subject) + "</dc:subject>" +
+		"<dc:creator>" + xmlEscape(metadata.Author) + "</dc:creator>" +
+		"<dc:description>" + xmlEscape(description) + "</dc:description>" +
+		"<cp:lastModifiedBy>" + xmlEscape(metadata.Author) + "</cp:lastModifiedBy>" +
+		`<dcterms:created xsi:type="dcterms:W3CDTF">` + created + "</dcterms:created>" +
+		`<dcterms:modified xsi:type="dcterms:W3CDTF">` + created + "</dcterms:modified>" +
+		"</cp:coreProperties>"
+}
+
+// docxAppProperties returns the extended properties part naming the organisation
+func docxAppProperties(branding Branding) string {
+	return xml.Header +
+		`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties">` +
+		"<Application>AI SA Assistant</Application>" +
+		"<Company>" + xmlEscape(branding.Name) + "</Company>" +
+		"</Properties>"
+}
+
+// docxFooter returns the page footer with the footer text and page numbers
+func docxFooter(branding Branding) string {
+	footer := ""
+	if branding.Footer != "" {
+		footer = docxRun(run{text: branding.Footer + "    "})
+	}
+	return xml.Header +
+		`<w:ftr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:p>` +
+		`<w:pPr><w:pStyle w:val="Footer"/><w:jc w:val="center"/></w:pPr>` + footer +
+		docxRun(run{text: "Page "}) +
+		`<w:fldSimple w:instr="PAGE"><w:r><w:t>1</w:t></w:r></w:fldSimple>` +
+		docxRun(run{text: " of "}) +
+		`<w:fldSimple w:instr="NUMPAGES"><w:r><w:t>1</w:t></w:r></w:fldSimple>` +
+		"</w:p></w:ftr>"
+}
+
+// docxStyles returns the style definitions with the brand color applied to headings
+func docxStyles(branding Branding) string {
+	heading := func(level, size, before int) string {
+		return fmt.Sprintf(`<w:style w:type="paragraph" w:styleId="Heading%[1]d"><w:name w:val="heading %[1]d"/>`+
+			`<w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/>`+
+			`<w:pPr><w:keepNext/><w:spacing w:before="%[3]d" w:after="120"/><w:outlineLvl w:val="%[4]d"/></w:pPr>`+
+			`<w:rPr><w:b/><w:color w:val="%[5]s"/><w:sz w:val="%[2]d"/></w:rPr></w:style>`,
+			level, size, before, level-1, branding.Color)
+	}
+
+	return xml.Header +
+		`<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+		`<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:cs="Calibri"/>` +
+		`<w:sz w:val="22"/></w:rPr></w:rPrDefault>` +
+		`<w:pPrDefault><w:pPr><w:spacing w:after="120" w:line="264" w:lineRule="auto"/></w:pPr></w:pPrDefault></w:docDefaults>` +
+		`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:qFormat/></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:basedOn w:val="Normal"/><w:qFormat/>` +
+		`<w:pPr><w:spacing w:after="60"/></w:pPr>` +
+		`<w:rPr><w:b/><w:color w:val="` + branding.Color + `"/><w:sz w:val="48"/></w:rPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Subtitle"><w:name w:val="Subtitle"/><w:basedOn w:val="Normal"/><w:qFormat/>` +
+		`<w:pPr><w:pBdr><w:bottom w:val="single" w:sz="12" w:space="4" w:color="` + branding.Color + `"/></w:pBdr>` +
+		`<w:spacing w:after="240"/></w:pPr><w:rPr><w:i/><w:color w:val="595959"/></w:rPr></w:style>` +
+		heading(1, 32, 360) + heading(2, 26, 240) + heading(3, 22, 200) +
+		`<w:style w:type="paragraph" w:styleId="ListParagraph"><w:name w:val="List Paragraph"/><w:basedOn w:val="Normal"/>` +
+		`<w:pPr><w:spacing w:after="60"/></w:pPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Caption"><w:name w:val="caption"/><w:basedOn w:val="Normal"/>` +
+		`<w:rPr><w:color w:val="595959"/><w:sz w:val="18"/></w:rPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/>` +
+		`<w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F2F2F2"/><w:spacing w:after="160" w:line="240" w:lineRule="auto"/></w:pPr>` +
+		`<w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="18"/></w:rPr></w:style>` +
+		`<w:style w:type="character" w:styleId="CodeChar"><w:name w:val="Code Char"/>` +
+		`<w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:shd w:val="clear" w:color="auto" w:fill="F2F2F2"/></w:rPr></w:style>` +
+		`<w:style w:type="paragraph" w:styleId="Footer"><w:name w:val="footer"/><w:basedOn w:val="Normal"/>` +
+		`<w:rPr><w:color w:val="7F7F7F"/><w:sz w:val="16"/></w:rPr></w:style>` +
+		`<w:style w:type="table" w:styleId="TableGrid"><w:name w:val="Table Grid"/>` +
+		`<w:tblPr><w:tblBorders>` +
+		`<w:top w:val="single" w:sz="4" w:space="0" w:color="BFBFBF"/><w:left w:val="single" w:sz="4" w:space="0" w:color="BFBFBF"/>` +
+		`<w:bottom w:val="single" w:sz="4" w:space="0" w:color="BFBFBF"/><w:right w:val="single" w:sz="4" w:space="0" w:color="BFBFBF"/>` +
+		`<w:insideH w:val="single" w:sz="4" w:space="0" w:color="BFBFBF"/><w:insideV w:val="single" w:sz="4" w:space="0" w:color="BFBFBF"/>` +
+		`</w:tblBorders><w:tblCellMar><w:left w:w="108" w:type="dxa"/><w:right w:w="108" w:type="dxa"/></w:tblCellMar></w:tblPr></w:style>` +
+		`</w:styles>`
+}
+
+// xmlEscape escapes text for XML character data
+func xmlEscape(text string) string {
+	var out strings.Builder
+	_ = xml.EscapeText(&out, []byte(text))
+	return out.String()
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRenderDOCX(t *testing.T) {
+	image := testPNG(t)
+	exporter := NewExporter(Branding{Name: "Acme & Co", Color: "c00000", Footer: "Confidential"},
+		&stubRenderer{image: image}, zap.NewNop())
+	document := NewResponseDocument("Plan a <migration> to AWS", testResponse())
+	document.Metadata.ConversationID = "conv-1"
+
+	file, err := exporter.Export(context.Background(), document, FormatDOCX)
+	if err != nil {
+		t.Fatalf("Export(docx) error = %v", err)
+	}
+	if file.ContentType != FormatDOCX.ContentType() || !strings.HasSuffix(file.Name, ".docx") {
+		t.Errorf("Unexpected file %q (%s)", file.Name, file.ContentType)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(file.Data), int64(len(file.Data)))
+	if err != nil {
+		t.Fatalf("DOCX is not a valid zip archive: %v", err)
+	}
+
+	parts := make(map[string]string)
+	for _, entry := range archive.File {
+		reader, err := entry.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", entry.Name, err)
+		}
+		data, _ := io.ReadAll(reader)
+		_ = reader.Close()
+		parts[entry.Name] = string(data)
+
+		if strings.HasSuffix(entry.Name, ".xml") || strings.HasSuffix(entry.Name, ".rels") {
+			decoder := xml.NewDecoder(bytes.NewReader(data))
+			for {
+				if _, err := decoder.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("%s is not well-formed XML: %v", entry.Name, err)
+				}
+			}
+		}
+	}
+
+	if parts["word/media/image1.png"] != string(image) {
+		t.Error("Expected the rendered diagram to be embedded")
+	}
+	documentXML := parts["word/document.xml"]
+	for _, want := range []string{
+		`r:embed="rIdImage1"`,
+		`<w:pStyle w:val="Title"/>`,
+		`<w:t xml:space="preserve">AWS MGN</w:t>`,
+		`<w:rStyle w:val="CodeChar"/>`,
+		`aws mgn describe-source-servers`,
+		`<w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t xml:space="preserve">Sources</w:t>`,
+	} {
+		if !strings.Contains(documentXML, want) {
+			t.Errorf("Expected document.xml to contain %q", want)
+		}
+	}
+	if !strings.Contains(parts["word/styles.xml"], `<w:color w:val="C00000"/>`) {
+		t.Error("Expected the brand color in the heading styles")
+	}
+	if !strings.Contains(parts["word/footer1.xml"], "Confidential") || !strings.Contains(parts["word/footer1.xml"], `w:instr="PAGE"`) {
+		t.Error("Expected the footer text and page number field")
+	}
+	core := parts["docProps/core.xml"]
+	for _, want := range []string{"<dc:title>Migration Plan</dc:title>", "<dc:subject>Plan a &lt;migration&gt; to AWS</dc:subject>",
+		"<dc:creator>Acme &amp; Co</dc:creator>", "Conversation conv-1"} {
+		if !strings.Contains(core, want) {
+			t.Errorf("Expected core.xml to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export renders synthesis answers, plans and whole conversations as
+// branded DOCX, PDF and Markdown deliverables. All three formats share one
+// document composition: the answer body, the rendered architecture diagram, a
+// code appendix and a source bibliography.
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/your-org/ai-sa-assistant/internal/config"
+	"github.com/your-org/ai-sa-assistant/internal/session"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"go.uber.org/zap"
+)
+
+// Format is an export file format
+type Format string
+
+const (
+	// FormatMarkdown exports clean Markdown with YAML front matter
+	FormatMarkdown Format = "markdown"
+	// FormatDOCX exports an Office Open XML word processing document
+	FormatDOCX Format = "docx"
+	// FormatPDF exports a PDF document
+	FormatPDF Format = "pdf"
+)
+
+// MessageMetadataResponse is the message metadata key holding the full synthesis response of
+// an assistant message, so conversations can be exported with diagrams, code and sources
+const MessageMetadataResponse = "response"
+
+const (
+	defaultBrandName  = "AI SA Assistant"
+	defaultBrandColor = "1F4E79"
+	maxTitleLength    = 120
+	maxFilenameLength = 60
+)
+
+var (
+	// ErrUnsupportedFormat is returned for an unknown export format
+	ErrUnsupportedFormat = errors.New("unsupported export format")
+	// ErrEmptyDocument is returned when there is no answer to export
+	ErrEmptyDocument = errors.New("nothing to export")
+)
+
+// ParseFormat parses an export format name. The empty string selects Markdown.
+func ParseFormat(value string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "md", "markdown":
+		return FormatMarkdown, nil
+	case "docx", "word":
+		return FormatDOCX, nil
+	case "pdf":
+		return FormatPDF, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedFormat, value)
+	}
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatDOCX:
+		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	case FormatPDF:
+		return "application/pdf"
+	default:
+		return "text/markdown; charset=utf-8"
+	}
+}
+
+// Extension returns the file extension of the format, without the dot
+func (f Format) Extension() string {
+	switch f {
+	case FormatDOCX:
+		return "docx"
+	case FormatPDF:
+		return "pdf"
+	default:
+		return "md"
+	}
+}
+
+// Branding is the organisation branding applied to exported documents
+type Branding struct {
+	Name string
+	// Color is a six digit hex heading color, with or without a leading '#'
+	Color  string
+	Author string
+	Footer string
+}
+
+// BrandingFromConfig returns the branding configured in the export section
+func BrandingFromConfig(cfg config.ExportConfig) Branding {
+	return Branding{
+		Name:   cfg.BrandName,
+		Color:  cfg.BrandColor,
+		Author: cfg.Author,
+		Footer: cfg.Footer,
+	}
+}
+
+// Metadata describes an exported document
+type Metadata struct {
+	Title          string
+	Subject        string
+	Author         string
+	Organization   string
+	ConversationID string
+	CreatedAt      time.Time
+}
+
+// Entry is one answered question in an exported document
+type Entry struct {
+	Query    string
+	Response synth.SynthesisResponse
+	// DiagramImage is the PNG rendering of Response.DiagramCode. When it is empty the
+	// exporter renders the diagram, and falls back to the Mermaid source if that fails.
+	DiagramImage []byte
+}
+
+// Document is the content of an export
+type Document struct {
+	Metadata Metadata
+	Entries  []Entry
+}
+
+// File is a rendered export
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// DiagramRenderer renders Mermaid diagram code to a PNG image
+type DiagramRenderer interface {
+	RenderDiagramPNG(ctx context.Context, mermaidCode string) ([]byte, error)
+}
+
+// NewResponseDocument creates a document for a single answer or plan
+func NewResponseDocument(query string, response synth.SynthesisResponse) *Document {
+	title := firstHeading(response.MainText)
+	if title == "" {
+		title = query
+	}
+	return &Document{
+		Metadata: Metadata{
+			Title:   truncateTitle(title),
+			Subject: query,
+		},
+		Entries: []Entry{{Query: query, Response: response}},
+	}
+}
+
+// NewConversationDocument creates a document with every answered question of a conversation.
+// Assistant messages stored with MessageMetadataResponse keep their diagrams, code and sources;
+// older messages are exported from their text content.
+func NewConversationDocument(sess *session.Session) (*Document, error) {
+	if sess == nil {
+		return nil, ErrEmptyDocument
+	}
+
+	document := &Document{
+		Metadata: Metadata{
+			Title:          truncateTitle(sess.Title),
+			ConversationID: sess.ID,
+			CreatedAt:      sess.UpdatedAt,
+		},
+	}
+	if document.Metadata.Title == "" {
+		document.Metadata.Title = "Conversation Export"
+	}
+
+	query := ""
+	for _, message := range sess.Messages {
+		switch message.Role {
+		case session.UserRole:
+			query = message.Content
+		case session.AssistantRole:
+			document.Entries = append(document.Entries, Entry{
+				Query:    query,
+				Response: responseFromMessage(message),
+			})
+			query = ""
+		}
+	}
+
+	if len(document.Entries) == 0 {
+		return nil, ErrEmptyDocument
+	}
+	document.Metadata.Subject = document.Entries[0].Query
+	return document, nil
+}
+
+// responseFromMessage recovers the synthesis response of an assistant message. Metadata that
+// went through a JSON store arrives as generic maps, so it is decoded through JSON either way.
+func responseFromMessage(message session.Message) synth.SynthesisResponse {
+	response := synth.SynthesisResponse{MainText: message.Content}
+	if message.Metadata == nil {
+		return response
+	}
+
+	if stored, ok := message.Metadata[MessageMetadataResponse]; ok {
+		if decodeMetadata(stored, &response) == nil && response.MainText != "" {
+			return response
+		}
+		response = synth.SynthesisResponse{MainText: message.Content}
+	}
+
+	if code, ok := message.Metadata["diagram_code"].(string); ok {
+		response.DiagramCode = code
+	}
+	if snippets, ok := message.Metadata["code_snippets"]; ok {
+		_ = decodeMetadata(snippets, &response.CodeSnippets)
+	}
+	if sources, ok := message.Metadata["context_sources"]; ok {
+		_ = decodeMetadata(sources, &response.Sources)
+	}
+	return response
+}
+
+// decodeMetadata copies a metadata value into target through its JSON encoding
+func decodeMetadata(value interface{}, target interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// Exporter renders documents in the supported formats
+type Exporter struct {
+	branding Branding
+	renderer DiagramRenderer
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+// NewExporter creates an exporter. The renderer may be nil, in which case diagrams are
+// exported as Mermaid source.
+func NewExporter(branding Branding, renderer DiagramRenderer, logger *zap.Logger) *Exporter {
+	if branding.Name == "" {
+		branding.Name = defaultBrandName
+	}
+	if branding.Author == "" {
+		branding.Author = branding.Name
+	}
+	branding.Color = strings.ToUpper(strings.TrimPrefix(branding.Color, "#"))
+	if len(branding.Color) != 6 {
+		branding.Color = defaultBrandColor
+	}
+	return &Exporter{
+		branding: branding,
+		renderer: renderer,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// Export renders the document in the given format
+func (e *Exporter) Export(ctx context.Context, document *Document, format Format) (*File, error) {
+	if document == nil || len(document.Entries) == 0 {
+		return nil, ErrEmptyDocument
+	}
+
+	document = e.prepare(ctx, document, format)
+	blocks := composeDocument(document, e.branding)
+
+	var data []byte
+	var err error
+	switch format {
+	case FormatMarkdown:
+		data = renderMarkdown(document, e.branding, blocks)
+	case FormatDOCX:
+		data, err = renderDOCX(document, e.branding, blocks)
+	case FormatPDF:
+		data, err = renderPDF(document, e.branding, blocks)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s export: %w", format, err)
+	}
+
+	e.logger.Info("Exported document",
+		zap.String("format", string(format)),
+		zap.String("title", document.Metadata.Title),
+		zap.Int("entries", len(document.Entries)),
+		zap.Int("bytes", len(data)))
+
+	return &File{
+		Name:        fileName(document.Metadata, format),
+		ContentType: format.ContentType(),
+		Data:        data,
+	}, nil
+}
+
+// prepare fills in metadata defaults and renders diagram images for the binary formats.
+// The caller's document is not modified.
+func (e *Exporter) prepare(ctx context.Context, document *Document, format Format) *Document {
+	prepared := *document
+	prepared.Entries = append([]Entry(nil), document.Entries...)
+
+	if prepared.Metadata.CreatedAt.IsZero() {
+		prepared.Metadata.CreatedAt = e.now()
+	}
+	if prepared.Metadata.Author == "" {
+		prepared.Metadata.Author = e.branding.Author
+	}
+	if prepared.Metadata.Organization == "" {
+		prepared.Metadata.Organization = e.branding.Name
+	}
+	if prepared.Metadata.Title == "" {
+		prepared.Metadata.Title = truncateTitle(prepared.Entries[0].Query)
+	}
+
+	if format == FormatMarkdown || e.renderer == nil {
+		return &prepared
+	}
+
+	for i := range prepared.Entries {
+		entry := &prepared.Entries[i]
+		if entry.Response.DiagramCode == "" || len(entry.DiagramImage) > 0 {
+			continue
+		}
+		image, err := e.renderer.RenderDiagramPNG(ctx, entry.Response.DiagramCode)
+		if err != nil {
+			e.logger.Warn("Failed to render diagram for export, including the Mermaid source instead",
+				zap.Int("entry", i), zap.Error(err))
+			continue
+		}
+		entry.DiagramImage = image
+	}
+	return &prepared
+}
+
+// firstHeading returns the text of the first level one heading in markdown
+func firstHeading(markdown string) string {
+	for _, line := range strings.Split(markdown, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "# "))
+		}
+	}
+	return ""
+}
+
+// truncateTitle shortens a query to a document title
+func truncateTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	runes := []rune(title)
+	if len(runes) <= maxTitleLength {
+		return title
+	}
+	return strings.TrimSpace(string(runes[:maxTitleLength])) + "..."
+}
+
+// fileName builds a download file name from the document title and date
+func fileName(metadata Metadata, format Format) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(metadata.Title) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			slug.WriteRune(r)
+			dash = false
+		case slug.Len() > 0 && !dash:
+			slug.WriteByte('-')
+			dash = true
+		}
+		if slug.Len() >= maxFilenameLength {
+			break
+		}
+	}
+
+	name := strings.Trim(slug.String(), "-")
+	if name == "" {
+		name = "export"
+	}
+	return fmt.Sprintf("%s-%s.%s", name, metadata.CreatedAt.Format("2006-01-02"), format.Extension())
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/your-org/ai-sa-assistant/internal/session"
+	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"go.uber.org/zap"
+)
+
+const testMainText = "# Migration Plan\n\n" +
+	"Use **AWS MGN** to rehost the `web` tier [aws-migration-guide].\n\n" +
+	"## Steps\n\n- Install the agent\n- Launch test instances\n\n" +
+	"```bash\naws mgn describe-source-servers\n```\n\n" +
+	"```mermaid\ngraph TD\n  A --> B\n```\n\n" +
+	"## Sources\n\n- [aws-migration-guide]\n"
+
+// testResponse returns a response with a diagram, code and both kinds of sources
+func testResponse() synth.SynthesisResponse {
+	return synth.SynthesisResponse{
+		MainText:    testMainText,
+		DiagramCode: "graph TD\n  A[Data Center] --> B[AWS]",
+		CodeSnippets: []synth.CodeSnippet{
+			{Language: "bash", Code: "aws mgn describe-source-servers", Filename: "discover.sh"},
+			{Language: "hcl", Code: "resource \"aws_instance\" \"web\" {}", Purpose: "Target instance"},
+		},
+		Sources: []string{"aws-migration-guide"},
+		ContextSources: []synth.ContextSourceInfo{
+			{SourceID: "aws-migration-guide", Title: "AWS Migration Guide", SourceType: "playbook"},
+		},
+		WebSources: []synth.WebSourceInfo{
+			{URL: "https://aws.amazon.com/mgn/", Title: "AWS MGN", Used: true},
+			{URL: "https://example.com/unused", Title: "Unused"},
+		},
+	}
+}
+
+// testPNG returns a small PNG image with a transparent corner
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 3; y++ {
+			img.Set(x, y, color.NRGBA{R: 31, G: 78, B: 121, A: 255})
+		}
+	}
+	img.Set(0, 0, color.NRGBA{})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// stubRenderer returns a fixed image or error
+type stubRenderer struct {
+	image []byte
+	err   error
+	calls int
+}
+
+func (s *stubRenderer) RenderDiagramPNG(_ context.Context, _ string) ([]byte, error) {
+	s.calls++
+	return s.image, s.err
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]Format{"": FormatMarkdown, "md": FormatMarkdown, "DOCX": FormatDOCX, "word": FormatDOCX, "pdf": FormatPDF}
+	for value, want := range tests {
+		got, err := ParseFormat(value)
+		if err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+
+	if _, err := ParseFormat("odt"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestComposeDocument(t *testing.T) {
+	document := NewResponseDocument("Plan a migration to AWS", testResponse())
+	document.Metadata.CreatedAt = time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	blocks := composeDocument(document, Branding{Name: "Acme"})
+
+	if document.Metadata.Title != "Migration Plan" {
+		t.Errorf("Expected the answer heading as the title, got %q", document.Metadata.Title)
+	}
+
+	var headings, numbered []string
+	var diagrams, code []block
+	for _, b := range blocks {
+		switch b.kind {
+		case blockHeading:
+			headings = append(headings, b.text)
+		case blockNumbered:
+			numbered = append(numbered, b.text)
+		case blockDiagram:
+			diagrams = append(diagrams, b)
+		case blockCode:
+			code = append(code, b)
+		}
+	}
+
+	wantHeadings := []string{"Steps", "Architecture Diagram", "Appendix A: Code",
+		"A.1 discover.sh", "A.2 hcl - Target instance", "Sources"}
+	if strings.Join(headings, "|") != strings.Join(wantHeadings, "|") {
+		t.Errorf("Unexpected headings: %q", headings)
+	}
+	if len(diagrams) != 1 || !strings.Contains(diagrams[0].text, "A[Data Center]") {
+		t.Errorf("Expected the response diagram once, got %+v", diagrams)
+	}
+	if len(code) != 2 {
+		t.Errorf("Expected two deduplicated appendix snippets, got %d", len(code))
+	}
+	wantSources := []string{"AWS Migration Guide [aws-migration-guide], playbook", "AWS MGN, https://aws.amazon.com/mgn/"}
+	if strings.Join(numbered, "|") != strings.Join(wantSources, "|") {
+		t.Errorf("Unexpected bibliography: %q", numbered)
+	}
+	if blocks[1].text != "Prepared by Acme · 1 May 2024" {
+		t.Errorf("Unexpected subtitle: %q", blocks[1].text)
+	}
+}
+
+func TestNewConversationDocument(t *testing.T) {
+	response := testResponse()
+	// Simulate metadata that went through a JSON session store
+	var stored map[string]interface{}
+	data, _ := json.Marshal(response)
+	_ = json.Unmarshal(data, &stored)
+
+	sess := &session.Session{
+		ID:    "conv-1",
+		Title: "AWS migration",
+		Messages: []session.Message{
+			{Role: session.UserRole, Content: "Plan a migration to AWS"},
+			{Role: session.AssistantRole, Content: "summary", Metadata: map[string]interface{}{MessageMetadataResponse: stored}},
+			{Role: session.UserRole, Content: "And the costs?"},
+			{Role: session.AssistantRole, Content: "About $3,000 per month.",
+				Metadata: map[string]interface{}{"diagram_code": "graph LR\n  A --> B"}},
+		},
+	}
+
+	document, err := NewConversationDocument(sess)
+	if err != nil {
+		t.Fatalf("NewConversationDocument() error = %v", err)
+	}
+	if len(document.Entries) != 2 || document.Metadata.ConversationID != "conv-1" {
+		t.Fatalf("Unexpected document: %+v", document.Metadata)
+	}
+	if document.Entries[0].Response.DiagramCode != response.DiagramCode || len(document.Entries[0].Response.CodeSnippets) != 2 {
+		t.Error("Expected the stored response to be restored from message metadata")
+	}
+	if document.Entries[1].Query != "And the costs?" || document.Entries[1].Response.DiagramCode != "graph LR\n  A --> B" {
+		t.Errorf("Unexpected legacy entry: %+v", document.Entries[1])
+	}
+
+	if _, err := NewConversationDocument(&session.Session{}); !errors.Is(err, ErrEmptyDocument) {
+		t.Errorf("Expected ErrEmptyDocument, got %v", err)
+	}
+}
+
+func TestExportRendersDiagramForBinaryFormats(t *testing.T) {
+	renderer := &stubRenderer{image: testPNG(t)}
+	exporter := NewExporter(Branding{Name: "Acme", Color: "#c00000"}, renderer, zap.NewNop())
+	document := NewResponseDocument("Plan a migration to AWS", testResponse())
+
+	file, err := exporter.Export(context.Background(), document, FormatMarkdown)
+	if err != nil {
+		t.Fatalf("Export(markdown) error = %v", err)
+	}
+	if renderer.calls != 0 {
+		t.Error("Expected Markdown exports to keep the Mermaid source without rendering")
+	}
+	if !strings.HasSuffix(file.Name, ".md") || !strings.HasPrefix(file.Name, "migration-plan-") {
+		t.Errorf("Unexpected file name %q", file.Name)
+	}
+
+	if _, err := exporter.Export(context.Background(), document, FormatPDF); err != nil {
+		t.Fatalf("Export(pdf) error = %v", err)
+	}
+	if renderer.calls != 1 {
+		t.Errorf("Expected one diagram render, got %d", renderer.calls)
+	}
+	if len(document.Entries[0].DiagramImage) != 0 {
+		t.Error("Expected Export not to modify the caller's document")
+	}
+
+	failing := NewExporter(Branding{}, &stubRenderer{err: errors.New("unavailable")}, zap.NewNop())
+	file, err = failing.Export(context.Background(), document, FormatPDF)
+	if err != nil {
+		t.Fatalf("Expected a render failure to fall back to the Mermaid source, got %v", err)
+	}
+	if !bytes.Contains(file.Data, []byte(`(\(Mermaid\)) Tj`)) {
+		t.Error("Expected the PDF to include the Mermaid source")
+	}
+
+	if _, err := exporter.Export(context.Background(), &Document{}, FormatPDF); !errors.Is(err, ErrEmptyDocument) {
+		t.Errorf("Expected ErrEmptyDocument, got %v", err)
+	}
+}
+
+func TestParseInline(t *testing.T) {
+	runs := parseInline("Use **AWS MGN** with `aws mgn` and [the guide](https://example.com) for snake_case names")
+	var plain strings.Builder
+	for _, r := range runs {
+		plain.WriteString(r.text)
+	}
+	if plain.String() != "Use AWS MGN with aws mgn and the guide (https://example.com) for snake_case names" {
+		t.Errorf("Unexpected text %q", plain.String())
+	}
+	if !runs[1].bold || runs[1].text != "AWS MGN" || !runs[3].code {
+		t.Errorf("Unexpected runs: %+v", runs)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// renderMarkdown renders blocks as Markdown with YAML front matter. Diagrams stay Mermaid
+// code blocks, which Markdown viewers render natively.
+func renderMarkdown(document *Document, branding Branding, blocks []block) []byte {
+	var out strings.Builder
+
+	metadata := document.Metadata
+	out.WriteString("---\n")
+	writeFrontMatter(&out, "title", metadata.Title)
+	writeFrontMatter(&out, "subject", metadata.Subject)
+	writeFrontMatter(&out, "author", metadata.Author)
+	writeFrontMatter(&out, "organization", metadata.Organization)
+	writeFrontMatter(&out, "conversation_id", metadata.ConversationID)
+	out.WriteString("date: " + metadata.CreatedAt.UTC().Format("2006-01-02T15:04:05Z") + "\n")
+	out.WriteString("---\n")
+
+	previous := blockTitle
+	for i, b := range blocks {
+		listItem := b.kind == blockBullet || b.kind == blockNumbered
+		if i > 0 && !(listItem && previous == b.kind) {
+			out.WriteString("\n")
+		}
+		previous = b.kind
+
+		indent := strings.Repeat("  ", b.level)
+		switch b.kind {
+		case blockTitle:
+			out.WriteString("\n# " + b.text + "\n")
+		case blockSubtitle:
+			out.WriteString("_" + b.text + "_\n")
+		case blockHeading:
+			out.WriteString(strings.Repeat("#", b.level+1) + " " + b.text + "\n")
+		case blockParagraph:
+			out.WriteString(b.text + "\n")
+		case blockBullet:
+			out.WriteString(indent + "- " + b.text + "\n")
+		case blockNumbered:
+			out.WriteString(indent + b.marker + " " + b.text + "\n")
+		case blockCode:
+			out.WriteString("```" + b.language + "\n" + b.text + "\n```\n")
+		case blockDiagram:
+			out.WriteString("```mermaid\n" + b.text + "\n```\n")
+		case blockTable:
+			writeMarkdownTable(&out, b.rows)
+		case blockRule:
+			out.WriteString("---\n")
+		}
+	}
+
+	if branding.Footer != "" {
+		out.WriteString("\n---\n\n_" + branding.Footer + "_\n")
+	}
+
+	return []byte(out.String())
+}
+
+// writeFrontMatter writes a YAML front matter field, skipping empty values. JSON strings are
+// valid YAML double-quoted scalars.
+func writeFrontMatter(out *strings.Builder, key, value string) {
+	if value == "" {
+		return
+	}
+	quoted, _ := json.Marshal(value)
+	out.WriteString(key + ": " + string(quoted) + "\n")
+}
+
+// writeMarkdownTable writes table rows with a header separator after the first row
+func writeMarkdownTable(out *strings.Builder, rows [][]string) {
+	for i, row := range rows {
+		out.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			separator := make([]string, len(row))
+			for j := range separator {
+				separator[j] = "---"
+			}
+			out.WriteString("| " + strings.Join(separator, " | ") + " |\n")
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	document := NewResponseDocument("Plan a migration to AWS", testResponse())
+	document.Metadata.Author = "Acme SA Team"
+	document.Metadata.Organization = "Acme"
+	document.Metadata.CreatedAt = time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	document.Entries[0].Response.MainText = strings.Replace(document.Entries[0].Response.MainText,
+		"## Sources", "| Service | Cost |\n|---|---|\n| EC2 | $70 |\n\n## Sources", 1)
+	branding := Branding{Name: "Acme", Footer: "Confidential"}
+
+	output := string(renderMarkdown(document, branding, composeDocument(document, branding)))
+
+	for _, want := range []string{
+		"---\ntitle: \"Migration Plan\"\nsubject: \"Plan a migration to AWS\"\nauthor: \"Acme SA Team\"\norganization: \"Acme\"\ndate: 2024-05-01T09:00:00Z\n---\n",
+		"\n# Migration Plan\n\n_Prepared by Acme · 1 May 2024_\n",
+		"**Question:** Plan a migration to AWS",
+		"Use **AWS MGN** to rehost the `web` tier [aws-migration-guide].",
+		"## Steps\n\n- Install the agent\n- Launch test instances\n",
+		"_See Appendix A.1 (bash)._",
+		"## Architecture Diagram\n\n```mermaid\ngraph TD\n  A[Data Center] --> B[AWS]\n```",
+		"## Appendix A: Code\n\n### A.1 discover.sh\n\n```bash\naws mgn describe-source-servers\n```",
+		"| Service | Cost |\n| --- | --- |\n| EC2 | $70 |\n",
+		"## Sources\n\n[1] AWS Migration Guide [aws-migration-guide], playbook\n[2] AWS MGN, https://aws.amazon.com/mgn/\n",
+		"---\n\n_Confidential_\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected Markdown to contain %q, got:\n%s", want, output)
+		}
+	}
+
+	if strings.Contains(output, "A --> B\n") {
+		t.Error("Expected the inline Mermaid block to be replaced by the response diagram")
+	}
+	if strings.Contains(output, "- [aws-migration-guide]") {
+		t.Error("Expected the answer's Sources section to be replaced by the bibliography")
+	}
+}
@@ -0,0 +1,583 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// PDF page geometry in points, for A4 paper
+const (
+	pdfPageWidth    = 595.28
+	pdfPageHeight   = 841.89
+	pdfMargin       = 56.0
+	pdfFooterY      = 30.0
+	pdfContentWidth = pdfPageWidth - 2*pdfMargin
+	pdfBodySize     = 10.5
+	pdfCodeSize     = 8.5
+	pdfListIndent   = 14.0
+	// pdfPointsPerPixel renders images at 96 DPI
+	pdfPointsPerPixel = 0.75
+)
+
+// The standard Type 1 fonts used by the PDF writer. They need no embedding.
+const (
+	fontRegular = iota
+	fontBold
+	fontItalic
+	fontBoldItalic
+	fontMono
+)
+
+var pdfFontNames = []string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique", "Courier"}
+
+// helveticaWidths and helveticaBoldWidths are the glyph widths of printable ASCII (32-126) in
+// thousandths of the font size, from the standard font metrics. Oblique variants share them.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// winAnsiSpecials maps characters outside Latin-1 to their WinAnsiEncoding bytes
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, '‰': 0x89,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// winAnsiReplacements spells out common characters the standard fonts cannot show
+var winAnsiReplacements = map[rune]string{
+	'→': "->", '←': "<-", '↔': "<->", '⇒': "=>", '≤': "<=", '≥': ">=", '≠': "!=",
+	'✓': "[x]", '✔': "[x]", '✅': "[x]", '❌': "[ ]", '✗': "[ ]",
+}
+
+// pdfWord is a run of text without spaces, drawn in one font
+type pdfWord struct {
+	text  []byte
+	font  int
+	size  float64
+	width float64
+	space bool
+}
+
+// pdfTextStyle controls how a block of text is set
+type pdfTextStyle struct {
+	size        float64
+	indent      float64
+	color       [3]float64
+	bold        bool
+	marker      string
+	spaceBefore float64
+	spaceAfter  float64
+}
+
+// pdfImage is an image XObject
+type pdfImage struct {
+	width  int
+	height int
+	data   []byte
+}
+
+// pdfLayout lays blocks out onto pages of content stream operators
+type pdfLayout struct {
+	pages  []*strings.Builder
+	y      float64
+	images []pdfImage
+	brand  [3]float64
+}
+
+// renderPDF renders blocks as a PDF document
+func renderPDF(document *Document, branding Branding, blocks []block) ([]byte, error) {
+	layout := &pdfLayout{brand: hexColor(branding.Color)}
+	layout.newPage()
+
+	for _, b := range blocks {
+		if err := layout.writeBlock(b); err != nil {
+			return nil, err
+		}
+	}
+	layout.writeFooters(branding.Footer)
+
+	return layout.serialize(document.Metadata)
+}
+
+// writeBlock lays out one block
+func (l *pdfLayout) writeBlock(b block) error {
+	black := [3]float64{0, 0, 0}
+	switch b.kind {
+	case blockTitle:
+		l.text([]run{{text: b.text}}, pdfTextStyle{size: 22, color: l.brand, bold: true, spaceAfter: 4})
+	case blockSubtitle:
+		l.text([]run{{text: b.text, italic: true}}, pdfTextStyle{size: 10, color: [3]float64{0.35, 0.35, 0.35}, spaceAfter: 4})
+		l.rule(l.brand, 1.2)
+		l.y -= 10
+	case blockHeading:
+		size := map[int]float64{1: 16, 2: 13, 3: 11.5}[b.level]
+		l.ensure(size * 4)
+		l.text(parseInline(b.text), pdfTextStyle{size: size, color: l.brand, bold: true, spaceBefore: size * 0.8, spaceAfter: 4})
+	case blockParagraph:
+		l.text(parseInline(b.text), pdfTextStyle{size: pdfBodySize, color: black, spaceAfter: 6})
+	case blockBullet, blockNumbered:
+		marker := "•"
+		if b.kind == blockNumbered {
+			marker = b.marker
+		}
+		indent := pdfListIndent*float64(b.level) + pdfListIndent + float64(len(marker))*3
+		l.text(parseInline(b.text), pdfTextStyle{size: pdfBodySize, indent: indent, color: black, marker: marker, spaceAfter: 3})
+	case blockCode:
+		l.code(b.text)
+	case blockTable:
+		for i, row := range b.rows {
+			l.text(parseInline(strings.Join(row, "  |  ")),
+				pdfTextStyle{size: 9, color: black, bold: i == 0, spaceAfter: 2})
+		}
+		l.y -= 6
+	case blockDiagram:
+		if len(b.image) == 0 {
+			l.text([]run{{text: "Diagram source (Mermaid)", italic: true}},
+				pdfTextStyle{size: 9, color: [3]float64{0.35, 0.35, 0.35}, spaceAfter: 2})
+			l.code(b.text)
+			return nil
+		}
+		return l.image(b.image)
+	case blockRule:
+		l.y -= 4
+		l.rule([3]float64{0.75, 0.75, 0.75}, 0.5)
+		l.y -= 8
+	}
+	return nil
+}
+
+// newPage starts a page and moves the cursor to its top margin
+func (l *pdfLayout) newPage() {
+	l.pages = append(l.pages, &strings.Builder{})
+	l.y = pdfPageHeight - pdfMargin
+}
+
+// page returns the content stream of the current page
+func (l *pdfLayout) page() *strings.Builder {
+	return l.pages[len(l.pages)-1]
+}
+
+// ensure starts a new page unless height points fit above the bottom margin
+func (l *pdfLayout) ensure(height float64) {
+	if l.y-height < pdfMargin {
+		l.newPage()
+	}
+}
+
+// text sets runs as a wrapped block of text
+func (l *pdfLayout) text(runs []run, style pdfTextStyle) {
+	if l.y < pdfPageHeight-pdfMargin {
+		l.y -= style.spaceBefore
+	}
+
+	var words []pdfWord
+	for _, r := range runs {
+		font := fontRegular
+		switch {
+		case r.code:
+			font = fontMono
+		case (r.bold || style.bold) && r.italic:
+			font = fontBoldItalic
+		case r.bold || style.bold:
+			font = fontBold
+		case r.italic:
+			font = fontItalic
+		}
+
+		encoded := toWinAnsi(r.text)
+		start := 0
+		for i := 0; i <= len(encoded); i++ {
+			if i < len(encoded) && encoded[i] != ' ' {
+				continue
+			}
+			if i > start {
+				text := encoded[start:i]
+				words = append(words, pdfWord{text: text, font: font, size: style.size, width: textWidth(text, font, style.size)})
+			}
+			if i < len(encoded) && len(words) > 0 {
+				words[len(words)-1].space = true
+			}
+			start = i + 1
+		}
+	}
+
+	maxWidth := pdfContentWidth - style.indent
+	var line []pdfWord
+	lineWidth := 0.0
+	first := true
+	emit := func() {
+		marker := ""
+		if first {
+			marker = style.marker
+		}
+		l.line(line, style, marker)
+		line, lineWidth, first = nil, 0, false
+	}
+
+	for _, word := range words {
+		for _, part := range splitWord(word, maxWidth) {
+			needed := part.width
+			if len(line) > 0 && line[len(line)-1].space {
+				needed += spaceWidth(line[len(line)-1])
+			}
+			if len(line) > 0 && lineWidth+needed > maxWidth {
+				emit()
+				needed = part.width
+			}
+			line = append(line, part)
+			lineWidth += needed
+		}
+	}
+	if len(line) > 0 || first {
+		emit()
+	}
+
+	l.y -= style.spaceAfter
+}
+
+// line draws one line of words, with an optional list marker in the indent
+func (l *pdfLayout) line(words []pdfWord, style pdfTextStyle, marker string) {
+	lineHeight := style.size * 1.35
+	l.ensure(lineHeight)
+	baseline := l.y - style.size
+	page := l.page()
+
+	page.WriteString(fmt.Sprintf("%s %s %s rg\n", num(style.color[0]), num(style.color[1]), num(style.color[2])))
+	if marker != "" {
+		markerText := toWinAnsi(marker)
+		x := pdfMargin + style.indent - textWidth(markerText, fontRegular, style.size) - 4
+		page.WriteString(textOp(x, baseline, fontRegular, style.size, markerText))
+	}
+
+	x := pdfMargin + style.indent
+	for _, word := range words {
+		page.WriteString(textOp(x, baseline, word.font, word.size, word.text))
+		x += word.width
+		if word.space {
+			x += spaceWidth(word)
+		}
+	}
+
+	l.y -= lineHeight
+}
+
+// code draws a code block in a monospace font on a shaded background, hard wrapping long lines
+func (l *pdfLayout) code(code string) {
+	lineHeight := pdfCodeSize * 1.3
+	perLine := int(math.Floor(pdfContentWidth / (0.6 * pdfCodeSize)))
+
+	l.y -= 2
+	for _, line := range strings.Split(strings.ReplaceAll(code, "\t", "    "), "\n") {
+		encoded := toWinAnsi(line)
+		for {
+			segment := encoded
+			if len(segment) > perLine {
+				segment = encoded[:perLine]
+			}
+			l.ensure(lineHeight)
+			page := l.page()
+			page.WriteString(fmt.Sprintf("0.95 0.95 0.95 rg %s %s %s %s re f\n",
+				num(pdfMargin-4), num(l.y-lineHeight), num(pdfContentWidth+8), num(lineHeight)))
+			page.WriteString("0.15 0.15 0.15 rg\n")
+			page.WriteString(textOp(pdfMargin, l.y-pdfCodeSize, fontMono, pdfCodeSize, segment))
+			l.y -= lineHeight
+
+			if len(encoded) <= perLine {
+				break
+			}
+			encoded = encoded[perLine:]
+		}
+	}
+	l.y -= 8
+}
+
+// rule draws a horizontal line across the text area at the cursor
+func (l *pdfLayout) rule(stroke [3]float64, width float64) {
+	l.page().WriteString(fmt.Sprintf("%s %s %s RG %s w %s %s m %s %s l S\n",
+		num(stroke[0]), num(stroke[1]), num(stroke[2]), num(width),
+		num(pdfMargin), num(l.y), num(pdfPageWidth-pdfMargin), num(l.y)))
+}
+
+// image draws a diagram image scaled to the text area, flattening transparency onto white
+func (l *pdfLayout) image(data []byte) error {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode diagram image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	pixels := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			alpha := int(c.A)
+			pixels = append(pixels,
+				byte((int(c.R)*alpha+255*(255-alpha))/255),
+				byte((int(c.G)*alpha+255*(255-alpha))/255),
+				byte((int(c.B)*alpha+255*(255-alpha))/255))
+		}
+	}
+
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	if _, err := writer.Write(pixels); err != nil {
+		return fmt.Errorf("failed to compress diagram image: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to compress diagram image: %w", err)
+	}
+	l.images = append(l.images, pdfImage{width: bounds.Dx(), height: bounds.Dy(), data: compressed.Bytes()})
+
+	width := float64(bounds.Dx()) * pdfPointsPerPixel
+	height := float64(bounds.Dy()) * pdfPointsPerPixel
+	maxHeight := pdfPageHeight - 2*pdfMargin - 40
+	if width > pdfContentWidth {
+		height *= pdfContentWidth / width
+		width = pdfContentWidth
+	}
+	if height > maxHeight {
+		width *= maxHeight / height
+		height = maxHeight
+	}
+
+	l.ensure(height + 8)
+	x := pdfMargin + (pdfContentWidth-width)/2
+	l.page().WriteString(fmt.Sprintf("q %s 0 0 %s %s %s cm /Im%d Do Q\n",
+		num(width), num(height), num(x), num(l.y-height), len(l.images)))
+	l.y -= height + 12
+	return nil
+}
+
+// writeFooters adds the footer text and page numbers to every page
+func (l *pdfLayout) writeFooters(footer string) {
+	for i, page := range l.pages {
+		page.WriteString("0.5 0.5 0.5 rg\n")
+		if footer != "" {
+			page.WriteString(textOp(pdfMargin, pdfFooterY, fontRegular, 8, toWinAnsi(footer)))
+		}
+		number := toWinAnsi(fmt.Sprintf("Page %d of %d", i+1, len(l.pages)))
+		x := pdfPageWidth - pdfMargin - textWidth(number, fontRegular, 8)
+		page.WriteString(textOp(x, pdfFooterY, fontRegular, 8, number))
+	}
+}
+
+// serialize writes the PDF objects, cross-reference table and trailer
+func (l *pdfLayout) serialize(metadata Metadata) ([]byte, error) {
+	const (
+		catalogObject = 1
+		pagesObject   = 2
+		infoObject    = 3
+		firstFont     = 4
+	)
+	firstImage := firstFont + len(pdfFontNames)
+	firstPage := firstImage + len(l.images)
+	objectCount := firstPage + 2*len(l.pages) - 1
+
+	var out bytes.Buffer
+	offsets := make([]int, objectCount+1)
+	object := func(number int, body string) {
+		offsets[number] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", number, body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	object(catalogObject, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObject))
+
+	kids := make([]string, len(l.pages))
+	for i := range l.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object(pagesObject, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+
+	created := "D:" + metadata.CreatedAt.UTC().Format("20060102150405") + "Z"
+	object(infoObject, fmt.Sprintf("<< /Title %s /Subject %s /Author %s /Creator %s /Producer %s /CreationDate (%s) /ModDate (%s) >>",
+		pdfTextString(metadata.Title), pdfTextString(metadata.Subject), pdfTextString(metadata.Author),
+		pdfTextString(metadata.Organization), pdfTextString("AI SA Assistant"), created, created))
+
+	var fonts, xobjects strings.Builder
+	for i, name := range pdfFontNames {
+		object(firstFont+i, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fmt.Fprintf(&fonts, " /F%d %d 0 R", i+1, firstFont+i)
+	}
+
+	for i, img := range l.images {
+		number := firstImage + i
+		offsets[number] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB "+
+			"/BitsPerComponent 8 /Filter /FlateDecode /Length %d >>\nstream\n", number, img.width, img.height, len(img.data))
+		out.Write(img.data)
+		out.WriteString("\nendstream\nendobj\n")
+		fmt.Fprintf(&xobjects, " /Im%d %d 0 R", i+1, number)
+	}
+
+	resources := fmt.Sprintf("<< /Font <<%s >> /XObject <<%s >> >>", fonts.String(), xobjects.String())
+	for i, page := range l.pages {
+		pageNumber := firstPage + 2*i
+		content := page.String()
+		object(pageNumber, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %s /Contents %d 0 R >>",
+			pagesObject, num(pdfPageWidth), num(pdfPageHeight), resources, pageNumber+1))
+		object(pageNumber+1, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", objectCount+1)
+	for _, offset := range offsets[1:] {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		objectCount+1, catalogObject, infoObject, xref)
+
+	return out.Bytes(), nil
+}
+
+// textOp returns the operators that draw text at a position
+func textOp(x, y float64, font int, size float64, text []byte) string {
+	return fmt.Sprintf("BT /F%d %s Tf %s %s Td %s Tj ET\n", font+1, num(size), num(x), num(y), pdfLiteral(text))
+}
+
+// splitWord breaks a word wider than maxWidth into pieces that fit
+func splitWord(word pdfWord, maxWidth float64) []pdfWord {
+	if word.width <= maxWidth {
+		return []pdfWord{word}
+	}
+
+	var parts []pdfWord
+	start := 0
+	width := 0.0
+	for i := range word.text {
+		charWidth := textWidth(word.text[i:i+1], word.font, word.size)
+		if width+charWidth > maxWidth && i > start {
+			parts = append(parts, pdfWord{text: word.text[start:i], font: word.font, size: word.size, width: width})
+			start, width = i, 0
+		}
+		width += charWidth
+	}
+	parts = append(parts, pdfWord{text: word.text[start:], font: word.font, size: word.size, width: width, space: word.space})
+	return parts
+}
+
+// spaceWidth returns the width of the space following a word
+func spaceWidth(word pdfWord) float64 {
+	return textWidth([]byte{' '}, word.font, word.size)
+}
+
+// textWidth measures WinAnsi encoded text in points
+func textWidth(text []byte, font int, size float64) float64 {
+	if font == fontMono {
+		return float64(len(text)) * 600 * size / 1000
+	}
+
+	widths := &helveticaWidths
+	if font == fontBold || font == fontBoldItalic {
+		widths = &helveticaBoldWidths
+	}
+
+	total := 0
+	for _, c := range text {
+		if c >= 32 && c <= 126 {
+			total += widths[c-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// toWinAnsi encodes text for the standard fonts, substituting characters they cannot show
+func toWinAnsi(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			encoded = append(encoded, ' ')
+		case r < 32:
+		case r < 127 || (r >= 0xA0 && r <= 0xFF):
+			encoded = append(encoded, byte(r))
+		case winAnsiSpecials[r] != 0:
+			encoded = append(encoded, winAnsiSpecials[r])
+		case winAnsiReplacements[r] != "":
+			encoded = append(encoded, winAnsiReplacements[r]...)
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+// pdfLiteral escapes bytes as a PDF literal string
+func pdfLiteral(text []byte) string {
+	var out strings.Builder
+	out.WriteByte('(')
+	for _, c := range text {
+		if c == '(' || c == ')' || c == '\\' {
+			out.WriteByte('\\')
+		}
+		out.WriteByte(c)
+	}
+	out.WriteByte(')')
+	return out.String()
+}
+
+// pdfTextString encodes document information as a UTF-16BE hex string
+func pdfTextString(text string) string {
+	var out strings.Builder
+	out.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&out, "%04X", unit)
+	}
+	out.WriteString(">")
+	return out.String()
+}
+
+// hexColor converts a six digit hex color to PDF color components
+func hexColor(hex string) [3]float64 {
+	value, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(hex, "#")) != 6 {
+		value, _ = strconv.ParseUint(defaultBrandColor, 16, 32)
+	}
+	return [3]float64{
+		float64(value>>16&0xFF) / 255,
+		float64(value>>8&0xFF) / 255,
+		float64(value&0xFF) / 255,
+	}
+}
+
+// num formats a number compactly for PDF operators
+func num(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64)
+}
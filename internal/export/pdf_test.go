@@ -0,0 +1,90 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRenderPDF(t *testing.T) {
+	exporter := NewExporter(Branding{Name: "Acme", Footer: "Confidential"}, &stubRenderer{image: testPNG(t)}, zap.NewNop())
+	response := testResponse()
+	response.MainText = strings.Replace(response.MainText, "## Sources",
+		strings.Repeat("Rehost each wave (with rollback) → validate. ", 400)+"\n\n## Sources", 1)
+	document := NewResponseDocument("Plan a migration to AWS", response)
+
+	file, err := exporter.Export(context.Background(), document, FormatPDF)
+	if err != nil {
+		t.Fatalf("Export(pdf) error = %v", err)
+	}
+	data := file.Data
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("Expected a PDF header and trailer")
+	}
+	for _, want := range []string{
+		"/Title " + pdfTextString("Migration Plan"),
+		"/Author " + pdfTextString("Acme"),
+		"/Subtype /Image /Width 4 /Height 3",
+		"/Im1 Do",
+		"(Confidential) Tj",
+		`(Rehost) Tj`,
+		`(\(with) Tj`,
+		"(->) Tj",
+		"(aws mgn describe-source-servers) Tj",
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("Expected PDF to contain %q", want)
+		}
+	}
+
+	pages := bytes.Count(data, []byte("/Type /Page "))
+	if pages < 2 {
+		t.Errorf("Expected the long answer to span pages, got %d", pages)
+	}
+	if !bytes.Contains(data, []byte(fmt.Sprintf("(Page %d of %d) Tj", pages, pages))) {
+		t.Error("Expected page numbers in the footer")
+	}
+
+	// Every cross-reference offset must point at its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	if startxref == nil {
+		t.Fatal("Expected a startxref entry")
+	}
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if !bytes.HasPrefix(data[offset:], []byte(fmt.Sprintf("%d 0 obj", i+1))) {
+			t.Fatalf("Cross-reference entry %d does not point at its object", i+1)
+		}
+	}
+}
+
+func TestToWinAnsi(t *testing.T) {
+	got := toWinAnsi("Café “quoted” – 5€ → ✅ 日本")
+	want := []byte("Caf\xe9 \x93quoted\x94 \x96 5\x80 -> [x] ??")
+	if !bytes.Equal(got, want) {
+		t.Errorf("toWinAnsi() = %q, want %q", got, want)
+	}
+}
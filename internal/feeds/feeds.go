@@ -0,0 +1,422 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package feeds parses cloud provider release-note feeds in RSS 2.0 and Atom format,
+// such as AWS What's New, Azure Updates and Google Cloud release notes.
+package feeds
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Providers detected from feed and item links
+const (
+	ProviderAWS   = "aws"
+	ProviderAzure = "azure"
+	ProviderGCP   = "gcp"
+)
+
+// ErrUnsupportedFormat is returned for XML documents that are neither RSS nor Atom
+var ErrUnsupportedFormat = errors.New("unsupported feed format")
+
+// feedExtensions are the file extensions read from a feed mirror directory
+var feedExtensions = map[string]bool{".xml": true, ".rss": true, ".atom": true}
+
+// providerDomains maps release-note hosts to their cloud provider
+var providerDomains = []struct {
+	domain   string
+	provider string
+}{
+	{"aws.amazon.com", ProviderAWS},
+	{"amazon.com", ProviderAWS},
+	{"azure.microsoft.com", ProviderAzure},
+	{"azure.com", ProviderAzure},
+	{"microsoft.com", ProviderAzure},
+	{"cloud.google.com", ProviderGCP},
+	{"google.com", ProviderGCP},
+}
+
+// dateLayouts are the publish date formats seen in RSS and Atom feeds
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	time.RFC3339Nano,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// Feed is a parsed release-note feed
+type Feed struct {
+	Title    string
+	Link     string
+	Provider string
+	Items    []Item
+}
+
+// Item is a single release note
+type Item struct {
+	ID         string
+	Title      string
+	Link       string
+	Summary    string
+	Categories []string
+	// Published is the zero time when the item carries no parseable date
+	Published time.Time
+	Provider  string
+	FeedTitle string
+}
+
+// DocID returns a stable document ID for the item, derived from its ID or link
+func (i Item) DocID() string {
+	key := i.ID
+	if key == "" {
+		key = i.Link
+	}
+	if key == "" {
+		key = i.Title + "|" + i.Published.UTC().Format(time.RFC3339)
+	}
+	sum := sha256.Sum256([]byte(key))
+	prefix := i.Provider
+	if prefix == "" {
+		prefix = "feed"
+	}
+	return prefix + "-release-" + hex.EncodeToString(sum[:8])
+}
+
+// Text returns the item title and summary as a single passage
+func (i Item) Text() string {
+	if i.Summary == "" {
+		return i.Title
+	}
+	return i.Title + "\n\n" + i.Summary
+}
+
+type rssDocument struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Link  string    `xml:"link"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string   `xml:"pubDate"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Categories  []string `xml:"category"`
+}
+
+type atomDocument struct {
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      atomText       `xml:"title"`
+	Links      []atomLink     `xml:"link"`
+	Summary    atomText       `xml:"summary"`
+	Content    atomText       `xml:"content"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+}
+
+// atomText is an Atom text construct, which holds text, escaped HTML or inline XHTML
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// String returns the visible text of the construct
+func (t atomText) String() string {
+	if t.Type == "xhtml" {
+		return htmlText(t.Inner)
+	}
+	return htmlText(t.Text)
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// Parse reads an RSS 2.0 or Atom feed
+func Parse(r io.Reader) (*Feed, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed: %w", err)
+	}
+
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed *Feed
+	switch root {
+	case "rss":
+		feed, err = parseRSS(data)
+	case "feed":
+		feed, err = parseAtom(data)
+	default:
+		return nil, fmt.Errorf("%w: root element <%s>", ErrUnsupportedFormat, root)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	feed.Provider = DetectProvider(feed.Link)
+	for i := range feed.Items {
+		item := &feed.Items[i]
+		item.FeedTitle = feed.Title
+		item.Provider = DetectProvider(item.Link)
+		if item.Provider == "" {
+			item.Provider = feed.Provider
+		}
+	}
+	return feed, nil
+}
+
+// ParseFile reads the feed stored at path
+func ParseFile(path string) (*Feed, error) {
+	file, err := os.Open(path) // #nosec G304 - feed paths are supplied by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to open feed %s: %w", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	feed, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse feed %s: %w", path, err)
+	}
+	return feed, nil
+}
+
+// LoadPath reads a single feed file, or every .xml, .rss and .atom file under a
+// mirror directory in lexical order
+func LoadPath(path string) ([]*Feed, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed path: %w", err)
+	}
+	if !info.IsDir() {
+		feed, err := ParseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return []*Feed{feed}, nil
+	}
+
+	var paths []string
+	err = filepath.WalkDir(path, func(filePath string, entry os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if !entry.IsDir() && feedExtensions[strings.ToLower(filepath.Ext(filePath))] {
+			paths = append(paths, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feed directory: %w", err)
+	}
+	sort.Strings(paths)
+
+	feeds := make([]*Feed, 0, len(paths))
+	for _, filePath := range paths {
+		feed, err := ParseFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, feed)
+	}
+	return feeds, nil
+}
+
+// DetectProvider returns the cloud provider that publishes the link, or "" when unknown
+func DetectProvider(link string) string {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, candidate := range providerDomains {
+		if host == candidate.domain || strings.HasSuffix(host, "."+candidate.domain) {
+			return candidate.provider
+		}
+	}
+	return ""
+}
+
+// ParseDate parses a feed date, returning the zero time when no known layout matches
+func ParseDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range dateLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
+
+// rootElement returns the local name of the document's root element
+func rootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", fmt.Errorf("%w: no root element", ErrUnsupportedFormat)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse feed XML: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func parseRSS(data []byte) (*Feed, error) {
+	var doc rssDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse RSS feed: %w", err)
+	}
+
+	feed := &Feed{Title: strings.TrimSpace(doc.Channel.Title), Link: strings.TrimSpace(doc.Channel.Link)}
+	for _, entry := range doc.Channel.Items {
+		summary := entry.Content
+		if strings.TrimSpace(summary) == "" {
+			summary = entry.Description
+		}
+		published := entry.PubDate
+		if strings.TrimSpace(published) == "" {
+			published = entry.Date
+		}
+		feed.Items = append(feed.Items, Item{
+			ID:         strings.TrimSpace(entry.GUID),
+			Title:      htmlText(entry.Title),
+			Link:       strings.TrimSpace(entry.Link),
+			Summary:    htmlText(summary),
+			Categories: trimAll(entry.Categories),
+			Published:  ParseDate(published),
+		})
+	}
+	return feed, nil
+}
+
+func parseAtom(data []byte) (*Feed, error) {
+	var doc atomDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse Atom feed: %w", err)
+	}
+
+	feed := &Feed{Title: strings.TrimSpace(doc.Title), Link: alternateLink(doc.Links)}
+	for _, entry := range doc.Entries {
+		summary := entry.Content.String()
+		if summary == "" {
+			summary = entry.Summary.String()
+		}
+		published := entry.Published
+		if strings.TrimSpace(published) == "" {
+			published = entry.Updated
+		}
+		categories := make([]string, 0, len(entry.Categories))
+		for _, category := range entry.Categories {
+			categories = append(categories, category.Term)
+		}
+		feed.Items = append(feed.Items, Item{
+			ID:         strings.TrimSpace(entry.ID),
+			Title:      entry.Title.String(),
+			Link:       alternateLink(entry.Links),
+			Summary:    summary,
+			Categories: trimAll(categories),
+			Published:  ParseDate(published),
+		})
+	}
+	return feed, nil
+}
+
+// alternateLink returns the rel="alternate" link, or the first link when none is marked
+func alternateLink(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	if len(links) > 0 {
+		return strings.TrimSpace(links[0].Href)
+	}
+	return ""
+}
+
+// htmlText returns the visible text of an HTML fragment with whitespace collapsed
+func htmlText(fragment string) string {
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	var builder strings.Builder
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(builder.String()), " ")
+		case html.TextToken:
+			builder.Write(tokenizer.Text())
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			// Keep words in adjacent elements apart
+			builder.WriteByte(' ')
+		}
+	}
+}
+
+// trimAll trims each value and drops empty ones
+func trimAll(values []string) []string {
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			trimmed = append(trimmed, value)
+		}
+	}
+	return trimmed
+}
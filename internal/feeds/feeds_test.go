@@ -0,0 +1,146 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feeds
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const awsWhatsNewRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+  <channel>
+    <title>Recent Announcements</title>
+    <link>https://aws.amazon.com/about-aws/whats-new/recent/</link>
+    <item>
+      <guid isPermaLink="false">a1b2c3</guid>
+      <title>Amazon EKS now supports Kubernetes version 1.31</title>
+      <link>https://aws.amazon.com/about-aws/whats-new/2024/09/amazon-eks-kubernetes-version-1-31/</link>
+      <description>&lt;p&gt;You can now create &lt;b&gt;EKS&lt;/b&gt; clusters running Kubernetes 1.31.&lt;/p&gt;</description>
+      <pubDate>Thu, 26 Sep 2024 17:00:00 +0000</pubDate>
+      <category>general:products/amazon-eks</category>
+    </item>
+    <item>
+      <title>Undated announcement</title>
+      <link>https://aws.amazon.com/about-aws/whats-new/undated/</link>
+    </item>
+  </channel>
+</rss>`
+
+const azureUpdatesAtom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Azure updates</title>
+  <link rel="self" href="https://example.org/feed.atom"/>
+  <link rel="alternate" href="https://azure.microsoft.com/en-us/updates/"/>
+  <entry>
+    <id>urn:uuid:5f0e</id>
+    <title type="html">Generally available: Azure Site Recovery &amp;amp; Premium SSD v2</title>
+    <link href="https://azure.microsoft.com/en-us/updates/asr-premium-ssd-v2/"/>
+    <updated>2025-02-10T09:30:00Z</updated>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Replicate VMs that use</p><p>Premium SSD v2 disks.</p></div></content>
+    <category term="Site Recovery"/>
+  </entry>
+</feed>`
+
+func TestParseRSS(t *testing.T) {
+	feed, err := Parse(strings.NewReader(awsWhatsNewRSS))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Recent Announcements", feed.Title)
+	assert.Equal(t, ProviderAWS, feed.Provider)
+	require.Len(t, feed.Items, 2)
+
+	item := feed.Items[0]
+	assert.Equal(t, "a1b2c3", item.ID)
+	assert.Equal(t, "Amazon EKS now supports Kubernetes version 1.31", item.Title)
+	assert.Equal(t, "You can now create EKS clusters running Kubernetes 1.31.", item.Summary)
+	assert.Equal(t, time.Date(2024, 9, 26, 17, 0, 0, 0, time.UTC), item.Published.UTC())
+	assert.Equal(t, []string{"general:products/amazon-eks"}, item.Categories)
+	assert.Equal(t, ProviderAWS, item.Provider)
+	assert.Equal(t, "Recent Announcements", item.FeedTitle)
+
+	assert.True(t, feed.Items[1].Published.IsZero())
+	assert.Equal(t, "Undated announcement", feed.Items[1].Text())
+}
+
+func TestParseAtom(t *testing.T) {
+	feed, err := Parse(strings.NewReader(azureUpdatesAtom))
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://azure.microsoft.com/en-us/updates/", feed.Link)
+	assert.Equal(t, ProviderAzure, feed.Provider)
+	require.Len(t, feed.Items, 1)
+
+	item := feed.Items[0]
+	assert.Equal(t, "Generally available: Azure Site Recovery & Premium SSD v2", item.Title)
+	assert.Equal(t, "https://azure.microsoft.com/en-us/updates/asr-premium-ssd-v2/", item.Link)
+	assert.Equal(t, "Replicate VMs that use Premium SSD v2 disks.", item.Summary)
+	assert.Equal(t, time.Date(2025, 2, 10, 9, 30, 0, 0, time.UTC), item.Published.UTC())
+	assert.Equal(t, []string{"Site Recovery"}, item.Categories)
+	assert.Equal(t, ProviderAzure, item.Provider)
+}
+
+func TestParseRejectsUnknownFormat(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<html><body>not a feed</body></html>`))
+	assert.True(t, errors.Is(err, ErrUnsupportedFormat))
+
+	_, err = Parse(strings.NewReader(`not xml at all`))
+	assert.Error(t, err)
+}
+
+func TestLoadPathReadsMirrorDirectory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "aws.rss"), []byte(awsWhatsNewRSS), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "azure"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "azure", "updates.atom"), []byte(azureUpdatesAtom), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# mirror"), 0o600))
+
+	feeds, err := LoadPath(dir)
+	require.NoError(t, err)
+	require.Len(t, feeds, 2)
+	assert.Equal(t, ProviderAWS, feeds[0].Provider)
+	assert.Equal(t, ProviderAzure, feeds[1].Provider)
+
+	single, err := LoadPath(filepath.Join(dir, "aws.rss"))
+	require.NoError(t, err)
+	assert.Len(t, single, 1)
+
+	_, err = LoadPath(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestDetectProvider(t *testing.T) {
+	assert.Equal(t, ProviderAWS, DetectProvider("https://aws.amazon.com/new/"))
+	assert.Equal(t, ProviderAzure, DetectProvider("https://azure.microsoft.com/updates/"))
+	assert.Equal(t, ProviderAzure, DetectProvider("https://learn.microsoft.com/azure/"))
+	assert.Equal(t, ProviderGCP, DetectProvider("https://cloud.google.com/release-notes"))
+	assert.Equal(t, "", DetectProvider("https://example.com/feed"))
+	assert.Equal(t, "", DetectProvider("https://notamazon.com/feed"))
+}
+
+func TestItemDocIDIsStable(t *testing.T) {
+	item := Item{ID: "a1b2c3", Provider: ProviderAWS}
+	assert.Equal(t, item.DocID(), Item{ID: "a1b2c3", Provider: ProviderAWS, Title: "changed"}.DocID())
+	assert.True(t, strings.HasPrefix(item.DocID(), "aws-release-"))
+	assert.NotEqual(t, item.DocID(), Item{ID: "other", Provider: ProviderAWS}.DocID())
+	assert.True(t, strings.HasPrefix(Item{Link: "https://example.com/a"}.DocID(), "feed-release-"))
+}
@@ -0,0 +1,352 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultAnthropicEndpoint = "https://api.anthropic.com"
+	anthropicMessagesPath    = "/v1/messages"
+	// DefaultAnthropicVersion is the anthropic-version header sent when none is configured
+	DefaultAnthropicVersion = "2023-06-01"
+	// defaultAnthropicMaxTokens is used when a request does not set MaxTokens, which the
+	// Messages API requires
+	defaultAnthropicMaxTokens = 4096
+	// maxAnthropicResponseBytes limits the size of a non-streamed response body
+	maxAnthropicResponseBytes = 4 << 20
+)
+
+// anthropicModel generates chat completions with the Anthropic Messages API
+type anthropicModel struct {
+	apiKey     string
+	endpoint   string
+	version    string
+	httpClient *http.Client
+}
+
+// anthropicMessage is a message in the Messages API format
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// anthropicTool is a tool definition in the Messages API format
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// anthropicRequest is the Messages API request body
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature float32            `json:"temperature"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice  *anthropicChoice   `json:"tool_choice,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+// anthropicChoice forces the model to call the named tool
+type anthropicChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// anthropicUsage is the token usage reported by the Messages API
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicResponse is the subset of the Messages API response used here
+type anthropicResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      anthropicUsage `json:"usage"`
+}
+
+// anthropicError is the Messages API error body
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicStreamEvent is the subset of the Messages API stream events used here
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func newAnthropicModel(cfg ProviderConfig, httpClient *http.Client) (*anthropicModel, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("anthropic provider requires an API key")
+	}
+	version := cfg.APIVersion
+	if version == "" {
+		version = DefaultAnthropicVersion
+	}
+	return &anthropicModel{
+		apiKey:     cfg.APIKey,
+		endpoint:   endpointOrDefault(cfg.Endpoint, defaultAnthropicEndpoint),
+		version:    version,
+		httpClient: httpClient,
+	}, nil
+}
+
+// Provider returns the provider type
+func (m *anthropicModel) Provider() string {
+	return ProviderAnthropic
+}
+
+// CreateChatCompletion returns the complete response to the request
+func (m *anthropicModel) CreateChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	body := buildAnthropicRequest(req)
+	if req.Function != nil {
+		body.Tools = []anthropicTool{{
+			Name:        req.Function.Name,
+			Description: req.Function.Description,
+			InputSchema: req.Function.Parameters,
+		}}
+		body.ToolChoice = &anthropicChoice{Type: "tool", Name: req.Function.Name}
+	}
+
+	resp, err := m.send(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var payload anthropicResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAnthropicResponseBytes)).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to decode anthropic response: %w", err)
+	}
+
+	result := &ChatResponse{
+		FinishReason: anthropicFinishReason(payload.StopReason),
+		Usage:        anthropicTokenUsage(payload.Usage),
+	}
+	var content strings.Builder
+	for _, block := range payload.Content {
+		switch block.Type {
+		case "text":
+			content.WriteString(block.Text)
+		case "tool_use":
+			if req.Function != nil && block.Name == req.Function.Name {
+				result.FunctionArguments = string(block.Input)
+			}
+		}
+	}
+	result.Content = content.String()
+	return result, nil
+}
+
+// CreateChatCompletionStream streams the response, passing each text delta to onDelta
+func (m *anthropicModel) CreateChatCompletionStream(ctx context.Context, req ChatRequest, onDelta DeltaFunc) (*ChatResponse, error) {
+	if req.Function != nil {
+		return nil, fmt.Errorf("function calling is not supported for streamed chat completions")
+	}
+	body := buildAnthropicRequest(req)
+	body.Stream = true
+
+	resp, err := m.send(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var content strings.Builder
+	var usage anthropicUsage
+	result := &ChatResponse{}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return nil, fmt.Errorf("failed to decode anthropic stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			usage.InputTokens = event.Message.Usage.InputTokens
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				continue
+			}
+			content.WriteString(event.Delta.Text)
+			if err := onDelta(event.Delta.Text); err != nil {
+				return nil, fmt.Errorf("stream consumer stopped: %w", err)
+			}
+		case "message_delta":
+			result.FinishReason = anthropicFinishReason(event.Delta.StopReason)
+			usage.OutputTokens = event.Usage.OutputTokens
+		case "error":
+			return nil, &APIError{
+				Provider:   ProviderAnthropic,
+				StatusCode: anthropicStreamErrorStatus(event.Error.Type),
+				Type:       event.Error.Type,
+				Message:    event.Error.Message,
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("anthropic stream failed: %w", err)
+	}
+
+	result.Content = content.String()
+	result.Usage = anthropicTokenUsage(usage)
+	return result, nil
+}
+
+// send posts the request body to the Messages API and returns a successful response
+func (m *anthropicModel) send(ctx context.Context, body anthropicRequest) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode anthropic request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, m.endpoint+anthropicMessagesPath, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create anthropic request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", m.apiKey)
+	httpReq.Header.Set("anthropic-version", m.version)
+	if body.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := m.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		apiErr := &APIError{Provider: ProviderAnthropic, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		var errorBody anthropicError
+		if json.Unmarshal(data, &errorBody) == nil && errorBody.Error.Message != "" {
+			apiErr.Type = errorBody.Error.Type
+			apiErr.Message = errorBody.Error.Message
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// buildAnthropicRequest converts the request to the Messages API format. System messages
+// become the system prompt and consecutive messages with the same role are joined,
+// because the API requires user and assistant turns to alternate.
+func buildAnthropicRequest(req ChatRequest) anthropicRequest {
+	body := anthropicRequest{
+		Model:       req.Model,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	}
+	if body.MaxTokens <= 0 {
+		body.MaxTokens = defaultAnthropicMaxTokens
+	}
+
+	var system []string
+	for _, message := range req.Messages {
+		if message.Role == RoleSystem {
+			system = append(system, message.Content)
+			continue
+		}
+		role := RoleUser
+		if message.Role == RoleAssistant {
+			role = RoleAssistant
+		}
+		if last := len(body.Messages) - 1; last >= 0 && body.Messages[last].Role == role {
+			body.Messages[last].Content += "\n\n" + message.Content
+			continue
+		}
+		body.Messages = append(body.Messages, anthropicMessage{Role: role, Content: message.Content})
+	}
+	body.System = strings.Join(system, "\n\n")
+	return body
+}
+
+// anthropicFinishReason maps a Messages API stop reason onto the shared finish reasons
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return FinishReasonStop
+	case "max_tokens":
+		return FinishReasonLength
+	case "tool_use":
+		return FinishReasonFunctionCall
+	default:
+		return stopReason
+	}
+}
+
+// anthropicTokenUsage converts Messages API token usage
+func anthropicTokenUsage(usage anthropicUsage) Usage {
+	return Usage{
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      usage.InputTokens + usage.OutputTokens,
+	}
+}
+
+// anthropicStreamErrorStatus gives errors reported inside a stream the HTTP status the
+// same error would have had, so callers can decide whether to retry
+func anthropicStreamErrorStatus(errorType string) int {
+	switch errorType {
+	case "overloaded_error":
+		return 529
+	case "rate_limit_error":
+		return http.StatusTooManyRequests
+	case "invalid_request_error":
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,361 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package llmtest provides a local fake server that stands in for the OpenAI, Azure
+// OpenAI, Anthropic Messages and OpenAI-compatible chat APIs in contract tests.
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const (
+	// APIKey is the key the fake server accepts for every provider
+	APIKey = "fake-llm-api-key" // pragma: allowlist secret
+	// AzureAPIVersion is the api-version the fake Azure OpenAI endpoint accepts
+	AzureAPIVersion = "2024-06-01"
+	// AnthropicVersion is the anthropic-version header the fake Anthropic endpoint accepts
+	AnthropicVersion = "2023-06-01"
+	// RateLimitedModel is a model name every endpoint answers with a rate limit error
+	RateLimitedModel = "rate-limited-model"
+	// UnavailableModel is a model name every endpoint answers with a server error
+	UnavailableModel = "unavailable-model"
+)
+
+// Fake server path prefixes, one per provider wire format
+const (
+	PathOpenAI    = "openai"
+	PathAzure     = "azure"
+	PathAnthropic = "anthropic"
+	PathLocal     = "local"
+)
+
+// DefaultReply is the answer content served when no reply is set
+const DefaultReply = "Use AWS Application Migration Service for the lift-and-shift."
+
+// DefaultFunctionArguments are the function call arguments served when none are set
+const DefaultFunctionArguments = `{"answer":"Use AWS MGN.","confidence":0.9}`
+
+// Usage reported for every response
+const (
+	PromptTokens     = 42
+	CompletionTokens = 7
+)
+
+// Request is a chat request received by the fake server
+type Request struct {
+	// Provider is the path prefix the request was sent to
+	Provider string
+	Path     string
+	Query    string
+	Header   http.Header
+	// Model is the model named in the body, or the Azure deployment in the path
+	Model string
+	Body  map[string]interface{}
+}
+
+// Server is a fake chat server. Each provider wire format is served under its own path
+// prefix, e.g. Server.URL(PathAzure).
+type Server struct {
+	*httptest.Server
+
+	mu                sync.Mutex
+	reply             string
+	functionArguments string
+	requests          []Request
+}
+
+// NewServer starts a fake chat server that answers with DefaultReply. Callers must Close
+// the server.
+func NewServer() *Server {
+	s := &Server{reply: DefaultReply, functionArguments: DefaultFunctionArguments}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+PathOpenAI+"/chat/completions", s.handleOpenAI(PathOpenAI))
+	mux.HandleFunc("/"+PathLocal+"/v1/chat/completions", s.handleOpenAI(PathLocal))
+	mux.HandleFunc("/"+PathAzure+"/openai/deployments/", s.handleAzure)
+	mux.HandleFunc("/"+PathAnthropic+"/v1/messages", s.handleAnthropic)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// URL returns the endpoint to configure for the given path prefix
+func (s *Server) URL(prefix string) string {
+	if prefix == PathLocal {
+		return s.Server.URL + "/" + PathLocal + "/v1"
+	}
+	return s.Server.URL + "/" + prefix
+}
+
+// SetReply sets the answer content served from now on
+func (s *Server) SetReply(reply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reply = reply
+}
+
+// SetFunctionArguments sets the function call arguments served from now on
+func (s *Server) SetFunctionArguments(arguments string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.functionArguments = arguments
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// record decodes and stores the request, returning its body and the current answer
+func (s *Server) record(provider, model string, r *http.Request) (map[string]interface{}, string, string, error) {
+	var body map[string]interface{}
+	data, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(data, &body)
+	}
+	if model == "" {
+		model, _ = body["model"].(string)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{
+		Provider: provider,
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		Header:   r.Header.Clone(),
+		Model:    model,
+		Body:     body,
+	})
+	return body, s.reply, s.functionArguments, err
+}
+
+func (s *Server) handleOpenAI(provider string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+APIKey {
+			writeOpenAIError(w, http.StatusUnauthorized, "invalid_api_key", "Incorrect API key provided")
+			return
+		}
+		s.serveOpenAI(provider, "", w, r)
+	}
+}
+
+func (s *Server) handleAzure(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("api-key") != APIKey {
+		writeOpenAIError(w, http.StatusUnauthorized, "401", "Access denied due to invalid subscription key")
+		return
+	}
+	if r.URL.Query().Get("api-version") != AzureAPIVersion {
+		writeOpenAIError(w, http.StatusNotFound, "404", "Resource not found")
+		return
+	}
+	deployment, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/"+PathAzure+"/openai/deployments/"), "/chat/completions")
+	if !ok || deployment == "" || strings.Contains(deployment, "/") {
+		writeOpenAIError(w, http.StatusNotFound, "DeploymentNotFound", "The API deployment for this resource does not exist")
+		return
+	}
+	s.serveOpenAI(PathAzure, deployment, w, r)
+}
+
+// serveOpenAI answers a chat completions request in the OpenAI wire format
+func (s *Server) serveOpenAI(provider, deployment string, w http.ResponseWriter, r *http.Request) {
+	body, reply, arguments, err := s.record(provider, deployment, r)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	model := deployment
+	if model == "" {
+		model, _ = body["model"].(string)
+	}
+	switch model {
+	case RateLimitedModel:
+		writeOpenAIError(w, http.StatusTooManyRequests, "rate_limit_exceeded", "Rate limit reached")
+		return
+	case UnavailableModel:
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "The server is overloaded")
+		return
+	}
+
+	usage := map[string]int{
+		"prompt_tokens":     PromptTokens,
+		"completion_tokens": CompletionTokens,
+		"total_tokens":      PromptTokens + CompletionTokens,
+	}
+
+	if stream, _ := body["stream"].(bool); stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range splitReply(reply) {
+			writeEvent(w, "", map[string]interface{}{
+				"object":  "chat.completion.chunk",
+				"choices": []map[string]interface{}{{"index": 0, "delta": map[string]string{"content": delta}}},
+			})
+		}
+		writeEvent(w, "", map[string]interface{}{
+			"object":  "chat.completion.chunk",
+			"choices": []map[string]interface{}{{"index": 0, "delta": map[string]string{}, "finish_reason": "stop"}},
+		})
+		writeEvent(w, "", map[string]interface{}{"object": "chat.completion.chunk", "choices": []interface{}{}, "usage": usage})
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+		return
+	}
+
+	message := map[string]interface{}{"role": "assistant", "content": reply}
+	finishReason := "stop"
+	if tools, _ := body["tools"].([]interface{}); len(tools) > 0 {
+		function, _ := tools[0].(map[string]interface{})["function"].(map[string]interface{})
+		message = map[string]interface{}{
+			"role":    "assistant",
+			"content": "",
+			"tool_calls": []map[string]interface{}{{
+				"id":       "call_fake",
+				"type":     "function",
+				"function": map[string]interface{}{"name": function["name"], "arguments": arguments},
+			}},
+		}
+		finishReason = "tool_calls"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      "chatcmpl-fake",
+		"object":  "chat.completion",
+		"model":   model,
+		"choices": []map[string]interface{}{{"index": 0, "message": message, "finish_reason": finishReason}},
+		"usage":   usage,
+	})
+}
+
+func (s *Server) handleAnthropic(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("x-api-key") != APIKey {
+		writeAnthropicError(w, http.StatusUnauthorized, "authentication_error", "invalid x-api-key")
+		return
+	}
+	if r.Header.Get("anthropic-version") != AnthropicVersion {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "unsupported anthropic-version")
+		return
+	}
+
+	body, reply, arguments, err := s.record(PathAnthropic, "", r)
+	if err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if _, ok := body["max_tokens"].(float64); !ok {
+		writeAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "max_tokens: Field required")
+		return
+	}
+	switch body["model"] {
+	case RateLimitedModel:
+		writeAnthropicError(w, http.StatusTooManyRequests, "rate_limit_error", "Number of request tokens has exceeded your rate limit")
+		return
+	case UnavailableModel:
+		writeAnthropicError(w, 529, "overloaded_error", "Overloaded")
+		return
+	}
+
+	if stream, _ := body["stream"].(bool); stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		writeEvent(w, "message_start", map[string]interface{}{
+			"type":    "message_start",
+			"message": map[string]interface{}{"usage": map[string]int{"input_tokens": PromptTokens, "output_tokens": 1}},
+		})
+		writeEvent(w, "content_block_start", map[string]interface{}{
+			"type": "content_block_start", "index": 0, "content_block": map[string]string{"type": "text", "text": ""},
+		})
+		for _, delta := range splitReply(reply) {
+			writeEvent(w, "content_block_delta", map[string]interface{}{
+				"type": "content_block_delta", "index": 0, "delta": map[string]string{"type": "text_delta", "text": delta},
+			})
+		}
+		writeEvent(w, "content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": 0})
+		writeEvent(w, "message_delta", map[string]interface{}{
+			"type":  "message_delta",
+			"delta": map[string]string{"stop_reason": "end_turn"},
+			"usage": map[string]int{"output_tokens": CompletionTokens},
+		})
+		writeEvent(w, "message_stop", map[string]string{"type": "message_stop"})
+		return
+	}
+
+	content := []map[string]interface{}{{"type": "text", "text": reply}}
+	stopReason := "end_turn"
+	if tools, _ := body["tools"].([]interface{}); len(tools) > 0 {
+		tool, _ := tools[0].(map[string]interface{})
+		content = []map[string]interface{}{{
+			"type":  "tool_use",
+			"id":    "toolu_fake",
+			"name":  tool["name"],
+			"input": json.RawMessage(arguments),
+		}}
+		stopReason = "tool_use"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":          "msg_fake",
+		"type":        "message",
+		"role":        "assistant",
+		"model":       body["model"],
+		"content":     content,
+		"stop_reason": stopReason,
+		"usage":       map[string]int{"input_tokens": PromptTokens, "output_tokens": CompletionTokens},
+	})
+}
+
+// splitReply splits the reply into word deltas, keeping the spaces
+func splitReply(reply string) []string {
+	words := strings.SplitAfter(reply, " ")
+	deltas := make([]string, 0, len(words))
+	for _, word := range words {
+		if word != "" {
+			deltas = append(deltas, word)
+		}
+	}
+	return deltas
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	payload, _ := json.Marshal(data)
+	if event != "" {
+		_, _ = fmt.Fprintf(w, "event: %s\n", event)
+	}
+	_, _ = fmt.Fprintf(w, "data: %s\n\n", payload)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, errorType, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"type": errorType, "message": message},
+	})
+}
+
+func writeAnthropicError(w http.ResponseWriter, status int, errorType, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"type":  "error",
+		"error": map[string]string{"type": errorType, "message": message},
+	})
+}
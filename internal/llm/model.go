@@ -0,0 +1,177 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package llm provides a provider-neutral chat model interface with implementations
+// for OpenAI, Azure OpenAI, the Anthropic Messages API and OpenAI-compatible
+// endpoints such as vLLM and Ollama.
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Supported chat model provider types
+const (
+	ProviderOpenAI           = "openai"
+	ProviderAzure            = "azure"
+	ProviderAnthropic        = "anthropic"
+	ProviderOpenAICompatible = "openai_compatible"
+)
+
+// Chat message roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Finish reasons reported in ChatResponse. Providers with their own stop reasons are
+// mapped onto these.
+const (
+	FinishReasonStop         = "stop"
+	FinishReasonLength       = "length"
+	FinishReasonFunctionCall = "tool_calls"
+)
+
+const (
+	// defaultHTTPTimeout bounds a single provider request when no HTTP client is given
+	defaultHTTPTimeout = 5 * time.Minute
+	// maxErrorBodyBytes limits how much of an error response is included in errors
+	maxErrorBodyBytes = 512
+)
+
+// ErrUnknownProvider is returned when the configured provider type is not supported
+var ErrUnknownProvider = errors.New("unknown chat model provider")
+
+// Message is a single chat message
+type Message struct {
+	Role    string
+	Content string
+}
+
+// Function describes a function the model must answer by calling
+type Function struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the function arguments
+	Parameters json.RawMessage
+}
+
+// ChatRequest is a provider-neutral chat completion request
+type ChatRequest struct {
+	Model       string
+	Messages    []Message
+	MaxTokens   int
+	Temperature float32
+	// Function, when set, requires the model to answer by calling it. The call's JSON
+	// arguments are returned in ChatResponse.FunctionArguments.
+	Function *Function
+}
+
+// Usage reports the tokens used by a chat completion
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// ChatResponse is a provider-neutral chat completion response
+type ChatResponse struct {
+	Content      string
+	FinishReason string
+	Usage        Usage
+	// FunctionArguments holds the arguments of the call to the requested Function
+	FunctionArguments string
+}
+
+// DeltaFunc receives each content delta of a streamed chat completion. Returning an
+// error stops the stream.
+type DeltaFunc func(delta string) error
+
+// ChatModel generates chat completions with a single provider
+type ChatModel interface {
+	// Provider returns the provider type used in logs and responses
+	Provider() string
+	// CreateChatCompletion returns the complete response to the request
+	CreateChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+	// CreateChatCompletionStream passes each content delta to onDelta as it arrives and
+	// returns the assembled response when the stream ends. Function calling is not
+	// supported when streaming.
+	CreateChatCompletionStream(ctx context.Context, req ChatRequest, onDelta DeltaFunc) (*ChatResponse, error)
+}
+
+// ProviderConfig configures a chat model provider
+type ProviderConfig struct {
+	// Provider is one of the supported provider types
+	Provider string
+	APIKey   string
+	// Endpoint overrides the provider's default API base URL. Required for Azure OpenAI
+	// and OpenAI-compatible endpoints.
+	Endpoint string
+	// APIVersion is the Azure OpenAI api-version or the anthropic-version header
+	APIVersion string
+	// Deployments maps model names to Azure OpenAI deployment names. Models without an
+	// entry are used as the deployment name.
+	Deployments map[string]string
+}
+
+// APIError is returned when a provider responds with an error status
+type APIError struct {
+	Provider   string
+	StatusCode int
+	// Type is the provider's error type, e.g. rate_limit_exceeded
+	Type    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Type != "" {
+		return fmt.Sprintf("%s API error (status %d, %s): %s", e.Provider, e.StatusCode, e.Type, e.Message)
+	}
+	return fmt.Sprintf("%s API error (status %d): %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// NewChatModel creates the chat model provider named in cfg
+func NewChatModel(cfg ProviderConfig, httpClient *http.Client) (ChatModel, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(cfg.Provider)) {
+	case ProviderOpenAI:
+		return newOpenAIModel(cfg, httpClient)
+	case ProviderAzure:
+		return newAzureModel(cfg, httpClient)
+	case ProviderOpenAICompatible:
+		return newOpenAICompatibleModel(cfg, httpClient)
+	case ProviderAnthropic:
+		return newAnthropicModel(cfg, httpClient)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, cfg.Provider)
+	}
+}
+
+// endpointOrDefault returns the configured endpoint without a trailing slash, or the default
+func endpointOrDefault(endpoint, defaultEndpoint string) string {
+	if endpoint = strings.TrimSpace(endpoint); endpoint == "" {
+		return defaultEndpoint
+	}
+	return strings.TrimRight(endpoint, "/")
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/your-org/ai-sa-assistant/internal/llm/llmtest"
+)
+
+func fakeProviderConfigs(server *llmtest.Server) map[string]ProviderConfig {
+	return map[string]ProviderConfig{
+		ProviderOpenAI: {Provider: ProviderOpenAI, APIKey: llmtest.APIKey, Endpoint: server.URL(llmtest.PathOpenAI)},
+		ProviderAzure: {Provider: ProviderAzure, APIKey: llmtest.APIKey, Endpoint: server.URL(llmtest.PathAzure),
+			APIVersion: llmtest.AzureAPIVersion, Deployments: map[string]string{"gpt-4o": "prod-gpt4o"}},
+		ProviderAnthropic: {Provider: ProviderAnthropic, APIKey: llmtest.APIKey, Endpoint: server.URL(llmtest.PathAnthropic)},
+		ProviderOpenAICompatible: {Provider: ProviderOpenAICompatible, APIKey: llmtest.APIKey,
+			Endpoint: server.URL(llmtest.PathLocal)},
+	}
+}
+
+func testChatRequest() ChatRequest {
+	return ChatRequest{
+		Model: "gpt-4o",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "You are a cloud architect."},
+			{Role: RoleUser, Content: "How do I rehost 40 VMs?"},
+		},
+		MaxTokens:   500,
+		Temperature: 0.2,
+	}
+}
+
+func TestChatModelsAgainstFakeServer(t *testing.T) {
+	server := llmtest.NewServer()
+	defer server.Close()
+
+	for name, cfg := range fakeProviderConfigs(server) {
+		t.Run(name, func(t *testing.T) {
+			model, err := NewChatModel(cfg, server.Client())
+			require.NoError(t, err)
+			assert.Equal(t, name, model.Provider())
+
+			resp, err := model.CreateChatCompletion(context.Background(), testChatRequest())
+			require.NoError(t, err)
+			assert.Equal(t, llmtest.DefaultReply, resp.Content)
+			assert.Equal(t, FinishReasonStop, resp.FinishReason)
+			assert.Equal(t, Usage{
+				PromptTokens:     llmtest.PromptTokens,
+				CompletionTokens: llmtest.CompletionTokens,
+				TotalTokens:      llmtest.PromptTokens + llmtest.CompletionTokens,
+			}, resp.Usage)
+		})
+	}
+}
+
+func TestChatModelsCallFunctions(t *testing.T) {
+	server := llmtest.NewServer()
+	defer server.Close()
+
+	req := testChatRequest()
+	req.Function = &Function{
+		Name:        "submit_answer",
+		Description: "Submit the answer",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"answer":{"type":"string"}}}`),
+	}
+
+	for name, cfg := range fakeProviderConfigs(server) {
+		t.Run(name, func(t *testing.T) {
+			model, err := NewChatModel(cfg, server.Client())
+			require.NoError(t, err)
+
+			resp, err := model.CreateChatCompletion(context.Background(), req)
+			require.NoError(t, err)
+			assert.JSONEq(t, llmtest.DefaultFunctionArguments, resp.FunctionArguments)
+			assert.Equal(t, FinishReasonFunctionCall, resp.FinishReason)
+		})
+	}
+}
+
+func TestChatModelsStream(t *testing.T) {
+	server := llmtest.NewServer()
+	defer server.Close()
+
+	for name, cfg := range fakeProviderConfigs(server) {
+		t.Run(name, func(t *testing.T) {
+			model, err := NewChatModel(cfg, server.Client())
+			require.NoError(t, err)
+
+			var deltas []string
+			resp, err := model.CreateChatCompletionStream(context.Background(), testChatRequest(), func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Greater(t, len(deltas), 1)
+			assert.Equal(t, llmtest.DefaultReply, strings.Join(deltas, ""))
+			assert.Equal(t, llmtest.DefaultReply, resp.Content)
+			assert.Equal(t, FinishReasonStop, resp.FinishReason)
+			assert.Equal(t, llmtest.CompletionTokens, resp.Usage.CompletionTokens)
+
+			stopped := errors.New("client went away")
+			_, err = model.CreateChatCompletionStream(context.Background(), testChatRequest(), func(string) error {
+				return stopped
+			})
+			assert.ErrorIs(t, err, stopped)
+		})
+	}
+}
+
+func TestChatModelErrors(t *testing.T) {
+	server := llmtest.NewServer()
+	defer server.Close()
+
+	for name, cfg := range fakeProviderConfigs(server) {
+		t.Run(name, func(t *testing.T) {
+			model, err := NewChatModel(cfg, server.Client())
+			require.NoError(t, err)
+
+			req := testChatRequest()
+			req.Model = llmtest.RateLimitedModel
+			_, err = model.CreateChatCompletion(context.Background(), req)
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+			assert.Equal(t, name, apiErr.Provider)
+
+			cfg.APIKey = "wrong-key" // pragma: allowlist secret
+			model, err = NewChatModel(cfg, server.Client())
+			require.NoError(t, err)
+			_, err = model.CreateChatCompletion(context.Background(), testChatRequest())
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+		})
+	}
+}
+
+func TestChatModelWireFormats(t *testing.T) {
+	server := llmtest.NewServer()
+	defer server.Close()
+	configs := fakeProviderConfigs(server)
+
+	for _, name := range []string{ProviderAzure, ProviderAnthropic} {
+		model, err := NewChatModel(configs[name], server.Client())
+		require.NoError(t, err)
+		req := testChatRequest()
+		req.Messages = append(req.Messages, Message{Role: RoleUser, Content: "Include a runbook."})
+		_, err = model.CreateChatCompletion(context.Background(), req)
+		require.NoError(t, err)
+	}
+
+	requests := server.Requests()
+	require.Len(t, requests, 2)
+
+	azure := requests[0]
+	assert.Equal(t, "prod-gpt4o", azure.Model, "models are mapped to their Azure deployment")
+	assert.Contains(t, azure.Query, "api-version="+llmtest.AzureAPIVersion)
+
+	anthropic := requests[1]
+	assert.Equal(t, "You are a cloud architect.", anthropic.Body["system"])
+	messages, _ := anthropic.Body["messages"].([]interface{})
+	require.Len(t, messages, 1, "consecutive user messages are joined")
+	assert.Equal(t, map[string]interface{}{
+		"role":    RoleUser,
+		"content": "How do I rehost 40 VMs?\n\nInclude a runbook.",
+	}, messages[0])
+	assert.Equal(t, float64(500), anthropic.Body["max_tokens"])
+}
+
+func TestNewChatModelValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ProviderConfig
+		err  string
+	}{
+		{"unknown provider", ProviderConfig{Provider: "bedrock"}, "unknown chat model provider"},
+		{"openai without key", ProviderConfig{Provider: ProviderOpenAI}, "requires an API key"},
+		{"azure without endpoint", ProviderConfig{Provider: ProviderAzure, APIKey: "key"}, "requires the resource endpoint"},
+		{"anthropic without key", ProviderConfig{Provider: ProviderAnthropic}, "requires an API key"},
+		{"compatible without endpoint", ProviderConfig{Provider: ProviderOpenAICompatible}, "requires an endpoint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewChatModel(tt.cfg, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	_, err := NewChatModel(ProviderConfig{Provider: ProviderOpenAICompatible, Endpoint: "http://localhost:11434/v1"}, nil)
+	assert.NoError(t, err, "local endpoints do not need an API key")
+}
@@ -0,0 +1,231 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultOpenAIEndpoint = "https://api.openai.com/v1"
+	// DefaultAzureAPIVersion is the Azure OpenAI api-version used when none is configured
+	DefaultAzureAPIVersion = "2024-06-01"
+)
+
+// openAIModel generates chat completions with the OpenAI chat completions API. The same
+// wire format serves OpenAI, Azure OpenAI deployments and OpenAI-compatible servers.
+type openAIModel struct {
+	provider string
+	client   *openai.Client
+}
+
+// NewOpenAIChatModel wraps an existing go-openai client as a chat model for the given
+// provider type
+func NewOpenAIChatModel(client *openai.Client, provider string) ChatModel {
+	return &openAIModel{provider: provider, client: client}
+}
+
+func newOpenAIModel(cfg ProviderConfig, httpClient *http.Client) (*openAIModel, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("openai provider requires an API key")
+	}
+	config := openai.DefaultConfig(cfg.APIKey)
+	config.BaseURL = endpointOrDefault(cfg.Endpoint, defaultOpenAIEndpoint)
+	config.HTTPClient = httpClient
+	return &openAIModel{provider: ProviderOpenAI, client: openai.NewClientWithConfig(config)}, nil
+}
+
+func newAzureModel(cfg ProviderConfig, httpClient *http.Client) (*openAIModel, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("azure provider requires the resource endpoint")
+	}
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("azure provider requires an API key")
+	}
+	config := openai.DefaultAzureConfig(cfg.APIKey, endpointOrDefault(cfg.Endpoint, ""))
+	if cfg.APIVersion != "" {
+		config.APIVersion = cfg.APIVersion
+	} else {
+		config.APIVersion = DefaultAzureAPIVersion
+	}
+	deployments := make(map[string]string, len(cfg.Deployments))
+	for model, deployment := range cfg.Deployments {
+		deployments[strings.ToLower(model)] = deployment
+	}
+	config.AzureModelMapperFunc = func(model string) string {
+		if deployment, ok := deployments[strings.ToLower(model)]; ok {
+			return deployment
+		}
+		return model
+	}
+	config.HTTPClient = httpClient
+	return &openAIModel{provider: ProviderAzure, client: openai.NewClientWithConfig(config)}, nil
+}
+
+func newOpenAICompatibleModel(cfg ProviderConfig, httpClient *http.Client) (*openAIModel, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("openai_compatible provider requires an endpoint")
+	}
+	// Local servers such as Ollama ignore the key, but the client always sends one
+	config := openai.DefaultConfig(cfg.APIKey)
+	config.BaseURL = endpointOrDefault(cfg.Endpoint, "")
+	config.HTTPClient = httpClient
+	return &openAIModel{provider: ProviderOpenAICompatible, client: openai.NewClientWithConfig(config)}, nil
+}
+
+// Provider returns the provider type
+func (m *openAIModel) Provider() string {
+	return m.provider
+}
+
+// CreateChatCompletion returns the complete response to the request
+func (m *openAIModel) CreateChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	openaiReq := m.buildRequest(req)
+	if req.Function != nil {
+		openaiReq.Tools = []openai.Tool{{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        req.Function.Name,
+				Description: req.Function.Description,
+				Parameters:  req.Function.Parameters,
+			},
+		}}
+		openaiReq.ToolChoice = openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: req.Function.Name},
+		}
+	}
+
+	resp, err := m.client.CreateChatCompletion(ctx, openaiReq)
+	if err != nil {
+		return nil, m.convertError(err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices returned from %s", m.provider)
+	}
+
+	choice := resp.Choices[0]
+	result := &ChatResponse{
+		Content:      choice.Message.Content,
+		FinishReason: string(choice.FinishReason),
+		Usage:        convertOpenAIUsage(resp.Usage),
+	}
+	if req.Function != nil {
+		for _, call := range choice.Message.ToolCalls {
+			if call.Function.Name == req.Function.Name {
+				result.FunctionArguments = call.Function.Arguments
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// CreateChatCompletionStream streams the response, passing each content delta to onDelta
+func (m *openAIModel) CreateChatCompletionStream(ctx context.Context, req ChatRequest, onDelta DeltaFunc) (*ChatResponse, error) {
+	if req.Function != nil {
+		return nil, fmt.Errorf("function calling is not supported for streamed chat completions")
+	}
+	openaiReq := m.buildRequest(req)
+	openaiReq.Stream = true
+	openaiReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := m.client.CreateChatCompletionStream(ctx, openaiReq)
+	if err != nil {
+		return nil, m.convertError(err)
+	}
+	defer func() { _ = stream.Close() }()
+
+	var content strings.Builder
+	result := &ChatResponse{}
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, m.convertError(err)
+		}
+		if chunk.Usage != nil {
+			result.Usage = convertOpenAIUsage(*chunk.Usage)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				result.FinishReason = string(choice.FinishReason)
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return nil, fmt.Errorf("stream consumer stopped: %w", err)
+			}
+		}
+	}
+	result.Content = content.String()
+	return result, nil
+}
+
+// buildRequest converts the request to the OpenAI wire format without a function
+func (m *openAIModel) buildRequest(req ChatRequest) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, message := range req.Messages {
+		messages = append(messages, openai.ChatCompletionMessage{Role: message.Role, Content: message.Content})
+	}
+	return openai.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	}
+}
+
+// convertError converts go-openai status errors to APIError and returns other errors unchanged
+func (m *openAIModel) convertError(err error) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return &APIError{
+			Provider:   m.provider,
+			StatusCode: apiErr.HTTPStatusCode,
+			Type:       apiErr.Type,
+			Message:    apiErr.Message,
+		}
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return &APIError{
+			Provider:   m.provider,
+			StatusCode: requestErr.HTTPStatusCode,
+			Message:    requestErr.Error(),
+		}
+	}
+	return err
+}
+
+// convertOpenAIUsage converts go-openai token usage
+func convertOpenAIUsage(usage openai.Usage) Usage {
+	return Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lru provides a bounded, thread-safe least recently used cache whose
+// entries expire either after a fixed TTL or at a per-entry expiry time.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a bounded, thread-safe LRU cache with expiring entries
+type Cache[V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	items      map[string]*list.Element
+	order      *list.List
+	now        func() time.Time
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// entry is a single cached value with its expiry time
+type entry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+// Stats reports the counters of a cache
+type Stats struct {
+	Entries   int     `json:"entries"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Evictions uint64  `json:"evictions"`
+	HitRate   float64 `json:"hit_rate"`
+}
+
+// New creates a cache holding at most maxEntries values. Values stored with Set
+// expire after ttl; a zero ttl keeps them until they are evicted.
+func New[V any](maxEntries int, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		items:      make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// SetClock replaces the clock used to expire entries
+func (c *Cache[V]) SetClock(now func() time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Get returns the cached value for key, treating expired entries as misses
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	element, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return zero, false
+	}
+
+	item := element.Value.(*entry[V])
+	if !item.expiresAt.IsZero() && !c.now().Before(item.expiresAt) {
+		c.removeElement(element)
+		c.misses++
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits++
+	return item.value, true
+}
+
+// Set stores value under key for the cache TTL
+func (c *Cache[V]) Set(key string, value V) {
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		c.mu.Lock()
+		expiresAt = c.now().Add(c.ttl)
+		c.mu.Unlock()
+	}
+	c.SetWithExpiry(key, value, expiresAt)
+}
+
+// SetWithExpiry stores value under key until expiresAt, evicting the least recently
+// used entries beyond the bound. A zero expiresAt never expires.
+func (c *Cache[V]) SetWithExpiry(key string, value V, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		item := element.Value.(*entry[V])
+		item.value = value
+		item.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[V]{key: key, value: value, expiresAt: expiresAt})
+	for c.order.Len() > c.maxEntries {
+		c.removeElement(c.order.Back())
+		c.evictions++
+	}
+}
+
+// Len returns the number of stored entries, including expired ones not yet removed
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Purge removes every entry while keeping the hit and miss counters
+func (c *Cache[V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *Cache[V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := Stats{
+		Entries:   c.order.Len(),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// removeElement unlinks an element from both the map and the recency list
+func (c *Cache[V]) removeElement(element *list.Element) {
+	item := element.Value.(*entry[V])
+	delete(c.items, item.key)
+	c.order.Remove(element)
+}
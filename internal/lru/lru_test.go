@@ -0,0 +1,78 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheEvictionAndExpiry(t *testing.T) {
+	now := time.Now()
+	cache := New[string](2, time.Minute)
+	cache.SetClock(func() time.Time { return now })
+
+	cache.Set("a", "1")
+	cache.Set("b", "2")
+	_, ok := cache.Get("a") // a becomes most recently used
+	require.True(t, ok)
+
+	cache.Set("c", "3")
+	_, ok = cache.Get("b")
+	assert.False(t, ok, "least recently used entry should be evicted")
+
+	value, ok := cache.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, "3", value)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = cache.Get("a")
+	assert.False(t, ok, "expired entry should be a miss")
+
+	stats := cache.Stats()
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.InDelta(t, 0.5, stats.HitRate, 1e-9)
+
+	cache.Purge()
+	assert.Zero(t, cache.Len())
+}
+
+func TestCachePerEntryExpiry(t *testing.T) {
+	now := time.Now()
+	cache := New[int](10, 0)
+	cache.SetClock(func() time.Time { return now })
+
+	cache.SetWithExpiry("short", 1, now.Add(time.Minute))
+	cache.SetWithExpiry("long", 2, now.Add(time.Hour))
+	cache.Set("forever", 3)
+
+	now = now.Add(30 * time.Minute)
+	_, ok := cache.Get("short")
+	assert.False(t, ok)
+	value, ok := cache.Get("long")
+	assert.True(t, ok)
+	assert.Equal(t, 2, value)
+
+	now = now.Add(24 * time.Hour)
+	_, ok = cache.Get("forever")
+	assert.True(t, ok, "entries without an expiry stay until evicted")
+	assert.Equal(t, 2, cache.Len())
+}
@@ -320,8 +320,8 @@ func TestIntegrationMigration(t *testing.T) {
 		t.Fatalf("Failed to get schema version: %v", err)
 	}
 
-	if version != 1 {
-		t.Errorf("Expected schema version 1, got %d", version)
+	if version != 5 {
+		t.Errorf("Expected schema version 5, got %d", version)
 	}
 
 	// Verify data is still accessible after migration
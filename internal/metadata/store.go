@@ -21,6 +21,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -30,6 +31,7 @@ import (
 	_ "github.com/mattn/go-sqlite3" // SQLite driver for database/sql
 	"go.uber.org/zap"
 
+	"github.com/your-org/ai-sa-assistant/internal/acl"
 	"github.com/your-org/ai-sa-assistant/internal/resilience"
 )
 
@@ -112,13 +114,10 @@ func (s *Store) Close() error {
 	return nil
 }
 
-// initSchema creates the metadata table if it doesn't exist
-func (s *Store) initSchema() error {
-	s.logger.Info("Initializing database schema")
-
-	query := `
-		CREATE TABLE IF NOT EXISTS metadata (
-			doc_id TEXT PRIMARY KEY,
+// metadataTableColumns defines the metadata table. Entries are keyed by namespace and
+// document ID so knowledge bases can reuse document IDs without overwriting each other.
+const metadataTableColumns = `
+			doc_id TEXT NOT NULL,
 			title TEXT NOT NULL,
 			platform TEXT NOT NULL,
 			scenario TEXT NOT NULL,
@@ -128,9 +127,21 @@ func (s *Store) initSchema() error {
 			tags TEXT, -- JSON array stored as text
 			difficulty TEXT,
 			estimated_time TEXT,
+			namespace TEXT NOT NULL DEFAULT '',
+			allowed_groups TEXT NOT NULL DEFAULT '[]', -- JSON array stored as text
+			allowed_users TEXT NOT NULL DEFAULT '[]', -- JSON array stored as text
+			classification TEXT NOT NULL DEFAULT '',
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (namespace, doc_id)
+		`
+
+// initSchema creates the metadata table if it doesn't exist
+func (s *Store) initSchema() error {
+	s.logger.Info("Initializing database schema")
+
+	query := `
+		CREATE TABLE IF NOT EXISTS metadata (` + metadataTableColumns + `);
 
 		CREATE INDEX IF NOT EXISTS idx_platform ON metadata(platform);
 		CREATE INDEX IF NOT EXISTS idx_scenario ON metadata(scenario);
@@ -144,6 +155,25 @@ func (s *Store) initSchema() error {
 		return s.errorHandler.WrapError(err, "creating database schema")
 	}
 
+	// Databases created before knowledge base namespaces and ACLs lack those columns and
+	// key entries by document ID alone
+	if err := addNamespaceColumn(s.db); err != nil {
+		s.logger.Error("Failed to add namespace column", zap.Error(err))
+		return s.errorHandler.WrapError(err, "adding namespace column")
+	}
+	if err := addACLColumns(s.db); err != nil {
+		s.logger.Error("Failed to add access control columns", zap.Error(err))
+		return s.errorHandler.WrapError(err, "adding access control columns")
+	}
+	if err := keyMetadataByNamespace(s.db); err != nil {
+		s.logger.Error("Failed to key metadata by namespace", zap.Error(err))
+		return s.errorHandler.WrapError(err, "keying metadata by namespace")
+	}
+	if err := createCollectionVersionsTable(s.db); err != nil {
+		s.logger.Error("Failed to create collection versions table", zap.Error(err))
+		return s.errorHandler.WrapError(err, "creating collection versions table")
+	}
+
 	s.logger.Info("Database schema initialized successfully")
 	return nil
 }
@@ -188,6 +218,20 @@ type Entry struct {
 	Tags          []string `json:"tags"`
 	Difficulty    string   `json:"difficulty"`
 	EstimatedTime string   `json:"estimated_time"`
+	Namespace     string   `json:"namespace,omitempty"`
+	// Access control: empty allow lists mean any caller with sufficient clearance
+	AllowedGroups  []string `json:"allowed_groups,omitempty"`
+	AllowedUsers   []string `json:"allowed_users,omitempty"`
+	Classification string   `json:"classification,omitempty"`
+}
+
+// ACLPolicy returns the access control policy of the entry
+func (e Entry) ACLPolicy() acl.Policy {
+	return acl.Policy{
+		AllowedUsers:   e.AllowedUsers,
+		AllowedGroups:  e.AllowedGroups,
+		Classification: acl.Classification(e.Classification),
+	}
 }
 
 // Index represents the root structure of metadata.json
@@ -208,14 +252,21 @@ func (s *Store) AddMetadata(entry Entry) error {
 		return fmt.Errorf("failed to marshal tags: %w", err)
 	}
 
+	groupsJSON, usersJSON, err := marshalACLLists(entry)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		INSERT OR REPLACE INTO metadata (
-			doc_id, title, platform, scenario, type, source_url, path, tags, difficulty, estimated_time, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			doc_id, title, platform, scenario, type, source_url, path, tags, difficulty, estimated_time, namespace,
+			allowed_groups, allowed_users, classification, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 	`
 
 	_, err = s.db.Exec(query, entry.DocID, entry.Title, entry.Platform, entry.Scenario, entry.Type,
-		entry.SourceURL, entry.Path, string(tagsJSON), entry.Difficulty, entry.EstimatedTime)
+		entry.SourceURL, entry.Path, string(tagsJSON), entry.Difficulty, entry.EstimatedTime, entry.Namespace,
+		groupsJSON, usersJSON, normalizeClassification(entry.Classification))
 	if err != nil {
 		s.logger.Error("Failed to insert metadata", zap.Error(err), zap.String("doc_id", entry.DocID))
 		return fmt.Errorf("failed to insert metadata: %w", err)
@@ -245,7 +296,15 @@ func validateJSONPath(jsonPath string) error {
 
 // LoadFromJSON loads metadata from a JSON file and populates the database
 func (s *Store) LoadFromJSON(jsonPath string) error {
-	s.logger.Info("Loading metadata from JSON file", zap.String("json_path", jsonPath))
+	return s.LoadFromJSONWithNamespace(jsonPath, "")
+}
+
+// LoadFromJSONWithNamespace loads metadata from a JSON file, storing entries without
+// an explicit namespace under the given knowledge base namespace
+func (s *Store) LoadFromJSONWithNamespace(jsonPath, namespace string) error {
+	s.logger.Info("Loading metadata from JSON file",
+		zap.String("json_path", jsonPath),
+		zap.String("namespace", namespace))
 
 	// Validate JSON path for security
 	if err := validateJSONPath(jsonPath); err != nil {
@@ -284,8 +343,9 @@ func (s *Store) LoadFromJSON(jsonPath string) error {
 	// Prepare statement for bulk insert
 	stmt, err := tx.Prepare(`
 		INSERT OR REPLACE INTO metadata (
-			doc_id, title, platform, scenario, type, source_url, path, tags, difficulty, estimated_time, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			doc_id, title, platform, scenario, type, source_url, path, tags, difficulty, estimated_time, namespace,
+			allowed_groups, allowed_users, classification, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
@@ -298,13 +358,23 @@ func (s *Store) LoadFromJSON(jsonPath string) error {
 
 	// Insert all documents
 	for _, entry := range metadataIndex.Documents {
+		if entry.Namespace == "" {
+			entry.Namespace = namespace
+		}
+
 		tagsJSON, err := json.Marshal(entry.Tags)
 		if err != nil {
 			return fmt.Errorf("failed to marshal tags for %s: %w", entry.DocID, err)
 		}
 
+		groupsJSON, usersJSON, err := marshalACLLists(entry)
+		if err != nil {
+			return err
+		}
+
 		_, err = stmt.Exec(entry.DocID, entry.Title, entry.Platform, entry.Scenario, entry.Type,
-			entry.SourceURL, entry.Path, string(tagsJSON), entry.Difficulty, entry.EstimatedTime)
+			entry.SourceURL, entry.Path, string(tagsJSON), entry.Difficulty, entry.EstimatedTime, entry.Namespace,
+			groupsJSON, usersJSON, normalizeClassification(entry.Classification))
 		if err != nil {
 			s.logger.Error("Failed to insert metadata entry", zap.Error(err), zap.String("doc_id", entry.DocID))
 			return fmt.Errorf("failed to insert metadata for %s: %w", entry.DocID, err)
@@ -337,6 +407,10 @@ type FilterOptions struct {
 	ScenarioIn []string
 	TypeIn     []string
 	AndFilters bool // true for AND, false for OR
+	// Namespace restricts results to a knowledge base namespace regardless of AndFilters
+	Namespace string
+	// Identity, when set, restricts results to documents the caller may access
+	Identity *acl.Identity
 }
 
 // FilterDocuments returns document IDs matching the given filters
@@ -411,13 +485,22 @@ func (s *Store) FilterDocuments(filters FilterOptions) ([]string, error) {
 	}
 
 	// Build query
-	query := "SELECT doc_id FROM metadata"
+	query := "SELECT doc_id, allowed_groups, allowed_users, classification FROM metadata"
 	if len(conditions) > 0 {
 		operator := " AND "
 		if !filters.AndFilters {
 			operator = " OR "
 		}
-		query += " WHERE " + strings.Join(conditions, operator)
+		query += " WHERE (" + strings.Join(conditions, operator) + ")"
+	}
+
+	if filters.Namespace != "" {
+		if len(conditions) > 0 {
+			query += " AND namespace = ?"
+		} else {
+			query += " WHERE namespace = ?"
+		}
+		args = append(args, filters.Namespace)
 	}
 
 	s.logger.Debug("Executing query", zap.String("query", query), zap.Any("args", args))
@@ -435,12 +518,19 @@ func (s *Store) FilterDocuments(filters FilterOptions) ([]string, error) {
 
 	var docIDs []string
 	for rows.Next() {
-		var docID string
-		if err := rows.Scan(&docID); err != nil {
+		var entry Entry
+		var groupsJSON, usersJSON string
+		if err := rows.Scan(&entry.DocID, &groupsJSON, &usersJSON, &entry.Classification); err != nil {
 			s.logger.Error("Failed to scan doc_id", zap.Error(err))
 			return nil, fmt.Errorf("failed to scan doc_id: %w", err)
 		}
-		docIDs = append(docIDs, docID)
+		if filters.Identity != nil {
+			s.unmarshalACLLists(&entry, groupsJSON, usersJSON)
+			if !entry.ACLPolicy().Allows(*filters.Identity) {
+				continue
+			}
+		}
+		docIDs = append(docIDs, entry.DocID)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -456,8 +546,8 @@ func (s *Store) FilterDocuments(filters FilterOptions) ([]string, error) {
 func (s *Store) GetAllMetadata() ([]Entry, error) {
 	s.logger.Debug("Getting all metadata entries")
 
-	query := "SELECT doc_id, title, platform, scenario, type, source_url, path, tags, difficulty, estimated_time " +
-		"FROM metadata"
+	query := "SELECT doc_id, title, platform, scenario, type, source_url, path, tags, difficulty, estimated_time, " +
+		"namespace, allowed_groups, allowed_users, classification FROM metadata"
 
 	rows, err := s.db.Query(query)
 	if err != nil {
@@ -473,9 +563,10 @@ func (s *Store) GetAllMetadata() ([]Entry, error) {
 	var entries []Entry
 	for rows.Next() {
 		var entry Entry
-		var tagsJSON string
+		var tagsJSON, groupsJSON, usersJSON string
 		err := rows.Scan(&entry.DocID, &entry.Title, &entry.Platform, &entry.Scenario, &entry.Type,
-			&entry.SourceURL, &entry.Path, &tagsJSON, &entry.Difficulty, &entry.EstimatedTime)
+			&entry.SourceURL, &entry.Path, &tagsJSON, &entry.Difficulty, &entry.EstimatedTime, &entry.Namespace,
+			&groupsJSON, &usersJSON, &entry.Classification)
 		if err != nil {
 			s.logger.Error("Failed to scan metadata entry", zap.Error(err))
 			return nil, fmt.Errorf("failed to scan metadata entry: %w", err)
@@ -486,6 +577,7 @@ func (s *Store) GetAllMetadata() ([]Entry, error) {
 			s.logger.Warn("Failed to unmarshal tags", zap.Error(err), zap.String("doc_id", entry.DocID))
 			entry.Tags = []string{} // Default to empty array on error
 		}
+		s.unmarshalACLLists(&entry, groupsJSON, usersJSON)
 
 		entries = append(entries, entry)
 	}
@@ -499,19 +591,34 @@ func (s *Store) GetAllMetadata() ([]Entry, error) {
 	return entries, nil
 }
 
-// GetMetadataByDocID returns metadata for a specific document ID
+// GetMetadataByDocID returns metadata for a specific document ID in any namespace. When
+// several knowledge bases use the document ID, the entry with the first namespace is
+// returned; use GetMetadataByDocIDWithNamespace to look up a knowledge base's own entry.
 func (s *Store) GetMetadataByDocID(docID string) (*Entry, error) {
+	return s.getMetadata(docID, "WHERE doc_id = ? ORDER BY namespace LIMIT 1", docID)
+}
+
+// GetMetadataByDocIDWithNamespace returns metadata for a document ID in a knowledge base
+// namespace
+func (s *Store) GetMetadataByDocIDWithNamespace(docID, namespace string) (*Entry, error) {
+	return s.getMetadata(docID, "WHERE namespace = ? AND doc_id = ?", namespace, docID)
+}
+
+// getMetadata returns the metadata entry for a document selected by the where clause, or
+// nil when there is none
+func (s *Store) getMetadata(docID, where string, args ...interface{}) (*Entry, error) {
 	s.logger.Debug("Getting metadata by doc_id", zap.String("doc_id", docID))
 
-	query := "SELECT doc_id, title, platform, scenario, type, source_url, path, tags, difficulty, estimated_time " +
-		"FROM metadata WHERE doc_id = ?"
+	query := "SELECT doc_id, title, platform, scenario, type, source_url, path, tags, difficulty, estimated_time, " +
+		"namespace, allowed_groups, allowed_users, classification FROM metadata " + where
 
-	row := s.db.QueryRow(query, docID)
+	row := s.db.QueryRow(query, args...)
 
 	var entry Entry
-	var tagsJSON string
+	var tagsJSON, groupsJSON, usersJSON string
 	err := row.Scan(&entry.DocID, &entry.Title, &entry.Platform, &entry.Scenario, &entry.Type,
-		&entry.SourceURL, &entry.Path, &tagsJSON, &entry.Difficulty, &entry.EstimatedTime)
+		&entry.SourceURL, &entry.Path, &tagsJSON, &entry.Difficulty, &entry.EstimatedTime, &entry.Namespace,
+		&groupsJSON, &usersJSON, &entry.Classification)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			s.logger.Debug("Document not found", zap.String("doc_id", docID))
@@ -526,6 +633,7 @@ func (s *Store) GetMetadataByDocID(docID string) (*Entry, error) {
 		s.logger.Warn("Failed to unmarshal tags", zap.Error(err), zap.String("doc_id", docID))
 		entry.Tags = []string{} // Default to empty array on error
 	}
+	s.unmarshalACLLists(&entry, groupsJSON, usersJSON)
 
 	s.logger.Debug("Retrieved metadata by doc_id", zap.String("doc_id", docID))
 	return &entry, nil
@@ -657,6 +765,14 @@ func (s *Store) Migrate() error {
 			`)
 			return err
 		},
+		// Migration 2: Add knowledge base namespace column
+		addNamespaceColumn,
+		// Migration 3: Add access control columns
+		addACLColumns,
+		// Migration 4: Add collection versions table
+		createCollectionVersionsTable,
+		// Migration 5: Key metadata by namespace and document ID
+		keyMetadataByNamespace,
 	}
 
 	// Apply migrations
@@ -680,3 +796,242 @@ func (s *Store) Migrate() error {
 
 	return nil
 }
+
+// InaccessibleDocIDs returns the IDs of documents in the namespace that the identity may not
+// access. Only documents with a restrictive policy are considered, keeping the list small
+// enough to pass to the vector store as an exclusion filter.
+func (s *Store) InaccessibleDocIDs(namespace string, identity acl.Identity) ([]string, error) {
+	query := "SELECT doc_id, allowed_groups, allowed_users, classification FROM metadata " +
+		"WHERE (allowed_groups != '[]' OR allowed_users != '[]' OR classification NOT IN ('', ?, ?))"
+	args := []interface{}{string(acl.ClassificationPublic), string(acl.ClassificationInternal)}
+	if namespace != "" {
+		query += " AND namespace = ?"
+		args = append(args, namespace)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		s.logger.Error("Failed to query restricted documents", zap.Error(err))
+		return nil, fmt.Errorf("failed to query restricted documents: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil {
+			s.logger.Debug("Failed to close rows", zap.Error(closeErr))
+		}
+	}()
+
+	var docIDs []string
+	for rows.Next() {
+		var entry Entry
+		var groupsJSON, usersJSON string
+		if err := rows.Scan(&entry.DocID, &groupsJSON, &usersJSON, &entry.Classification); err != nil {
+			return nil, fmt.Errorf("failed to scan restricted document: %w", err)
+		}
+		s.unmarshalACLLists(&entry, groupsJSON, usersJSON)
+		if !entry.ACLPolicy().Allows(identity) {
+			docIDs = append(docIDs, entry.DocID)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating restricted documents: %w", err)
+	}
+
+	return docIDs, nil
+}
+
+// marshalACLLists encodes the allowed groups and users of an entry as JSON arrays
+func marshalACLLists(entry Entry) (string, string, error) {
+	groups := entry.AllowedGroups
+	if groups == nil {
+		groups = []string{}
+	}
+	users := entry.AllowedUsers
+	if users == nil {
+		users = []string{}
+	}
+
+	groupsJSON, err := json.Marshal(groups)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal allowed groups for %s: %w", entry.DocID, err)
+	}
+	usersJSON, err := json.Marshal(users)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal allowed users for %s: %w", entry.DocID, err)
+	}
+	return string(groupsJSON), string(usersJSON), nil
+}
+
+// unmarshalACLLists decodes the allowed groups and users columns into the entry
+func (s *Store) unmarshalACLLists(entry *Entry, groupsJSON, usersJSON string) {
+	if err := json.Unmarshal([]byte(groupsJSON), &entry.AllowedGroups); err != nil {
+		s.logger.Warn("Failed to unmarshal allowed groups", zap.Error(err), zap.String("doc_id", entry.DocID))
+	}
+	if err := json.Unmarshal([]byte(usersJSON), &entry.AllowedUsers); err != nil {
+		s.logger.Warn("Failed to unmarshal allowed users", zap.Error(err), zap.String("doc_id", entry.DocID))
+	}
+	if len(entry.AllowedGroups) == 0 {
+		entry.AllowedGroups = nil
+	}
+	if len(entry.AllowedUsers) == 0 {
+		entry.AllowedUsers = nil
+	}
+}
+
+// normalizeClassification stores known classifications in canonical form and leaves
+// unlabelled documents empty so they follow the default classification
+func normalizeClassification(classification string) string {
+	if classification == "" {
+		return ""
+	}
+	return string(acl.ParseClassification(classification))
+}
+
+// CollectionVersion returns the current version of a vector store collection. The version
+// starts at 0 and is bumped by every ingest run, letting readers detect stale caches.
+func (s *Store) CollectionVersion(collection string) (int64, error) {
+	var version int64
+	err := s.db.QueryRow("SELECT version FROM collection_versions WHERE collection = ?", collection).
+		Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get collection version: %w", err)
+	}
+	return version, nil
+}
+
+// BumpCollectionVersion increments the version of a vector store collection and returns
+// the new version
+func (s *Store) BumpCollectionVersion(collection string) (int64, error) {
+	_, err := s.db.Exec(`
+		INSERT INTO collection_versions (collection, version, updated_at)
+		VALUES (?, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT(collection) DO UPDATE SET
+			version = version + 1,
+			updated_at = CURRENT_TIMESTAMP
+	`, collection)
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump collection version: %w", err)
+	}
+
+	version, err := s.CollectionVersion(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	s.logger.Info("Bumped collection version",
+		zap.String("collection", collection),
+		zap.Int64("version", version))
+	return version, nil
+}
+
+// createCollectionVersionsTable creates the table tracking vector store collection versions
+func createCollectionVersionsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS collection_versions (
+			collection TEXT PRIMARY KEY,
+			version INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	return err
+}
+
+// addNamespaceColumn adds the knowledge base namespace column if it does not exist yet
+func addNamespaceColumn(db *sql.DB) error {
+	if err := addColumnIfMissing(db, "namespace", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_namespace ON metadata(namespace)")
+	return err
+}
+
+// keyMetadataByNamespace rebuilds a metadata table keyed by document ID alone so it is keyed
+// by namespace and document ID. SQLite cannot change a primary key in place, so the rows are
+// copied into a new table.
+func keyMetadataByNamespace(db *sql.DB) error {
+	var namespaceKey int
+	err := db.QueryRow("SELECT pk FROM pragma_table_info('metadata') WHERE name = 'namespace'").Scan(&namespaceKey)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata primary key: %w", err)
+	}
+	if namespaceKey > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const columns = "doc_id, title, platform, scenario, type, source_url, path, tags, difficulty, estimated_time, " +
+		"namespace, allowed_groups, allowed_users, classification, created_at, updated_at"
+	statements := []string{
+		"CREATE TABLE metadata_keyed (" + metadataTableColumns + ")",
+		"INSERT INTO metadata_keyed (" + columns + ") SELECT " + columns + " FROM metadata",
+		"DROP TABLE metadata",
+		"ALTER TABLE metadata_keyed RENAME TO metadata",
+		"CREATE INDEX IF NOT EXISTS idx_platform ON metadata(platform)",
+		"CREATE INDEX IF NOT EXISTS idx_scenario ON metadata(scenario)",
+		"CREATE INDEX IF NOT EXISTS idx_type ON metadata(type)",
+		"CREATE INDEX IF NOT EXISTS idx_difficulty ON metadata(difficulty)",
+		"CREATE INDEX IF NOT EXISTS idx_namespace ON metadata(namespace)",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to rebuild metadata table: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// addACLColumns adds the access control columns if they do not exist yet
+func addACLColumns(db *sql.DB) error {
+	if err := addColumnIfMissing(db, "allowed_groups", "TEXT NOT NULL DEFAULT '[]'"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "allowed_users", "TEXT NOT NULL DEFAULT '[]'"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(db, "classification", "TEXT NOT NULL DEFAULT ''")
+}
+
+// addColumnIfMissing adds a column to the metadata table unless it already exists
+func addColumnIfMissing(db *sql.DB, column, definition string) error {
+	rows, err := db.Query("PRAGMA table_info(metadata)")
+	if err != nil {
+		return fmt.Errorf("failed to read table info: %w", err)
+	}
+
+	exists := false
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if name == column {
+			exists = true
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to close table info rows: %w", err)
+	}
+
+	if exists {
+		return nil
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE metadata ADD COLUMN %s %s", column, definition))
+	return err
+}
@@ -21,6 +21,8 @@ import (
 	"testing"
 
 	"go.uber.org/zap"
+
+	"github.com/your-org/ai-sa-assistant/internal/acl"
 )
 
 func TestNewStore(t *testing.T) {
@@ -663,8 +665,8 @@ func TestMigrate(t *testing.T) {
 		t.Fatalf("Failed to get schema version: %v", err)
 	}
 
-	if version != 1 {
-		t.Errorf("Expected schema version 1, got %d", version)
+	if version != 5 {
+		t.Errorf("Expected schema version 5, got %d", version)
 	}
 
 	// Verify indexes were created
@@ -680,6 +682,292 @@ func TestMigrate(t *testing.T) {
 	}
 }
 
+func TestFilterDocumentsByNamespace(t *testing.T) {
+	logger := zap.NewNop()
+	store, err := NewStore(":memory:", logger)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Logf("Failed to close store: %v", closeErr)
+		}
+	}()
+
+	entries := []Entry{
+		{DocID: "shared-aws.md", Title: "Shared AWS", Platform: "aws", Scenario: "migration", Type: "playbook"},
+		{DocID: "customer-aws.md", Title: "Customer AWS", Platform: "aws", Scenario: "migration", Type: "playbook",
+			Namespace: "customer"},
+		{DocID: "customer-azure.md", Title: "Customer Azure", Platform: "azure", Scenario: "migration",
+			Type: "playbook", Namespace: "customer"},
+	}
+	for _, entry := range entries {
+		if err := store.AddMetadata(entry); err != nil {
+			t.Fatalf("Failed to add metadata: %v", err)
+		}
+	}
+
+	// Namespace is always ANDed, even when other filters are ORed
+	docIDs, err := store.FilterDocuments(FilterOptions{
+		PlatformIn: []string{"aws", "azure"},
+		Namespace:  "customer",
+		AndFilters: false,
+	})
+	if err != nil {
+		t.Fatalf("Failed to filter documents: %v", err)
+	}
+	if len(docIDs) != 2 {
+		t.Errorf("Expected 2 customer documents, got %d: %v", len(docIDs), docIDs)
+	}
+
+	docIDs, err = store.FilterDocuments(FilterOptions{Namespace: "customer", Platform: "aws", AndFilters: true})
+	if err != nil {
+		t.Fatalf("Failed to filter documents: %v", err)
+	}
+	if len(docIDs) != 1 || docIDs[0] != "customer-aws.md" {
+		t.Errorf("Expected only customer-aws.md, got %v", docIDs)
+	}
+
+	retrieved, err := store.GetMetadataByDocID("customer-aws.md")
+	if err != nil || retrieved == nil {
+		t.Fatalf("Failed to retrieve metadata: %v", err)
+	}
+	if retrieved.Namespace != "customer" {
+		t.Errorf("Expected namespace 'customer', got '%s'", retrieved.Namespace)
+	}
+}
+
+func TestLoadFromJSONWithNamespace(t *testing.T) {
+	logger := zap.NewNop()
+	store, err := NewStore(":memory:", logger)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Logf("Failed to close store: %v", closeErr)
+		}
+	}()
+
+	index := Index{
+		SchemaVersion: "1.0",
+		Documents: []Entry{
+			{DocID: "team-runbook.md", Title: "Team Runbook", Platform: "aws", Scenario: "dr", Type: "runbook"},
+			{DocID: "pinned.md", Title: "Pinned", Platform: "aws", Scenario: "dr", Type: "runbook",
+				Namespace: "shared"},
+		},
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatalf("Failed to marshal index: %v", err)
+	}
+	jsonPath := filepath.Join(t.TempDir(), "metadata.json")
+	if err := os.WriteFile(jsonPath, data, 0600); err != nil {
+		t.Fatalf("Failed to write metadata file: %v", err)
+	}
+
+	if err := store.LoadFromJSONWithNamespace(jsonPath, "team"); err != nil {
+		t.Fatalf("Failed to load metadata: %v", err)
+	}
+
+	docIDs, err := store.FilterDocuments(FilterOptions{Namespace: "team"})
+	if err != nil {
+		t.Fatalf("Failed to filter documents: %v", err)
+	}
+	if len(docIDs) != 1 || docIDs[0] != "team-runbook.md" {
+		t.Errorf("Expected only team-runbook.md in team namespace, got %v", docIDs)
+	}
+}
+
+func TestAddNamespaceColumnToLegacySchema(t *testing.T) {
+	logger := zap.NewNop()
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	store, err := NewStore(dbPath, logger)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	// Recreate the table without the namespace column to simulate a pre-namespace database
+	if _, err := store.db.Exec(`DROP TABLE metadata;
+		CREATE TABLE metadata (
+			doc_id TEXT PRIMARY KEY, title TEXT NOT NULL, platform TEXT NOT NULL, scenario TEXT NOT NULL,
+			type TEXT NOT NULL, source_url TEXT, path TEXT, tags TEXT, difficulty TEXT, estimated_time TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO metadata (doc_id, title, platform, scenario, type, source_url, path, tags, difficulty, estimated_time)
+		VALUES ('doc.md', 'Legacy Doc', 'aws', 'migration', 'playbook', '', '', '[]', '', '')`); err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+
+	store, err = NewStore(dbPath, logger)
+	if err != nil {
+		t.Fatalf("Failed to reopen legacy store: %v", err)
+	}
+	defer func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Logf("Failed to close store: %v", closeErr)
+		}
+	}()
+
+	if err := store.AddMetadata(Entry{DocID: "doc.md", Title: "Doc", Platform: "aws", Scenario: "migration",
+		Type: "playbook", Namespace: "team"}); err != nil {
+		t.Fatalf("Failed to add metadata after upgrade: %v", err)
+	}
+
+	// The upgraded table is keyed by namespace and document ID, so the legacy entry survives
+	legacy, err := store.GetMetadataByDocIDWithNamespace("doc.md", "")
+	if err != nil || legacy == nil {
+		t.Fatalf("Expected the legacy entry to survive the upgrade, got %v, %v", legacy, err)
+	}
+	if legacy.Title != "Legacy Doc" {
+		t.Errorf("Expected legacy title, got %q", legacy.Title)
+	}
+	team, err := store.GetMetadataByDocIDWithNamespace("doc.md", "team")
+	if err != nil || team == nil || team.Title != "Doc" {
+		t.Errorf("Expected the team entry, got %v, %v", team, err)
+	}
+}
+
+func TestNamespacesKeepTheirOwnMetadata(t *testing.T) {
+	logger := zap.NewNop()
+	store, err := NewStore(":memory:", logger)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Logf("Failed to close store: %v", closeErr)
+		}
+	}()
+
+	if err := store.AddMetadata(Entry{DocID: "runbook.md", Title: "Shared Runbook", Platform: "aws",
+		Scenario: "dr", Type: "runbook"}); err != nil {
+		t.Fatalf("Failed to add metadata: %v", err)
+	}
+
+	index := Index{
+		SchemaVersion: "1.0",
+		Documents: []Entry{
+			{DocID: "runbook.md", Title: "Customer Runbook", Platform: "azure", Scenario: "dr", Type: "runbook",
+				AllowedGroups: []string{"acme-account-team"}},
+		},
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatalf("Failed to marshal index: %v", err)
+	}
+	jsonPath := filepath.Join(t.TempDir(), "metadata.json")
+	if err := os.WriteFile(jsonPath, data, 0600); err != nil {
+		t.Fatalf("Failed to write metadata file: %v", err)
+	}
+	if err := store.LoadFromJSONWithNamespace(jsonPath, "customer"); err != nil {
+		t.Fatalf("Failed to load metadata: %v", err)
+	}
+
+	shared, err := store.GetMetadataByDocIDWithNamespace("runbook.md", "")
+	if err != nil || shared == nil {
+		t.Fatalf("Expected the shared entry, got %v, %v", shared, err)
+	}
+	if shared.Title != "Shared Runbook" || len(shared.AllowedGroups) != 0 {
+		t.Errorf("Shared entry was overwritten by the customer knowledge base: %+v", shared)
+	}
+
+	customer, err := store.GetMetadataByDocIDWithNamespace("runbook.md", "customer")
+	if err != nil || customer == nil {
+		t.Fatalf("Expected the customer entry, got %v, %v", customer, err)
+	}
+	if customer.Title != "Customer Runbook" || customer.Platform != "azure" {
+		t.Errorf("Unexpected customer entry: %+v", customer)
+	}
+
+	all, err := store.GetAllMetadata()
+	if err != nil {
+		t.Fatalf("Failed to get all metadata: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(all))
+	}
+
+	missing, err := store.GetMetadataByDocIDWithNamespace("runbook.md", "other")
+	if err != nil || missing != nil {
+		t.Errorf("Expected no entry in another namespace, got %v, %v", missing, err)
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	logger := zap.NewNop()
+	store, err := NewStore(":memory:", logger)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Logf("Failed to close store: %v", closeErr)
+		}
+	}()
+
+	entries := []Entry{
+		{DocID: "playbook.md", Title: "Migration Playbook", Platform: "aws", Scenario: "migration", Type: "playbook"},
+		{DocID: "acme-sow.md", Title: "ACME SOW", Platform: "aws", Scenario: "migration", Type: "sow",
+			AllowedGroups: []string{"acme-account-team"}, Classification: "Confidential"},
+		{DocID: "board-deck.md", Title: "Board Deck", Platform: "aws", Scenario: "migration", Type: "deck",
+			AllowedUsers: []string{"ceo@example.com"}, Classification: "restricted"},
+	}
+	for _, entry := range entries {
+		if err := store.AddMetadata(entry); err != nil {
+			t.Fatalf("Failed to add metadata: %v", err)
+		}
+	}
+
+	retrieved, err := store.GetMetadataByDocID("acme-sow.md")
+	if err != nil || retrieved == nil {
+		t.Fatalf("Failed to retrieve metadata: %v", err)
+	}
+	if retrieved.Classification != "confidential" || len(retrieved.AllowedGroups) != 1 {
+		t.Errorf("Expected normalized ACL fields, got classification=%q groups=%v",
+			retrieved.Classification, retrieved.AllowedGroups)
+	}
+
+	accountTeam := acl.Identity{UserID: "alice@example.com", Groups: []string{"acme-account-team"},
+		Clearance: acl.ClassificationConfidential}
+	anonymous := acl.Identity{}
+
+	docIDs, err := store.FilterDocuments(FilterOptions{Platform: "aws", AndFilters: true, Identity: &accountTeam})
+	if err != nil {
+		t.Fatalf("Failed to filter documents: %v", err)
+	}
+	if len(docIDs) != 2 {
+		t.Errorf("Expected account team to see 2 documents, got %v", docIDs)
+	}
+
+	docIDs, err = store.FilterDocuments(FilterOptions{Platform: "aws", AndFilters: true, Identity: &anonymous})
+	if err != nil {
+		t.Fatalf("Failed to filter documents: %v", err)
+	}
+	if len(docIDs) != 1 || docIDs[0] != "playbook.md" {
+		t.Errorf("Expected anonymous caller to see only playbook.md, got %v", docIDs)
+	}
+
+	denied, err := store.InaccessibleDocIDs("", accountTeam)
+	if err != nil {
+		t.Fatalf("Failed to list inaccessible documents: %v", err)
+	}
+	if len(denied) != 1 || denied[0] != "board-deck.md" {
+		t.Errorf("Expected only board-deck.md to be denied, got %v", denied)
+	}
+
+	denied, err = store.InaccessibleDocIDs("", anonymous)
+	if err != nil {
+		t.Fatalf("Failed to list inaccessible documents: %v", err)
+	}
+	if len(denied) != 2 {
+		t.Errorf("Expected 2 denied documents for anonymous caller, got %v", denied)
+	}
+}
+
 func TestEmptyFilters(t *testing.T) {
 	logger := zap.NewNop()
 	store, err := NewStore(":memory:", logger)
@@ -803,3 +1091,42 @@ func TestCloseStore(t *testing.T) {
 		t.Error("Expected error when adding metadata to closed store")
 	}
 }
+
+func TestCollectionVersion(t *testing.T) {
+	logger := zap.NewNop()
+	store, err := NewStore(":memory:", logger)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Logf("Failed to close store: %v", closeErr)
+		}
+	}()
+
+	version, err := store.CollectionVersion("cloud_assistant")
+	if err != nil {
+		t.Fatalf("Failed to get collection version: %v", err)
+	}
+	if version != 0 {
+		t.Errorf("Expected unknown collection to have version 0, got %d", version)
+	}
+
+	for expected := int64(1); expected <= 2; expected++ {
+		version, err = store.BumpCollectionVersion("cloud_assistant")
+		if err != nil {
+			t.Fatalf("Failed to bump collection version: %v", err)
+		}
+		if version != expected {
+			t.Errorf("Expected version %d after bump, got %d", expected, version)
+		}
+	}
+
+	otherVersion, err := store.CollectionVersion("customer_docs")
+	if err != nil {
+		t.Fatalf("Failed to get collection version: %v", err)
+	}
+	if otherVersion != 0 {
+		t.Errorf("Expected other collections to be unaffected, got version %d", otherVersion)
+	}
+}
@@ -14,11 +14,15 @@
 
 // Package openai provides a client wrapper for OpenAI API interactions.
 // It handles embedding generation, chat completions, and includes retry logic
-// with exponential backoff for robust API communication.
+// with exponential backoff for robust API communication. Chat completions are
+// served by an llm.ChatModel, so the same client can use Azure OpenAI, Anthropic
+// or an OpenAI-compatible endpoint instead.
 package openai
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -29,6 +33,7 @@ import (
 	"github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 
+	"github.com/your-org/ai-sa-assistant/internal/llm"
 	"github.com/your-org/ai-sa-assistant/internal/resilience"
 )
 
@@ -49,11 +54,15 @@ const (
 	CostCalculationDivisor = 1000.0
 	// QueryPreviewLength defines the length for query preview truncation
 	QueryPreviewLength = 100
+	// statusOverloaded is the status Anthropic returns when its API is overloaded
+	statusOverloaded = 529
 )
 
 // Client wraps the go-openai client with enhanced functionality
 type Client struct {
+	// client serves embeddings; it is nil for chat-only clients
 	client         *openai.Client
+	chat           llm.ChatModel
 	logger         *zap.Logger
 	model          string
 	circuitBreaker *resilience.CircuitBreaker
@@ -93,6 +102,16 @@ func NewClient(apiKey string, logger *zap.Logger) (*Client, error) {
 
 // NewClientWithTimeout creates a new OpenAI client with custom timeout configuration
 func NewClientWithTimeout(apiKey string, logger *zap.Logger, timeoutConfig resilience.TimeoutConfig) (*Client, error) {
+	return NewClientWithEndpoint(apiKey, "", logger, timeoutConfig)
+}
+
+// NewClientWithEndpoint creates a new OpenAI client that sends requests to endpoint, the
+// API base URL such as https://api.openai.com/v1. An empty endpoint uses the OpenAI API.
+func NewClientWithEndpoint(
+	apiKey, endpoint string,
+	logger *zap.Logger,
+	timeoutConfig resilience.TimeoutConfig,
+) (*Client, error) {
 	if apiKey == "" {
 		return nil, resilience.NewBadRequestError("API key is required", nil)
 	}
@@ -122,8 +141,14 @@ func NewClientWithTimeout(apiKey string, logger *zap.Logger, timeoutConfig resil
 	errorHandler := resilience.NewErrorHandler(logger)
 	timeoutManager := resilience.NewTimeoutManager(timeoutConfig)
 
+	clientConfig := openai.DefaultConfig(apiKey)
+	if endpoint != "" {
+		clientConfig.BaseURL = strings.TrimRight(endpoint, "/")
+	}
+	openaiClient := openai.NewClientWithConfig(clientConfig)
 	client := &Client{
-		client:         openai.NewClient(apiKey),
+		client:         openaiClient,
+		chat:           llm.NewOpenAIChatModel(openaiClient, llm.ProviderOpenAI),
 		logger:         logger,
 		model:          EmbeddingModel,
 		circuitBreaker: circuitBreaker,
@@ -177,8 +202,10 @@ func NewClientWithConfig(config openai.ClientConfig, logger *zap.Logger) *Client
 	errorHandler := resilience.NewErrorHandler(logger)
 	timeoutManager := resilience.NewTimeoutManager(resilience.DefaultTimeoutConfig())
 
+	openaiClient := openai.NewClientWithConfig(config)
 	client := &Client{
-		client:         openai.NewClientWithConfig(config),
+		client:         openaiClient,
+		chat:           llm.NewOpenAIChatModel(openaiClient, llm.ProviderOpenAI),
 		logger:         logger,
 		model:          EmbeddingModel,
 		circuitBreaker: circuitBreaker,
@@ -194,6 +221,47 @@ func NewClientWithConfig(config openai.ClientConfig, logger *zap.Logger) *Client
 	return client
 }
 
+// NewChatClient creates a client whose chat completions are served by the given chat
+// model, with the same circuit breaker, timeouts and retries as OpenAI chat completions.
+// The client has no embeddings; EmbedTexts and the embedding health check fail.
+func NewChatClient(model llm.ChatModel, logger *zap.Logger, timeoutConfig resilience.TimeoutConfig) *Client {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	cbConfig := resilience.DefaultCircuitBreakerConfig(model.Provider())
+	cbConfig.MaxFailures = 8
+	cbConfig.ResetTimeout = 45 * time.Second
+	cbConfig.HalfOpenMaxRequests = 2
+
+	client := &Client{
+		chat:           model,
+		logger:         logger,
+		model:          EmbeddingModel,
+		circuitBreaker: resilience.NewCircuitBreaker(cbConfig, logger),
+		errorHandler:   resilience.NewErrorHandler(logger),
+		timeoutManager: resilience.NewTimeoutManager(timeoutConfig),
+	}
+
+	logger.Info("Chat client initialized successfully",
+		zap.String("provider", model.Provider()),
+		zap.Duration("default_timeout", timeoutConfig.DefaultTimeout),
+		zap.Duration("max_timeout", timeoutConfig.MaxTimeout),
+	)
+
+	return client
+}
+
+// ChatProvider returns the provider type serving chat completions
+func (c *Client) ChatProvider() string {
+	return c.chat.Provider()
+}
+
+// SupportsEmbeddings reports whether the client can generate embeddings
+func (c *Client) SupportsEmbeddings() bool {
+	return c.client != nil
+}
+
 // validateConnection validates the OpenAI API connection
 func (c *Client) validateConnection() error {
 	ctx, cancel := context.WithTimeout(context.Background(), ValidationTimeout)
@@ -216,6 +284,9 @@ func (c *Client) EmbedTexts(ctx context.Context, texts []string) (*EmbeddingResp
 			Usage:      EmbeddingUsage{},
 		}, nil
 	}
+	if c.client == nil {
+		return nil, fmt.Errorf("embeddings are not available from the %s chat provider", c.chat.Provider())
+	}
 
 	c.logger.Debug("Starting batch embedding generation",
 		zap.Int("text_count", len(texts)),
@@ -358,51 +429,65 @@ func (c *Client) createEmbeddings(ctx context.Context, texts []string) ([][]floa
 	return embeddings, resp.Usage, nil
 }
 
-// handleAPIError handles OpenAI API errors and determines if they are retryable
+// handleAPIError handles OpenAI and chat provider API errors and determines if they are retryable
 func (c *Client) handleAPIError(err error) error {
-	if apiErr, ok := err.(*openai.APIError); ok {
-		switch apiErr.HTTPStatusCode {
-		case http.StatusUnauthorized:
-			return resilience.NewUnauthorizedError("invalid API key or unauthorized access", err)
-		case http.StatusTooManyRequests:
-			// Enhanced rate limit handling with retry-after detection
-			retryAfter := time.Duration(0)
-			if apiErr.Type == "rate_limit_exceeded" {
-				c.logger.Warn("OpenAI API rate limit exceeded",
-					zap.String("error_type", apiErr.Type),
-					zap.Any("error_code", apiErr.Code),
-					zap.String("message", apiErr.Message),
-				)
+	service := "OpenAI"
+	var statusCode int
+	var errorType, message string
+	var apiErr *openai.APIError
+	var providerErr *llm.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		statusCode, errorType, message = apiErr.HTTPStatusCode, apiErr.Type, apiErr.Message
+	case errors.As(err, &providerErr):
+		statusCode, errorType, message = providerErr.StatusCode, providerErr.Type, providerErr.Message
+		if providerErr.Provider != llm.ProviderOpenAI {
+			service = providerErr.Provider
+		}
+	default:
+		return resilience.NewInternalError(service+" client error", err)
+	}
+
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return resilience.NewUnauthorizedError("invalid API key or unauthorized access", err)
+	case http.StatusTooManyRequests:
+		// Enhanced rate limit handling with retry-after detection
+		retryAfter := time.Duration(0)
+		if errorType == "rate_limit_exceeded" || errorType == "rate_limit_error" {
+			c.logger.Warn("Chat API rate limit exceeded",
+				zap.String("service", service),
+				zap.String("error_type", errorType),
+				zap.String("message", message),
+			)
 
-				// Extract retry-after if available (OpenAI sometimes provides this)
-				if apiErr.Message != "" && strings.Contains(apiErr.Message, "retry after") {
-					// Try to parse retry-after from message
-					if retrySeconds := parseRetryAfterFromMessage(apiErr.Message); retrySeconds > 0 {
-						retryAfter = time.Duration(retrySeconds) * time.Second
-					}
+			// Extract retry-after if available (OpenAI sometimes provides this)
+			if message != "" && strings.Contains(message, "retry after") {
+				// Try to parse retry-after from message
+				if retrySeconds := parseRetryAfterFromMessage(message); retrySeconds > 0 {
+					retryAfter = time.Duration(retrySeconds) * time.Second
 				}
 			}
+		}
 
-			rateLimitErr := resilience.NewTooManyRequestsError("rate limit exceeded", err)
-			if retryAfter > 0 {
-				c.logger.Info("Rate limit retry-after detected",
-					zap.Duration("retry_after", retryAfter),
-				)
-			}
-			return rateLimitErr
-		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
-			return resilience.NewServiceUnavailableError("OpenAI service temporarily unavailable", err)
-		case http.StatusBadRequest:
-			return resilience.NewBadRequestError(fmt.Sprintf("invalid request: %s", apiErr.Message), err)
-		default:
-			return resilience.NewInternalError(
-				fmt.Sprintf("OpenAI API error (status %d): %s", apiErr.HTTPStatusCode, apiErr.Message),
-				err,
+		rateLimitErr := resilience.NewTooManyRequestsError("rate limit exceeded", err)
+		if retryAfter > 0 {
+			c.logger.Info("Rate limit retry-after detected",
+				zap.Duration("retry_after", retryAfter),
 			)
 		}
+		return rateLimitErr
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+		statusOverloaded:
+		return resilience.NewServiceUnavailableError(service+" service temporarily unavailable", err)
+	case http.StatusBadRequest:
+		return resilience.NewBadRequestError(fmt.Sprintf("invalid request: %s", message), err)
+	default:
+		return resilience.NewInternalError(
+			fmt.Sprintf("%s API error (status %d): %s", service, statusCode, message),
+			err,
+		)
 	}
-
-	return resilience.NewInternalError("OpenAI client error", err)
 }
 
 // validateEmbeddingDimensions validates that embeddings have the expected dimensions
@@ -507,6 +592,9 @@ type ChatCompletionRequest struct {
 	MaxTokens   int
 	Temperature float32
 	Model       string
+	// Function, when set, requires the model to answer by calling it. The call's JSON
+	// arguments are returned in ChatCompletionResponse.FunctionArguments.
+	Function *openai.FunctionDefinition
 }
 
 // ChatCompletionResponse represents the response from a chat completion
@@ -514,6 +602,8 @@ type ChatCompletionResponse struct {
 	Content      string
 	FinishReason string
 	Usage        openai.Usage
+	// FunctionArguments holds the arguments of the call to the requested Function
+	FunctionArguments string
 }
 
 // CreateChatCompletion creates a chat completion with retry logic
@@ -528,14 +618,13 @@ func (c *Client) CreateChatCompletionWithRetry(ctx context.Context, req ChatComp
 		req.Model = c.model
 	}
 
-	openaiReq := openai.ChatCompletionRequest{
-		Model:       req.Model,
-		Messages:    req.Messages,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
+	chatReq, err := toChatRequest(req)
+	if err != nil {
+		return nil, resilience.NewBadRequestError("invalid function definition", err)
 	}
 
 	c.logger.Debug("Creating chat completion",
+		zap.String("provider", c.chat.Provider()),
 		zap.String("model", req.Model),
 		zap.Int("max_tokens", req.MaxTokens),
 		zap.Float64("temperature", float64(req.Temperature)),
@@ -548,11 +637,11 @@ func (c *Client) CreateChatCompletionWithRetry(ctx context.Context, req ChatComp
 	var resp *ChatCompletionResponse
 
 	// Use circuit breaker and exponential backoff with custom retry configuration
-	err := c.circuitBreaker.Execute(ctx, func(ctx context.Context) error {
+	err = c.circuitBreaker.Execute(ctx, func(ctx context.Context) error {
 		return c.timeoutManager.Execute(ctx, func(ctx context.Context) error {
 			return resilience.WithExponentialBackoff(ctx, c.logger, retryConfig, func(ctx context.Context) error {
 				start := time.Now()
-				openaiResp, err := c.client.CreateChatCompletion(ctx, openaiReq)
+				chatResp, err := c.chat.CreateChatCompletion(ctx, chatReq)
 				duration := time.Since(start)
 
 				if err != nil {
@@ -564,23 +653,15 @@ func (c *Client) CreateChatCompletionWithRetry(ctx context.Context, req ChatComp
 					return c.handleAPIError(err)
 				}
 
-				if len(openaiResp.Choices) == 0 {
-					return resilience.NewInternalError("no choices returned from OpenAI", nil)
-				}
-
 				c.logger.Debug("Chat completion successful",
-					zap.String("finish_reason", string(openaiResp.Choices[0].FinishReason)),
-					zap.Int("prompt_tokens", openaiResp.Usage.PromptTokens),
-					zap.Int("completion_tokens", openaiResp.Usage.CompletionTokens),
-					zap.Int("total_tokens", openaiResp.Usage.TotalTokens),
+					zap.String("finish_reason", chatResp.FinishReason),
+					zap.Int("prompt_tokens", chatResp.Usage.PromptTokens),
+					zap.Int("completion_tokens", chatResp.Usage.CompletionTokens),
+					zap.Int("total_tokens", chatResp.Usage.TotalTokens),
 					zap.Duration("duration", duration),
 				)
 
-				resp = &ChatCompletionResponse{
-					Content:      openaiResp.Choices[0].Message.Content,
-					FinishReason: string(openaiResp.Choices[0].FinishReason),
-					Usage:        openaiResp.Usage,
-				}
+				resp = fromChatResponse(chatResp)
 				return nil
 			})
 		})
@@ -593,6 +674,131 @@ func (c *Client) CreateChatCompletionWithRetry(ctx context.Context, req ChatComp
 	return resp, nil
 }
 
+// ChatCompletionDeltaFunc receives each content delta of a streamed chat completion.
+// Returning an error stops the stream.
+type ChatCompletionDeltaFunc func(delta string) error
+
+// CreateChatCompletionStream streams a chat completion, passing each content delta to
+// onDelta as it arrives, and returns the assembled response when the stream ends.
+// The request is retried with retryConfig until content has been delivered; a failure
+// after that is returned rather than retried so deltas are never repeated. Function
+// calling is not supported when streaming.
+func (c *Client) CreateChatCompletionStream(
+	ctx context.Context,
+	req ChatCompletionRequest,
+	retryConfig resilience.BackoffConfig,
+	onDelta ChatCompletionDeltaFunc,
+) (*ChatCompletionResponse, error) {
+	if req.Function != nil {
+		return nil, fmt.Errorf("function calling is not supported for streamed chat completions")
+	}
+	if req.Model == "" {
+		req.Model = c.model
+	}
+
+	chatReq, err := toChatRequest(req)
+	if err != nil {
+		return nil, resilience.NewBadRequestError("invalid chat request", err)
+	}
+
+	c.logger.Debug("Creating streamed chat completion",
+		zap.String("provider", c.chat.Provider()),
+		zap.String("model", req.Model),
+		zap.Int("max_tokens", req.MaxTokens),
+		zap.Int("message_count", len(req.Messages)),
+	)
+
+	delivered := false
+	streamRetryConfig := retryConfig
+	streamRetryConfig.RetryOnFunc = func(err error) bool {
+		if delivered {
+			return false
+		}
+		if retryConfig.RetryOnFunc != nil {
+			return retryConfig.RetryOnFunc(err)
+		}
+		return resilience.DefaultRetryOnFunc(err)
+	}
+
+	var resp *ChatCompletionResponse
+
+	err = c.circuitBreaker.Execute(ctx, func(ctx context.Context) error {
+		return c.timeoutManager.Execute(ctx, func(ctx context.Context) error {
+			return resilience.WithExponentialBackoff(ctx, c.logger, streamRetryConfig, func(ctx context.Context) error {
+				start := time.Now()
+				chatResp, err := c.chat.CreateChatCompletionStream(ctx, chatReq, func(delta string) error {
+					delivered = true
+					return onDelta(delta)
+				})
+				if err != nil {
+					if delivered {
+						return err
+					}
+					return c.handleAPIError(err)
+				}
+
+				c.logger.Debug("Streamed chat completion successful",
+					zap.String("finish_reason", chatResp.FinishReason),
+					zap.Int("completion_tokens", chatResp.Usage.CompletionTokens),
+					zap.Int("content_length", len(chatResp.Content)),
+					zap.Duration("duration", time.Since(start)),
+				)
+				resp = fromChatResponse(chatResp)
+				return nil
+			})
+		})
+	})
+
+	if err != nil {
+		return nil, c.errorHandler.WrapError(err, "streaming chat completion")
+	}
+
+	return resp, nil
+}
+
+// toChatRequest converts a chat completion request to the provider-neutral format
+func toChatRequest(req ChatCompletionRequest) (llm.ChatRequest, error) {
+	chatReq := llm.ChatRequest{
+		Model:       req.Model,
+		Messages:    make([]llm.Message, 0, len(req.Messages)),
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	}
+	for _, message := range req.Messages {
+		chatReq.Messages = append(chatReq.Messages, llm.Message{Role: message.Role, Content: message.Content})
+	}
+	if req.Function != nil {
+		parameters, ok := req.Function.Parameters.(json.RawMessage)
+		if !ok && req.Function.Parameters != nil {
+			encoded, err := json.Marshal(req.Function.Parameters)
+			if err != nil {
+				return llm.ChatRequest{}, fmt.Errorf("failed to encode parameters of %s: %w", req.Function.Name, err)
+			}
+			parameters = encoded
+		}
+		chatReq.Function = &llm.Function{
+			Name:        req.Function.Name,
+			Description: req.Function.Description,
+			Parameters:  parameters,
+		}
+	}
+	return chatReq, nil
+}
+
+// fromChatResponse converts a provider-neutral chat response
+func fromChatResponse(resp *llm.ChatResponse) *ChatCompletionResponse {
+	return &ChatCompletionResponse{
+		Content:      resp.Content,
+		FinishReason: resp.FinishReason,
+		Usage: openai.Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+		FunctionArguments: resp.FunctionArguments,
+	}
+}
+
 // BuildSystemPrompt creates a system prompt for the assistant
 func BuildSystemPrompt() string {
 	return `You are an expert Cloud Solutions Architect assistant. Your role is to help Solutions Architects ` +
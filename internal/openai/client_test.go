@@ -17,6 +17,7 @@ package openai
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -28,6 +29,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
+
+	"github.com/your-org/ai-sa-assistant/internal/llm"
+	"github.com/your-org/ai-sa-assistant/internal/llm/llmtest"
+	"github.com/your-org/ai-sa-assistant/internal/resilience"
 )
 
 // mockOpenAIServer creates a mock OpenAI server for testing
@@ -604,6 +609,233 @@ func TestCreateChatCompletion(t *testing.T) {
 	}
 }
 
+// TestCreateChatCompletionWithFunction tests that a requested function call is forced and its arguments returned
+func TestCreateChatCompletionWithFunction(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+
+	var received openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"id": "chatcmpl-test",
+			"object": "chat.completion",
+			"model": "gpt-4o",
+			"choices": [{
+				"index": 0,
+				"message": {
+					"role": "assistant",
+					"content": "",
+					"tool_calls": [{
+						"id": "call_1",
+						"type": "function",
+						"function": {"name": "submit_answer", "arguments": "{\"answer\": \"42\"}"}
+					}]
+				},
+				"finish_reason": "stop"
+			}],
+			"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+		}`))
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("sk-test1234567890abcdef") // pragma: allowlist secret
+	config.BaseURL = server.URL + "/v1"
+	c := NewClientWithConfig(config, logger)
+
+	response, err := c.CreateChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Answer"}},
+		Model:    "gpt-4o",
+		Function: &openai.FunctionDefinition{
+			Name:       "submit_answer",
+			Parameters: json.RawMessage(`{"type": "object"}`),
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateChatCompletion failed: %v", err)
+	}
+
+	if response.FunctionArguments != `{"answer": "42"}` {
+		t.Errorf("Expected function arguments, got '%s'", response.FunctionArguments)
+	}
+	if len(received.Tools) != 1 || received.Tools[0].Function.Name != "submit_answer" {
+		t.Errorf("Expected the function to be sent as a tool, got %+v", received.Tools)
+	}
+	choice, ok := received.ToolChoice.(map[string]interface{})
+	if !ok || choice["type"] != "function" {
+		t.Errorf("Expected the function call to be forced, got %v", received.ToolChoice)
+	}
+}
+
+func TestCreateChatCompletionStream(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+
+	var received openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+			`{"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Use "}}]}`,
+			`{"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Amazon EKS."}}]}`,
+			`{"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			`{"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":4,"total_tokens":14}}`,
+		} {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("sk-test1234567890abcdef") // pragma: allowlist secret
+	config.BaseURL = server.URL + "/v1"
+	c := NewClientWithConfig(config, logger)
+
+	var deltas []string
+	response, err := c.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Answer"}},
+		Model:    "gpt-4o",
+	}, resilience.DefaultBackoffConfig(), func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("CreateChatCompletionStream failed: %v", err)
+	}
+
+	if strings.Join(deltas, "|") != "Use |Amazon EKS." {
+		t.Errorf("Expected two content deltas, got %q", deltas)
+	}
+	if response.Content != "Use Amazon EKS." {
+		t.Errorf("Expected assembled content, got '%s'", response.Content)
+	}
+	if response.FinishReason != "stop" || response.Usage.TotalTokens != 14 {
+		t.Errorf("Expected finish reason and usage, got %q and %+v", response.FinishReason, response.Usage)
+	}
+	if !received.Stream || received.StreamOptions == nil || !received.StreamOptions.IncludeUsage {
+		t.Errorf("Expected a streamed request including usage, got stream=%v options=%+v", received.Stream, received.StreamOptions)
+	}
+}
+
+func TestCreateChatCompletionStreamStopsWhenConsumerFails(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n",
+				`{"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"token "}}]}`)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("sk-test1234567890abcdef") // pragma: allowlist secret
+	config.BaseURL = server.URL + "/v1"
+	c := NewClientWithConfig(config, logger)
+
+	calls := 0
+	_, err := c.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Answer"}},
+	}, resilience.DefaultBackoffConfig(), func(string) error {
+		calls++
+		return fmt.Errorf("client disconnected")
+	})
+	if err == nil {
+		t.Fatal("Expected an error when the consumer stops the stream")
+	}
+	if calls != 1 {
+		t.Errorf("Expected the stream to stop after the first delta, got %d calls", calls)
+	}
+}
+
+// TestChatClientWithAnthropicModel tests that chat completions are served by the chat model
+func TestChatClientWithAnthropicModel(t *testing.T) {
+	server := llmtest.NewServer()
+	defer server.Close()
+
+	model, err := llm.NewChatModel(llm.ProviderConfig{
+		Provider: llm.ProviderAnthropic,
+		APIKey:   llmtest.APIKey,
+		Endpoint: server.URL(llmtest.PathAnthropic),
+	}, server.Client())
+	require.NoError(t, err)
+	c := NewChatClient(model, zaptest.NewLogger(t), resilience.DefaultTimeoutConfig())
+
+	if c.ChatProvider() != llm.ProviderAnthropic || c.SupportsEmbeddings() {
+		t.Errorf("Expected a chat-only anthropic client, got provider %q", c.ChatProvider())
+	}
+	if _, err := c.EmbedTexts(context.Background(), []string{"text"}); err == nil {
+		t.Error("Expected embeddings to be unavailable")
+	}
+
+	response, err := c.CreateChatCompletion(context.Background(), ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Answer"}},
+		Model:    "claude-sonnet-4",
+		Function: &openai.FunctionDefinition{
+			Name:       "submit_answer",
+			Parameters: map[string]interface{}{"type": "object"},
+		},
+	})
+	require.NoError(t, err)
+	if response.FunctionArguments != llmtest.DefaultFunctionArguments {
+		t.Errorf("Expected function arguments, got '%s'", response.FunctionArguments)
+	}
+	if response.Usage.TotalTokens != llmtest.PromptTokens+llmtest.CompletionTokens {
+		t.Errorf("Expected usage to be converted, got %+v", response.Usage)
+	}
+
+	retryConfig := resilience.DefaultBackoffConfig()
+	retryConfig.MaxRetries = 0
+	_, err = c.CreateChatCompletionWithRetry(context.Background(), ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Answer"}},
+		Model:    llmtest.RateLimitedModel,
+	}, retryConfig)
+	if !isRateLimitError(err) {
+		t.Errorf("Expected provider rate limits to be reported as rate limit errors, got %v", err)
+	}
+}
+
+// TestCreateChatCompletionStreamRetriesUntilContentIsDelivered tests that failures to open
+// a stream are retried but failures after content has been delivered are not
+func TestCreateChatCompletionStreamRetriesUntilContentIsDelivered(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error": {"type": "server_error", "message": "overloaded"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprintf(w, "data: %s\n\n",
+			`{"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"content":"token "}}]}`)
+		_, _ = fmt.Fprint(w, "data: {not json}\n\n")
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("sk-test1234567890abcdef") // pragma: allowlist secret
+	config.BaseURL = server.URL + "/v1"
+	c := NewClientWithConfig(config, zaptest.NewLogger(t))
+
+	retryConfig := resilience.DefaultBackoffConfig()
+	retryConfig.BaseDelay = time.Millisecond
+	deltas := 0
+	_, err := c.CreateChatCompletionStream(context.Background(), ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Answer"}},
+	}, retryConfig, func(string) error {
+		deltas++
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Expected the broken stream to fail")
+	}
+	if attempts != 2 || deltas != 1 {
+		t.Errorf("Expected one retry and no repeated deltas, got %d attempts and %d deltas", attempts, deltas)
+	}
+}
+
 // TestContextCancellation tests context cancellation handling
 func TestContextCancellation(t *testing.T) {
 	logger := zaptest.NewLogger(t)
@@ -0,0 +1,200 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pricing
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// bundledSnapshots holds the price-list snapshots shipped with the service
+//
+//go:embed data/*.json
+var bundledSnapshots embed.FS
+
+// Price units. Hourly and monthly prices are per resource.
+const (
+	UnitHour    = "hour"
+	UnitMonth   = "month"
+	UnitGBMonth = "GB-month"
+	UnitGB      = "GB"
+)
+
+// Snapshot is a versioned price list of one provider. Versions are ISO dates, such as
+// "2024-06", so the newest version sorts last.
+type Snapshot struct {
+	Provider string `json:"provider"`
+	Version  string `json:"version"`
+	Currency string `json:"currency"`
+	// Source describes where the prices were taken from
+	Source        string `json:"source"`
+	DefaultRegion string `json:"default_region"`
+	SKUs          []SKU  `json:"skus"`
+}
+
+// SKU is a priced product with its price per region
+type SKU struct {
+	Name        string `json:"sku"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Unit        string `json:"unit"`
+	// OS is "windows" for compute SKUs with the license included, empty otherwise
+	OS string `json:"os,omitempty"`
+	// FreeQuantity is the usage per month that is not charged
+	FreeQuantity float64            `json:"free_quantity,omitempty"`
+	Prices       map[string]float64 `json:"prices"`
+}
+
+// sku returns the SKU of a kind, picking the Windows variant of compute when asked for
+func (s *Snapshot) sku(kind string, windows bool) (SKU, bool) {
+	var fallback *SKU
+	for i, sku := range s.SKUs {
+		if sku.Kind != kind {
+			continue
+		}
+		if (sku.OS == "windows") == windows {
+			return sku, true
+		}
+		if fallback == nil {
+			fallback = &s.SKUs[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return SKU{}, false
+}
+
+// validate checks that a snapshot can price estimates
+func (s *Snapshot) validate() error {
+	if s.Provider == "" || s.Version == "" || s.Currency == "" {
+		return fmt.Errorf("provider, version and currency are required")
+	}
+	if s.DefaultRegion == "" {
+		return fmt.Errorf("default_region is required")
+	}
+	for _, sku := range s.SKUs {
+		switch sku.Unit {
+		case UnitHour, UnitMonth, UnitGBMonth, UnitGB:
+		default:
+			return fmt.Errorf("sku %q has unknown unit %q", sku.Name, sku.Unit)
+		}
+		if _, ok := sku.Prices[s.DefaultRegion]; !ok {
+			return fmt.Errorf("sku %q has no price for the default region %s", sku.Name, s.DefaultRegion)
+		}
+	}
+	return nil
+}
+
+// Catalog holds the newest price-list snapshot of each provider
+type Catalog struct {
+	snapshots map[string]*Snapshot
+}
+
+// Snapshot returns the price list of a provider
+func (c *Catalog) Snapshot(provider string) (*Snapshot, bool) {
+	snapshot, ok := c.snapshots[normalizeProvider(provider)]
+	return snapshot, ok
+}
+
+// Providers returns the providers with a price list, sorted
+func (c *Catalog) Providers() []string {
+	providers := make([]string, 0, len(c.snapshots))
+	for provider := range c.snapshots {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// add keeps a snapshot when it is newer than the provider's current one
+func (c *Catalog) add(snapshot *Snapshot) {
+	snapshot.Provider = normalizeProvider(snapshot.Provider)
+	if current, ok := c.snapshots[snapshot.Provider]; ok && current.Version >= snapshot.Version {
+		return
+	}
+	c.snapshots[snapshot.Provider] = snapshot
+}
+
+// NewCatalog loads the bundled snapshots and, when directory is not empty, the JSON snapshots
+// in it. The newest version of each provider is used.
+func NewCatalog(directory string) (*Catalog, error) {
+	catalog := &Catalog{snapshots: make(map[string]*Snapshot)}
+	if err := catalog.loadFS(bundledSnapshots, "data"); err != nil {
+		return nil, err
+	}
+	if directory != "" {
+		if err := catalog.loadFS(os.DirFS(directory), "."); err != nil {
+			return nil, err
+		}
+	}
+	return catalog, nil
+}
+
+// loadFS adds the JSON snapshots of a directory
+func (c *Catalog) loadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("failed to list price-list snapshots: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read price-list snapshot %s: %w", entry.Name(), err)
+		}
+		var snapshot Snapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return fmt.Errorf("failed to parse price-list snapshot %s: %w", entry.Name(), err)
+		}
+		if err := snapshot.validate(); err != nil {
+			return fmt.Errorf("invalid price-list snapshot %s: %w", entry.Name(), err)
+		}
+		c.add(&snapshot)
+	}
+	return nil
+}
+
+var (
+	defaultCatalog     *Catalog
+	defaultCatalogErr  error
+	defaultCatalogOnce sync.Once
+)
+
+// Default returns the catalog of the bundled snapshots, loaded on first use
+func Default() (*Catalog, error) {
+	defaultCatalogOnce.Do(func() {
+		defaultCatalog, defaultCatalogErr = NewCatalog("")
+	})
+	return defaultCatalog, defaultCatalogErr
+}
+
+// normalizeProvider maps provider names to the names used by the snapshots
+func normalizeProvider(provider string) string {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if provider == "azurerm" {
+		return "azure"
+	}
+	return provider
+}
@@ -0,0 +1,295 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pricing estimates monthly and annual cloud costs from versioned price-list
+// snapshots. A workload taken from a query or a plan is mapped to SKUs and priced with
+// stated assumptions, so answers can quote computed figures instead of invented ones.
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Resource kinds priced by an estimate
+const (
+	KindCompute       = "compute"
+	KindBlockStorage  = "block_storage"
+	KindObjectStorage = "object_storage"
+	KindEgress        = "egress"
+	KindInterconnect  = "interconnect"
+	KindReplication   = "replication"
+)
+
+// Usage assumptions applied when the workload does not state them
+const (
+	HoursPerMonth   = 730
+	MonthsPerYear   = 12
+	DiskGBPerVM     = 128
+	ObjectStorageGB = 1024
+	EgressGB        = 1024
+)
+
+var (
+	// ErrUnsupportedProvider is returned for providers without a price list
+	ErrUnsupportedProvider = errors.New("no price list for provider")
+	// ErrNothingToPrice is returned when the workload has no priced resources
+	ErrNothingToPrice = errors.New("workload has no priced resources")
+)
+
+// Workload describes what to price
+type Workload struct {
+	Provider string
+	// Regions are candidate regions in order of preference; the first one in the price list is used
+	Regions []string
+	VMCount int
+	// Windows prices compute with the Windows license included
+	Windows bool
+	// DisasterRecovery adds replication of every VM to a recovery region
+	DisasterRecovery bool
+	// Services are extra resource kinds to price, such as KindInterconnect
+	Services []string
+}
+
+// LineItem is one priced resource of an estimate
+type LineItem struct {
+	Kind        string  `json:"kind"`
+	SKU         string  `json:"sku"`
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	Unit        string  `json:"unit"`
+	UnitPrice   float64 `json:"unit_price"`
+	Monthly     float64 `json:"monthly"`
+	Annual      float64 `json:"annual"`
+}
+
+// Estimate is the priced workload with the assumptions behind the figures
+type Estimate struct {
+	Provider         string     `json:"provider"`
+	Region           string     `json:"region"`
+	PriceListVersion string     `json:"price_list_version"`
+	Currency         string     `json:"currency"`
+	Lines            []LineItem `json:"lines"`
+	MonthlyTotal     float64    `json:"monthly_total"`
+	AnnualTotal      float64    `json:"annual_total"`
+	Assumptions      []string   `json:"assumptions"`
+}
+
+// serviceKeywords detect the services a text mentions
+var serviceKeywords = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{KindObjectStorage, regexp.MustCompile(`\b(s3|blob storage|object storage|azure blob|glacier)\b`)},
+	{KindEgress, regexp.MustCompile(`\b(egress|data transfer|bandwidth)\b`)},
+	{KindInterconnect, regexp.MustCompile(`\b(direct connect|expressroute|express route|dedicated connection)\b`)},
+	{KindReplication, regexp.MustCompile(`\b(elastic disaster recovery|site recovery|aws drs|replication)\b`)},
+}
+
+// DetectServices returns the resource kinds beyond compute and block storage that a text
+// mentions, such as the services in a plan's diagram and sections
+func DetectServices(text string) []string {
+	text = strings.ToLower(text)
+	var kinds []string
+	for _, keyword := range serviceKeywords {
+		if keyword.pattern.MatchString(text) {
+			kinds = append(kinds, keyword.kind)
+		}
+	}
+	return kinds
+}
+
+// Estimate prices a workload with the provider's price list
+func (c *Catalog) Estimate(workload Workload) (*Estimate, error) {
+	snapshot, ok := c.Snapshot(workload.Provider)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedProvider, workload.Provider)
+	}
+
+	region, regionNote := snapshot.region(workload.Regions)
+	estimate := &Estimate{
+		Provider:         snapshot.Provider,
+		Region:           region,
+		PriceListVersion: snapshot.Version,
+		Currency:         snapshot.Currency,
+		Assumptions: []string{
+			fmt.Sprintf("%s from the %s price list version %s, in %s, for %s",
+				snapshot.Source, snapshot.Provider, snapshot.Version, snapshot.Currency, region),
+		},
+	}
+	if regionNote != "" {
+		estimate.Assumptions = append(estimate.Assumptions, regionNote)
+	}
+
+	if workload.VMCount > 0 {
+		compute := estimate.add(snapshot, KindCompute, workload.Windows, float64(workload.VMCount), 0)
+		if compute != nil {
+			estimate.Assumptions = append(estimate.Assumptions,
+				fmt.Sprintf("Each of the %d VMs is a %s running %d hours a month", workload.VMCount, compute.SKU, HoursPerMonth))
+		}
+		if estimate.add(snapshot, KindBlockStorage, false, float64(workload.VMCount), DiskGBPerVM*float64(workload.VMCount)) != nil {
+			estimate.Assumptions = append(estimate.Assumptions, fmt.Sprintf("Each VM has one %d GB disk", DiskGBPerVM))
+		}
+		if workload.DisasterRecovery || containsKind(workload.Services, KindReplication) {
+			estimate.add(snapshot, KindReplication, false, float64(workload.VMCount), 0)
+		}
+	}
+	if containsKind(workload.Services, KindObjectStorage) &&
+		estimate.add(snapshot, KindObjectStorage, false, 1, ObjectStorageGB) != nil {
+		estimate.Assumptions = append(estimate.Assumptions, fmt.Sprintf("%d GB is kept in object storage", ObjectStorageGB))
+	}
+	if containsKind(workload.Services, KindEgress) {
+		if egress := estimate.add(snapshot, KindEgress, false, 1, EgressGB); egress != nil {
+			estimate.Assumptions = append(estimate.Assumptions, fmt.Sprintf("%d GB leaves the cloud each month, %g GB of it free",
+				EgressGB, EgressGB-egress.Quantity))
+		}
+	}
+	if containsKind(workload.Services, KindInterconnect) &&
+		estimate.add(snapshot, KindInterconnect, false, 1, 0) != nil {
+		estimate.Assumptions = append(estimate.Assumptions, "One 1 Gbps private connection to the data center, without carrier charges")
+	}
+
+	if len(estimate.Lines) == 0 {
+		return nil, ErrNothingToPrice
+	}
+	if workload.Windows && workload.VMCount > 0 {
+		estimate.Assumptions = append(estimate.Assumptions, "Windows licenses are included in the VM price")
+	}
+	estimate.Assumptions = append(estimate.Assumptions,
+		"On-demand prices without reservations, savings plans, support plans or taxes")
+	estimate.MonthlyTotal = roundCents(estimate.MonthlyTotal)
+	estimate.AnnualTotal = roundCents(estimate.MonthlyTotal * MonthsPerYear)
+	return estimate, nil
+}
+
+// add prices a resource kind for the given number of resources and gigabytes and returns
+// the line, or nil when the price list has no SKU of the kind
+func (e *Estimate) add(snapshot *Snapshot, kind string, windows bool, resources, gigabytes float64) *LineItem {
+	sku, ok := snapshot.sku(kind, windows)
+	if !ok {
+		return nil
+	}
+
+	quantity := resources
+	switch sku.Unit {
+	case UnitHour:
+		quantity = resources * HoursPerMonth
+	case UnitGBMonth, UnitGB:
+		quantity = gigabytes
+	}
+	quantity = math.Max(quantity-sku.FreeQuantity, 0)
+
+	unitPrice := sku.Prices[e.Region]
+	monthly := roundCents(quantity * unitPrice)
+	e.Lines = append(e.Lines, LineItem{
+		Kind:        kind,
+		SKU:         sku.Name,
+		Description: sku.Description,
+		Quantity:    quantity,
+		Unit:        sku.Unit,
+		UnitPrice:   unitPrice,
+		Monthly:     monthly,
+		Annual:      roundCents(monthly * MonthsPerYear),
+	})
+	e.MonthlyTotal += monthly
+	return &e.Lines[len(e.Lines)-1]
+}
+
+// region returns the first candidate region the price list covers, or the default region
+// with a note saying why it was used
+func (s *Snapshot) region(candidates []string) (string, string) {
+	for _, candidate := range candidates {
+		if s.hasRegion(candidate) {
+			return candidate, ""
+		}
+	}
+	if len(candidates) > 0 {
+		return s.DefaultRegion, fmt.Sprintf("%s prices are used because the price list does not cover %s",
+			s.DefaultRegion, strings.Join(candidates, ", "))
+	}
+	return s.DefaultRegion, fmt.Sprintf("No region was given, so %s prices are used", s.DefaultRegion)
+}
+
+// hasRegion reports whether every SKU has a price in the region
+func (s *Snapshot) hasRegion(region string) bool {
+	for _, sku := range s.SKUs {
+		if _, ok := sku.Prices[region]; !ok {
+			return false
+		}
+	}
+	return len(s.SKUs) > 0
+}
+
+// Context describes the estimate for a prompt as the figures the answer must use
+func (e *Estimate) Context() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Cost estimate computed from the %s price list version %s (%s, %s). "+
+		"These figures are authoritative: use them for any cost numbers in the answer, "+
+		"do not invent other prices, and state the assumptions.\n", e.Provider, e.PriceListVersion, e.Currency, e.Region)
+	for _, line := range e.Lines {
+		fmt.Fprintf(&b, "- %s (%s): %s %s at %s per %s = %s/month, %s/year\n",
+			line.Description, line.SKU, formatQuantity(line.Quantity), line.Unit, formatPrice(line.UnitPrice), line.Unit,
+			FormatAmount(line.Monthly), FormatAmount(line.Annual))
+	}
+	fmt.Fprintf(&b, "Total: %s/month, %s/year\nAssumptions:\n", FormatAmount(e.MonthlyTotal), FormatAmount(e.AnnualTotal))
+	for _, assumption := range e.Assumptions {
+		fmt.Fprintf(&b, "- %s\n", assumption)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// FormatAmount formats an amount in dollars with thousands separators, such as "$12,345.67"
+func FormatAmount(amount float64) string {
+	cents := int64(math.Round(amount * 100))
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	dollars := fmt.Sprintf("%d", cents/100)
+	for i := len(dollars) - 3; i > 0; i -= 3 {
+		dollars = dollars[:i] + "," + dollars[i:]
+	}
+	return fmt.Sprintf("%s$%s.%02d", sign, dollars, cents%100)
+}
+
+// formatPrice formats a unit price with up to four decimals, since storage prices are fractions of a cent
+func formatPrice(price float64) string {
+	if price >= 1 {
+		return FormatAmount(price)
+	}
+	return "$" + strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.4f", price), "0"), ".")
+}
+
+// formatQuantity formats a quantity without trailing zeros
+func formatQuantity(quantity float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", quantity), "0"), ".")
+}
+
+// roundCents rounds an amount to whole cents
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// containsKind reports whether a list of resource kinds contains a kind
+func containsKind(kinds []string, kind string) bool {
+	for _, existing := range kinds {
+		if existing == kind {
+			return true
+		}
+	}
+	return false
+}
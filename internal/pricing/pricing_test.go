@@ -0,0 +1,148 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pricing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultCatalog(t *testing.T) {
+	catalog, err := Default()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aws", "azure"}, catalog.Providers())
+
+	snapshot, ok := catalog.Snapshot("azurerm")
+	require.True(t, ok)
+	assert.Equal(t, "2024-06", snapshot.Version)
+}
+
+func TestEstimateAWSMigration(t *testing.T) {
+	catalog, err := Default()
+	require.NoError(t, err)
+
+	estimate, err := catalog.Estimate(Workload{
+		Provider: "aws",
+		Regions:  []string{"eastus", "us-west-2"},
+		VMCount:  40,
+		Windows:  true,
+		Services: DetectServices("Connect the data center over Direct Connect and back up to S3"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "us-west-2", estimate.Region)
+	var kinds []string
+	for _, line := range estimate.Lines {
+		kinds = append(kinds, line.Kind)
+	}
+	assert.Equal(t, []string{KindCompute, KindBlockStorage, KindObjectStorage, KindInterconnect}, kinds)
+
+	compute := estimate.Lines[0]
+	assert.Equal(t, "m5.large-windows", compute.SKU)
+	assert.Equal(t, float64(40*HoursPerMonth), compute.Quantity)
+	assert.InDelta(t, 5489.60, compute.Monthly, 0.001)
+	assert.InDelta(t, 409.60, estimate.Lines[1].Monthly, 0.001)
+	assert.InDelta(t, 23.55, estimate.Lines[2].Monthly, 0.001)
+	assert.InDelta(t, 219.00, estimate.Lines[3].Monthly, 0.001)
+	assert.InDelta(t, 6141.75, estimate.MonthlyTotal, 0.001)
+	assert.InDelta(t, 73701.00, estimate.AnnualTotal, 0.001)
+
+	assumptions := strings.Join(estimate.Assumptions, "\n")
+	assert.Contains(t, assumptions, "price list version 2024-06")
+	assert.Contains(t, assumptions, "Windows licenses are included")
+}
+
+func TestEstimateAzureDisasterRecovery(t *testing.T) {
+	catalog, err := Default()
+	require.NoError(t, err)
+
+	estimate, err := catalog.Estimate(Workload{
+		Provider:         "azure",
+		Regions:          []string{"japaneast"},
+		VMCount:          10,
+		DisasterRecovery: true,
+		Services:         []string{KindEgress},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "eastus", estimate.Region)
+	assert.Contains(t, estimate.Assumptions[1], "does not cover japaneast")
+	require.Len(t, estimate.Lines, 4)
+	assert.InDelta(t, 197.10, estimate.Lines[1].Monthly, 0.001)
+	assert.Equal(t, KindReplication, estimate.Lines[2].Kind)
+	assert.InDelta(t, 250.00, estimate.Lines[2].Monthly, 0.001)
+	assert.Equal(t, float64(EgressGB-100), estimate.Lines[3].Quantity)
+}
+
+func TestEstimateErrors(t *testing.T) {
+	catalog, err := Default()
+	require.NoError(t, err)
+
+	_, err = catalog.Estimate(Workload{Provider: "google", VMCount: 5})
+	assert.True(t, errors.Is(err, ErrUnsupportedProvider))
+
+	_, err = catalog.Estimate(Workload{Provider: "aws"})
+	assert.True(t, errors.Is(err, ErrNothingToPrice))
+}
+
+func TestNewCatalogUsesNewestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := `{"provider": "aws", "version": "2025-01", "currency": "USD", "source": "Test prices",
+		"default_region": "us-east-1",
+		"skus": [{"sku": "m7i.large", "kind": "compute", "description": "EC2 m7i.large", "unit": "hour", "prices": {"us-east-1": 0.1}}]}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "aws-2025-01.json"), []byte(snapshot), 0o600))
+	older := strings.Replace(strings.Replace(snapshot, "2025-01", "2023-01", 1), "m7i.large", "m4.large", -1)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "aws-2023-01.json"), []byte(older), 0o600))
+
+	catalog, err := NewCatalog(dir)
+	require.NoError(t, err)
+
+	estimate, err := catalog.Estimate(Workload{Provider: "aws", VMCount: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "2025-01", estimate.PriceListVersion)
+	require.Len(t, estimate.Lines, 1)
+	assert.Equal(t, "m7i.large", estimate.Lines[0].SKU)
+	assert.InDelta(t, 146.00, estimate.MonthlyTotal, 0.001)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"provider": "aws"}`), 0o600))
+	_, err = NewCatalog(dir)
+	assert.ErrorContains(t, err, "broken.json")
+}
+
+func TestEstimateContext(t *testing.T) {
+	catalog, err := Default()
+	require.NoError(t, err)
+	estimate, err := catalog.Estimate(Workload{Provider: "aws", Regions: []string{"us-east-1"}, VMCount: 100})
+	require.NoError(t, err)
+
+	context := estimate.Context()
+	assert.Contains(t, context, "These figures are authoritative")
+	assert.Contains(t, context, "EC2 m5.large Linux (2 vCPU, 8 GiB) (m5.large): 73000 hour at $0.096 per hour = $7,008.00/month, $84,096.00/year")
+	assert.Contains(t, context, "Total: $8,032.00/month, $96,384.00/year")
+	assert.Contains(t, context, "- On-demand prices without reservations")
+}
+
+func TestFormatAmount(t *testing.T) {
+	assert.Equal(t, "$0.00", FormatAmount(0))
+	assert.Equal(t, "$999.50", FormatAmount(999.5))
+	assert.Equal(t, "$1,234,567.89", FormatAmount(1234567.891))
+	assert.Equal(t, "-$1,000.00", FormatAmount(-1000))
+}
@@ -0,0 +1,393 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaffold
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// RequiredTerraformVersion is the Terraform version constraint of generated projects
+const RequiredTerraformVersion = ">= 1.5.0"
+
+// devVMCount caps the VM count of environments other than prod
+const devVMCount = 2
+
+// drAlias is the alias of the provider configured for the disaster recovery region
+const drAlias = "dr"
+
+// Names of the variables generated from the parameters
+const (
+	varProjectName   = "project_name"
+	varEnvironment   = "environment"
+	varPrimaryRegion = "primary_region"
+	varDRRegion      = "dr_region"
+	varVMCount       = "vm_count"
+	varRTOMinutes    = "rto_minutes"
+	varRPOMinutes    = "rpo_minutes"
+)
+
+// providerRequirement is the source and version constraint of a provider
+type providerRequirement struct {
+	source  string
+	version string
+}
+
+// providerRequirements are the version constraints written to versions.tf. Providers missing
+// here are left to Terraform's default hashicorp/<name> source.
+var providerRequirements = map[string]providerRequirement{
+	"aws":     {"hashicorp/aws", "~> 5.0"},
+	"azurerm": {"hashicorp/azurerm", "~> 3.0"},
+	"azuread": {"hashicorp/azuread", "~> 2.0"},
+	"google":  {"hashicorp/google", "~> 5.0"},
+	"random":  {"hashicorp/random", "~> 3.0"},
+	"tls":     {"hashicorp/tls", "~> 4.0"},
+	"null":    {"hashicorp/null", "~> 3.0"},
+	"time":    {"hashicorp/time", "~> 0.9"},
+	"local":   {"hashicorp/local", "~> 2.0"},
+	"archive": {"hashicorp/archive", "~> 2.0"},
+}
+
+// regionDefaults are the primary and disaster recovery regions used when the request names none
+var regionDefaults = map[string][2]string{
+	"aws":     {"us-east-1", "us-west-2"},
+	"azurerm": {"eastus", "westus2"},
+	"google":  {"us-central1", "us-east1"},
+}
+
+// durationPattern matches RTO and RPO durations such as "4 hours" or "15 mins"
+var durationPattern = regexp.MustCompile(`^(\d+)\s*(hours?|hrs?|h|minutes?|mins?|m)$`)
+
+// Variable is a project variable generated from the parameters
+type Variable struct {
+	Name        string
+	Type        string
+	Description string
+	// Default is the default value as an HCL expression
+	Default string
+}
+
+// layout is the content of a project's files
+type layout struct {
+	params    Parameters
+	code      *snippetCode
+	provider  string
+	providers []string
+	// variables are generated from the parameters; undeclared are read by the code but
+	// declared nowhere
+	variables  []Variable
+	undeclared []string
+}
+
+// newLayout decides the providers and variables of a project
+func newLayout(params Parameters, code *snippetCode) *layout {
+	l := &layout{params: params, code: code}
+
+	l.provider = params.Provider
+	if l.provider == "" {
+		for _, provider := range code.providers {
+			if _, ok := regionDefaults[provider]; ok {
+				l.provider = provider
+				break
+			}
+		}
+	}
+	if l.provider != "" {
+		l.providers = append(l.providers, l.provider)
+	}
+	for _, provider := range code.providers {
+		if !contains(l.providers, provider) {
+			l.providers = append(l.providers, provider)
+		}
+	}
+
+	params.Provider = l.provider
+	l.variables = params.Variables()
+	for _, provider := range l.providers[min(1, len(l.providers)):] {
+		if defaults, ok := regionDefaults[provider]; ok {
+			l.variables = append(l.variables, Variable{provider + "_region", "string",
+				fmt.Sprintf("Region of the %s provider", provider), quote(defaults[0])})
+		}
+	}
+	for _, name := range code.references {
+		if !l.generates(name) && !code.declares(name) {
+			l.undeclared = append(l.undeclared, name)
+		}
+	}
+
+	// Values extracted from the request take precedence over the answer's own declarations
+	kept := code.variables[:0:0]
+	for _, block := range code.variables {
+		if l.generates(block.name()) {
+			code.note("Variable %q of the answer's code was replaced by the value extracted from the request", block.name())
+			continue
+		}
+		kept = append(kept, block)
+	}
+	code.variables = kept
+	return l
+}
+
+// Variables returns the variables generated from the parameters. Region variables follow
+// Provider; a project adds a region variable for each further provider its code uses.
+func (p Parameters) Variables() []Variable {
+	name := p.Name
+	if name == "" {
+		name = ProjectName(p.Description)
+	}
+	variables := []Variable{
+		{varProjectName, "string", "Name used to label the project's resources", quote(name)},
+		{varEnvironment, "string", "Deployment environment, set by the environments/*.tfvars files", quote(Environments[0])},
+	}
+
+	defaults, hasDefaults := regionDefaults[p.Provider]
+	regions := append([]string{}, p.Regions...)
+	if len(regions) > 0 || hasDefaults {
+		if len(regions) == 0 {
+			regions = append(regions, defaults[0])
+		}
+		variables = append(variables, Variable{varPrimaryRegion, "string", "Region the workload runs in", quote(regions[0])})
+		if p.disasterRecovery() {
+			if len(regions) == 1 {
+				regions = append(regions, defaults[1])
+			}
+			if regions[1] != "" {
+				variables = append(variables, Variable{varDRRegion, "string", "Region the workload fails over to", quote(regions[1])})
+			}
+		}
+	}
+
+	if p.VMCount > 0 {
+		variables = append(variables, Variable{varVMCount, "number", "Number of virtual machines to provision",
+			strconv.Itoa(p.VMCount)})
+	}
+	if minutes, ok := durationMinutes(p.RTO); ok {
+		variables = append(variables, Variable{varRTOMinutes, "number", "Recovery time objective in minutes", strconv.Itoa(minutes)})
+	}
+	if minutes, ok := durationMinutes(p.RPO); ok {
+		variables = append(variables, Variable{varRPOMinutes, "number", "Recovery point objective in minutes", strconv.Itoa(minutes)})
+	}
+	return variables
+}
+
+// disasterRecovery reports whether the project has a disaster recovery region
+func (p Parameters) disasterRecovery() bool {
+	return p.DisasterRecovery || len(p.Regions) > 1
+}
+
+// ProviderAlias returns the provider alias of the disaster recovery region, or "" when the
+// project has none
+func (p Parameters) ProviderAlias() string {
+	if _, ok := regionDefaults[p.Provider]; !ok || p.Provider == "azurerm" || !p.disasterRecovery() {
+		return ""
+	}
+	return p.Provider + "." + drAlias
+}
+
+// generates reports whether a variable is generated from the parameters
+func (l *layout) generates(name string) bool {
+	for _, v := range l.variables {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mainFile returns main.tf: the provider configuration followed by the answer's code
+func (l *layout) mainFile() string {
+	var b strings.Builder
+	if description := oneLine(l.params.Description); description != "" {
+		fmt.Fprintf(&b, "# %s\n\n", description)
+	}
+	for _, provider := range l.providers {
+		if block := l.providerBlock(provider, ""); block != "" {
+			b.WriteString(block + "\n")
+		}
+		if provider == l.provider && l.generates(varDRRegion) && provider != "azurerm" {
+			b.WriteString(l.providerBlock(provider, drAlias) + "\n")
+		}
+	}
+	for _, block := range l.code.main {
+		b.WriteString(block.text + "\n\n")
+	}
+	return format(b.String())
+}
+
+// providerBlock returns the configuration of a provider, or "" when it needs none. The drAlias
+// alias configures the provider for the disaster recovery region.
+func (l *layout) providerBlock(provider, alias string) string {
+	region := varPrimaryRegion
+	if alias == drAlias {
+		region = varDRRegion
+	} else if provider != l.provider {
+		region = provider + "_region"
+	}
+
+	var body strings.Builder
+	if alias != "" {
+		fmt.Fprintf(&body, "  alias = %s\n", quote(alias))
+	}
+	switch provider {
+	case "aws":
+		fmt.Fprintf(&body, "  region = var.%s\n\n", region)
+		body.WriteString("  default_tags {\n    tags = {\n      Project     = var.project_name\n      Environment = var.environment\n    }\n  }\n")
+	case "azurerm":
+		body.WriteString("  features {}\n")
+	case "google":
+		fmt.Fprintf(&body, "  region = var.%s\n", region)
+	default:
+		return ""
+	}
+	return fmt.Sprintf("provider %s {\n%s}\n", quote(provider), body.String())
+}
+
+// variablesFile returns variables.tf: the generated variables, the answer's variables and
+// the variables the answer reads without declaring them
+func (l *layout) variablesFile() string {
+	var b strings.Builder
+	for _, v := range l.variables {
+		fmt.Fprintf(&b, "variable %s {\n  description = %s\n  type = %s\n  default = %s\n}\n\n",
+			quote(v.Name), quote(v.Description), v.Type, v.Default)
+	}
+	for _, block := range l.code.variables {
+		b.WriteString(block.text + "\n\n")
+	}
+	for _, name := range l.undeclared {
+		fmt.Fprintf(&b, "variable %s {\n  description = %s\n}\n\n",
+			quote(name), quote("Used by the generated code; set it in the environments/*.tfvars files"))
+	}
+	return format(b.String())
+}
+
+// outputsFile returns outputs.tf: the answer's outputs, or the ID of each resource when the
+// answer has none
+func (l *layout) outputsFile() string {
+	var b strings.Builder
+	for _, block := range l.code.outputs {
+		b.WriteString(block.text + "\n\n")
+	}
+	if len(l.code.outputs) > 0 {
+		return format(b.String())
+	}
+
+	names := make(map[string]bool)
+	for _, block := range l.code.main {
+		if block.kind != "resource" || len(block.labels) != 2 {
+			continue
+		}
+		resourceType, name := block.labels[0], block.labels[1]
+		outputName := strings.TrimPrefix(resourceType, resourceProvider(resourceType)+"_") + "_" + name + "_id"
+		if names[outputName] {
+			outputName = resourceType + "_" + name + "_id"
+		}
+		names[outputName] = true
+
+		address := resourceType + "." + name
+		value := address + ".id"
+		switch {
+		case block.counted:
+			value = address + "[*].id"
+		case block.forEach:
+			value = "{ for key, instance in " + address + " : key => instance.id }"
+		}
+		fmt.Fprintf(&b, "output %s {\n  description = %s\n  value = %s\n}\n\n",
+			quote(outputName), quote("ID of "+address), value)
+	}
+	if b.Len() == 0 {
+		return "# The generated code declares no resources to output\n"
+	}
+	return format(b.String())
+}
+
+// versionsFile returns versions.tf with the Terraform and provider version constraints
+func (l *layout) versionsFile() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "terraform {\n  required_version = %s\n", quote(RequiredTerraformVersion))
+	var requirements strings.Builder
+	for _, provider := range l.providers {
+		if requirement, ok := providerRequirements[provider]; ok {
+			fmt.Fprintf(&requirements, "    %s = {\n      source = %s\n      version = %s\n    }\n",
+				provider, quote(requirement.source), quote(requirement.version))
+		}
+	}
+	if requirements.Len() > 0 {
+		b.WriteString("\n  required_providers {\n" + requirements.String() + "  }\n")
+	}
+	b.WriteString("}\n")
+	return format(b.String())
+}
+
+// tfvarsFile returns the variable values of an environment
+func (l *layout) tfvarsFile(environment string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Values for the %s environment\n", environment)
+	for _, v := range l.variables {
+		value := v.Default
+		switch v.Name {
+		case varEnvironment:
+			value = quote(environment)
+		case varVMCount:
+			if environment != "prod" && l.params.VMCount > devVMCount {
+				fmt.Fprintf(&b, "# Scaled down from %d VMs in prod\n", l.params.VMCount)
+				value = strconv.Itoa(devVMCount)
+			}
+		}
+		fmt.Fprintf(&b, "%s = %s\n", v.Name, value)
+	}
+	if len(l.undeclared) > 0 {
+		b.WriteString("\n# TODO: set the variables the generated code uses\n")
+		for _, name := range l.undeclared {
+			fmt.Fprintf(&b, "# %s =\n", name)
+		}
+	}
+	return format(b.String())
+}
+
+// durationMinutes converts a duration such as "4 hours" to minutes
+func durationMinutes(duration string) (int, bool) {
+	match := durationPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(duration)))
+	if match == nil {
+		return 0, false
+	}
+	value, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, false
+	}
+	if strings.HasPrefix(match[2], "h") {
+		value *= 60
+	}
+	return value, true
+}
+
+// quote returns a string as an HCL string literal
+func quote(value string) string {
+	return string(hclwrite.TokensForValue(cty.StringVal(value)).Bytes())
+}
+
+// oneLine collapses whitespace, including newlines, so text fits in a comment
+func oneLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// format aligns and indents HCL the way terraform fmt does
+func format(source string) string {
+	return strings.TrimRight(string(hclwrite.Format([]byte(source))), "\n") + "\n"
+}
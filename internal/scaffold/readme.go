@@ -0,0 +1,80 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaffold
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fileDescriptions describe the generated files in the README
+var fileDescriptions = map[string]string{
+	"main.tf":      "Provider configuration and the resources from the answer",
+	"variables.tf": "Input variables, with defaults taken from the request",
+	"outputs.tf":   "Values exported by the project",
+	"versions.tf":  "Terraform and provider version constraints",
+}
+
+// readme returns the project README: what it was generated for, its variables, how to use it
+// and what validation found
+func (l *layout) readme(project *Project) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", project.Name)
+	if description := oneLine(l.params.Description); description != "" {
+		fmt.Fprintf(&b, "Terraform project generated for: %s\n\n", description)
+	}
+	b.WriteString("Review the code before applying it. It was generated from an answer and may need changes for your environment.\n\n")
+
+	b.WriteString("## Files\n\n")
+	for _, file := range project.Files {
+		description := fileDescriptions[file.Path]
+		if strings.HasSuffix(file.Path, ".tfvars") {
+			description = "Variable values for the " + strings.TrimSuffix(strings.TrimPrefix(file.Path, "environments/"), ".tfvars") + " environment"
+		}
+		fmt.Fprintf(&b, "- `%s`: %s\n", file.Path, description)
+	}
+
+	b.WriteString("\n## Variables\n\n| Name | Default | Description |\n| --- | --- | --- |\n")
+	for _, v := range l.variables {
+		fmt.Fprintf(&b, "| `%s` | `%s` | %s |\n", v.Name, v.Default, v.Description)
+	}
+	for _, name := range l.undeclared {
+		fmt.Fprintf(&b, "| `%s` | | Used by the generated code; set it before applying |\n", name)
+	}
+
+	environment := Environments[0]
+	fmt.Fprintf(&b, "\n## Usage\n\n```bash\nterraform init\nterraform plan -var-file=environments/%s.tfvars\nterraform apply -var-file=environments/%s.tfvars\n```\n", environment, environment)
+
+	if len(project.Notes) > 0 {
+		b.WriteString("\n## Notes\n\n")
+		for _, note := range project.Notes {
+			fmt.Fprintf(&b, "- %s\n", note)
+		}
+	}
+
+	b.WriteString("\n## Validation\n\n")
+	var findings []string
+	for _, file := range project.Files {
+		for _, finding := range file.Findings {
+			findings = append(findings, fmt.Sprintf("- %s `%s`: %s", finding.Severity, file.Path, finding))
+		}
+	}
+	if len(findings) == 0 {
+		b.WriteString("The files parsed and passed the schema and policy checks.\n")
+	} else {
+		b.WriteString(strings.Join(findings, "\n") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,209 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scaffold turns the Terraform snippets of an answer into a complete Terraform project
+// with main.tf, variables.tf, outputs.tf, versions.tf, a tfvars file per environment and a
+// README. Values extracted from the query, such as the VM count, regions and RTO/RPO, become
+// variables. The project is validated with the codecheck package and can be archived as a zip.
+package scaffold
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/your-org/ai-sa-assistant/internal/codecheck"
+)
+
+// ErrNoTerraform is returned when none of the snippets contains Terraform blocks
+var ErrNoTerraform = errors.New("the answer has no Terraform code to scaffold a project from")
+
+// ContentTypeZip is the content type of a project archive
+const ContentTypeZip = "application/zip"
+
+// DefaultProjectName is the project name used when none can be derived from the description
+const DefaultProjectName = "terraform-project"
+
+// maxNameWords is the number of description words kept in a derived project name
+const maxNameWords = 5
+
+// Environments are the environments a tfvars file is generated for
+var Environments = []string{"dev", "prod"}
+
+// Parameters are the values extracted from the request that become project variables
+type Parameters struct {
+	// Name is the project directory name; it is derived from Description when empty
+	Name string
+	// Description is the request the project was generated for
+	Description string
+	// Provider is the main provider such as "aws" or "azurerm"; it is detected from the code
+	// when empty
+	Provider string
+	VMCount  int
+	// Regions are the primary region followed by the disaster recovery region
+	Regions []string
+	// RTO and RPO are durations such as "4 hours" or "15 minutes"
+	RTO string
+	RPO string
+	// DisasterRecovery adds a disaster recovery region even when the request names only one
+	DisasterRecovery bool
+}
+
+// File is a project file with the problems validation found in it
+type File struct {
+	Path     string              `json:"path"`
+	Content  string              `json:"content"`
+	Findings []codecheck.Finding `json:"findings,omitempty"`
+}
+
+// Project is a generated Terraform project
+type Project struct {
+	Name  string `json:"name"`
+	Files []File `json:"files"`
+	// Valid is false when validation found errors in any file
+	Valid bool `json:"valid"`
+	// Notes explain the changes made to the answer's code, such as duplicate blocks left out,
+	// and the variables that must be set before applying
+	Notes []string `json:"notes,omitempty"`
+}
+
+// Build assembles and validates a project from Terraform snippets. It returns ErrNoTerraform
+// when no snippet has blocks to build from.
+func Build(params Parameters, snippets []string) (*Project, error) {
+	code := collectSnippets(snippets)
+	if !code.hasBlocks() {
+		return nil, ErrNoTerraform
+	}
+
+	if params.Name == "" {
+		params.Name = ProjectName(params.Description)
+	}
+	layout := newLayout(params, code)
+
+	project := &Project{Name: params.Name, Notes: code.notes}
+	for _, name := range layout.undeclared {
+		project.Notes = append(project.Notes, fmt.Sprintf(
+			"Variable %q is used by the answer's code but has no value; set it in the environments/*.tfvars files", name))
+	}
+
+	project.Files = []File{
+		{Path: "main.tf", Content: layout.mainFile()},
+		{Path: "variables.tf", Content: layout.variablesFile()},
+		{Path: "outputs.tf", Content: layout.outputsFile()},
+		{Path: "versions.tf", Content: layout.versionsFile()},
+	}
+	for _, environment := range Environments {
+		project.Files = append(project.Files, File{
+			Path:    "environments/" + environment + ".tfvars",
+			Content: layout.tfvarsFile(environment),
+		})
+	}
+
+	project.Valid = true
+	for i := range project.Files {
+		file := &project.Files[i]
+		file.Findings = validateFile(file.Path, file.Content)
+		if codecheck.HasErrors(file.Findings) {
+			project.Valid = false
+		}
+	}
+
+	project.Files = append(project.Files, File{Path: "README.md", Content: layout.readme(project)})
+	return project, nil
+}
+
+// validateFile validates a Terraform configuration file, or checks the syntax of a tfvars file
+func validateFile(path, content string) []codecheck.Finding {
+	if !strings.HasSuffix(path, ".tfvars") {
+		return codecheck.Validate("terraform", content)
+	}
+	_, diagnostics := hclsyntax.ParseConfig([]byte(content), path, hcl.InitialPos)
+	var findings []codecheck.Finding
+	for _, diagnostic := range diagnostics {
+		finding := codecheck.Finding{Severity: codecheck.SeverityError, Rule: codecheck.RuleSyntax,
+			Message: diagnostic.Summary}
+		if diagnostic.Severity == hcl.DiagWarning {
+			finding.Severity = codecheck.SeverityWarning
+		}
+		if diagnostic.Subject != nil {
+			finding.Line = diagnostic.Subject.Start.Line
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// Zip archives the project files in a directory named after the project
+func (p *Project) Zip() ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	modified := time.Now().UTC()
+	for _, file := range p.Files {
+		writer, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     p.Name + "/" + file.Path,
+			Method:   zip.Deflate,
+			Modified: modified,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to the archive: %w", file.Path, err)
+		}
+		if _, err := writer.Write([]byte(file.Content)); err != nil {
+			return nil, fmt.Errorf("failed to add %s to the archive: %w", file.Path, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write the archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ArchiveName returns the file name of the project archive
+func (p *Project) ArchiveName() string {
+	return p.Name + ".zip"
+}
+
+// nameWordPattern matches the words a project name is made of
+var nameWordPattern = regexp.MustCompile(`[a-z0-9]+`)
+
+// nameStopWords are words left out of derived project names
+var nameStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "to": true, "for": true, "of": true, "in": true,
+	"on": true, "with": true, "from": true, "our": true, "my": true, "me": true, "we": true, "i": true,
+	"generate": true, "create": true, "give": true, "write": true, "build": true, "please": true,
+	"terraform": true, "scaffold": true, "project": true, "module": true, "how": true, "can": true,
+}
+
+// ProjectName derives a directory name such as "migrate-120-vms-aws" from a description
+func ProjectName(description string) string {
+	var words []string
+	for _, word := range nameWordPattern.FindAllString(strings.ToLower(description), -1) {
+		if nameStopWords[word] {
+			continue
+		}
+		words = append(words, word)
+		if len(words) == maxNameWords {
+			break
+		}
+	}
+	if len(words) == 0 {
+		return DefaultProjectName
+	}
+	return strings.Join(words, "-")
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaffold
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/your-org/ai-sa-assistant/internal/codecheck"
+)
+
+// drParameters are the parameters of an AWS migration with a disaster recovery region
+var drParameters = Parameters{
+	Description: "Migrate 120 VMs to AWS with DR from us-east-1 to us-west-2, RTO 4 hours and RPO 15 minutes",
+	Provider:    "aws",
+	VMCount:     120,
+	Regions:     []string{"us-east-1", "us-west-2"},
+	RTO:         "4 hours",
+	RPO:         "15 minutes",
+}
+
+// projectFile returns the content of a project file
+func projectFile(t *testing.T, project *Project, path string) File {
+	t.Helper()
+	for _, file := range project.Files {
+		if file.Path == path {
+			return file
+		}
+	}
+	t.Fatalf("project has no %s", path)
+	return File{}
+}
+
+func TestBuild(t *testing.T) {
+	snippets := []string{
+		"provider \"aws\" {\n  region = \"us-east-1\"\n}\n\n# Application servers\nresource \"aws_instance\" \"app\" {\n" +
+			"  count         = var.vm_count\n  ami           = var.ami_id\n  instance_type = \"t3.medium\"\n}",
+		"variable \"vm_count\" {\n  default = 3\n}\n\nresource \"aws_s3_bucket\" \"backup\" {\n" +
+			"  provider = aws.dr\n  bucket   = \"${var.project_name}-backup\"\n}\n\nresource \"aws_instance\" \"app\" {}",
+		"this is { not hcl",
+	}
+
+	project, err := Build(drParameters, snippets)
+	require.NoError(t, err)
+
+	assert.Equal(t, "migrate-120-vms-aws-dr", project.Name)
+	assert.True(t, project.Valid)
+	var paths []string
+	for _, file := range project.Files {
+		paths = append(paths, file.Path)
+	}
+	assert.Equal(t, []string{"main.tf", "variables.tf", "outputs.tf", "versions.tf",
+		"environments/dev.tfvars", "environments/prod.tfvars", "README.md"}, paths)
+
+	main := projectFile(t, project, "main.tf").Content
+	assert.Contains(t, main, "region = var.primary_region")
+	assert.Contains(t, main, "alias  = \"dr\"\n  region = var.dr_region")
+	assert.Contains(t, main, "# Application servers\nresource \"aws_instance\" \"app\"")
+	assert.NotContains(t, main, "region = \"us-east-1\"")
+	assert.Equal(t, 1, strings.Count(main, "resource \"aws_instance\" \"app\""))
+
+	variables := projectFile(t, project, "variables.tf").Content
+	for _, want := range []string{
+		"default     = \"us-west-2\"", "default     = 120", "default     = 240", "default     = 15", "variable \"ami_id\"",
+	} {
+		assert.Contains(t, variables, want)
+	}
+	assert.NotContains(t, variables, "default = 3")
+
+	assert.Contains(t, projectFile(t, project, "outputs.tf").Content, "value       = aws_instance.app[*].id")
+	assert.Contains(t, projectFile(t, project, "versions.tf").Content, "source  = \"hashicorp/aws\"")
+
+	dev := projectFile(t, project, "environments/dev.tfvars").Content
+	assert.Contains(t, dev, "environment    = \"dev\"")
+	assert.Contains(t, dev, "vm_count    = 2")
+	assert.Contains(t, dev, "# ami_id =")
+	assert.Contains(t, projectFile(t, project, "environments/prod.tfvars").Content, "vm_count       = 120")
+
+	notes := strings.Join(project.Notes, "\n")
+	for _, want := range []string{
+		"provider \"aws\" block of snippet 1", "aws_instance.app in snippet 2", "Snippet 3 was left out",
+		"Variable \"vm_count\" of the answer's code", "Variable \"ami_id\"",
+	} {
+		assert.Contains(t, notes, want)
+	}
+
+	readme := projectFile(t, project, "README.md").Content
+	assert.Contains(t, readme, "terraform plan -var-file=environments/dev.tfvars")
+	assert.Contains(t, readme, "| `vm_count` | `120` |")
+	assert.Contains(t, readme, "passed the schema and policy checks")
+}
+
+func TestBuildReportsFindings(t *testing.T) {
+	snippets := []string{"resource \"azurerm_storage_container\" \"web\" {\n  name                  = \"web\"\n" +
+		"  storage_account_name  = \"site\"\n  container_access_type = \"blob\"\n}"}
+
+	project, err := Build(Parameters{Description: "Static website on Azure"}, snippets)
+	require.NoError(t, err)
+
+	assert.False(t, project.Valid)
+	main := projectFile(t, project, "main.tf")
+	require.Len(t, main.Findings, 1)
+	assert.Equal(t, codecheck.RulePublicStorage, main.Findings[0].Rule)
+	assert.Contains(t, main.Content, "provider \"azurerm\" {\n  features {}\n}")
+	assert.Contains(t, projectFile(t, project, "variables.tf").Content, "default     = \"eastus\"")
+	assert.Contains(t, projectFile(t, project, "README.md").Content, "- error `main.tf`: line ")
+}
+
+func TestBuildWithoutTerraform(t *testing.T) {
+	_, err := Build(drParameters, []string{"not { terraform", ""})
+	assert.True(t, errors.Is(err, ErrNoTerraform))
+}
+
+func TestProjectZip(t *testing.T) {
+	project, err := Build(drParameters, []string{"resource \"aws_vpc\" \"main\" {\n  cidr_block = \"10.0.0.0/16\"\n}"})
+	require.NoError(t, err)
+
+	data, err := project.Zip()
+	require.NoError(t, err)
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	require.Len(t, archive.File, len(project.Files))
+	for i, entry := range archive.File {
+		assert.Equal(t, project.Name+"/"+project.Files[i].Path, entry.Name)
+		reader, err := entry.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, project.Files[i].Content, string(content))
+	}
+	assert.Equal(t, "migrate-120-vms-aws-dr.zip", project.ArchiveName())
+}
+
+func TestProjectName(t *testing.T) {
+	assert.Equal(t, "dr-sql-server-east-us", ProjectName("Give me Terraform for DR of SQL Server in East US 2"))
+	assert.Equal(t, DefaultProjectName, ProjectName("Create the terraform"))
+}
+
+func TestDurationMinutes(t *testing.T) {
+	tests := map[string]int{"4 hours": 240, "1 hour": 60, "15 minutes": 15, "30 mins": 30, "2 hrs": 120}
+	for duration, want := range tests {
+		minutes, ok := durationMinutes(duration)
+		assert.True(t, ok, duration)
+		assert.Equal(t, want, minutes, duration)
+	}
+	_, ok := durationMinutes("")
+	assert.False(t, ok)
+}
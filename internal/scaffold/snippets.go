@@ -0,0 +1,210 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// codeBlock is a top-level block of a snippet with its source text
+type codeBlock struct {
+	kind   string
+	labels []string
+	text   string
+	// counted and forEach record the count and for_each meta-arguments of resources
+	counted bool
+	forEach bool
+}
+
+// name returns the block's last label, which names variables, outputs and modules
+func (b codeBlock) name() string {
+	if len(b.labels) == 0 {
+		return ""
+	}
+	return b.labels[len(b.labels)-1]
+}
+
+// snippetCode is the Terraform code of an answer's snippets, sorted by the file it goes to
+type snippetCode struct {
+	main      []codeBlock
+	variables []codeBlock
+	outputs   []codeBlock
+	// providers are the providers the code uses, in the order they are first seen
+	providers []string
+	// references are the input variables the code reads, in the order they are first seen
+	references []string
+	notes      []string
+
+	seen map[string]bool
+}
+
+// collectSnippets parses the snippets and sorts their blocks. Snippets that do not parse are
+// left out, as are blocks repeated across snippets and blocks the project generates itself.
+func collectSnippets(snippets []string) *snippetCode {
+	code := &snippetCode{seen: make(map[string]bool)}
+	for i, snippet := range snippets {
+		number := i + 1
+		source := []byte(snippet)
+		file, diagnostics := hclsyntax.ParseConfig(source, fmt.Sprintf("snippet%d.tf", number), hcl.InitialPos)
+		if diagnostics.HasErrors() {
+			code.note("Snippet %d was left out because it is not valid HCL: %s", number, firstError(diagnostics))
+			continue
+		}
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		if len(body.Attributes) > 0 {
+			code.note("The top-level arguments of snippet %d were left out because Terraform only allows blocks there", number)
+		}
+		for _, block := range body.Blocks {
+			code.add(number, block, source)
+		}
+	}
+	return code
+}
+
+// hasBlocks reports whether any block was collected
+func (c *snippetCode) hasBlocks() bool {
+	return len(c.main)+len(c.variables)+len(c.outputs) > 0
+}
+
+// note records a change made to the answer's code
+func (c *snippetCode) note(format string, args ...any) {
+	c.notes = append(c.notes, fmt.Sprintf(format, args...))
+}
+
+// add sorts a block of the given snippet into its file
+func (c *snippetCode) add(number int, block *hclsyntax.Block, source []byte) {
+	item := codeBlock{kind: block.Type, labels: block.Labels, text: blockText(source, block)}
+	// Resources are addressed by their type and name, other blocks by their kind and labels
+	address := strings.Join(block.Labels, ".")
+	if block.Type != "resource" {
+		address = strings.Join(append([]string{block.Type}, block.Labels...), ".")
+	}
+
+	switch block.Type {
+	case "terraform":
+		c.note("The terraform block of snippet %d was replaced by versions.tf", number)
+		return
+	case "provider":
+		if item.name() != "" {
+			c.useProvider(item.name())
+		}
+		c.note("The provider %q block of snippet %d was replaced by the generated provider configuration", item.name(), number)
+		return
+	case "locals":
+		// Locals blocks merge, so every one is kept
+	default:
+		if c.seen[address] {
+			c.note("%s in snippet %d was left out because an earlier snippet declares it", address, number)
+			return
+		}
+		c.seen[address] = true
+	}
+
+	switch block.Type {
+	case "variable":
+		c.variables = append(c.variables, item)
+	case "output":
+		c.outputs = append(c.outputs, item)
+	case "resource", "data":
+		if len(block.Labels) > 0 {
+			c.useProvider(resourceProvider(block.Labels[0]))
+		}
+		_, item.counted = block.Body.Attributes["count"]
+		_, item.forEach = block.Body.Attributes["for_each"]
+		c.main = append(c.main, item)
+	default:
+		c.main = append(c.main, item)
+	}
+	c.collectReferences(block)
+}
+
+// useProvider records that the code uses a provider
+func (c *snippetCode) useProvider(name string) {
+	if !contains(c.providers, name) {
+		c.providers = append(c.providers, name)
+	}
+}
+
+// declares reports whether the code declares an input variable
+func (c *snippetCode) declares(name string) bool {
+	return c.seen["variable."+name]
+}
+
+// collectReferences records the input variables a block reads
+func (c *snippetCode) collectReferences(block *hclsyntax.Block) {
+	hclsyntax.VisitAll(block, func(node hclsyntax.Node) hcl.Diagnostics {
+		expr, ok := node.(*hclsyntax.ScopeTraversalExpr)
+		if !ok || expr.Traversal.RootName() != "var" || len(expr.Traversal) < 2 {
+			return nil
+		}
+		if attr, ok := expr.Traversal[1].(hcl.TraverseAttr); ok && !contains(c.references, attr.Name) {
+			c.references = append(c.references, attr.Name)
+		}
+		return nil
+	})
+}
+
+// blockText returns the source of a block with the comment lines directly above it
+func blockText(source []byte, block *hclsyntax.Block) string {
+	blockRange := block.Range()
+	start := bytes.LastIndexByte(source[:blockRange.Start.Byte], '\n') + 1
+	for start > 0 {
+		previousStart := bytes.LastIndexByte(source[:start-1], '\n') + 1
+		line := strings.TrimSpace(string(source[previousStart : start-1]))
+		if !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "//") {
+			break
+		}
+		start = previousStart
+	}
+	return strings.TrimSpace(string(source[start:blockRange.End.Byte]))
+}
+
+// resourceProvider returns the provider of a resource type, the part before the first underscore
+func resourceProvider(resourceType string) string {
+	provider, _, _ := strings.Cut(resourceType, "_")
+	return provider
+}
+
+// firstError describes the first error of a parse
+func firstError(diagnostics hcl.Diagnostics) string {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity != hcl.DiagError {
+			continue
+		}
+		if diagnostic.Subject != nil {
+			return fmt.Sprintf("line %d: %s", diagnostic.Subject.Start.Line, diagnostic.Summary)
+		}
+		return diagnostic.Summary
+	}
+	return diagnostics.Error()
+}
+
+// contains reports whether a slice contains a value
+func contains(values []string, value string) bool {
+	for _, existing := range values {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
@@ -33,6 +33,10 @@ const (
 	EventTypeComplete EventType = "complete"
 	// EventTypeMetrics represents metrics/performance data
 	EventTypeMetrics EventType = "metrics"
+	// EventTypeToken represents a delta of the answer text as it is generated
+	EventTypeToken EventType = "token"
+	// EventTypeReplace carries the final answer text, which replaces the relayed tokens
+	EventTypeReplace EventType = "replace"
 )
 
 // StageType represents different stages in the RAG pipeline
@@ -81,6 +85,7 @@ type EventStream struct {
 	events    []Event
 	mutex     sync.RWMutex
 	closed    bool
+	tokens    int
 }
 
 // NewEventStream creates a new event stream
@@ -172,6 +177,61 @@ func (es *EventStream) EmitComplete(message string, data map[string]interface{})
 	es.EmitEvent(EventTypeComplete, StageComplete, message, 100, data)
 }
 
+// EmitToken emits a delta of the answer text. Unlike other events, callbacks are run
+// synchronously so deltas reach them in order; each delta also carries its index.
+func (es *EventStream) EmitToken(delta string) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	if es.closed {
+		return
+	}
+
+	event := Event{
+		ID:        generateEventID(),
+		Type:      EventTypeToken,
+		Stage:     StageSynthesis,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"delta": delta,
+			"index": es.tokens,
+		},
+	}
+	es.tokens++
+	es.events = append(es.events, event)
+
+	for _, callback := range es.callbacks {
+		callback(event)
+	}
+}
+
+// EmitReplace emits the final answer text after the last token. Clients must show it in
+// place of the text assembled from token deltas, since citation stripping and grounding
+// policies run on the complete answer.
+func (es *EventStream) EmitReplace(text string) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	if es.closed {
+		return
+	}
+
+	event := Event{
+		ID:        generateEventID(),
+		Type:      EventTypeReplace,
+		Stage:     StageSynthesis,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"text": text,
+		},
+	}
+	es.events = append(es.events, event)
+
+	for _, callback := range es.callbacks {
+		callback(event)
+	}
+}
+
 // EmitMetrics emits performance metrics
 func (es *EventStream) EmitMetrics(stage StageType, metrics map[string]interface{}) {
 	es.EmitEvent(EventTypeMetrics, stage, "Performance metrics", 0, metrics)
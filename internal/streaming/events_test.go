@@ -209,6 +209,76 @@ func TestEventStream_EmitComplete(t *testing.T) {
 	}
 }
 
+func TestEventStream_EmitToken(t *testing.T) {
+	stream := NewEventStream("test-stream")
+
+	var received []string
+	stream.AddCallback(func(event Event) {
+		if event.Type != EventTypeToken {
+			t.Errorf("Expected token event, got %s", event.Type)
+		}
+		received = append(received, event.Data["delta"].(string))
+	})
+
+	deltas := []string{"Use ", "Amazon ", "EKS", "."}
+	for _, delta := range deltas {
+		stream.EmitToken(delta)
+	}
+
+	// Token callbacks run synchronously, so every delta has arrived in order
+	if strings.Join(received, "") != "Use Amazon EKS." {
+		t.Errorf("Expected deltas in order, got %q", received)
+	}
+
+	events := stream.GetEvents()
+	if len(events) != len(deltas) {
+		t.Fatalf("Expected %d events, got %d", len(deltas), len(events))
+	}
+	for i, event := range events {
+		if event.Data["index"] != i {
+			t.Errorf("Expected index %d, got %v", i, event.Data["index"])
+		}
+		if event.Stage != StageSynthesis {
+			t.Errorf("Expected synthesis stage, got %s", event.Stage)
+		}
+	}
+
+	stream.Close()
+	stream.EmitToken("ignored")
+	if len(stream.GetEvents()) != len(deltas) {
+		t.Error("Expected no token events after close")
+	}
+}
+
+func TestEventStream_EmitReplace(t *testing.T) {
+	stream := NewEventStream("test-stream")
+
+	var received []Event
+	stream.AddCallback(func(event Event) {
+		received = append(received, event)
+	})
+
+	stream.EmitToken("See [web1].")
+	stream.EmitReplace("See the release notes.")
+
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(received))
+	}
+	replace := received[1]
+	if replace.Type != EventTypeReplace {
+		t.Errorf("Expected replace event, got %s", replace.Type)
+	}
+	if replace.Data["text"] != "See the release notes." {
+		t.Errorf("Expected the final text, got %v", replace.Data["text"])
+	}
+
+	stream.Close()
+	stream.EmitReplace("ignored")
+	if len(stream.GetEvents()) != 2 {
+		t.Error("Expected no replace events after close")
+	}
+}
+
 func TestEventStream_Close(t *testing.T) {
 	stream := NewEventStream("test-stream")
 
@@ -24,6 +24,8 @@ import (
 	"strings"
 	"unicode/utf8"
 
+	"github.com/your-org/ai-sa-assistant/internal/codecheck"
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
 	"github.com/your-org/ai-sa-assistant/internal/session"
 )
 
@@ -45,6 +47,8 @@ const (
 	BusinessQuery
 	// GeneralQuery indicates general-purpose queries
 	GeneralQuery
+	// ComparisonQuery indicates queries weighing two or more cloud platforms against each other
+	ComparisonQuery
 )
 
 // PromptConfig holds configuration for prompt generation
@@ -88,21 +92,37 @@ type SynthesisRequest struct {
 
 // SynthesisResponse represents the structured response from synthesis
 type SynthesisResponse struct {
-	MainText         string               `json:"main_text"`
-	DiagramCode      string               `json:"diagram_code"`
-	DiagramURL       string               `json:"diagram_url,omitempty"`
+	MainText    string `json:"main_text"`
+	DiagramCode string `json:"diagram_code"`
+	DiagramURL  string `json:"diagram_url,omitempty"`
+	// DiagramDownloads maps editable diagram formats (drawio, d2, plantuml) to download URLs
+	DiagramDownloads map[string]string    `json:"diagram_downloads,omitempty"`
 	CodeSnippets     []CodeSnippet        `json:"code_snippets"`
 	Sources          []string             `json:"sources"`
 	ContextSources   []ContextSourceInfo  `json:"context_sources,omitempty"`
 	WebSources       []WebSourceInfo      `json:"web_sources,omitempty"`
 	ProcessingStats  ProcessingStats      `json:"processing_stats,omitempty"`
 	PipelineDecision PipelineDecisionInfo `json:"pipeline_decision,omitempty"`
+	// Sections and Assumptions are only set for answers in OutputModeStructured
+	Sections    []AnswerSection `json:"sections,omitempty"`
+	Assumptions []string        `json:"assumptions,omitempty"`
+	// Grounding is set when claim-level grounding verification is enabled
+	Grounding *GroundingReport `json:"grounding,omitempty"`
+	// CostEstimate is set when the answer's costs were priced from a price list
+	CostEstimate *pricing.Estimate `json:"cost_estimate,omitempty"`
+	// Comparison is set for answers in the side-by-side comparison mode
+	Comparison *Comparison `json:"comparison,omitempty"`
 }
 
 // CodeSnippet represents a code snippet with its language
 type CodeSnippet struct {
 	Language string `json:"language"`
 	Code     string `json:"code"`
+	// Filename and Purpose are only set for answers in OutputModeStructured
+	Filename string `json:"filename,omitempty"`
+	Purpose  string `json:"purpose,omitempty"`
+	// Findings is set when the snippet was validated and problems were found
+	Findings []codecheck.Finding `json:"findings,omitempty"`
 }
 
 // ContextSourceInfo represents detailed information about a context source
@@ -126,7 +146,8 @@ type WebSourceInfo struct {
 	Confidence float64 `json:"confidence"`
 	Freshness  string  `json:"freshness,omitempty"`
 	Domain     string  `json:"domain"`
-	Used       bool    `json:"used"` // Whether this source was actually cited in the response
+	Used       bool    `json:"used"`     // Whether this source was actually cited in the response
+	Verified   bool    `json:"verified"` // Whether web search returned this URL for the request
 }
 
 // ProcessingStats represents processing time and token usage statistics
@@ -140,7 +161,15 @@ type ProcessingStats struct {
 	TotalTokens         int     `json:"total_tokens"`
 	EstimatedCost       float64 `json:"estimated_cost_usd,omitempty"`
 	ModelUsed           string  `json:"model_used"`
-	Temperature         float64 `json:"temperature"`
+	// ModelRoutingReason says why ModelUsed was chosen, such as the query complexity or
+	// a fallback, and ModelFallbacks lists the unavailable models tried before it
+	ModelRoutingReason string   `json:"model_routing_reason,omitempty"`
+	ModelFallbacks     []string `json:"model_fallbacks,omitempty"`
+	Temperature        float64  `json:"temperature"`
+	// PromptTemplateID and PromptTemplateVersion identify the prompt template used,
+	// and are empty when the built-in prompt was used
+	PromptTemplateID      string `json:"prompt_template_id,omitempty"`
+	PromptTemplateVersion int    `json:"prompt_template_version,omitempty"`
 }
 
 // PipelineDecisionInfo represents information about pipeline decisions made during processing
@@ -155,6 +184,9 @@ type PipelineDecisionInfo struct {
 	ContextItemsFiltered   int      `json:"context_items_filtered"`
 	ContextItemsUsed       int      `json:"context_items_used"`
 	Reasoning              string   `json:"reasoning,omitempty"`
+	// InjectionDetections lists the context chunks and web results suspected of prompt
+	// injection and whether they were flagged, neutralized or quarantined
+	InjectionDetections []InjectionDetection `json:"injection_detections,omitempty"`
 }
 
 // BuildPrompt combines context into a comprehensive prompt for the LLM
@@ -182,6 +214,10 @@ func BuildPromptWithConversation(
 type PromptMessages struct {
 	SystemMessage string
 	UserMessage   string
+	// TemplateID and TemplateVersion identify the prompt template the messages were
+	// rendered from, and are empty for the built-in prompt
+	TemplateID      string
+	TemplateVersion int
 }
 
 // BuildPromptMessages creates separate system and user messages with proper structure
@@ -193,6 +229,20 @@ func BuildPromptMessages(query string, contextItems []ContextItem, webResults []
 
 // BuildPromptMessagesWithConfig creates separate system and user messages with configuration
 func BuildPromptMessagesWithConfig(query string, contextItems []ContextItem, webResults []string, config PromptConfig) PromptMessages {
+	messages, err := BuildPromptMessagesFromTemplate(builtinPromptTemplate(), query, contextItems, webResults, nil, config)
+	if err != nil {
+		panic(fmt.Sprintf("failed to render built-in prompt: %v", err))
+	}
+
+	// The built-in prompt is not reported as a prompt template
+	messages.TemplateID = ""
+	messages.TemplateVersion = 0
+	return messages
+}
+
+// selectPromptSources validates, deduplicates, prioritizes and limits the context and
+// web results included in a prompt
+func selectPromptSources(contextItems []ContextItem, webResults []string, config PromptConfig) ([]ContextItem, []string) {
 	// Validate and deduplicate sources before processing
 	validatedContext, err := ValidateAndDeduplicateSources(contextItems)
 	if err != nil {
@@ -201,61 +251,25 @@ func BuildPromptMessagesWithConfig(query string, contextItems []ContextItem, web
 	}
 
 	// Prioritize and limit context based on token constraints
-	optimizedContext := PrioritizeContext(validatedContext, config.MaxContextItems)
-	limitedWebResults := LimitWebResults(webResults, config.MaxWebResults)
-
-	// Build system message
-	systemMessage := buildSystemPrompt(config.QueryType)
-
-	// Build user message
-	var userMessage strings.Builder
-
-	// User query with enhanced contextual emphasis
-	userMessage.WriteString(fmt.Sprintf("User Query: %s\n\n", query))
-
-	// Add contextual parameter extraction instructions
-	userMessage.WriteString(buildContextualParameterInstructions(query))
-
-	// Internal document context
-	if len(optimizedContext) > 0 {
-		userMessage.WriteString("--- Internal Document Context (PRIMARY SOURCE) ---\n")
-		userMessage.WriteString("The following context chunks contain the most relevant and authoritative information for this query.\n")
-		userMessage.WriteString("Base your response PRIMARILY on this context. Reference these chunks throughout your response.\n\n")
-		for i, item := range optimizedContext {
-			userMessage.WriteString(fmt.Sprintf("Context %d [%s]: %s\n\n", i+1, item.SourceID, item.Content))
-		}
-	}
-
-	// Web search results with enhanced URL tracking
-	if len(limitedWebResults) > 0 {
-		userMessage.WriteString("--- Live Web Search Results ---\n")
-		for i, result := range limitedWebResults {
-			formattedResult := formatWebResultWithURL(i+1, result)
-			userMessage.WriteString(formattedResult)
-		}
-	}
-
-	// Add enhanced citation instructions
-	userMessage.WriteString(buildEnhancedCitationInstructions())
-
-	userMessage.WriteString("\nPlease provide your comprehensive response now:")
-
-	finalUserMessage := userMessage.String()
+	return PrioritizeContext(validatedContext, config.MaxContextItems), LimitWebResults(webResults, config.MaxWebResults)
+}
 
+// limitPromptMessages truncates the user message so both messages fit within maxTokens
+func limitPromptMessages(systemMessage, userMessage string, maxTokens int) PromptMessages {
 	// Ensure token limits are respected (split between system and user messages)
-	totalTokens := EstimateTokens(systemMessage) + EstimateTokens(finalUserMessage)
-	if totalTokens > config.MaxTokens {
+	totalTokens := EstimateTokens(systemMessage) + EstimateTokens(userMessage)
+	if totalTokens > maxTokens {
 		// Reserve tokens for system message and truncate user message if needed
 		systemTokens := EstimateTokens(systemMessage)
-		availableUserTokens := config.MaxTokens - systemTokens
+		availableUserTokens := maxTokens - systemTokens
 		if availableUserTokens > 0 {
-			finalUserMessage = TruncateToTokenLimit(finalUserMessage, availableUserTokens)
+			userMessage = TruncateToTokenLimit(userMessage, availableUserTokens)
 		}
 	}
 
 	return PromptMessages{
 		SystemMessage: systemMessage,
-		UserMessage:   finalUserMessage,
+		UserMessage:   userMessage,
 	}
 }
 
@@ -329,7 +343,7 @@ func BuildPromptWithConversationAndConfig(
 
 	// Add current user query with contextual parameter instructions
 	prompt.WriteString(fmt.Sprintf("Current User Query: %s\n\n", query))
-	prompt.WriteString(buildContextualParameterInstructions(query))
+	prompt.WriteString(builtinPromptSection("parameters", query))
 
 	// Add conversation history with allocated tokens
 	conversationTokens := 0
@@ -375,7 +389,7 @@ func BuildPromptWithConversationAndConfig(
 	}
 
 	// Add enhanced citation instructions
-	prompt.WriteString(buildEnhancedCitationInstructions())
+	prompt.WriteString(builtinPromptSection("citations", nil))
 
 	prompt.WriteString("Please provide your comprehensive response now:")
 
@@ -439,15 +453,16 @@ func buildContextSectionWithTokenLimit(contextItems []ContextItem, maxTokens int
 
 	includedItems := 0
 	for i, item := range contextItems {
-		contextEntry := fmt.Sprintf("Context %d [%s]: %s\n\n", i+1, item.SourceID, item.Content)
+		contextEntry := formatContextEntry(i+1, item)
 		entryTokens := EstimateTokens(contextEntry)
 
 		if currentTokens+entryTokens > maxTokens {
 			// Try to include a truncated version if it's the first item and we have reasonable space
 			if includedItems == 0 && maxTokens-currentTokens > 200 {
-				availableTokens := maxTokens - currentTokens - EstimateTokens(fmt.Sprintf("Context %d [%s]: \n\n", i+1, item.SourceID))
-				truncatedContent := truncateMessageContentToTokens(item.Content, availableTokens)
-				builder.WriteString(fmt.Sprintf("Context %d [%s]: %s\n\n", i+1, item.SourceID, truncatedContent))
+				availableTokens := maxTokens - currentTokens - EstimateTokens(formatContextEntry(i+1, ContextItem{SourceID: item.SourceID}))
+				truncated := item
+				truncated.Content = truncateMessageContentToTokens(item.Content, availableTokens)
+				builder.WriteString(formatContextEntry(i+1, truncated))
 				includedItems++
 			}
 			break
@@ -955,6 +970,10 @@ func DetectFreshnessKeywords(query string, keywords []string) bool {
 
 // DetectQueryType analyzes the query to determine its type
 func DetectQueryType(query string) QueryType {
+	if IsComparisonQuery(query) {
+		return ComparisonQuery
+	}
+
 	queryLower := strings.ToLower(query)
 
 	// Technical query indicators
@@ -1027,202 +1046,10 @@ func LimitWebResults(webResults []string, maxResults int) []string {
 	return webResults[:maxResults]
 }
 
-// buildSystemPrompt creates system prompt based on query type
-func buildSystemPrompt(queryType QueryType) string {
-	basePrompt := `You are an expert Cloud Solutions Architect assistant. Your role is to help Solutions Architects with pre-sales research and planning.
-
-CRITICAL CONTEXT PRIORITIZATION REQUIREMENTS:
-- Your response MUST be based PRIMARILY on the provided Internal Document Context chunks
-- The Internal Document Context contains the most relevant and authoritative information for this query
-- PRIORITIZE information from the provided context chunks over your general knowledge
-- Only supplement with general knowledge when the context is insufficient
-- ALWAYS reference specific context chunks using [source_id] format throughout your response
-- If the context contains specific details (VM counts, technologies, procedures), use those EXACT details
-- Build your response around the context content, not generic cloud guidance
-
-Your response MUST be extremely comprehensive, detailed, and implementation-focused. Provide:
-
-1. A thorough, actionable answer with specific implementation steps and detailed explanations
-2. Complete architecture diagrams using Mermaid.js graph TD syntax with comprehensive labeling
-3. MANDATORY: Extensive code snippets and complete configuration files in proper code blocks
-4. Specific commands, scripts, and step-by-step procedures with detailed explanations
-5. In-depth analysis of options, trade-offs, and best practices
-6. Comprehensive cost breakdowns and optimization strategies
-7. Detailed timelines and project phases
-8. Multiple implementation approaches with pros/cons
-9. Always cite your sources using [source_id] format when referencing any information
-
-RESPONSE LENGTH REQUIREMENTS:
-- Minimum 2000 words for complex enterprise queries
-- Provide exhaustive detail on all aspects requested
-- Include comprehensive explanations, not just bullet points
-- Expand on each major section with detailed sub-sections
-- Provide multiple examples and use cases where applicable
-
-CRITICAL CONTEXTUAL SPECIFICITY REQUIREMENTS:
-- EXTRACT and USE specific numbers, quantities, and parameters from the user query
-- REFERENCE exact specifications provided (VM counts, RTO/RPO times, storage sizes, etc.)
-- TAILOR ALL recommendations to the specific technologies mentioned
-- CALCULATE precise costs based on exact specifications provided
-- CUSTOMIZE architecture diagrams to reflect specific requirements
-- AVOID generic cloud migration language - make it specific to the user's exact scenario
-
-MANDATORY COST CALCULATIONS FOR MIGRATION QUERIES:
-- MUST provide specific cost estimates for the exact number of VMs mentioned
-- MUST include monthly AWS infrastructure costs with specific instance types
-- MUST calculate migration costs including AWS MGN usage
-- MUST provide cost comparison between on-premises and AWS
-- MUST include specific storage costs for databases and file systems
-- MUST estimate data transfer costs for the migration
-- MUST provide 3-year total cost of ownership (TCO) analysis
-- MUST include cost optimization recommendations with dollar savings
-- MUST use current AWS pricing (2024) for all calculations
-
-COST CALCULATION EXAMPLE FORMAT:
-### Cost Analysis for 120 VM Migration
-
-**Monthly AWS Infrastructure Costs:**
-- 120 x t3.medium instances: $3,168/month (120 x $26.40)
-- RDS SQL Server (multi-AZ): $520/month
-- EBS Storage (1TB per VM): $12,000/month
-- Data Transfer: $450/month
-- **Total Monthly Cost: $16,138**
-
-**Migration Costs:**
-- AWS MGN replication: $2,400 (120 VMs x $20 per VM)
-- Professional services: $150,000
-- **Total Migration Cost: $152,400**
-
-**3-Year TCO Comparison:**
-- On-premises (3 years): $2,160,000
-- AWS (3 years): $1,631,328
-- **Net Savings: $528,672 (24.5% reduction)**
-
-CRITICAL REQUIREMENTS - Your response MUST include:
-- Specific service configurations with exact parameters based on user requirements
-- Complete code examples (not snippets) with full implementations using specific parameters
-- Detailed step-by-step procedures with commands tailored to specific requirements
-- Specific resource sizing and capacity planning based on exact user specifications
-- Network configurations with IP ranges, subnets, and routing for specific scale
-- Security configurations with exact policy definitions for specific technologies
-- Monitoring and alerting configurations specific to mentioned technologies
-- Troubleshooting procedures and common issues for specific scenarios
-- Cost breakdowns with specific pricing estimates for exact specifications
-- Implementation timelines with detailed task dependencies for specific scale
-- Performance optimization parameters and tuning configurations
-- Backup and disaster recovery procedures with specific recovery steps
-- Validation and testing scripts with comprehensive test cases
-- Operational runbooks with detailed maintenance procedures
-- Capacity planning with growth projections and scaling triggers
-- Security hardening checklists with specific configuration changes
-- Compliance implementation steps with audit procedures
-- Integration patterns with detailed API configurations
-- Automation scripts for deployment and operational tasks
-
-MANDATORY CODE GENERATION - Your response MUST include:
-- Complete Terraform/ARM templates in proper ` + "`terraform`" + ` code blocks
-- Full bash scripts with error handling in proper ` + "`bash`" + ` code blocks
-- Exact CLI commands with all parameters in proper ` + "`bash`" + ` code blocks
-- Complete configuration files (not partial examples) in proper ` + "`yaml`" + ` or ` + "`json`" + ` code blocks
-- Specific instance types, storage configurations, and networking details in code
-- Actual implementation workflows with dependencies in code
-
-CRITICAL: DO NOT say "Below is a complete Terraform configuration" without actually providing the code block. 
-CRITICAL: DO NOT say "Below is a sample bash script" without actually providing the code block.
-CRITICAL: ALWAYS provide the actual code immediately after describing it.
-CRITICAL: For migration queries, MUST provide actual working Terraform code for infrastructure setup.
-
-EXAMPLE CORRECT FORMAT:
-### Terraform Code for Landing Zone Setup
-
-` + "```terraform" + `
-terraform {
-  required_providers {
-    aws = {
-      source  = "hashicorp/aws"
-      version = "~> 5.0"
-    }
-  }
-}
-
-provider "aws" {
-  region = var.aws_region
-}
-
-resource "aws_vpc" "main" {
-  cidr_block           = "10.0.0.0/16"
-  enable_dns_hostnames = true
-  enable_dns_support   = true
-  tags = {
-    Name = "enterprise-migration-vpc"
-  }
-}
-` + "```" + `
-- Detailed validation and testing procedures in code
-
-CODE BLOCK FORMATTING - ALWAYS use proper markdown code blocks:
-- Terraform: ` + "```terraform" + ` ... ` + "```" + `
-- Bash/Shell: ` + "```bash" + ` ... ` + "```" + `
-- AWS CLI: ` + "```bash" + ` ... ` + "```" + `
-- Azure CLI: ` + "```bash" + ` ... ` + "```" + `
-- PowerShell: ` + "```powershell" + ` ... ` + "```" + `
-- YAML: ` + "```yaml" + ` ... ` + "```" + `
-- JSON: ` + "```json" + ` ... ` + "```" + `
-
-FAILURE TO PROVIDE CODE BLOCKS IS UNACCEPTABLE - Every technical query requires implementation-ready code.
-
-Guidelines:
-- Be extremely specific and technical in your recommendations
-- ALWAYS include implementation-ready code that can be executed immediately
-- For diagrams: Use Mermaid.js graph TD syntax with detailed component specifications
-- For code: Provide complete, production-ready configurations in proper code blocks
-- Citations: End sentences with [source_id] or [URL] when using information from any source
-- Focus on immediate implementation guidance with working examples
-
-`
-
-	// Add comprehensive diagram generation instructions
-	diagramInstructions := buildDiagramInstructions(queryType)
-	basePrompt += diagramInstructions
-
-	// Add comprehensive code generation instructions
-	codeInstructions := buildCodeGenerationInstructions(queryType)
-	basePrompt += codeInstructions
-
-	switch queryType {
-	case TechnicalQuery:
-		technicalFocus := `TECHNICAL FOCUS: Provide deep technical implementation details, complete code examples, configuration examples, architectural patterns, and comprehensive best practices. Include specific configurations, performance tuning, and operational procedures.
-
-ENHANCED TECHNICAL DEPTH REQUIREMENTS:
-- Provide extensive code comments explaining each configuration parameter
-- Include multiple implementation approaches with trade-offs analysis
-- Add comprehensive error handling and edge case management
-- Include detailed performance benchmarking and optimization strategies
-- Provide extensive logging and monitoring configurations
-- Include comprehensive security scanning and vulnerability assessments
-- Add detailed capacity planning with resource utilization metrics
-- Include comprehensive backup and recovery validation procedures
-- Provide detailed integration testing and validation scripts
-- Include extensive troubleshooting guides with common failure scenarios
-
-`
-		return basePrompt + technicalFocus
-	case BusinessQuery:
-		businessFocus := `BUSINESS FOCUS: Provide detailed business value analysis, comprehensive cost breakdowns, cost considerations, ROI analysis, detailed timeline estimates, and strategic implications with specific metrics.
-
-`
-		return basePrompt + businessFocus
-	case GeneralQuery:
-		return basePrompt
-	default:
-		return basePrompt
-	}
-}
-
-// buildContextualParameterInstructions creates instructions that emphasize using specific query parameters
-func buildContextualParameterInstructions(query string) string {
+// extractQueryParameters lists the VM counts, recovery objectives, technologies, cloud
+// providers and sizes mentioned in the query, for prompts to emphasize
+func extractQueryParameters(query string) []string {
 	queryLower := strings.ToLower(query)
-	var instructions strings.Builder
 
 	// Check for specific parameters that need emphasis
 	var foundParameters []string
@@ -1278,65 +1105,7 @@ func buildContextualParameterInstructions(query string) string {
 		}
 	}
 
-	// If specific parameters are found, add targeted instructions
-	if len(foundParameters) > 0 {
-		instructions.WriteString("### CRITICAL CONTEXTUAL REQUIREMENTS ###\n")
-		instructions.WriteString("The user query contains SPECIFIC PARAMETERS that MUST be directly addressed in your response:\n")
-
-		for _, param := range foundParameters {
-			instructions.WriteString(fmt.Sprintf("- %s\n", param))
-		}
-
-		instructions.WriteString("\n**MANDATORY RESPONSE REQUIREMENTS:**\n")
-		instructions.WriteString("1. Reference these EXACT numbers and specifications in your response\n")
-		instructions.WriteString("2. Base ALL calculations, sizing, and recommendations on these specific parameters\n")
-		instructions.WriteString("3. Provide tailored solutions that directly address these requirements\n")
-		instructions.WriteString("4. Include specific cost estimates based on these exact specifications\n")
-		instructions.WriteString("5. Generate architecture diagrams that reflect these specific requirements\n")
-		instructions.WriteString("6. Provide implementation code that uses these exact parameters\n")
-		instructions.WriteString("\n**AVOID GENERIC RESPONSES** - Every recommendation must be specifically tailored to these parameters.\n\n")
-	}
-
-	return instructions.String()
-}
-
-// buildDiagramInstructions creates comprehensive Mermaid.js diagram generation instructions
-func buildDiagramInstructions(_ QueryType) string {
-	return buildDiagramHeader() +
-		buildMermaidSyntaxInstructions() +
-		buildCloudArchitecturePatterns() +
-		buildDiagramQualityGuidelines() +
-		buildDiagramFallbackInstructions()
-}
-
-// buildDiagramHeader creates the main header for diagram instructions
-func buildDiagramHeader() string {
-	return `
-## MERMAID.JS DIAGRAM GENERATION INSTRUCTIONS
-
-### When to Generate Diagrams
-Generate architecture diagrams for queries involving:
-- Cloud architecture design (AWS, Azure, GCP, hybrid)
-- Migration planning and lift-and-shift scenarios
-- Disaster recovery and backup strategies
-- Network topology and security configurations
-- Microservices and containerization architectures
-- CI/CD pipeline designs
-- Data flow and integration patterns
-
-`
-}
-
-// buildMermaidSyntaxInstructions creates the syntax requirements section
-func buildMermaidSyntaxInstructions() string {
-	return `### Mermaid Syntax Requirements
-- ALWAYS use "graph TD" (Top-Down) syntax for cloud architecture diagrams
-- Enclose ALL diagram code in triple backticks with "mermaid" language identifier: ` + "```mermaid" + `
-- Use descriptive node names with proper formatting
-- Include subgraphs for logical groupings (environments, regions, services)
-- Use appropriate arrow styles for different connection types
-
-`
+	return foundParameters
 }
 
 // EstimateTokens provides a rough estimate of token count (4 characters ≈ 1 token)
@@ -1380,6 +1149,23 @@ func ValidatePrompt(prompt string) error {
 	return validateCodeInstructions(prompt)
 }
 
+// promptRequirement is text a prompt must contain and how it is described when missing
+type promptRequirement struct {
+	text        string
+	description string
+}
+
+// checkPromptRequirements reports the first requirement missing from the prompt. The
+// requirements are checked in order so the same prompt always fails the same way.
+func checkPromptRequirements(prompt string, requirements []promptRequirement) error {
+	for _, requirement := range requirements {
+		if !strings.Contains(prompt, requirement.text) {
+			return fmt.Errorf("prompt must contain %s", requirement.description)
+		}
+	}
+	return nil
+}
+
 // validateBasicPromptStructure checks basic prompt requirements
 func validateBasicPromptStructure(prompt string) error {
 	if strings.TrimSpace(prompt) == "" {
@@ -1395,57 +1181,33 @@ func validateBasicPromptStructure(prompt string) error {
 
 // validatePromptContent checks for required content sections
 func validatePromptContent(prompt string) error {
-	requiredSections := map[string]string{
-		"User Query:":         "user query section",
-		"Solutions Architect": "Solutions Architect persona",
-		"[source_id]":         "citation instructions",
-	}
-
-	for section, description := range requiredSections {
-		if !strings.Contains(prompt, section) {
-			return fmt.Errorf("prompt must contain %s", description)
-		}
-	}
-
-	return nil
+	return checkPromptRequirements(prompt, []promptRequirement{
+		{"User Query:", "user query section"},
+		{"Solutions Architect", "Solutions Architect persona"},
+		{"[source_id]", "citation instructions"},
+	})
 }
 
 // validateDiagramInstructions checks for Mermaid diagram instruction requirements
 func validateDiagramInstructions(prompt string) error {
-	diagramRequirements := map[string]string{
-		"MERMAID.JS DIAGRAM GENERATION INSTRUCTIONS": "Mermaid.js diagram generation instructions",
-		"graph TD":   "graph TD syntax instructions",
-		"```mermaid": "mermaid code block formatting instructions",
-	}
-
-	for requirement, description := range diagramRequirements {
-		if !strings.Contains(prompt, requirement) {
-			return fmt.Errorf("prompt must contain %s", description)
-		}
-	}
-
-	return nil
+	return checkPromptRequirements(prompt, []promptRequirement{
+		{"MERMAID.JS DIAGRAM GENERATION INSTRUCTIONS", "Mermaid.js diagram generation instructions"},
+		{"graph TD", "graph TD syntax instructions"},
+		{"```mermaid", "mermaid code block formatting instructions"},
+	})
 }
 
 // validateCodeInstructions checks for code generation instruction requirements
 func validateCodeInstructions(prompt string) error {
-	codeRequirements := map[string]string{
-		"CODE GENERATION INSTRUCTIONS":    "code generation instructions",
-		"terraform":                       "Terraform code generation instructions",
-		"AWS CLI":                         "AWS CLI code generation instructions",
-		"Azure CLI":                       "Azure CLI code generation instructions",
-		"PowerShell":                      "PowerShell code generation instructions",
-		"NEVER include hardcoded secrets": "security requirements for code generation", // pragma: allowlist secret
-		"meaningful comments":             "code commenting requirements",
-	}
-
-	for requirement, description := range codeRequirements {
-		if !strings.Contains(prompt, requirement) {
-			return fmt.Errorf("prompt must contain %s", description)
-		}
-	}
-
-	return nil
+	return checkPromptRequirements(prompt, []promptRequirement{
+		{"CODE GENERATION INSTRUCTIONS", "code generation instructions"},
+		{"terraform", "Terraform code generation instructions"},
+		{"AWS CLI", "AWS CLI code generation instructions"},
+		{"Azure CLI", "Azure CLI code generation instructions"},
+		{"PowerShell", "PowerShell code generation instructions"},
+		{"NEVER include hardcoded secrets", "security requirements for code generation"}, // pragma: allowlist secret
+		{"meaningful comments", "code commenting requirements"},
+	})
 }
 
 // DetectArchitectureQuery determines if a query is about architecture and warrants a diagram
@@ -1565,565 +1327,6 @@ func IsBusinessOnlyQuery(query string) bool {
 	return businessScore > 0 && !DetectArchitectureQuery(query)
 }
 
-// buildCodeGenerationInstructions creates comprehensive code generation instructions
-func buildCodeGenerationInstructions(_ QueryType) string {
-	return buildCodeGenerationHeader() +
-		buildTerraformInstructions() +
-		buildAWSCLIInstructions() +
-		buildAzureCLIInstructions() +
-		buildPowerShellInstructions() +
-		buildYAMLJSONInstructions() +
-		buildCodeSecurityRequirements() +
-		buildCodeTestingInstructions()
-}
-
-// buildCodeGenerationHeader creates the header section for code generation instructions
-func buildCodeGenerationHeader() string {
-	return `
-## CODE GENERATION INSTRUCTIONS
-
-### When to Generate Code
-Generate code snippets for queries involving:
-- Infrastructure deployment and configuration
-- Cloud resource provisioning and management
-- Migration and deployment automation
-- Configuration management and orchestration
-- Security implementations and compliance
-- Monitoring, logging, and observability setup
-- CI/CD pipeline configurations
-- Backup, disaster recovery, and automation scripts
-
-### Language and Tool Requirements
-
-`
-}
-
-// buildTerraformInstructions creates Terraform-specific code generation instructions
-func buildTerraformInstructions() string {
-	return `#### Terraform (Infrastructure as Code) - MANDATORY FOR ALL INFRASTRUCTURE QUERIES
-- MUST generate complete Terraform configurations for all infrastructure requests
-- ALWAYS include provider configuration (AWS, Azure, GCP)
-- MUST use meaningful resource names with proper naming conventions
-- MUST include data sources for existing resources
-- MUST add variable definitions and output values
-- MANDATORY format: ` + "`terraform`" + ` code blocks
-
-TERRAFORM CODE GENERATION REQUIREMENTS:
-- Generate COMPLETE Terraform configurations, not partial examples
-- Include ALL required resources for the requested infrastructure
-- Add proper variable definitions and outputs
-- Include tags and naming conventions
-- Add security configurations (security groups, NACLs, etc.)
-
-CRITICAL INSTRUCTION: When you write "### Terraform Code for Landing Zone Setup" or similar, 
-you MUST immediately follow it with an actual terraform code block. DO NOT leave it empty.
-Example:
-### Terraform Code for Landing Zone Setup
-
-` + "```terraform" + `
-# Your actual Terraform code here
-terraform {
-  required_providers {
-    aws = {
-      source  = "hashicorp/aws"
-      version = "~> 5.0"
-    }
-  }
-}
-# ... rest of actual code
-` + "```" + `
-- Include networking configurations (VPCs, subnets, route tables)
-- Add monitoring and logging configurations
-
-MANDATORY Example Pattern for AWS VPC:
-` + "```terraform" + `
-# Configure the AWS Provider
-terraform {
-  required_providers {
-    aws = {
-      source  = "hashicorp/aws"
-      version = "~> 5.0"
-    }
-  }
-}
-
-# Configure the AWS Provider
-provider "aws" {
-  region = var.aws_region
-}
-
-# Variables
-variable "aws_region" {
-  description = "AWS region"
-  type        = string
-  default     = "us-west-2"
-}
-
-variable "vpc_cidr" {
-  description = "CIDR block for VPC"
-  type        = string
-  default     = "10.0.0.0/16"
-}
-
-variable "project_name" {
-  description = "Project name for resource naming"
-  type        = string
-  default     = "my-project"
-}
-
-variable "environment" {
-  description = "Environment name"
-  type        = string
-  default     = "production"
-}
-
-# Create VPC
-resource "aws_vpc" "main" {
-  cidr_block           = var.vpc_cidr
-  enable_dns_hostnames = true
-  enable_dns_support   = true
-
-  tags = {
-    Name        = "$${var.project_name}-vpc"
-    Environment = var.environment
-  }
-}
-
-# Create Internet Gateway
-resource "aws_internet_gateway" "main" {
-  vpc_id = aws_vpc.main.id
-
-  tags = {
-    Name        = "$${var.project_name}-igw"
-    Environment = var.environment
-  }
-}
-
-# Create public subnet
-resource "aws_subnet" "public" {
-  vpc_id                  = aws_vpc.main.id
-  cidr_block              = "10.0.1.0/24"
-  availability_zone       = "$${var.aws_region}a"
-  map_public_ip_on_launch = true
-
-  tags = {
-    Name        = "$${var.project_name}-public-subnet"
-    Environment = var.environment
-  }
-}
-
-# Create private subnet
-resource "aws_subnet" "private" {
-  vpc_id            = aws_vpc.main.id
-  cidr_block        = "10.0.2.0/24"
-  availability_zone = "$${var.aws_region}a"
-
-  tags = {
-    Name        = "$${var.project_name}-private-subnet"
-    Environment = var.environment
-  }
-}
-
-# Create route table for public subnet
-resource "aws_route_table" "public" {
-  vpc_id = aws_vpc.main.id
-
-  route {
-    cidr_block = "0.0.0.0/0"
-    gateway_id = aws_internet_gateway.main.id
-  }
-
-  tags = {
-    Name        = "$${var.project_name}-public-rt"
-    Environment = var.environment
-  }
-}
-
-# Associate route table with public subnet
-resource "aws_route_table_association" "public" {
-  subnet_id      = aws_subnet.public.id
-  route_table_id = aws_route_table.public.id
-}
-
-# Outputs
-output "vpc_id" {
-  description = "VPC ID"
-  value       = aws_vpc.main.id
-}
-
-output "public_subnet_id" {
-  description = "Public subnet ID"
-  value       = aws_subnet.public.id
-}
-
-output "private_subnet_id" {
-  description = "Private subnet ID"
-  value       = aws_subnet.private.id
-}
-` + "```" + `
-
-**CRITICAL: Every infrastructure query MUST include complete, executable Terraform code like the above example.**
-
-`
-}
-
-// buildAWSCLIInstructions creates AWS CLI-specific code generation instructions
-func buildAWSCLIInstructions() string {
-	return `#### AWS CLI Commands
-- Use for AWS resource management and automation
-- Include profile and region specifications where applicable
-- Use meaningful output formats (json, table, text)
-- Include error handling and validation
-- Format: ` + "`bash`" + ` or ` + "`aws`" + `
-
-Example Pattern:
-` + "```bash" + `
-#!/bin/bash
-# AWS CLI script for EC2 instance management
-
-# Set default region and profile
-export AWS_DEFAULT_REGION=us-west-2
-export AWS_PROFILE=production
-
-# Create EC2 instance
-aws ec2 run-instances \
-  --image-id ami-0abcdef1234567890 \
-  --instance-type t3.medium \
-  --key-name my-key-pair \
-  --security-group-ids sg-0123456789abcdef0 \
-  --subnet-id subnet-0123456789abcdef0 \
-  --user-data file://user-data.sh \
-  --tag-specifications 'ResourceType=instance,Tags=[{Key=Name,Value=MyInstance}]' \
-  --output json
-
-# Wait for instance to be running
-aws ec2 wait instance-running --instance-ids i-0123456789abcdef0
-
-# Get instance information
-aws ec2 describe-instances \
-  --instance-ids i-0123456789abcdef0 \
-  --query 'Reservations[0].Instances[0].{ID:InstanceId,State:State.Name}' \
-  --output table
-` + "```" + `
-
-`
-}
-
-// buildAzureCLIInstructions creates Azure CLI-specific code generation instructions
-func buildAzureCLIInstructions() string {
-	return `#### Azure CLI Commands
-- Use for Azure resource management and automation
-- Include subscription and resource group specifications
-- Use meaningful output formats (json, table, yaml)
-- Include resource tagging and naming conventions
-- Format: ` + "`bash`" + ` or ` + "`azure`" + `
-
-Example Pattern:
-` + "```bash" + `
-#!/bin/bash
-# Azure CLI script for VM deployment
-
-# Set default subscription and resource group
-az account set --subscription "Production"
-RESOURCE_GROUP="rg-production-eastus"
-LOCATION="eastus"
-
-# Create resource group if it doesn't exist
-az group create --name $RESOURCE_GROUP --location $LOCATION
-
-# Create virtual network
-az network vnet create \
-  --resource-group $RESOURCE_GROUP \
-  --name vnet-production \
-  --address-prefix 10.0.0.0/16 \
-  --subnet-name subnet-web \
-  --subnet-prefix 10.0.1.0/24
-
-# Create virtual machine
-az vm create \
-  --resource-group $RESOURCE_GROUP \
-  --name vm-web-01 \
-  --image Ubuntu2204 \
-  --admin-username azureuser \
-  --generate-ssh-keys \
-  --vnet-name vnet-production \
-  --subnet subnet-web \
-  --size Standard_B2s \
-  --tags Environment=Production Team=WebDev
-` + "```" + `
-
-`
-}
-
-// buildPowerShellInstructions creates PowerShell-specific code generation instructions
-func buildPowerShellInstructions() string {
-	return `#### PowerShell (Azure/Windows Automation)
-- Use for Windows-centric Azure automation
-- Include error handling and progress indicators
-- Use meaningful variable names and parameter validation
-- Include logging and status reporting
-- Format: ` + "`powershell`" + `
-
-Example Pattern:
-` + "```powershell" + `
-# Azure PowerShell script for resource deployment
-param(
-    [Parameter(Mandatory=$true)]
-    [string]$ResourceGroupName,
-
-    [Parameter(Mandatory=$true)]
-    [string]$Location,
-
-    [Parameter(Mandatory=$false)]
-    [string]$Environment = "Production"
-)
-
-# Connect to Azure (if not already connected)
-if (-not (Get-AzContext)) {
-    Write-Host "Connecting to Azure..." -ForegroundColor Yellow
-    Connect-AzAccount
-}
-
-try {
-    Write-Host "Starting deployment to $ResourceGroupName" -ForegroundColor Green
-
-    # Create resource group
-    $resourceGroup = New-AzResourceGroup -Name $ResourceGroupName -Location $Location -Force
-    Write-Host "Resource group created: $($resourceGroup.ResourceGroupName)" -ForegroundColor Green
-
-    # Deploy ARM template
-    $deploymentResult = New-AzResourceGroupDeployment \
-        -ResourceGroupName $ResourceGroupName \
-        -TemplateFile "azuredeploy.json" \
-        -Environment $Environment \
-        -Verbose
-
-    Write-Host "Deployment completed successfully" -ForegroundColor Green
-}
-catch {
-    Write-Error "Deployment failed: $($_.Exception.Message)"
-    Write-Host "Rolling back changes..." -ForegroundColor Yellow
-    exit 1
-}
-finally {
-    Write-Host "Cleanup completed" -ForegroundColor Blue
-}
-` + "```" + `
-
-`
-}
-
-// buildYAMLJSONInstructions creates YAML/JSON configuration file instructions
-func buildYAMLJSONInstructions() string {
-	return `#### YAML/JSON Configuration Files
-- Use for Kubernetes manifests, CI/CD pipelines, and configuration management
-- Follow proper indentation and structure guidelines
-- Include metadata and labels for proper organization
-- Add validation and schema references where applicable
-- Format: ` + "`yaml`" + ` or ` + "`json`" + `
-
-Example YAML Pattern:
-` + "```yaml" + `
-apiVersion: v1
-kind: ConfigMap
-metadata:
-  name: app-config
-  namespace: production
-  labels:
-    app: web-service
-    environment: production
-data:
-  database_url: "postgresql://db.example.com:5432/prod"
-  cache_enabled: "true"
-  log_level: "info"
----
-apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: web-service
-  namespace: production
-spec:
-  replicas: 3
-  selector:
-    matchLabels:
-      app: web-service
-  template:
-    metadata:
-      labels:
-        app: web-service
-    spec:
-      containers:
-      - name: web
-        image: nginx:1.21
-        ports:
-        - containerPort: 80
-` + "```" + `
-
-`
-}
-
-// buildCodeTestingInstructions creates testing and integration instructions
-func buildCodeTestingInstructions() string {
-	return `### Integration and Testing Considerations
-- Include unit tests for complex scripts
-- Add integration testing steps
-- Include deployment validation checks
-- Add monitoring and alerting configurations
-- Include rollback and recovery procedures
-
-`
-}
-
-// buildCloudArchitecturePatterns creates cloud architecture pattern examples
-func buildCloudArchitecturePatterns() string {
-	return `
-
-### Cloud Architecture Diagram Conventions
-
-#### AWS Architecture Diagrams
-- Use subgraphs for VPCs, Availability Zones, and service groupings
-- Node naming: Use AWS service names (EC2, RDS, S3, Lambda, etc.)
-- Include security groups, subnets, and load balancers
-- Show data flow with labeled arrows
-
-Example AWS Pattern:
-` + "```" + `
-graph TD
-    subgraph "AWS Cloud"
-        subgraph "VPC: 10.0.0.0/16"
-            subgraph "Public Subnet"
-                ALB[Application Load Balancer]
-                NAT[NAT Gateway]
-            end
-            subgraph "Private Subnet"
-                EC2[EC2 Instances]
-                RDS[RDS Database]
-            end
-        end
-        S3[S3 Buckets]
-    end
-    Users[Users] --> ALB
-    ALB --> EC2
-    EC2 --> RDS
-    EC2 --> S3
-` + "```" + `
-
-#### Azure Architecture Diagrams
-- Use subgraphs for Resource Groups, Virtual Networks, and subscriptions
-- Node naming: Use Azure service names (VM, SQL Database, Storage Account, etc.)
-- Include Azure-specific components (Application Gateway, Traffic Manager)
-- Show resource relationships and dependencies
-
-Example Azure Pattern:
-` + "```" + `
-graph TD
-    subgraph "Azure Subscription"
-        subgraph "Resource Group"
-            subgraph "Virtual Network: 10.1.0.0/16"
-                subgraph "Public Subnet"
-                    AG[Application Gateway]
-                    LB[Load Balancer]
-                end
-                subgraph "Private Subnet"
-                    VM[Virtual Machines]
-                    SQL[SQL Database]
-                end
-            end
-            Storage[Storage Account]
-        end
-    end
-    Users[Users] --> AG
-    AG --> VM
-    VM --> SQL
-    VM --> Storage
-` + "```" + `
-
-#### Hybrid Cloud Architecture Diagrams
-- Show connections between on-premises and cloud environments
-- Include VPN or ExpressRoute connections
-- Separate subgraphs for different environments
-- Show data synchronization and backup flows
-
-Example Hybrid Pattern:
-` + "```" + `
-graph TD
-    subgraph "On-Premises"
-        OnPremServers[Legacy Servers]
-        OnPremDB[On-Prem Database]
-        VPNGateway[VPN Gateway]
-    end
-
-    subgraph "AWS Cloud"
-        subgraph "VPC"
-            CloudServers[EC2 Instances]
-            CloudDB[RDS Database]
-            CloudVPN[VPN Connection]
-        end
-    end
-
-    OnPremServers --> VPNGateway
-    VPNGateway -.-> CloudVPN
-    CloudVPN --> CloudServers
-    OnPremDB -.-> CloudDB
-    CloudServers --> CloudDB
-` + "```" + `
-
-`
-}
-
-// buildDiagramQualityGuidelines creates quality and formatting guidelines
-func buildDiagramQualityGuidelines() string {
-	return `### Diagram Quality Requirements
-- Include 5-15 nodes for optimal clarity
-- Use meaningful node labels (not generic terms)
-- Group related components in subgraphs
-- Show clear data flow direction with arrows
-- Include security boundaries and access controls
-- Use consistent naming conventions throughout
-
-### Node Formatting Guidelines
-- Use PascalCase for service names: EC2, RDS, S3
-- Use descriptive labels: "Web Servers" instead of "Servers"
-- Include capacity or scale indicators when relevant
-- Use square brackets for services: [EC2 Instances]
-- Use parentheses for external entities: (Users)
-- Use curly braces for databases: {RDS Database}
-
-### Arrow Types and Meanings
-- Solid arrows (-->) for primary data flow
-- Dashed arrows (-.->)  for secondary or backup connections
-- Thick arrows (==>) for high-bandwidth connections
-- Dotted arrows (...>) for occasional or batch data transfer
-
-`
-}
-
-// buildDiagramFallbackInstructions creates fallback and format instructions
-func buildDiagramFallbackInstructions() string {
-	return `### Fallback Instructions
-If the query is NOT about architecture, infrastructure, or technical implementation:
-- Do NOT generate a diagram
-- Focus on textual response with bullet points and structured information
-- Only include diagrams if they genuinely add value to the architectural understanding
-
-### Common Diagram Mistakes to Avoid
-- Do NOT use "graph LR" (Left-Right) - always use "graph TD" (Top-Down)
-- Do NOT create overcomplicated diagrams with too many nodes
-- Do NOT use generic node names like "Server1", "Database1"
-- Do NOT forget to enclose diagram code in proper markdown code blocks
-- Do NOT include diagrams for non-architectural queries
-
-### Code Block Format
-Always format Mermaid diagrams exactly like this:
-
-` + "```mermaid" + `
-graph TD
-    [Your diagram content here]
-` + "```" + `
-
-`
-}
-
 // validateCodeSecurity validates code snippets for security issues
 func validateCodeSecurity(code, language string) bool {
 	// Check for potential security issues
@@ -2393,17 +1596,20 @@ func normalizeLanguage(language string) string {
 }
 
 // formatWebResultWithURL formats a web result with URL validation and source attribution
+// as a delimited untrusted block
 func formatWebResultWithURL(index int, result string) string {
 	url := extractURLFromWebResult(result)
 
+	result = EscapeUntrustedContent(result)
+
 	switch {
 	case url != "" && isValidURL(url):
-		return fmt.Sprintf("Web Result %d [%s]: %s\n\n", index, url, result)
+		return wrapUntrustedContent(url, fmt.Sprintf("Web Result %d [%s]: %s", index, EscapeUntrustedContent(url), result))
 	case url != "" && !isValidURL(url):
-		return fmt.Sprintf("Web Result %d [Invalid URL]: %s\n\n", index, result)
+		return wrapUntrustedContent("web", fmt.Sprintf("Web Result %d [Invalid URL]: %s", index, result))
 	default:
 		// When no URL is found, use simple format without brackets
-		return fmt.Sprintf("Web Result %d: %s\n\n", index, result)
+		return wrapUntrustedContent("web", fmt.Sprintf("Web Result %d: %s", index, result))
 	}
 }
 
@@ -2578,64 +1784,6 @@ func TrackWebSearchSources(webResults []string) []string {
 	return validURLs
 }
 
-// buildCodeSecurityRequirements creates security and quality requirements for code generation
-func buildCodeSecurityRequirements() string {
-	return `### Code Quality and Security Requirements
-- NEVER include hardcoded secrets, API keys, passwords, or sensitive data
-- Use environment variables, parameter stores, or secret management services for sensitive configuration
-- Implement least-privilege access principles
-- Include meaningful comments explaining complex logic
-- Add error handling and validation for all inputs
-- Use secure defaults and encryption configurations
-- Include proper indentation and structure for readability
-- Follow language-specific security best practices
-
-### Security Best Practices
-- Enable encryption in transit and at rest
-- Implement proper authentication and authorization
-- Use secure communication protocols (HTTPS, TLS)
-- Apply principle of least privilege for access controls
-- Regular security patching and updates
-- Implement logging and monitoring for security events
-
-### Code Block Formatting Requirements
-- Use proper language identifiers for syntax highlighting
-- Include descriptive comments within code blocks
-- Follow consistent indentation and formatting standards
-- Add line breaks for readability in complex configurations
-- Use meaningful variable and resource names
-
-### Conditional Code Generation Based on Platform
-- Detect platform context from query (AWS, Azure, GCP, hybrid)
-- Adapt code examples to the specific cloud provider
-- Include platform-specific best practices and conventions
-- Use appropriate tooling and services for each platform
-- Provide cross-platform alternatives when applicable
-
-### Error Handling Patterns
-- Implement try-catch blocks for exception handling
-- Add validation for input parameters and configurations
-- Include graceful degradation for service failures
-- Provide clear error messages and logging
-- Implement retry logic with exponential backoff
-
-### Documentation Requirements
-- Include inline documentation for complex operations
-- Add parameter descriptions and usage examples
-- Include troubleshooting steps and common issues
-- Document any prerequisites or dependencies
-- Provide clear installation and configuration instructions
-
-### Fallback Instructions for Non-Technical Queries
-- For non-technical queries, focus on explanatory content
-- Provide conceptual overviews instead of code implementations
-- Include high-level architectural guidance
-- Offer business-focused recommendations and considerations
-- Suggest when technical implementation would be beneficial
-
-`
-}
-
 // formatConversationHistory formats conversation history for inclusion in prompts with token-aware truncation
 
 // formatConversationHistoryWithTokenLimit formats conversation history with a specific token limit
@@ -2816,6 +1964,7 @@ func buildWebSourceInfo(webResults []string, citedSources []string) []WebSourceI
 			Freshness:  "recent",
 			Domain:     domain,
 			Used:       citedSourceMap[url],
+			Verified:   true, // Returned by web search for this request
 		}
 
 		webSources = append(webSources, webSource)
@@ -2989,7 +2138,7 @@ If the query is clear and complete, respond with:
 			if i >= 3 { // Limit context for clarification analysis
 				break
 			}
-			prompt.WriteString(fmt.Sprintf("Context %d [%s]: %s\n\n", i+1, item.SourceID, item.Content))
+			prompt.WriteString(formatContextEntry(i+1, item))
 		}
 	}
 
@@ -3053,7 +2202,7 @@ func BuildFollowupPrompt(query string, contextItems []ContextItem, conversationH
 			if i >= 5 { // Limit context for follow-up
 				break
 			}
-			prompt.WriteString(fmt.Sprintf("Context %d [%s]: %s\n\n", i+1, item.SourceID, item.Content))
+			prompt.WriteString(formatContextEntry(i+1, item))
 		}
 	}
 
@@ -3204,15 +2353,3 @@ func validateCodeGeneration(query string, codeSnippets []CodeSnippet) {
 		}
 	}
 }
-
-// buildEnhancedCitationInstructions builds enhanced citation instructions for the prompt
-func buildEnhancedCitationInstructions() string {
-	return `
-SOURCE CITATION REQUIREMENTS:
-- When referencing information from internal documents, cite with [source_id] format
-- When referencing information from web search results, cite with [URL] format
-- Every factual claim should have a corresponding source citation
-- Use the exact source identifiers provided in the context sections above
-
-`
-}
@@ -0,0 +1,179 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Handling of cited URLs that web search did not return
+const (
+	// CitationModeStrip removes unverified URLs from the answer text
+	CitationModeStrip = "strip"
+	// CitationModeFlag keeps unverified URLs in the answer text
+	CitationModeFlag = "flag"
+)
+
+var (
+	// citedURLRegex matches http(s) URLs in answer text
+	citedURLRegex = regexp.MustCompile(`https?://[^\s\[\]()<>"'` + "`" + `]+`)
+	// markdownLinkRegex matches [text](url) links
+	markdownLinkRegex = regexp.MustCompile(`\[([^\]]*)\]\((https?://[^)\s]+)\)`)
+	// bracketURLRegex matches [url] citations
+	bracketURLRegex = regexp.MustCompile(`\[\s*(https?://[^\]\s]+)\s*\]`)
+	// spaceBeforePunctuationRegex tidies text left behind by removed citations
+	spaceBeforePunctuationRegex = regexp.MustCompile(`[ \t]+([.,;:!?])`)
+	// repeatedSpaceRegex collapses runs of spaces and tabs
+	repeatedSpaceRegex = regexp.MustCompile(`[ \t]{2,}`)
+)
+
+// CitationVerification lists the web URLs cited in an answer, split by whether web
+// search returned them for the request
+type CitationVerification struct {
+	Verified   []string `json:"verified"`
+	Unverified []string `json:"unverified"`
+}
+
+// VerifyWebCitations checks every URL cited in the answer against the web results
+// returned by search for the request. Web sources returned by search are marked
+// verified; cited URLs that search did not return are added as unverified web sources,
+// removed from Sources and, in CitationModeStrip, removed from the answer text.
+// URLs that are the source IDs of the request's context chunks, such as internal
+// documents and release notes, are not web citations and are left alone.
+func VerifyWebCitations(result *SynthesisResponse, webResults, contextSources []string, mode string) CitationVerification {
+	returned := make(map[string]bool)
+	for _, webResult := range webResults {
+		if resultURL := extractURLFromWebResult(webResult); resultURL != "" {
+			returned[normalizeCitationURL(resultURL)] = true
+		}
+	}
+	fromContext := make(map[string]bool, len(contextSources))
+	for _, source := range contextSources {
+		fromContext[normalizeCitationURL(source)] = true
+	}
+
+	var verification CitationVerification
+	unverified := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, cited := range citedURLRegex.FindAllString(result.MainText, -1) {
+		cited = trimCitationURL(cited)
+		key := normalizeCitationURL(cited)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if fromContext[key] && !returned[key] {
+			continue
+		}
+		if returned[key] {
+			verification.Verified = append(verification.Verified, cited)
+		} else {
+			verification.Unverified = append(verification.Unverified, cited)
+			unverified[key] = true
+		}
+	}
+
+	if len(result.WebSources) == 0 && len(webResults) > 0 {
+		result.WebSources = buildWebSourceInfo(webResults, verification.Verified)
+	}
+	for i := range result.WebSources {
+		key := normalizeCitationURL(result.WebSources[i].URL)
+		result.WebSources[i].Verified = returned[key]
+		if seen[key] {
+			result.WebSources[i].Used = true
+		}
+	}
+
+	if len(unverified) == 0 {
+		return verification
+	}
+
+	for _, cited := range verification.Unverified {
+		result.WebSources = append(result.WebSources, WebSourceInfo{
+			URL:      cited,
+			Domain:   extractDomainFromURL(cited),
+			Used:     true,
+			Verified: false,
+		})
+	}
+
+	sources := make([]string, 0, len(result.Sources))
+	for _, source := range result.Sources {
+		if !unverified[normalizeCitationURL(source)] {
+			sources = append(sources, source)
+		}
+	}
+	result.Sources = sources
+
+	if mode != CitationModeFlag {
+		result.MainText = stripCitations(result.MainText, unverified)
+	}
+	return verification
+}
+
+// stripCitations removes the unverified URLs from text. Markdown links keep their text.
+func stripCitations(text string, unverified map[string]bool) string {
+	text = markdownLinkRegex.ReplaceAllStringFunc(text, func(link string) string {
+		match := markdownLinkRegex.FindStringSubmatch(link)
+		if unverified[normalizeCitationURL(match[2])] {
+			return match[1]
+		}
+		return link
+	})
+	text = bracketURLRegex.ReplaceAllStringFunc(text, func(citation string) string {
+		match := bracketURLRegex.FindStringSubmatch(citation)
+		if unverified[normalizeCitationURL(match[1])] {
+			return ""
+		}
+		return citation
+	})
+	text = citedURLRegex.ReplaceAllStringFunc(text, func(cited string) string {
+		trimmed := trimCitationURL(cited)
+		if unverified[normalizeCitationURL(trimmed)] {
+			return strings.TrimPrefix(cited, trimmed)
+		}
+		return cited
+	})
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = spaceBeforePunctuationRegex.ReplaceAllString(line, "$1")
+		lines[i] = strings.TrimRight(repeatedSpaceRegex.ReplaceAllString(line, " "), " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// trimCitationURL drops sentence punctuation that follows a URL in running text
+func trimCitationURL(cited string) string {
+	return strings.TrimRight(cited, ".,;:!?")
+}
+
+// normalizeCitationURL reduces a URL to the parts that identify a page, so that scheme,
+// letter case, a leading www., trailing slashes and fragments do not affect matching
+func normalizeCitationURL(rawURL string) string {
+	rawURL = trimCitationURL(strings.TrimSpace(rawURL))
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return strings.ToLower(rawURL)
+	}
+	host := strings.TrimPrefix(strings.ToLower(parsed.Host), "www.")
+	normalized := host + strings.TrimRight(parsed.EscapedPath(), "/")
+	if parsed.RawQuery != "" {
+		normalized += "?" + parsed.RawQuery
+	}
+	return normalized
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"strings"
+	"testing"
+)
+
+var citationWebResults = []string{
+	"Title: EKS 1.31\nSnippet: EKS supports Kubernetes 1.31\nURL: https://aws.amazon.com/about-aws/whats-new/2024/09/eks-1-31/",
+	"Title: AKS release notes\nSnippet: Latest AKS changes\nURL: https://learn.microsoft.com/en-us/azure/aks/release-notes",
+}
+
+const citationAnswer = "EKS now supports Kubernetes 1.31 [https://aws.amazon.com/about-aws/whats-new/2024/09/eks-1-31]. " +
+	"AKS ships monthly updates, see [the notes](https://www.learn.microsoft.com/en-us/azure/aks/release-notes#latest). " +
+	"GKE added the same version [https://cloud.google.com/kubernetes-engine/docs/release-notes]. " +
+	"More details at https://blog.example.com/k8s-131.\nNext steps follow."
+
+func TestVerifyWebCitationsStrip(t *testing.T) {
+	result := SynthesisResponse{
+		MainText: citationAnswer,
+		Sources:  []string{"https://cloud.google.com/kubernetes-engine/docs/release-notes", "runbook-eks"},
+	}
+
+	verification := VerifyWebCitations(&result, citationWebResults, nil, CitationModeStrip)
+
+	if len(verification.Verified) != 2 {
+		t.Errorf("Expected 2 verified citations, got %v", verification.Verified)
+	}
+	if len(verification.Unverified) != 2 {
+		t.Fatalf("Expected 2 unverified citations, got %v", verification.Unverified)
+	}
+
+	for _, unverified := range []string{"cloud.google.com", "blog.example.com"} {
+		if strings.Contains(result.MainText, unverified) {
+			t.Errorf("Expected %s to be stripped from the answer: %q", unverified, result.MainText)
+		}
+	}
+	if !strings.Contains(result.MainText, "GKE added the same version.") {
+		t.Errorf("Expected stripped citation to leave a clean sentence: %q", result.MainText)
+	}
+	if !strings.Contains(result.MainText, "[https://aws.amazon.com/about-aws/whats-new/2024/09/eks-1-31]") {
+		t.Errorf("Expected verified citation to be kept: %q", result.MainText)
+	}
+	if !strings.Contains(result.MainText, "\nNext steps follow.") {
+		t.Errorf("Expected line breaks to be preserved: %q", result.MainText)
+	}
+
+	if len(result.Sources) != 1 || result.Sources[0] != "runbook-eks" {
+		t.Errorf("Expected unverified URL to be removed from sources, got %v", result.Sources)
+	}
+
+	if len(result.WebSources) != 4 {
+		t.Fatalf("Expected 2 returned and 2 unverified web sources, got %d", len(result.WebSources))
+	}
+	for _, source := range result.WebSources[:2] {
+		if !source.Verified || !source.Used {
+			t.Errorf("Expected returned source %s to be verified and used", source.URL)
+		}
+	}
+	for _, source := range result.WebSources[2:] {
+		if source.Verified || !source.Used {
+			t.Errorf("Expected cited source %s to be flagged unverified", source.URL)
+		}
+	}
+}
+
+func TestVerifyWebCitationsFlag(t *testing.T) {
+	result := SynthesisResponse{MainText: citationAnswer}
+
+	verification := VerifyWebCitations(&result, citationWebResults, nil, CitationModeFlag)
+
+	if result.MainText != citationAnswer {
+		t.Errorf("Expected flag mode to keep the answer text unchanged")
+	}
+	if len(verification.Unverified) != 2 {
+		t.Errorf("Expected 2 unverified citations, got %v", verification.Unverified)
+	}
+	if result.WebSources[len(result.WebSources)-1].Domain != "blog.example.com" {
+		t.Errorf("Expected unverified source domain, got %+v", result.WebSources[len(result.WebSources)-1])
+	}
+}
+
+func TestVerifyWebCitationsWithoutWebResults(t *testing.T) {
+	result := SynthesisResponse{MainText: "Use the runbook [runbook-eks]."}
+
+	verification := VerifyWebCitations(&result, nil, nil, CitationModeStrip)
+
+	if len(verification.Verified) != 0 || len(verification.Unverified) != 0 {
+		t.Errorf("Expected no web citations, got %+v", verification)
+	}
+	if result.MainText != "Use the runbook [runbook-eks]." || len(result.WebSources) != 0 {
+		t.Errorf("Expected response to be unchanged, got %+v", result)
+	}
+}
+
+func TestVerifyWebCitationsKeepsContextSources(t *testing.T) {
+	internalURL := "https://wiki.example.com/runbooks/eks-upgrade"
+	result := SynthesisResponse{
+		MainText: "Follow the upgrade runbook [" + internalURL + "/]. " +
+			"GKE added the same version [https://cloud.google.com/kubernetes-engine/docs/release-notes].",
+		Sources: []string{internalURL},
+	}
+
+	verification := VerifyWebCitations(&result, citationWebResults, []string{internalURL, "runbook-eks"}, CitationModeStrip)
+
+	if len(verification.Unverified) != 1 || !strings.Contains(verification.Unverified[0], "cloud.google.com") {
+		t.Errorf("Expected only the GKE citation to be unverified, got %v", verification.Unverified)
+	}
+	if !strings.Contains(result.MainText, "["+internalURL+"/]") {
+		t.Errorf("Expected cited context source to be kept: %q", result.MainText)
+	}
+	if len(result.Sources) != 1 || result.Sources[0] != internalURL {
+		t.Errorf("Expected context source to stay in sources, got %v", result.Sources)
+	}
+	for _, source := range result.WebSources {
+		if source.URL == internalURL || source.URL == internalURL+"/" {
+			t.Errorf("Expected context source not to be listed as a web source: %+v", source)
+		}
+	}
+}
+
+func TestNormalizeCitationURL(t *testing.T) {
+	tests := map[string]string{
+		"https://www.Example.com/docs/":     "example.com/docs",
+		"http://example.com/docs#section":   "example.com/docs",
+		"https://example.com/search?q=eks.": "example.com/search?q=eks",
+		"https://example.com":               "example.com",
+		"not a url":                         "not a url",
+	}
+	for input, expected := range tests {
+		if got := normalizeCitationURL(input); got != expected {
+			t.Errorf("normalizeCitationURL(%q) = %q, want %q", input, got, expected)
+		}
+	}
+}
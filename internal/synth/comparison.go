@@ -0,0 +1,431 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
+)
+
+// Comparison platforms, named as in the platform metadata the retrieve service filters on
+const (
+	PlatformAWS   = "aws"
+	PlatformAzure = "azure"
+	PlatformGCP   = "gcp"
+)
+
+// DefaultComparisonPlatforms are compared when a comparison names fewer than two platforms
+var DefaultComparisonPlatforms = []string{PlatformAWS, PlatformAzure}
+
+// Comparison dimensions. Every comparison has one row of each kind.
+const (
+	ComparisonCapabilities    = "capabilities"
+	ComparisonServicesMapping = "services_mapping"
+	ComparisonCost            = "cost"
+	ComparisonComplexity      = "complexity"
+	ComparisonRisks           = "risks"
+)
+
+// RequiredComparisonDimensions are the dimension kinds every comparison must include, in
+// reading order
+var RequiredComparisonDimensions = []string{
+	ComparisonCapabilities, ComparisonServicesMapping, ComparisonCost, ComparisonComplexity, ComparisonRisks,
+}
+
+// ComparisonFunction is the function the model calls to return a comparison
+const ComparisonFunction = "submit_comparison"
+
+// ErrInvalidComparison is returned when a comparison does not match the schema
+var ErrInvalidComparison = errors.New("invalid comparison")
+
+// comparisonPlatforms detect the platforms a query names, in column order
+var comparisonPlatforms = []struct {
+	platform string
+	name     string
+	pattern  *regexp.Regexp
+}{
+	{PlatformAWS, "AWS", regexp.MustCompile(`\b(aws|amazon web services)\b`)},
+	{PlatformAzure, "Azure", regexp.MustCompile(`\b(azure|microsoft cloud)\b`)},
+	{PlatformGCP, "Google Cloud", regexp.MustCompile(`\b(gcp|google cloud)\b`)},
+}
+
+// comparisonKeywordRegex matches wording that weighs options against each other
+var comparisonKeywordRegex = regexp.MustCompile(`\b(compare|compared|comparing|comparison|vs|versus|or|which|better|differences?)\b`)
+
+// ComparisonSchema is the JSON schema of the ComparisonFunction arguments
+var ComparisonSchema = json.RawMessage(`{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["title", "summary", "dimensions", "recommendation"],
+  "properties": {
+    "title": {"type": "string", "description": "Title of the comparison"},
+    "summary": {"type": "string", "description": "Two or three sentence summary of how the platforms differ for this request"},
+    "dimensions": {
+      "type": "array",
+      "description": "One row each for capabilities, services mapping, cost, complexity and risks",
+      "minItems": 5,
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["kind", "title", "cells"],
+        "properties": {
+          "kind": {"type": "string", "enum": ["capabilities", "services_mapping", "cost", "complexity", "risks"]},
+          "title": {"type": "string", "description": "Row heading"},
+          "cells": {
+            "type": "array",
+            "description": "One cell per compared platform",
+            "items": {
+              "type": "object",
+              "additionalProperties": false,
+              "required": ["platform", "text", "citations"],
+              "properties": {
+                "platform": {"type": "string", "description": "The platform the cell describes, exactly as listed in the request"},
+                "text": {"type": "string", "description": "Short assessment of the platform on this dimension without inline citation brackets"},
+                "citations": {
+                  "type": "array",
+                  "description": "Source IDs or URLs, exactly as given, from this platform's sources or the shared sources",
+                  "items": {"type": "string"}
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "recommendation": {"type": "string", "description": "Which platform fits the request better and under which conditions"}
+  }
+}`)
+
+// Comparison is a side-by-side comparison of cloud platforms: one row per dimension and
+// one column per platform
+type Comparison struct {
+	Title          string `json:"title"`
+	Summary        string `json:"summary"`
+	Recommendation string `json:"recommendation"`
+	// Platforms are the columns in order, with the sources their cells cite
+	Platforms  []ComparisonPlatform  `json:"platforms"`
+	Dimensions []ComparisonDimension `json:"dimensions"`
+}
+
+// ComparisonPlatform is one column of a comparison
+type ComparisonPlatform struct {
+	Platform string   `json:"platform"`
+	Name     string   `json:"name"`
+	Sources  []string `json:"sources"`
+	// CostEstimate is set when the platform's workload was priced from a price list
+	CostEstimate *pricing.Estimate `json:"cost_estimate,omitempty"`
+}
+
+// ComparisonDimension is one row of a comparison with a cell per platform, in column order
+type ComparisonDimension struct {
+	Kind  string           `json:"kind"`
+	Title string           `json:"title"`
+	Cells []ComparisonCell `json:"cells"`
+}
+
+// ComparisonCell is the assessment of one platform on one dimension
+type ComparisonCell struct {
+	Platform  string   `json:"platform"`
+	Text      string   `json:"text"`
+	Citations []string `json:"citations"`
+}
+
+// comparisonArguments are the ComparisonFunction arguments; the columns are set by the caller
+type comparisonArguments struct {
+	Title          string                `json:"title"`
+	Summary        string                `json:"summary"`
+	Dimensions     []ComparisonDimension `json:"dimensions"`
+	Recommendation string                `json:"recommendation"`
+}
+
+// DetectComparisonPlatforms returns the platforms a query names, in column order
+func DetectComparisonPlatforms(query string) []string {
+	queryLower := strings.ToLower(query)
+	var platforms []string
+	for _, candidate := range comparisonPlatforms {
+		if candidate.pattern.MatchString(queryLower) {
+			platforms = append(platforms, candidate.platform)
+		}
+	}
+	return platforms
+}
+
+// IsComparisonQuery reports whether a query weighs two or more cloud platforms against
+// each other, such as "should we do this on AWS or Azure?"
+func IsComparisonQuery(query string) bool {
+	return len(DetectComparisonPlatforms(query)) >= 2 && comparisonKeywordRegex.MatchString(strings.ToLower(query))
+}
+
+// PlatformName returns the display name of a comparison platform
+func PlatformName(platform string) string {
+	for _, candidate := range comparisonPlatforms {
+		if candidate.platform == platform {
+			return candidate.name
+		}
+	}
+	return platform
+}
+
+// ParseComparison decodes and validates a comparison of the given platforms. Comparisons
+// with unknown fields, a missing dimension or a row without exactly one cell per platform
+// are rejected. Cells are put in the order of platforms.
+func ParseComparison(arguments string, platforms []string) (Comparison, error) {
+	decoder := json.NewDecoder(strings.NewReader(arguments))
+	decoder.DisallowUnknownFields()
+
+	var parsed comparisonArguments
+	if err := decoder.Decode(&parsed); err != nil {
+		return Comparison{}, fmt.Errorf("%w: %v", ErrInvalidComparison, err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return Comparison{}, fmt.Errorf("%w: unexpected data after the comparison object", ErrInvalidComparison)
+	}
+
+	comparison := Comparison{
+		Title:          strings.TrimSpace(parsed.Title),
+		Summary:        strings.TrimSpace(parsed.Summary),
+		Recommendation: strings.TrimSpace(parsed.Recommendation),
+		Dimensions:     parsed.Dimensions,
+	}
+	for _, platform := range platforms {
+		comparison.Platforms = append(comparison.Platforms, ComparisonPlatform{Platform: platform, Name: PlatformName(platform)})
+	}
+	if err := comparison.normalize(); err != nil {
+		return Comparison{}, err
+	}
+	return comparison, nil
+}
+
+// normalize validates the rows against the columns and orders each row's cells like the columns
+func (c *Comparison) normalize() error {
+	if c.Title == "" {
+		return fmt.Errorf("%w: title must not be empty", ErrInvalidComparison)
+	}
+	if len(c.Platforms) < 2 {
+		return fmt.Errorf("%w: at least two platforms are needed", ErrInvalidComparison)
+	}
+
+	covered := make(map[string]bool, len(RequiredComparisonDimensions))
+	for i, dimension := range c.Dimensions {
+		switch dimension.Kind {
+		case ComparisonCapabilities, ComparisonServicesMapping, ComparisonCost, ComparisonComplexity, ComparisonRisks:
+		default:
+			return fmt.Errorf("%w: dimensions[%d].kind %q is not a comparison dimension", ErrInvalidComparison, i, dimension.Kind)
+		}
+		if strings.TrimSpace(dimension.Title) == "" {
+			return fmt.Errorf("%w: dimensions[%d] needs a title", ErrInvalidComparison, i)
+		}
+
+		cells := make(map[string]ComparisonCell, len(dimension.Cells))
+		for _, cell := range dimension.Cells {
+			platform := strings.ToLower(strings.TrimSpace(cell.Platform))
+			if _, duplicate := cells[platform]; duplicate {
+				return fmt.Errorf("%w: dimensions[%d] has two cells for %s", ErrInvalidComparison, i, platform)
+			}
+			cell.Platform = platform
+			cell.Text = strings.TrimSpace(cell.Text)
+			cells[platform] = cell
+		}
+		if len(cells) != len(c.Platforms) {
+			return fmt.Errorf("%w: dimensions[%d] needs one cell per platform", ErrInvalidComparison, i)
+		}
+		ordered := make([]ComparisonCell, 0, len(c.Platforms))
+		for _, column := range c.Platforms {
+			cell, ok := cells[column.Platform]
+			if !ok || cell.Text == "" {
+				return fmt.Errorf("%w: dimensions[%d] has no %s cell", ErrInvalidComparison, i, column.Platform)
+			}
+			ordered = append(ordered, cell)
+		}
+		c.Dimensions[i].Cells = ordered
+		covered[dimension.Kind] = true
+	}
+	for _, kind := range RequiredComparisonDimensions {
+		if !covered[kind] {
+			return fmt.Errorf("%w: missing a %s dimension", ErrInvalidComparison, kind)
+		}
+	}
+	return nil
+}
+
+// RestrictCitations keeps the citations of each cell that are among its platform's
+// available sources and lists the sources each column cites, so a column never cites
+// documents retrieved for another platform
+func (c *Comparison) RestrictCitations(available map[string][]string) {
+	for i := range c.Platforms {
+		allowed := make(map[string]bool, len(available[c.Platforms[i].Platform]))
+		for _, source := range available[c.Platforms[i].Platform] {
+			allowed[source] = true
+		}
+
+		var cited []string
+		for d := range c.Dimensions {
+			cell := &c.Dimensions[d].Cells[i]
+			var kept []string
+			for _, citation := range uniqueStrings(cell.Citations) {
+				if allowed[citation] {
+					kept = append(kept, citation)
+				}
+			}
+			cell.Citations = kept
+			cited = append(cited, kept...)
+		}
+		c.Platforms[i].Sources = uniqueStrings(cited)
+	}
+}
+
+// BuildComparisonMessages creates the messages asking for a comparison through
+// ComparisonFunction. Each platform's context is listed under its own heading so cells
+// can cite their own platform's sources; shared context and web results apply to all.
+func BuildComparisonMessages(
+	query string,
+	platforms []string,
+	platformContext map[string][]ContextItem,
+	sharedContext []ContextItem,
+	webResults []string,
+	config PromptConfig,
+) PromptMessages {
+	selectedContext, selectedWebResults := selectPromptSources(sharedContext, webResults, config)
+
+	names := make([]string, len(platforms))
+	for i, platform := range platforms {
+		names[i] = fmt.Sprintf("%s (%s)", PlatformName(platform), platform)
+	}
+
+	systemMessage := `You are an expert Cloud Solutions Architect assistant comparing cloud platforms side by side for a Solutions Architect.
+Submit the comparison by calling the ` + ComparisonFunction + ` function.
+- Compare exactly these platforms: ` + strings.Join(names, ", ") + `. Give every dimension one cell per platform, using the platform IDs in brackets.
+- Include one row each for capabilities, services mapping, cost, complexity and risks, in that order. For services mapping, name the equivalent services of each platform.
+- Keep cells short and specific to the request, using its exact numbers, technologies and constraints.
+- Cite each cell only with its own platform's sources or the shared sources, using the source IDs or URLs exactly as given. Leave the citations empty rather than citing another platform's sources.
+- Recommend which platform fits the request better and under which conditions.
+` + untrustedContentRule
+
+	var userMessage strings.Builder
+	userMessage.WriteString(fmt.Sprintf("User Query: %s\n\n", query))
+	for _, platform := range platforms {
+		items := platformContext[platform]
+		userMessage.WriteString(fmt.Sprintf("--- %s Sources (cite only in %s cells) ---\n", PlatformName(platform), platform))
+		if len(items) == 0 {
+			userMessage.WriteString("No documents were found for this platform.\n\n")
+		}
+		for i, item := range items {
+			userMessage.WriteString(formatLabeledContextEntry(PlatformName(platform), i+1, item))
+		}
+	}
+	if len(selectedContext) > 0 || len(selectedWebResults) > 0 {
+		userMessage.WriteString("--- Shared Sources (cite in any cell) ---\n")
+		writePromptSources(&userMessage, selectedContext, selectedWebResults)
+	}
+
+	return limitPromptMessages(systemMessage, userMessage.String(), config.MaxTokens)
+}
+
+// AssembleComparison renders a comparison as one markdown document: the summary, a table
+// with a row per dimension and a column per platform, the recommendation and the sources
+// of each column
+func AssembleComparison(comparison Comparison) string {
+	var document strings.Builder
+	document.WriteString("# " + comparison.Title + "\n\n")
+	if comparison.Summary != "" {
+		document.WriteString(comparison.Summary + "\n\n")
+	}
+
+	document.WriteString("| Dimension |")
+	separator := "| --- |"
+	for _, platform := range comparison.Platforms {
+		document.WriteString(" " + platform.Name + " |")
+		separator += " --- |"
+	}
+	document.WriteString("\n" + separator + "\n")
+	for _, dimension := range comparison.Dimensions {
+		document.WriteString("| " + tableCell(dimension.Title) + " |")
+		for _, cell := range dimension.Cells {
+			document.WriteString(" " + tableCell(cell.TextWithCitations()) + " |")
+		}
+		document.WriteString("\n")
+	}
+	if comparison.hasCostEstimates() {
+		document.WriteString("| Estimated monthly cost |")
+		for _, platform := range comparison.Platforms {
+			document.WriteString(" " + ComparisonCostSummary(platform.CostEstimate) + " |")
+		}
+		document.WriteString("\n")
+	}
+	document.WriteString("\n")
+
+	if comparison.Recommendation != "" {
+		document.WriteString("## Recommendation\n\n" + comparison.Recommendation + "\n\n")
+	}
+
+	var sources strings.Builder
+	for _, platform := range comparison.Platforms {
+		if len(platform.Sources) == 0 {
+			continue
+		}
+		sources.WriteString("### " + platform.Name + "\n\n")
+		for _, source := range platform.Sources {
+			sources.WriteString("- [" + source + "]\n")
+		}
+		sources.WriteString("\n")
+	}
+	if sources.Len() > 0 {
+		document.WriteString("## Sources\n\n" + sources.String())
+	}
+
+	return strings.TrimSpace(document.String())
+}
+
+// ComparisonCostSummary describes a platform's cost estimate in one table cell, or "n/a"
+// when the platform was not priced
+func ComparisonCostSummary(estimate *pricing.Estimate) string {
+	if estimate == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%s (price list %s, %s)", pricing.FormatAmount(estimate.MonthlyTotal), estimate.PriceListVersion, estimate.Region)
+}
+
+// hasCostEstimates reports whether any platform was priced
+func (c Comparison) hasCostEstimates() bool {
+	for _, platform := range c.Platforms {
+		if platform.CostEstimate != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// TextWithCitations returns the cell text followed by its citations as the bracketed
+// references used in answer text
+func (c ComparisonCell) TextWithCitations() string {
+	var text strings.Builder
+	text.WriteString(c.Text)
+	for _, citation := range c.Citations {
+		text.WriteString(" [" + citation + "]")
+	}
+	return text.String()
+}
+
+// tableCell makes text safe for a markdown table cell
+func tableCell(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	return strings.ReplaceAll(text, "|", `\|`)
+}
@@ -0,0 +1,175 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
+)
+
+const validComparison = `{
+  "title": "AWS vs Azure for 40 VM migration",
+  "summary": "Both platforms rehost the estate; Azure is cheaper for Windows licenses.",
+  "dimensions": [
+    {"kind": "capabilities", "title": "Capabilities", "cells": [
+      {"platform": "azure", "text": "Azure Migrate with | agentless discovery", "citations": ["azure-migrate", "aws-mgn"]},
+      {"platform": "AWS", "text": "Application Migration Service", "citations": ["aws-mgn"]}
+    ]},
+    {"kind": "services_mapping", "title": "Services Mapping", "cells": [
+      {"platform": "aws", "text": "EC2, EBS", "citations": []},
+      {"platform": "azure", "text": "Virtual Machines, Managed Disks", "citations": []}
+    ]},
+    {"kind": "cost", "title": "Cost", "cells": [
+      {"platform": "aws", "text": "Higher Windows cost", "citations": ["https://aws.amazon.com/ec2/pricing/"]},
+      {"platform": "azure", "text": "Hybrid Benefit", "citations": []}
+    ]},
+    {"kind": "complexity", "title": "Complexity", "cells": [
+      {"platform": "aws", "text": "Low", "citations": []},
+      {"platform": "azure", "text": "Low", "citations": []}
+    ]},
+    {"kind": "risks", "title": "Risks", "cells": [
+      {"platform": "aws", "text": "License mobility", "citations": []},
+      {"platform": "azure", "text": "Region capacity", "citations": ["azure-migrate"]}
+    ]}
+  ],
+  "recommendation": "Choose Azure when the estate is mostly Windows."
+}`
+
+func TestComparisonSchemaIsValidJSON(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(ComparisonSchema, &schema); err != nil {
+		t.Fatalf("ComparisonSchema is not valid JSON: %v", err)
+	}
+}
+
+func TestIsComparisonQuery(t *testing.T) {
+	tests := []struct {
+		query     string
+		expected  bool
+		platforms []string
+	}{
+		{"Should we host the data platform on AWS or Azure?", true, []string{PlatformAWS, PlatformAzure}},
+		{"Compare Azure and Google Cloud for AI workloads", true, []string{PlatformAzure, PlatformGCP}},
+		{"AWS vs. Azure vs. GCP for SAP", true, []string{PlatformAWS, PlatformAzure, PlatformGCP}},
+		{"Migrate our VMs from AWS to Azure", false, []string{PlatformAWS, PlatformAzure}},
+		{"Which AWS region is better for latency?", false, []string{PlatformAWS}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := IsComparisonQuery(tt.query); got != tt.expected {
+				t.Errorf("IsComparisonQuery() = %v, want %v", got, tt.expected)
+			}
+			if got := DetectComparisonPlatforms(tt.query); !reflect.DeepEqual(got, tt.platforms) {
+				t.Errorf("DetectComparisonPlatforms() = %v, want %v", got, tt.platforms)
+			}
+		})
+	}
+
+	if got := DetectQueryType("Should we do this on AWS or Azure?"); got != ComparisonQuery {
+		t.Errorf("DetectQueryType() = %v, want ComparisonQuery", got)
+	}
+}
+
+func TestParseComparison(t *testing.T) {
+	comparison, err := ParseComparison(validComparison, []string{PlatformAWS, PlatformAzure})
+	if err != nil {
+		t.Fatalf("ParseComparison() error = %v", err)
+	}
+	if len(comparison.Platforms) != 2 || comparison.Platforms[1].Name != "Azure" {
+		t.Fatalf("Platforms = %+v, want AWS and Azure", comparison.Platforms)
+	}
+	capabilities := comparison.Dimensions[0].Cells
+	if capabilities[0].Platform != PlatformAWS || capabilities[1].Platform != PlatformAzure {
+		t.Errorf("Cells should follow the column order, got %s, %s", capabilities[0].Platform, capabilities[1].Platform)
+	}
+
+	invalid := []struct {
+		name      string
+		arguments string
+		platforms []string
+	}{
+		{"missing dimension", strings.Replace(validComparison, `"kind": "risks"`, `"kind": "cost"`, 1), []string{PlatformAWS, PlatformAzure}},
+		{"missing cell", validComparison, []string{PlatformAWS, PlatformAzure, PlatformGCP}},
+		{"unknown platform", validComparison, []string{PlatformAWS, PlatformGCP}},
+		{"unknown field", strings.Replace(validComparison, `"title": "AWS`, `"verdict": "x", "title": "AWS`, 1), []string{PlatformAWS, PlatformAzure}},
+		{"empty title", strings.Replace(validComparison, `"AWS vs Azure for 40 VM migration"`, `" "`, 1), []string{PlatformAWS, PlatformAzure}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseComparison(tt.arguments, tt.platforms); !errors.Is(err, ErrInvalidComparison) {
+				t.Errorf("ParseComparison() error = %v, want ErrInvalidComparison", err)
+			}
+		})
+	}
+}
+
+func TestRestrictCitationsAndAssembleComparison(t *testing.T) {
+	comparison, err := ParseComparison(validComparison, []string{PlatformAWS, PlatformAzure})
+	if err != nil {
+		t.Fatalf("ParseComparison() error = %v", err)
+	}
+	comparison.RestrictCitations(map[string][]string{
+		PlatformAWS:   {"aws-mgn", "https://aws.amazon.com/ec2/pricing/"},
+		PlatformAzure: {"azure-migrate"},
+	})
+	comparison.Platforms[0].CostEstimate = &pricing.Estimate{MonthlyTotal: 1234.5, PriceListVersion: "2024-06", Region: "us-east-1"}
+
+	if got := comparison.Dimensions[0].Cells[1].Citations; !reflect.DeepEqual(got, []string{"azure-migrate"}) {
+		t.Errorf("Azure cell citations = %v, want only the Azure source", got)
+	}
+	if got := comparison.Platforms[0].Sources; !reflect.DeepEqual(got, []string{"aws-mgn", "https://aws.amazon.com/ec2/pricing/"}) {
+		t.Errorf("AWS sources = %v", got)
+	}
+
+	document := AssembleComparison(comparison)
+	for _, expected := range []string{
+		"# AWS vs Azure for 40 VM migration",
+		"| Dimension | AWS | Azure |",
+		"| Capabilities | Application Migration Service [aws-mgn] | Azure Migrate with \\| agentless discovery [azure-migrate] |",
+		"| Estimated monthly cost | $1,234.50 (price list 2024-06, us-east-1) | n/a |",
+		"## Recommendation\n\nChoose Azure when the estate is mostly Windows.",
+		"### Azure\n\n- [azure-migrate]",
+	} {
+		if !strings.Contains(document, expected) {
+			t.Errorf("Assembled comparison is missing %q:\n%s", expected, document)
+		}
+	}
+}
+
+func TestBuildComparisonMessages(t *testing.T) {
+	messages := BuildComparisonMessages("AWS or Azure for 40 VMs?", []string{PlatformAWS, PlatformAzure},
+		map[string][]ContextItem{PlatformAWS: {{Content: "Use MGN", SourceID: "aws-mgn"}}},
+		[]ContextItem{{Content: "Inventory of 40 VMs", SourceID: "inventory"}}, nil, DefaultPromptConfig())
+
+	if !strings.Contains(messages.SystemMessage, "AWS (aws), Azure (azure)") {
+		t.Errorf("System message should list the platforms:\n%s", messages.SystemMessage)
+	}
+	for _, expected := range []string{
+		"--- AWS Sources (cite only in aws cells) ---\n<untrusted_content source=\"aws-mgn\">\nAWS 1 [aws-mgn]: Use MGN\n</untrusted_content>",
+		"--- Azure Sources (cite only in azure cells) ---\nNo documents were found for this platform.",
+		"--- Shared Sources (cite in any cell) ---",
+		"[inventory]: Inventory of 40 VMs",
+	} {
+		if !strings.Contains(messages.UserMessage, expected) {
+			t.Errorf("User message is missing %q:\n%s", expected, messages.UserMessage)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Actions taken when an answer's groundedness score is below the minimum
+const (
+	// GroundingActionAnnotate lists the unsupported claims below the answer
+	GroundingActionAnnotate = "annotate"
+	// GroundingActionRegenerate asks the model once more to answer from the sources only,
+	// then annotates if the new answer is still below the minimum
+	GroundingActionRegenerate = "regenerate"
+	// GroundingActionBlock replaces the answer with a notice that it could not be grounded
+	GroundingActionBlock = "block"
+)
+
+// Grounding defaults
+const (
+	// DefaultSupportThreshold is the lexical overlap at which a claim counts as supported
+	// when no entailment check is made
+	DefaultSupportThreshold = 0.6
+	// DefaultCandidateThreshold is the lexical overlap a chunk needs to be aligned to a claim
+	DefaultCandidateThreshold = 0.25
+	// DefaultMaxClaimEvidence is the number of aligned chunks kept per claim
+	DefaultMaxClaimEvidence = 2
+	// minClaimTerms is the number of content words a sentence needs to be treated as a claim
+	minClaimTerms = 4
+)
+
+// BlockedAnswerText replaces answers blocked by GroundingActionBlock
+const BlockedAnswerText = "I couldn't verify enough of this answer against the provided sources to share it. " +
+	"Try rephrasing the question or adding documents that cover it."
+
+var (
+	// fencedBlockRegex matches fenced code and diagram blocks, which are not claims
+	fencedBlockRegex = regexp.MustCompile("(?s)```.*?```")
+	// claimCitationRegex matches bracketed citations such as [doc-id] or [https://...]
+	claimCitationRegex = regexp.MustCompile(`\[[^\[\]]*\]`)
+	// emptyParenthesesRegex matches parentheses left empty by removed citations
+	emptyParenthesesRegex = regexp.MustCompile(`\(\s*\)`)
+	// claimListMarkerRegex matches list markers at the start of a line
+	claimListMarkerRegex = regexp.MustCompile(`^\s*(?:[-*+•]|\d+[.)])\s+`)
+	// tableSeparatorRegex matches markdown table separator rows
+	tableSeparatorRegex = regexp.MustCompile(`^\s*\|?[\s:|-]+\|?\s*$`)
+	// claimAbbreviations are words whose trailing period does not end a sentence
+	claimAbbreviations = map[string]bool{"e.g": true, "i.e": true, "etc": true, "vs": true, "approx": true, "incl": true}
+	// groundingStopWords are ignored when measuring lexical overlap
+	groundingStopWords = map[string]bool{
+		"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+		"can": true, "for": true, "from": true, "has": true, "have": true, "in": true, "into": true,
+		"is": true, "it": true, "its": true, "of": true, "on": true, "or": true, "should": true,
+		"that": true, "the": true, "their": true, "then": true, "there": true, "these": true, "this": true,
+		"to": true, "use": true, "using": true, "was": true, "which": true, "while": true, "will": true,
+		"with": true, "you": true, "your": true, "we": true, "our": true, "also": true, "all": true,
+		"any": true, "each": true, "more": true, "than": true, "they": true, "when": true, "where": true,
+		"would": true, "could": true, "may": true, "not": true, "no": true, "so": true, "such": true,
+	}
+)
+
+// GroundingEvidence is a context chunk or web result an answer may be grounded in
+type GroundingEvidence struct {
+	ID   string
+	Text string
+}
+
+// GroundingOptions tune how claims are aligned to evidence
+type GroundingOptions struct {
+	SupportThreshold   float64
+	CandidateThreshold float64
+	MaxEvidence        int
+}
+
+// DefaultGroundingOptions returns the default grounding options
+func DefaultGroundingOptions() GroundingOptions {
+	return GroundingOptions{
+		SupportThreshold:   DefaultSupportThreshold,
+		CandidateThreshold: DefaultCandidateThreshold,
+		MaxEvidence:        DefaultMaxClaimEvidence,
+	}
+}
+
+// EntailmentCheck asks whether a claim follows from the evidence aligned to it
+type EntailmentCheck struct {
+	Claim    string
+	Evidence []string
+}
+
+// EntailmentJudge decides whether claims are entailed by their evidence, returning one
+// verdict per check in order
+type EntailmentJudge interface {
+	JudgeEntailment(ctx context.Context, checks []EntailmentCheck) ([]bool, error)
+}
+
+// ClaimGrounding is the verification result for one claim of an answer
+type ClaimGrounding struct {
+	Text      string   `json:"text"`
+	Supported bool     `json:"supported"`
+	Overlap   float64  `json:"overlap"`
+	Evidence  []string `json:"evidence,omitempty"`
+	Entailed  *bool    `json:"entailed,omitempty"`
+}
+
+// GroundingReport describes how well an answer is supported by the sources it was given
+type GroundingReport struct {
+	// Score is the fraction of claims that are supported, 1 when there are no claims
+	Score             float64          `json:"score"`
+	Claims            []ClaimGrounding `json:"claims"`
+	UnsupportedClaims []string         `json:"unsupported_claims"`
+	// EntailmentChecked is false when support was decided by lexical overlap alone
+	EntailmentChecked bool `json:"entailment_checked"`
+	// Regenerated is true when the answer was regenerated for low groundedness
+	Regenerated bool `json:"regenerated,omitempty"`
+	// Action is the policy action applied to the answer, empty when none was needed
+	Action string `json:"action,omitempty"`
+}
+
+// VerifyGrounding splits the answer text into claims and aligns each claim to the
+// evidence with the highest lexical overlap. When a judge is given, claims with aligned
+// evidence are supported only if the judge finds them entailed; otherwise a claim is
+// supported when its best overlap reaches the support threshold. The report is always
+// usable: a non-nil error means the judge failed and lexical overlap decided support.
+func VerifyGrounding(
+	ctx context.Context,
+	text string,
+	evidence []GroundingEvidence,
+	options GroundingOptions,
+	judge EntailmentJudge,
+) (GroundingReport, error) {
+	evidenceTerms := make([]map[string]bool, len(evidence))
+	for i, item := range evidence {
+		evidenceTerms[i] = termSet(groundingTerms(item.Text))
+	}
+
+	report := GroundingReport{Claims: []ClaimGrounding{}, UnsupportedClaims: []string{}}
+	var checks []EntailmentCheck
+	var checked []int
+	for _, claim := range SplitClaims(text) {
+		terms := groundingTerms(claim)
+
+		type candidate struct {
+			index   int
+			overlap float64
+		}
+		var candidates []candidate
+		for i := range evidence {
+			if overlap := termOverlap(terms, evidenceTerms[i]); overlap >= options.CandidateThreshold {
+				candidates = append(candidates, candidate{index: i, overlap: overlap})
+			}
+		}
+		sort.SliceStable(candidates, func(a, b int) bool { return candidates[a].overlap > candidates[b].overlap })
+		if options.MaxEvidence > 0 && len(candidates) > options.MaxEvidence {
+			candidates = candidates[:options.MaxEvidence]
+		}
+
+		grounding := ClaimGrounding{Text: claim}
+		check := EntailmentCheck{Claim: claim}
+		for _, c := range candidates {
+			grounding.Evidence = append(grounding.Evidence, evidence[c.index].ID)
+			check.Evidence = append(check.Evidence, evidence[c.index].Text)
+		}
+		if len(candidates) > 0 {
+			grounding.Overlap = candidates[0].overlap
+			grounding.Supported = grounding.Overlap >= options.SupportThreshold
+			checks = append(checks, check)
+			checked = append(checked, len(report.Claims))
+		}
+		report.Claims = append(report.Claims, grounding)
+	}
+
+	var judgeErr error
+	if judge != nil && len(checks) > 0 {
+		verdicts, err := judge.JudgeEntailment(ctx, checks)
+		switch {
+		case err != nil:
+			judgeErr = fmt.Errorf("entailment check failed: %w", err)
+		case len(verdicts) != len(checks):
+			judgeErr = fmt.Errorf("entailment check returned %d verdicts for %d claims", len(verdicts), len(checks))
+		default:
+			report.EntailmentChecked = true
+			for i, claimIndex := range checked {
+				entailed := verdicts[i]
+				report.Claims[claimIndex].Entailed = &entailed
+				report.Claims[claimIndex].Supported = entailed
+			}
+		}
+	}
+
+	supported := 0
+	for _, claim := range report.Claims {
+		if claim.Supported {
+			supported++
+		} else {
+			report.UnsupportedClaims = append(report.UnsupportedClaims, claim.Text)
+		}
+	}
+	report.Score = 1
+	if len(report.Claims) > 0 {
+		report.Score = float64(supported) / float64(len(report.Claims))
+	}
+	return report, judgeErr
+}
+
+// SplitClaims splits answer text into the sentences that make factual claims. Code and
+// diagram blocks, headings, citations and sentences too short to be checked are left out.
+func SplitClaims(text string) []string {
+	text = fencedBlockRegex.ReplaceAllString(text, "\n")
+
+	var claims []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ">") || tableSeparatorRegex.MatchString(line) {
+			continue
+		}
+		if strings.HasPrefix(line, "|") {
+			line = strings.TrimSpace(strings.ReplaceAll(strings.Trim(line, "|"), "|", " "))
+		}
+		line = claimListMarkerRegex.ReplaceAllString(line, "")
+		line = citedURLRegex.ReplaceAllString(claimCitationRegex.ReplaceAllString(line, ""), "")
+		line = emptyParenthesesRegex.ReplaceAllString(line, "")
+		line = strings.ReplaceAll(strings.ReplaceAll(line, "**", ""), "`", "")
+
+		for _, sentence := range splitSentences(line) {
+			sentence = strings.TrimSpace(spaceBeforePunctuationRegex.ReplaceAllString(sentence, "$1"))
+			sentence = repeatedSpaceRegex.ReplaceAllString(sentence, " ")
+			if strings.HasSuffix(sentence, "?") || strings.HasSuffix(sentence, ":") {
+				continue
+			}
+			if len(groundingTerms(sentence)) >= minClaimTerms {
+				claims = append(claims, sentence)
+			}
+		}
+	}
+	return claims
+}
+
+// ApplyGroundingPolicy applies action to the answer when the report's score is below
+// minScore and records the applied action in the report, which is attached to the
+// answer. GroundingActionRegenerate is applied as GroundingActionAnnotate since
+// regeneration happens before the final answer is built.
+func ApplyGroundingPolicy(result *SynthesisResponse, report GroundingReport, minScore float64, action string) {
+	if report.Score < minScore && len(report.UnsupportedClaims) > 0 {
+		switch action {
+		case GroundingActionBlock:
+			result.MainText = BlockedAnswerText
+			result.DiagramCode = ""
+			result.DiagramURL = ""
+			result.CodeSnippets = []CodeSnippet{}
+			report.Action = GroundingActionBlock
+		default:
+			var note strings.Builder
+			note.WriteString("\n\n> ⚠️ **Unverified claims**: the provided sources do not support the following statements.\n")
+			for _, claim := range report.UnsupportedClaims {
+				note.WriteString("> - " + claim + "\n")
+			}
+			result.MainText = strings.TrimRight(result.MainText, "\n") + strings.TrimRight(note.String(), "\n")
+			report.Action = GroundingActionAnnotate
+		}
+	}
+	result.Grounding = &report
+}
+
+// BuildGroundingFeedback returns the instructions for regenerating an answer whose
+// claims were not supported by the sources
+func BuildGroundingFeedback(report GroundingReport) string {
+	var feedback strings.Builder
+	feedback.WriteString("A previous answer to this question made claims that the provided sources do not support:\n")
+	for _, claim := range report.UnsupportedClaims {
+		feedback.WriteString("- " + claim + "\n")
+	}
+	feedback.WriteString("Answer again using only facts stated in the provided context and web results. ")
+	feedback.WriteString("Cite the supporting source for each statement, and say so explicitly where the sources do not cover part of the question.")
+	return feedback.String()
+}
+
+// splitSentences splits a line after sentence-ending punctuation followed by a space
+func splitSentences(line string) []string {
+	var sentences []string
+	runes := []rune(line)
+	start := 0
+	for i, r := range runes {
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		if i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			continue
+		}
+		if r == '.' && isAbbreviation(runes[start:i]) {
+			continue
+		}
+		sentences = append(sentences, string(runes[start:i+1]))
+		start = i + 1
+	}
+	if start < len(runes) {
+		sentences = append(sentences, string(runes[start:]))
+	}
+	return sentences
+}
+
+// isAbbreviation reports whether the text before a period ends with an abbreviation or initial
+func isAbbreviation(before []rune) bool {
+	fields := strings.Fields(string(before))
+	if len(fields) == 0 {
+		return false
+	}
+	word := strings.ToLower(strings.Trim(fields[len(fields)-1], "("))
+	return claimAbbreviations[word] || len([]rune(word)) == 1
+}
+
+// groundingTerms returns the normalized content words of text
+func groundingTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '-'
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.Trim(word, ".-")
+		if len(word) < 2 || groundingStopWords[word] {
+			continue
+		}
+		terms = append(terms, stemTerm(word))
+	}
+	return terms
+}
+
+// stemTerm reduces plural forms so "clusters" matches "cluster"
+func stemTerm(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y"
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		return strings.TrimSuffix(word, "s")
+	}
+	return word
+}
+
+// termSet returns terms as a set
+func termSet(terms []string) map[string]bool {
+	set := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		set[term] = true
+	}
+	return set
+}
+
+// termOverlap returns the fraction of distinct claim terms found in the evidence terms
+func termOverlap(claimTerms []string, evidenceTerms map[string]bool) float64 {
+	distinct := termSet(claimTerms)
+	if len(distinct) == 0 {
+		return 0
+	}
+	matched := 0
+	for term := range distinct {
+		if evidenceTerms[term] {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(distinct))
+}
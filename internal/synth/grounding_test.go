@@ -0,0 +1,208 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var groundingEvidence = []GroundingEvidence{
+	{ID: "aws-mgn-guide", Text: "AWS Application Migration Service (MGN) replicates source servers into AWS with continuous block-level replication and minimal cutover downtime."},
+	{ID: "eks-versions", Text: "Amazon EKS supports Kubernetes version 1.31 for new and existing clusters."},
+}
+
+// fakeJudge returns fixed verdicts and records the checks it was asked to make
+type fakeJudge struct {
+	verdicts []bool
+	err      error
+	checks   []EntailmentCheck
+}
+
+func (j *fakeJudge) JudgeEntailment(_ context.Context, checks []EntailmentCheck) ([]bool, error) {
+	j.checks = checks
+	return j.verdicts, j.err
+}
+
+func TestSplitClaims(t *testing.T) {
+	text := `## Migration Plan
+
+Use AWS Application Migration Service for continuous block-level replication [aws-mgn-guide]. Cut over during a weekend window, e.g. Saturday night.
+- Amazon EKS supports Kubernetes version 1.31 (https://aws.amazon.com/eks/).
+- Short item.
+
+` + "```bash\naws mgn initialize-service --region us-east-1\n```" + `
+
+| Service | Monthly cost |
+|---------|--------------|
+| Amazon RDS Multi-AZ database | $1,200 per month |
+
+Which region should you choose?`
+
+	claims := SplitClaims(text)
+	expected := []string{
+		"Use AWS Application Migration Service for continuous block-level replication.",
+		"Cut over during a weekend window, e.g. Saturday night.",
+		"Amazon EKS supports Kubernetes version 1.31.",
+		"Amazon RDS Multi-AZ database $1,200 per month",
+	}
+	if len(claims) != len(expected) {
+		t.Fatalf("SplitClaims() = %q, want %q", claims, expected)
+	}
+	for i := range expected {
+		if claims[i] != expected[i] {
+			t.Errorf("claims[%d] = %q, want %q", i, claims[i], expected[i])
+		}
+	}
+}
+
+func TestVerifyGroundingLexical(t *testing.T) {
+	text := "Amazon EKS supports Kubernetes version 1.31 for existing clusters. " +
+		"Azure Front Door provides a global web application firewall at no extra cost."
+
+	report, err := VerifyGrounding(context.Background(), text, groundingEvidence, DefaultGroundingOptions(), nil)
+	if err != nil {
+		t.Fatalf("VerifyGrounding() error = %v", err)
+	}
+
+	if len(report.Claims) != 2 {
+		t.Fatalf("Claims = %+v, want 2", report.Claims)
+	}
+	if !report.Claims[0].Supported || report.Claims[0].Evidence[0] != "eks-versions" {
+		t.Errorf("Claims[0] = %+v, want supported by eks-versions", report.Claims[0])
+	}
+	if report.Claims[1].Supported || len(report.Claims[1].Evidence) != 0 {
+		t.Errorf("Claims[1] = %+v, want unsupported without evidence", report.Claims[1])
+	}
+	if report.Score != 0.5 {
+		t.Errorf("Score = %v, want 0.5", report.Score)
+	}
+	if len(report.UnsupportedClaims) != 1 || !strings.HasPrefix(report.UnsupportedClaims[0], "Azure Front Door") {
+		t.Errorf("UnsupportedClaims = %q, want the Azure claim", report.UnsupportedClaims)
+	}
+	if report.EntailmentChecked {
+		t.Error("Expected no entailment check without a judge")
+	}
+}
+
+func TestVerifyGroundingWithJudge(t *testing.T) {
+	text := "Amazon EKS supports Kubernetes version 1.31 for existing clusters. " +
+		"Application Migration Service replicates source servers with zero downtime guaranteed."
+
+	judge := &fakeJudge{verdicts: []bool{true, false}}
+	report, err := VerifyGrounding(context.Background(), text, groundingEvidence, DefaultGroundingOptions(), judge)
+	if err != nil {
+		t.Fatalf("VerifyGrounding() error = %v", err)
+	}
+
+	if len(judge.checks) != 2 || !strings.Contains(judge.checks[1].Evidence[0], "minimal cutover downtime") {
+		t.Fatalf("Expected both aligned claims to be checked with their evidence, got %+v", judge.checks)
+	}
+	if !report.EntailmentChecked {
+		t.Error("Expected the entailment check to be recorded")
+	}
+	if report.Claims[1].Supported || report.Claims[1].Entailed == nil || *report.Claims[1].Entailed {
+		t.Errorf("Claims[1] = %+v, want not entailed", report.Claims[1])
+	}
+	if report.Score != 0.5 {
+		t.Errorf("Score = %v, want 0.5", report.Score)
+	}
+}
+
+func TestVerifyGroundingFallsBackToLexicalWhenJudgeFails(t *testing.T) {
+	judge := &fakeJudge{err: errors.New("rate limited")}
+	report, err := VerifyGrounding(context.Background(),
+		"Amazon EKS supports Kubernetes version 1.31 for existing clusters.",
+		groundingEvidence, DefaultGroundingOptions(), judge)
+	if err == nil {
+		t.Fatal("Expected the judge error to be returned")
+	}
+	if report.EntailmentChecked || report.Score != 1 {
+		t.Errorf("Expected a lexical report with score 1, got %+v", report)
+	}
+}
+
+func TestVerifyGroundingWithoutClaims(t *testing.T) {
+	report, err := VerifyGrounding(context.Background(), "## Overview\n\nSee below.", groundingEvidence,
+		DefaultGroundingOptions(), nil)
+	if err != nil {
+		t.Fatalf("VerifyGrounding() error = %v", err)
+	}
+	if report.Score != 1 || len(report.Claims) != 0 {
+		t.Errorf("Expected an empty report with score 1, got %+v", report)
+	}
+}
+
+func TestApplyGroundingPolicy(t *testing.T) {
+	report := GroundingReport{
+		Score:             0.5,
+		UnsupportedClaims: []string{"Azure Front Door is free."},
+	}
+
+	t.Run("annotate", func(t *testing.T) {
+		result := SynthesisResponse{MainText: "Answer text.", DiagramCode: "graph TD\n  A --> B"}
+		ApplyGroundingPolicy(&result, report, 0.7, GroundingActionAnnotate)
+
+		if !strings.Contains(result.MainText, "Unverified claims") || !strings.Contains(result.MainText, "> - Azure Front Door is free.") {
+			t.Errorf("MainText = %q, want the unsupported claim listed", result.MainText)
+		}
+		if result.Grounding == nil || result.Grounding.Action != GroundingActionAnnotate {
+			t.Errorf("Grounding = %+v, want the annotate action", result.Grounding)
+		}
+		if result.DiagramCode == "" {
+			t.Error("Expected the diagram to be kept")
+		}
+	})
+
+	t.Run("regenerate annotates", func(t *testing.T) {
+		result := SynthesisResponse{MainText: "Answer text."}
+		ApplyGroundingPolicy(&result, report, 0.7, GroundingActionRegenerate)
+		if result.Grounding.Action != GroundingActionAnnotate {
+			t.Errorf("Action = %q, want annotate", result.Grounding.Action)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		result := SynthesisResponse{
+			MainText:     "Answer text.",
+			DiagramCode:  "graph TD\n  A --> B",
+			CodeSnippets: []CodeSnippet{{Language: "bash", Code: "echo hi"}},
+		}
+		ApplyGroundingPolicy(&result, report, 0.7, GroundingActionBlock)
+		if result.MainText != BlockedAnswerText || result.DiagramCode != "" || len(result.CodeSnippets) != 0 {
+			t.Errorf("Expected the answer to be blocked, got %+v", result)
+		}
+		if result.Grounding.Action != GroundingActionBlock {
+			t.Errorf("Action = %q, want block", result.Grounding.Action)
+		}
+	})
+
+	t.Run("above minimum", func(t *testing.T) {
+		result := SynthesisResponse{MainText: "Answer text."}
+		ApplyGroundingPolicy(&result, report, 0.5, GroundingActionBlock)
+		if result.MainText != "Answer text." || result.Grounding.Action != "" {
+			t.Errorf("Expected the answer to be unchanged, got %+v", result)
+		}
+	})
+}
+
+func TestBuildGroundingFeedback(t *testing.T) {
+	feedback := BuildGroundingFeedback(GroundingReport{UnsupportedClaims: []string{"Azure Front Door is free."}})
+	if !strings.Contains(feedback, "- Azure Front Door is free.") || !strings.Contains(feedback, "only facts stated") {
+		t.Errorf("BuildGroundingFeedback() = %q", feedback)
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Plan section kinds. Every outline covers the required kinds and may add custom sections.
+const (
+	PlanSectionPhases      = "phases"
+	PlanSectionWorkstreams = "workstreams"
+	PlanSectionRisks       = "risks"
+	PlanSectionTimeline    = "timeline"
+	PlanSectionCosts       = "costs"
+	PlanSectionCustom      = "custom"
+)
+
+// RequiredPlanSections are the section kinds every plan outline must include
+var RequiredPlanSections = []string{
+	PlanSectionPhases, PlanSectionWorkstreams, PlanSectionRisks, PlanSectionTimeline, PlanSectionCosts,
+}
+
+// PlanOutlineFunction is the function the model calls to return a plan outline
+const PlanOutlineFunction = "submit_plan_outline"
+
+// PlanContinuationPrompt asks the model to continue a section that hit the token limit
+const PlanContinuationPrompt = "Your previous reply was cut off by the length limit. " +
+	"Continue exactly where it stopped. Do not repeat any earlier text, restart the section or add a heading."
+
+// ErrInvalidPlanOutline is returned when an outline does not match the schema
+var ErrInvalidPlanOutline = errors.New("invalid plan outline")
+
+// Repeated text removed when joining a continuation. Shorter overlaps are usually
+// coincidence, such as a word continuing with the letter it ended on.
+const (
+	minContinuationOverlap = 8
+	maxContinuationOverlap = 200
+)
+
+// leadingHeadingRegex matches a markdown heading on the first line of a section
+var leadingHeadingRegex = regexp.MustCompile(`^#{1,6}\s+[^\n]*\n*`)
+
+// topLevelHeadingRegex matches level one and two headings, which are reserved for the plan
+var topLevelHeadingRegex = regexp.MustCompile(`^#{1,2}\s+`)
+
+// PlanOutlineSchema is the JSON schema of the PlanOutlineFunction arguments
+var PlanOutlineSchema = json.RawMessage(`{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["title", "summary", "diagram", "sections"],
+  "properties": {
+    "title": {"type": "string", "description": "Title of the plan"},
+    "summary": {"type": "string", "description": "Two or three sentence executive summary of the plan"},
+    "diagram": {
+      "type": "string",
+      "description": "Mermaid graph TD source without code fences showing the target architecture the whole plan builds towards"
+    },
+    "sections": {
+      "type": "array",
+      "description": "Ordered plan sections covering phases, workstreams, risks, timeline and costs",
+      "minItems": 5,
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["kind", "title", "focus", "retrieval_query"],
+        "properties": {
+          "kind": {"type": "string", "enum": ["phases", "workstreams", "risks", "timeline", "costs", "custom"]},
+          "title": {"type": "string", "description": "Section heading"},
+          "focus": {"type": "string", "description": "What the section must cover, specific to the request"},
+          "retrieval_query": {"type": "string", "description": "Search query for documents that support this section"}
+        }
+      }
+    }
+  }
+}`)
+
+// PlanOutline is the outline returned through PlanOutlineFunction
+type PlanOutline struct {
+	Title    string               `json:"title"`
+	Summary  string               `json:"summary"`
+	Diagram  string               `json:"diagram"`
+	Sections []PlanOutlineSection `json:"sections"`
+}
+
+// PlanOutlineSection is one section of a plan outline
+type PlanOutlineSection struct {
+	Kind           string `json:"kind"`
+	Title          string `json:"title"`
+	Focus          string `json:"focus"`
+	RetrievalQuery string `json:"retrieval_query"`
+}
+
+// PlanSectionResult is the generated text of one outline section
+type PlanSectionResult struct {
+	Section PlanOutlineSection
+	Content string
+	// Continuations is the number of times the section was continued after hitting the token limit
+	Continuations int
+	// Truncated is set when the section still ended at the token limit after the last continuation
+	Truncated bool
+}
+
+// ParsePlanOutline decodes and validates an outline. Outlines with unknown fields, more
+// than maxSections sections, a missing required section kind or a fenced diagram are
+// rejected so the caller can fall back to DefaultPlanOutline.
+func ParsePlanOutline(arguments string, maxSections int) (PlanOutline, error) {
+	decoder := json.NewDecoder(strings.NewReader(arguments))
+	decoder.DisallowUnknownFields()
+
+	var outline PlanOutline
+	if err := decoder.Decode(&outline); err != nil {
+		return PlanOutline{}, fmt.Errorf("%w: %v", ErrInvalidPlanOutline, err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return PlanOutline{}, fmt.Errorf("%w: unexpected data after the outline object", ErrInvalidPlanOutline)
+	}
+
+	outline.Title = strings.TrimSpace(outline.Title)
+	outline.Summary = strings.TrimSpace(outline.Summary)
+	outline.Diagram = strings.TrimSpace(outline.Diagram)
+	if err := outline.Validate(maxSections); err != nil {
+		return PlanOutline{}, err
+	}
+	return outline, nil
+}
+
+// Validate checks the outline against the rules the schema cannot express
+func (o PlanOutline) Validate(maxSections int) error {
+	if o.Title == "" {
+		return fmt.Errorf("%w: title must not be empty", ErrInvalidPlanOutline)
+	}
+	if maxSections > 0 && len(o.Sections) > maxSections {
+		return fmt.Errorf("%w: %d sections exceed the limit of %d", ErrInvalidPlanOutline, len(o.Sections), maxSections)
+	}
+	if o.Diagram != "" && (strings.HasPrefix(o.Diagram, "```") || !isMermaidDiagram(o.Diagram)) {
+		return fmt.Errorf("%w: diagram must be Mermaid source without code fences", ErrInvalidPlanOutline)
+	}
+
+	covered := make(map[string]bool, len(RequiredPlanSections))
+	for i, section := range o.Sections {
+		switch section.Kind {
+		case PlanSectionPhases, PlanSectionWorkstreams, PlanSectionRisks, PlanSectionTimeline, PlanSectionCosts, PlanSectionCustom:
+		default:
+			return fmt.Errorf("%w: sections[%d].kind %q is not a plan section kind", ErrInvalidPlanOutline, i, section.Kind)
+		}
+		if strings.TrimSpace(section.Title) == "" || strings.TrimSpace(section.Focus) == "" {
+			return fmt.Errorf("%w: sections[%d] needs a title and a focus", ErrInvalidPlanOutline, i)
+		}
+		covered[section.Kind] = true
+	}
+	for _, kind := range RequiredPlanSections {
+		if !covered[kind] {
+			return fmt.Errorf("%w: missing a %s section", ErrInvalidPlanOutline, kind)
+		}
+	}
+	return nil
+}
+
+// DefaultPlanOutline returns the outline used when the model's outline is unusable
+func DefaultPlanOutline(query string) PlanOutline {
+	return PlanOutline{
+		Title:   "Implementation Plan",
+		Summary: "Phased plan for: " + strings.TrimSpace(query),
+		Diagram: GenerateFallbackDiagram(query),
+		Sections: []PlanOutlineSection{
+			{Kind: PlanSectionPhases, Title: "Phases", Focus: "Project phases with goals, entry and exit criteria and deliverables", RetrievalQuery: query + " phases"},
+			{Kind: PlanSectionWorkstreams, Title: "Workstreams", Focus: "Parallel workstreams with owners, activities and dependencies", RetrievalQuery: query + " workstreams"},
+			{Kind: PlanSectionRisks, Title: "Risks and Mitigations", Focus: "Key technical, operational and business risks with mitigations", RetrievalQuery: query + " risks"},
+			{Kind: PlanSectionTimeline, Title: "Timeline", Focus: "Week by week timeline with milestones", RetrievalQuery: query + " timeline"},
+			{Kind: PlanSectionCosts, Title: "Cost Estimate", Focus: "One-time and monthly costs with optimization options", RetrievalQuery: query + " costs"},
+		},
+	}
+}
+
+// planOutlineRole and planSectionRole open the built-in plan prompts; a prompt template's
+// system message takes their place when one is selected
+const (
+	planOutlineRole = "You are an expert Cloud Solutions Architect assistant planning a long-form deliverable for a Solutions Architect."
+	planSectionRole = "You are an expert Cloud Solutions Architect assistant writing one section of a larger plan for a Solutions Architect."
+)
+
+// planOutlineInstructions are the rules of the outline stage
+const planOutlineInstructions = `Outline the plan by calling the ` + PlanOutlineFunction + ` function. Do not write the plan itself.
+- Include at least one section each for phases, workstreams, risks, timeline and costs, in a sensible reading order. Add custom sections only when the request needs them.
+- Give every section a focus that is specific to the request, using its exact numbers, technologies and constraints.
+- Give every section a retrieval query that would find internal documents supporting it.
+- Provide one Mermaid graph TD diagram of the target architecture. Every section will refer to this diagram, so name components the way the sections should.
+` + untrustedContentRule
+
+// planSectionInstructions are the rules of the section stage
+const planSectionInstructions = `- Write only the requested section. Other sections are written separately, so do not repeat their content.
+- Do not start with a heading and do not use level one or two headings; use ### for subsections.
+- Do not draw diagrams. The plan has a single architecture diagram; refer to its components by name.
+- Include code blocks with language identifiers where commands or configuration help implement the section.
+- Base the section on the provided context, use the exact numbers and technologies from the request, and cite sources with [source_id] or [URL].
+` + untrustedContentRule
+
+// BuildPlanOutlineMessages creates the messages asking for a plan outline through
+// PlanOutlineFunction
+func BuildPlanOutlineMessages(query string, contextItems []ContextItem, webResults []string, config PromptConfig) PromptMessages {
+	selectedContext, selectedWebResults := selectPromptSources(contextItems, webResults, config)
+	return limitPromptMessages(planOutlineRole+"\n"+planOutlineInstructions,
+		planOutlineUserMessage(query, selectedContext, selectedWebResults), config.MaxTokens)
+}
+
+// BuildPlanOutlineMessagesFromTemplate creates the outline messages with the template's
+// system message in place of the built-in role, followed by the outline rules
+func BuildPlanOutlineMessagesFromTemplate(
+	tmpl *PromptTemplate,
+	query string,
+	contextItems []ContextItem,
+	webResults []string,
+	config PromptConfig,
+) (PromptMessages, error) {
+	selectedContext, selectedWebResults := selectPromptSources(contextItems, webResults, config)
+	return buildPlanMessagesFromTemplate(tmpl, query, selectedContext, selectedWebResults, config,
+		"You are now outlining a long-form plan that is written in stages.", planOutlineInstructions,
+		planOutlineUserMessage(query, selectedContext, selectedWebResults))
+}
+
+// planOutlineUserMessage writes the user message of the outline stage
+func planOutlineUserMessage(query string, contextItems []ContextItem, webResults []string) string {
+	var userMessage strings.Builder
+	userMessage.WriteString(fmt.Sprintf("User Query: %s\n\n", query))
+	writePromptSources(&userMessage, contextItems, webResults)
+	return userMessage.String()
+}
+
+// BuildPlanSectionMessages creates the messages for writing one outline section. The
+// whole outline is included so each section stays consistent with the others.
+func BuildPlanSectionMessages(
+	query string,
+	outline PlanOutline,
+	index int,
+	contextItems []ContextItem,
+	webResults []string,
+	config PromptConfig,
+) PromptMessages {
+	selectedContext, selectedWebResults := selectPromptSources(contextItems, webResults, config)
+	return limitPromptMessages(planSectionRole+"\n"+planSectionInstructions,
+		planSectionUserMessage(query, outline, index, selectedContext, selectedWebResults), config.MaxTokens)
+}
+
+// BuildPlanSectionMessagesFromTemplate creates the messages for one outline section with
+// the template's system message in place of the built-in role, followed by the section rules
+func BuildPlanSectionMessagesFromTemplate(
+	tmpl *PromptTemplate,
+	query string,
+	outline PlanOutline,
+	index int,
+	contextItems []ContextItem,
+	webResults []string,
+	config PromptConfig,
+) (PromptMessages, error) {
+	selectedContext, selectedWebResults := selectPromptSources(contextItems, webResults, config)
+	return buildPlanMessagesFromTemplate(tmpl, query, selectedContext, selectedWebResults, config,
+		"You are now writing one section of a larger plan that is written in stages.", planSectionInstructions,
+		planSectionUserMessage(query, outline, index, selectedContext, selectedWebResults))
+}
+
+// planSectionUserMessage writes the user message of the section stage
+func planSectionUserMessage(
+	query string,
+	outline PlanOutline,
+	index int,
+	contextItems []ContextItem,
+	webResults []string,
+) string {
+	section := outline.Sections[index]
+
+	var userMessage strings.Builder
+	userMessage.WriteString(fmt.Sprintf("User Query: %s\n\n", query))
+	userMessage.WriteString(fmt.Sprintf("Plan: %s\n%s\n\nOutline:\n", outline.Title, outline.Summary))
+	for i, planned := range outline.Sections {
+		userMessage.WriteString(fmt.Sprintf("%d. %s - %s\n", i+1, planned.Title, planned.Focus))
+	}
+	if outline.Diagram != "" {
+		userMessage.WriteString("\nArchitecture diagram:\n" + outline.Diagram + "\n")
+	}
+	userMessage.WriteString(fmt.Sprintf("\nWrite section %d, %q: %s\n\n", index+1, section.Title, section.Focus))
+	writePromptSources(&userMessage, contextItems, webResults)
+	userMessage.WriteString(builtinPromptSection("citations", nil))
+	return userMessage.String()
+}
+
+// buildPlanMessagesFromTemplate renders the template's system message for the query and
+// appends the stage's rules, which take precedence over the template's answer format. The
+// stage's own user message replaces the template's.
+func buildPlanMessagesFromTemplate(
+	tmpl *PromptTemplate,
+	query string,
+	contextItems []ContextItem,
+	webResults []string,
+	config PromptConfig,
+	stage, instructions, userMessage string,
+) (PromptMessages, error) {
+	rendered, err := tmpl.Render(PromptTemplateData{
+		Query:      query,
+		QueryType:  queryTypeNames[config.QueryType],
+		Context:    contextItems,
+		WebResults: webResults,
+	})
+	if err != nil {
+		return PromptMessages{}, fmt.Errorf("prompt template %s v%d: %w", tmpl.ID, tmpl.Version, err)
+	}
+
+	systemMessage := strings.TrimRight(rendered.SystemMessage, "\n") + "\n\n" + stage +
+		" Follow these rules where they differ from the answer format above:\n" + instructions
+	limited := limitPromptMessages(systemMessage, userMessage, config.MaxTokens)
+	limited.TemplateID = tmpl.ID
+	limited.TemplateVersion = tmpl.Version
+	return limited, nil
+}
+
+// writePromptSources writes the context chunks and web results of a plan prompt
+func writePromptSources(builder *strings.Builder, contextItems []ContextItem, webResults []string) {
+	if len(contextItems) > 0 {
+		builder.WriteString("--- Internal Document Context (PRIMARY SOURCE) ---\n")
+		for i, item := range contextItems {
+			builder.WriteString(formatContextEntry(i+1, item))
+		}
+	}
+	if len(webResults) > 0 {
+		builder.WriteString("--- Live Web Search Results ---\n")
+		for i, result := range webResults {
+			builder.WriteString(formatWebResultWithURL(i+1, result))
+		}
+	}
+}
+
+// MergeContinuation appends a continuation to text cut off at the token limit. Models
+// often repeat the last words before continuing, so text the continuation starts with
+// that already ends the previous part is dropped.
+func MergeContinuation(previous, continuation string) string {
+	limit := min(min(len(previous), len(continuation)), maxContinuationOverlap)
+	for overlap := limit; overlap >= minContinuationOverlap; overlap-- {
+		if strings.HasSuffix(previous, continuation[:overlap]) {
+			return previous + continuation[overlap:]
+		}
+	}
+	return previous + continuation
+}
+
+// AssemblePlan joins the outline and its generated sections into one markdown document
+// with the outline's diagram and a consolidated list of the cited sources. Only sources
+// in availableSources are listed.
+func AssemblePlan(query string, outline PlanOutline, sections []PlanSectionResult, availableSources []string) string {
+	diagram := outline.Diagram
+	if diagram == "" {
+		diagram = GenerateFallbackDiagram(query)
+	}
+
+	var document strings.Builder
+	document.WriteString("# " + outline.Title + "\n\n")
+	if outline.Summary != "" {
+		document.WriteString(outline.Summary + "\n\n")
+	}
+	if diagram != "" {
+		document.WriteString("## Architecture Overview\n\n```mermaid\n" + diagram + "\n```\n\n")
+	}
+
+	var cited []string
+	for i, section := range sections {
+		content := cleanPlanSection(section.Content)
+		document.WriteString(fmt.Sprintf("## %d. %s\n\n", i+1, section.Section.Title))
+		document.WriteString(content + "\n\n")
+		if section.Truncated {
+			document.WriteString("_This section was cut off at the length limit._\n\n")
+		}
+		cited = append(cited, extractSources(content)...)
+	}
+
+	available := make(map[string]bool, len(availableSources))
+	for _, source := range availableSources {
+		available[source] = true
+	}
+	var sources []string
+	for _, source := range uniqueStrings(cited) {
+		if available[source] {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) > 0 {
+		document.WriteString("## Sources\n\n")
+		for _, source := range sources {
+			document.WriteString("- [" + source + "]\n")
+		}
+	}
+
+	return strings.TrimSpace(document.String())
+}
+
+// cleanPlanSection removes the parts of a generated section that belong to the plan as
+// a whole: a leading heading, its own diagrams and level one or two headings
+func cleanPlanSection(content string) string {
+	content = strings.TrimSpace(content)
+	content = leadingHeadingRegex.ReplaceAllString(content, "")
+	content = removeMermaidDiagram(content)
+
+	// Comments in code blocks look like headings, so only lines outside them are demoted
+	lines := strings.Split(content, "\n")
+	inCode := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if !inCode {
+			lines[i] = topLevelHeadingRegex.ReplaceAllString(line, "### ")
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const validPlanOutline = `{
+  "title": "Migration of 120 VMs to AWS",
+  "summary": "Rehost the estate in three waves.",
+  "diagram": "graph TD\n  A[Data Center] --> B[AWS MGN]\n  B --> C[EC2]",
+  "sections": [
+    {"kind": "phases", "title": "Migration Phases", "focus": "Assess, mobilize, migrate", "retrieval_query": "migration phases"},
+    {"kind": "workstreams", "title": "Workstreams", "focus": "Network, data, apps", "retrieval_query": "workstreams"},
+    {"kind": "risks", "title": "Risks", "focus": "Downtime and licensing", "retrieval_query": "migration risks"},
+    {"kind": "timeline", "title": "Timeline", "focus": "12 week plan", "retrieval_query": "migration timeline"},
+    {"kind": "costs", "title": "Costs", "focus": "Monthly EC2 and MGN costs", "retrieval_query": "EC2 pricing"}
+  ]
+}`
+
+func TestPlanOutlineSchemaIsValidJSON(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(PlanOutlineSchema, &schema); err != nil {
+		t.Fatalf("PlanOutlineSchema is not valid JSON: %v", err)
+	}
+}
+
+func TestParsePlanOutline(t *testing.T) {
+	outline, err := ParsePlanOutline(validPlanOutline, 8)
+	if err != nil {
+		t.Fatalf("ParsePlanOutline() error = %v", err)
+	}
+	if outline.Title != "Migration of 120 VMs to AWS" || len(outline.Sections) != 5 {
+		t.Errorf("Unexpected outline: %+v", outline)
+	}
+
+	var withoutCosts map[string]interface{}
+	_ = json.Unmarshal([]byte(validPlanOutline), &withoutCosts)
+	withoutCosts["sections"] = withoutCosts["sections"].([]interface{})[:4]
+	missingCosts, _ := json.Marshal(withoutCosts)
+
+	tests := []struct {
+		name        string
+		arguments   string
+		maxSections int
+		wantErr     string
+	}{
+		{name: "malformed JSON", arguments: `{"title":`, maxSections: 8, wantErr: "unexpected EOF"},
+		{name: "unknown field", arguments: strings.Replace(validPlanOutline, `"title"`, `"extra": 1, "title"`, 1), maxSections: 8, wantErr: "unknown field"},
+		{name: "too many sections", arguments: validPlanOutline, maxSections: 4, wantErr: "exceed the limit"},
+		{name: "missing required kind", arguments: string(missingCosts), maxSections: 8, wantErr: "missing a costs section"},
+		{name: "unknown kind", arguments: strings.Replace(validPlanOutline, `"kind": "risks"`, `"kind": "appendix"`, 1), maxSections: 8, wantErr: "not a plan section kind"},
+		{name: "fenced diagram", arguments: strings.Replace(validPlanOutline, `"graph TD`, "\"```mermaid\\ngraph TD", 1), maxSections: 8, wantErr: "without code fences"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePlanOutline(tt.arguments, tt.maxSections)
+			if !errors.Is(err, ErrInvalidPlanOutline) {
+				t.Fatalf("Expected ErrInvalidPlanOutline, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDefaultPlanOutlineIsValid(t *testing.T) {
+	outline := DefaultPlanOutline("Migrate 40 VMs to AWS")
+	if err := outline.Validate(len(RequiredPlanSections)); err != nil {
+		t.Errorf("DefaultPlanOutline() is invalid: %v", err)
+	}
+}
+
+func TestBuildPlanSectionMessages(t *testing.T) {
+	outline, err := ParsePlanOutline(validPlanOutline, 8)
+	if err != nil {
+		t.Fatalf("ParsePlanOutline() error = %v", err)
+	}
+
+	messages := BuildPlanSectionMessages("Migrate 120 VMs to AWS", outline, 4,
+		[]ContextItem{{Content: "EC2 pricing guidance", SourceID: "aws-pricing"}}, nil, DefaultPromptConfig())
+
+	for _, want := range []string{
+		"User Query: Migrate 120 VMs to AWS",
+		"1. Migration Phases - Assess, mobilize, migrate",
+		"Write section 5, \"Costs\": Monthly EC2 and MGN costs",
+		"Context 1 [aws-pricing]: EC2 pricing guidance",
+		"A[Data Center] --> B[AWS MGN]",
+	} {
+		if !strings.Contains(messages.UserMessage, want) {
+			t.Errorf("Expected user message to contain %q", want)
+		}
+	}
+	if !strings.Contains(messages.SystemMessage, "Do not draw diagrams") {
+		t.Error("Expected system message to rule out per-section diagrams")
+	}
+}
+
+func TestBuildPlanMessagesFromTemplate(t *testing.T) {
+	tmpl, err := ParsePromptTemplate([]byte(promptTemplateFile("concise", 2, "", "concise")), "concise.yaml")
+	if err != nil {
+		t.Fatalf("ParsePromptTemplate() error = %v", err)
+	}
+	outline, err := ParsePlanOutline(validPlanOutline, 8)
+	if err != nil {
+		t.Fatalf("ParsePlanOutline() error = %v", err)
+	}
+	contextItems := []ContextItem{{Content: "EC2 pricing guidance", SourceID: "aws-pricing"}}
+
+	outlineMessages, err := BuildPlanOutlineMessagesFromTemplate(tmpl, "Migrate 120 VMs to AWS", contextItems, nil,
+		DefaultPromptConfig())
+	if err != nil {
+		t.Fatalf("BuildPlanOutlineMessagesFromTemplate() error = %v", err)
+	}
+	sectionMessages, err := BuildPlanSectionMessagesFromTemplate(tmpl, "Migrate 120 VMs to AWS", outline, 4,
+		contextItems, nil, DefaultPromptConfig())
+	if err != nil {
+		t.Fatalf("BuildPlanSectionMessagesFromTemplate() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		messages PromptMessages
+		builtin  PromptMessages
+		rule     string
+	}{
+		{
+			name:     "outline",
+			messages: outlineMessages,
+			builtin:  BuildPlanOutlineMessages("Migrate 120 VMs to AWS", contextItems, nil, DefaultPromptConfig()),
+			rule:     "Outline the plan by calling the " + PlanOutlineFunction + " function",
+		},
+		{
+			name:     "section",
+			messages: sectionMessages,
+			builtin:  BuildPlanSectionMessages("Migrate 120 VMs to AWS", outline, 4, contextItems, nil, DefaultPromptConfig()),
+			rule:     "Do not draw diagrams",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.HasPrefix(tt.messages.SystemMessage, "You are a Cloud Solutions Architect assistant (concise v2).") {
+				t.Errorf("Expected the template's system message first, got %q", tt.messages.SystemMessage)
+			}
+			if strings.Contains(tt.messages.SystemMessage, "You are an expert Cloud Solutions Architect assistant") {
+				t.Error("Expected the template to replace the built-in role")
+			}
+			if !strings.Contains(tt.messages.SystemMessage, tt.rule) {
+				t.Errorf("Expected the system message to keep the stage rule %q", tt.rule)
+			}
+			if tt.messages.UserMessage != tt.builtin.UserMessage {
+				t.Error("Expected the stage's user message rather than the template's")
+			}
+			if tt.messages.TemplateID != "concise" || tt.messages.TemplateVersion != 2 {
+				t.Errorf("Template = %s v%d, want concise v2", tt.messages.TemplateID, tt.messages.TemplateVersion)
+			}
+		})
+	}
+}
+
+func TestMergeContinuation(t *testing.T) {
+	tests := []struct {
+		name         string
+		previous     string
+		continuation string
+		want         string
+	}{
+		{name: "no overlap", previous: "Phase one moves the web", continuation: " tier.", want: "Phase one moves the web tier."},
+		{name: "repeated words", previous: "Phase one moves the web", continuation: "moves the web tier.", want: "Phase one moves the web tier."},
+		{name: "short coincidental overlap", previous: "Reserved instance", continuation: "e pricing", want: "Reserved instancee pricing"},
+		{name: "empty continuation", previous: "Done.", continuation: "", want: "Done."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeContinuation(tt.previous, tt.continuation); got != tt.want {
+				t.Errorf("MergeContinuation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssemblePlan(t *testing.T) {
+	outline, err := ParsePlanOutline(validPlanOutline, 8)
+	if err != nil {
+		t.Fatalf("ParsePlanOutline() error = %v", err)
+	}
+
+	sections := []PlanSectionResult{
+		{
+			Section: outline.Sections[0],
+			Content: "## Migration Phases\n\nAssess the estate first [aws-migration-guide].\n\n" +
+				"```mermaid\ngraph TD\n  X --> Y\n```\n\n# Wave planning\n\n```bash\n# list servers\naws mgn describe-source-servers\n```",
+		},
+		{
+			Section:   outline.Sections[4],
+			Content:   "EC2 costs $3,168 per month [aws-pricing] and [unknown-source].",
+			Truncated: true,
+		},
+	}
+
+	document := AssemblePlan("Migrate 120 VMs to AWS", outline, sections, []string{"aws-migration-guide", "aws-pricing"})
+
+	if strings.Count(document, "```mermaid") != 1 || !strings.Contains(document, "A[Data Center] --> B[AWS MGN]") {
+		t.Errorf("Expected only the outline diagram, got:\n%s", document)
+	}
+	for _, want := range []string{
+		"# Migration of 120 VMs to AWS",
+		"## 1. Migration Phases\n\nAssess the estate first",
+		"### Wave planning",
+		"# list servers",
+		"## 2. Costs",
+		"_This section was cut off at the length limit._",
+		"## Sources\n\n- [aws-migration-guide]\n- [aws-pricing]",
+	} {
+		if !strings.Contains(document, want) {
+			t.Errorf("Expected document to contain %q, got:\n%s", want, document)
+		}
+	}
+	if strings.Contains(document, "- [unknown-source]") {
+		t.Error("Expected sources that were not provided to be left out of the source list")
+	}
+}
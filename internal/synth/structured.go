@@ -0,0 +1,344 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Synthesis output modes
+const (
+	// OutputModeText asks for a markdown answer parsed by ParseResponseWithEnhancedMetadata
+	OutputModeText = "text"
+	// OutputModeStructured asks for a StructuredAnswer through a forced function call
+	OutputModeStructured = "structured"
+)
+
+// StructuredAnswerFunction is the function the model calls to return a structured answer
+const StructuredAnswerFunction = "submit_answer"
+
+// ErrInvalidStructuredAnswer is returned when structured output does not match the schema
+var ErrInvalidStructuredAnswer = errors.New("invalid structured answer")
+
+// StructuredAnswerSchema is the JSON schema of the StructuredAnswerFunction arguments
+var StructuredAnswerSchema = json.RawMessage(`{
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["sections", "diagram", "code_snippets", "assumptions"],
+  "properties": {
+    "sections": {
+      "type": "array",
+      "description": "The answer as ordered sections of prose",
+      "minItems": 1,
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["heading", "paragraphs"],
+        "properties": {
+          "heading": {"type": "string", "description": "Section heading, empty for an untitled introduction"},
+          "paragraphs": {
+            "type": "array",
+            "minItems": 1,
+            "items": {
+              "type": "object",
+              "additionalProperties": false,
+              "required": ["text", "citations"],
+              "properties": {
+                "text": {"type": "string", "description": "Paragraph text without inline citation brackets"},
+                "citations": {
+                  "type": "array",
+                  "description": "Source IDs or URLs, exactly as given in the context, supporting this paragraph",
+                  "items": {"type": "string"}
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "diagram": {
+      "type": "string",
+      "description": "Mermaid diagram source without code fences, or an empty string when no diagram is needed"
+    },
+    "code_snippets": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "additionalProperties": false,
+        "required": ["language", "filename", "purpose", "code"],
+        "properties": {
+          "language": {"type": "string", "description": "Language identifier such as terraform, bash or yaml"},
+          "filename": {"type": "string", "description": "Relative file name the code should be saved as, e.g. main.tf"},
+          "purpose": {"type": "string", "description": "One sentence describing what the code does"},
+          "code": {"type": "string"}
+        }
+      }
+    },
+    "assumptions": {
+      "type": "array",
+      "description": "Assumptions made where the question or context left details open",
+      "items": {"type": "string"}
+    }
+  }
+}`)
+
+// mermaidDiagramTypes are the diagram declarations a structured diagram may start with
+var mermaidDiagramTypes = []string{
+	"graph", "flowchart", "sequenceDiagram", "classDiagram", "stateDiagram", "stateDiagram-v2",
+	"erDiagram", "journey", "gantt", "pie", "mindmap", "timeline", "C4Context", "C4Container",
+	"C4Component", "C4Deployment", "architecture-beta",
+}
+
+// StructuredAnswer is the answer returned through StructuredAnswerFunction
+type StructuredAnswer struct {
+	Sections     []AnswerSection         `json:"sections"`
+	Diagram      string                  `json:"diagram"`
+	CodeSnippets []StructuredCodeSnippet `json:"code_snippets"`
+	Assumptions  []string                `json:"assumptions"`
+}
+
+// AnswerSection is a headed part of a structured answer
+type AnswerSection struct {
+	Heading    string            `json:"heading"`
+	Paragraphs []AnswerParagraph `json:"paragraphs"`
+}
+
+// AnswerParagraph is a paragraph of a structured answer with the sources supporting it
+type AnswerParagraph struct {
+	Text      string   `json:"text"`
+	Citations []string `json:"citations"`
+}
+
+// StructuredCodeSnippet is a code snippet of a structured answer
+type StructuredCodeSnippet struct {
+	Language string `json:"language"`
+	Filename string `json:"filename"`
+	Purpose  string `json:"purpose"`
+	Code     string `json:"code"`
+}
+
+// BuildStructuredOutputInstructions returns the system instructions for answering
+// through StructuredAnswerFunction. They replace the markdown formatting rules of the
+// text prompt.
+func BuildStructuredOutputInstructions() string {
+	return `Return your answer by calling the ` + StructuredAnswerFunction + ` function instead of writing markdown.
+- Put the prose in sections. Use an empty heading for an introduction.
+- Cite sources per paragraph in the citations field, using the source IDs and URLs exactly as they appear in the context. Do not put [source] brackets in the paragraph text.
+- Put any architecture diagram in the diagram field as Mermaid source without code fences, or leave it empty.
+- Put every code block in code_snippets with its language, a relative filename and a one sentence purpose. Do not put code in the paragraphs.
+- List the assumptions you made where the question or context left details open.`
+}
+
+// ParseStructuredAnswer decodes and strictly validates structured output. Unknown
+// fields, missing fields, citations of sources that were not provided, fenced diagrams
+// and incomplete code snippets are all rejected so the caller can fall back to text.
+func ParseStructuredAnswer(arguments string, availableSources []string) (StructuredAnswer, error) {
+	decoder := json.NewDecoder(strings.NewReader(arguments))
+	decoder.DisallowUnknownFields()
+
+	// Decode into pointers first so missing required fields can be told apart from empty ones
+	var raw struct {
+		Sections     *[]AnswerSection         `json:"sections"`
+		Diagram      *string                  `json:"diagram"`
+		CodeSnippets *[]StructuredCodeSnippet `json:"code_snippets"`
+		Assumptions  *[]string                `json:"assumptions"`
+	}
+	if err := decoder.Decode(&raw); err != nil {
+		return StructuredAnswer{}, fmt.Errorf("%w: %v", ErrInvalidStructuredAnswer, err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return StructuredAnswer{}, fmt.Errorf("%w: unexpected data after the answer object", ErrInvalidStructuredAnswer)
+	}
+
+	switch {
+	case raw.Sections == nil:
+		return StructuredAnswer{}, missingField("sections")
+	case raw.Diagram == nil:
+		return StructuredAnswer{}, missingField("diagram")
+	case raw.CodeSnippets == nil:
+		return StructuredAnswer{}, missingField("code_snippets")
+	case raw.Assumptions == nil:
+		return StructuredAnswer{}, missingField("assumptions")
+	}
+
+	answer := StructuredAnswer{
+		Sections:     *raw.Sections,
+		Diagram:      strings.TrimSpace(*raw.Diagram),
+		CodeSnippets: *raw.CodeSnippets,
+		Assumptions:  *raw.Assumptions,
+	}
+	if err := answer.Validate(availableSources); err != nil {
+		return StructuredAnswer{}, err
+	}
+	return answer, nil
+}
+
+// Validate checks the answer against the rules the schema cannot express
+func (a StructuredAnswer) Validate(availableSources []string) error {
+	if len(a.Sections) == 0 {
+		return invalidField("sections", "at least one section is required")
+	}
+
+	available := make(map[string]bool, len(availableSources))
+	for _, source := range availableSources {
+		available[source] = true
+	}
+
+	for i, section := range a.Sections {
+		if len(section.Paragraphs) == 0 {
+			return invalidField(fmt.Sprintf("sections[%d].paragraphs", i), "at least one paragraph is required")
+		}
+		for j, paragraph := range section.Paragraphs {
+			field := fmt.Sprintf("sections[%d].paragraphs[%d]", i, j)
+			if strings.TrimSpace(paragraph.Text) == "" {
+				return invalidField(field+".text", "must not be empty")
+			}
+			for _, citation := range paragraph.Citations {
+				if !available[citation] {
+					return invalidField(field+".citations", fmt.Sprintf("%q is not one of the provided sources", citation))
+				}
+			}
+		}
+	}
+
+	if a.Diagram != "" {
+		if strings.HasPrefix(a.Diagram, "```") {
+			return invalidField("diagram", "must be Mermaid source without code fences")
+		}
+		if !isMermaidDiagram(a.Diagram) {
+			return invalidField("diagram", "must start with a Mermaid diagram type such as flowchart or graph")
+		}
+	}
+
+	for i, snippet := range a.CodeSnippets {
+		field := fmt.Sprintf("code_snippets[%d]", i)
+		switch {
+		case strings.TrimSpace(snippet.Language) == "":
+			return invalidField(field+".language", "must not be empty")
+		case strings.TrimSpace(snippet.Purpose) == "":
+			return invalidField(field+".purpose", "must not be empty")
+		case strings.TrimSpace(snippet.Code) == "":
+			return invalidField(field+".code", "must not be empty")
+		case !isRelativeFilename(snippet.Filename):
+			return invalidField(field+".filename", "must be a relative file name inside the project")
+		}
+	}
+
+	for i, assumption := range a.Assumptions {
+		if strings.TrimSpace(assumption) == "" {
+			return invalidField(fmt.Sprintf("assumptions[%d]", i), "must not be empty")
+		}
+	}
+	return nil
+}
+
+// ToSynthesisResponse converts the answer to the response produced by the text parser.
+// Citations are rendered as [source] after each paragraph so downstream citation
+// handling works unchanged, and a fallback diagram is generated for the query when the
+// answer has none.
+func (a StructuredAnswer) ToSynthesisResponse(query string) SynthesisResponse {
+	result := SynthesisResponse{
+		CodeSnippets: []CodeSnippet{},
+		Sources:      []string{},
+		Sections:     a.Sections,
+		Assumptions:  a.Assumptions,
+	}
+
+	var text strings.Builder
+	var cited []string
+	for _, section := range a.Sections {
+		if heading := strings.TrimSpace(section.Heading); heading != "" {
+			text.WriteString("## " + heading + "\n\n")
+		}
+		for _, paragraph := range section.Paragraphs {
+			text.WriteString(strings.TrimSpace(paragraph.Text))
+			for _, citation := range paragraph.Citations {
+				text.WriteString(" [" + citation + "]")
+			}
+			text.WriteString("\n\n")
+			cited = append(cited, paragraph.Citations...)
+		}
+	}
+	if len(a.Assumptions) > 0 {
+		text.WriteString("## Assumptions\n\n")
+		for _, assumption := range a.Assumptions {
+			text.WriteString("- " + strings.TrimSpace(assumption) + "\n")
+		}
+	}
+	result.MainText = strings.TrimSpace(text.String())
+	if sources := uniqueStrings(cited); len(sources) > 0 {
+		result.Sources = sources
+	}
+
+	result.DiagramCode = a.Diagram
+	if result.DiagramCode == "" && query != "" {
+		result.DiagramCode = GenerateFallbackDiagram(query)
+	}
+	result.PipelineDecision.ArchitectureDiagram = result.DiagramCode != ""
+
+	for _, snippet := range a.CodeSnippets {
+		code := strings.TrimSpace(strings.ReplaceAll(snippet.Code, "\r\n", "\n"))
+		// Insecure code is dropped, matching the text parser
+		if !validateCodeSecurity(code, snippet.Language) {
+			continue
+		}
+		result.CodeSnippets = append(result.CodeSnippets, CodeSnippet{
+			Language: normalizeLanguage(strings.TrimSpace(snippet.Language)),
+			Code:     code,
+			Filename: path.Clean(strings.TrimSpace(snippet.Filename)),
+			Purpose:  strings.TrimSpace(snippet.Purpose),
+		})
+	}
+	result.PipelineDecision.CodeGenerated = len(result.CodeSnippets) > 0
+
+	return result
+}
+
+// isMermaidDiagram reports whether the source starts with a Mermaid diagram declaration
+func isMermaidDiagram(source string) bool {
+	fields := strings.Fields(source)
+	if len(fields) == 0 {
+		return false
+	}
+	for _, diagramType := range mermaidDiagramTypes {
+		if fields[0] == diagramType {
+			return true
+		}
+	}
+	return false
+}
+
+// isRelativeFilename reports whether name is a relative path that stays inside the project
+func isRelativeFilename(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, "\\\x00") || path.IsAbs(name) {
+		return false
+	}
+	cleaned := path.Clean(name)
+	return cleaned != "." && cleaned != ".." && !strings.HasPrefix(cleaned, "../")
+}
+
+func missingField(field string) error {
+	return fmt.Errorf("%w: missing required field %s", ErrInvalidStructuredAnswer, field)
+}
+
+func invalidField(field, message string) error {
+	return fmt.Errorf("%w: %s %s", ErrInvalidStructuredAnswer, field, message)
+}
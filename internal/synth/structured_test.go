@@ -0,0 +1,209 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var structuredSources = []string{"aws-migration-guide", "https://aws.amazon.com/eks/"}
+
+const validStructuredAnswer = `{
+  "sections": [
+    {"heading": "", "paragraphs": [{"text": "Use Amazon EKS for the container workloads.", "citations": ["https://aws.amazon.com/eks/"]}]},
+    {"heading": "Migration Plan", "paragraphs": [
+      {"text": "Rehost the VMs with Application Migration Service.", "citations": ["aws-migration-guide"]},
+      {"text": "Validate the cutover in a staging account.", "citations": []}
+    ]}
+  ],
+  "diagram": "graph TD\n  A[Users] --> B[ALB]\n  B --> C[EKS]",
+  "code_snippets": [
+    {"language": "hcl", "filename": "infra/main.tf", "purpose": "Creates the EKS cluster.", "code": "resource \"aws_eks_cluster\" \"main\" {\n  name = \"main\"\n}"}
+  ],
+  "assumptions": ["The workloads are already containerized."]
+}`
+
+func TestParseStructuredAnswer(t *testing.T) {
+	answer, err := ParseStructuredAnswer(validStructuredAnswer, structuredSources)
+	if err != nil {
+		t.Fatalf("ParseStructuredAnswer() error = %v", err)
+	}
+
+	if len(answer.Sections) != 2 || len(answer.Sections[1].Paragraphs) != 2 {
+		t.Fatalf("Sections = %+v, want 2 sections with 2 paragraphs in the second", answer.Sections)
+	}
+	if got := answer.Sections[1].Paragraphs[0].Citations; len(got) != 1 || got[0] != "aws-migration-guide" {
+		t.Errorf("Citations = %v, want [aws-migration-guide]", got)
+	}
+	if answer.CodeSnippets[0].Filename != "infra/main.tf" || answer.CodeSnippets[0].Purpose != "Creates the EKS cluster." {
+		t.Errorf("CodeSnippets[0] = %+v, want filename and purpose", answer.CodeSnippets[0])
+	}
+	if !strings.HasPrefix(answer.Diagram, "graph TD") {
+		t.Errorf("Diagram = %q, want a graph", answer.Diagram)
+	}
+}
+
+func TestParseStructuredAnswerRejectsInvalidOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		mutate    func(map[string]interface{})
+		arguments string
+		wantError string
+	}{
+		{
+			name:      "malformed JSON",
+			arguments: `{"sections": [`,
+			wantError: "invalid structured answer",
+		},
+		{
+			name:      "trailing data",
+			arguments: validStructuredAnswer + ` {}`,
+			wantError: "unexpected data",
+		},
+		{
+			name:      "unknown field",
+			mutate:    func(m map[string]interface{}) { m["summary"] = "extra" },
+			wantError: "unknown field",
+		},
+		{
+			name:      "missing field",
+			mutate:    func(m map[string]interface{}) { delete(m, "assumptions") },
+			wantError: "missing required field assumptions",
+		},
+		{
+			name:      "no sections",
+			mutate:    func(m map[string]interface{}) { m["sections"] = []interface{}{} },
+			wantError: "at least one section",
+		},
+		{
+			name: "unknown citation",
+			mutate: func(m map[string]interface{}) {
+				m["sections"] = []interface{}{map[string]interface{}{
+					"heading":    "Overview",
+					"paragraphs": []interface{}{map[string]interface{}{"text": "Text", "citations": []string{"made-up-doc"}}},
+				}}
+			},
+			wantError: `"made-up-doc" is not one of the provided sources`,
+		},
+		{
+			name:      "fenced diagram",
+			mutate:    func(m map[string]interface{}) { m["diagram"] = "```mermaid\ngraph TD\n  A --> B\n```" },
+			wantError: "without code fences",
+		},
+		{
+			name:      "not a Mermaid diagram",
+			mutate:    func(m map[string]interface{}) { m["diagram"] = "A --> B" },
+			wantError: "Mermaid diagram type",
+		},
+		{
+			name: "filename outside the project",
+			mutate: func(m map[string]interface{}) {
+				m["code_snippets"] = []interface{}{map[string]interface{}{
+					"language": "bash", "filename": "../../etc/profile", "purpose": "Sets up the shell.", "code": "echo hi",
+				}}
+			},
+			wantError: "filename must be a relative file name",
+		},
+		{
+			name: "snippet without purpose",
+			mutate: func(m map[string]interface{}) {
+				m["code_snippets"] = []interface{}{map[string]interface{}{
+					"language": "bash", "filename": "setup.sh", "purpose": " ", "code": "echo hi",
+				}}
+			},
+			wantError: "purpose must not be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arguments := tt.arguments
+			if tt.mutate != nil {
+				var m map[string]interface{}
+				if err := json.Unmarshal([]byte(validStructuredAnswer), &m); err != nil {
+					t.Fatalf("Failed to decode fixture: %v", err)
+				}
+				tt.mutate(m)
+				encoded, err := json.Marshal(m)
+				if err != nil {
+					t.Fatalf("Failed to encode fixture: %v", err)
+				}
+				arguments = string(encoded)
+			}
+
+			_, err := ParseStructuredAnswer(arguments, structuredSources)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if !errors.Is(err, ErrInvalidStructuredAnswer) {
+				t.Errorf("Expected ErrInvalidStructuredAnswer, got: %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Error = %v, want it to contain %q", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestStructuredAnswerSchemaIsValidJSON(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(StructuredAnswerSchema, &schema); err != nil {
+		t.Fatalf("StructuredAnswerSchema is not valid JSON: %v", err)
+	}
+	if schema["additionalProperties"] != false {
+		t.Error("Expected the schema to disallow additional properties")
+	}
+}
+
+func TestStructuredAnswerToSynthesisResponse(t *testing.T) {
+	answer, err := ParseStructuredAnswer(validStructuredAnswer, structuredSources)
+	if err != nil {
+		t.Fatalf("ParseStructuredAnswer() error = %v", err)
+	}
+
+	response := answer.ToSynthesisResponse("Migrate our VMs to EKS")
+
+	for _, want := range []string{
+		"Use Amazon EKS for the container workloads. [https://aws.amazon.com/eks/]",
+		"## Migration Plan",
+		"Rehost the VMs with Application Migration Service. [aws-migration-guide]",
+		"## Assumptions\n\n- The workloads are already containerized.",
+	} {
+		if !strings.Contains(response.MainText, want) {
+			t.Errorf("MainText missing %q:\n%s", want, response.MainText)
+		}
+	}
+
+	if len(response.Sources) != 2 {
+		t.Errorf("Sources = %v, want the 2 cited sources", response.Sources)
+	}
+	if len(response.CodeSnippets) != 1 {
+		t.Fatalf("CodeSnippets = %+v, want 1", response.CodeSnippets)
+	}
+	snippet := response.CodeSnippets[0]
+	if snippet.Language != "terraform" || snippet.Filename != "infra/main.tf" || snippet.Purpose == "" {
+		t.Errorf("CodeSnippet = %+v, want normalized terraform snippet with filename and purpose", snippet)
+	}
+	if !strings.HasPrefix(response.DiagramCode, "graph TD") || !response.PipelineDecision.ArchitectureDiagram {
+		t.Errorf("DiagramCode = %q, want the structured diagram", response.DiagramCode)
+	}
+	if len(response.Sections) != 2 || len(response.Assumptions) != 1 {
+		t.Errorf("Expected sections and assumptions to be carried over, got %d and %d",
+			len(response.Sections), len(response.Assumptions))
+	}
+}
@@ -0,0 +1,496 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+
+	"github.com/your-org/ai-sa-assistant/configs/prompts"
+	"github.com/your-org/ai-sa-assistant/internal/session"
+)
+
+// promptReloadDelay debounces the burst of file events an editor produces for one save
+const promptReloadDelay = 200 * time.Millisecond
+
+// promptTemplateVariables are the PromptTemplateData fields a template may declare
+var promptTemplateVariables = map[string]bool{
+	"Query":               true,
+	"QueryType":           true,
+	"Context":             true,
+	"WebResults":          true,
+	"ConversationHistory": true,
+}
+
+// queryTypeNames are the names used for query types in prompt template files
+var queryTypeNames = map[QueryType]string{
+	TechnicalQuery:  "technical",
+	BusinessQuery:   "business",
+	GeneralQuery:    "general",
+	ComparisonQuery: "comparison",
+}
+
+// QueryTypeName returns the name of a query type, as used in prompt templates and
+// pipeline decisions
+func QueryTypeName(queryType QueryType) string {
+	return queryTypeNames[queryType]
+}
+
+// promptTemplateFuncs are the functions available to prompt templates
+var promptTemplateFuncs = template.FuncMap{
+	"add":             func(a, b int) int { return a + b },
+	"queryParameters": extractQueryParameters,
+	"contextEntry":    formatContextEntry,
+	"webResult":       formatWebResultWithURL,
+}
+
+// builtinPromptTemplateFile is the shipped template the built-in prompt is rendered from
+const builtinPromptTemplateFile = "solutions-architect.v1.yaml"
+
+// builtinPromptTemplate returns the shipped template the built-in prompt is rendered from.
+// The template is compiled into the binary, so failing to parse it is a programming error.
+var builtinPromptTemplate = sync.OnceValue(func() *PromptTemplate {
+	data, err := prompts.Files.ReadFile(builtinPromptTemplateFile)
+	if err != nil {
+		panic(fmt.Sprintf("failed to read built-in prompt template: %v", err))
+	}
+	tmpl, err := ParsePromptTemplate(data, builtinPromptTemplateFile)
+	if err != nil {
+		panic(err)
+	}
+	return tmpl
+})
+
+// buildSystemPrompt renders the system message of the built-in prompt for the query type
+func buildSystemPrompt(queryType QueryType) string {
+	var system bytes.Buffer
+	data := PromptTemplateData{QueryType: queryTypeNames[queryType]}
+	if err := builtinPromptTemplate().system.Execute(&system, data); err != nil {
+		panic(fmt.Sprintf("failed to render built-in system prompt: %v", err))
+	}
+	return system.String()
+}
+
+// builtinPromptSection renders a section defined in the user template of the built-in
+// prompt template
+func builtinPromptSection(name string, data interface{}) string {
+	var section bytes.Buffer
+	if err := builtinPromptTemplate().user.ExecuteTemplate(&section, name, data); err != nil {
+		panic(fmt.Sprintf("failed to render built-in prompt section %q: %v", name, err))
+	}
+	return section.String()
+}
+
+// PromptTemplate is a named, versioned pair of system and user prompt templates written
+// in text/template syntax
+type PromptTemplate struct {
+	ID          string `yaml:"id"`
+	Version     int    `yaml:"version"`
+	Description string `yaml:"description"`
+	// QueryTypes lists the query types ("technical", "business", "general", "comparison")
+	// the template serves; an empty list serves all of them
+	QueryTypes []string `yaml:"query_types"`
+	// Experiment names the experiment the template takes part in; templates without an
+	// experiment are the defaults
+	Experiment string `yaml:"experiment"`
+	// Variables lists the PromptTemplateData fields the template uses
+	Variables []string `yaml:"variables"`
+	System    string   `yaml:"system"`
+	User      string   `yaml:"user"`
+	// Path is the file the template was loaded from
+	Path string `yaml:"-"`
+
+	system *template.Template
+	user   *template.Template
+}
+
+// PromptTemplateData holds the variables available to prompt templates
+type PromptTemplateData struct {
+	Query string
+	// QueryType is "technical", "business", "general" or "comparison"
+	QueryType  string
+	Context    []ContextItem
+	WebResults []string
+	// ConversationHistory is the formatted previous conversation, empty for a new one
+	ConversationHistory string
+}
+
+// ParsePromptTemplate parses and validates a prompt template file. The templates must
+// parse, use only their declared variables, and render a prompt that passes ValidatePrompt.
+func ParsePromptTemplate(data []byte, path string) (*PromptTemplate, error) {
+	var tmpl PromptTemplate
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&tmpl); err != nil {
+		return nil, fmt.Errorf("invalid prompt template %s: %w", path, err)
+	}
+	tmpl.Path = path
+
+	if err := tmpl.validateFields(); err != nil {
+		return nil, fmt.Errorf("invalid prompt template %s: %w", path, err)
+	}
+
+	var err error
+	if tmpl.system, err = tmpl.parse("system", tmpl.System); err != nil {
+		return nil, fmt.Errorf("invalid prompt template %s: %w", path, err)
+	}
+	if tmpl.user, err = tmpl.parse("user", tmpl.User); err != nil {
+		return nil, fmt.Errorf("invalid prompt template %s: %w", path, err)
+	}
+
+	sample := PromptTemplateData{
+		Query:     "Plan a migration of 40 VMs to AWS",
+		QueryType: queryTypeNames[TechnicalQuery],
+		Context:   []ContextItem{{Content: "Sample context", SourceID: "sample-doc"}},
+		WebResults: []string{
+			"Title: Sample result\nSnippet: Sample snippet\nURL: https://example.com/sample",
+		},
+		ConversationHistory: "User: Sample question\n",
+	}
+	messages, err := tmpl.Render(sample)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template %s: %w", path, err)
+	}
+	if err := ValidatePrompt(messages.SystemMessage + "\n\n" + messages.UserMessage); err != nil {
+		return nil, fmt.Errorf("invalid prompt template %s: %w", path, err)
+	}
+
+	return &tmpl, nil
+}
+
+// validateFields checks the template's metadata
+func (t *PromptTemplate) validateFields() error {
+	if strings.TrimSpace(t.ID) == "" {
+		return fmt.Errorf("id is required")
+	}
+	if t.Version <= 0 {
+		return fmt.Errorf("version must be greater than 0")
+	}
+	if strings.TrimSpace(t.System) == "" || strings.TrimSpace(t.User) == "" {
+		return fmt.Errorf("system and user templates are required")
+	}
+
+	validQueryTypes := make(map[string]bool, len(queryTypeNames))
+	for _, name := range queryTypeNames {
+		validQueryTypes[name] = true
+	}
+	for _, queryType := range t.QueryTypes {
+		if !validQueryTypes[queryType] {
+			return fmt.Errorf("unknown query type %q", queryType)
+		}
+	}
+
+	for _, variable := range t.Variables {
+		if !promptTemplateVariables[variable] {
+			return fmt.Errorf("unknown variable %q", variable)
+		}
+	}
+	return nil
+}
+
+// parse parses one of the template's prompts and checks that it only uses declared variables
+func (t *PromptTemplate) parse(name, text string) (*template.Template, error) {
+	parsed, err := template.New(name).Funcs(promptTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s template: %w", name, err)
+	}
+
+	declared := make(map[string]bool, len(t.Variables))
+	for _, variable := range t.Variables {
+		declared[variable] = true
+	}
+	used := make(map[string]bool)
+	collectTemplateFields(parsed.Tree.Root, used)
+	for field := range used {
+		if !declared[field] {
+			return nil, fmt.Errorf("%s template uses undeclared variable %q", name, field)
+		}
+	}
+	return parsed, nil
+}
+
+// Render executes the template with the given data
+func (t *PromptTemplate) Render(data PromptTemplateData) (PromptMessages, error) {
+	var system, user bytes.Buffer
+	if err := t.system.Execute(&system, data); err != nil {
+		return PromptMessages{}, fmt.Errorf("failed to render system template: %w", err)
+	}
+	if err := t.user.Execute(&user, data); err != nil {
+		return PromptMessages{}, fmt.Errorf("failed to render user template: %w", err)
+	}
+	return PromptMessages{
+		SystemMessage:   system.String(),
+		UserMessage:     user.String(),
+		TemplateID:      t.ID,
+		TemplateVersion: t.Version,
+	}, nil
+}
+
+// servesQueryType reports whether the template is meant for the query type
+func (t *PromptTemplate) servesQueryType(queryType QueryType) bool {
+	if len(t.QueryTypes) == 0 {
+		return true
+	}
+	name := queryTypeNames[queryType]
+	for _, candidate := range t.QueryTypes {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+// collectTemplateFields records the top-level fields of the data referenced by node.
+// Fields referenced inside range and with blocks are relative to a different dot and
+// are not collected.
+func collectTemplateFields(node parse.Node, fields map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateFields(child, fields)
+		}
+	case *parse.ActionNode:
+		collectTemplateFields(n.Pipe, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				collectTemplateFields(arg, fields)
+			}
+		}
+	case *parse.FieldNode:
+		fields[n.Ident[0]] = true
+	case *parse.ChainNode:
+		collectTemplateFields(n.Node, fields)
+	case *parse.IfNode:
+		collectTemplateFields(n.Pipe, fields)
+		collectTemplateFields(n.List, fields)
+		collectTemplateFields(n.ElseList, fields)
+	case *parse.RangeNode:
+		collectTemplateFields(n.Pipe, fields)
+		collectTemplateFields(n.ElseList, fields)
+	case *parse.WithNode:
+		collectTemplateFields(n.Pipe, fields)
+		collectTemplateFields(n.ElseList, fields)
+	case *parse.TemplateNode:
+		collectTemplateFields(n.Pipe, fields)
+	}
+}
+
+// BuildPromptMessagesFromTemplate renders the template with the same source selection,
+// conversation history budget and token limit as the built-in prompt
+func BuildPromptMessagesFromTemplate(
+	tmpl *PromptTemplate,
+	query string,
+	contextItems []ContextItem,
+	webResults []string,
+	conversationHistory []session.Message,
+	config PromptConfig,
+) (PromptMessages, error) {
+	selectedContext, selectedWebResults := selectPromptSources(contextItems, webResults, config)
+
+	messages, err := tmpl.Render(PromptTemplateData{
+		Query:               query,
+		QueryType:           queryTypeNames[config.QueryType],
+		Context:             selectedContext,
+		WebResults:          selectedWebResults,
+		ConversationHistory: formatConversationHistoryWithTokenLimit(conversationHistory, DefaultMaxHistoryTokens),
+	})
+	if err != nil {
+		return PromptMessages{}, fmt.Errorf("prompt template %s v%d: %w", tmpl.ID, tmpl.Version, err)
+	}
+
+	limited := limitPromptMessages(messages.SystemMessage, messages.UserMessage, config.MaxTokens)
+	limited.TemplateID = messages.TemplateID
+	limited.TemplateVersion = messages.TemplateVersion
+	return limited, nil
+}
+
+// LoadPromptTemplates loads every .yaml and .yml prompt template in dir. Two templates
+// may share an ID only with different versions.
+func LoadPromptTemplates(dir string) ([]*PromptTemplate, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt template directory: %w", err)
+	}
+
+	var templates []*PromptTemplate
+	seen := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || !isPromptTemplateFile(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template %s: %w", path, err)
+		}
+		tmpl, err := ParsePromptTemplate(data, path)
+		if err != nil {
+			return nil, err
+		}
+
+		key := fmt.Sprintf("%s@%d", tmpl.ID, tmpl.Version)
+		if previous, exists := seen[key]; exists {
+			return nil, fmt.Errorf("prompt template %s v%d is defined in both %s and %s", tmpl.ID, tmpl.Version, previous, path)
+		}
+		seen[key] = path
+		templates = append(templates, tmpl)
+	}
+	return templates, nil
+}
+
+// isPromptTemplateFile reports whether name is a prompt template file
+func isPromptTemplateFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return (ext == ".yaml" || ext == ".yml") && !strings.HasPrefix(name, ".")
+}
+
+// PromptRegistry holds the prompt templates loaded from a directory and selects one per query
+type PromptRegistry struct {
+	dir       string
+	mu        sync.RWMutex
+	templates []*PromptTemplate
+}
+
+// NewPromptRegistry loads the prompt templates in dir
+func NewPromptRegistry(dir string) (*PromptRegistry, error) {
+	registry := &PromptRegistry{dir: dir}
+	if err := registry.Reload(); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// Reload reloads the templates from the directory. When any template fails to load the
+// previously loaded templates stay in use.
+func (r *PromptRegistry) Reload() error {
+	templates, err := LoadPromptTemplates(r.dir)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.templates = templates
+	r.mu.Unlock()
+	return nil
+}
+
+// Templates returns the loaded templates
+func (r *PromptRegistry) Templates() []*PromptTemplate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*PromptTemplate(nil), r.templates...)
+}
+
+// Select returns the template to use for a query type. Templates in the named experiment
+// are preferred; otherwise a default template serving the query type is used. Among
+// candidates the highest version wins, with ties broken by ID. It returns nil when no
+// template serves the query type.
+func (r *PromptRegistry) Select(queryType QueryType, experiment string) *PromptTemplate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var defaults, experimental []*PromptTemplate
+	for _, tmpl := range r.templates {
+		if !tmpl.servesQueryType(queryType) {
+			continue
+		}
+		switch {
+		case tmpl.Experiment == "":
+			defaults = append(defaults, tmpl)
+		case experiment != "" && tmpl.Experiment == experiment:
+			experimental = append(experimental, tmpl)
+		}
+	}
+
+	candidates := defaults
+	if len(experimental) > 0 {
+		candidates = experimental
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Version != candidates[j].Version {
+			return candidates[i].Version > candidates[j].Version
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	return candidates[0]
+}
+
+// Watch reloads the templates whenever a file in the directory changes, until ctx is
+// done. onReload, when set, is called with the result of each reload.
+func (r *PromptRegistry) Watch(ctx context.Context, onReload func(error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create prompt template watcher: %w", err)
+	}
+	if err := watcher.Add(r.dir); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("failed to watch prompt template directory: %w", err)
+	}
+
+	go func() {
+		defer func() { _ = watcher.Close() }()
+
+		timer := time.NewTimer(promptReloadDelay)
+		timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if isPromptTemplateFile(filepath.Base(event.Name)) {
+					timer.Reset(promptReloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				if onReload != nil {
+					onReload(fmt.Errorf("prompt template watcher error: %w", err))
+				}
+			case <-timer.C:
+				err := r.Reload()
+				if onReload != nil {
+					onReload(err)
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package synth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// promptTemplateFile returns a minimal valid prompt template file
+func promptTemplateFile(id string, version int, queryTypes, experiment string) string {
+	return fmt.Sprintf(`id: %s
+version: %d
+query_types: [%s]
+experiment: %q
+variables: [Query]
+system: |-
+  You are a Cloud Solutions Architect assistant (%s v%d).
+  MERMAID.JS DIAGRAM GENERATION INSTRUCTIONS: draw graph TD diagrams in `+"```mermaid"+` blocks.
+  CODE GENERATION INSTRUCTIONS: write terraform, AWS CLI, Azure CLI and PowerShell code with
+  meaningful comments. NEVER include hardcoded secrets.
+user: |-
+  User Query: {{ .Query }}
+  Cite sources with [source_id].
+`, id, version, queryTypes, experiment, id, version)
+}
+
+// writePromptTemplate writes a prompt template file into dir
+func writePromptTemplate(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+}
+
+func TestShippedPromptTemplateMatchesBuiltInPrompt(t *testing.T) {
+	templates, err := LoadPromptTemplates("../../configs/prompts")
+	if err != nil {
+		t.Fatalf("LoadPromptTemplates() error = %v", err)
+	}
+	if len(templates) != 1 {
+		t.Fatalf("Expected 1 shipped template, got %d", len(templates))
+	}
+
+	trailingSpace := regexp.MustCompile(`(?m)[ \t]+$`)
+	contextItems := []ContextItem{{Content: "Rehost with Application Migration Service.", SourceID: "aws-mgn-guide"}}
+	webResults := []string{"Title: EKS versions\nSnippet: EKS supports 1.31\nURL: https://aws.amazon.com/eks/"}
+
+	for queryType, name := range queryTypeNames {
+		t.Run(name, func(t *testing.T) {
+			config := DefaultPromptConfig()
+			config.QueryType = queryType
+
+			rendered, err := BuildPromptMessagesFromTemplate(templates[0], "Migrate 40 VMs to AWS", contextItems, webResults, nil, config)
+			if err != nil {
+				t.Fatalf("BuildPromptMessagesFromTemplate() error = %v", err)
+			}
+			builtIn := BuildPromptMessagesWithConfig("Migrate 40 VMs to AWS", contextItems, webResults, config)
+
+			if trailingSpace.ReplaceAllString(rendered.SystemMessage, "") != trailingSpace.ReplaceAllString(builtIn.SystemMessage, "") {
+				t.Error("System message differs from the built-in prompt")
+			}
+			if rendered.UserMessage != builtIn.UserMessage {
+				t.Errorf("User message differs from the built-in prompt:\n%s\n---\n%s", rendered.UserMessage, builtIn.UserMessage)
+			}
+			if rendered.TemplateID != "solutions-architect" || rendered.TemplateVersion != 1 {
+				t.Errorf("Template = %s v%d, want solutions-architect v1", rendered.TemplateID, rendered.TemplateVersion)
+			}
+		})
+	}
+}
+
+func TestParsePromptTemplateRejectsInvalidTemplates(t *testing.T) {
+	valid := promptTemplateFile("sa", 1, "", "")
+
+	tests := []struct {
+		name      string
+		content   string
+		wantError string
+	}{
+		{
+			name:      "missing id",
+			content:   strings.Replace(valid, "id: sa", "id: ''", 1),
+			wantError: "id is required",
+		},
+		{
+			name:      "invalid version",
+			content:   strings.Replace(valid, "version: 1", "version: 0", 1),
+			wantError: "version must be greater than 0",
+		},
+		{
+			name:      "unknown field",
+			content:   valid + "owner: platform\n",
+			wantError: "field owner not found",
+		},
+		{
+			name:      "unknown query type",
+			content:   strings.Replace(valid, "query_types: []", "query_types: [pricing]", 1),
+			wantError: `unknown query type "pricing"`,
+		},
+		{
+			name:      "unknown variable",
+			content:   strings.Replace(valid, "variables: [Query]", "variables: [Query, Region]", 1),
+			wantError: `unknown variable "Region"`,
+		},
+		{
+			name:      "undeclared variable",
+			content:   strings.Replace(valid, "User Query: {{ .Query }}", "User Query: {{ .Query }} ({{ .QueryType }})", 1),
+			wantError: `uses undeclared variable "QueryType"`,
+		},
+		{
+			name:      "template syntax error",
+			content:   strings.Replace(valid, "{{ .Query }}", "{{ .Query }", 1),
+			wantError: "user template",
+		},
+		{
+			name:      "fails prompt validation",
+			content:   strings.Replace(valid, "MERMAID.JS DIAGRAM GENERATION INSTRUCTIONS: ", "", 1),
+			wantError: "Mermaid.js diagram generation instructions",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePromptTemplate([]byte(tt.content), "test.yaml")
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Error = %v, want it to contain %q", err, tt.wantError)
+			}
+		})
+	}
+
+	if _, err := ParsePromptTemplate([]byte(valid), "test.yaml"); err != nil {
+		t.Errorf("ParsePromptTemplate() error = %v for a valid template", err)
+	}
+}
+
+func TestPromptRegistrySelect(t *testing.T) {
+	dir := t.TempDir()
+	writePromptTemplate(t, dir, "sa.v1.yaml", promptTemplateFile("sa", 1, "", ""))
+	writePromptTemplate(t, dir, "sa.v2.yaml", promptTemplateFile("sa", 2, "technical, general", ""))
+	writePromptTemplate(t, dir, "concise.v1.yaml", promptTemplateFile("concise", 1, "technical", "concise-answers"))
+	writePromptTemplate(t, dir, "README.md", "not a template")
+
+	registry, err := NewPromptRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewPromptRegistry() error = %v", err)
+	}
+	if len(registry.Templates()) != 3 {
+		t.Fatalf("Templates() = %d, want 3", len(registry.Templates()))
+	}
+
+	tests := []struct {
+		name        string
+		queryType   QueryType
+		experiment  string
+		wantID      string
+		wantVersion int
+	}{
+		{"highest version", TechnicalQuery, "", "sa", 2},
+		{"version serving the query type", BusinessQuery, "", "sa", 1},
+		{"experiment", TechnicalQuery, "concise-answers", "concise", 1},
+		{"experiment without a template for the query type", GeneralQuery, "concise-answers", "sa", 2},
+		{"unknown experiment", TechnicalQuery, "verbose-answers", "sa", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := registry.Select(tt.queryType, tt.experiment)
+			if selected == nil {
+				t.Fatal("Expected a template")
+			}
+			if selected.ID != tt.wantID || selected.Version != tt.wantVersion {
+				t.Errorf("Select() = %s v%d, want %s v%d", selected.ID, selected.Version, tt.wantID, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestPromptRegistryReloadKeepsTemplatesOnError(t *testing.T) {
+	dir := t.TempDir()
+	writePromptTemplate(t, dir, "sa.v1.yaml", promptTemplateFile("sa", 1, "", ""))
+
+	registry, err := NewPromptRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewPromptRegistry() error = %v", err)
+	}
+
+	writePromptTemplate(t, dir, "copy.yaml", promptTemplateFile("sa", 1, "", ""))
+	if err := registry.Reload(); err == nil || !strings.Contains(err.Error(), "defined in both") {
+		t.Fatalf("Reload() error = %v, want a duplicate version error", err)
+	}
+	if selected := registry.Select(GeneralQuery, ""); selected == nil || selected.ID != "sa" {
+		t.Errorf("Expected the previously loaded template to stay in use, got %+v", selected)
+	}
+}
+
+func TestPromptRegistryWatch(t *testing.T) {
+	dir := t.TempDir()
+	writePromptTemplate(t, dir, "sa.v1.yaml", promptTemplateFile("sa", 1, "", ""))
+
+	registry, err := NewPromptRegistry(dir)
+	if err != nil {
+		t.Fatalf("NewPromptRegistry() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan error, 10)
+	if err := registry.Watch(ctx, func(err error) { reloaded <- err }); err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	writePromptTemplate(t, dir, "sa.v2.yaml", promptTemplateFile("sa", 2, "", ""))
+
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("Reload error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the templates to reload")
+	}
+	if selected := registry.Select(GeneralQuery, ""); selected == nil || selected.Version != 2 {
+		t.Errorf("Expected version 2 after reload, got %+v", selected)
+	}
+}
@@ -20,9 +20,13 @@ package teams
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/your-org/ai-sa-assistant/internal/codecheck"
+	"github.com/your-org/ai-sa-assistant/internal/diagram"
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
 	"github.com/your-org/ai-sa-assistant/internal/synth"
 )
 
@@ -49,6 +53,16 @@ type CardElement struct {
 	Spacing   string        `json:"spacing,omitempty"`
 	Separator bool          `json:"separator,omitempty"`
 	Items     []CardElement `json:"items,omitempty"`
+	Actions   []CardAction  `json:"actions,omitempty"`
+	// Columns and Rows are set on Table elements, Cells on their TableRow elements
+	Columns []CardTableColumn `json:"columns,omitempty"`
+	Rows    []CardElement     `json:"rows,omitempty"`
+	Cells   []CardElement     `json:"cells,omitempty"`
+}
+
+// CardTableColumn sets the relative width of a Table column
+type CardTableColumn struct {
+	Width int `json:"width"`
 }
 
 // CardAction represents an action in the card
@@ -90,8 +104,10 @@ func GenerateCard(response synth.SynthesisResponse, query string, diagramURL str
 		Separator: true,
 	})
 
-	// Main response
-	if response.MainText != "" {
+	// Main response. A comparison is shown as a table, which TextBlock markdown cannot render.
+	if response.Comparison != nil {
+		card.Body = append(card.Body, comparisonElements(response.Comparison)...)
+	} else if response.MainText != "" {
 		card.Body = append(card.Body, CardElement{
 			Type:    "TextBlock",
 			Text:    response.MainText,
@@ -100,6 +116,11 @@ func GenerateCard(response synth.SynthesisResponse, query string, diagramURL str
 		})
 	}
 
+	// Cost estimate priced from the price list
+	if response.CostEstimate != nil && len(response.CostEstimate.Lines) > 0 {
+		card.Body = append(card.Body, costEstimateElements(response.CostEstimate)...)
+	}
+
 	// Architecture diagram
 	if diagramURL != "" {
 		card.Body = append(card.Body, CardElement{
@@ -116,6 +137,14 @@ func GenerateCard(response synth.SynthesisResponse, query string, diagramURL str
 			AltText: "Architecture Diagram",
 			Spacing: "Small",
 		})
+
+		if downloads := diagramDownloadActions(response.DiagramDownloads); len(downloads) > 0 {
+			card.Body = append(card.Body, CardElement{
+				Type:    "ActionSet",
+				Actions: downloads,
+				Spacing: "Small",
+			})
+		}
 	}
 
 	// Code snippets
@@ -145,6 +174,10 @@ func GenerateCard(response synth.SynthesisResponse, query string, diagramURL str
 				Wrap:     true,
 				Spacing:  "Small",
 			})
+
+			if len(snippet.Findings) > 0 {
+				card.Body = append(card.Body, snippetFindingsElement(snippet.Findings))
+			}
 		}
 	}
 
@@ -206,6 +239,19 @@ func GenerateCard(response synth.SynthesisResponse, query string, diagramURL str
 				"timestamp":         time.Now().Format(time.RFC3339),
 			},
 		},
+		CardAction{
+			Type:   "Action.Http",
+			Title:  "📄 Export",
+			Method: "POST",
+			URL:    "/teams-export",
+			Body: map[string]interface{}{
+				"query":       query,
+				"response_id": responseID,
+				"format":      "docx",
+				"response":    exportPayload(response),
+				"timestamp":   time.Now().Format(time.RFC3339),
+			},
+		},
 	)
 
 	// Marshal to JSON
@@ -217,6 +263,226 @@ func GenerateCard(response synth.SynthesisResponse, query string, diagramURL str
 	return string(cardJSON), nil
 }
 
+// diagramDownloadActions links the editable versions of a diagram, in the order the formats
+// are offered
+func diagramDownloadActions(downloads map[string]string) []CardAction {
+	var actions []CardAction
+	for _, format := range diagram.ExportFormats {
+		if url := downloads[string(format)]; url != "" {
+			actions = append(actions, CardAction{
+				Type:  "Action.OpenUrl",
+				Title: "⬇️ " + format.Title(),
+				URL:   url,
+			})
+		}
+	}
+	return actions
+}
+
+// maxCardSnippetFindings is the number of validation findings listed under a snippet
+const maxCardSnippetFindings = 5
+
+// snippetFindingsElement lists a snippet's validation findings, colored by the most severe one
+func snippetFindingsElement(findings []codecheck.Finding) CardElement {
+	color := "Warning"
+	if codecheck.HasErrors(findings) {
+		color = "Attention"
+	}
+
+	lines := make([]string, 0, maxCardSnippetFindings+1)
+	for _, finding := range findings[:min(len(findings), maxCardSnippetFindings)] {
+		icon := "⚠️"
+		if finding.Severity == codecheck.SeverityError {
+			icon = "❌"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", icon, finding))
+	}
+	if len(findings) > maxCardSnippetFindings {
+		lines = append(lines, fmt.Sprintf("…and %d more", len(findings)-maxCardSnippetFindings))
+	}
+
+	return CardElement{
+		Type:    "TextBlock",
+		Text:    strings.Join(lines, "\n\n"),
+		Color:   color,
+		Size:    "Small",
+		Wrap:    true,
+		Spacing: "Small",
+	}
+}
+
+// costEstimateElements shows a cost estimate as a table of its line items and totals,
+// followed by the assumptions behind the figures
+func costEstimateElements(estimate *pricing.Estimate) []CardElement {
+	rows := []CardElement{costTableRow(true, "Item", "Quantity", "Monthly", "Annual")}
+	for _, line := range estimate.Lines {
+		rows = append(rows, costTableRow(false, line.Description,
+			fmt.Sprintf("%s %s", strconv.FormatFloat(line.Quantity, 'f', -1, 64), line.Unit),
+			pricing.FormatAmount(line.Monthly), pricing.FormatAmount(line.Annual)))
+	}
+	rows = append(rows, costTableRow(true, "Total", "",
+		pricing.FormatAmount(estimate.MonthlyTotal), pricing.FormatAmount(estimate.AnnualTotal)))
+
+	return []CardElement{
+		{
+			Type:      "TextBlock",
+			Text:      "**Cost Estimate:**",
+			Weight:    "Bolder",
+			Spacing:   "Medium",
+			Separator: true,
+		},
+		{
+			Type:    "Table",
+			Columns: []CardTableColumn{{Width: 4}, {Width: 2}, {Width: 2}, {Width: 2}},
+			Rows:    rows,
+			Spacing: "Small",
+		},
+		{
+			Type:    "TextBlock",
+			Text:    "Assumptions: " + strings.Join(estimate.Assumptions, ". "),
+			Size:    "Small",
+			Wrap:    true,
+			Spacing: "Small",
+		},
+	}
+}
+
+// comparisonElements shows a comparison as its summary, a table with a row per dimension
+// and a column per platform ending with each column's sources, and the recommendation
+func comparisonElements(comparison *synth.Comparison) []CardElement {
+	columns := []CardTableColumn{{Width: 2}}
+	header := []string{"Dimension"}
+	for _, platform := range comparison.Platforms {
+		columns = append(columns, CardTableColumn{Width: 3})
+		header = append(header, platform.Name)
+	}
+
+	rows := []CardElement{costTableRow(true, header...)}
+	for _, dimension := range comparison.Dimensions {
+		cells := []string{dimension.Title}
+		for _, cell := range dimension.Cells {
+			cells = append(cells, cell.TextWithCitations())
+		}
+		rows = append(rows, costTableRow(false, cells...))
+	}
+	costs := []string{"Estimated monthly cost"}
+	sources := []string{"Sources"}
+	priced := false
+	for _, platform := range comparison.Platforms {
+		costs = append(costs, synth.ComparisonCostSummary(platform.CostEstimate))
+		priced = priced || platform.CostEstimate != nil
+		if len(platform.Sources) == 0 {
+			sources = append(sources, "None")
+			continue
+		}
+		sources = append(sources, "["+strings.Join(platform.Sources, "] [")+"]")
+	}
+	if priced {
+		rows = append(rows, costTableRow(false, costs...))
+	}
+	rows = append(rows, costTableRow(false, sources...))
+
+	elements := []CardElement{
+		{
+			Type:    "TextBlock",
+			Text:    fmt.Sprintf("**%s**\n\n%s", comparison.Title, comparison.Summary),
+			Wrap:    true,
+			Spacing: "Medium",
+		},
+		{
+			Type:    "Table",
+			Columns: columns,
+			Rows:    rows,
+			Spacing: "Small",
+		},
+	}
+	if comparison.Recommendation != "" {
+		elements = append(elements, CardElement{
+			Type:    "TextBlock",
+			Text:    "**Recommendation:** " + comparison.Recommendation,
+			Wrap:    true,
+			Spacing: "Medium",
+		})
+	}
+	return elements
+}
+
+// costTableRow returns a row of the cost table, in bold for the header and total
+func costTableRow(bold bool, cells ...string) CardElement {
+	weight := ""
+	if bold {
+		weight = "Bolder"
+	}
+	row := CardElement{Type: "TableRow"}
+	for _, text := range cells {
+		row.Cells = append(row.Cells, CardElement{
+			Type:  "TableCell",
+			Items: []CardElement{{Type: "TextBlock", Text: text, Weight: weight, Wrap: true}},
+		})
+	}
+	return row
+}
+
+// exportPayload returns the parts of a response that an exported document needs, leaving out
+// retrieval previews and statistics to keep the card small
+func exportPayload(response synth.SynthesisResponse) map[string]interface{} {
+	payload := map[string]interface{}{
+		"main_text":     response.MainText,
+		"diagram_code":  response.DiagramCode,
+		"code_snippets": response.CodeSnippets,
+		"sources":       response.Sources,
+	}
+
+	var webSources []synth.WebSourceInfo
+	for _, source := range response.WebSources {
+		if source.Used {
+			webSources = append(webSources, synth.WebSourceInfo{URL: source.URL, Title: source.Title, Used: true})
+		}
+	}
+	if len(webSources) > 0 {
+		payload["web_sources"] = webSources
+	}
+	return payload
+}
+
+// GenerateExportCard creates a card that links to a rendered export
+func GenerateExportCard(fileName, downloadURL string) (string, error) {
+	card := AdaptiveCard{
+		Type:    "AdaptiveCard",
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Version: "1.3",
+		Body: []CardElement{
+			{
+				Type:   "TextBlock",
+				Text:   "📄 Your export is ready",
+				Size:   "Medium",
+				Weight: "Bolder",
+				Wrap:   true,
+			},
+			{
+				Type:    "TextBlock",
+				Text:    fileName,
+				Wrap:    true,
+				Spacing: "Small",
+			},
+		},
+		Actions: []CardAction{
+			{
+				Type:  "Action.OpenUrl",
+				Title: "⬇️ Download",
+				URL:   downloadURL,
+			},
+		},
+	}
+
+	cardJSON, err := json.MarshalIndent(card, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal export card: %w", err)
+	}
+
+	return string(cardJSON), nil
+}
+
 // GenerateSimpleCard creates a simple text-only card for errors or simple responses
 func GenerateSimpleCard(title, message string) (string, error) {
 	card := AdaptiveCard{
@@ -19,6 +19,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/your-org/ai-sa-assistant/internal/codecheck"
+	"github.com/your-org/ai-sa-assistant/internal/pricing"
 	"github.com/your-org/ai-sa-assistant/internal/synth"
 )
 
@@ -390,11 +392,11 @@ func validateCardActions(t *testing.T, card map[string]interface{}, query string
 		return
 	}
 
-	if len(actions) != 3 {
-		t.Errorf("Expected 3 actions (positive feedback, negative feedback, and regenerate), got %d", len(actions))
+	if len(actions) != 4 {
+		t.Errorf("Expected 4 actions (positive feedback, negative feedback, regenerate, and export), got %d", len(actions))
 	}
 
-	// Validate feedback actions and regeneration action
+	// Validate feedback, regeneration and export actions
 	expectedActions := []struct {
 		title    string
 		feedback string
@@ -403,6 +405,7 @@ func validateCardActions(t *testing.T, card map[string]interface{}, query string
 		{"👍 Helpful", "positive", "/teams-feedback"},
 		{"👎 Not Helpful", "negative", "/teams-feedback"},
 		{"🔄 Regenerate", "", "/teams-regenerate"},
+		{"📄 Export", "", "/teams-export"},
 	}
 
 	for i, action := range actions {
@@ -471,6 +474,260 @@ func validateActionBody(t *testing.T, actionMap map[string]interface{}, index in
 	}
 }
 
+func TestGenerateCardExportAction(t *testing.T) {
+	response := synth.SynthesisResponse{
+		MainText:     "Use AWS MGN [aws-guide].",
+		DiagramCode:  "graph TD\n  A --> B",
+		CodeSnippets: []synth.CodeSnippet{{Language: "bash", Code: "aws mgn help"}},
+		Sources:      []string{"aws-guide"},
+		ContextSources: []synth.ContextSourceInfo{
+			{SourceID: "aws-guide", Preview: strings.Repeat("preview ", 100)},
+		},
+		WebSources: []synth.WebSourceInfo{
+			{URL: "https://aws.amazon.com/mgn/", Title: "AWS MGN", Snippet: "snippet", Used: true},
+			{URL: "https://example.com/unused"},
+		},
+	}
+
+	cardJSON, err := GenerateCard(response, "Migrate to AWS", "")
+	if err != nil {
+		t.Fatalf("GenerateCard() error = %v", err)
+	}
+
+	var card AdaptiveCard
+	if err := json.Unmarshal([]byte(cardJSON), &card); err != nil {
+		t.Fatalf("Failed to parse card: %v", err)
+	}
+	action := card.Actions[len(card.Actions)-1]
+	if action.URL != "/teams-export" || action.Body["format"] != "docx" {
+		t.Fatalf("Unexpected export action: %+v", action)
+	}
+
+	var exported synth.SynthesisResponse
+	data, _ := json.Marshal(action.Body["response"])
+	if err := json.Unmarshal(data, &exported); err != nil {
+		t.Fatalf("Export payload is not a synthesis response: %v", err)
+	}
+	if exported.DiagramCode != response.DiagramCode || len(exported.CodeSnippets) != 1 || len(exported.ContextSources) != 0 {
+		t.Errorf("Unexpected export payload: %+v", exported)
+	}
+	if len(exported.WebSources) != 1 || exported.WebSources[0].Snippet != "" {
+		t.Errorf("Expected only the cited web source without its snippet, got %+v", exported.WebSources)
+	}
+}
+
+func TestGenerateCardDiagramDownloads(t *testing.T) {
+	response := synth.SynthesisResponse{
+		MainText:    "Connect the data center with ExpressRoute.",
+		DiagramCode: "graph LR\n  DC[Data Center] --> ER[ExpressRoute]",
+		DiagramDownloads: map[string]string{
+			"plantuml": "https://bot.example.com/diagrams/c3",
+			"drawio":   "https://bot.example.com/diagrams/a1",
+			"d2":       "https://bot.example.com/diagrams/b2",
+		},
+	}
+
+	cardJSON, err := GenerateCard(response, "Hybrid connectivity", "https://bot.example.com/diagrams/png")
+	if err != nil {
+		t.Fatalf("GenerateCard() error = %v", err)
+	}
+
+	var card AdaptiveCard
+	if err := json.Unmarshal([]byte(cardJSON), &card); err != nil {
+		t.Fatalf("Failed to parse card: %v", err)
+	}
+	var downloads []CardAction
+	for _, element := range card.Body {
+		if element.Type == "ActionSet" {
+			downloads = element.Actions
+		}
+	}
+
+	want := []struct{ title, url string }{
+		{"⬇️ draw.io", "https://bot.example.com/diagrams/a1"},
+		{"⬇️ D2", "https://bot.example.com/diagrams/b2"},
+		{"⬇️ PlantUML", "https://bot.example.com/diagrams/c3"},
+	}
+	if len(downloads) != len(want) {
+		t.Fatalf("Expected %d diagram downloads, got %+v", len(want), downloads)
+	}
+	for i, action := range downloads {
+		if action.Type != "Action.OpenUrl" || action.Title != want[i].title || action.URL != want[i].url {
+			t.Errorf("Download %d: expected %s at %s, got %+v", i, want[i].title, want[i].url, action)
+		}
+	}
+}
+
+func TestGenerateCardSnippetFindings(t *testing.T) {
+	findings := make([]codecheck.Finding, 0, 7)
+	findings = append(findings, codecheck.Finding{Line: 3, Severity: codecheck.SeverityError,
+		Rule: codecheck.RulePublicStorage, Message: "bucket ACL \"public-read\" makes the objects public"})
+	for i := 0; i < 6; i++ {
+		findings = append(findings, codecheck.Finding{Severity: codecheck.SeverityWarning,
+			Rule: codecheck.RuleMissingArgument, Message: "missing argument"})
+	}
+	response := synth.SynthesisResponse{
+		MainText: "Host the site on S3.",
+		CodeSnippets: []synth.CodeSnippet{
+			{Language: "terraform", Code: "resource \"aws_s3_bucket_acl\" \"site\" {}", Findings: findings},
+			{Language: "bash", Code: "aws s3 ls"},
+		},
+	}
+
+	cardJSON, err := GenerateCard(response, "Static website", "")
+	if err != nil {
+		t.Fatalf("GenerateCard() error = %v", err)
+	}
+
+	var card AdaptiveCard
+	if err := json.Unmarshal([]byte(cardJSON), &card); err != nil {
+		t.Fatalf("Failed to parse card: %v", err)
+	}
+	var blocks []CardElement
+	for _, element := range card.Body {
+		if element.Type == textBlockType && element.Color == "Attention" {
+			blocks = append(blocks, element)
+		}
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("Expected one findings block, got %+v", blocks)
+	}
+	text := blocks[0].Text
+	if !strings.Contains(text, "❌ line 3: bucket ACL") {
+		t.Errorf("Expected the error with its line, got %q", text)
+	}
+	if strings.Count(text, "⚠️") != 4 || !strings.Contains(text, "…and 2 more") {
+		t.Errorf("Expected findings capped at %d, got %q", maxCardSnippetFindings, text)
+	}
+}
+
+func TestGenerateCardCostEstimate(t *testing.T) {
+	response := synth.SynthesisResponse{
+		MainText: "Rehosting costs about $7,000 a month.",
+		CostEstimate: &pricing.Estimate{
+			Provider: "aws", Region: "us-east-1", PriceListVersion: "2024-06", Currency: "USD",
+			Lines: []pricing.LineItem{
+				{Kind: pricing.KindCompute, SKU: "m5.large", Description: "EC2 m5.large Linux", Quantity: 73000,
+					Unit: pricing.UnitHour, UnitPrice: 0.096, Monthly: 7008, Annual: 84096},
+			},
+			MonthlyTotal: 7008,
+			AnnualTotal:  84096,
+			Assumptions:  []string{"Each of the 100 VMs is a m5.large running 730 hours a month"},
+		},
+	}
+
+	cardJSON, err := GenerateCard(response, "Cost of 100 VMs on AWS", "")
+	if err != nil {
+		t.Fatalf("GenerateCard() error = %v", err)
+	}
+
+	var card AdaptiveCard
+	if err := json.Unmarshal([]byte(cardJSON), &card); err != nil {
+		t.Fatalf("Failed to parse card: %v", err)
+	}
+	var table *CardElement
+	for i, element := range card.Body {
+		if element.Type == "Table" {
+			table = &card.Body[i]
+		}
+	}
+	if table == nil {
+		t.Fatalf("Expected a cost table, got %s", cardJSON)
+	}
+	if len(table.Columns) != 4 || len(table.Rows) != 3 {
+		t.Fatalf("Expected 4 columns and header, line and total rows, got %+v", table)
+	}
+	line := table.Rows[1].Cells
+	if line[0].Items[0].Text != "EC2 m5.large Linux" || line[1].Items[0].Text != "73000 hour" ||
+		line[2].Items[0].Text != "$7,008.00" || line[3].Items[0].Text != "$84,096.00" {
+		t.Errorf("Unexpected line row: %+v", line)
+	}
+	if total := table.Rows[2].Cells; total[0].Items[0].Text != "Total" || total[0].Items[0].Weight != "Bolder" {
+		t.Errorf("Expected a bold total row, got %+v", total)
+	}
+	if !strings.Contains(cardJSON, "Assumptions: Each of the 100 VMs") {
+		t.Errorf("Expected the assumptions under the table")
+	}
+}
+
+func TestGenerateCardComparison(t *testing.T) {
+	response := synth.SynthesisResponse{
+		MainText: "# AWS vs Azure\n\n| Dimension | AWS | Azure |",
+		Comparison: &synth.Comparison{
+			Title:          "AWS vs Azure",
+			Summary:        "Both rehost the VMs.",
+			Recommendation: "Choose Azure for Windows estates.",
+			Platforms: []synth.ComparisonPlatform{
+				{Platform: "aws", Name: "AWS", Sources: []string{"aws-mgn"},
+					CostEstimate: &pricing.Estimate{MonthlyTotal: 7008, PriceListVersion: "2024-06", Region: "us-east-1"}},
+				{Platform: "azure", Name: "Azure"},
+			},
+			Dimensions: []synth.ComparisonDimension{
+				{Kind: "capabilities", Title: "Capabilities", Cells: []synth.ComparisonCell{
+					{Platform: "aws", Text: "MGN", Citations: []string{"aws-mgn"}},
+					{Platform: "azure", Text: "Azure Migrate"},
+				}},
+			},
+		},
+	}
+
+	cardJSON, err := GenerateCard(response, "AWS or Azure?", "")
+	if err != nil {
+		t.Fatalf("GenerateCard() error = %v", err)
+	}
+
+	var card AdaptiveCard
+	if err := json.Unmarshal([]byte(cardJSON), &card); err != nil {
+		t.Fatalf("Failed to parse card: %v", err)
+	}
+	var table *CardElement
+	for i, element := range card.Body {
+		if element.Type == "Table" {
+			table = &card.Body[i]
+		}
+		if strings.Contains(element.Text, "| Dimension |") {
+			t.Error("Expected the markdown table to be replaced by a card table")
+		}
+	}
+	if table == nil {
+		t.Fatalf("Expected a comparison table, got %s", cardJSON)
+	}
+	if len(table.Columns) != 3 || len(table.Rows) != 4 {
+		t.Fatalf("Expected 3 columns and header, dimension, cost and sources rows, got %+v", table)
+	}
+	cellText := func(row, column int) string { return table.Rows[row].Cells[column].Items[0].Text }
+	if cellText(0, 1) != "AWS" || cellText(1, 1) != "MGN [aws-mgn]" || cellText(1, 2) != "Azure Migrate" {
+		t.Errorf("Unexpected header or dimension row: %+v", table.Rows[:2])
+	}
+	if cellText(2, 1) != "$7,008.00 (price list 2024-06, us-east-1)" || cellText(2, 2) != "n/a" {
+		t.Errorf("Unexpected cost row: %+v", table.Rows[2])
+	}
+	if cellText(3, 1) != "[aws-mgn]" || cellText(3, 2) != "None" {
+		t.Errorf("Expected each column's own sources, got %+v", table.Rows[3])
+	}
+	if !strings.Contains(cardJSON, "**Recommendation:** Choose Azure") {
+		t.Error("Expected the recommendation under the table")
+	}
+}
+
+func TestGenerateExportCard(t *testing.T) {
+	cardJSON, err := GenerateExportCard("migration-plan-2024-05-01.docx", "/teams-export/abc123")
+	if err != nil {
+		t.Fatalf("GenerateExportCard() error = %v", err)
+	}
+
+	var card AdaptiveCard
+	if err := json.Unmarshal([]byte(cardJSON), &card); err != nil {
+		t.Fatalf("Failed to parse card: %v", err)
+	}
+	if len(card.Actions) != 1 || card.Actions[0].Type != "Action.OpenUrl" || card.Actions[0].URL != "/teams-export/abc123" {
+		t.Errorf("Unexpected actions: %+v", card.Actions)
+	}
+	if !strings.Contains(cardJSON, "migration-plan-2024-05-01.docx") {
+		t.Error("Expected the card to name the exported file")
+	}
+}
+
 func TestGenerateSimpleCard(t *testing.T) {
 	tests := getGenerateSimpleCardTestCases()
 
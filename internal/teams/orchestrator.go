@@ -18,9 +18,11 @@
 package teams
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -28,12 +30,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/your-org/ai-sa-assistant/internal/acl"
 	"github.com/your-org/ai-sa-assistant/internal/config"
 	"github.com/your-org/ai-sa-assistant/internal/diagram"
+	"github.com/your-org/ai-sa-assistant/internal/export"
 	"github.com/your-org/ai-sa-assistant/internal/health"
 	"github.com/your-org/ai-sa-assistant/internal/session"
 	"github.com/your-org/ai-sa-assistant/internal/streaming"
 	"github.com/your-org/ai-sa-assistant/internal/synth"
+	"github.com/your-org/ai-sa-assistant/internal/websearch"
 	"go.uber.org/zap"
 )
 
@@ -44,6 +49,8 @@ const (
 	FallbackScore = 0.5
 	// MaxFallbackChunks is the maximum number of chunks to include in fallback responses
 	MaxFallbackChunks = 3
+	// maxServerSentEventSize bounds a single line read from the synthesize stream
+	maxServerSentEventSize = 8 * 1024 * 1024
 )
 
 // OrchestrationResult represents the result of orchestrating backend services
@@ -123,6 +130,11 @@ func (o *Orchestrator) ProcessQueryWithStreaming(ctx context.Context, query stri
 		FallbackUsed:   false,
 	}
 
+	// Carry the caller identity to the retrieve service so document access control applies
+	if _, ok := acl.FromContext(ctx); !ok && userID != "" {
+		ctx = acl.WithIdentity(ctx, acl.Identity{UserID: userID, Clearance: acl.DefaultClassification})
+	}
+
 	orchestrationID := fmt.Sprintf("orch_%d", startTime.UnixNano())
 	o.logger.Info("Starting query orchestration",
 		zap.String("query", query),
@@ -148,8 +160,6 @@ func (o *Orchestrator) ProcessQueryWithStreaming(ctx context.Context, query stri
 	// Step 1: Validate service health
 	if eventStream != nil {
 		eventStream.EmitProgress(streaming.StageQueryAnalysis, "⚡ Validating service health...", 10, nil)
-		// Add realistic delay for UI feedback
-		time.Sleep(500 * time.Millisecond)
 	}
 
 	if !o.validateServiceHealthWithStreaming(ctx, result, eventStream) {
@@ -164,8 +174,6 @@ func (o *Orchestrator) ProcessQueryWithStreaming(ctx context.Context, query stri
 	// Step 2: Call retrieve service with fallback
 	if eventStream != nil {
 		eventStream.EmitProgress(streaming.StageMetadataFilter, "📊 Searching metadata database...", 15, nil)
-		// Add realistic delay for UI feedback
-		time.Sleep(300 * time.Millisecond)
 	}
 
 	retrieveResponse, err := o.callRetrieveServiceWithFallbackStreaming(ctx, query, result, eventStream)
@@ -178,34 +186,29 @@ func (o *Orchestrator) ProcessQueryWithStreaming(ctx context.Context, query stri
 		return result
 	}
 
-	// Step 3: Conditionally call web search service
+	// Step 3: Conditionally call web search service. Live search is skipped when the
+	// retrieve service already found fresh release notes.
 	var webResults []string
-	needsWeb := o.needsFreshness(query)
+	needsWeb := o.needsFreshness(query) && !retrieveResponse.ReleaseNotesUsed
 	if needsWeb {
 		if eventStream != nil {
 			eventStream.EmitProgress(streaming.StageFreshnessDetection, "🌐 Freshness keywords detected, triggering web search...", 60, map[string]interface{}{
 				"freshness_detected": true,
 			})
-			// Add realistic delay for UI feedback
-			time.Sleep(800 * time.Millisecond)
 		}
 		webResults = o.callWebSearchServiceWithFallbackStreaming(ctx, query, result, eventStream)
 	} else if eventStream != nil {
 		eventStream.EmitProgress(streaming.StageFreshnessDetection, "✓ No freshness keywords detected", 60, map[string]interface{}{
 			"freshness_detected": false,
 		})
-		// Add realistic delay for UI feedback
-		time.Sleep(300 * time.Millisecond)
 	}
 
 	// Step 4: Call synthesize service with fallback (including conversation context)
 	if eventStream != nil {
-		eventStream.EmitProgress(streaming.StageSynthesis, "🤖 Synthesizing response with GPT-4o...", 75, map[string]interface{}{
+		eventStream.EmitProgress(streaming.StageSynthesis, "🤖 Synthesizing response...", 75, map[string]interface{}{
 			"context_items": len(retrieveResponse.Chunks),
 			"web_results":   len(webResults),
 		})
-		// Add realistic delay for UI feedback
-		time.Sleep(1000 * time.Millisecond)
 	}
 
 	synthesizeResponse, err := o.callSynthesizeServiceWithFallbackStreaming(
@@ -224,8 +227,6 @@ func (o *Orchestrator) ProcessQueryWithStreaming(ctx context.Context, query stri
 	if synthesizeResponse.DiagramCode != "" {
 		if eventStream != nil {
 			eventStream.EmitProgress(streaming.StageDiagramRendering, "📊 Rendering architecture diagram...", 90, nil)
-			// Add realistic delay for UI feedback
-			time.Sleep(500 * time.Millisecond)
 		}
 		o.renderDiagramWithFallbackStreaming(ctx, synthesizeResponse, result, eventStream)
 	}
@@ -341,6 +342,14 @@ func (o *Orchestrator) validateServiceHealthWithStreaming(ctx context.Context, r
 	return result.HealthChecksPassed
 }
 
+// applyCallerIdentity forwards the caller identity stored in ctx as request headers.
+// The request itself uses a background context, so the identity must be copied explicitly.
+func applyCallerIdentity(ctx context.Context, req *http.Request) {
+	if identity, ok := acl.FromContext(ctx); ok {
+		identity.ApplyHeaders(req.Header)
+	}
+}
+
 // callRetrieveServiceWithFallback calls the retrieve service with fallback logic
 func (o *Orchestrator) callRetrieveServiceWithFallback(
 	ctx context.Context,
@@ -361,6 +370,7 @@ func (o *Orchestrator) callRetrieveServiceWithFallback(
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	applyCallerIdentity(ctx, req)
 
 	// Use isolated HTTP client with proper timeout
 	isolatedClient := &http.Client{Timeout: 300 * time.Second}
@@ -422,6 +432,7 @@ func (o *Orchestrator) callRetrieveServiceWithFallbackStreaming(
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	applyCallerIdentity(ctx, req)
 
 	// TEMPORARY: Create a completely isolated HTTP client
 	isolatedClient := &http.Client{Timeout: 300 * time.Second}
@@ -548,9 +559,7 @@ func (o *Orchestrator) callWebSearchServiceWithFallback(
 		return []string{}
 	}
 
-	var webResponse struct {
-		Results []string `json:"results"`
-	}
+	var webResponse webSearchServiceResponse
 	if err := json.NewDecoder(resp.Body).Decode(&webResponse); err != nil {
 		o.logger.Warn("Failed to decode web search response, continuing without web results", zap.Error(err))
 		return []string{}
@@ -561,7 +570,7 @@ func (o *Orchestrator) callWebSearchServiceWithFallback(
 		zap.String("query", query),
 		zap.Int("results_returned", len(webResponse.Results)))
 
-	return webResponse.Results
+	return webResponse.formattedResults()
 }
 
 // callWebSearchServiceWithFallbackStreaming calls the web search service with fallback logic and streaming progress
@@ -634,9 +643,7 @@ func (o *Orchestrator) callWebSearchServiceWithFallbackStreaming(
 		return []string{}
 	}
 
-	var webResponse struct {
-		Results []string `json:"results"`
-	}
+	var webResponse webSearchServiceResponse
 	if err := json.NewDecoder(resp.Body).Decode(&webResponse); err != nil {
 		o.logger.Warn("Failed to decode web search response, continuing without web results", zap.Error(err))
 		if eventStream != nil {
@@ -659,7 +666,7 @@ func (o *Orchestrator) callWebSearchServiceWithFallbackStreaming(
 		zap.String("query", query),
 		zap.Int("results_returned", len(webResponse.Results)))
 
-	return webResponse.Results
+	return webResponse.formattedResults()
 }
 
 // callSynthesizeServiceWithFallbackStreaming calls the synthesize service with fallback logic and streaming progress
@@ -688,9 +695,25 @@ func (o *Orchestrator) callSynthesizeServiceWithFallbackStreaming(
 	}
 
 	if eventStream != nil {
-		eventStream.EmitProgress(streaming.StageSynthesis, "🤖 Generating response with GPT-4o...", 82, map[string]interface{}{
-			"model": "gpt-4o",
-		})
+		eventStream.EmitProgress(streaming.StageSynthesis, "🤖 Generating response...", 82, nil)
+	}
+
+	// Modes are only served by the non-streaming endpoint
+	if eventStream != nil && synthesizeRequest.Mode == "" {
+		// Relay the answer as it is generated. The non-streaming endpoint is used when the
+		// stream cannot be opened; once text has been relayed a failure uses the fallback.
+		synthesizeResponse, relayed, err := o.callSynthesizeStream(jsonBody, eventStream)
+		if err == nil {
+			return o.completeSynthesis(query, synthesizeResponse, result, eventStream), nil
+		}
+		if relayed {
+			o.logger.Error("Streaming synthesis failed after relaying tokens", zap.Error(err))
+			eventStream.EmitProgress(streaming.StageSynthesis, "⚠️ Synthesis stream interrupted, using fallback...", 85, map[string]interface{}{
+				"fallback_triggered": true,
+			})
+			return o.fallbackSynthesizeResponse(query, retrieveResponse, conversationHistory, result), nil
+		}
+		o.logger.Warn("Streaming synthesis unavailable, using non-streaming endpoint", zap.Error(err))
 	}
 
 	// TEMPORARY: Use background context to isolate from any cancellation issues
@@ -744,21 +767,136 @@ func (o *Orchestrator) callSynthesizeServiceWithFallbackStreaming(
 		return o.fallbackSynthesizeResponse(query, retrieveResponse, conversationHistory, result), nil
 	}
 
+	return o.completeSynthesis(query, &synthesizeResponse, result, eventStream), nil
+}
+
+// completeSynthesis records a successful synthesize call
+func (o *Orchestrator) completeSynthesis(
+	query string,
+	synthesizeResponse *synth.SynthesisResponse,
+	result *OrchestrationResult,
+	eventStream *streaming.EventStream,
+) *synth.SynthesisResponse {
 	result.ServicesUsed = append(result.ServicesUsed, "synthesize")
 
 	if eventStream != nil {
-		eventStream.EmitProgress(streaming.StageSynthesis, "✓ Response synthesis complete", 88, map[string]interface{}{
+		data := map[string]interface{}{
 			"response_length": len(synthesizeResponse.MainText),
 			"has_diagram":     synthesizeResponse.DiagramCode != "",
 			"code_snippets":   len(synthesizeResponse.CodeSnippets),
-		})
+		}
+		// The synthesize service routes each query to a model, so report the one it used
+		if model := synthesizeResponse.ProcessingStats.ModelUsed; model != "" {
+			data["model"] = model
+		}
+		eventStream.EmitProgress(streaming.StageSynthesis, "✓ Response synthesis complete", 88, data)
 	}
 
 	o.logger.Info("Synthesize service call successful",
 		zap.String("query", query),
 		zap.Int("main_text_length", len(synthesizeResponse.MainText)))
 
-	return &synthesizeResponse, nil
+	return synthesizeResponse
+}
+
+// callSynthesizeStream calls the streaming synthesize endpoint, relaying token and replace
+// events to eventStream, and returns the response carried by the final complete event. relayed
+// reports whether any tokens were relayed before an error.
+func (o *Orchestrator) callSynthesizeStream(
+	jsonBody []byte,
+	eventStream *streaming.EventStream,
+) (response *synth.SynthesisResponse, relayed bool, err error) {
+	// Use background context to isolate from cancellation, like the non-streaming call
+	req, err := http.NewRequestWithContext(
+		context.Background(),
+		"POST",
+		o.config.Services.SynthesizeURL+"/synthesize/stream",
+		bytes.NewBuffer(jsonBody),
+	)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create synthesize stream request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	isolatedClient := &http.Client{Timeout: DefaultHTTPTimeout}
+	resp, err := isolatedClient.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("synthesize stream request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("synthesize stream returned status %d", resp.StatusCode)
+	}
+
+	err = readServerSentEvents(resp.Body, func(event, data string) error {
+		switch streaming.EventType(event) {
+		case streaming.EventTypeToken:
+			var token struct {
+				Delta string `json:"delta"`
+			}
+			if err := json.Unmarshal([]byte(data), &token); err != nil {
+				return fmt.Errorf("failed to decode token event: %w", err)
+			}
+			eventStream.EmitToken(token.Delta)
+			relayed = true
+		case streaming.EventTypeReplace:
+			var replace struct {
+				MainText string `json:"main_text"`
+			}
+			if err := json.Unmarshal([]byte(data), &replace); err != nil {
+				return fmt.Errorf("failed to decode replace event: %w", err)
+			}
+			eventStream.EmitReplace(replace.MainText)
+		case streaming.EventTypeComplete:
+			response = &synth.SynthesisResponse{}
+			if err := json.Unmarshal([]byte(data), response); err != nil {
+				return fmt.Errorf("failed to decode complete event: %w", err)
+			}
+			return io.EOF
+		case streaming.EventTypeError:
+			return fmt.Errorf("synthesize stream error: %s", data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, relayed, err
+	}
+	if response == nil {
+		return nil, relayed, fmt.Errorf("synthesize stream ended without a complete event")
+	}
+	return response, relayed, nil
+}
+
+// readServerSentEvents calls handle with the name and data of each event read from r
+// until r ends or handle returns an error. io.EOF from handle stops reading without error.
+func readServerSentEvents(r io.Reader, handle func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxServerSentEventSize)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := handle(event, strings.Join(data, "\n")); err != nil {
+					if errors.Is(err, io.EOF) {
+						return nil
+					}
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return scanner.Err()
 }
 
 // fallbackSynthesizeResponse provides a fallback response when synthesize service fails
@@ -841,10 +979,13 @@ func (o *Orchestrator) renderDiagramWithFallbackStreaming(
 				"fallback_used": true,
 			})
 		}
-	} else if eventStream != nil {
-		eventStream.EmitProgress(streaming.StageDiagramRendering, "✓ Diagram rendered successfully", 95, map[string]interface{}{
-			"diagram_url": diagramURL,
-		})
+	} else {
+		response.DiagramDownloads = o.diagramRenderer.ExportDiagramFormats(ctx, response.DiagramCode)
+		if eventStream != nil {
+			eventStream.EmitProgress(streaming.StageDiagramRendering, "✓ Diagram rendered successfully", 95, map[string]interface{}{
+				"diagram_url": diagramURL,
+			})
+		}
 	}
 
 	response.DiagramURL = diagramURL
@@ -861,6 +1002,14 @@ func (o *Orchestrator) needsFreshness(query string) bool {
 			return true
 		}
 	}
+
+	// Dates are judged against the clock instead of being listed as keywords
+	now := time.Now()
+	for _, reference := range websearch.FindDateReferences(query, now) {
+		if reference.Relative || reference.Window.IsRecent(now) {
+			return true
+		}
+	}
 	return false
 }
 
@@ -920,12 +1069,17 @@ func (o *Orchestrator) createSynthesizeRequest(
 		}
 	}
 
-	return SynthesizeRequest{
+	request := SynthesizeRequest{
 		Query:               query,
 		Chunks:              chunks,
 		WebResults:          webResultItems,
 		ConversationHistory: conversationHistory,
 	}
+	// Comparisons retrieve per platform in the synthesize service and answer with a table
+	if synth.DetectQueryType(query) == synth.ComparisonQuery {
+		request.Mode = SynthesizeModeCompare
+	}
+	return request
 }
 
 // RetrieveResponse represents the response from the retrieve service
@@ -935,15 +1089,18 @@ type RetrieveResponse struct {
 	Query             string          `json:"query"`
 	FallbackTriggered bool            `json:"fallback_triggered"`
 	FallbackReason    string          `json:"fallback_reason,omitempty"`
+	// ReleaseNotesUsed is set when fresh release notes already answer a freshness query
+	ReleaseNotesUsed bool `json:"release_notes_used,omitempty"`
 }
 
 // RetrieveChunk represents a chunk from the retrieve service
 type RetrieveChunk struct {
-	Text     string                 `json:"text"`
-	Score    float64                `json:"score"`
-	DocID    string                 `json:"doc_id"`
-	SourceID string                 `json:"source_id"`
-	Metadata map[string]interface{} `json:"metadata"`
+	Text          string                 `json:"text"`
+	Score         float64                `json:"score"`
+	DocID         string                 `json:"doc_id"`
+	SourceID      string                 `json:"source_id"`
+	KnowledgeBase string                 `json:"knowledge_base,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata"`
 }
 
 // SynthesizeChunkItem represents a chunk item for synthesis request
@@ -960,12 +1117,65 @@ type SynthesizeWebResult struct {
 	URL     string `json:"url"`
 }
 
+// webSearchServiceResponse is the web search service response. Results are either
+// preformatted strings or result objects; passages are excerpts of fetched result pages.
+type webSearchServiceResponse struct {
+	Results  []json.RawMessage `json:"results"`
+	Passages []struct {
+		URL  string `json:"url"`
+		Text string `json:"text"`
+	} `json:"passages"`
+}
+
+// formattedResults renders each result in the "Title:/Snippet:/URL:" form parsed by
+// createSynthesizeRequest. Passages fetched from a result page replace its snippet.
+func (r webSearchServiceResponse) formattedResults() []string {
+	passagesByURL := make(map[string][]string)
+	for _, passage := range r.Passages {
+		passagesByURL[passage.URL] = append(passagesByURL[passage.URL], passage.Text)
+	}
+
+	formatted := make([]string, 0, len(r.Results))
+	for _, raw := range r.Results {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			formatted = append(formatted, text)
+			continue
+		}
+
+		var item struct {
+			Title     string `json:"title"`
+			Snippet   string `json:"snippet"`
+			URL       string `json:"url"`
+			Timestamp string `json:"timestamp"`
+		}
+		if err := json.Unmarshal(raw, &item); err != nil || item.URL == "" {
+			continue
+		}
+		snippet := item.Snippet
+		if passages := passagesByURL[item.URL]; len(passages) > 0 {
+			snippet = strings.Join(passages, " ... ")
+		}
+		entry := fmt.Sprintf("Title: %s\nSnippet: %s\nURL: %s", item.Title, strings.ReplaceAll(snippet, "\n", " "), item.URL)
+		if item.Timestamp != "" {
+			entry += "\nPublished: " + item.Timestamp
+		}
+		formatted = append(formatted, entry)
+	}
+	return formatted
+}
+
+// SynthesizeModeCompare asks the synthesize service for a side-by-side platform comparison
+const SynthesizeModeCompare = "compare"
+
 // SynthesizeRequest represents a request to the synthesis service
 type SynthesizeRequest struct {
 	Query               string                `json:"query"`
 	Chunks              []SynthesizeChunkItem `json:"chunks"`
 	WebResults          []SynthesizeWebResult `json:"web_results"`
 	ConversationHistory []session.Message     `json:"conversation_history,omitempty"`
+	// Mode is "compare" for queries weighing cloud platforms against each other, empty otherwise
+	Mode string `json:"mode,omitempty"`
 }
 
 // handleSessionManagement manages session creation and conversation history retrieval
@@ -1062,6 +1272,8 @@ func (o *Orchestrator) storeResponseInSession(
 		"source_count":  len(response.Sources),
 		"timestamp":     ctx.Value("timestamp"),
 		"response_type": "synthesis",
+		// The full response lets the conversation be exported with its diagram and sources
+		export.MessageMetadataResponse: response,
 	}
 
 	// Store the assistant response
@@ -1097,7 +1309,7 @@ func (o *Orchestrator) ProcessRegenerationQuery(ctx context.Context, query, pres
 
 	// Step 2: Web search (if applicable)
 	webResults := []string{}
-	needsWeb := o.needsFreshness(query)
+	needsWeb := o.needsFreshness(query) && !retrieveResp.ReleaseNotesUsed
 	if needsWeb {
 		o.logger.Debug("Performing web search for regeneration", zap.Bool("freshness_detected", true))
 		webResults = o.callWebSearchServiceWithFallback(ctx, query, result)
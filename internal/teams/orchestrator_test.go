@@ -17,15 +17,21 @@ package teams
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/your-org/ai-sa-assistant/internal/acl"
 	"github.com/your-org/ai-sa-assistant/internal/config"
 	"github.com/your-org/ai-sa-assistant/internal/diagram"
 	"github.com/your-org/ai-sa-assistant/internal/health"
 	"github.com/your-org/ai-sa-assistant/internal/session"
+	"github.com/your-org/ai-sa-assistant/internal/streaming"
 	"github.com/your-org/ai-sa-assistant/internal/synth"
 	"go.uber.org/zap/zaptest"
 )
@@ -283,6 +289,96 @@ func TestOrchestrator_ProcessQuery_WithFreshness(t *testing.T) {
 	}
 }
 
+func TestOrchestrator_ProcessQuery_ReleaseNotesSkipWebSearch(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+
+	retrieveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == HealthEndpoint {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		response := RetrieveResponse{
+			Chunks: []RetrieveChunk{
+				{
+					Text:          "Amazon EKS now supports Kubernetes version 1.31",
+					Score:         0.9,
+					DocID:         "aws-release-0a1b_chunk_0",
+					SourceID:      "https://aws.amazon.com/about-aws/whats-new/",
+					KnowledgeBase: "freshness",
+				},
+			},
+			Count:            1,
+			Query:            "latest EKS release",
+			ReleaseNotesUsed: true,
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer retrieveServer.Close()
+
+	websearchCalls := 0
+	websearchServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == HealthEndpoint {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		websearchCalls++
+		_ = json.NewEncoder(w).Encode(map[string][]string{"results": {}})
+	}))
+	defer websearchServer.Close()
+
+	synthesizeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == HealthEndpoint {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(synth.SynthesisResponse{MainText: "EKS supports Kubernetes 1.31"})
+	}))
+	defer synthesizeServer.Close()
+
+	cfg := &config.Config{
+		Services: config.ServicesConfig{
+			RetrieveURL:   retrieveServer.URL,
+			WebSearchURL:  websearchServer.URL,
+			SynthesizeURL: synthesizeServer.URL,
+		},
+		WebSearch: config.WebSearchConfig{
+			FreshnessKeywords: []string{"latest", "recent"},
+		},
+	}
+
+	healthManager := health.NewManager("test", "1.0.0", logger)
+	diagramRenderer := diagram.NewRenderer(diagram.RendererConfig{
+		MermaidInkURL:  "https://mermaid.ink/img",
+		Timeout:        30,
+		MaxDiagramSize: 10240,
+	}, logger)
+	sessionManager, err := session.NewManager(session.Config{
+		StorageType: session.MemoryStorageType,
+		DefaultTTL:  30 * time.Minute,
+		MaxSessions: 1000,
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create session manager: %v", err)
+	}
+	defer func() { _ = sessionManager.Close() }()
+
+	orchestrator := NewOrchestrator(cfg, healthManager, diagramRenderer, sessionManager, logger)
+	result := orchestrator.ProcessQuery(context.Background(), "latest EKS release", "test_user")
+
+	if result.Error != nil {
+		t.Errorf("Expected no error, got %v", result.Error)
+	}
+	if websearchCalls != 0 {
+		t.Errorf("Expected web search to be skipped when release notes answer the query, got %d calls", websearchCalls)
+	}
+	for _, service := range result.ServicesUsed {
+		if service == "websearch" {
+			t.Error("Expected websearch service not to be used")
+		}
+	}
+}
+
 func TestOrchestrator_ProcessQuery_RetrieveServiceFailure(t *testing.T) {
 	logger := zaptest.NewLogger(t)
 
@@ -739,6 +835,9 @@ func TestOrchestrator_needsFreshness(t *testing.T) {
 		{"general cloud architecture", false},
 		{"basic networking concepts", false},
 		{"LATEST trends in cloud", true}, // Case insensitive
+		{"EKS changes since re:Invent", true},
+		{"AKS roadmap for H2 " + strconv.Itoa(time.Now().Year()), true},
+		{"GKE pricing model in 2015", false},
 	}
 
 	for _, tt := range tests {
@@ -748,3 +847,269 @@ func TestOrchestrator_needsFreshness(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyCallerIdentity(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/search", nil)
+	applyCallerIdentity(context.Background(), req)
+	if req.Header.Get(acl.HeaderUserID) != "" {
+		t.Errorf("Expected no identity headers without a caller identity")
+	}
+
+	ctx := acl.WithIdentity(context.Background(), acl.Identity{
+		UserID:    "alice@example.com",
+		Groups:    []string{"sa-team", "acme-account-team"},
+		Clearance: acl.ClassificationConfidential,
+	})
+	applyCallerIdentity(ctx, req)
+
+	if got := req.Header.Get(acl.HeaderUserID); got != "alice@example.com" {
+		t.Errorf("Expected user header alice@example.com, got %q", got)
+	}
+	if got := req.Header.Get(acl.HeaderUserGroups); got != "sa-team,acme-account-team" {
+		t.Errorf("Expected groups header, got %q", got)
+	}
+	if got := req.Header.Get(acl.HeaderUserClearance); got != "confidential" {
+		t.Errorf("Expected clearance header confidential, got %q", got)
+	}
+}
+
+func TestWebSearchResponseFormattedResults(t *testing.T) {
+	body := `{
+		"results": [
+			{"title": "EKS news", "snippet": "EKS supports 1.31", "url": "https://example.com/eks", "timestamp": "2024-09-26"},
+			{"title": "AKS notes", "snippet": "AKS release notes", "url": "https://example.com/aks", "timestamp": ""},
+			"Title: Legacy\nSnippet: Preformatted\nURL: https://example.com/legacy"
+		],
+		"passages": [
+			{"url": "https://example.com/eks", "text": "Amazon EKS now supports Kubernetes 1.31."},
+			{"url": "https://example.com/eks", "text": "Extended support is billed per cluster hour."}
+		]
+	}`
+
+	var response webSearchServiceResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("Failed to decode web search response: %v", err)
+	}
+
+	results := response.formattedResults()
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 formatted results, got %d", len(results))
+	}
+
+	expected := "Title: EKS news\nSnippet: Amazon EKS now supports Kubernetes 1.31. ... " +
+		"Extended support is billed per cluster hour.\nURL: https://example.com/eks\nPublished: 2024-09-26"
+	if results[0] != expected {
+		t.Errorf("Expected passages to replace the snippet, got %q", results[0])
+	}
+	if results[1] != "Title: AKS notes\nSnippet: AKS release notes\nURL: https://example.com/aks" {
+		t.Errorf("Unexpected formatting for result without passages: %q", results[1])
+	}
+	if results[2] != "Title: Legacy\nSnippet: Preformatted\nURL: https://example.com/legacy" {
+		t.Errorf("Expected preformatted result to pass through, got %q", results[2])
+	}
+
+	o := &Orchestrator{}
+	request := o.createSynthesizeRequest("latest EKS", nil, results, nil)
+	if request.WebResults[0].URL != "https://example.com/eks" || request.WebResults[0].Title != "EKS news" {
+		t.Errorf("Expected formatted result to parse back into a web result, got %+v", request.WebResults[0])
+	}
+}
+
+// newStreamingTestOrchestrator creates an orchestrator whose synthesize service is served
+// by synthesizeHandler and whose retrieve service returns a single chunk
+func newStreamingTestOrchestrator(t *testing.T, synthesizeHandler http.HandlerFunc) *Orchestrator {
+	t.Helper()
+	logger := zaptest.NewLogger(t)
+
+	healthy := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == HealthEndpoint {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			next(w, r)
+		}
+	}
+
+	retrieveServer := httptest.NewServer(healthy(func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(RetrieveResponse{
+			Chunks: []RetrieveChunk{{Text: "EKS guidance", Score: 0.9, DocID: "doc1", SourceID: "source1"}},
+			Count:  1,
+		})
+	}))
+	t.Cleanup(retrieveServer.Close)
+	synthesizeServer := httptest.NewServer(healthy(synthesizeHandler))
+	t.Cleanup(synthesizeServer.Close)
+
+	sessionManager, err := session.NewManager(session.Config{
+		StorageType: session.MemoryStorageType,
+		DefaultTTL:  30 * time.Minute,
+		MaxSessions: 10,
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create session manager: %v", err)
+	}
+	t.Cleanup(func() { _ = sessionManager.Close() })
+
+	cfg := &config.Config{
+		Services: config.ServicesConfig{
+			RetrieveURL:   retrieveServer.URL,
+			SynthesizeURL: synthesizeServer.URL,
+		},
+	}
+	renderer := diagram.NewRenderer(diagram.RendererConfig{MermaidInkURL: "https://mermaid.ink/img", Timeout: 30}, logger)
+	return NewOrchestrator(cfg, health.NewManager("test", "1.0.0", logger), renderer, sessionManager, logger)
+}
+
+func TestOrchestrator_ProcessQueryWithStreaming_RelaysTokens(t *testing.T) {
+	orchestrator := newStreamingTestOrchestrator(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/synthesize/stream" {
+			t.Errorf("Expected the streaming endpoint, got %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"Use ", "Amazon ", "EKS."} {
+			encoded, _ := json.Marshal(map[string]string{"delta": delta})
+			_, _ = fmt.Fprintf(w, "event:token\ndata:%s\n\n", encoded)
+		}
+		_, _ = fmt.Fprint(w, "event:replace\ndata:{\"main_text\":\"Use Amazon EKS [source1].\"}\n\n")
+		encoded, _ := json.Marshal(synth.SynthesisResponse{MainText: "Use Amazon EKS.", Sources: []string{"source1"}})
+		_, _ = fmt.Fprintf(w, "event:complete\ndata:%s\n\n", encoded)
+	})
+
+	eventStream := streaming.NewEventStream("test")
+	result := orchestrator.ProcessQueryWithStreaming(context.Background(), "How do I run containers?", "user", eventStream)
+	if result.Error != nil {
+		t.Fatalf("Expected no error, got %v", result.Error)
+	}
+	if result.FallbackUsed {
+		t.Error("Expected the streamed response to be used")
+	}
+	if result.Response == nil || result.Response.MainText != "Use Amazon EKS." {
+		t.Fatalf("Expected the response from the complete event, got %+v", result.Response)
+	}
+
+	var relayed strings.Builder
+	var replaced string
+	for _, event := range eventStream.GetEvents() {
+		switch event.Type {
+		case streaming.EventTypeToken:
+			relayed.WriteString(event.Data["delta"].(string))
+		case streaming.EventTypeReplace:
+			replaced = event.Data["text"].(string)
+		}
+	}
+	if relayed.String() != "Use Amazon EKS." {
+		t.Errorf("Expected the tokens to be relayed, got %q", relayed.String())
+	}
+	if replaced != "Use Amazon EKS [source1]." {
+		t.Errorf("Expected the final answer text to be relayed, got %q", replaced)
+	}
+}
+
+func TestOrchestrator_ProcessQueryWithStreaming_FallsBackToNonStreaming(t *testing.T) {
+	orchestrator := newStreamingTestOrchestrator(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/synthesize/stream" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(synth.SynthesisResponse{MainText: "Non-streamed answer"})
+	})
+
+	result := orchestrator.ProcessQueryWithStreaming(context.Background(), "How do I run containers?", "user",
+		streaming.NewEventStream("test"))
+	if result.Error != nil {
+		t.Fatalf("Expected no error, got %v", result.Error)
+	}
+	if result.FallbackUsed || result.Response == nil || result.Response.MainText != "Non-streamed answer" {
+		t.Errorf("Expected the non-streaming response, got %+v (fallback %v)", result.Response, result.FallbackUsed)
+	}
+}
+
+func TestOrchestrator_ProcessQueryWithStreaming_ReportsRoutedModel(t *testing.T) {
+	orchestrator := newStreamingTestOrchestrator(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/synthesize/stream" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(synth.SynthesisResponse{
+			MainText:        "Routed answer",
+			ProcessingStats: synth.ProcessingStats{ModelUsed: "claude-3-5-sonnet"},
+		})
+	})
+
+	eventStream := streaming.NewEventStream("test")
+	result := orchestrator.ProcessQueryWithStreaming(context.Background(), "How do I run containers?", "user", eventStream)
+	if result.Error != nil {
+		t.Fatalf("Expected no error, got %v", result.Error)
+	}
+
+	var models []interface{}
+	for _, event := range eventStream.GetEvents() {
+		if strings.Contains(strings.ToLower(event.Message), "gpt-4o") {
+			t.Errorf("Expected no hard-coded model in progress message %q", event.Message)
+		}
+		if model, ok := event.Data["model"]; ok {
+			models = append(models, model)
+		}
+	}
+	if len(models) != 1 || models[0] != "claude-3-5-sonnet" {
+		t.Errorf("Expected only the routed model to be reported, got %v", models)
+	}
+}
+
+func TestOrchestrator_ProcessQueryWithStreaming_ComparisonMode(t *testing.T) {
+	var mode string
+	orchestrator := newStreamingTestOrchestrator(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/synthesize" {
+			t.Errorf("Expected comparisons to use the non-streaming endpoint, got %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var request SynthesizeRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		mode = request.Mode
+		_ = json.NewEncoder(w).Encode(synth.SynthesisResponse{
+			MainText:   "| Dimension | AWS | Azure |",
+			Comparison: &synth.Comparison{Title: "AWS vs Azure"},
+		})
+	})
+
+	result := orchestrator.ProcessQueryWithStreaming(context.Background(), "Should we run containers on AWS or Azure?", "user",
+		streaming.NewEventStream("test"))
+	if result.Error != nil {
+		t.Fatalf("Expected no error, got %v", result.Error)
+	}
+	if mode != SynthesizeModeCompare {
+		t.Errorf("Expected mode %q, got %q", SynthesizeModeCompare, mode)
+	}
+	if result.Response == nil || result.Response.Comparison == nil || result.Response.Comparison.Title != "AWS vs Azure" {
+		t.Errorf("Expected the comparison to be decoded, got %+v", result.Response)
+	}
+}
+
+func TestReadServerSentEvents(t *testing.T) {
+	input := "event:token\ndata:{\"delta\":\"a\"}\n\n" +
+		": comment\n\n" +
+		"event: error\ndata: line one\ndata: line two\n\n" +
+		"event:complete\ndata:{}\n\n" +
+		"event:token\ndata:{\"delta\":\"ignored\"}\n\n"
+
+	var events []string
+	err := readServerSentEvents(strings.NewReader(input), func(event, data string) error {
+		events = append(events, event+"="+data)
+		if event == "complete" {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{`token={"delta":"a"}`, "error=line one\nline two", "complete={}"}
+	if strings.Join(events, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected events %q, got %q", expected, events)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultBingEndpoint = "https://api.bing.microsoft.com"
+	bingSearchPath      = "/v7.0/search"
+	bingMaxResults      = 50
+)
+
+// bingProvider searches with the Bing Web Search API
+type bingProvider struct {
+	apiKey     string
+	endpoint   string
+	market     string
+	httpClient *http.Client
+}
+
+// bingResponse is the subset of the Bing Web Search response used here
+type bingResponse struct {
+	WebPages struct {
+		Value []struct {
+			Name          string `json:"name"`
+			URL           string `json:"url"`
+			Snippet       string `json:"snippet"`
+			DatePublished string `json:"datePublished"`
+		} `json:"value"`
+	} `json:"webPages"`
+}
+
+func newBingProvider(cfg ProviderConfig, httpClient *http.Client) (*bingProvider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("bing provider requires an API key")
+	}
+	return &bingProvider{
+		apiKey:     cfg.APIKey,
+		endpoint:   endpointOrDefault(cfg.Endpoint, defaultBingEndpoint),
+		market:     cfg.Market,
+		httpClient: httpClient,
+	}, nil
+}
+
+// Name returns the provider name
+func (p *bingProvider) Name() string {
+	return ProviderBing
+}
+
+// Search queries the Bing Web Search API
+func (p *bingProvider) Search(ctx context.Context, query string, opts SearchOptions) ([]Result, error) {
+	maxResults := resolveMaxResults(opts.MaxResults, bingMaxResults)
+
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("count", strconv.Itoa(maxResults))
+	params.Set("responseFilter", "Webpages")
+	if p.market != "" {
+		params.Set("mkt", p.market)
+	}
+	if first, last, ok := windowDays(opts.Window); ok {
+		params.Set("freshness", first+".."+last)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+bingSearchPath+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bing request: %w", err)
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", p.apiKey)
+
+	var response bingResponse
+	if err := doJSONRequest(p.httpClient, req, p.Name(), &response); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, page := range response.WebPages.Value {
+		// dateLastCrawled is when Bing last fetched the page, not when it was published,
+		// so pages without datePublished are left undated rather than looking fresh
+		results = appendResult(results, Result{
+			Title:     page.Name,
+			URL:       page.URL,
+			Snippet:   page.Snippet,
+			Published: page.DatePublished,
+		}, maxResults)
+	}
+	return results, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultBraveEndpoint = "https://api.search.brave.com"
+	braveSearchPath      = "/res/v1/web/search"
+	braveMaxResults      = 20
+)
+
+// braveProvider searches with the Brave Search API
+type braveProvider struct {
+	apiKey     string
+	endpoint   string
+	httpClient *http.Client
+}
+
+// braveResponse is the subset of the Brave Search response used here
+type braveResponse struct {
+	Web struct {
+		Results []struct {
+			Title       string `json:"title"`
+			URL         string `json:"url"`
+			Description string `json:"description"`
+			PageAge     string `json:"page_age"`
+		} `json:"results"`
+	} `json:"web"`
+}
+
+func newBraveProvider(cfg ProviderConfig, httpClient *http.Client) (*braveProvider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("brave provider requires an API key")
+	}
+	return &braveProvider{
+		apiKey:     cfg.APIKey,
+		endpoint:   endpointOrDefault(cfg.Endpoint, defaultBraveEndpoint),
+		httpClient: httpClient,
+	}, nil
+}
+
+// Name returns the provider name
+func (p *braveProvider) Name() string {
+	return ProviderBrave
+}
+
+// Search queries the Brave Search API
+func (p *braveProvider) Search(ctx context.Context, query string, opts SearchOptions) ([]Result, error) {
+	maxResults := resolveMaxResults(opts.MaxResults, braveMaxResults)
+
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("count", strconv.Itoa(maxResults))
+	if first, last, ok := windowDays(opts.Window); ok {
+		params.Set("freshness", first+"to"+last)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+braveSearchPath+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create brave request: %w", err)
+	}
+	req.Header.Set("X-Subscription-Token", p.apiKey)
+
+	var response braveResponse
+	if err := doJSONRequest(p.httpClient, req, p.Name(), &response); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, item := range response.Web.Results {
+		results = appendResult(results, Result{
+			Title:     item.Title,
+			URL:       item.URL,
+			Snippet:   item.Description,
+			Published: item.PageAge,
+		}, maxResults)
+	}
+	return results, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/your-org/ai-sa-assistant/internal/lru"
+)
+
+const (
+	// DefaultCacheTTL is how long a search response is served from the cache
+	DefaultCacheTTL = 30 * time.Minute
+	// DefaultReleaseCacheTTL is the shorter lifetime for release and announcement queries
+	DefaultReleaseCacheTTL = 5 * time.Minute
+	// DefaultCacheStaleFor is how long past expiry a response may be served when the provider fails
+	DefaultCacheStaleFor = 24 * time.Hour
+	// DefaultCacheMaxEntries bounds the number of cached responses
+	DefaultCacheMaxEntries = 1000
+)
+
+// cacheStopWords are dropped from cache keys so that rephrasings share an entry
+var cacheStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "is": true, "are": true, "was": true, "were": true,
+	"what": true, "what's": true, "whats": true, "which": true, "how": true, "do": true,
+	"does": true, "of": true, "for": true, "in": true, "on": true, "at": true, "about": true,
+	"please": true, "tell": true, "me": true, "show": true, "any": true, "there": true,
+	"can": true, "you": true, "i": true, "and": true, "with": true,
+}
+
+// releaseQueryKeywords mark queries about releases and announcements, whose answers
+// change quickly
+var releaseQueryKeywords = []string{
+	"release", "released", "releases", "release notes", "announce", "announced",
+	"announcement", "announcements", "launch", "launched", "launches", "ga",
+	"general availability", "preview", "what's new", "whats new", "changelog",
+	"latest version", "new features",
+}
+
+// CacheEntry is a cached search response
+type CacheEntry struct {
+	// Value is the encoded response
+	Value    []byte
+	StoredAt time.Time
+	// ExpiresAt is when the entry stops being served without asking the provider
+	ExpiresAt time.Time
+	// StaleUntil is when the entry stops being served as a fallback for provider failures
+	StaleUntil time.Time
+}
+
+// Fresh reports whether the entry can be served without asking the provider
+func (e CacheEntry) Fresh(now time.Time) bool {
+	return now.Before(e.ExpiresAt)
+}
+
+// Usable reports whether the entry may still be served when the provider fails
+func (e CacheEntry) Usable(now time.Time) bool {
+	return now.Before(e.StaleUntil)
+}
+
+// ResultCache stores encoded search responses. Get returns entries until their
+// StaleUntil time, so callers must check Fresh before serving one in place of a search.
+type ResultCache interface {
+	Get(key string) (CacheEntry, bool, error)
+	Set(key string, entry CacheEntry) error
+	// Len returns the number of stored entries
+	Len() int
+	Close() error
+}
+
+// CachePolicy sets cache lifetimes by query type
+type CachePolicy struct {
+	TTL        time.Duration
+	ReleaseTTL time.Duration
+	StaleFor   time.Duration
+}
+
+// DefaultCachePolicy returns the default cache lifetimes
+func DefaultCachePolicy() CachePolicy {
+	return CachePolicy{TTL: DefaultCacheTTL, ReleaseTTL: DefaultReleaseCacheTTL, StaleFor: DefaultCacheStaleFor}
+}
+
+// TTLFor returns the cache lifetime for a query. Release and announcement queries
+// expire sooner because their results change quickly.
+func (p CachePolicy) TTLFor(query string) time.Duration {
+	ttl := p.TTL
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	if IsReleaseQuery(query) {
+		releaseTTL := p.ReleaseTTL
+		if releaseTTL <= 0 {
+			releaseTTL = DefaultReleaseCacheTTL
+		}
+		if releaseTTL < ttl {
+			return releaseTTL
+		}
+	}
+	return ttl
+}
+
+// NewEntry creates a cache entry for a query's encoded response stored at now
+func (p CachePolicy) NewEntry(query string, value []byte, now time.Time) CacheEntry {
+	expiresAt := now.Add(p.TTLFor(query))
+	return CacheEntry{
+		Value:      value,
+		StoredAt:   now,
+		ExpiresAt:  expiresAt,
+		StaleUntil: expiresAt.Add(p.StaleFor),
+	}
+}
+
+// IsReleaseQuery reports whether the query asks about releases or announcements
+func IsReleaseQuery(query string) bool {
+	return len(checkKeywords(strings.ToLower(query), releaseQueryKeywords)) > 0
+}
+
+// NormalizeCacheKey reduces a query to a cache key that ignores letter case,
+// whitespace, punctuation and stop words
+func NormalizeCacheKey(query string) string {
+	fields := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '\'')
+	})
+
+	words := make([]string, 0, len(fields))
+	all := make([]string, 0, len(fields))
+	for _, field := range fields {
+		field = strings.Trim(field, ".-'")
+		if field == "" {
+			continue
+		}
+		all = append(all, field)
+		if !cacheStopWords[field] {
+			words = append(words, field)
+		}
+	}
+
+	// A query made only of stop words keys on all of its words
+	if len(words) == 0 {
+		words = all
+	}
+	return strings.Join(words, " ")
+}
+
+// MemoryCache is an in-memory ResultCache that evicts the least recently used entry
+// once it is full
+type MemoryCache struct {
+	entries *lru.Cache[CacheEntry]
+}
+
+// NewMemoryCache creates an in-memory cache bounded to maxEntries
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	return &MemoryCache{entries: lru.New[CacheEntry](maxEntries, 0)}
+}
+
+// Get returns the entry for key unless it is past its stale window
+func (c *MemoryCache) Get(key string) (CacheEntry, bool, error) {
+	entry, ok := c.entries.Get(key)
+	return entry, ok, nil
+}
+
+// Set stores the entry until its stale window ends, evicting the least recently used
+// entries beyond the bound
+func (c *MemoryCache) Set(key string, entry CacheEntry) error {
+	c.entries.SetWithExpiry(key, entry, entry.StaleUntil)
+	return nil
+}
+
+// Len returns the number of stored entries
+func (c *MemoryCache) Len() int {
+	return c.entries.Len()
+}
+
+// Close releases nothing for the in-memory cache
+func (c *MemoryCache) Close() error {
+	return nil
+}
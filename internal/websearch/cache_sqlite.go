@@ -0,0 +1,155 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver for database/sql
+)
+
+// cacheDirectoryPermissions is used when creating the cache database directory
+const cacheDirectoryPermissions = 0o750
+
+const createCacheTableSQL = `
+CREATE TABLE IF NOT EXISTS websearch_cache (
+	cache_key TEXT PRIMARY KEY,
+	value BLOB NOT NULL,
+	stored_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL,
+	stale_until INTEGER NOT NULL,
+	accessed_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_websearch_cache_accessed_at ON websearch_cache(accessed_at);
+`
+
+// SQLiteCache is a ResultCache persisted in SQLite so cached responses survive restarts.
+// It evicts the least recently used entries once it is full.
+type SQLiteCache struct {
+	db         *sql.DB
+	maxEntries int
+	now        func() time.Time
+}
+
+// NewSQLiteCache opens or creates the cache database at path, bounded to maxEntries
+func NewSQLiteCache(path string, maxEntries int) (*SQLiteCache, error) {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	if err := os.MkdirAll(filepath.Dir(path), cacheDirectoryPermissions); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache database: %w", err)
+	}
+	// SQLite allows a single writer, so serialize access through one connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(createCacheTableSQL); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create cache table: %w", err)
+	}
+
+	return &SQLiteCache{db: db, maxEntries: maxEntries, now: time.Now}, nil
+}
+
+// Get returns the entry for key unless it is past its stale window
+func (c *SQLiteCache) Get(key string) (CacheEntry, bool, error) {
+	var (
+		entry                           CacheEntry
+		storedAt, expiresAt, staleUntil int64
+	)
+	err := c.db.QueryRow(
+		`SELECT value, stored_at, expires_at, stale_until FROM websearch_cache WHERE cache_key = ?`, key,
+	).Scan(&entry.Value, &storedAt, &expiresAt, &staleUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return CacheEntry{}, false, nil
+	}
+	if err != nil {
+		return CacheEntry{}, false, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	entry.StoredAt = time.Unix(0, storedAt)
+	entry.ExpiresAt = time.Unix(0, expiresAt)
+	entry.StaleUntil = time.Unix(0, staleUntil)
+
+	now := c.now()
+	if !entry.Usable(now) {
+		if _, err := c.db.Exec(`DELETE FROM websearch_cache WHERE cache_key = ?`, key); err != nil {
+			return CacheEntry{}, false, fmt.Errorf("failed to delete expired cache entry: %w", err)
+		}
+		return CacheEntry{}, false, nil
+	}
+
+	if _, err := c.db.Exec(`UPDATE websearch_cache SET accessed_at = ? WHERE cache_key = ?`, now.UnixNano(), key); err != nil {
+		return CacheEntry{}, false, fmt.Errorf("failed to update cache entry: %w", err)
+	}
+	return entry, true, nil
+}
+
+// Set stores the entry, evicting the least recently used entries beyond the bound
+func (c *SQLiteCache) Set(key string, entry CacheEntry) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin cache transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(
+		`INSERT OR REPLACE INTO websearch_cache
+			(cache_key, value, stored_at, expires_at, stale_until, accessed_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		key, entry.Value, entry.StoredAt.UnixNano(), entry.ExpiresAt.UnixNano(),
+		entry.StaleUntil.UnixNano(), c.now().UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	_, err = tx.Exec(
+		`DELETE FROM websearch_cache WHERE cache_key IN (
+			SELECT cache_key FROM websearch_cache ORDER BY accessed_at DESC LIMIT -1 OFFSET ?
+		)`, c.maxEntries,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to evict cache entries: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit cache entry: %w", err)
+	}
+	return nil
+}
+
+// Len returns the number of stored entries, or 0 when the database cannot be read
+func (c *SQLiteCache) Len() int {
+	var count int
+	if err := c.db.QueryRow(`SELECT COUNT(*) FROM websearch_cache`).Scan(&count); err != nil {
+		return 0
+	}
+	return count
+}
+
+// Close closes the cache database
+func (c *SQLiteCache) Close() error {
+	return c.db.Close()
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeCacheKey(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"What is the latest EKS version?", "latest eks version"},
+		{"  latest   EKS\tversion ", "latest eks version"},
+		{"LATEST eks VERSION!!", "latest eks version"},
+		{"What's new in Azure OpenAI?", "new azure openai"},
+		{"Migrate from EC2 to Azure VMs", "migrate from ec2 to azure vms"},
+		{"Node.js 22 on Lambda", "node.js 22 lambda"},
+		{"What is the", "what is the"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NormalizeCacheKey(tt.query))
+		})
+	}
+}
+
+func TestCachePolicyTTL(t *testing.T) {
+	policy := CachePolicy{TTL: time.Hour, ReleaseTTL: 5 * time.Minute, StaleFor: time.Hour}
+
+	assert.Equal(t, time.Hour, policy.TTLFor("AWS Well-Architected security pillar"))
+	assert.Equal(t, 5*time.Minute, policy.TTLFor("EKS 1.31 release notes"))
+	assert.Equal(t, 5*time.Minute, policy.TTLFor("What did Google announce at Next?"))
+	assert.Equal(t, 5*time.Minute, policy.TTLFor("Is Azure Container Apps GA yet"))
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	entry := policy.NewEntry("Bedrock launch announcement", []byte("{}"), now)
+	assert.Equal(t, now.Add(5*time.Minute), entry.ExpiresAt)
+	assert.Equal(t, now.Add(65*time.Minute), entry.StaleUntil)
+	assert.True(t, entry.Fresh(now.Add(time.Minute)))
+	assert.False(t, entry.Fresh(now.Add(10*time.Minute)))
+	assert.True(t, entry.Usable(now.Add(10*time.Minute)))
+	assert.False(t, entry.Usable(now.Add(2*time.Hour)))
+
+	// Unset lifetimes fall back to the defaults
+	assert.Equal(t, DefaultCacheTTL, CachePolicy{}.TTLFor("database migration"))
+	assert.Equal(t, DefaultReleaseCacheTTL, CachePolicy{}.TTLFor("new release"))
+}
+
+func testEntry(value string, now time.Time) CacheEntry {
+	return CacheEntry{
+		Value:      []byte(value),
+		StoredAt:   now,
+		ExpiresAt:  now.Add(time.Minute),
+		StaleUntil: now.Add(time.Hour),
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewMemoryCache(2)
+	now := time.Now()
+
+	require.NoError(t, cache.Set("a", testEntry("1", now)))
+	require.NoError(t, cache.Set("b", testEntry("2", now)))
+
+	// Reading "a" makes "b" the least recently used entry
+	_, found, err := cache.Get("a")
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	require.NoError(t, cache.Set("c", testEntry("3", now)))
+	assert.Equal(t, 2, cache.Len())
+
+	_, found, _ = cache.Get("b")
+	assert.False(t, found)
+	entry, found, _ := cache.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, "1", string(entry.Value))
+}
+
+func TestMemoryCacheDropsEntriesPastStaleWindow(t *testing.T) {
+	cache := NewMemoryCache(10)
+	now := time.Now()
+	clock := now
+	cache.entries.SetClock(func() time.Time { return clock })
+
+	require.NoError(t, cache.Set("query", testEntry("1", now)))
+
+	// Expired entries stay available for stale fallback
+	clock = now.Add(30 * time.Minute)
+	entry, found, _ := cache.Get("query")
+	assert.True(t, found)
+	assert.False(t, entry.Fresh(clock))
+
+	clock = now.Add(2 * time.Hour)
+	_, found, _ = cache.Get("query")
+	assert.False(t, found)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestSQLiteCachePersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "websearch.db")
+	now := time.Now()
+
+	cache, err := NewSQLiteCache(path, 10)
+	require.NoError(t, err)
+	require.NoError(t, cache.Set("latest eks version", testEntry(`{"source":"brave"}`, now)))
+	require.NoError(t, cache.Close())
+
+	reopened, err := NewSQLiteCache(path, 10)
+	require.NoError(t, err)
+	defer func() { _ = reopened.Close() }()
+
+	entry, found, err := reopened.Get("latest eks version")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, `{"source":"brave"}`, string(entry.Value))
+	assert.Equal(t, now.Add(time.Minute).UnixNano(), entry.ExpiresAt.UnixNano())
+
+	_, found, err = reopened.Get("missing")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestSQLiteCacheEviction(t *testing.T) {
+	cache, err := NewSQLiteCache(filepath.Join(t.TempDir(), "websearch.db"), 2)
+	require.NoError(t, err)
+	defer func() { _ = cache.Close() }()
+
+	now := time.Now()
+	clock := now
+	cache.now = func() time.Time { return clock }
+
+	require.NoError(t, cache.Set("a", testEntry("1", now)))
+	clock = clock.Add(time.Second)
+	require.NoError(t, cache.Set("b", testEntry("2", now)))
+	clock = clock.Add(time.Second)
+	_, found, err := cache.Get("a")
+	require.NoError(t, err)
+	assert.True(t, found)
+	clock = clock.Add(time.Second)
+	require.NoError(t, cache.Set("c", testEntry("3", now)))
+
+	assert.Equal(t, 2, cache.Len())
+	_, found, _ = cache.Get("b")
+	assert.False(t, found)
+
+	// Entries past their stale window are removed on read
+	clock = now.Add(2 * time.Hour)
+	_, found, _ = cache.Get("a")
+	assert.False(t, found)
+	assert.Equal(t, 1, cache.Len())
+}
@@ -20,6 +20,7 @@ package websearch
 import (
 	"regexp"
 	"strings"
+	"time"
 )
 
 // DetectionResult contains details about freshness keyword detection
@@ -29,6 +30,9 @@ type DetectionResult struct {
 	MatchedPatterns  []string `json:"matched_patterns"`
 	ConfidenceScore  float64  `json:"confidence_score"`
 	DetectionReasons []string `json:"detection_reasons"`
+	// TimeWindow is the period covered by the dates the query mentions, nil when it
+	// mentions none or date detection is disabled
+	TimeWindow *TimeWindow `json:"time_window,omitempty"`
 }
 
 // DetectionConfig contains configuration for freshness detection
@@ -37,6 +41,16 @@ type DetectionConfig struct {
 	ReleaseKeywords     []string `json:"release_keywords"`
 	EventKeywords       []string `json:"event_keywords"`
 	EnableDateDetection bool     `json:"enable_date_detection"`
+	// Now returns the time dates are resolved against. Defaults to time.Now.
+	Now func() time.Time `json:"-"`
+}
+
+// now returns the detection clock's current time
+func (c DetectionConfig) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
 }
 
 const (
@@ -49,6 +63,7 @@ const (
 	quarterDateScore      = 0.4
 	monthDateScore        = 0.3
 	recentYearScore       = 0.5
+	relativeDateScore     = 0.4
 )
 
 var (
@@ -72,14 +87,6 @@ var (
 		"conference", "keynote", "announcement", "unveil",
 		"demo", "showcase", "presentation",
 	}
-
-	// Date patterns for matching quarterly and yearly references
-	quarterYearPattern = regexp.MustCompile(`(?i)\bQ[1-4]\s+20\d{2}\b`)
-	monthYearPattern   = regexp.MustCompile(
-		`(?i)\b(january|february|march|april|may|june|july|august|` +
-			`september|october|november|december)\s+20\d{2}\b`)
-	recentYearPattern     = regexp.MustCompile(`\b202[4-9]\b`)           // Recent years that likely need fresh info
-	historicalYearPattern = regexp.MustCompile(`\b20(0\d|1\d|2[0-3])\b`) // Years 2000-2023
 )
 
 // DetectFreshnessNeeds analyzes a query to determine if it requires fresh, current information
@@ -137,8 +144,12 @@ func DetectFreshnessNeeds(query string, config DetectionConfig) DetectionResult
 
 	// Check for date patterns if enabled
 	if config.EnableDateDetection {
-		dateScore := checkDatePatterns(query, &result)
-		result.ConfidenceScore += dateScore
+		now := config.now()
+		references := FindDateReferences(query, now)
+		result.ConfidenceScore += checkDatePatterns(references, now, &result)
+		if window, ok := windowOf(references); ok {
+			result.TimeWindow = &window
+		}
 	}
 
 	// Determine if fresh information is needed
@@ -181,44 +192,53 @@ func checkKeywords(queryLower string, keywords []string) []string {
 	return matches
 }
 
-// checkDatePatterns checks for date patterns that indicate freshness needs
-func checkDatePatterns(query string, result *DetectionResult) float64 {
-	score := 0.0
+// checkDatePatterns scores the date references in a query. Dates in the current or
+// previous calendar year and dates relative to now indicate freshness needs, while
+// older dates reduce confidence.
+func checkDatePatterns(references []DateReference, now time.Time, result *DetectionResult) float64 {
+	var quarter, month, relative, recent, historical bool
+	for _, reference := range references {
+		result.MatchedPatterns = append(result.MatchedPatterns, reference.Text)
+
+		switch reference.kind {
+		case dateKindRelative:
+			relative = true
+			continue
+		case dateKindQuarter:
+			quarter = true
+		case dateKindMonth:
+			month = true
+		}
+		if reference.Window.IsRecent(now) {
+			recent = true
+		} else {
+			historical = true
+		}
+	}
 
-	// Check for quarterly patterns (Q1 2025, Q2 2025, etc.)
-	if quarterYearPattern.MatchString(query) {
-		matches := quarterYearPattern.FindAllString(query, -1)
-		result.MatchedPatterns = append(result.MatchedPatterns, matches...)
+	score := 0.0
+	if quarter {
 		score += quarterDateScore
 		result.DetectionReasons = append(result.DetectionReasons, "Found quarterly date patterns")
 	}
-
-	// Check for month/year patterns (June 2025, etc.)
-	if monthYearPattern.MatchString(query) {
-		matches := monthYearPattern.FindAllString(query, -1)
-		result.MatchedPatterns = append(result.MatchedPatterns, matches...)
+	if month {
 		score += monthDateScore
 		result.DetectionReasons = append(result.DetectionReasons, "Found month/year date patterns")
 	}
-
-	// Check for recent years (2024+) - these indicate freshness needs
-	if recentYearPattern.MatchString(query) {
-		matches := recentYearPattern.FindAllString(query, -1)
-		result.MatchedPatterns = append(result.MatchedPatterns, matches...)
+	if relative {
+		score += relativeDateScore
+		result.DetectionReasons = append(result.DetectionReasons, "Found relative date expressions")
+	}
+	if recent {
 		score += recentYearScore
 		result.DetectionReasons = append(result.DetectionReasons, "Found recent year patterns")
 	}
-
-	// Check for historical years (2000-2023) - these reduce confidence for freshness
-	if historicalYearPattern.MatchString(query) {
-		matches := historicalYearPattern.FindAllString(query, -1)
-		result.MatchedPatterns = append(result.MatchedPatterns, matches...)
+	if historical {
 		// Subtract from score to indicate this is historical, not fresh
 		score -= historicalYearPenalty
 		result.DetectionReasons = append(result.DetectionReasons,
 			"Found historical year patterns (reduces freshness confidence)")
 	}
-
 	return score
 }
 
@@ -234,12 +254,24 @@ func DefaultDetectionConfig() DetectionConfig {
 
 // ConfigFromSlice creates a DetectionConfig from a simple keyword slice (for backward compatibility)
 func ConfigFromSlice(keywords []string) DetectionConfig {
+	return ConfigFromSliceWithClock(keywords, nil)
+}
+
+// ConfigFromSliceWithClock creates a DetectionConfig from a keyword slice whose dates are
+// resolved against now. A nil clock uses time.Now.
+func ConfigFromSliceWithClock(keywords []string, now func() time.Time) DetectionConfig {
+	clock := DetectionConfig{Now: now}
+
 	// Categorize keywords based on common patterns
 	var temporal, release, event []string
 
 	for _, keyword := range keywords {
 		lower := strings.ToLower(keyword)
 		switch {
+		case isDateKeyword(keyword, clock.now()):
+			// Dates such as "Q3 2025" are scored by date detection relative to the clock
+			// rather than matched as keywords that never stop being "recent"
+			continue
 		case contains(defaultTemporalKeywords, lower):
 			temporal = append(temporal, keyword)
 		case contains(defaultReleaseKeywords, lower):
@@ -268,9 +300,18 @@ func ConfigFromSlice(keywords []string) DetectionConfig {
 		ReleaseKeywords:     release,
 		EventKeywords:       event,
 		EnableDateDetection: true,
+		Now:                 now,
 	}
 }
 
+// isDateKeyword reports whether the keyword is entirely an absolute date expression
+// when resolved at now
+func isDateKeyword(keyword string, now time.Time) bool {
+	keyword = strings.TrimSpace(keyword)
+	references := FindDateReferences(keyword, now)
+	return len(references) == 1 && !references[0].Relative && references[0].Text == keyword
+}
+
 // contains checks if a slice contains a specific string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
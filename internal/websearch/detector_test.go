@@ -16,8 +16,16 @@ package websearch
 
 import (
 	"testing"
+	"time"
 )
 
+// detectionNow is the fixed time the detector tests resolve dates against
+var detectionNow = time.Date(2025, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+func fixedClock() time.Time {
+	return detectionNow
+}
+
 func TestDetectFreshnessNeeds(t *testing.T) {
 	tests := []struct {
 		name                  string
@@ -303,7 +311,9 @@ func TestDetectFreshnessNeeds(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := DetectFreshnessNeeds(tt.query, tt.config)
+			config := tt.config
+			config.Now = fixedClock
+			result := DetectFreshnessNeeds(tt.query, config)
 
 			// Check freshness needs
 			if result.NeedsFreshInfo != tt.expectedNeedsFresh {
@@ -351,6 +361,7 @@ func TestDetectionConfigCustomization(t *testing.T) {
 		ReleaseKeywords:     []string{"custom", "release"},
 		EventKeywords:       []string{"custom", "event"},
 		EnableDateDetection: true,
+		Now:                 fixedClock,
 	}
 
 	tests := []struct {
@@ -402,6 +413,64 @@ func TestDetectionConfigCustomization(t *testing.T) {
 	}
 }
 
+func TestDateDetectionRelativeToClock(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		now        time.Time
+		needsFresh bool
+	}{
+		{"current year is recent", "Azure pricing changes in 2025", detectionNow, true},
+		{"previous year is recent", "EKS Q3 2024 changes", detectionNow, true},
+		{"same year is historical later on", "Azure pricing changes in 2025", detectionNow.AddDate(3, 0, 0), false},
+		{"same quarter is historical later on", "EKS Q3 2024 changes", detectionNow.AddDate(2, 0, 0), false},
+		{"relative dates are always recent", "EKS changes last quarter", detectionNow.AddDate(10, 0, 0), true},
+		{"since an old year still asks for fresh info", "What changed in GKE since 2019?", detectionNow, true},
+		{"port numbers are not years", "Open port 2049 for EFS mounts", detectionNow, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultDetectionConfig()
+			now := tt.now
+			config.Now = func() time.Time { return now }
+
+			result := DetectFreshnessNeeds(tt.query, config)
+			if result.NeedsFreshInfo != tt.needsFresh {
+				t.Errorf("DetectFreshnessNeeds(%q) at %s NeedsFreshInfo = %v, want %v (score %f, reasons %v)",
+					tt.query, now.Format("2006-01-02"), result.NeedsFreshInfo, tt.needsFresh,
+					result.ConfidenceScore, result.DetectionReasons)
+			}
+		})
+	}
+}
+
+func TestDetectFreshnessNeedsTimeWindow(t *testing.T) {
+	config := DefaultDetectionConfig()
+	config.Now = fixedClock
+
+	result := DetectFreshnessNeeds("What did AWS launch for EKS since re:Invent?", config)
+	if result.TimeWindow == nil {
+		t.Fatal("Expected a time window for a since re:Invent query")
+	}
+	wantStart := time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC)
+	if !result.TimeWindow.Start.Equal(wantStart) || !result.TimeWindow.End.Equal(detectionNow) {
+		t.Errorf("TimeWindow = %v - %v, want %v - %v",
+			result.TimeWindow.Start, result.TimeWindow.End, wantStart, detectionNow)
+	}
+
+	result = DetectFreshnessNeeds("Latest EKS features", config)
+	if result.TimeWindow != nil {
+		t.Errorf("Expected no time window without dates, got %v", result.TimeWindow)
+	}
+
+	config.EnableDateDetection = false
+	result = DetectFreshnessNeeds("EKS features in H2 2025", config)
+	if result.TimeWindow != nil {
+		t.Errorf("Expected no time window when date detection is disabled, got %v", result.TimeWindow)
+	}
+}
+
 func TestDateDetectionDisabled(t *testing.T) {
 	configWithoutDateDetection := DetectionConfig{
 		TemporalKeywords:    defaultTemporalKeywords,
@@ -446,6 +515,39 @@ func TestConfigFromSlice(t *testing.T) {
 	}
 }
 
+func TestConfigFromSliceSkipsDateKeywords(t *testing.T) {
+	config := ConfigFromSlice([]string{"latest", "Q1 2025", "June 2025", "2024", "this month"})
+
+	for _, keyword := range config.TemporalKeywords {
+		if keyword == "Q1 2025" || keyword == "June 2025" || keyword == "2024" {
+			t.Errorf("Expected date keyword %q to be left to date detection", keyword)
+		}
+	}
+	if !contains(config.TemporalKeywords, "this month") {
+		t.Errorf("Expected relative keyword to be kept, got %v", config.TemporalKeywords)
+	}
+}
+
+func TestConfigFromSliceWithClock(t *testing.T) {
+	clockAt := func(year int) func() time.Time {
+		return func() time.Time { return time.Date(year, time.June, 15, 0, 0, 0, 0, time.UTC) }
+	}
+
+	// A bare year is only a date expression relative to the detector's clock
+	config := ConfigFromSliceWithClock([]string{"latest", "2024"}, clockAt(2025))
+	if contains(config.TemporalKeywords, "2024") {
+		t.Errorf("Expected 2024 to be left to date detection in 2025, got %v", config.TemporalKeywords)
+	}
+	if config.now().Year() != 2025 {
+		t.Errorf("Expected the config to keep the clock, got %v", config.now())
+	}
+
+	config = ConfigFromSliceWithClock([]string{"latest", "2024"}, clockAt(2020))
+	if !contains(config.TemporalKeywords, "2024") {
+		t.Errorf("Expected 2024 to be kept as a keyword in 2020, got %v", config.TemporalKeywords)
+	}
+}
+
 func TestDefaultDetectionConfig(t *testing.T) {
 	config := DefaultDetectionConfig()
 
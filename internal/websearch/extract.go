@@ -0,0 +1,346 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// minParagraphChars is the shortest block of text scored as article content
+	minParagraphChars = 25
+	// maxParagraphBonus caps the length bonus a single paragraph contributes
+	maxParagraphBonus = 3.0
+)
+
+// boilerplatePattern matches class and id values of page furniture rather than content
+var boilerplatePattern = regexp.MustCompile(
+	`(?i)\b(comments?|sidebar|footer|masthead|navbar|nav|menu|cookie|consent|banner|advert|ads?|promo|` +
+		`share|social|related|subscribe|newsletter|breadcrumbs?|popup|modal|skip-link)\b`)
+
+// whitespacePattern collapses runs of whitespace in extracted text
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+// boilerplateTags are elements that never hold article content
+var boilerplateTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Nav: true,
+	atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Form: true,
+	atom.Iframe: true, atom.Svg: true, atom.Button: true, atom.Select: true,
+	atom.Template: true, atom.Object: true, atom.Embed: true, atom.Dialog: true,
+}
+
+// scoredTags are the text blocks whose length and punctuation are scored
+var scoredTags = map[atom.Atom]bool{
+	atom.P: true, atom.Pre: true, atom.Td: true, atom.Blockquote: true, atom.Li: true,
+}
+
+// blockTags start a new paragraph in the extracted text
+var blockTags = map[atom.Atom]bool{
+	atom.P: true, atom.Pre: true, atom.Blockquote: true, atom.Li: true, atom.Td: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Div: true, atom.Section: true, atom.Article: true, atom.Dd: true, atom.Dt: true,
+	atom.Br: true, atom.Tr: true, atom.Figcaption: true,
+}
+
+// publishedMetaKeys are the meta property, name and itemprop values checked, in order,
+// for the page's publication date
+var publishedMetaKeys = []string{
+	"article:published_time", "datepublished", "og:published_time", "pubdate",
+	"publish-date", "date", "dc.date", "dcterms.created", "article:modified_time",
+}
+
+// Article is the main content extracted from an HTML page
+type Article struct {
+	Title     string
+	Text      string
+	Published string
+}
+
+// ExtractArticle extracts the title, publication date and main text of an HTML page.
+// Boilerplate such as navigation, headers, footers and sidebars is removed, and the
+// container with the most paragraph text and the lowest link density is kept.
+func ExtractArticle(r io.Reader) (*Article, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	article := &Article{}
+	meta := make(map[string]string)
+	collectMetadata(doc, article, meta)
+
+	if title := meta["og:title"]; title != "" {
+		article.Title = title
+	}
+	for _, key := range publishedMetaKeys {
+		if value := meta[key]; value != "" {
+			article.Published = value
+			break
+		}
+	}
+
+	removeBoilerplate(doc)
+
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+
+	root := body
+	if candidate := topCandidate(body); candidate != nil {
+		root = candidate
+	}
+	article.Text = blockText(root)
+	return article, nil
+}
+
+// collectMetadata gathers the <title>, meta tags and the first <time datetime> value
+func collectMetadata(n *html.Node, article *Article, meta map[string]string) {
+	if n.Type == html.ElementNode {
+		switch n.DataAtom {
+		case atom.Title:
+			if article.Title == "" {
+				article.Title = collapseWhitespace(textContent(n))
+			}
+		case atom.Meta:
+			key := strings.ToLower(firstAttr(n, "property", "name", "itemprop"))
+			if content := strings.TrimSpace(attr(n, "content")); key != "" && content != "" {
+				if _, seen := meta[key]; !seen {
+					meta[key] = content
+				}
+			}
+		case atom.Time:
+			if value := strings.TrimSpace(attr(n, "datetime")); value != "" {
+				if _, seen := meta["pubdate"]; !seen {
+					meta["pubdate"] = value
+				}
+			}
+		}
+		if itemprop := strings.ToLower(attr(n, "itemprop")); itemprop == "datepublished" && n.DataAtom != atom.Meta {
+			if value := firstAttr(n, "datetime", "content"); value != "" {
+				meta["datepublished"] = value
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		collectMetadata(c, article, meta)
+	}
+}
+
+// removeBoilerplate detaches boilerplate elements and hidden nodes from the tree
+func removeBoilerplate(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && isBoilerplate(c)) {
+			n.RemoveChild(c)
+		} else {
+			removeBoilerplate(c)
+		}
+		c = next
+	}
+}
+
+// isBoilerplate reports whether an element is page furniture rather than content
+func isBoilerplate(n *html.Node) bool {
+	if boilerplateTags[n.DataAtom] {
+		return true
+	}
+	// The main content element is never dropped, whatever its class names say
+	if n.DataAtom == atom.Article || n.DataAtom == atom.Main || n.DataAtom == atom.Body {
+		return false
+	}
+	if _, hidden := findAttr(n, "hidden"); hidden || strings.EqualFold(attr(n, "aria-hidden"), "true") {
+		return true
+	}
+	switch strings.ToLower(attr(n, "role")) {
+	case "navigation", "banner", "contentinfo", "complementary", "dialog":
+		return true
+	}
+	return boilerplatePattern.MatchString(attr(n, "class") + " " + attr(n, "id"))
+}
+
+// topCandidate scores the parents of text blocks and returns the best content container
+func topCandidate(body *html.Node) *html.Node {
+	scores := make(map[*html.Node]float64)
+	var order []*html.Node
+
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, seen := scores[n]; !seen {
+			order = append(order, n)
+		}
+		scores[n] += score
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && scoredTags[n.DataAtom] {
+			text := collapseWhitespace(textContent(n))
+			if len(text) >= minParagraphChars {
+				score := 1 + float64(strings.Count(text, ","))
+				bonus := float64(len(text)) / 100
+				if bonus > maxParagraphBonus {
+					bonus = maxParagraphBonus
+				}
+				score += bonus
+				addScore(n.Parent, score)
+				if n.Parent != nil {
+					addScore(n.Parent.Parent, score/2)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(body)
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range order {
+		score := scores[n] * (1 - linkDensity(n))
+		if n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+			score *= 1.25
+		}
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best
+}
+
+// linkDensity is the fraction of an element's text that sits inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(collapseWhitespace(textContent(n)))
+	if total == 0 {
+		return 0
+	}
+
+	linked := 0
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			linked += len(collapseWhitespace(textContent(c)))
+			return
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return float64(linked) / float64(total)
+}
+
+// blockText renders an element's text with one paragraph per block element
+func blockText(n *html.Node) string {
+	var (
+		paragraphs []string
+		current    strings.Builder
+	)
+	flush := func() {
+		if text := collapseWhitespace(current.String()); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+		current.Reset()
+	}
+
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		switch c.Type {
+		case html.TextNode:
+			current.WriteString(c.Data)
+			current.WriteString(" ")
+		case html.ElementNode, html.DocumentNode:
+			block := blockTags[c.DataAtom]
+			if block {
+				flush()
+			}
+			for child := c.FirstChild; child != nil; child = child.NextSibling {
+				walk(child)
+			}
+			if block {
+				flush()
+			}
+		}
+	}
+	walk(n)
+	flush()
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// textContent concatenates all text below n
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+			b.WriteString(" ")
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// findElement returns the first element of the given type in document order
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func attr(n *html.Node, key string) string {
+	value, _ := findAttr(n, key)
+	return value
+}
+
+// firstAttr returns the first non-empty value among the given attributes
+func firstAttr(n *html.Node, keys ...string) string {
+	for _, key := range keys {
+		if value := strings.TrimSpace(attr(n, key)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func collapseWhitespace(s string) string {
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(s, " "))
+}
@@ -0,0 +1,340 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/your-org/ai-sa-assistant/internal/lru"
+)
+
+const (
+	// DefaultFetchTimeout bounds a single page fetch, including redirects
+	DefaultFetchTimeout = 5 * time.Second
+	// DefaultMaxPageBytes caps how much of a page body is read
+	DefaultMaxPageBytes = 1 << 20
+	// DefaultUserAgent identifies the fetcher to sites and in robots.txt matching
+	DefaultUserAgent = "ai-sa-assistant/1.0 (+https://github.com/your-org/ai-sa-assistant)"
+	// maxFetchRedirects limits the redirects followed for a single page
+	maxFetchRedirects = 5
+	// maxRobotsBytes caps how much of a robots.txt file is read
+	maxRobotsBytes = 512 << 10
+	// robotsCacheTTL is how long a host's robots.txt rules are reused. RFC 9309 asks
+	// crawlers not to use a cached copy for more than 24 hours.
+	robotsCacheTTL = 24 * time.Hour
+	// maxRobotsHosts caps the number of hosts whose robots.txt rules are cached
+	maxRobotsHosts = 1000
+)
+
+var (
+	// ErrDomainNotAllowed is returned when a URL's host is outside the fetch allow-list
+	ErrDomainNotAllowed = errors.New("domain not in fetch allow-list")
+	// ErrDisallowedByRobots is returned when robots.txt forbids fetching a URL
+	ErrDisallowedByRobots = errors.New("fetch disallowed by robots.txt")
+	// ErrUnsupportedContent is returned for non-HTML and non-text responses
+	ErrUnsupportedContent = errors.New("unsupported content type")
+	// ErrAddressNotAllowed is returned when a page resolves to a loopback, private or link-local address
+	ErrAddressNotAllowed = errors.New("address not allowed for page fetch")
+)
+
+// sharedAddressSpace is the RFC 6598 carrier-grade NAT range, which is not public either
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// FetchConfig controls how result pages are fetched
+type FetchConfig struct {
+	// Timeout bounds each page fetch. Defaults to DefaultFetchTimeout.
+	Timeout time.Duration
+	// MaxBytes caps the page body size; longer pages are truncated. Defaults to DefaultMaxPageBytes.
+	MaxBytes int64
+	// AllowedDomains restricts fetching to these domains and their subdomains. Empty allows any domain.
+	AllowedDomains []string
+	// RespectRobots checks each host's robots.txt before fetching
+	RespectRobots bool
+	// UserAgent is sent with every request. Defaults to DefaultUserAgent.
+	UserAgent string
+	// AllowPrivateNetworks permits fetching loopback, private and link-local addresses.
+	// Leave it off for internet search results: anyone who controls a result or a
+	// redirect could otherwise reach internal services such as cloud metadata endpoints.
+	AllowPrivateNetworks bool
+}
+
+// Page is the readable content extracted from a fetched result page
+type Page struct {
+	URL       string
+	Title     string
+	Text      string
+	Published string
+	// Truncated reports whether the body exceeded the size cap
+	Truncated bool
+}
+
+// PageFetcher downloads result pages and extracts their main content
+type PageFetcher struct {
+	cfg        FetchConfig
+	httpClient *http.Client
+
+	robots *lru.Cache[*robotsRules]
+}
+
+// NewPageFetcher creates a page fetcher. The HTTP client is copied so redirects can
+// be checked against the allow-list, and unless private networks are allowed its
+// transport refuses to connect to non-public addresses. Because that check runs on
+// the resolved address at dial time it also covers redirects and DNS rebinding.
+func NewPageFetcher(cfg FetchConfig, httpClient *http.Client) *PageFetcher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultFetchTimeout
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxPageBytes
+	}
+	if strings.TrimSpace(cfg.UserAgent) == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+	domains := make([]string, 0, len(cfg.AllowedDomains))
+	for _, domain := range cfg.AllowedDomains {
+		if domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "."); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	cfg.AllowedDomains = domains
+
+	client := &http.Client{}
+	if httpClient != nil {
+		*client = *httpClient
+	}
+	if !cfg.AllowPrivateNetworks {
+		client.Transport = publicOnlyTransport(client.Transport)
+	}
+	f := &PageFetcher{
+		cfg:        cfg,
+		httpClient: client,
+		robots:     lru.New[*robotsRules](maxRobotsHosts, robotsCacheTTL),
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxFetchRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxFetchRedirects)
+		}
+		return f.checkURL(req.URL)
+	}
+	return f
+}
+
+// Fetch downloads the page at rawURL and extracts its readable content
+func (f *PageFetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid page URL %q: %w", rawURL, err)
+	}
+	if err := f.checkURL(target); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.cfg.Timeout)
+	defer cancel()
+
+	if f.cfg.RespectRobots && !f.robotsAllowed(ctx, target) {
+		return nil, fmt.Errorf("%w: %s", ErrDisallowedByRobots, target)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create page request: %w", err)
+	}
+	req.Header.Set("User-Agent", f.cfg.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.8")
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("page request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("page returned status %d: %s", resp.StatusCode, target)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "text/plain", "":
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContent, mediaType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.cfg.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page body: %w", err)
+	}
+	truncated := int64(len(body)) > f.cfg.MaxBytes
+	if truncated {
+		body = body[:f.cfg.MaxBytes]
+	}
+
+	page := &Page{URL: resp.Request.URL.String(), Truncated: truncated}
+	if mediaType == "text/plain" {
+		page.Text = strings.TrimSpace(string(body))
+		return page, nil
+	}
+
+	article, err := ExtractArticle(strings.NewReader(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract page content: %w", err)
+	}
+	page.Title = article.Title
+	page.Text = article.Text
+	page.Published = normalizePublished(article.Published)
+	return page, nil
+}
+
+// checkURL enforces the scheme and domain allow-list for a page or redirect target
+func (f *PageFetcher) checkURL(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", target.Scheme)
+	}
+	if !DomainAllowed(target.Hostname(), f.cfg.AllowedDomains) {
+		return fmt.Errorf("%w: %s", ErrDomainNotAllowed, target.Hostname())
+	}
+	if !f.cfg.AllowPrivateNetworks {
+		if addr, err := netip.ParseAddr(target.Hostname()); err == nil && !publicAddress(addr) {
+			return fmt.Errorf("%w: %s", ErrAddressNotAllowed, addr)
+		}
+	}
+	return nil
+}
+
+// publicOnlyTransport returns a copy of the base transport whose dialer refuses
+// non-public addresses. Proxies are not used since the dialer would only see the
+// proxy's address, not the page's.
+func publicOnlyTransport(base http.RoundTripper) *http.Transport {
+	transport, ok := base.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	transport.Proxy = nil
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkDialAddress,
+	}
+	transport.DialContext = dialer.DialContext
+	transport.DialTLSContext = nil
+	return transport
+}
+
+// checkDialAddress is a net.Dialer Control function that rejects connections to
+// non-public addresses after DNS resolution
+func checkDialAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, address)
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !publicAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+	}
+	return nil
+}
+
+// publicAddress reports whether addr is a globally routable unicast address
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// DomainAllowed reports whether host is one of the domains or a subdomain of one.
+// An empty domain list allows every host.
+func DomainAllowed(host string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain == "" {
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// robotsAllowed checks the target against its host's robots.txt, fetching and caching
+// the rules on first use. Hosts whose robots.txt is unreachable are treated as disallowed
+// and asked again on the next fetch.
+func (f *PageFetcher) robotsAllowed(ctx context.Context, target *url.URL) bool {
+	host := target.Scheme + "://" + target.Host
+
+	rules, cached := f.robots.Get(host)
+	if !cached {
+		var reachable bool
+		rules, reachable = f.fetchRobots(ctx, host)
+		if !reachable {
+			return false
+		}
+		f.robots.Set(host, rules)
+	}
+
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+	return rules.Allowed(path)
+}
+
+// fetchRobots downloads and parses robots.txt for host and reports whether it was
+// reachable. As in RFC 9309, a missing file (a 4xx status) allows everything, while a
+// network error or server error makes the file unreachable, which disallows everything.
+func (f *PageFetcher) fetchRobots(ctx context.Context, host string) (*robotsRules, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+"/robots.txt", nil)
+	if err != nil {
+		return nil, false
+	}
+	req.Header.Set("User-Agent", f.cfg.UserAgent)
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, false
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, true
+	}
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsBytes), f.cfg.UserAgent), true
+}
@@ -0,0 +1,395 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const articleHTML = `<!DOCTYPE html>
+<html>
+<head>
+  <title>EKS 1.31 | Cloud Blog</title>
+  <meta property="og:title" content="Amazon EKS adds Kubernetes 1.31">
+  <meta property="article:published_time" content="2024-09-26T17:00:00Z">
+  <script>var tracking = "ignore me";</script>
+</head>
+<body>
+  <header><a href="/">Cloud Blog</a> <a href="/products">Products</a></header>
+  <nav class="site-menu"><a href="/a">Compute</a> <a href="/b">Containers</a> <a href="/c">Databases</a></nav>
+  <div class="cookie-banner">We use cookies to improve your experience on this website.</div>
+  <article>
+    <h1>Amazon EKS adds Kubernetes 1.31</h1>
+    <p>Amazon EKS now supports Kubernetes version 1.31 for new clusters, and existing clusters can be upgraded in place.</p>
+    <p>Kubernetes 1.31 graduates AppArmor support to stable, improves persistent volume handling, and removes in-tree cloud provider code.</p>
+    <p>Review the upgrade checklist, including deprecated APIs, before moving production clusters to the new version.</p>
+  </article>
+  <aside class="related-posts"><p>Related: Amazon ECS launches a new capacity provider for batch workloads.</p></aside>
+  <footer><p>Copyright 2024 Cloud Blog. All rights reserved. Terms of use apply.</p></footer>
+</body>
+</html>`
+
+func TestExtractArticle(t *testing.T) {
+	article, err := ExtractArticle(strings.NewReader(articleHTML))
+	require.NoError(t, err)
+
+	assert.Equal(t, "Amazon EKS adds Kubernetes 1.31", article.Title)
+	assert.Equal(t, "2024-09-26T17:00:00Z", article.Published)
+	assert.Contains(t, article.Text, "Amazon EKS now supports Kubernetes version 1.31")
+	assert.Contains(t, article.Text, "AppArmor support to stable")
+
+	for _, boilerplate := range []string{"tracking", "Products", "Containers", "cookies", "Amazon ECS", "Copyright"} {
+		assert.NotContains(t, article.Text, boilerplate)
+	}
+}
+
+func TestExtractArticlePrefersLowLinkDensity(t *testing.T) {
+	page := `<html><head><title>Release notes</title></head><body>
+	<div id="links">
+	  <p><a href="/1">Release note one with a long link text for scoring purposes</a></p>
+	  <p><a href="/2">Release note two with a long link text for scoring purposes</a></p>
+	  <p><a href="/3">Release note three with a long link text for scoring purposes</a></p>
+	</div>
+	<div id="content">
+	  <p>Version 2.4 adds private networking, customer managed keys, and zone redundancy.</p>
+	  <p>Published <time datetime="2024-10-01">October 1</time> by the platform team.</p>
+	</div>
+	</body></html>`
+
+	article, err := ExtractArticle(strings.NewReader(page))
+	require.NoError(t, err)
+	assert.Equal(t, "Release notes", article.Title)
+	assert.Equal(t, "2024-10-01", article.Published)
+	assert.Contains(t, article.Text, "private networking")
+	assert.NotContains(t, article.Text, "Release note one")
+}
+
+func TestParseRobots(t *testing.T) {
+	robots := `
+# Example robots.txt
+User-agent: *
+Disallow: /private/
+Allow: /private/public-*.html$
+
+User-agent: ai-sa-assistant
+Disallow: /drafts
+`
+	rules := parseRobots(strings.NewReader(robots), DefaultUserAgent)
+	assert.False(t, rules.Allowed("/drafts/post"))
+	// The specific group replaces the wildcard group
+	assert.True(t, rules.Allowed("/private/secret"))
+
+	wildcard := parseRobots(strings.NewReader(robots), "other-bot/2.0")
+	assert.False(t, wildcard.Allowed("/private/secret"))
+	assert.True(t, wildcard.Allowed("/private/public-notes.html"))
+	assert.False(t, wildcard.Allowed("/private/public-notes.html?x=1"))
+	assert.True(t, wildcard.Allowed("/blog"))
+
+	var none *robotsRules
+	assert.True(t, none.Allowed("/anything"))
+}
+
+func TestDomainAllowed(t *testing.T) {
+	domains := []string{"aws.amazon.com", ".Microsoft.com"}
+	assert.True(t, DomainAllowed("aws.amazon.com", domains))
+	assert.True(t, DomainAllowed("docs.aws.amazon.com", domains))
+	assert.True(t, DomainAllowed("learn.microsoft.com", domains))
+	assert.False(t, DomainAllowed("notaws.amazon.com.evil.io", domains))
+	assert.False(t, DomainAllowed("fakeaws.amazon.com", []string{"aws.amazon.com"}))
+	assert.True(t, DomainAllowed("example.com", nil))
+}
+
+func newPageServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /blocked\n"))
+	})
+	mux.HandleFunc("/article", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(articleHTML))
+	})
+	mux.HandleFunc("/blocked", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(articleHTML))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(strings.Repeat("kubernetes ", 1000)))
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte{0x89, 'P', 'N', 'G'})
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://elsewhere.example.org/article", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPageFetcher(t *testing.T) {
+	server := newPageServer(t)
+	host, _ := url.Parse(server.URL)
+
+	fetcher := NewPageFetcher(FetchConfig{
+		Timeout:        200 * time.Millisecond,
+		MaxBytes:       100,
+		AllowedDomains: []string{host.Hostname()},
+		RespectRobots:  true,
+		// The test server listens on loopback
+		AllowPrivateNetworks: true,
+	}, server.Client())
+	ctx := context.Background()
+
+	t.Run("extracts article", func(t *testing.T) {
+		large := NewPageFetcher(FetchConfig{RespectRobots: true, AllowPrivateNetworks: true}, server.Client())
+		page, err := large.Fetch(ctx, server.URL+"/article")
+		require.NoError(t, err)
+		assert.Equal(t, "Amazon EKS adds Kubernetes 1.31", page.Title)
+		assert.Equal(t, "2024-09-26", page.Published)
+		assert.Contains(t, page.Text, "AppArmor")
+		assert.False(t, page.Truncated)
+	})
+
+	t.Run("truncates large pages", func(t *testing.T) {
+		page, err := fetcher.Fetch(ctx, server.URL+"/large")
+		require.NoError(t, err)
+		assert.True(t, page.Truncated)
+		assert.LessOrEqual(t, len(page.Text), 100)
+	})
+
+	t.Run("respects robots.txt", func(t *testing.T) {
+		_, err := fetcher.Fetch(ctx, server.URL+"/blocked")
+		assert.True(t, errors.Is(err, ErrDisallowedByRobots))
+	})
+
+	t.Run("rejects domains outside the allow-list", func(t *testing.T) {
+		_, err := fetcher.Fetch(ctx, "https://example.com/article")
+		assert.True(t, errors.Is(err, ErrDomainNotAllowed))
+
+		_, err = fetcher.Fetch(ctx, server.URL+"/redirect")
+		assert.True(t, errors.Is(err, ErrDomainNotAllowed))
+	})
+
+	t.Run("rejects unsupported schemes and content", func(t *testing.T) {
+		_, err := fetcher.Fetch(ctx, "file:///etc/passwd")
+		assert.Error(t, err)
+
+		_, err = fetcher.Fetch(ctx, server.URL+"/image")
+		assert.True(t, errors.Is(err, ErrUnsupportedContent))
+	})
+
+	t.Run("times out slow pages", func(t *testing.T) {
+		start := time.Now()
+		_, err := fetcher.Fetch(ctx, server.URL+"/slow")
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestPageFetcherRobotsAvailability(t *testing.T) {
+	var robotsStatus, robotsRequests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, _ *http.Request) {
+		robotsRequests.Add(1)
+		w.WriteHeader(int(robotsStatus.Load()))
+	})
+	mux.HandleFunc("/article", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(articleHTML))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	ctx := context.Background()
+
+	t.Run("server error disallows and is asked again", func(t *testing.T) {
+		fetcher := NewPageFetcher(FetchConfig{RespectRobots: true, AllowPrivateNetworks: true}, server.Client())
+		robotsStatus.Store(http.StatusServiceUnavailable)
+		robotsRequests.Store(0)
+
+		_, err := fetcher.Fetch(ctx, server.URL+"/article")
+		assert.True(t, errors.Is(err, ErrDisallowedByRobots), "%v", err)
+
+		robotsStatus.Store(http.StatusNotFound)
+		_, err = fetcher.Fetch(ctx, server.URL+"/article")
+		assert.NoError(t, err, "a missing robots.txt allows everything")
+		_, err = fetcher.Fetch(ctx, server.URL+"/article")
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), robotsRequests.Load(), "only reachable robots.txt rules are cached")
+	})
+
+	t.Run("network error disallows", func(t *testing.T) {
+		unreachable := httptest.NewServer(mux)
+		unreachable.Close()
+		fetcher := NewPageFetcher(FetchConfig{RespectRobots: true, AllowPrivateNetworks: true}, unreachable.Client())
+
+		_, err := fetcher.Fetch(ctx, unreachable.URL+"/article")
+		assert.True(t, errors.Is(err, ErrDisallowedByRobots), "%v", err)
+	})
+
+	t.Run("cached rules are bounded", func(t *testing.T) {
+		fetcher := NewPageFetcher(FetchConfig{RespectRobots: true, AllowPrivateNetworks: true}, server.Client())
+		for i := 0; i < maxRobotsHosts+10; i++ {
+			fetcher.robots.Set(fmt.Sprintf("https://host-%d.example.com", i), nil)
+		}
+		assert.Equal(t, maxRobotsHosts, fetcher.robots.Len())
+	})
+}
+
+func TestPageFetcherRejectsNonPublicAddresses(t *testing.T) {
+	server := newPageServer(t)
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	ctx := context.Background()
+
+	// The default empty allow-list permits any domain but never internal addresses
+	fetcher := NewPageFetcher(FetchConfig{}, server.Client())
+
+	for _, target := range []string{
+		server.URL + "/article",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/admin",
+		"http://192.168.1.1/",
+		"http://[::1]" + port + "/article",
+		"http://[::ffff:127.0.0.1]" + port + "/article",
+	} {
+		_, err := fetcher.Fetch(ctx, target)
+		assert.True(t, errors.Is(err, ErrAddressNotAllowed), "%s: %v", target, err)
+	}
+
+	// Host names are checked after DNS resolution, which also covers redirects
+	_, err := fetcher.Fetch(ctx, "http://localhost"+port+"/article")
+	assert.True(t, errors.Is(err, ErrAddressNotAllowed), "localhost: %v", err)
+}
+
+func TestCheckDialAddress(t *testing.T) {
+	for _, address := range []string{
+		"127.0.0.1:80", "10.1.2.3:443", "172.16.0.1:80", "192.168.0.10:80", "169.254.169.254:80",
+		"100.64.0.1:80", "0.0.0.0:80", "[::1]:443", "[fe80::1]:80", "[fd00::1]:80", "[::ffff:10.0.0.1]:80",
+	} {
+		assert.True(t, errors.Is(checkDialAddress("tcp", address, nil), ErrAddressNotAllowed), address)
+	}
+	for _, address := range []string{"93.184.216.34:443", "[2606:2800:220:1:248:1893:25c8:1946]:443"} {
+		assert.NoError(t, checkDialAddress("tcp", address, nil), address)
+	}
+}
+
+type fakeEmbedder struct {
+	vectors map[string][]float32
+	err     error
+}
+
+func (f *fakeEmbedder) GenerateEmbeddings(_ context.Context, texts []string) ([][]float32, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = f.vectors[text]
+	}
+	return embeddings, nil
+}
+
+func TestSplitAndRankPassages(t *testing.T) {
+	page := &Page{
+		URL:       "https://example.com/eks",
+		Title:     "EKS news",
+		Published: "2024-09-26",
+		Text: "Amazon EKS now supports Kubernetes 1.31 for new and existing clusters.\n\n" +
+			"Pricing for the extended support window is billed per cluster hour in every region.\n\n" +
+			"tiny",
+	}
+
+	passages := SplitPassages(page, 100)
+	require.Len(t, passages, 2)
+	assert.Equal(t, page.URL, passages[0].URL)
+	assert.Equal(t, page.Published, passages[1].Published)
+
+	ranked, err := RankPassages(context.Background(), "EKS extended support pricing", passages, nil, 1)
+	require.NoError(t, err)
+	require.Len(t, ranked, 1)
+	assert.Contains(t, ranked[0].Text, "Pricing")
+	assert.InDelta(t, 0.75, ranked[0].Score, 0.001)
+
+	ranked, err = RankPassages(context.Background(), "unrelated words", passages, nil, 3)
+	require.NoError(t, err)
+	assert.Empty(t, ranked)
+
+	embedder := &fakeEmbedder{vectors: map[string][]float32{
+		"which version":  {1, 0},
+		passages[0].Text: {0.9, 0.1},
+		passages[1].Text: {0.1, 0.9},
+	}}
+	ranked, err = RankPassages(context.Background(), "which version", passages, embedder, 2)
+	require.NoError(t, err)
+	require.Len(t, ranked, 2)
+	assert.Contains(t, ranked[0].Text, "Kubernetes 1.31")
+	assert.Greater(t, ranked[0].Score, ranked[1].Score)
+
+	_, err = RankPassages(context.Background(), "which version", passages, &fakeEmbedder{err: errors.New("down")}, 2)
+	assert.Error(t, err)
+}
+
+func TestDomainPolicy(t *testing.T) {
+	results := []Result{
+		{Title: "Blog", URL: "https://blog.example.com/eks"},
+		{Title: "Spam", URL: "https://spam.example.net/eks"},
+		{Title: "AWS", URL: "https://docs.aws.amazon.com/eks/latest/userguide/"},
+		{Title: "Azure", URL: "https://learn.microsoft.com/en-us/azure/aks/"},
+		{Title: "Broken", URL: "://missing-scheme"},
+	}
+
+	policy := DomainPolicy{
+		Deny:      []string{"example.net"},
+		Preferred: []string{"aws.amazon.com", "learn.microsoft.com"},
+	}
+	ranked := policy.Apply(results)
+	require.Len(t, ranked, 3)
+	assert.Equal(t, "AWS", ranked[0].Title)
+	assert.Equal(t, "Azure", ranked[1].Title)
+	assert.Equal(t, "Blog", ranked[2].Title)
+	assert.Equal(t, TrustPreferred, ranked[0].Trust)
+	assert.Equal(t, TrustDefault, ranked[2].Trust)
+
+	allowOnly := DomainPolicy{Allow: []string{"example.com"}, Preferred: []string{"aws.amazon.com"}, Deny: []string{"docs.aws.amazon.com"}}
+	ranked = allowOnly.Apply(results)
+	require.Len(t, ranked, 1)
+	assert.Equal(t, "Blog", ranked[0].Title)
+	assert.Equal(t, TrustAllowed, ranked[0].Trust)
+	assert.True(t, allowOnly.Permits("aws.amazon.com"))
+	assert.False(t, allowOnly.Permits("docs.aws.amazon.com"))
+
+	assert.True(t, DomainPolicy{}.IsEmpty())
+	assert.Len(t, DomainPolicy{}.Apply(results), 4)
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultGoogleEndpoint = "https://www.googleapis.com"
+	googleSearchPath      = "/customsearch/v1"
+	// googleMaxResults is the per-request limit of the Custom Search JSON API
+	googleMaxResults = 10
+)
+
+// googlePublishedMetaTags are the page meta tags checked, in order, for a publication date.
+// Modification times are not publication dates, so pages carrying only those stay undated.
+var googlePublishedMetaTags = []string{
+	"article:published_time", "og:published_time", "datepublished", "date", "dc.date",
+}
+
+// googleProvider searches with the Google Programmable Search Engine JSON API
+type googleProvider struct {
+	apiKey         string
+	searchEngineID string
+	endpoint       string
+	httpClient     *http.Client
+}
+
+// googleResponse is the subset of the Custom Search JSON API response used here
+type googleResponse struct {
+	Items []struct {
+		Title   string `json:"title"`
+		Link    string `json:"link"`
+		Snippet string `json:"snippet"`
+		PageMap struct {
+			MetaTags []map[string]string `json:"metatags"`
+		} `json:"pagemap"`
+	} `json:"items"`
+}
+
+func newGoogleProvider(cfg ProviderConfig, httpClient *http.Client) (*googleProvider, error) {
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("google provider requires an API key")
+	}
+	if cfg.SearchEngineID == "" {
+		return nil, fmt.Errorf("google provider requires a search engine ID")
+	}
+	return &googleProvider{
+		apiKey:         cfg.APIKey,
+		searchEngineID: cfg.SearchEngineID,
+		endpoint:       endpointOrDefault(cfg.Endpoint, defaultGoogleEndpoint),
+		httpClient:     httpClient,
+	}, nil
+}
+
+// Name returns the provider name
+func (p *googleProvider) Name() string {
+	return ProviderGoogle
+}
+
+// Search queries the Google Programmable Search Engine
+func (p *googleProvider) Search(ctx context.Context, query string, opts SearchOptions) ([]Result, error) {
+	maxResults := resolveMaxResults(opts.MaxResults, googleMaxResults)
+
+	params := url.Values{}
+	params.Set("key", p.apiKey)
+	params.Set("cx", p.searchEngineID)
+	params.Set("q", query)
+	params.Set("num", strconv.Itoa(maxResults))
+	if first, last, ok := windowDays(opts.Window); ok {
+		// Restricts results to pages dated within the range
+		params.Set("sort", "date:r:"+strings.ReplaceAll(first, "-", "")+":"+strings.ReplaceAll(last, "-", ""))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+googleSearchPath+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create google request: %w", err)
+	}
+
+	var response googleResponse
+	if err := doJSONRequest(p.httpClient, req, p.Name(), &response); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, item := range response.Items {
+		published := ""
+		for _, metaTags := range item.PageMap.MetaTags {
+			for _, tag := range googlePublishedMetaTags {
+				if value := metaTags[tag]; value != "" && published == "" {
+					published = value
+				}
+			}
+		}
+		results = appendResult(results, Result{
+			Title:     item.Title,
+			URL:       item.Link,
+			Snippet:   item.Snippet,
+			Published: published,
+		}, maxResults)
+	}
+	return results, nil
+}
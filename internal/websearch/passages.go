@@ -0,0 +1,189 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/your-org/ai-sa-assistant/internal/chunker"
+)
+
+const (
+	// DefaultPassageSize is the target passage length in characters
+	DefaultPassageSize = 800
+	// minPassageChars drops fragments too short to be worth citing
+	minPassageChars = 40
+)
+
+// passageStopWords are ignored when ranking passages lexically
+var passageStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "what": true, "how": true,
+	"with": true, "that": true, "this": true, "from": true, "does": true, "about": true,
+	"which": true, "when": true, "where": true, "who": true, "why": true, "can": true,
+	"into": true, "its": true, "our": true, "your": true, "was": true, "were": true,
+}
+
+// Passage is a relevant excerpt of a fetched result page
+type Passage struct {
+	URL       string  `json:"url"`
+	Title     string  `json:"title"`
+	Text      string  `json:"text"`
+	Score     float64 `json:"score"`
+	Published string  `json:"published,omitempty"`
+}
+
+// Embedder creates embeddings for passages and queries
+type Embedder interface {
+	GenerateEmbeddings(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// SplitPassages chunks a page's text into passages of roughly size characters
+func SplitPassages(page *Page, size int) []Passage {
+	if page == nil || strings.TrimSpace(page.Text) == "" {
+		return nil
+	}
+	if size <= 0 {
+		size = DefaultPassageSize
+	}
+
+	var passages []Passage
+	for _, chunk := range chunker.Splitter(page.Text, size) {
+		chunk = collapseWhitespace(chunk)
+		if len(chunk) < minPassageChars {
+			continue
+		}
+		passages = append(passages, Passage{
+			URL:       page.URL,
+			Title:     page.Title,
+			Text:      chunk,
+			Published: page.Published,
+		})
+	}
+	return passages
+}
+
+// RankPassages scores passages against the query and returns the top limit passages.
+// Scores are the cosine similarity of embeddings when an embedder is given, and the
+// share of query terms a passage contains otherwise. Passages sharing no terms with
+// the query are dropped from lexical rankings.
+func RankPassages(ctx context.Context, query string, passages []Passage, embedder Embedder, limit int) ([]Passage, error) {
+	if len(passages) == 0 {
+		return nil, nil
+	}
+
+	ranked := make([]Passage, len(passages))
+	copy(ranked, passages)
+
+	if embedder != nil {
+		texts := make([]string, 0, len(ranked)+1)
+		texts = append(texts, query)
+		for _, passage := range ranked {
+			texts = append(texts, passage.Text)
+		}
+		embeddings, err := embedder.GenerateEmbeddings(ctx, texts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed passages: %w", err)
+		}
+		if len(embeddings) != len(texts) {
+			return nil, fmt.Errorf("expected %d passage embeddings, got %d", len(texts), len(embeddings))
+		}
+		for i := range ranked {
+			ranked[i].Score = cosineSimilarity(embeddings[0], embeddings[i+1])
+		}
+	} else {
+		terms := queryTerms(query)
+		kept := ranked[:0]
+		for _, passage := range ranked {
+			passage.Score = lexicalScore(terms, passage.Text)
+			if passage.Score > 0 {
+				kept = append(kept, passage)
+			}
+		}
+		ranked = kept
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked, nil
+}
+
+// queryTerms returns the distinct lower-cased query words worth matching
+func queryTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range termWords(query) {
+		if len(word) < 2 || passageStopWords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// lexicalScore is the fraction of query terms that appear in text
+func lexicalScore(terms []string, text string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	words := make(map[string]bool)
+	for _, word := range termWords(text) {
+		words[word] = true
+	}
+	matched := 0
+	for _, term := range terms {
+		if words[term] {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(terms))
+}
+
+// termWords splits text into lower-cased words, keeping version numbers like 1.31 whole
+func termWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r == '.' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	words := fields[:0]
+	for _, field := range fields {
+		if field = strings.Trim(field, ".-"); field != "" {
+			words = append(words, field)
+		}
+	}
+	return words
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
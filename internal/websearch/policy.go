@@ -0,0 +1,94 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Domain trust scores assigned by DomainPolicy
+const (
+	// TrustPreferred is the trust of results from preferred domains
+	TrustPreferred = 1.0
+	// TrustAllowed is the trust of results from explicitly allowed domains
+	TrustAllowed = 0.7
+	// TrustDefault is the trust of results from domains the policy does not mention
+	TrustDefault = 0.5
+)
+
+// DomainPolicy decides which result domains are used and ranks them by trust.
+// Each list matches the listed domains and their subdomains.
+type DomainPolicy struct {
+	// Allow restricts results to these domains. Empty allows every domain that is not denied.
+	// Preferred domains are always allowed.
+	Allow []string
+	// Deny drops results from these domains, even when they are also allowed or preferred
+	Deny []string
+	// Preferred domains are trusted most and ranked first
+	Preferred []string
+}
+
+// IsEmpty reports whether the policy neither filters nor reorders results
+func (p DomainPolicy) IsEmpty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0 && len(p.Preferred) == 0
+}
+
+// Trust returns the trust score for a host, or 0 when the policy does not permit it
+func (p DomainPolicy) Trust(host string) float64 {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" || (len(p.Deny) > 0 && DomainAllowed(host, p.Deny)) {
+		return 0
+	}
+	if len(p.Preferred) > 0 && DomainAllowed(host, p.Preferred) {
+		return TrustPreferred
+	}
+	if len(p.Allow) > 0 {
+		if DomainAllowed(host, p.Allow) {
+			return TrustAllowed
+		}
+		return 0
+	}
+	return TrustDefault
+}
+
+// Permits reports whether results from the host may be used
+func (p DomainPolicy) Permits(host string) bool {
+	return p.Trust(host) > 0
+}
+
+// Apply drops results the policy does not permit, sets each remaining result's trust
+// and orders them by trust. Results with equal trust keep the provider's order.
+func (p DomainPolicy) Apply(results []Result) []Result {
+	kept := make([]Result, 0, len(results))
+	for _, result := range results {
+		result.Trust = p.Trust(ResultHost(result.URL))
+		if result.Trust > 0 {
+			kept = append(kept, result)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Trust > kept[j].Trust })
+	return kept
+}
+
+// ResultHost returns the lower-cased host of a result URL, or "" when it cannot be parsed
+func ResultHost(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
@@ -0,0 +1,221 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Supported web search provider names
+const (
+	ProviderBing    = "bing"
+	ProviderBrave   = "brave"
+	ProviderGoogle  = "google"
+	ProviderSearxNG = "searxng"
+)
+
+const (
+	// DefaultMaxResults is the number of results requested when none is specified
+	DefaultMaxResults = 3
+	// maxErrorBodyBytes limits how much of an error response is included in errors
+	maxErrorBodyBytes = 512
+	// maxResponseBytes limits the size of a provider response body
+	maxResponseBytes = 4 << 20
+)
+
+// ErrUnknownProvider is returned when the configured provider name is not supported
+var ErrUnknownProvider = errors.New("unknown web search provider")
+
+// Result is a single web search result returned by a provider
+type Result struct {
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Snippet   string `json:"snippet"`
+	Published string `json:"published,omitempty"`
+	// Trust is the domain trust assigned by a DomainPolicy, 0 until a policy is applied
+	Trust float64 `json:"trust,omitempty"`
+}
+
+// SearchOptions controls a single provider search
+type SearchOptions struct {
+	MaxResults int
+	// Window restricts results to pages published within it. Providers without a date
+	// range parameter ignore it and callers filter with FilterByWindow.
+	Window TimeWindow
+}
+
+// SearchProvider performs live web searches against an external search API
+type SearchProvider interface {
+	// Name returns the provider name used in logs and responses
+	Name() string
+	// Search returns up to opts.MaxResults results for the query
+	Search(ctx context.Context, query string, opts SearchOptions) ([]Result, error)
+}
+
+// ProviderConfig configures a web search provider
+type ProviderConfig struct {
+	Provider string
+	APIKey   string
+	// Endpoint overrides the provider's default API base URL. Required for SearxNG.
+	Endpoint string
+	// SearchEngineID is the Google Programmable Search engine ID (cx)
+	SearchEngineID string
+	// Market is the optional locale hint passed to providers that support it, e.g. en-US
+	Market string
+}
+
+// NewSearchProvider creates the search provider named in cfg
+func NewSearchProvider(cfg ProviderConfig, httpClient *http.Client) (SearchProvider, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(cfg.Provider)) {
+	case ProviderBing:
+		return newBingProvider(cfg, httpClient)
+	case ProviderBrave:
+		return newBraveProvider(cfg, httpClient)
+	case ProviderGoogle:
+		return newGoogleProvider(cfg, httpClient)
+	case ProviderSearxNG:
+		return newSearxNGProvider(cfg, httpClient)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, cfg.Provider)
+	}
+}
+
+// resolveMaxResults applies the default result count and a provider-specific cap
+func resolveMaxResults(requested, limit int) int {
+	if requested <= 0 {
+		requested = DefaultMaxResults
+	}
+	if limit > 0 && requested > limit {
+		return limit
+	}
+	return requested
+}
+
+// endpointOrDefault returns the configured endpoint without a trailing slash, or the default
+func endpointOrDefault(endpoint, defaultEndpoint string) string {
+	if endpoint = strings.TrimSpace(endpoint); endpoint == "" {
+		return defaultEndpoint
+	}
+	return strings.TrimRight(endpoint, "/")
+}
+
+// doJSONRequest executes the request and decodes a successful JSON response into out
+func doJSONRequest(httpClient *http.Client, req *http.Request, provider string, out interface{}) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s search request failed: %w", provider, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return fmt.Errorf("%s search returned status %d: %s",
+			provider, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s search response: %w", provider, err)
+	}
+	return nil
+}
+
+// normalizePublished converts a provider timestamp to a YYYY-MM-DD date when it can be
+// parsed, returning the trimmed original otherwise
+func normalizePublished(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	layouts := []string{
+		time.RFC3339Nano,
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04:05.0000000",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	}
+	for _, layout := range layouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed.Format("2006-01-02")
+		}
+	}
+	return value
+}
+
+// windowDays returns the first and last calendar days of a window as YYYY-MM-DD, or false
+// when either side of the window is open
+func windowDays(window TimeWindow) (first, last string, ok bool) {
+	if window.Start.IsZero() || window.End.IsZero() || !window.End.After(window.Start) {
+		return "", "", false
+	}
+	return window.Start.Format("2006-01-02"), window.End.Add(-time.Nanosecond).Format("2006-01-02"), true
+}
+
+// FilterByWindow drops results published outside the window. Results without a parseable
+// publish date are kept because most pages do not expose one.
+func FilterByWindow(results []Result, window TimeWindow) []Result {
+	if window.IsZero() {
+		return results
+	}
+
+	first, last := "", ""
+	if !window.Start.IsZero() {
+		first = window.Start.Format("2006-01-02")
+	}
+	if !window.End.IsZero() {
+		last = window.End.Add(-time.Nanosecond).Format("2006-01-02")
+	}
+
+	filtered := make([]Result, 0, len(results))
+	for _, result := range results {
+		if _, err := time.Parse("2006-01-02", result.Published); err == nil {
+			// Published dates are normalized to YYYY-MM-DD, which sorts chronologically
+			if (first != "" && result.Published < first) || (last != "" && result.Published > last) {
+				continue
+			}
+		}
+		filtered = append(filtered, result)
+	}
+	return filtered
+}
+
+// appendResult adds a result when it has the title and URL needed for a citation
+func appendResult(results []Result, result Result, maxResults int) []Result {
+	if len(results) >= maxResults {
+		return results
+	}
+	result.Title = strings.TrimSpace(result.Title)
+	result.URL = strings.TrimSpace(result.URL)
+	result.Snippet = strings.TrimSpace(result.Snippet)
+	if result.Title == "" || result.URL == "" {
+		return results
+	}
+	result.Published = normalizePublished(result.Published)
+	return append(results, result)
+}
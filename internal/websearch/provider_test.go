@@ -0,0 +1,201 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/your-org/ai-sa-assistant/internal/websearch/websearchtest"
+)
+
+func fixtureProviderConfigs(server *websearchtest.Server) map[string]ProviderConfig {
+	return map[string]ProviderConfig{
+		ProviderBing:  {Provider: ProviderBing, APIKey: websearchtest.APIKey, Endpoint: server.URL(ProviderBing)},
+		ProviderBrave: {Provider: ProviderBrave, APIKey: websearchtest.APIKey, Endpoint: server.URL(ProviderBrave)},
+		ProviderGoogle: {Provider: ProviderGoogle, APIKey: websearchtest.APIKey,
+			SearchEngineID: websearchtest.SearchEngineID, Endpoint: server.URL(ProviderGoogle)},
+		ProviderSearxNG: {Provider: ProviderSearxNG, Endpoint: server.URL(ProviderSearxNG)},
+	}
+}
+
+func TestSearchProvidersAgainstFixtureServer(t *testing.T) {
+	server := websearchtest.NewServer()
+	defer server.Close()
+
+	for name, cfg := range fixtureProviderConfigs(server) {
+		t.Run(name, func(t *testing.T) {
+			provider, err := NewSearchProvider(cfg, server.Client())
+			require.NoError(t, err)
+			assert.Equal(t, name, provider.Name())
+
+			results, err := provider.Search(context.Background(), "latest EKS release", SearchOptions{MaxResults: 3})
+			require.NoError(t, err)
+			require.Len(t, results, 3)
+
+			expected := websearchtest.DefaultFixtures[0]
+			assert.Equal(t, expected.Title, results[0].Title)
+			assert.Equal(t, expected.URL, results[0].URL)
+			assert.Equal(t, expected.Snippet, results[0].Snippet)
+			assert.Equal(t, "2024-09-26", results[0].Published)
+			assert.Equal(t, "2024-10-01", results[1].Published)
+			assert.Empty(t, results[2].Published)
+		})
+	}
+
+	for _, req := range server.Requests() {
+		assert.Contains(t, req.URL.RawQuery, "q=latest+EKS+release")
+	}
+}
+
+func TestGoogleIgnoresModificationDates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"items": [
+			{"title": "Updated", "link": "https://example.com/updated", "snippet": "s",
+			 "pagemap": {"metatags": [{"og:updated_time": "2025-01-01", "article:modified_time": "2025-01-02"}]}},
+			{"title": "Published", "link": "https://example.com/published", "snippet": "s",
+			 "pagemap": {"metatags": [{"article:modified_time": "2025-01-02", "article:published_time": "2024-09-26"}]}}
+		]}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewSearchProvider(ProviderConfig{Provider: ProviderGoogle, APIKey: "key",
+		SearchEngineID: "engine", Endpoint: server.URL}, server.Client())
+	require.NoError(t, err)
+
+	results, err := provider.Search(context.Background(), "eks", SearchOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Empty(t, results[0].Published)
+	assert.Equal(t, "2024-09-26", results[1].Published)
+}
+
+func TestSearchProviderErrors(t *testing.T) {
+	server := websearchtest.NewServer()
+	defer server.Close()
+
+	for name, cfg := range fixtureProviderConfigs(server) {
+		if name == ProviderSearxNG {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			cfg.APIKey = "wrong-key" // pragma: allowlist secret
+			provider, err := NewSearchProvider(cfg, server.Client())
+			require.NoError(t, err)
+
+			_, err = provider.Search(context.Background(), "latest EKS release", SearchOptions{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), name)
+			assert.Contains(t, err.Error(), "status")
+		})
+	}
+}
+
+func TestNewSearchProviderValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ProviderConfig
+	}{
+		{name: "bing without key", cfg: ProviderConfig{Provider: ProviderBing}},
+		{name: "brave without key", cfg: ProviderConfig{Provider: ProviderBrave}},
+		{name: "google without engine ID", cfg: ProviderConfig{Provider: ProviderGoogle, APIKey: "key"}},
+		{name: "searxng without endpoint", cfg: ProviderConfig{Provider: ProviderSearxNG}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSearchProvider(tt.cfg, nil)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := NewSearchProvider(ProviderConfig{Provider: "duckduckgo"}, nil)
+	assert.True(t, errors.Is(err, ErrUnknownProvider))
+}
+
+func TestAppendResultSkipsIncompleteResults(t *testing.T) {
+	var results []Result
+	results = appendResult(results, Result{Title: "No URL"}, 3)
+	results = appendResult(results, Result{URL: "https://example.com/untitled"}, 3)
+	results = appendResult(results, Result{Title: " Title ", URL: "https://example.com", Published: "2024-01-02"}, 3)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Title", results[0].Title)
+
+	assert.Equal(t, "last week", normalizePublished("last week"))
+	assert.Equal(t, DefaultMaxResults, resolveMaxResults(0, 10))
+	assert.Equal(t, 10, resolveMaxResults(25, 10))
+}
+
+func TestSearchProvidersPassTimeWindow(t *testing.T) {
+	server := websearchtest.NewServer()
+	defer server.Close()
+
+	window := TimeWindow{
+		Start: time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2025, time.October, 1, 0, 0, 0, 0, time.UTC),
+	}
+	expected := map[string]string{
+		ProviderBing:   "freshness=2025-07-01..2025-09-30",
+		ProviderBrave:  "freshness=2025-07-01to2025-09-30",
+		ProviderGoogle: "sort=date:r:20250701:20250930",
+	}
+
+	configs := fixtureProviderConfigs(server)
+	for name, param := range expected {
+		t.Run(name, func(t *testing.T) {
+			provider, err := NewSearchProvider(configs[name], server.Client())
+			require.NoError(t, err)
+
+			_, err = provider.Search(context.Background(), "EKS Q3 2025", SearchOptions{Window: window})
+			require.NoError(t, err)
+
+			requests := server.Requests()
+			rawQuery, err := url.QueryUnescape(requests[len(requests)-1].URL.RawQuery)
+			require.NoError(t, err)
+			assert.Contains(t, rawQuery, param)
+		})
+	}
+}
+
+func TestFilterByWindow(t *testing.T) {
+	results := []Result{
+		{Title: "before", Published: "2025-06-30"},
+		{Title: "first day", Published: "2025-07-01"},
+		{Title: "last day", Published: "2025-09-30"},
+		{Title: "after", Published: "2025-10-01"},
+		{Title: "undated"},
+		{Title: "unparsed", Published: "3 days ago"},
+	}
+	window := TimeWindow{
+		Start: time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2025, time.October, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	var titles []string
+	for _, result := range FilterByWindow(results, window) {
+		titles = append(titles, result.Title)
+	}
+	assert.Equal(t, []string{"first day", "last day", "undated", "unparsed"}, titles)
+	assert.Len(t, FilterByWindow(results, TimeWindow{}), len(results))
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// robotsRule is a single Allow or Disallow line from robots.txt
+type robotsRule struct {
+	allow   bool
+	pattern string
+	matcher *regexp.Regexp
+}
+
+// robotsRules holds the rules that apply to this fetcher's user agent
+type robotsRules struct {
+	rules []robotsRule
+}
+
+// parseRobots parses a robots.txt body, keeping the rules of the most specific group
+// matching userAgent and falling back to the wildcard group
+func parseRobots(body io.Reader, userAgent string) *robotsRules {
+	agentToken := strings.ToLower(strings.SplitN(strings.TrimSpace(userAgent), "/", 2)[0])
+
+	var (
+		specific, wildcard []robotsRule
+		groupAgents        []string
+		inRules            bool
+	)
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		field, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if inRules {
+				groupAgents = nil
+				inRules = false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			// An empty Disallow allows everything and adds no rule
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{allow: field == "allow", pattern: value, matcher: compileRobotsPattern(value)}
+			for _, agent := range groupAgents {
+				switch {
+				case agent == "*":
+					wildcard = append(wildcard, rule)
+				case agentToken != "" && strings.Contains(agentToken, agent):
+					specific = append(specific, rule)
+				}
+			}
+		}
+	}
+
+	if len(specific) > 0 {
+		return &robotsRules{rules: specific}
+	}
+	return &robotsRules{rules: wildcard}
+}
+
+// compileRobotsPattern converts a robots.txt path pattern with * and $ into a regexp
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// Allowed reports whether the path may be fetched. The longest matching rule wins
+// and Allow wins ties, following RFC 9309.
+func (r *robotsRules) Allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+
+	allowed := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !rule.matcher.MatchString(path) {
+			continue
+		}
+		length := len(rule.pattern)
+		if length > longest || (length == longest && rule.allow) {
+			longest = length
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const searxNGSearchPath = "/search"
+
+// searxNGProvider searches a self-hosted SearxNG instance through its JSON output format
+type searxNGProvider struct {
+	apiKey     string
+	endpoint   string
+	language   string
+	httpClient *http.Client
+}
+
+// searxNGResponse is the subset of the SearxNG JSON response used here
+type searxNGResponse struct {
+	Results []struct {
+		Title         string `json:"title"`
+		URL           string `json:"url"`
+		Content       string `json:"content"`
+		PublishedDate string `json:"publishedDate"`
+	} `json:"results"`
+}
+
+func newSearxNGProvider(cfg ProviderConfig, httpClient *http.Client) (*searxNGProvider, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("searxng provider requires an endpoint")
+	}
+	return &searxNGProvider{
+		apiKey:     cfg.APIKey,
+		endpoint:   endpointOrDefault(cfg.Endpoint, ""),
+		language:   cfg.Market,
+		httpClient: httpClient,
+	}, nil
+}
+
+// Name returns the provider name
+func (p *searxNGProvider) Name() string {
+	return ProviderSearxNG
+}
+
+// Search queries the SearxNG instance. SearxNG has no result count or absolute date
+// range parameter, so results are truncated locally and callers filter by window.
+func (p *searxNGProvider) Search(ctx context.Context, query string, opts SearchOptions) ([]Result, error) {
+	maxResults := resolveMaxResults(opts.MaxResults, 0)
+
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("format", "json")
+	if p.language != "" {
+		params.Set("language", p.language)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+searxNGSearchPath+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create searxng request: %w", err)
+	}
+	// Instances behind an authenticating proxy accept a bearer token
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	var response searxNGResponse
+	if err := doJSONRequest(p.httpClient, req, p.Name(), &response); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, item := range response.Results {
+		results = appendResult(results, Result{
+			Title:     item.Title,
+			URL:       item.URL,
+			Snippet:   item.Content,
+			Published: item.PublishedDate,
+		}, maxResults)
+	}
+	return results, nil
+}
@@ -0,0 +1,430 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// futureYearAllowance is how many years ahead a bare year may be and still be read as a
+// date, so roadmap questions work while numbers such as port 2049 are ignored
+const futureYearAllowance = 2
+
+// TimeWindow is the period a query asks about. Start is inclusive and End is exclusive;
+// a zero Start or End leaves that side of the window open.
+type TimeWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// IsZero reports whether the window is unbounded on both sides
+func (w TimeWindow) IsZero() bool {
+	return w.Start.IsZero() && w.End.IsZero()
+}
+
+// Contains reports whether t falls inside the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	if !w.Start.IsZero() && t.Before(w.Start) {
+		return false
+	}
+	if !w.End.IsZero() && !t.Before(w.End) {
+		return false
+	}
+	return true
+}
+
+// IsRecent reports whether the window reaches into the current or previous calendar year
+func (w TimeWindow) IsRecent(now time.Time) bool {
+	return w.End.IsZero() || w.End.After(time.Date(now.Year()-1, time.January, 1, 0, 0, 0, 0, now.Location()))
+}
+
+// union returns the smallest window covering both windows
+func (w TimeWindow) union(other TimeWindow) TimeWindow {
+	if w.IsZero() {
+		return other
+	}
+	if other.Start.IsZero() || (!w.Start.IsZero() && other.Start.Before(w.Start)) {
+		w.Start = other.Start
+	}
+	if other.End.IsZero() || (!w.End.IsZero() && other.End.After(w.End)) {
+		w.End = other.End
+	}
+	return w
+}
+
+// dateKind classifies a date reference for freshness scoring
+type dateKind int
+
+const (
+	dateKindRelative dateKind = iota
+	dateKindQuarter
+	dateKindMonth
+	dateKindYear
+)
+
+// DateReference is a date expression found in a query and the window it resolves to
+type DateReference struct {
+	Text   string     `json:"text"`
+	Window TimeWindow `json:"window"`
+	// Relative is true for expressions anchored to the present, such as "last quarter"
+	// or "since re:Invent"
+	Relative bool `json:"relative"`
+
+	kind  dateKind
+	index int
+}
+
+// dateExpression resolves one form of date expression against the current time
+type dateExpression struct {
+	pattern *regexp.Regexp
+	kind    dateKind
+	resolve func(match []string, now time.Time) (TimeWindow, bool)
+}
+
+// conferenceStart is the approximate opening day of an annual conference
+type conferenceStart struct {
+	month time.Month
+	day   int
+}
+
+const monthNamePattern = `january|february|march|april|may|june|july|august|september|october|november|december|` +
+	`jan|feb|mar|apr|jun|jul|aug|sept|sep|oct|nov|dec`
+
+var (
+	// conferenceStarts are the approximate opening days of the conferences "since <event>"
+	// refers to. Announcements cluster around the keynotes, so a few days either way does
+	// not change which releases are in the window.
+	conferenceStarts = map[string]conferenceStart{
+		"reinvent": {time.December, 1},
+		"ignite":   {time.November, 18},
+		"build":    {time.May, 19},
+		"next":     {time.April, 9},
+	}
+
+	// numberWords are the spelled-out counts accepted in rolling windows
+	numberWords = map[string]int{
+		"a": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+		"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+	}
+
+	// dateExpressions are tried in order. Text matched by an expression is not matched
+	// again, so "since Q3 2025" is not also read as the quarter or the year alone.
+	dateExpressions = []dateExpression{
+		{
+			pattern: regexp.MustCompile(`(?i)\bsince\s+(?:the\s+(?:last\s+)?)?(?:(?:aws|microsoft|google)\s+)?` +
+				`(re:?\s?invent|ignite|build|(?:google\s+)?cloud\s+next|google\s+next)(?:\s+(20\d{2}))?\b`),
+			kind:    dateKindRelative,
+			resolve: resolveSinceEvent,
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)\bsince\s+(?:the\s+)?(?:(q[1-4]|h[12])|(` + monthNamePattern + `)\.?)` +
+				`(?:\s+(20\d{2}))?\b`),
+			kind:    dateKindRelative,
+			resolve: resolveSincePeriod,
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)\bsince\s+(20\d{2})\b`),
+			kind:    dateKindRelative,
+			resolve: resolveSinceYear,
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)\b(?:last|past|previous|trailing)\s+` +
+				`(\d{1,3}|a|one|two|three|four|five|six|seven|eight|nine|ten|eleven|twelve)\s+` +
+				`(day|week|month|quarter|year)s?\b`),
+			kind:    dateKindRelative,
+			resolve: resolveRolling,
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)\b(?:past|trailing)\s+(day|week|month|quarter|year)\b`),
+			kind:    dateKindRelative,
+			resolve: resolveRollingOne,
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)\b(this|current|last|previous|prior)\s+(week|month|quarter|year)\b`),
+			kind:    dateKindRelative,
+			resolve: resolveCalendarPeriod,
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)\b(today|yesterday)\b`),
+			kind:    dateKindRelative,
+			resolve: resolveDay,
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)\b(?:ytd|year[\s-]to[\s-]date)\b`),
+			kind:    dateKindRelative,
+			resolve: func(_ []string, now time.Time) (TimeWindow, bool) {
+				return TimeWindow{Start: periodStart(now, "year"), End: now}, true
+			},
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)\b(q[1-4]|h[12])\s+(20\d{2})\b`),
+			kind:    dateKindQuarter,
+			resolve: func(match []string, now time.Time) (TimeWindow, bool) {
+				return resolvePeriodOfYear(match[1], match[2], now)
+			},
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)\b(20\d{2})[\s-]?(q[1-4]|h[12])\b`),
+			kind:    dateKindQuarter,
+			resolve: func(match []string, now time.Time) (TimeWindow, bool) {
+				return resolvePeriodOfYear(match[2], match[1], now)
+			},
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)\b(` + monthNamePattern + `)\.?\s+(20\d{2})\b`),
+			kind:    dateKindMonth,
+			resolve: resolveMonthOfYear,
+		},
+		{
+			pattern: regexp.MustCompile(`\b(20\d{2})\b`),
+			kind:    dateKindYear,
+			resolve: resolveYear,
+		},
+	}
+)
+
+// FindDateReferences returns the absolute and relative date expressions in the query,
+// resolved against now, in the order they appear
+func FindDateReferences(query string, now time.Time) []DateReference {
+	// Matched text is blanked out with spaces so later expressions cannot match it again
+	// and byte offsets still line up with the original query
+	remaining := []byte(query)
+	var references []DateReference
+
+	for _, expression := range dateExpressions {
+		for _, loc := range expression.pattern.FindAllSubmatchIndex(remaining, -1) {
+			match := make([]string, len(loc)/2)
+			for i := range match {
+				if loc[2*i] >= 0 {
+					match[i] = query[loc[2*i]:loc[2*i+1]]
+				}
+			}
+
+			window, ok := expression.resolve(match, now)
+			if !ok {
+				continue
+			}
+			references = append(references, DateReference{
+				Text:     match[0],
+				Window:   window,
+				Relative: expression.kind == dateKindRelative,
+				kind:     expression.kind,
+				index:    loc[0],
+			})
+			for i := loc[0]; i < loc[1]; i++ {
+				remaining[i] = ' '
+			}
+		}
+	}
+
+	sort.SliceStable(references, func(i, j int) bool {
+		return references[i].index < references[j].index
+	})
+	return references
+}
+
+// RequestedWindow returns the smallest window covering every date reference in the
+// query, or false when the query does not mention a date
+func RequestedWindow(query string, now time.Time) (TimeWindow, bool) {
+	return windowOf(FindDateReferences(query, now))
+}
+
+// windowOf returns the smallest window covering the references
+func windowOf(references []DateReference) (TimeWindow, bool) {
+	if len(references) == 0 {
+		return TimeWindow{}, false
+	}
+	window := references[0].Window
+	for _, reference := range references[1:] {
+		window = window.union(reference.Window)
+	}
+	return window, true
+}
+
+func resolveSinceEvent(match []string, now time.Time) (TimeWindow, bool) {
+	event := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(match[1]))
+	if strings.HasSuffix(event, "next") {
+		event = "next"
+	}
+
+	start, ok := conferenceStarts[event]
+	if !ok {
+		return TimeWindow{}, false
+	}
+	return sinceWindow(anchorDate(start.month, start.day, match[2], now), now)
+}
+
+func resolveSincePeriod(match []string, now time.Time) (TimeWindow, bool) {
+	var month time.Month
+	if period := strings.ToLower(match[1]); period != "" {
+		month = periodStartMonth(period)
+	} else {
+		month = monthNumber(match[2])
+	}
+	return sinceWindow(anchorDate(month, 1, match[3], now), now)
+}
+
+func resolveSinceYear(match []string, now time.Time) (TimeWindow, bool) {
+	year, _ := strconv.Atoi(match[1])
+	return sinceWindow(time.Date(year, time.January, 1, 0, 0, 0, 0, now.Location()), now)
+}
+
+func resolveRolling(match []string, now time.Time) (TimeWindow, bool) {
+	count, ok := numberWords[strings.ToLower(match[1])]
+	if !ok {
+		var err error
+		if count, err = strconv.Atoi(match[1]); err != nil || count <= 0 {
+			return TimeWindow{}, false
+		}
+	}
+	return TimeWindow{Start: addUnits(now, strings.ToLower(match[2]), -count), End: now}, true
+}
+
+func resolveRollingOne(match []string, now time.Time) (TimeWindow, bool) {
+	return TimeWindow{Start: addUnits(now, strings.ToLower(match[1]), -1), End: now}, true
+}
+
+func resolveCalendarPeriod(match []string, now time.Time) (TimeWindow, bool) {
+	unit := strings.ToLower(match[2])
+	current := periodStart(now, unit)
+
+	switch strings.ToLower(match[1]) {
+	case "this", "current":
+		return TimeWindow{Start: current, End: now}, true
+	default:
+		return TimeWindow{Start: addUnits(current, unit, -1), End: current}, true
+	}
+}
+
+func resolveDay(match []string, now time.Time) (TimeWindow, bool) {
+	today := periodStart(now, "day")
+	if strings.EqualFold(match[1], "yesterday") {
+		return TimeWindow{Start: today.AddDate(0, 0, -1), End: today}, true
+	}
+	return TimeWindow{Start: today, End: now}, true
+}
+
+// resolvePeriodOfYear resolves a quarter (Q1-Q4) or half (H1-H2) of a year
+func resolvePeriodOfYear(period, yearText string, now time.Time) (TimeWindow, bool) {
+	year, _ := strconv.Atoi(yearText)
+	period = strings.ToLower(period)
+	start := time.Date(year, periodStartMonth(period), 1, 0, 0, 0, 0, now.Location())
+
+	months := 3
+	if period[0] == 'h' {
+		months = 6
+	}
+	return TimeWindow{Start: start, End: start.AddDate(0, months, 0)}, true
+}
+
+func resolveMonthOfYear(match []string, now time.Time) (TimeWindow, bool) {
+	year, _ := strconv.Atoi(match[2])
+	start := time.Date(year, monthNumber(match[1]), 1, 0, 0, 0, 0, now.Location())
+	return TimeWindow{Start: start, End: start.AddDate(0, 1, 0)}, true
+}
+
+func resolveYear(match []string, now time.Time) (TimeWindow, bool) {
+	year, _ := strconv.Atoi(match[1])
+	if year > now.Year()+futureYearAllowance {
+		return TimeWindow{}, false
+	}
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, now.Location())
+	return TimeWindow{Start: start, End: start.AddDate(1, 0, 0)}, true
+}
+
+// sinceWindow returns the window from start to now, rejecting anchors in the future
+func sinceWindow(start, now time.Time) (TimeWindow, bool) {
+	if start.After(now) {
+		return TimeWindow{}, false
+	}
+	return TimeWindow{Start: start, End: now}, true
+}
+
+// anchorDate returns the given day in the named year, or its latest occurrence at or
+// before now when no year is given
+func anchorDate(month time.Month, day int, yearText string, now time.Time) time.Time {
+	if yearText != "" {
+		year, _ := strconv.Atoi(yearText)
+		return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	}
+	anchor := time.Date(now.Year(), month, day, 0, 0, 0, 0, now.Location())
+	if anchor.After(now) {
+		anchor = anchor.AddDate(-1, 0, 0)
+	}
+	return anchor
+}
+
+// periodStartMonth returns the first month of a quarter (q1-q4) or half (h1-h2)
+func periodStartMonth(period string) time.Month {
+	index := int(period[1] - '1')
+	if period[0] == 'h' {
+		return time.Month(index*6 + 1)
+	}
+	return time.Month(index*3 + 1)
+}
+
+// monthNumber converts a full or abbreviated month name
+func monthNumber(name string) time.Month {
+	prefix := strings.ToLower(name)[:3]
+	for month := time.January; month <= time.December; month++ {
+		if strings.HasPrefix(strings.ToLower(month.String()), prefix) {
+			return month
+		}
+	}
+	return time.January
+}
+
+// periodStart returns the start of the day, week (Monday), month, quarter or year containing t
+func periodStart(t time.Time, unit string) time.Time {
+	year, month, day := t.Date()
+	switch unit {
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case "month":
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	case "quarter":
+		return time.Date(year, month-(month-1)%3, 1, 0, 0, 0, 0, t.Location())
+	case "year":
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// addUnits moves t by count days, weeks, months, quarters or years
+func addUnits(t time.Time, unit string, count int) time.Time {
+	switch unit {
+	case "week":
+		return t.AddDate(0, 0, 7*count)
+	case "month":
+		return t.AddDate(0, count, 0)
+	case "quarter":
+		return t.AddDate(0, 3*count, 0)
+	case "year":
+		return t.AddDate(count, 0, 0)
+	default:
+		return t.AddDate(0, 0, count)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websearch
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestFindDateReferences(t *testing.T) {
+	// A Wednesday in the third quarter
+	now := time.Date(2026, time.August, 12, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		query    string
+		text     string
+		start    time.Time
+		end      time.Time
+		relative bool
+	}{
+		{"EKS changes in Q3 2025", "Q3 2025", date(2025, time.July, 1), date(2025, time.October, 1), false},
+		{"Bedrock roadmap for H2 2026", "H2 2026", date(2026, time.July, 1), date(2027, time.January, 1), false},
+		{"Azure news from 2025-Q1", "2025-Q1", date(2025, time.January, 1), date(2025, time.April, 1), false},
+		{"GKE release in June 2025", "June 2025", date(2025, time.June, 1), date(2025, time.July, 1), false},
+		{"Pricing as of Sept. 2025", "Sept. 2025", date(2025, time.September, 1), date(2025, time.October, 1), false},
+		{"Services retired in 2024", "2024", date(2024, time.January, 1), date(2025, time.January, 1), false},
+		{"What shipped last quarter?", "last quarter", date(2026, time.April, 1), date(2026, time.July, 1), true},
+		{"Announcements this quarter", "this quarter", date(2026, time.July, 1), now, true},
+		{"Changes last month", "last month", date(2026, time.July, 1), date(2026, time.August, 1), true},
+		{"Outages last year", "last year", date(2025, time.January, 1), date(2026, time.January, 1), true},
+		{"Updates over the past year", "past year", date(2025, time.August, 12).Add(15*time.Hour + 30*time.Minute), now, true},
+		{"Releases in the last 30 days", "last 30 days", now.AddDate(0, 0, -30), now, true},
+		{"Releases in the past two weeks", "past two weeks", now.AddDate(0, 0, -14), now, true},
+		{"Updates this week", "this week", date(2026, time.August, 10), now, true},
+		{"What launched yesterday", "yesterday", date(2026, time.August, 11), date(2026, time.August, 12), true},
+		{"Spend year-to-date", "year-to-date", date(2026, time.January, 1), now, true},
+		{"Lambda features since re:Invent", "since re:Invent", date(2025, time.December, 1), now, true},
+		{"Azure changes since Ignite 2024", "since Ignite 2024", date(2024, time.November, 18), now, true},
+		{"New models since Google Cloud Next", "since Google Cloud Next", date(2026, time.April, 9), now, true},
+		{"Copilot updates since Build", "since Build", date(2026, time.May, 19), now, true},
+		{"Updates since March", "since March", date(2026, time.March, 1), now, true},
+		{"Updates since October", "since October", date(2025, time.October, 1), now, true},
+		{"Updates since Q4 2025", "since Q4 2025", date(2025, time.October, 1), now, true},
+		{"Deprecations since 2023", "since 2023", date(2023, time.January, 1), now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			references := FindDateReferences(tt.query, now)
+			if len(references) != 1 {
+				t.Fatalf("FindDateReferences(%q) = %v, want one reference", tt.query, references)
+			}
+
+			reference := references[0]
+			if reference.Text != tt.text {
+				t.Errorf("Text = %q, want %q", reference.Text, tt.text)
+			}
+			if !reference.Window.Start.Equal(tt.start) || !reference.Window.End.Equal(tt.end) {
+				t.Errorf("Window = %v - %v, want %v - %v",
+					reference.Window.Start, reference.Window.End, tt.start, tt.end)
+			}
+			if reference.Relative != tt.relative {
+				t.Errorf("Relative = %v, want %v", reference.Relative, tt.relative)
+			}
+		})
+	}
+}
+
+func TestFindDateReferencesIgnoresNonDates(t *testing.T) {
+	now := date(2026, time.August, 12)
+
+	queries := []string{
+		"Explain cloud computing basics",
+		"Open port 2049 for EFS mounts",
+		"Upgrade from Q3 to the next tier",
+		"Since the migration, latency improved",
+		"Since re:Invent 2030 there will be new regions",
+	}
+	for _, query := range queries {
+		if references := FindDateReferences(query, now); len(references) != 0 {
+			t.Errorf("FindDateReferences(%q) = %v, want none", query, references)
+		}
+	}
+}
+
+func TestRequestedWindow(t *testing.T) {
+	now := date(2026, time.August, 12)
+
+	window, ok := RequestedWindow("Compare Q1 2025 with June 2025 and 2026", now)
+	if !ok {
+		t.Fatal("Expected a requested window")
+	}
+	if !window.Start.Equal(date(2025, time.January, 1)) || !window.End.Equal(date(2027, time.January, 1)) {
+		t.Errorf("RequestedWindow = %v - %v, want 2025-01-01 - 2027-01-01", window.Start, window.End)
+	}
+
+	if _, ok := RequestedWindow("Latest AKS features", now); ok {
+		t.Error("Expected no requested window without dates")
+	}
+}
+
+func TestTimeWindowContains(t *testing.T) {
+	window := TimeWindow{Start: date(2025, time.July, 1), End: date(2025, time.October, 1)}
+
+	if !window.Contains(date(2025, time.July, 1)) {
+		t.Error("Expected the start to be inside the window")
+	}
+	if window.Contains(date(2025, time.October, 1)) {
+		t.Error("Expected the end to be outside the window")
+	}
+	if window.Contains(date(2025, time.June, 30)) {
+		t.Error("Expected dates before the start to be outside the window")
+	}
+
+	openEnded := TimeWindow{Start: date(2025, time.July, 1)}
+	if !openEnded.Contains(date(2030, time.January, 1)) {
+		t.Error("Expected an open-ended window to contain later dates")
+	}
+	if !(TimeWindow{}).Contains(date(1999, time.January, 1)) {
+		t.Error("Expected an unbounded window to contain every date")
+	}
+}
+
+func TestTimeWindowIsRecent(t *testing.T) {
+	now := date(2026, time.August, 12)
+
+	if !(TimeWindow{Start: date(2025, time.January, 1), End: date(2026, time.January, 1)}).IsRecent(now) {
+		t.Error("Expected the previous year to be recent")
+	}
+	if (TimeWindow{Start: date(2024, time.October, 1), End: date(2025, time.January, 1)}).IsRecent(now) {
+		t.Error("Expected Q4 two years ago to be historical")
+	}
+}
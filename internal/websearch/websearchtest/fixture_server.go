@@ -0,0 +1,218 @@
+// Copyright 2024 AI SA Assistant Project
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package websearchtest provides a local fixture server that stands in for the
+// Bing, Brave, Google Programmable Search and SearxNG APIs in tests.
+package websearchtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const (
+	// APIKey is the key the fixture server accepts for every provider
+	APIKey = "fixture-api-key" // pragma: allowlist secret
+	// SearchEngineID is the Google search engine ID the fixture server accepts
+	SearchEngineID = "fixture-cx"
+)
+
+// Fixture is a canned search result served by every provider endpoint
+type Fixture struct {
+	Title     string
+	URL       string
+	Snippet   string
+	Published string
+}
+
+// DefaultFixtures are the results served when no fixtures are given
+var DefaultFixtures = []Fixture{
+	{
+		Title:     "Amazon EKS announces support for Kubernetes 1.31",
+		URL:       "https://aws.amazon.com/about-aws/whats-new/2024/09/amazon-eks-kubernetes-1-31/",
+		Snippet:   "Amazon EKS now supports Kubernetes version 1.31 for new and existing clusters.",
+		Published: "2024-09-26T17:00:00Z",
+	},
+	{
+		Title:     "Azure Kubernetes Service release notes",
+		URL:       "https://learn.microsoft.com/en-us/azure/aks/release-notes",
+		Snippet:   "The latest features, fixes and deprecations for Azure Kubernetes Service.",
+		Published: "2024-10-01",
+	},
+	{
+		Title:   "Google Kubernetes Engine release notes",
+		URL:     "https://cloud.google.com/kubernetes-engine/docs/release-notes",
+		Snippet: "This page documents production updates to Google Kubernetes Engine.",
+	},
+	{
+		Title:   "Kubernetes v1.31 release blog",
+		URL:     "https://kubernetes.io/blog/2024/08/13/kubernetes-v1-31-release/",
+		Snippet: "Kubernetes v1.31 is the second release of 2024.",
+	},
+}
+
+// Server is a fixture server for the supported web search providers. Each provider
+// is served under its own path prefix, e.g. Server.URL("bing").
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	fixtures []Fixture
+	requests []*http.Request
+}
+
+// NewServer starts a fixture server returning the given fixtures, or DefaultFixtures
+// when none are given. Callers must Close the server.
+func NewServer(fixtures ...Fixture) *Server {
+	if len(fixtures) == 0 {
+		fixtures = DefaultFixtures
+	}
+	s := &Server{fixtures: fixtures}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bing/v7.0/search", s.handleBing)
+	mux.HandleFunc("/brave/res/v1/web/search", s.handleBrave)
+	mux.HandleFunc("/google/customsearch/v1", s.handleGoogle)
+	mux.HandleFunc("/searxng/search", s.handleSearxNG)
+	s.Server = httptest.NewServer(s.record(mux))
+	return s
+}
+
+// URL returns the endpoint to configure for the named provider
+func (s *Server) URL(provider string) string {
+	return s.Server.URL + "/" + provider
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+// record stores every request before passing it to the provider handler
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Clone(r.Context()))
+		s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleBing(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Ocp-Apim-Subscription-Key") != APIKey {
+		writeError(w, http.StatusUnauthorized, "invalid subscription key")
+		return
+	}
+
+	values := make([]map[string]interface{}, 0, len(s.fixtures))
+	for _, fixture := range s.fixtures {
+		values = append(values, map[string]interface{}{
+			"name":          fixture.Title,
+			"url":           fixture.URL,
+			"snippet":       fixture.Snippet,
+			"datePublished": fixture.Published,
+			// Every page was crawled recently, whatever its publication date
+			"dateLastCrawled": "2099-01-01T00:00:00.0000000Z",
+		})
+	}
+	writeJSON(w, map[string]interface{}{
+		"_type":    "SearchResponse",
+		"webPages": map[string]interface{}{"value": values},
+	})
+}
+
+func (s *Server) handleBrave(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Subscription-Token") != APIKey {
+		writeError(w, http.StatusUnauthorized, "invalid subscription token")
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, len(s.fixtures))
+	for _, fixture := range s.fixtures {
+		results = append(results, map[string]interface{}{
+			"title":       fixture.Title,
+			"url":         fixture.URL,
+			"description": fixture.Snippet,
+			"page_age":    fixture.Published,
+		})
+	}
+	writeJSON(w, map[string]interface{}{
+		"type": "search",
+		"web":  map[string]interface{}{"results": results},
+	})
+}
+
+func (s *Server) handleGoogle(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("key") != APIKey || query.Get("cx") != SearchEngineID {
+		writeError(w, http.StatusForbidden, "invalid API key or search engine ID")
+		return
+	}
+
+	items := make([]map[string]interface{}, 0, len(s.fixtures))
+	for _, fixture := range s.fixtures {
+		item := map[string]interface{}{
+			"title":   fixture.Title,
+			"link":    fixture.URL,
+			"snippet": fixture.Snippet,
+		}
+		if fixture.Published != "" {
+			item["pagemap"] = map[string]interface{}{
+				"metatags": []map[string]string{{"article:published_time": fixture.Published}},
+			}
+		}
+		items = append(items, item)
+	}
+	writeJSON(w, map[string]interface{}{"items": items})
+}
+
+func (s *Server) handleSearxNG(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("format") != "json" {
+		writeError(w, http.StatusForbidden, "format not enabled")
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, len(s.fixtures))
+	for _, fixture := range s.fixtures {
+		result := map[string]interface{}{
+			"title":   fixture.Title,
+			"url":     fixture.URL,
+			"content": fixture.Snippet,
+		}
+		if fixture.Published != "" {
+			result["publishedDate"] = fixture.Published
+		}
+		results = append(results, result)
+	}
+	writeJSON(w, map[string]interface{}{
+		"query":   r.URL.Query().Get("q"),
+		"results": results,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": strings.TrimSpace(message)})
+}